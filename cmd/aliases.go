@@ -13,9 +13,9 @@ func init() {
 		Short: "Alias for 'fleet up'",
 		Long:  `Start all services for environment (alias for 'fleet up').`,
 		Args:  cobra.MaximumNArgs(1),
-		Run:   fleetUpCmd.Run,
+		RunE:  fleetUpCmd.RunE,
 	}
-	upCmd.Flags().AddFlagSet(fleetUpCmd.Flags())
+	addFleetUpFlags(upCmd)
 	rootCmd.AddCommand(upCmd)
 
 	// yar down [env] -> yar fleet down [env]
@@ -24,8 +24,12 @@ func init() {
 		Short: "Alias for 'fleet down'",
 		Long:  `Stop all services (alias for 'fleet down').`,
 		Args:  cobra.MaximumNArgs(1),
-		Run:   fleetDownCmd.Run,
+		RunE:  fleetDownCmd.RunE,
 	}
+	addDryRunFlag(downCmd)
+	addLockFlags(downCmd)
+	addInstanceFlag(downCmd)
+	addHooksFlag(downCmd)
 	rootCmd.AddCommand(downCmd)
 
 	// yar hoist [env] -> yar fleet up [env]
@@ -34,9 +38,9 @@ func init() {
 		Short: "Alias for 'fleet up' (nautical)",
 		Long:  `Start all services for environment (alias for 'fleet up').`,
 		Args:  cobra.MaximumNArgs(1),
-		Run:   fleetUpCmd.Run,
+		RunE:  fleetUpCmd.RunE,
 	}
-	hoistCmd.Flags().AddFlagSet(fleetUpCmd.Flags())
+	addFleetUpFlags(hoistCmd)
 	rootCmd.AddCommand(hoistCmd)
 
 	// yar dock [env] -> yar fleet down [env]
@@ -45,8 +49,12 @@ func init() {
 		Short: "Alias for 'fleet down' (nautical)",
 		Long:  `Stop all services (alias for 'fleet down').`,
 		Args:  cobra.MaximumNArgs(1),
-		Run:   fleetDownCmd.Run,
+		RunE:  fleetDownCmd.RunE,
 	}
+	addDryRunFlag(dockCmd)
+	addLockFlags(dockCmd)
+	addInstanceFlag(dockCmd)
+	addHooksFlag(dockCmd)
 	rootCmd.AddCommand(dockCmd)
 
 	// yar scuttle [env] -> yar fleet destroy [env]
@@ -55,9 +63,9 @@ func init() {
 		Short: "Alias for 'fleet destroy' (nautical)",
 		Long:  `Stop and remove all services, networks, and volumes (alias for 'fleet destroy').`,
 		Args:  cobra.MaximumNArgs(1),
-		Run:   fleetDestroyCmd.Run,
+		RunE:  fleetDestroyCmd.RunE,
 	}
-	scuttleCmd.Flags().AddFlagSet(fleetDestroyCmd.Flags())
+	addFleetDestroyFlags(scuttleCmd)
 	rootCmd.AddCommand(scuttleCmd)
 
 	// yar swab -> yar doctor run --fix-cache
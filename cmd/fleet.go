@@ -1,9 +1,30 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/fleet"
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/network"
+	"github.com/yar-run/yar/internal/packs"
+	"github.com/yar-run/yar/internal/platform"
+	"gopkg.in/yaml.v3"
 )
 
 // Fleet flags
@@ -11,8 +32,37 @@ var (
 	fleetDetach        bool
 	fleetBuild         bool
 	fleetForceRecreate bool
+	fleetAtomic        bool
 	fleetKeepVolumes   bool
 	fleetForce         bool
+
+	fleetLogsFollow     bool
+	fleetLogsSince      string
+	fleetLogsTail       string
+	fleetLogsTimestamps bool
+	fleetLogsGrep       string
+
+	fleetRemote        string
+	fleetLocalServices []string
+
+	fleetForwardAddress string
+	fleetForwardNoHosts bool
+
+	fleetSnapshotName string
+
+	fleetInstance     string
+	fleetAllInstances bool
+
+	fleetNoHooks bool
+)
+
+// Connections to Docker and Kubernetes, and the hosts file; tests replace
+// them.
+var (
+	newDockerClient     = docker.NewClient
+	newKubernetesClient = kubernetes.NewClient
+	newLogReader        = kubernetes.NewLogReader
+	newHosts            = network.NewHosts
 )
 
 var fleetCmd = &cobra.Command{
@@ -27,89 +77,655 @@ var fleetUpCmd = &cobra.Command{
 	Long: `Start all services for the specified environment (default: local).
 
 Bootstraps Colima/VPN/DNS, validates secrets, and starts containers
-in dependency order.`,
+in dependency order.
+
+Ctrl-C stops launching further services. Services that are already running
+are left up, unless --atomic is set, in which case everything created by
+this run is removed again. A second Ctrl-C exits immediately.
+
+On compose environments, every service's pack runs as labeled containers
+on the fleet network. Containers whose spec is unchanged are kept;
+--force-recreate replaces them anyway.
+
+A service that crash-loops or exits during bring-up fails the run at once,
+with its restart count, last exit code and last log lines.
+
+With --remote, only --local-services are started locally. The services
+they require are forwarded from the remote k8s environment under their
+in-cluster names, on this machine and inside the local containers, until
+Ctrl-C.
+
+With --dry-run, the full plan is computed against the live environment and
+the actions that would be taken are printed instead of run; -o json prints
+them as JSON.`,
 	Args: cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
 		env := "local"
 		if len(args) > 0 {
 			env = args[0]
 		}
+		if fleetRemote != "" {
+			return runHybridUp(cmd, args, env, log)
+		}
 		fmt.Printf("fleet up: starting services for environment '%s'\n", env)
-		fmt.Println("  [stub] would validate secrets, start containers in dependency order")
-	},
+
+		proj, driver, err := loadFleetDriver(env, log)
+		if err != nil {
+			return err
+		}
+		registry, err := applyPackParams(cmd, args, proj, log)
+		if err != nil {
+			return err
+		}
+		if err := resolveFleetEnv(proj, env); err != nil {
+			return err
+		}
+		unlock, err := lockFleet(cmd, args, proj, env)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := runFleetHooks(cmd.Context(), proj, env, config.HookPreUp, log); err != nil {
+			return err
+		}
+		if driver != nil {
+			err := driver.Up(cmd.Context(), proj, env, fleet.UpOptions{
+				Build:         fleetBuild,
+				ForceRecreate: fleetForceRecreate,
+				Atomic:        fleetAtomic,
+			})
+			printServiceFailure(err)
+			if err != nil {
+				return err
+			}
+		} else if _, err := startComposeServices(cmd.Context(), proj, registry, env, proj.Services, nil, log); err != nil {
+			return err
+		}
+		return runFleetHooks(cmd.Context(), proj, env, config.HookPostUp, log)
+	}),
 }
 
 var fleetDownCmd = &cobra.Command{
 	Use:   "down [env]",
 	Short: "Stop all services",
-	Long:  `Stop all services. Containers are stopped but not removed.`,
-	Args:  cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Stop all services. Containers are stopped but not removed.
+
+In k8s environments, Deployments and StatefulSets are scaled to zero.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
 		env := "local"
 		if len(args) > 0 {
 			env = args[0]
 		}
 		fmt.Printf("fleet down: stopping services for environment '%s'\n", env)
-		fmt.Println("  [stub] would stop containers in reverse dependency order")
-	},
+
+		proj, driver, err := loadFleetDriver(env, log)
+		if err != nil {
+			return err
+		}
+		unlock, err := lockFleet(cmd, args, proj, env)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := runFleetHooks(cmd.Context(), proj, env, config.HookPreDown, log); err != nil {
+			return err
+		}
+		if driver != nil {
+			if err := driver.Down(cmd.Context(), proj, env, fleet.DownOptions{}); err != nil {
+				return err
+			}
+			return runFleetHooks(cmd.Context(), proj, env, config.HookPostDown, log)
+		}
+
+		// Stop in reverse dependency order, services of pack dependencies
+		// included.
+		waves, err := composeWaves(proj)
+		if err != nil {
+			return err
+		}
+		client, err := newDockerClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		if err := fleet.ComposeStop(cmd.Context(), docker.NewRecordingClient(client, log), proj.Project, env, waves); err != nil {
+			return err
+		}
+		return runFleetHooks(cmd.Context(), proj, env, config.HookPostDown, log)
+	}),
 }
 
 var fleetDestroyCmd = &cobra.Command{
 	Use:   "destroy [env]",
 	Short: "Stop and remove all services, networks, and volumes",
-	Long:  `Stop and remove all services, networks, and volumes.`,
-	Args:  cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Stop and remove all services, networks, and volumes.
+
+Resources are taken from the fleet state record written by 'fleet up', so
+everything created is removed even if yar.yaml has changed since. In k8s
+environments, every object labeled for the project environment is deleted.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
 		env := "local"
 		if len(args) > 0 {
 			env = args[0]
 		}
 		fmt.Printf("fleet destroy: destroying all resources for environment '%s'\n", env)
-		if fleetKeepVolumes {
-			fmt.Println("  [stub] would keep volumes")
+
+		proj, driver, err := loadFleetDriver(env, log)
+		if err != nil {
+			return err
 		}
-		fmt.Println("  [stub] would remove containers, networks, volumes")
-	},
+		unlock, err := lockFleet(cmd, args, proj, env)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		store, st, err := loadFleetState(proj.Project, env)
+		if err != nil {
+			return err
+		}
+		if driver != nil {
+			if err := driver.Destroy(cmd.Context(), proj, env, fleet.DestroyOptions{KeepVolumes: fleetKeepVolumes}); err != nil {
+				return err
+			}
+			// Hosts entries left by a killed 'fleet forward' are recorded
+			// in the state of the k8s environment.
+			if st != nil {
+				if err := destroyRecordedHosts(cmd, args, store, st, log); err != nil {
+					return err
+				}
+			}
+			return runFleetHooks(cmd.Context(), proj, env, config.HookPostDestroy, log)
+		}
+
+		if st == nil {
+			fmt.Println("  no resources recorded for this environment")
+			return nil
+		}
+		if err := destroyRecorded(cmd, args, store, st, log); err != nil {
+			return err
+		}
+		return runFleetHooks(cmd.Context(), proj, env, config.HookPostDestroy, log)
+	}),
 }
 
 var fleetRestartCmd = &cobra.Command{
 	Use:   "restart [env]",
 	Short: "Restart all services",
-	Long:  `Restart all services, applying any config changes.`,
-	Args:  cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Restart all services.
+
+Compose containers are stopped in reverse dependency order and started
+again in dependency order; 'yar fleet up' applies config changes. In k8s
+environments, workloads get a rolling restart.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
 		env := "local"
 		if len(args) > 0 {
 			env = args[0]
 		}
 		fmt.Printf("fleet restart: restarting services for environment '%s'\n", env)
-		fmt.Println("  [stub] would restart containers")
-	},
+
+		proj, driver, err := loadFleetDriver(env, log)
+		if err != nil {
+			return err
+		}
+		unlock, err := lockFleet(cmd, args, proj, env)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if driver != nil {
+			return driver.Restart(cmd.Context(), proj, env, fleet.RestartOptions{})
+		}
+		waves, err := composeWaves(proj)
+		if err != nil {
+			return err
+		}
+		client, err := newDockerClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		return fleet.ComposeRestart(cmd.Context(), docker.NewRecordingClient(client, log), proj.Project, env, waves)
+	}),
+}
+
+// composeWaves returns the services of proj, those of pack dependencies
+// included, in the dependency waves they start in.
+func composeWaves(proj *config.Project) ([][]*config.Service, error) {
+	if _, err := resolvePacks(proj); err != nil {
+		return nil, err
+	}
+	return fleet.Waves(proj.Services)
 }
 
 var fleetStatusCmd = &cobra.Command{
 	Use:   "status [env]",
 	Short: "Show status of all services",
-	Long:  `Show status of all services (running, stopped, health).`,
-	Args:  cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Show status of all services: running, stopped, health, restart counts
+and a derived state (starting, healthy, unhealthy, crash-looping, exited).
+
+Failing services are followed by their last exit code, whether they were
+OOM-killed, and their last log lines.
+
+With --all-instances, every instance of a compose environment started with
+--instance is listed, the default instance first.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
 		env := "local"
 		if len(args) > 0 {
 			env = args[0]
 		}
 		fmt.Printf("fleet status: showing status for environment '%s'\n", env)
-		fmt.Println("  SERVICE              STATUS    REPLICAS    ENDPOINTS")
-		fmt.Println("  [stub] no services configured")
+
+		proj, driver, err := loadFleetDriver(env, nil)
+		if err != nil {
+			return err
+		}
+		if fleetAllInstances {
+			if driver != nil {
+				return fmt.Errorf("environment '%s' uses a k8s cluster; --all-instances is only supported for compose environments", env)
+			}
+			return printInstanceStatuses(cmd.Context(), proj.Project, env)
+		}
+		if driver != nil {
+			status, err := driver.Status(cmd.Context(), proj, env)
+			if err != nil {
+				return err
+			}
+			printFleetStatus(status)
+			return nil
+		}
+
+		client, err := newDockerClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		status, err := fleet.ComposeStatus(cmd.Context(), client, proj.Project, env, fleet.DefaultDiagnosticLogLines)
+		if err != nil {
+			return err
+		}
+		printFleetStatus(status)
+		return nil
+	},
+}
+
+var fleetLogsCmd = &cobra.Command{
+	Use:   "logs [env] [service...]",
+	Short: "Show merged logs of fleet services",
+	Long: `Show the merged stdout/stderr of all selected containers, all replicas
+included, ordered by timestamp and prefixed with a per-service color.
+On k8s environments these are the containers of the fleet's pods.
+
+The first argument is treated as the environment if yar.yaml defines it;
+otherwise the environment defaults to local and all arguments are services.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		proj, err := config.NewLoader().LoadProject()
+		if err != nil {
+			return fmt.Errorf("failed to load project: %w", err)
+		}
+
+		env := "local"
+		services := args
+		if len(args) > 0 {
+			if _, ok := proj.Environments[args[0]]; ok {
+				env = args[0]
+				services = args[1:]
+			}
+		}
+
+		opts := fleet.LogOptions{
+			Follow:     fleetLogsFollow,
+			Since:      fleetLogsSince,
+			Tail:       fleetLogsTail,
+			Timestamps: fleetLogsTimestamps,
+			Color:      colorEnabled(os.Stdout),
+		}
+		if fleetLogsGrep != "" {
+			re, err := regexp.Compile(fleetLogsGrep)
+			if err != nil {
+				return fmt.Errorf("invalid --grep pattern: %w", err)
+			}
+			opts.Grep = re
+		}
+
+		ctx := cmd.Context()
+		proj, driver, err := loadFleetDriver(env, nil)
+		if err != nil {
+			return err
+		}
+		if k8s, ok := driver.(*fleet.K8sDriver); ok {
+			return k8s.Logs(ctx, proj, env, services, opts, os.Stdout)
+		}
+
+		client, err := newDockerClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		sources, err := fleet.SelectLogSources(ctx, client, proj.Project, env, services)
+		if err != nil {
+			return err
+		}
+		if len(sources) == 0 {
+			fmt.Fprintf(os.Stderr, "no containers found for environment '%s'\n", env)
+			return nil
+		}
+
+		return fleet.StreamLogs(ctx, client, sources, opts, os.Stdout)
+	},
+}
+
+var fleetForwardCmd = &cobra.Command{
+	Use:   "forward [env] [service...]",
+	Short: "Forward fleet service ports to this machine",
+	Long: `Forward the declared ports of each selected Kubernetes Service to the
+same port on this machine, through the Kubernetes API. Forwards follow pod
+restarts and rescheduling until Ctrl-C.
+
+Each Service's in-cluster names (<name>.<namespace>, .svc and
+.svc.cluster.local) are added to /etc/hosts as yar-managed entries while
+forwarding, and removed again on exit. Writing /etc/hosts may require sudo;
+without it, forwarding continues on the listen address.
+
+The first argument is treated as the environment if yar.yaml defines it;
+otherwise the environment defaults to local and all arguments are services.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		proj, err := config.NewLoader().LoadProject()
+		if err != nil {
+			return fmt.Errorf("failed to load project: %w", err)
+		}
+
+		env := "local"
+		services := args
+		if len(args) > 0 {
+			if _, ok := proj.Environments[args[0]]; ok {
+				env = args[0]
+				services = args[1:]
+			}
+		}
+
+		cluster, err := environmentCluster(proj, env)
+		if err != nil {
+			return err
+		}
+		if cluster == nil || cluster.Provider != "k8s" {
+			return fmt.Errorf("environment '%s' does not use a k8s cluster; fleet forward only supports k8s environments", env)
+		}
+
+		client, err := newKubernetesClient(
+			kubernetes.WithContext(cluster.Context),
+			kubernetes.WithNamespace(cluster.Namespace),
+		)
+		if err != nil {
+			return err
+		}
+		pf, err := kubernetes.NewPortForwarder(
+			kubernetes.WithContext(cluster.Context),
+			kubernetes.WithNamespace(cluster.Namespace),
+		)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		targets, err := fleet.NewK8sDriver(client).ForwardTargets(ctx, proj, env, services)
+		if err != nil {
+			return err
+		}
+		if len(targets) == 0 {
+			fmt.Fprintf(os.Stderr, "no forwardable services found for environment '%s'\n", env)
+			return nil
+		}
+
+		if !fleetForwardNoHosts {
+			if cleanup := registerForwardHosts(ctx, lockHolder(cmd, args), targets, fleetForwardAddress, proj.Project, env, nil); cleanup != nil {
+				defer cleanup()
+			}
+		}
+
+		forwarder := fleet.NewForwarder(client, pf,
+			fleet.WithForwardAddress(fleetForwardAddress),
+			fleet.WithForwardEvents(forwardEventPrinter(fleetForwardAddress)),
+		)
+		return forwarder.Run(ctx, targets)
+	},
+}
+
+var fleetSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Save and restore volume snapshots",
+	Long: `Save and restore the yar-labelled volumes of a compose environment.
+
+Snapshots are compressed tarballs stored under the yar data directory with a
+manifest of the services' packs. Services owning the volumes are stopped while
+a snapshot is saved or restored and started again afterwards.`,
+}
+
+var fleetSnapshotSaveCmd = &cobra.Command{
+	Use:   "save <name> [env]",
+	Short: "Snapshot the environment's volumes",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, env := args[0], snapshotEnv(args[1:])
+		proj, store, client, err := loadSnapshotTarget(env)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		unlock, err := lockFleet(cmd, args, proj, env)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		manifest, err := store.Save(cmd.Context(), client, proj, env, name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("fleet snapshot: saved '%s' (%d volumes) to %s\n", name, len(manifest.Volumes), store.Path(proj.Project, env, name))
+		return nil
+	},
+}
+
+var fleetSnapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <name> [env]",
+	Short: "Restore the environment's volumes from a snapshot",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, env := args[0], snapshotEnv(args[1:])
+		proj, store, client, err := loadSnapshotTarget(env)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		unlock, err := lockFleet(cmd, args, proj, env)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		manifest, err := store.Restore(cmd.Context(), client, proj, env, name)
+		if err != nil {
+			return err
+		}
+		for _, skew := range manifest.PackSkew(proj, store.PackLock()) {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", skew)
+		}
+		fmt.Printf("fleet snapshot: restored '%s' (%d volumes)\n", name, len(manifest.Volumes))
+		return nil
+	},
+}
+
+var fleetSnapshotListCmd = &cobra.Command{
+	Use:   "list [env]",
+	Short: "List snapshots",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		env := snapshotEnv(args)
+		proj, err := loadFleetProject(env)
+		if err != nil {
+			return err
+		}
+		store, err := fleet.NewSnapshotStore()
+		if err != nil {
+			return err
+		}
+
+		manifests, err := store.List(proj.Project, env)
+		if err != nil {
+			return err
+		}
+		fmt.Println("  NAME                 CREATED                VOLUMES")
+		if len(manifests) == 0 {
+			fmt.Println("  no snapshots")
+			return nil
+		}
+		for _, m := range manifests {
+			fmt.Printf("  %-20s %-22s %d\n", m.Name, m.CreatedAt.Local().Format("2006-01-02 15:04:05"), len(m.Volumes))
+		}
+		return nil
+	},
+}
+
+var fleetSnapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <name> [env]",
+	Short: "Delete a snapshot",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, env := args[0], snapshotEnv(args[1:])
+		proj, err := loadFleetProject(env)
+		if err != nil {
+			return err
+		}
+		store, err := fleet.NewSnapshotStore()
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(proj.Project, env, name); err != nil {
+			return err
+		}
+		fmt.Printf("fleet snapshot: deleted '%s'\n", name)
+		return nil
+	},
+}
+
+var fleetSnapshotExportCmd = &cobra.Command{
+	Use:   "export <name> <file> [env]",
+	Short: "Copy a snapshot to a file to share it",
+	Args:  cobra.RangeArgs(2, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, file, env := args[0], args[1], snapshotEnv(args[2:])
+		proj, err := loadFleetProject(env)
+		if err != nil {
+			return err
+		}
+		store, err := fleet.NewSnapshotStore()
+		if err != nil {
+			return err
+		}
+		if err := store.Export(proj.Project, env, name, file); err != nil {
+			return err
+		}
+		fmt.Printf("fleet snapshot: exported '%s' to %s\n", name, file)
+		return nil
+	},
+}
+
+var fleetSnapshotImportCmd = &cobra.Command{
+	Use:   "import <file> [env]",
+	Short: "Add a shared snapshot file",
+	Long: `Add a snapshot exported by 'yar fleet snapshot export'. The snapshot must
+belong to the current project. Use --name to store it under another name.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, env := args[0], snapshotEnv(args[1:])
+		proj, err := loadFleetProject(env)
+		if err != nil {
+			return err
+		}
+		store, err := fleet.NewSnapshotStore()
+		if err != nil {
+			return err
+		}
+		manifest, err := store.Import(proj.Project, env, file, fleetSnapshotName)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("fleet snapshot: imported '%s' into environment '%s'\n", manifest.Name, env)
+		return nil
 	},
 }
 
 var fleetUpdateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update yar binary and pack catalog",
-	Long:  `Update the yar binary and refresh the pack catalog.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("fleet update: checking for updates")
-		fmt.Println("  [stub] would check for new yar version and update pack catalog")
+	Long: `Update the yar binary and refresh the pack catalog.
+
+Fetches the index of every pack catalog configured under packs.catalogs in
+the global config and keeps a verified copy in the yar cache directory.
+yar pack search, yar pack list --available and yar pack install <name>
+work offline from that copy.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		catalog, sources, err := newPackCatalog()
+		if err != nil {
+			return err
+		}
+		updates := catalog.Update(cmd.Context())
+
+		type updateView struct {
+			packs.CatalogUpdate `yaml:",inline"`
+			Error               string `json:"error,omitempty" yaml:"error,omitempty"`
+		}
+		views := make([]updateView, len(updates))
+		failed := 0
+		for i, u := range updates {
+			views[i] = updateView{CatalogUpdate: u}
+			if u.Err != nil {
+				views[i].Error = u.Err.Error()
+				failed++
+			}
+		}
+
+		switch outputFormat {
+		case "json":
+			data, err := json.MarshalIndent(views, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal catalogs: %w", err)
+			}
+			fmt.Println(string(data))
+		case "yaml":
+			data, err := yaml.Marshal(views)
+			if err != nil {
+				return fmt.Errorf("failed to marshal catalogs: %w", err)
+			}
+			fmt.Print(string(data))
+		default:
+			fmt.Println("fleet update: checking for updates")
+			fmt.Println("  [stub] would check for a new yar version")
+			if len(sources) == 0 {
+				path, _ := config.GlobalConfigPath()
+				fmt.Printf("  no pack catalogs configured; add them under packs.catalogs in %s\n", path)
+			}
+			for _, u := range updates {
+				switch {
+				case u.Err != nil:
+					fmt.Printf("  catalog %-12s failed: %v\n", u.Name, u.Err)
+				case u.Verified != "":
+					fmt.Printf("  catalog %-12s %d packs (verified by %s)\n", u.Name, u.Packs, u.Verified)
+				default:
+					fmt.Printf("  catalog %-12s %d packs\n", u.Name, u.Packs)
+				}
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to update %d of %d pack catalogs", failed, len(updates))
+		}
+		return nil
 	},
 }
 
@@ -117,25 +733,1086 @@ func init() {
 	rootCmd.AddCommand(fleetCmd)
 
 	// fleet up
-	fleetUpCmd.Flags().BoolVar(&fleetDetach, "detach", true, "Run in background")
-	fleetUpCmd.Flags().BoolVar(&fleetBuild, "build", false, "Build images before starting")
-	fleetUpCmd.Flags().BoolVar(&fleetForceRecreate, "force-recreate", false, "Recreate containers even if unchanged")
+	addFleetUpFlags(fleetUpCmd)
 	fleetCmd.AddCommand(fleetUpCmd)
 
 	// fleet down
+	addDryRunFlag(fleetDownCmd)
+	addLockFlags(fleetDownCmd)
+	addInstanceFlag(fleetDownCmd)
+	addHooksFlag(fleetDownCmd)
 	fleetCmd.AddCommand(fleetDownCmd)
 
 	// fleet destroy
-	fleetDestroyCmd.Flags().BoolVar(&fleetKeepVolumes, "keep-volumes", false, "Don't remove volumes")
-	fleetDestroyCmd.Flags().BoolVar(&fleetForce, "force", false, "Skip confirmation prompt")
+	addFleetDestroyFlags(fleetDestroyCmd)
 	fleetCmd.AddCommand(fleetDestroyCmd)
 
 	// fleet restart
+	addDryRunFlag(fleetRestartCmd)
+	addLockFlags(fleetRestartCmd)
+	addInstanceFlag(fleetRestartCmd)
 	fleetCmd.AddCommand(fleetRestartCmd)
 
 	// fleet status
+	addInstanceFlag(fleetStatusCmd)
+	fleetStatusCmd.Flags().BoolVar(&fleetAllInstances, "all-instances", false, "Show every instance of the environment")
+	fleetStatusCmd.MarkFlagsMutuallyExclusive("instance", "all-instances")
 	fleetCmd.AddCommand(fleetStatusCmd)
 
+	// fleet logs
+	fleetLogsCmd.Flags().BoolVarP(&fleetLogsFollow, "follow", "f", false, "Follow log output")
+	fleetLogsCmd.Flags().StringVar(&fleetLogsSince, "since", "", "Show logs since timestamp or relative duration (e.g., 10m)")
+	fleetLogsCmd.Flags().StringVar(&fleetLogsTail, "tail", "all", "Number of lines to show from the end of each container's log")
+	fleetLogsCmd.Flags().BoolVarP(&fleetLogsTimestamps, "timestamps", "t", false, "Show timestamps")
+	fleetLogsCmd.Flags().StringVar(&fleetLogsGrep, "grep", "", "Only show lines matching a regular expression")
+	addInstanceFlag(fleetLogsCmd)
+	fleetCmd.AddCommand(fleetLogsCmd)
+
+	// fleet forward
+	fleetForwardCmd.Flags().StringVar(&fleetForwardAddress, "address", fleet.DefaultForwardAddress, "Local address to listen on")
+	fleetForwardCmd.Flags().BoolVar(&fleetForwardNoHosts, "no-hosts", false, "Don't add service names to /etc/hosts")
+	fleetCmd.AddCommand(fleetForwardCmd)
+
+	// fleet snapshot
+	fleetSnapshotImportCmd.Flags().StringVar(&fleetSnapshotName, "name", "", "Store the snapshot under this name")
+	addLockFlags(fleetSnapshotSaveCmd)
+	addLockFlags(fleetSnapshotRestoreCmd)
+	for _, c := range []*cobra.Command{fleetSnapshotSaveCmd, fleetSnapshotRestoreCmd, fleetSnapshotListCmd,
+		fleetSnapshotDeleteCmd, fleetSnapshotExportCmd, fleetSnapshotImportCmd} {
+		addInstanceFlag(c)
+	}
+	fleetSnapshotCmd.AddCommand(fleetSnapshotSaveCmd, fleetSnapshotRestoreCmd, fleetSnapshotListCmd,
+		fleetSnapshotDeleteCmd, fleetSnapshotExportCmd, fleetSnapshotImportCmd)
+	fleetCmd.AddCommand(fleetSnapshotCmd)
+
 	// fleet update
 	fleetCmd.AddCommand(fleetUpdateCmd)
 }
+
+// addFleetUpFlags registers the 'fleet up' flags on cmd. Aliases call it
+// too, since their init may run before this file's.
+func addFleetUpFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&fleetDetach, "detach", true, "Run in background")
+	cmd.Flags().BoolVar(&fleetBuild, "build", false, "Build images before starting")
+	cmd.Flags().BoolVar(&fleetForceRecreate, "force-recreate", false, "Recreate containers even if unchanged")
+	cmd.Flags().BoolVar(&fleetAtomic, "atomic", false, "Remove everything created by this run if it fails or is interrupted")
+	cmd.Flags().StringVar(&fleetRemote, "remote", "", "k8s environment to forward required services from")
+	cmd.Flags().StringSliceVar(&fleetLocalServices, "local-services", nil, "Services to run locally with --remote (comma-separated)")
+	cmd.Flags().StringVar(&fleetForwardAddress, "address", fleet.DefaultForwardAddress, "Local address for forwards with --remote; loopback means the Docker bridge gateway on Linux")
+	addDryRunFlag(cmd)
+	addLockFlags(cmd)
+	addInstanceFlag(cmd)
+	addHooksFlag(cmd)
+}
+
+// instanceFromBranch is the --instance value naming the instance after the
+// current git branch.
+const instanceFromBranch = "@branch"
+
+// addInstanceFlag registers --instance on a fleet command.
+func addInstanceFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&fleetInstance, "instance", "", "Run as an isolated instance of the fleet ("+instanceFromBranch+" for the git branch name)")
+}
+
+// addFleetDestroyFlags registers the 'fleet destroy' flags on cmd.
+func addFleetDestroyFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&fleetKeepVolumes, "keep-volumes", false, "Don't remove volumes")
+	cmd.Flags().BoolVar(&fleetForce, "force", false, "Skip confirmation prompt")
+	addDryRunFlag(cmd)
+	addLockFlags(cmd)
+	addInstanceFlag(cmd)
+	addHooksFlag(cmd)
+}
+
+// addHooksFlag registers --no-hooks on a fleet command that runs hooks.
+func addHooksFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&fleetNoHooks, "no-hooks", false, "Don't run the lifecycle hooks of yar.yaml")
+}
+
+// loadFleetState returns the state store and the recorded fleet state of
+// project in env, or a nil state if nothing has been recorded yet.
+func loadFleetState(project, env string) (*fleet.StateStore, *fleet.State, error) {
+	store, err := fleet.NewStateStore()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	st, err := store.Load(project, env)
+	if err != nil {
+		var notFound *errors.NotFoundError
+		if stderrors.As(err, &notFound) {
+			return store, nil, nil
+		}
+		return nil, nil, err
+	}
+	return store, st, nil
+}
+
+// destroyRecorded removes the containers, volumes, networks and hosts
+// entries recorded in st through log, dropping each from the record as it
+// goes, and deletes the record once nothing is left. Volumes are kept with
+// --keep-volumes, and so is a network other projects still use. Removal
+// goes on past failures, which are returned together.
+func destroyRecorded(cmd *cobra.Command, args []string, store *fleet.StateStore, st *fleet.State, log *action.Log) error {
+	ctx := cmd.Context()
+	client, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	var driver fleet.ServiceDriver = fleet.NewDockerServiceDriver(client, st.Project, st.Environment, fleet.WithDockerActionLog(log))
+	if !log.DryRun() {
+		driver = fleet.RecordState(driver, store, st.Project, st.Environment)
+	}
+
+	var errs []error
+	for _, res := range st.Resources() {
+		if res.Kind == fleet.ResourceVolume && fleetKeepVolumes {
+			fmt.Printf("  keeping volume %s\n", res.Name)
+			continue
+		}
+		err := driver.Remove(ctx, res)
+		switch {
+		case res.Kind == fleet.ResourceNetwork && docker.IsNetworkInUse(err):
+			fmt.Printf("  keeping network %s: other containers still use it\n", res.Name)
+			if !log.DryRun() {
+				if _, err := store.Update(st.Project, st.Environment, func(cur *fleet.State) error {
+					cur.RemoveResource(res)
+					return nil
+				}); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s %s: %w", res.Kind, res.Name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return stderrors.Join(errs...)
+	}
+	return destroyRecordedHosts(cmd, args, store, st, log)
+}
+
+// destroyRecordedHosts removes the hosts entries recorded in st through
+// log and drops them from the record, which is deleted once nothing is
+// left.
+func destroyRecordedHosts(cmd *cobra.Command, args []string, store *fleet.StateStore, st *fleet.State, log *action.Log) error {
+	if len(st.Hosts) > 0 {
+		names := make([]string, len(st.Hosts))
+		for i, h := range st.Hosts {
+			names[i] = h.Name
+		}
+		unlock, err := lockAs(cmd.Context(), lockHolder(cmd, args), hostsLockName)
+		if err != nil {
+			return err
+		}
+		err = newHosts(network.WithHostsActionLog(log)).Delete(names...)
+		unlock()
+		if err != nil {
+			return err
+		}
+	}
+	if log.DryRun() {
+		return nil
+	}
+	return forgetHosts(store, st.Project, st.Environment, nil)
+}
+
+// forgetHosts drops the named hosts entries, or all of them if names is
+// nil, from the state record of project env, and deletes the record if
+// nothing is left in it.
+func forgetHosts(store *fleet.StateStore, project, env string, names []string) error {
+	left, err := store.Update(project, env, func(st *fleet.State) error {
+		st.Hosts = slices.DeleteFunc(st.Hosts, func(h fleet.HostRecord) bool {
+			return names == nil || slices.Contains(names, h.Name)
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if left.Empty() {
+		return store.Delete(project, env)
+	}
+	return nil
+}
+
+// requireComposeEnvironment returns an error if env targets a Kubernetes
+// cluster, for commands that only have a Docker implementation so far.
+func requireComposeEnvironment(proj *config.Project, env string) error {
+	cluster, err := environmentCluster(proj, env)
+	if err != nil {
+		return err
+	}
+	if cluster != nil && cluster.Provider == "k8s" {
+		return fmt.Errorf("environment '%s' uses a k8s cluster; only compose environments are supported", env)
+	}
+	return nil
+}
+
+// snapshotEnv returns the optional environment argument of a snapshot
+// command, defaulting to local.
+func snapshotEnv(args []string) string {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return "local"
+}
+
+// loadSnapshotTarget loads the project, snapshot store and Docker client for
+// saving or restoring a snapshot of a compose environment.
+func loadSnapshotTarget(env string) (*config.Project, *fleet.SnapshotStore, docker.Client, error) {
+	proj, err := loadFleetProject(env)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := requireComposeEnvironment(proj, env); err != nil {
+		return nil, nil, nil, err
+	}
+	path, err := config.NewLoader().ProjectPath()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	lock, err := packs.ReadProjectLock(filepath.Dir(path))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	store, err := fleet.NewSnapshotStore(fleet.WithSnapshotPackLock(lock))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	client, err := newDockerClient()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return proj, store, client, nil
+}
+
+// environmentCluster returns the global cluster config env targets, or nil
+// if the cluster is not defined there.
+func environmentCluster(proj *config.Project, env string) (*config.ClusterConfig, error) {
+	e, ok := proj.Environments[env]
+	if !ok {
+		return nil, &errors.NotFoundError{
+			Resource: "environment",
+			Name:     env,
+			Message:  "not defined in yar.yaml",
+		}
+	}
+
+	cfg, err := config.NewLoader().LoadGlobal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg.Clusters[e.Cluster], nil
+}
+
+// loadFleetDriver loads the project and returns the driver for env, making
+// its changes through log. The driver is nil for compose environments,
+// which run through startComposeServices.
+func loadFleetDriver(env string, log *action.Log) (*config.Project, fleet.Driver, error) {
+	proj, err := loadFleetProject(env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cluster, err := environmentCluster(proj, env)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cluster == nil || cluster.Provider != "k8s" {
+		return proj, nil, nil
+	}
+
+	opts := []kubernetes.Option{
+		kubernetes.WithContext(cluster.Context),
+		kubernetes.WithNamespace(cluster.Namespace),
+	}
+	client, err := newKubernetesClient(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	logs, err := newLogReader(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proj, fleet.NewK8sDriver(client,
+		fleet.WithManifestRenderer(manifestRenderer{}),
+		fleet.WithLogReader(logs),
+		fleet.WithActionLog(log)), nil
+}
+
+// loadFleetProject loads the project for a fleet command on env, running
+// as the --instance if one is set (see applyInstance).
+func loadFleetProject(env string) (*config.Project, error) {
+	proj, err := config.NewLoader().LoadProject()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load project: %w", err)
+	}
+	if err := applyInstance(proj, env); err != nil {
+		return nil, err
+	}
+	return proj, nil
+}
+
+// applyInstance renames proj to the instance project of --instance (see
+// fleet.InstanceProject), so everything the command creates or finds is
+// kept apart from other instances. --instance @branch names the instance
+// after the current git branch. Instances are compose-only: on k8s, every
+// instance would apply the same object names.
+func applyInstance(proj *config.Project, env string) error {
+	if fleetInstance == "" {
+		return nil
+	}
+	instance := fleetInstance
+	if instance == instanceFromBranch {
+		path, err := config.NewLoader().ProjectPath()
+		if err != nil {
+			return err
+		}
+		branch, err := platform.GitBranch(filepath.Dir(path))
+		if err != nil {
+			return fmt.Errorf("cannot name the instance after the git branch: %w", err)
+		}
+		if instance = fleet.InstanceFromBranch(branch); instance == "" {
+			return fmt.Errorf("cannot name the instance after the git branch: HEAD is detached; use --instance <name>")
+		}
+	}
+	if err := fleet.ValidateInstance(instance); err != nil {
+		return err
+	}
+
+	cluster, err := environmentCluster(proj, env)
+	if err != nil {
+		return err
+	}
+	if cluster != nil && cluster.Provider == "k8s" {
+		return fmt.Errorf("environment '%s' uses a k8s cluster; --instance is only supported for compose environments", env)
+	}
+	proj.Project = fleet.InstanceProject(proj.Project, instance)
+	return nil
+}
+
+// applyPackParams resolves the packs of proj's services (see
+// resolvePacks) and records the versions chosen in yar.lock through log,
+// holding the project lock so environments and instances of the project
+// don't write it at the same time. It returns the registry, for rendering
+// the resolved services.
+func applyPackParams(cmd *cobra.Command, args []string, proj *config.Project, log *action.Log) (*packs.PackRegistry, error) {
+	registry, err := resolvePacks(proj)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockOperation(cmd, args, projectLockName(proj.Project))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := registry.WriteProjectLock(proj.Services, log); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// projectLockName is the operation lock serializing writes to the yar.lock
+// of project, which its environments and instances share.
+func projectLockName(project string) string {
+	base, _ := fleet.SplitInstanceProject(project)
+	return base + "/" + packs.FileProjectLock
+}
+
+// resolvePacks replaces the params of proj's services with their packs'
+// validated params, so schema and pack defaults (such as the port service
+// discovery reads) apply and invalid params stop the command before
+// anything runs. It returns the registry, which resolves each service to
+// the same pack again.
+func resolvePacks(proj *config.Project) (*packs.PackRegistry, error) {
+	registry, err := newPackRegistry()
+	if err != nil {
+		return nil, err
+	}
+	services, err := packs.ApplyParams(registry, proj.Services)
+	if err != nil {
+		return nil, err
+	}
+	proj.Services = services
+	return registry, nil
+}
+
+// resolveFleetEnv replaces the service discovery templates in the env
+// values of proj's services with where the services run in env: their
+// network aliases on compose, their cluster FQDNs on k8s.
+func resolveFleetEnv(proj *config.Project, env string) error {
+	cluster, err := environmentCluster(proj, env)
+	if err != nil {
+		return err
+	}
+	endpoints := fleet.ComposeEndpoints(proj.Project, proj.Services)
+	if cluster != nil && cluster.Provider == "k8s" {
+		endpoints = fleet.K8sEndpoints(proj.Project, proj.Services, cluster.Namespace)
+	}
+	services, err := fleet.ResolveEnv(proj.Services, endpoints)
+	if err != nil {
+		return err
+	}
+	proj.Services = services
+	return nil
+}
+
+// runFleetHooks runs the hooks of event for proj in env, unless --no-hooks
+// is set. Host hooks run in the directory of yar.yaml; exec hooks run in
+// the service containers of the environment's target.
+func runFleetHooks(ctx context.Context, proj *config.Project, env, event string, log *action.Log) error {
+	if fleetNoHooks || !fleet.HasHooks(proj, event) {
+		return nil
+	}
+	path, err := config.NewLoader().ProjectPath()
+	if err != nil {
+		return err
+	}
+	opts := []fleet.HookOption{fleet.WithHookDir(filepath.Dir(path)), fleet.WithHookActionLog(log)}
+
+	cluster, err := environmentCluster(proj, env)
+	if err != nil {
+		return err
+	}
+	if cluster != nil && cluster.Provider == "k8s" {
+		k8sOpts := []kubernetes.Option{
+			kubernetes.WithContext(cluster.Context),
+			kubernetes.WithNamespace(cluster.Namespace),
+		}
+		client, err := newKubernetesClient(k8sOpts...)
+		if err != nil {
+			return err
+		}
+		executor, err := kubernetes.NewExecutor(k8sOpts...)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, fleet.WithHookExecutor(fleet.NewK8sHookExecutor(client, executor)))
+	} else {
+		client, err := newDockerClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		opts = append(opts, fleet.WithHookExecutor(fleet.NewDockerHookExecutor(client)), fleet.WithHookHostPorts())
+	}
+	return fleet.NewHookRunner(proj, env, opts...).Run(ctx, event)
+}
+
+// lockFleet takes the operation lock of a project environment, and for k8s
+// environments its lease in the cluster too, so other machines sharing the
+// cluster wait as well (INV-FLT-007). Dry runs take no lock. The returned
+// function releases both.
+func lockFleet(cmd *cobra.Command, args []string, proj *config.Project, env string) (func(), error) {
+	if dryRun {
+		return func() {}, nil
+	}
+	unlock, err := lockOperation(cmd, args, fleet.FleetLockName(proj.Project, env))
+	if err != nil {
+		return nil, err
+	}
+
+	cluster, err := environmentCluster(proj, env)
+	if err != nil || cluster == nil || cluster.Provider != "k8s" {
+		return unlock, nil
+	}
+	client, err := newKubernetesClient(
+		kubernetes.WithContext(cluster.Context),
+		kubernetes.WithNamespace(cluster.Namespace),
+	)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	name := "lease " + fleet.LeaseName(proj.Project, env)
+	release, err := fleet.NewLeaseLocker(client).Lock(cmd.Context(), proj.Project, env, lockHolder(cmd, args), lockOptions(name))
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return func() {
+		warnUnlock(release())
+		unlock()
+	}, nil
+}
+
+// printInstanceStatuses prints the status of every instance of project in
+// the compose environment env.
+func printInstanceStatuses(ctx context.Context, project, env string) error {
+	client, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	instances, err := fleet.ListInstances(ctx, client, project, env)
+	if err != nil {
+		return err
+	}
+	if len(instances) == 0 {
+		fmt.Println("  no instances running")
+		return nil
+	}
+	for i, instance := range instances {
+		if i > 0 {
+			fmt.Println()
+		}
+		name := "default instance"
+		if instance != "" {
+			name = "instance " + instance
+		}
+		fmt.Printf("  %s\n", name)
+		status, err := fleet.ComposeStatus(ctx, client, fleet.InstanceProject(project, instance), env, fleet.DefaultDiagnosticLogLines)
+		if err != nil {
+			return err
+		}
+		printFleetStatus(status)
+	}
+	return nil
+}
+
+// printFleetStatus prints a driver-reported fleet status.
+// Failing services are followed by their exit details and last log lines.
+func printFleetStatus(status *fleet.FleetStatus) {
+	fmt.Println("  SERVICE              STATUS     STATE          READY    RESTARTS  ENDPOINTS")
+	if len(status.Services) == 0 {
+		fmt.Println("  no services found")
+		return
+	}
+	for _, svc := range status.Services {
+		fmt.Printf("  %-20s %-10s %-14s %-8s %-9d %s\n", svc.Name, svc.Status, svc.State,
+			fmt.Sprintf("%d/%d", svc.Ready, svc.Replicas), svc.Restarts, strings.Join(svc.Endpoints, ", "))
+	}
+	for _, svc := range status.Services {
+		if !svc.Failing() {
+			continue
+		}
+		fmt.Printf("\n  %s: %s, last exit code %d", svc.Name, svc.State, svc.ExitCode)
+		if svc.Reason != "" {
+			fmt.Printf(" (%s)", svc.Reason)
+		}
+		fmt.Println()
+		for _, line := range svc.Logs {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+	if !status.Healthy {
+		fmt.Println("  fleet is not healthy")
+	}
+}
+
+// printServiceFailure prints the diagnostics of a service that failed
+// during bring-up, if err carries them.
+func printServiceFailure(err error) {
+	var failed *fleet.ServiceFailedError
+	if stderrors.As(err, &failed) {
+		fmt.Fprint(os.Stderr, failed.Diagnostics())
+	}
+}
+
+// startComposeServices brings services of proj, as renamed by
+// applyInstance, up in the compose environment env with fleet.Apply on the
+// Docker driver, making its changes through log and recording what it
+// creates in the fleet state as it goes. The hashes of the jobs it runs
+// are recorded too, so unchanged onChange jobs are skipped next time.
+// registry resolves the services' packs (see applyPackParams). extraHosts
+// are Docker extra-hosts entries added to every container. With --atomic,
+// everything created by a failed or interrupted run is removed again.
+func startComposeServices(ctx context.Context, proj *config.Project, registry *packs.PackRegistry, env string, services []*config.Service, extraHosts []string, log *action.Log) (*fleet.ApplyResult, error) {
+	cfg, err := config.NewLoader().LoadGlobal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	network := config.DefaultConfig().Network.Name
+	if cfg.Network != nil && cfg.Network.Name != "" {
+		network = cfg.Network.Name
+	}
+	path, err := config.NewLoader().ProjectPath()
+	if err != nil {
+		return nil, err
+	}
+	renderer, err := renderComposeContainers(proj, registry, env)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	opts := []fleet.DockerServiceOption{
+		fleet.WithContainerRenderer(renderer),
+		fleet.WithDockerNetwork(fleet.NetworkName(network, proj.Project)),
+		fleet.WithDockerExtraHosts(extraHosts),
+		fleet.WithDockerActionLog(log),
+	}
+	if fleetForceRecreate {
+		opts = append(opts, fleet.WithDockerForceRecreate())
+	}
+	store, st, err := loadFleetState(proj.Project, env)
+	if err != nil {
+		return nil, err
+	}
+	var completed map[string]string
+	if st != nil {
+		completed = st.JobHashes()
+	}
+	var driver fleet.ServiceDriver = fleet.NewDockerServiceDriver(client, proj.Project, env, opts...)
+	if !log.DryRun() {
+		driver = fleet.RecordState(driver, store, proj.Project, env)
+	}
+
+	result, err := fleet.Apply(ctx, driver, renderer.withJobs(services), fleet.ApplyOptions{
+		Atomic:        fleetAtomic,
+		Dir:           filepath.Dir(path),
+		CompletedJobs: completed,
+	})
+	if result != nil && result.RolledBack {
+		fmt.Printf("  rolled back %d resources created by this run\n", len(result.Created))
+	}
+	// Jobs that ran stay recorded even if a later service failed, so they
+	// are skipped next time; a rollback undoes what they did. The config
+	// hash is recorded once every service is up.
+	if result != nil && !result.RolledBack && (len(result.Jobs) > 0 || err == nil) && !log.DryRun() {
+		applied := err == nil
+		if _, serr := store.Update(proj.Project, env, func(st *fleet.State) error {
+			st.AddJobResults(result.Jobs, time.Now())
+			if applied {
+				hash, err := fleet.HashConfig(services)
+				if err != nil {
+					return err
+				}
+				st.ConfigHash = hash
+			}
+			return nil
+		}); serr != nil {
+			err = stderrors.Join(err, serr)
+		}
+	}
+	printServiceFailure(err)
+	return result, err
+}
+
+// composeRenderer renders the containers of a project's services for
+// compose, from their packs rendered once up front.
+type composeRenderer struct {
+	project    string
+	containers map[string][]fleet.ContainerSpec // by service
+	jobs       map[string][]*config.Job         // by service, see packs.ServiceJobs
+}
+
+// renderComposeContainers renders the packs of proj's services for
+// compose (see renderServices) and maps them to containers. The first
+// container of a pack is the service's main container; others are named
+// after it with the pack's container name appended. Secret references
+// become files under packs.ComposeSecretsDir, named by a <NAME>_FILE env
+// entry like compose secrets; configMaps and inline volume content become
+// files.
+func renderComposeContainers(proj *config.Project, registry *packs.PackRegistry, env string) (*composeRenderer, error) {
+	rendered, err := renderServices(proj, registry, env, packs.TargetCompose)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &composeRenderer{
+		project:    proj.Project,
+		containers: make(map[string][]fleet.ContainerSpec, len(rendered)),
+		jobs:       make(map[string][]*config.Job, len(rendered)),
+	}
+	for _, rs := range rendered {
+		r.jobs[rs.Service] = rs.Jobs
+		var files []fleet.ContainerFile
+		for _, b := range rs.Secrets {
+			files = append(files, fleet.ContainerFile{Path: packs.ComposeSecretsDir + "/" + b.Name, SecretRef: b.Ref})
+		}
+		for _, cm := range rs.Resources.Spec.ConfigMaps {
+			keys := make([]string, 0, len(cm.Data))
+			for k := range cm.Data {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				files = append(files, fleet.ContainerFile{
+					Path:    packs.ComposeConfigsDir + "/" + rs.Service + "-" + cm.Name + "/" + k,
+					Content: cm.Data[k],
+				})
+			}
+		}
+
+		for i, c := range rs.Resources.Spec.Containers {
+			spec := fleet.ContainerSpec{
+				Name:       fleet.ContainerName(proj.Project, rs.Service),
+				Image:      c.Image,
+				Entrypoint: c.Command,
+				Cmd:        c.Args,
+				Env:        make(map[string]string, len(c.Env)),
+				Files:      append([]fleet.ContainerFile(nil), files...),
+			}
+			if i > 0 {
+				spec.Name += "-" + c.Name
+			}
+			for _, e := range c.Env {
+				if e.SecretRef != "" {
+					spec.Env[e.Name+"_FILE"] = packs.ComposeSecretsDir + "/" + packs.SecretKey(e.SecretRef)
+				} else {
+					spec.Env[e.Name] = e.Value
+				}
+			}
+			for _, p := range c.Ports {
+				port := docker.PortBinding{ContainerPort: p.ContainerPort, Protocol: p.Protocol}
+				if p.HostPort != 0 {
+					port.HostPort = fleet.HostPort(proj.Project, p.HostPort)
+				}
+				spec.Ports = append(spec.Ports, port)
+			}
+			for _, v := range c.Volumes {
+				switch {
+				case v.Persistent:
+					spec.Volumes = append(spec.Volumes, fleet.VolumeMount{Name: v.Name, Target: v.MountPath})
+				case v.Content != "":
+					spec.Files = append(spec.Files, fleet.ContainerFile{Path: v.MountPath, Content: v.Content})
+				}
+			}
+			r.containers[rs.Service] = append(r.containers[rs.Service], spec)
+		}
+	}
+	return r, nil
+}
+
+// withJobs returns copies of services running the jobs of their packs
+// too, so Apply runs, hashes and records them like the services' own.
+func (r *composeRenderer) withJobs(services []*config.Service) []*config.Service {
+	out := make([]*config.Service, len(services))
+	for i, svc := range services {
+		copied := *svc
+		if jobs, ok := r.jobs[svc.Name]; ok {
+			copied.Jobs = jobs
+		}
+		out[i] = &copied
+	}
+	return out
+}
+
+// RenderContainers implements fleet.ContainerRenderer. The service's own
+// env, with service discovery templates resolved, and secretRefs are added
+// to its main container, and the host ports of params.ports are published.
+func (r *composeRenderer) RenderContainers(ctx context.Context, svc *config.Service) ([]fleet.ContainerSpec, error) {
+	rendered, ok := r.containers[svc.Name]
+	if !ok || len(rendered) == 0 {
+		return nil, &errors.NotFoundError{Resource: "service", Name: svc.Name, Message: "has no rendered containers"}
+	}
+	specs := append([]fleet.ContainerSpec(nil), rendered...)
+	main := specs[0]
+	main.Env = make(map[string]string, len(rendered[0].Env)+len(svc.Env))
+	for k, v := range rendered[0].Env {
+		main.Env[k] = v
+	}
+	for k, v := range svc.Env {
+		main.Env[k] = v
+	}
+	main.Files = append([]fleet.ContainerFile(nil), rendered[0].Files...)
+	names := make([]string, 0, len(svc.SecretRefs))
+	for name := range svc.SecretRefs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := packs.ComposeSecretsDir + "/" + packs.SecretKey(svc.SecretRefs[name])
+		main.Env[name+"_FILE"] = path
+		main.Files = append(main.Files, fleet.ContainerFile{Path: path, SecretRef: svc.SecretRefs[name]})
+	}
+
+	main.Ports = append([]docker.PortBinding(nil), rendered[0].Ports...)
+	for _, m := range fleet.ServicePorts(r.project, svc) {
+		if m.Host == 0 {
+			continue
+		}
+		published := false
+		for i, p := range main.Ports {
+			if p.ContainerPort == m.Container && p.HostPort == 0 {
+				main.Ports[i].HostPort = m.Host
+				published = true
+				break
+			}
+		}
+		if !published {
+			main.Ports = append(main.Ports, docker.PortBinding{ContainerPort: m.Container, HostPort: m.Host})
+		}
+	}
+	specs[0] = main
+	return specs, nil
+}
+
+// manifestRenderer renders the manifests the k8s driver applies from the
+// packs of a project whose params have been resolved (see
+// applyPackParams). Always-run jobs are named after the time of the run.
+type manifestRenderer struct{}
+
+// RenderManifests implements fleet.ManifestRenderer.
+func (manifestRenderer) RenderManifests(ctx context.Context, proj *config.Project, env string) ([]byte, error) {
+	registry, err := newPackRegistry()
+	if err != nil {
+		return nil, err
+	}
+	runID := strconv.FormatInt(time.Now().Unix(), 36)
+	objs, err := projectManifests(proj, registry, env, packs.TargetManifest, runID)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.EncodeManifests(objs)
+}
+
+// runHybridUp starts --local-services in the compose environment env, with
+// their up hooks, and forwards the services they require from the --remote
+// k8s environment until ctx is cancelled. A dry run records the forwards
+// and returns without starting them.
+func runHybridUp(cmd *cobra.Command, args []string, env string, log *action.Log) error {
+	ctx := cmd.Context()
+	if len(fleetLocalServices) == 0 {
+		return fmt.Errorf("--local-services is required with --remote")
+	}
+	proj, err := config.NewLoader().LoadProject()
+	if err != nil {
+		return fmt.Errorf("failed to load project: %w", err)
+	}
+	if err := requireComposeEnvironment(proj, env); err != nil {
+		return err
+	}
+	registry, err := applyPackParams(cmd, args, proj, log)
+	if err != nil {
+		return err
+	}
+	// Remote services are found under the project itself; only the local
+	// side runs as the instance.
+	local := *proj
+	if err := applyInstance(&local, env); err != nil {
+		return err
+	}
+	cluster, err := environmentCluster(proj, fleetRemote)
+	if err != nil {
+		return err
+	}
+	if cluster == nil || cluster.Provider != "k8s" {
+		return fmt.Errorf("remote environment '%s' does not use a k8s cluster", fleetRemote)
+	}
+
+	plan, err := fleet.PlanHybrid(proj.Services, fleetLocalServices)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("fleet up: hybrid %s with %s from '%s'\n", env, plan, fleetRemote)
+
+	var targets []fleet.ForwardTarget
+	var client kubernetes.Client
+	var pf kubernetes.PortForwarder
+	if len(plan.Remote) > 0 {
+		opts := []kubernetes.Option{
+			kubernetes.WithContext(cluster.Context),
+			kubernetes.WithNamespace(cluster.Namespace),
+		}
+		if client, err = newKubernetesClient(opts...); err != nil {
+			return err
+		}
+		if pf, err = kubernetes.NewPortForwarder(opts...); err != nil {
+			return err
+		}
+		targets, err = fleet.NewK8sDriver(client).ForwardTargets(ctx, proj, fleetRemote, plan.Remote)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Local services reach each other by alias and remote ones through
+	// their forwards.
+	endpoints := fleet.ComposeEndpoints(local.Project, plan.Local)
+	for name, e := range fleet.ForwardEndpoints(targets) {
+		endpoints[name] = e
+	}
+	services, err := fleet.ResolveEnv(plan.Local, endpoints)
+	if err != nil {
+		return err
+	}
+
+	// The local environment is locked while its services start, not while
+	// forwarding, so it can still be taken down from another terminal.
+	// Project hooks and those of the local services run around the start;
+	// remote services are the remote environment's.
+	unlock, err := lockFleet(cmd, args, &local, env)
+	if err != nil {
+		return err
+	}
+	hooked := local
+	hooked.Services = services
+	err = runFleetHooks(ctx, &hooked, env, config.HookPreUp, log)
+	if err == nil {
+		_, err = startComposeServices(ctx, &local, registry, env, services, fleet.ContainerHosts(targets), log)
+	}
+	if err == nil {
+		err = runFleetHooks(ctx, &hooked, env, config.HookPostUp, log)
+	}
+	unlock()
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	address, err := hybridForwardAddress(cmd)
+	if err != nil {
+		return err
+	}
+	cleanup := registerForwardHosts(ctx, lockHolder(cmd, args), targets, address, local.Project, env, log)
+	if log.DryRun() {
+		for _, t := range targets {
+			ports := make([]string, len(t.Ports))
+			for i, p := range t.Ports {
+				ports[i] = fmt.Sprintf("%s:%d", address, p.Port)
+			}
+			log.Record(action.Action{Kind: action.KindKubernetes, Op: "forward", Object: "Service " + t.Namespace + "/" + t.Name, Detail: strings.Join(ports, ", ")})
+		}
+		return nil
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+	fmt.Println("  forwarding remote services; Ctrl-C to stop")
+	forwarder := fleet.NewForwarder(client, pf,
+		fleet.WithForwardAddress(address),
+		fleet.WithForwardEvents(forwardEventPrinter(address)),
+	)
+	return forwarder.Run(ctx, targets)
+}
+
+// hybridForwardAddress returns the address hybrid forwards listen on so
+// local containers reach them (see fleet.HybridForwardAddress). An
+// --address given explicitly is kept, with a warning if containers can't
+// reach it.
+func hybridForwardAddress(cmd *cobra.Command) (string, error) {
+	var gateway string
+	if platform.Platform() == platform.Linux {
+		client, err := newDockerClient()
+		if err != nil {
+			return "", err
+		}
+		defer client.Close()
+		if gateway, err = fleet.BridgeGateway(cmd.Context(), client); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+
+	address, warning := fleet.HybridForwardAddress(platform.Platform(), fleetForwardAddress, gateway)
+	if cmd.Flags().Changed("address") && address != fleetForwardAddress {
+		address = fleetForwardAddress
+		warning = fmt.Sprintf("local containers can't reach forwards on %s; Docker's host-gateway is the bridge gateway on Linux", address)
+	}
+	if warning != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	return address, nil
+}
+
+// registerForwardHosts maps the targets' hostnames to the forward address
+// when hosts mode is "etc", recording the change in log and the entries in
+// the fleet state of project env, so 'fleet destroy' removes them if yar
+// is killed before it can. It returns a function removing them again, or
+// nil if nothing was registered. Failures are warnings: forwarding still
+// works by address.
+func registerForwardHosts(ctx context.Context, holder fleet.LockHolder, targets []fleet.ForwardTarget, address, project, env string, log *action.Log) func() {
+	cfg, err := config.NewLoader().LoadGlobal()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: hosts not updated: %v\n", err)
+		return nil
+	}
+	if cfg.Hosts != nil && cfg.Hosts.Mode != "" && cfg.Hosts.Mode != "etc" {
+		return nil
+	}
+
+	names := fleet.ForwardHostnames(targets)
+	entries := make([]network.HostEntry, len(names))
+	for i, name := range names {
+		entries[i] = network.HostEntry{Name: name, IP: address}
+	}
+
+	store, err := fleet.NewStateStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: hosts not updated: %v\n", err)
+		return nil
+	}
+	hosts := newHosts(network.WithHostsActionLog(log))
+	unlock, err := lockAs(ctx, holder, hostsLockName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: hosts not updated: %v\n", err)
+		return nil
+	}
+	err = hosts.Set(entries...)
+	unlock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: hosts not updated: %v\n", err)
+		return nil
+	}
+	if !log.DryRun() {
+		if _, err := store.Update(project, env, func(st *fleet.State) error {
+			for _, e := range entries {
+				st.AddHost(fleet.HostRecord{Name: e.Name, IP: e.IP})
+			}
+			return nil
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: hosts entries not recorded; 'fleet destroy' won't remove them: %v\n", err)
+		}
+	}
+	return func() {
+		// Forwarding stopped, possibly on Ctrl-C; the entries are removed
+		// regardless.
+		unlock, err := lockAs(context.Background(), holder, hostsLockName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to remove hosts entries: %v\n", err)
+			return
+		}
+		defer unlock()
+		if err := hosts.Delete(names...); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to remove hosts entries: %v\n", err)
+			return
+		}
+		if !log.DryRun() {
+			if err := forgetHosts(store, project, env, names); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			}
+		}
+	}
+}
+
+// forwardEventPrinter returns a function printing the port-forward state
+// changes of forwards listening on address.
+func forwardEventPrinter(address string) func(fleet.ForwardEvent) {
+	return func(e fleet.ForwardEvent) {
+		name := e.Target.Name + "." + e.Target.Namespace
+		switch e.Type {
+		case fleet.ForwardConnected:
+			ports := make([]string, len(e.Ports))
+			for i, p := range e.Ports {
+				ports[i] = fmt.Sprintf("%s:%d -> %d", address, p.Local, p.Remote)
+			}
+			fmt.Printf("  %-30s pod/%s  %s\n", name, e.Pod, strings.Join(ports, ", "))
+		case fleet.ForwardLost:
+			fmt.Fprintf(os.Stderr, "  %-30s %v; retrying in %s\n", name, e.Err, e.Retry)
+		}
+	}
+}
+
+// colorEnabled reports whether ANSI colors should be written to f.
+// Honors the NO_COLOR convention.
+func colorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
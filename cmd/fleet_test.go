@@ -0,0 +1,431 @@
+package cmd
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/fleet"
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/kubernetes/kubetest"
+	"github.com/yar-run/yar/internal/network"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const fleetTestProject = `project: demo
+environments:
+  local:
+    cluster: local
+    secrets: local
+  dev:
+    cluster: dev
+    secrets: local
+services:
+  - name: cache
+    pack: redis
+`
+
+// fleetTestConfig is the global config of fleet tests: the dev
+// environment runs on Kubernetes, local on compose.
+const fleetTestConfig = `container: docker
+clusters:
+  dev:
+    provider: k8s
+    context: dev
+    namespace: dev
+`
+
+// setupFleetTest runs the test in a project directory holding
+// fleetTestProject, with the yar config, data and cache directories under
+// a temporary directory holding fleetTestConfig, and Docker replaced by
+// the returned mock. The mock reports every started container as running.
+func setupFleetTest(t *testing.T) *docker.MockClient {
+	t.Helper()
+	root := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(root, "data"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(root, "cache"))
+	if err := os.MkdirAll(filepath.Join(root, "config", "yar"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "config", "yar", "config.yaml"), []byte(fleetTestConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(root, "project")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "yar.yaml"), []byte(fleetTestProject), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	mock := docker.NewMockClient()
+	mock.ContainerInspectResults = make(map[string]*docker.Container)
+	mock.OnContainerStart = func(ctx context.Context, id string) error {
+		opts := mock.ContainerCreateCalls[len(mock.ContainerCreateCalls)-1]
+		mock.ContainerInspectResults[id] = &docker.Container{ID: id, Name: opts.Name, State: "running", Labels: opts.Labels}
+		return nil
+	}
+	mock.OnContainerList = func(ctx context.Context, opts docker.ContainerListOptions) ([]docker.Container, error) {
+		var running []docker.Container
+		for _, c := range mock.ContainerInspectResults {
+			running = append(running, *c)
+		}
+		return running, nil
+	}
+	newDockerClient = func(opts ...docker.Option) (docker.Client, error) { return mock, nil }
+	t.Cleanup(func() { newDockerClient = docker.NewClient })
+	return mock
+}
+
+// fakeKubernetes replaces the cluster with a fake one whose workloads
+// roll out as soon as they are applied.
+func fakeKubernetes(t *testing.T) *dynamicfake.FakeDynamicClient {
+	t.Helper()
+	client, dyn := kubetest.NewFakeClient("dev")
+	for _, resource := range []string{"deployments", "statefulsets"} {
+		dyn.PrependReactor("get", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+			get := action.(k8stesting.GetActionImpl)
+			obj, err := dyn.Tracker().Get(get.GetResource(), get.GetNamespace(), get.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return true, nil, err
+			}
+			u := obj.(*unstructured.Unstructured).DeepCopy()
+			// Applied objects are decoded from JSON, so numbers are floats.
+			replicas := int64(1)
+			if v, ok := u.Object["spec"].(map[string]any)["replicas"].(float64); ok {
+				replicas = int64(v)
+			}
+			for _, field := range []string{"replicas", "updatedReplicas", "readyReplicas", "availableReplicas"} {
+				_ = unstructured.SetNestedField(u.Object, replicas, "status", field)
+			}
+			return true, u, nil
+		})
+	}
+	newKubernetesClient = func(opts ...kubernetes.Option) (kubernetes.Client, error) { return client, nil }
+	newLogReader = func(opts ...kubernetes.Option) (kubernetes.LogReader, error) { return nil, nil }
+	t.Cleanup(func() {
+		newKubernetesClient = kubernetes.NewClient
+		newLogReader = kubernetes.NewLogReader
+	})
+	return dyn
+}
+
+// runYar runs the yar command line with args.
+func runYar(t *testing.T, args ...string) error {
+	t.Helper()
+	rootCmd.SetArgs(args)
+	return rootCmd.ExecuteContext(context.Background())
+}
+
+func TestFleetUpDestroy(t *testing.T) {
+	mock := setupFleetTest(t)
+
+	if err := runYar(t, "fleet", "up"); err != nil {
+		t.Fatalf("fleet up error = %v", err)
+	}
+	if _, err := os.Stat("yar.lock"); err != nil {
+		t.Errorf("fleet up did not record pack versions: %v", err)
+	}
+	store, err := fleet.NewStateStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := store.Load("demo", "local")
+	if err != nil {
+		t.Fatalf("Load() after fleet up error = %v", err)
+	}
+	want := []fleet.Resource{
+		{Kind: fleet.ResourceContainer, Service: "cache", Name: "demo-cache", ID: "mock-container-1"},
+		{Kind: fleet.ResourceVolume, Service: "cache", Name: "demo-cache-data"},
+		{Kind: fleet.ResourceNetwork, Name: "yar-net", ID: "mock-network-id-yar-net"},
+	}
+	if diff := cmp.Diff(want, st.Resources()); diff != "" {
+		t.Errorf("recorded resources mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := runYar(t, "fleet", "destroy"); err != nil {
+		t.Fatalf("fleet destroy error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"mock-container-1"}, mock.ContainerRemoveCalls); diff != "" {
+		t.Errorf("ContainerRemove calls mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"demo-cache-data"}, mock.VolumeRemoveCalls); diff != "" {
+		t.Errorf("VolumeRemove calls mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"yar-net"}, mock.NetworkRemoveCalls); diff != "" {
+		t.Errorf("NetworkRemove calls mismatch (-want +got):\n%s", diff)
+	}
+	var notFound *errors.NotFoundError
+	if _, err := store.Load("demo", "local"); !stderrors.As(err, &notFound) {
+		t.Errorf("Load() after fleet destroy error = %v, want the record deleted", err)
+	}
+}
+
+func TestFleetDestroy_RemovesRecordedHosts(t *testing.T) {
+	setupFleetTest(t)
+	hostsPath := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(hostsPath, []byte("127.0.0.1 localhost\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	newHosts = func(opts ...network.HostsOption) *network.Hosts {
+		return network.NewHosts(append([]network.HostsOption{network.WithHostsPath(hostsPath)}, opts...)...)
+	}
+	t.Cleanup(func() { newHosts = network.NewHosts })
+
+	if err := runYar(t, "fleet", "up"); err != nil {
+		t.Fatalf("fleet up error = %v", err)
+	}
+	// A forward that is killed never runs its cleanup.
+	targets := []fleet.ForwardTarget{{Service: "api", Name: "api", Namespace: "dev"}}
+	if cleanup := registerForwardHosts(context.Background(), fleet.NewLockHolder("test"), targets, "127.0.0.1", "demo", "local", nil); cleanup == nil {
+		t.Fatal("registerForwardHosts() registered nothing")
+	}
+	store, err := fleet.NewStateStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := store.Load("demo", "local")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(st.Hosts) != len(targets[0].Hostnames()) || st.Hosts[0].Name != "api.dev" {
+		t.Errorf("recorded hosts = %+v, want the hostnames of api.dev", st.Hosts)
+	}
+
+	if err := runYar(t, "fleet", "destroy"); err != nil {
+		t.Fatalf("fleet destroy error = %v", err)
+	}
+	entries, err := newHosts().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("hosts entries after fleet destroy = %+v, want none", entries)
+	}
+	var notFound *errors.NotFoundError
+	if _, err := store.Load("demo", "local"); !stderrors.As(err, &notFound) {
+		t.Errorf("Load() after fleet destroy error = %v, want the record deleted", err)
+	}
+}
+
+func TestFleetUp_HybridRunsHooks(t *testing.T) {
+	setupFleetTest(t)
+	project := `project: demo
+environments:
+  local:
+    cluster: local
+    secrets: local
+  dev:
+    cluster: dev
+    secrets: local
+hooks:
+  pre-up:
+    - run: echo pre >> hooks.log
+  post-up:
+    - run: echo post >> hooks.log
+services:
+  - name: cache
+    pack: redis
+    hooks:
+      post-up:
+        - run: echo cache >> hooks.log
+`
+	if err := os.WriteFile("yar.yaml", []byte(project), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		fleetRemote = ""
+		fleetLocalServices = nil
+	})
+
+	if err := runYar(t, "fleet", "up", "--remote", "dev", "--local-services", "cache"); err != nil {
+		t.Fatalf("fleet up --remote error = %v", err)
+	}
+	data, err := os.ReadFile("hooks.log")
+	if err != nil {
+		t.Fatalf("hooks did not run: %v", err)
+	}
+	if diff := cmp.Diff("pre\ncache\npost\n", string(data)); diff != "" {
+		t.Errorf("hooks run mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFleetUp_K8s(t *testing.T) {
+	setupFleetTest(t)
+	dyn := fakeKubernetes(t)
+
+	if err := runYar(t, "fleet", "up", "dev"); err != nil {
+		t.Fatalf("fleet up error = %v", err)
+	}
+
+	var applied []string
+	for _, a := range dyn.Actions() {
+		if patch, ok := a.(k8stesting.PatchActionImpl); ok && patch.GetPatchType() == types.ApplyPatchType {
+			applied = append(applied, patch.GetResource().Resource+"/"+patch.GetName())
+		}
+	}
+	want := []string{"configmaps/cache-files", "services/cache", "statefulsets/cache"}
+	if diff := cmp.Diff(want, applied); diff != "" {
+		t.Errorf("applied objects mismatch (-want +got):\n%s", diff)
+	}
+
+	sts, err := dyn.Tracker().Get(kubernetes.StatefulSetKind.GroupVersion().WithResource("statefulsets"), "dev", "cache", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("statefulset cache not found: %v", err)
+	}
+	labels := sts.(*unstructured.Unstructured).GetLabels()
+	if labels[fleet.LabelProject] != "demo" || labels[fleet.LabelEnvironment] != "dev" || labels[fleet.LabelService] != "cache" {
+		t.Errorf("statefulset labels = %v, want the demo/dev labels of cache", labels)
+	}
+}
+
+func TestFleetUp_SkipsUnchangedJobs(t *testing.T) {
+	mock := setupFleetTest(t)
+	project := fleetTestProject + `    jobs:
+      - name: seed
+        image: redis:7-alpine
+        command: [redis-cli, ping]
+        run: onChange
+`
+	if err := os.WriteFile("yar.yaml", []byte(project), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if err := runYar(t, "fleet", "up"); err != nil {
+			t.Fatalf("fleet up error = %v", err)
+		}
+	}
+	if diff := cmp.Diff([]string{"mock-container-1"}, mock.ContainerWaitCalls); diff != "" {
+		t.Errorf("job runs mismatch (-want +got):\n%s", diff)
+	}
+
+	store, err := fleet.NewStateStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := store.Load("demo", "local")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(st.Jobs) != 1 || st.Jobs[0].Service != "cache" || st.Jobs[0].Name != "seed" || st.Jobs[0].Hash == "" {
+		t.Errorf("recorded jobs = %+v, want the hash of cache/seed", st.Jobs)
+	}
+}
+
+func TestFleetUp_RunsPackJobs(t *testing.T) {
+	mock := setupFleetTest(t)
+	project := fleetTestProject + `  - name: events
+    pack: kafka
+    params:
+      topics: [orders, payments]
+`
+	if err := os.WriteFile("yar.yaml", []byte(project), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runYar(t, "fleet", "up"); err != nil {
+		t.Fatalf("fleet up error = %v", err)
+	}
+	var jobs []docker.ContainerCreateOptions
+	for _, c := range mock.ContainerCreateCalls {
+		if c.Labels[fleet.LabelJob] != "" {
+			jobs = append(jobs, c)
+		}
+	}
+	if len(jobs) != 1 || jobs[0].Labels[fleet.LabelService] != "events" || jobs[0].Labels[fleet.LabelJob] != "create-topics" {
+		t.Fatalf("job containers = %+v, want events/create-topics", jobs)
+	}
+	script := strings.Join(append(jobs[0].Entrypoint, jobs[0].Cmd...), " ")
+	for _, topic := range []string{"--topic orders", "--topic payments"} {
+		if !strings.Contains(script, topic) {
+			t.Errorf("create-topics command = %q, want %q", script, topic)
+		}
+	}
+}
+
+// podLogs is a kubernetes.LogReader returning the same logs for every pod.
+type podLogs string
+
+func (l podLogs) PodLogs(ctx context.Context, namespace, pod string, opts kubernetes.PodLogOptions) ([]byte, error) {
+	return []byte(l), nil
+}
+
+func (l podLogs) StreamPodLogs(ctx context.Context, namespace, pod string, opts kubernetes.PodLogOptions) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(string(l))), nil
+}
+
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-out
+}
+
+func TestFleetLogs_K8s(t *testing.T) {
+	setupFleetTest(t)
+	dyn := fakeKubernetes(t)
+	pod := &unstructured.Unstructured{}
+	pod.SetGroupVersionKind(kubernetes.PodKind)
+	pod.SetNamespace("dev")
+	pod.SetName("cache-0")
+	pod.SetLabels(fleet.Labels("demo", "dev", "cache"))
+	_ = unstructured.SetNestedSlice(pod.Object, []any{map[string]any{"name": "redis"}}, "spec", "containers")
+	if err := dyn.Tracker().Add(pod); err != nil {
+		t.Fatal(err)
+	}
+	newLogReader = func(opts ...kubernetes.Option) (kubernetes.LogReader, error) {
+		return podLogs("2024-05-01T10:00:00Z Ready to accept connections\n"), nil
+	}
+
+	var err error
+	out := captureStdout(t, func() { err = runYar(t, "fleet", "logs", "dev", "cache") })
+	if err != nil {
+		t.Fatalf("fleet logs error = %v", err)
+	}
+	if want := "cache-0 | Ready to accept connections\n"; out != want {
+		t.Errorf("fleet logs output = %q, want %q", out, want)
+	}
+}
+
+func TestForwardEventPrinter(t *testing.T) {
+	e := fleet.ForwardEvent{
+		Type:   fleet.ForwardConnected,
+		Target: fleet.ForwardTarget{Name: "cache", Namespace: "dev"},
+		Pod:    "cache-0",
+		Ports:  []kubernetes.ForwardPort{{Local: 6379, Remote: 6379}},
+	}
+	out := captureStdout(t, func() { forwardEventPrinter("172.17.0.1")(e) })
+	if !strings.Contains(out, "pod/cache-0  172.17.0.1:6379 -> 6379") {
+		t.Errorf("output = %q, want the forward on 172.17.0.1", out)
+	}
+}
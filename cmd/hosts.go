@@ -4,8 +4,14 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/network"
 )
 
+// hostsLockName is the operation lock serializing changes to the hosts
+// file.
+const hostsLockName = "hosts"
+
 var hostsCmd = &cobra.Command{
 	Use:   "hosts",
 	Short: "Manage /etc/hosts entries",
@@ -18,10 +24,20 @@ var hostsListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List yar-managed host entries",
 	Long:  `List all host entries managed by yar.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("hosts list: listing yar-managed entries")
-		fmt.Println("  NAME                    IP")
-		fmt.Println("  [stub] would read /etc/hosts and filter yar:managed entries")
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := newHosts().List()
+		if err != nil {
+			return err
+		}
+		fmt.Println("  NAME                                     IP")
+		if len(entries) == 0 {
+			fmt.Println("  no yar-managed entries")
+			return nil
+		}
+		for _, e := range entries {
+			fmt.Printf("  %-40s %s\n", e.Name, e.IP)
+		}
+		return nil
 	},
 }
 
@@ -30,11 +46,23 @@ var hostsSetCmd = &cobra.Command{
 	Short: "Add or update a host entry",
 	Long:  `Add or update a host entry in /etc/hosts.`,
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
 		name, ip := args[0], args[1]
-		fmt.Printf("hosts set: setting %s -> %s\n", name, ip)
-		fmt.Println("  [stub] would update /etc/hosts (may require sudo)")
-	},
+		unlock, err := lockOperation(cmd, args, hostsLockName)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		hosts := newHosts(network.WithHostsActionLog(log))
+		if err := hosts.Set(network.HostEntry{Name: name, IP: ip}); err != nil {
+			return err
+		}
+		if !log.DryRun() {
+			fmt.Printf("hosts set: %s -> %s\n", name, ip)
+		}
+		return nil
+	}),
 }
 
 var hostsGetCmd = &cobra.Command{
@@ -42,9 +70,13 @@ var hostsGetCmd = &cobra.Command{
 	Short: "Show a host entry",
 	Long:  `Show a specific host entry.`,
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("hosts get: getting entry for '%s'\n", args[0])
-		fmt.Println("  [stub] would look up in /etc/hosts")
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entry, err := newHosts().Get(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", entry.Name, entry.IP)
+		return nil
 	},
 }
 
@@ -53,16 +85,32 @@ var hostsDeleteCmd = &cobra.Command{
 	Short: "Remove a host entry",
 	Long:  `Remove a host entry from /etc/hosts.`,
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("hosts delete: removing entry for '%s'\n", args[0])
-		fmt.Println("  [stub] would remove from /etc/hosts (may require sudo)")
-	},
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
+		unlock, err := lockOperation(cmd, args, hostsLockName)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		hosts := newHosts(network.WithHostsActionLog(log))
+		if err := hosts.Delete(args[0]); err != nil {
+			return err
+		}
+		if !log.DryRun() {
+			fmt.Printf("hosts delete: removed entry for '%s'\n", args[0])
+		}
+		return nil
+	}),
 }
 
 func init() {
 	rootCmd.AddCommand(hostsCmd)
 	hostsCmd.AddCommand(hostsListCmd)
+	addDryRunFlag(hostsSetCmd)
+	addLockFlags(hostsSetCmd)
 	hostsCmd.AddCommand(hostsSetCmd)
 	hostsCmd.AddCommand(hostsGetCmd)
+	addDryRunFlag(hostsDeleteCmd)
+	addLockFlags(hostsDeleteCmd)
 	hostsCmd.AddCommand(hostsDeleteCmd)
 }
@@ -1,9 +1,20 @@
 package cmd
 
 import (
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/packs"
+	"gopkg.in/yaml.v3"
 )
 
 var packCmd = &cobra.Command{
@@ -15,42 +26,531 @@ var packCmd = &cobra.Command{
 var packListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List available packs",
-	Long:  `List all available packs (built-in and installed).`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("pack list: listing available packs")
-		fmt.Println("  NAME        VERSION    DESCRIPTION")
-		fmt.Println("  redis       1.0.0      Redis in-memory data store")
-		fmt.Println("  postgres    1.0.0      PostgreSQL database")
-		fmt.Println("  kafka       1.0.0      Apache Kafka message broker")
-		fmt.Println("  [stub] would load from packs/ directory and catalog")
+	Long: `List all available packs and where they come from.
+
+Packs are found, in order of precedence, in ./packs next to yar.yaml
+(project), in the packs directory of the yar config directory (user), and
+built into yar (builtin). A pack shadows packs of the same name further
+down; shadowed packs are listed with the source that shadows them.
+
+With --available, list the packs of the pack catalogs instead, from the
+copy yar fleet update keeps.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if packListAvailable {
+			catalog, _, err := newPackCatalog()
+			if err != nil {
+				return err
+			}
+			found, err := catalog.Packs()
+			if err != nil {
+				return err
+			}
+			return printCatalogPacks(found, catalog.Unfetched())
+		}
+		registry, err := newPackRegistry()
+		if err != nil {
+			return err
+		}
+		entries, err := registry.List()
+		if err != nil {
+			return err
+		}
+
+		type packView struct {
+			Name        string       `json:"name" yaml:"name"`
+			Version     string       `json:"version" yaml:"version"`
+			Description string       `json:"description,omitempty" yaml:"description,omitempty"`
+			Source      packs.Source `json:"source" yaml:"source"`
+			Path        string       `json:"path,omitempty" yaml:"path,omitempty"`
+			ShadowedBy  packs.Source `json:"shadowedBy,omitempty" yaml:"shadowedBy,omitempty"`
+			Error       string       `json:"error,omitempty" yaml:"error,omitempty"`
+		}
+		views := make([]packView, len(entries))
+		for i, e := range entries {
+			views[i] = packView{Name: e.Name, Source: e.Source, Path: e.Path, ShadowedBy: e.ShadowedBy}
+			if e.Err != nil {
+				views[i].Version = "-"
+				views[i].Error = e.Err.Error()
+			} else {
+				views[i].Version = e.Pack.Version()
+				views[i].Description = e.Pack.Meta.Description
+			}
+		}
+
+		switch outputFormat {
+		case "json":
+			data, err := json.MarshalIndent(views, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal packs: %w", err)
+			}
+			fmt.Println(string(data))
+		case "yaml":
+			data, err := yaml.Marshal(views)
+			if err != nil {
+				return fmt.Errorf("failed to marshal packs: %w", err)
+			}
+			fmt.Print(string(data))
+		default:
+			fmt.Printf("  %-16s %-10s %-9s %s\n", "NAME", "VERSION", "SOURCE", "DESCRIPTION")
+			if len(entries) == 0 {
+				fmt.Println("  no packs found")
+			}
+			for _, e := range entries {
+				version, description := e.Describe()
+				if !e.Active() {
+					description += fmt.Sprintf(" (shadowed by %s)", e.ShadowedBy)
+				}
+				fmt.Printf("  %-16s %-10s %-9s %s\n", e.Name, version, e.Source, description)
+			}
+		}
+		return nil
 	},
 }
 
-var packInstallCmd = &cobra.Command{
-	Use:   "install <name>",
-	Short: "Install a pack from catalog",
-	Long:  `Install a pack from the pack catalog.`,
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("pack install: installing pack '%s'\n", args[0])
-		fmt.Println("  [stub] would download and install pack")
+var packSearchCmd = &cobra.Command{
+	Use:   "search <term>",
+	Short: "Search the pack catalogs",
+	Long: `Search the packs of the pack catalogs by name, description and tags.
+
+Searches the copy of the catalogs yar fleet update keeps, so it works
+offline. Install a pack found with yar pack install <name>.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		catalog, _, err := newPackCatalog()
+		if err != nil {
+			return err
+		}
+		found, err := catalog.Search(args[0])
+		if err != nil {
+			return err
+		}
+		return printCatalogPacks(found, catalog.Unfetched())
+	},
+}
+
+// printCatalogPacks prints catalog packs in the output format, noting
+// the catalogs not fetched yet.
+func printCatalogPacks(found []*packs.CatalogPack, unfetched []string) error {
+	switch outputFormat {
+	case "json":
+		data, err := json.MarshalIndent(found, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal packs: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	case "yaml":
+		type packView struct {
+			*packs.CatalogPack `yaml:",inline"`
+			Catalog            string `yaml:"catalog"`
+		}
+		views := make([]packView, len(found))
+		for i, p := range found {
+			views[i] = packView{CatalogPack: p, Catalog: p.Catalog}
+		}
+		data, err := yaml.Marshal(views)
+		if err != nil {
+			return fmt.Errorf("failed to marshal packs: %w", err)
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	fmt.Printf("  %-16s %-10s %-12s %s\n", "NAME", "VERSION", "CATALOG", "DESCRIPTION")
+	if len(found) == 0 {
+		fmt.Println("  no packs found")
+	}
+	for _, p := range found {
+		description := p.Description
+		if len(p.Tags) > 0 {
+			description += " [" + strings.Join(p.Tags, ", ") + "]"
+		}
+		fmt.Printf("  %-16s %-10s %-12s %s\n", p.Name, p.Latest().Version, p.Catalog, strings.TrimSpace(description))
+	}
+	if len(unfetched) > 0 {
+		fmt.Printf("\n  not fetched yet: %s; run yar fleet update\n", strings.Join(unfetched, ", "))
+	}
+	return nil
+}
+
+var packCreateDir string
+
+var packCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a new pack from an example",
+	Long: `Create a new pack in ./<name> (or <dir>/<name> with --dir), with working
+examples of meta.yaml, schema.json, defaults.yaml and
+templates/resources.yaml to edit.
+
+Put it in ./packs next to yar.yaml to use it in a project right away, and
+check it with yar pack lint.`,
+	Args: cobra.ExactArgs(1),
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
+		root, err := packs.Create(packCreateDir, args[0], log)
+		if err != nil {
+			return err
+		}
+		if !log.DryRun() {
+			fmt.Printf("Created pack %s in %s\n", args[0], root)
+		}
+		return nil
+	}),
+}
+
+var packLintCmd = &cobra.Command{
+	Use:   "lint <dir>",
+	Short: "Check a pack for errors",
+	Long: `Check the pack in <dir>:
+
+  - meta.yaml fields, and that schema.json is a valid parameter schema
+  - that every template compiles
+  - that schema defaults and defaults.yaml are valid params
+  - that templates only use declared params, and every param is used
+  - that the pack renders for compose, helm and manifest with its
+    default params (required params get an example value)
+
+Exits non-zero if there are errors; warnings do not fail.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		issues := packs.Lint(args[0])
+		errs := 0
+		for _, i := range issues {
+			if i.Severity == packs.LintError {
+				errs++
+			}
+		}
+
+		switch outputFormat {
+		case "json":
+			if issues == nil {
+				issues = []packs.LintIssue{}
+			}
+			data, err := json.MarshalIndent(issues, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal issues: %w", err)
+			}
+			fmt.Println(string(data))
+		case "yaml":
+			data, err := yaml.Marshal(issues)
+			if err != nil {
+				return fmt.Errorf("failed to marshal issues: %w", err)
+			}
+			fmt.Print(string(data))
+		default:
+			for _, i := range issues {
+				fmt.Printf("  %s\n", i)
+			}
+			fmt.Printf("%s: %s, %s\n", args[0], countOf(errs, "error"), countOf(len(issues)-errs, "warning"))
+		}
+		if errs > 0 {
+			return fmt.Errorf("pack %s has %s", args[0], countOf(errs, "error"))
+		}
+		return nil
 	},
 }
 
+var (
+	packTestUpdate bool
+	packTestJUnit  string
+)
+
+var packTestCmd = &cobra.Command{
+	Use:   "test <dir>",
+	Short: "Run a pack's golden tests",
+	Long: `Run the golden tests of the pack in <dir>. Each directory under
+<dir>/tests is a test case:
+
+  tests/<case>/params.yaml      params of the case (optional)
+  tests/<case>/compose.yaml     expected output for compose
+  tests/<case>/helm.yaml        expected output for helm
+  tests/<case>/manifest.yaml    expected output for manifest
+
+The pack is rendered for every target with the params, as a service named
+after the pack, and compared with the expected output; differences are
+shown as a diff. With --update, missing and differing files are rewritten
+instead: check the changes before committing them.
+
+The expected output is the rendered resources document with its secret
+and configMap references, as yar template render prints it.
+
+Exits non-zero if a case fails. --junit also writes the results as JUnit
+XML for CI; -o json prints them as JSON.`,
+	Args: cobra.ExactArgs(1),
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
+		report, err := packs.RunTests(args[0], packs.TestOptions{Update: packTestUpdate, Log: log})
+		if err != nil {
+			return err
+		}
+		if packTestJUnit != "" {
+			data, err := report.JUnit()
+			if err != nil {
+				return fmt.Errorf("failed to marshal JUnit report: %w", err)
+			}
+			if err := os.WriteFile(packTestJUnit, data, 0o644); err != nil {
+				return fmt.Errorf("failed to write JUnit report: %w", err)
+			}
+		}
+
+		switch outputFormat {
+		case "json":
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal results: %w", err)
+			}
+			fmt.Println(string(data))
+		case "yaml":
+			data, err := yaml.Marshal(report)
+			if err != nil {
+				return fmt.Errorf("failed to marshal results: %w", err)
+			}
+			fmt.Print(string(data))
+		default:
+			if len(report.Results) == 0 {
+				fmt.Printf("  no test cases in %s\n", filepath.Join(args[0], packs.DirTests))
+			}
+			for _, r := range report.Results {
+				fmt.Printf("  %-8s %s/%s\n", strings.ToUpper(r.Status), r.Case, r.Target)
+				if r.Message != "" {
+					fmt.Printf("           %s\n", r.Message)
+				}
+				if r.Diff != "" {
+					for _, line := range strings.Split(strings.TrimSuffix(r.Diff, "\n"), "\n") {
+						fmt.Printf("           %s\n", line)
+					}
+				}
+			}
+			fmt.Printf("%s %s: %d passed, %d failed, %s", report.Pack, report.Version,
+				report.Count(packs.TestPass), report.Count(packs.TestFail), countOf(report.Count(packs.TestError), "error"))
+			if n := report.Count(packs.TestUpdated); n > 0 {
+				fmt.Printf(", %d updated", n)
+			}
+			fmt.Println()
+		}
+		if !report.Passed() {
+			return fmt.Errorf("pack %s failed its tests", report.Pack)
+		}
+		return nil
+	}),
+}
+
+// countOf returns n and noun, plural unless n is 1.
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+var (
+	packListAvailable bool
+
+	packInstallPath   string
+	packInstallSHA256 string
+	packRemoveForce   bool
+)
+
+var packInstallCmd = &cobra.Command{
+	Use:   "install <source>|<name>[@<version>]",
+	Short: "Install a pack from a directory, archive, git or OCI registry",
+	Long: `Install a pack into the packs directory of the yar config directory.
+
+The source is one of:
+
+  ./path/to/pack                          a pack directory
+  redis-1.2.0.tgz, https://host/r.tgz     a gzipped tar archive
+  git+https://host/packs#v1.2.0           a git repository at a tag, branch or commit
+  https://host/packs.git#<commit>         (URLs ending in .git need no git+ prefix)
+  oci://ghcr.io/acme/packs/redis:1.2.0    an OCI artifact, by tag or @sha256:<digest>
+  redis, redis@^1.2                       a pack of the pack catalogs, at the highest
+                                          version matching the constraint
+
+If the source holds several packs, select one with --path. The pack is
+validated before it is installed, replacing any installed version, and
+the sha256 digest of its files is recorded in packs.lock. yar refuses to
+load an installed pack whose files no longer match that digest.`,
+	Args: cobra.ExactArgs(1),
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
+		installer, err := packs.NewInstaller(packs.WithInstallLog(log))
+		if err != nil {
+			return err
+		}
+		source, opts, err := packInstallSource(args[0])
+		if err != nil {
+			return err
+		}
+		installed, err := installer.Install(cmd.Context(), source, opts)
+		if err != nil {
+			return err
+		}
+
+		switch outputFormat {
+		case "json":
+			data, err := json.MarshalIndent(installed, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal pack: %w", err)
+			}
+			fmt.Println(string(data))
+		case "yaml":
+			data, err := yaml.Marshal(map[string]*packs.InstalledPack{installed.Name: installed})
+			if err != nil {
+				return fmt.Errorf("failed to marshal pack: %w", err)
+			}
+			fmt.Print(string(data))
+		default:
+			if !log.DryRun() {
+				fmt.Printf("Installed pack %s %s to %s\n", installed.Name, installed.Version, filepath.Join(installer.Dir(), installed.Name))
+				fmt.Printf("  digest: %s\n", installed.Digest)
+			}
+		}
+		return nil
+	}),
+}
+
+// packInstallSource returns the source and options to install arg from:
+// arg itself, or, if it is not a source but a pack name with an optional
+// version constraint, the source the pack catalogs list for it.
+func packInstallSource(arg string) (string, packs.InstallOptions, error) {
+	opts := packs.InstallOptions{Path: packInstallPath, SHA256: packInstallSHA256}
+	_, err := packs.ParseInstallSource(arg)
+	name, constraint, _ := strings.Cut(arg, "@")
+	if err == nil || !packNamePattern.MatchString(name) {
+		return arg, opts, err
+	}
+	if packInstallPath != "" || packInstallSHA256 != "" {
+		return "", opts, fmt.Errorf("--path and --sha256 apply to install sources, not to catalog packs")
+	}
+	catalog, sources, err := newPackCatalog()
+	if err != nil {
+		return "", opts, err
+	}
+	if len(sources) == 0 {
+		return "", opts, fmt.Errorf("%q is not an install source, and no pack catalogs are configured to look it up in", arg)
+	}
+	pack, v, err := catalog.Find(name, constraint)
+	if err != nil {
+		return "", opts, err
+	}
+	if outputFormat != "json" && outputFormat != "yaml" {
+		fmt.Printf("Found pack %s %s in catalog %s\n", pack.Name, v.Version, pack.Catalog)
+	}
+	return v.Source, packs.InstallOptions{Path: v.Path, SHA256: v.SHA256}, nil
+}
+
+// packNamePattern matches pack names.
+var packNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
 var packRemoveCmd = &cobra.Command{
 	Use:   "remove <name>",
 	Short: "Remove an installed pack",
-	Long:  `Remove a previously installed pack.`,
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("pack remove: removing pack '%s'\n", args[0])
-		fmt.Println("  [stub] would remove pack from local storage")
-	},
+	Long: `Remove a pack installed with yar pack install.
+
+yar refuses to remove a pack that services of the current project use,
+unless the project has its own copy in ./packs; --force removes it
+anyway.`,
+	Args: cobra.ExactArgs(1),
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
+		name := args[0]
+		if !packRemoveForce {
+			if err := checkPackUnused(name); err != nil {
+				return err
+			}
+		}
+		installer, err := packs.NewInstaller(packs.WithInstallLog(log))
+		if err != nil {
+			return err
+		}
+		if err := installer.Remove(name); err != nil {
+			return err
+		}
+		if !log.DryRun() {
+			fmt.Printf("Removed pack %s\n", name)
+		}
+		return nil
+	}),
+}
+
+// checkPackUnused returns an error if services of the project in or above
+// the working directory use installed pack name, which they would lose.
+// Projects with their own packs/<name> do not use the installed pack.
+func checkPackUnused(name string) error {
+	path, err := config.FindProjectConfig("")
+	var nf *errors.NotFoundError
+	if stderrors.As(err, &nf) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(filepath.Join(filepath.Dir(path), packs.DirPacks, name)); err == nil && info.IsDir() {
+		return nil
+	}
+	proj, err := config.NewLoader().LoadProject()
+	if err != nil {
+		return fmt.Errorf("failed to load project: %w", err)
+	}
+	var users []string
+	for _, svc := range proj.Services {
+		if svc.Pack == name {
+			users = append(users, svc.Name)
+		}
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("pack '%s' is used by services %s of project '%s'; use --force to remove it anyway", name, strings.Join(users, ", "), proj.Project)
+	}
+	return nil
+}
+
+// newPackCatalog returns the pack catalogs of the global config, and the
+// catalogs configured.
+func newPackCatalog() (*packs.Catalog, []*config.CatalogConfig, error) {
+	cfg, err := config.NewLoader().LoadGlobal()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	var sources []*config.CatalogConfig
+	if cfg.Packs != nil {
+		sources = cfg.Packs.Catalogs
+	}
+	catalog, err := packs.NewCatalog(sources)
+	if err != nil {
+		return nil, nil, err
+	}
+	return catalog, sources, nil
+}
+
+// newPackRegistry returns the pack registry, including the packs of the
+// project in or above the working directory if there is one.
+func newPackRegistry() (*packs.PackRegistry, error) {
+	opts := []packs.RegistryOption{packs.WithYarVersion(version)}
+	path, err := config.FindProjectConfig("")
+	var nf *errors.NotFoundError
+	switch {
+	case err == nil:
+		opts = append(opts, packs.WithProjectDir(filepath.Dir(path)))
+	case !stderrors.As(err, &nf):
+		return nil, err
+	}
+	return packs.NewPackRegistry(opts...)
 }
 
 func init() {
 	rootCmd.AddCommand(packCmd)
+	packListCmd.Flags().BoolVar(&packListAvailable, "available", false, "List the packs of the pack catalogs")
 	packCmd.AddCommand(packListCmd)
+	packCmd.AddCommand(packSearchCmd)
+	packCreateCmd.Flags().StringVar(&packCreateDir, "dir", ".", "Directory to create the pack in")
+	addDryRunFlag(packCreateCmd)
+	packCmd.AddCommand(packCreateCmd)
+	packCmd.AddCommand(packLintCmd)
+	packTestCmd.Flags().BoolVar(&packTestUpdate, "update", false, "Rewrite expected outputs that differ or are missing")
+	packTestCmd.Flags().StringVar(&packTestJUnit, "junit", "", "Also write the results as JUnit XML to this file")
+	addDryRunFlag(packTestCmd)
+	packCmd.AddCommand(packTestCmd)
+	packInstallCmd.Flags().StringVar(&packInstallPath, "path", "", "Directory of the pack inside the source")
+	packInstallCmd.Flags().StringVar(&packInstallSHA256, "sha256", "", "Expected sha256 of a tarball")
+	addDryRunFlag(packInstallCmd)
 	packCmd.AddCommand(packInstallCmd)
+	packRemoveCmd.Flags().BoolVar(&packRemoveForce, "force", false, "Remove the pack even if the current project uses it")
+	addDryRunFlag(packRemoveCmd)
 	packCmd.AddCommand(packRemoveCmd)
 }
@@ -4,14 +4,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 	"github.com/yar-run/yar/internal/config"
 	"github.com/yar-run/yar/internal/editor"
 	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/importer"
 	"gopkg.in/yaml.v3"
 )
 
+// Project import flags
+var (
+	projectImportOut   string
+	projectImportName  string
+	projectImportForce bool
+)
+
 var projectCmd = &cobra.Command{
 	Use:   "project",
 	Short: "Manage project configuration",
@@ -120,9 +129,84 @@ var projectEditCmd = &cobra.Command{
 	},
 }
 
+var projectImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Create yar.yaml from another project definition",
+	Long:  `Create yar.yaml from an existing project definition, such as a docker-compose file.`,
+}
+
+var projectImportComposeCmd = &cobra.Command{
+	Use:   "compose <file>",
+	Short: "Create yar.yaml from a docker-compose file",
+	Long: `Create yar.yaml from a docker-compose file.
+
+Each service is mapped to the built-in pack matching its image, or to the
+built-in "container" pack. Images, ports, replicas and depends_on are
+carried over, and so are the commands and named volumes of "container"
+services; healthchecks and bind mounts are not. Environment values whose
+names look like secrets (PASSWORD, TOKEN, SECRET, API_KEY, ...) are moved
+into secretRefs, or the pack's passwordRef; store their values with
+'yar secret set'. Anything that could not be translated is listed in the
+report.
+
+yar.yaml is written next to the compose file unless --out is given, and an
+existing file is only replaced with --force.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		src := args[0]
+		out := projectImportOut
+		if out == "" {
+			out = filepath.Join(filepath.Dir(src), config.ProjectFileName)
+		}
+		if _, err := os.Stat(out); err == nil && !projectImportForce {
+			return &errors.ValidationError{
+				Field:   "out",
+				Value:   out,
+				Message: "file already exists; use --force to replace it",
+			}
+		}
+
+		result, err := importer.ImportCompose(cmd.Context(), src, importer.ComposeOptions{Project: projectImportName})
+		if err != nil {
+			return err
+		}
+		data, err := result.YAML(filepath.Base(src))
+		if err != nil {
+			return fmt.Errorf("failed to marshal project: %w", err)
+		}
+		if err := os.WriteFile(out, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", out, err)
+		}
+
+		fmt.Printf("project import: wrote %s with %d services from %s\n", out, len(result.Project.Services), src)
+		for _, svc := range result.Project.Services {
+			fmt.Printf("  %-20s pack: %s\n", svc.Name, svc.Pack)
+		}
+		if len(result.Secrets) > 0 {
+			fmt.Println("\nSecrets moved to secretRefs (set their values before 'yar fleet up'):")
+			for _, s := range result.Secrets {
+				fmt.Printf("  yar secret set %s   # %s of %s\n", s.Ref, s.Env, s.Service)
+			}
+		}
+		if len(result.Notes) > 0 {
+			fmt.Println("\nReport:")
+			for _, n := range result.Notes {
+				fmt.Printf("  %s\n", n)
+			}
+		}
+		return nil
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(projectCmd)
 	projectCmd.AddCommand(projectInitCmd)
 	projectCmd.AddCommand(projectGetCmd)
 	projectCmd.AddCommand(projectEditCmd)
+	projectCmd.AddCommand(projectImportCmd)
+	projectImportCmd.AddCommand(projectImportComposeCmd)
+
+	projectImportComposeCmd.Flags().StringVar(&projectImportOut, "out", "", "Path of the yar.yaml to write (default: next to the compose file)")
+	projectImportComposeCmd.Flags().StringVar(&projectImportName, "name", "", "Project name (default: compose name or directory name)")
+	projectImportComposeCmd.Flags().BoolVar(&projectImportForce, "force", false, "Replace an existing yar.yaml")
 }
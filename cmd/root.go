@@ -1,18 +1,33 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/fleet"
 )
 
+// exitInterrupted is the exit code after SIGINT or SIGTERM (see SPEC.md).
+const exitInterrupted = 130
+
 var version = "dev" // set via -ldflags
 
 // Global flags
 var (
 	verbose      bool
 	outputFormat string
+	dryRun       bool
+	lockNoWait   bool
+	lockTimeout  time.Duration
 )
 
 var rootCmd = &cobra.Command{
@@ -28,8 +43,28 @@ at runtime from secure providers.`,
 	},
 }
 
+// Execute runs the root command. The first SIGINT or SIGTERM cancels the
+// command context so running operations can stop and clean up; a second one
+// terminates immediately.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// Restore default handling so the next signal kills the process.
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	if ctx.Err() != nil {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			fmt.Fprintln(os.Stderr, "interrupted")
+		}
+		os.Exit(exitInterrupted)
+	}
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -42,3 +77,139 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
 	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "Output format: yaml, json, table")
 }
+
+// addDryRunFlag registers --dry-run on a mutating command.
+func addDryRunFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the actions that would be taken without changing anything")
+}
+
+// withActionLog wraps the run function of a mutating command. Every change
+// the command makes goes through the action log it is passed, so --dry-run
+// runs the same path as a real run (see internal/action). The log is
+// printed when the command returns: always with --dry-run, otherwise with
+// --verbose. With --dry-run and -o json, other output goes to stderr so
+// stdout holds only the JSON log.
+func withActionLog(run func(cmd *cobra.Command, args []string, log *action.Log) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		log := action.NewLog(dryRun)
+		out := io.Writer(os.Stdout)
+		if dryRun && outputFormat == "json" {
+			stdout := os.Stdout
+			os.Stdout = os.Stderr
+			defer func() { os.Stdout = stdout }()
+		}
+
+		err := run(cmd, args, log)
+		if dryRun || verbose {
+			if printErr := printActionLog(out, log); err == nil {
+				err = printErr
+			}
+		}
+		return err
+	}
+}
+
+// printActionLog writes the actions in log as a table, or as JSON with
+// -o json.
+func printActionLog(w io.Writer, log *action.Log) error {
+	actions := log.Actions()
+	if outputFormat == "json" {
+		data, err := json.MarshalIndent(struct {
+			DryRun  bool            `json:"dryRun"`
+			Actions []action.Action `json:"actions"`
+		}{log.DryRun(), append([]action.Action{}, actions...)}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+
+	count := fmt.Sprintf("%d actions", len(actions))
+	if len(actions) == 1 {
+		count = "1 action"
+	}
+	if log.DryRun() {
+		fmt.Fprintf(w, "dry run: %s, nothing was changed\n", count)
+	} else {
+		fmt.Fprintf(w, "%s taken\n", count)
+	}
+	if len(actions) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w, "  KIND         OP         OBJECT")
+	for _, a := range actions {
+		line := fmt.Sprintf("  %-12s %-10s %s", a.Kind, a.Op, strings.ReplaceAll(a.Object, "\t", " "))
+		if a.Detail != "" {
+			line += "  " + a.Detail
+		}
+		if a.Error != "" {
+			line += "  FAILED: " + a.Error
+		}
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
+
+// stubAction records a for a step that has no executor yet, announcing it
+// outside a dry run.
+func stubAction(log *action.Log, a action.Action) {
+	_ = log.Do(a, nil)
+	if !log.DryRun() {
+		fmt.Printf("  [stub] %s\n", a)
+	}
+}
+
+// addLockFlags registers the operation lock flags on a mutating command.
+func addLockFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&lockNoWait, "no-wait", false, "Fail at once if another yar process holds the lock")
+	cmd.Flags().DurationVar(&lockTimeout, "lock-timeout", fleet.DefaultLockTimeout, "How long to wait for another yar process to release the lock")
+}
+
+// lockOptions returns the lock options set by addLockFlags. While waiting,
+// the holder is named on stderr.
+func lockOptions(name string) fleet.LockOptions {
+	return fleet.LockOptions{
+		Timeout: lockTimeout,
+		NoWait:  lockNoWait,
+		OnWait: func(holder fleet.LockHolder) {
+			fmt.Fprintf(os.Stderr, "waiting for %s, locked by %s\n", name, holder)
+		},
+	}
+}
+
+// lockHolder describes this process running cmd with args. Flags are left
+// out so values passed on the command line are not written to lock files.
+func lockHolder(cmd *cobra.Command, args []string) fleet.LockHolder {
+	return fleet.NewLockHolder(strings.Join(append([]string{cmd.CommandPath()}, args...), " "))
+}
+
+// lockOperation takes the machine-wide operation lock name for cmd
+// (INV-FLT-007). Dry runs change nothing and take no lock. The returned
+// function releases the lock; failures to release are warnings.
+func lockOperation(cmd *cobra.Command, args []string, name string) (func(), error) {
+	return lockAs(cmd.Context(), lockHolder(cmd, args), name)
+}
+
+// lockAs is lockOperation for an explicit holder.
+func lockAs(ctx context.Context, holder fleet.LockHolder, name string) (func(), error) {
+	if dryRun {
+		return func() {}, nil
+	}
+	locker, err := fleet.NewLocker()
+	if err != nil {
+		return nil, err
+	}
+	release, err := locker.Lock(ctx, name, holder, lockOptions(name))
+	if err != nil {
+		return nil, err
+	}
+	return func() { warnUnlock(release()) }, nil
+}
+
+// warnUnlock prints a failure to release a lock as a warning.
+func warnUnlock(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+	"github.com/yar-run/yar/internal/action"
 )
 
 // Secret flags
@@ -15,6 +16,9 @@ var (
 	secretPrefix string
 )
 
+// secretsLockName is the operation lock serializing secret syncs.
+const secretsLockName = "secrets"
+
 var secretCmd = &cobra.Command{
 	Use:   "secret",
 	Short: "Manage secrets",
@@ -40,14 +44,15 @@ var secretSetCmd = &cobra.Command{
 	Short: "Set a secret in local store",
 	Long:  `Set a secret value in the local secret store.`,
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
 		key, value := args[0], args[1]
 		fmt.Printf("secret set: setting '%s' (value: %d chars)\n", key, len(value))
 		if secretEnv != "" {
 			fmt.Printf("  scoped to environment: %s\n", secretEnv)
 		}
-		fmt.Println("  [stub] would write to pass/keychain")
-	},
+		stubAction(log, action.Action{Kind: action.KindSecret, Op: "set", Object: key, Detail: secretScope()})
+		return nil
+	}),
 }
 
 var secretGetCmd = &cobra.Command{
@@ -66,10 +71,11 @@ var secretDeleteCmd = &cobra.Command{
 	Short: "Delete a secret from local store",
 	Long:  `Delete a secret from the local secret store.`,
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
 		fmt.Printf("secret delete: deleting '%s'\n", args[0])
-		fmt.Println("  [stub] would remove from pass/keychain")
-	},
+		stubAction(log, action.Action{Kind: action.KindSecret, Op: "delete", Object: args[0], Detail: secretScope()})
+		return nil
+	}),
 }
 
 var secretSyncCmd = &cobra.Command{
@@ -79,10 +85,31 @@ var secretSyncCmd = &cobra.Command{
 
 This allows teams to share secrets through a central provider (GitHub, Azure,
 Vault, 1Password) without committing secrets to version control.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
+		unlock, err := lockOperation(cmd, args, secretsLockName)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
 		fmt.Printf("secret sync: syncing from '%s' to '%s' (prefix: %s)\n", secretFrom, secretTo, secretPrefix)
-		fmt.Println("  [stub] would fetch secrets from remote and write to local store")
-	},
+		stubAction(log, action.Action{Kind: action.KindSecret, Op: "sync", Object: secretPrefix + "*",
+			Detail: fmt.Sprintf("from %s to %s", secretFrom, secretTo)})
+		return nil
+	}),
+}
+
+// secretScope describes the store and environment a secret command targets.
+// Only names are recorded; values never reach the action log (INV-SEC-001).
+func secretScope() string {
+	store := secretStore
+	if store == "" {
+		store = "default store"
+	}
+	if secretEnv != "" {
+		return store + ", env " + secretEnv
+	}
+	return store
 }
 
 func init() {
@@ -94,17 +121,21 @@ func init() {
 	// secret set
 	secretSetCmd.Flags().StringVar(&secretEnv, "env", "", "Scope secret to environment")
 	secretSetCmd.Flags().StringVar(&secretStore, "store", "", "Override target store")
+	addDryRunFlag(secretSetCmd)
 	secretCmd.AddCommand(secretSetCmd)
 
 	// secret get
 	secretCmd.AddCommand(secretGetCmd)
 
 	// secret delete
+	addDryRunFlag(secretDeleteCmd)
 	secretCmd.AddCommand(secretDeleteCmd)
 
 	// secret sync
 	secretSyncCmd.Flags().StringVar(&secretFrom, "from", "", "Source provider (e.g., github, azure)")
 	secretSyncCmd.Flags().StringVar(&secretTo, "to", "pass", "Destination provider")
 	secretSyncCmd.Flags().StringVar(&secretPrefix, "prefix", "yar/", "Key prefix in destination")
+	addDryRunFlag(secretSyncCmd)
+	addLockFlags(secretSyncCmd)
 	secretCmd.AddCommand(secretSyncCmd)
 }
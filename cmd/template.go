@@ -1,9 +1,29 @@
 package cmd
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/fleet"
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/packs"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // Template flags
@@ -26,38 +46,556 @@ var templateCmd = &cobra.Command{
 var templateBuildCmd = &cobra.Command{
 	Use:   "build",
 	Short: "Generate Helm charts, Compose files, or K8s manifests",
-	Long:  `Generate deployment artifacts from the project configuration.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Generate deployment artifacts from the project configuration.
+
+Service params are validated against their packs' schemas first.
+
+--format helm writes a chart per service under charts/<service>/, with the
+services of its pack dependencies as subcharts under its charts/. Replica
+counts and images are values; a chart's values for a subchart are passed
+through to it. --format manifest writes manifests/<kind>.yaml, and
+--format compose writes docker-compose.yaml, reading secrets from
+secrets/<key> next to it. Service jobs become Kubernetes Jobs on helm,
+as hooks, and on manifest.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target := packs.Target(templateFormat)
+		if !slices.Contains(packs.Targets, target) {
+			return &errors.ValidationError{Field: "format", Value: templateFormat, Message: "must be helm, compose or manifest"}
+		}
+		if templatePackage && target != packs.TargetHelm {
+			return &errors.ValidationError{Field: "package", Message: "only Helm charts can be packaged"}
+		}
+		proj, err := config.NewLoader().LoadProject()
+		if err != nil {
+			return fmt.Errorf("failed to load project: %w", err)
+		}
+		registry, err := resolvePacks(proj)
+		if err != nil {
+			return err
+		}
 		fmt.Printf("template build: generating %s artifacts for environment '%s'\n", templateFormat, templateEnv)
-		fmt.Printf("  output directory: %s\n", templateOutputDir)
+
+		var files map[string][]byte
+		var charts []*fleet.HelmChart
+		switch target {
+		case packs.TargetHelm:
+			charts, err = helmCharts(proj, registry, templateEnv)
+			if err == nil {
+				files, err = chartFiles(charts)
+			}
+		case packs.TargetManifest:
+			files, err = manifestFiles(proj, registry, templateEnv)
+		case packs.TargetCompose:
+			files, err = composeFiles(cmd.Context(), proj, registry, templateEnv)
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeArtifacts(templateOutputDir, files); err != nil {
+			return err
+		}
+
 		if templatePackage {
-			fmt.Println("  [stub] would package Helm chart as .tgz")
+			for _, chart := range charts {
+				archive, err := packageChart(templateOutputDir, chart)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("  packaged %s\n", archive)
+			}
 		}
 		if templatePush != "" {
 			fmt.Printf("  [stub] would push to %s\n", templatePush)
 		}
-		fmt.Println("  [stub] would generate deployment artifacts")
+		return nil
 	},
 }
 
 var templateRenderCmd = &cobra.Command{
 	Use:   "render",
 	Short: "Render templates to stdout (dry-run)",
-	Long:  `Render templates to stdout without writing files.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("template render: rendering templates for environment '%s'\n", templateEnv)
-		fmt.Println("  [stub] would render and print templates")
+	Long: `Render the pack of every service to stdout without writing files.
+
+Each service's pack is rendered for --format with its validated params and
+printed as a resources document. Secrets appear as references for the
+target (compose secret files, or secretKeyRefs on helm and manifest),
+never as values.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target := packs.Target(templateFormat)
+		if !slices.Contains(packs.Targets, target) {
+			return &errors.ValidationError{Field: "format", Value: templateFormat, Message: "must be helm, compose or manifest"}
+		}
+		proj, err := config.NewLoader().LoadProject()
+		if err != nil {
+			return fmt.Errorf("failed to load project: %w", err)
+		}
+		rendered, err := renderProject(proj, templateEnv, target)
+		if err != nil {
+			return err
+		}
+
+		switch outputFormat {
+		case "json":
+			data, err := json.MarshalIndent(rendered, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal rendered packs: %w", err)
+			}
+			fmt.Println(string(data))
+		case "yaml":
+			data, err := yaml.Marshal(rendered)
+			if err != nil {
+				return fmt.Errorf("failed to marshal rendered packs: %w", err)
+			}
+			fmt.Print(string(data))
+		default:
+			for i, r := range rendered {
+				if i > 0 {
+					fmt.Println("---")
+				}
+				data, err := yaml.Marshal(r.Resources)
+				if err != nil {
+					return fmt.Errorf("failed to marshal rendered packs: %w", err)
+				}
+				fmt.Printf("# service %s: pack %s %s (%s), %s", r.Service, r.Pack, r.Version, r.Source, target)
+				if r.Parent != "" {
+					fmt.Printf(", dependency of %s", r.Parent)
+				}
+				fmt.Println()
+				fmt.Print(string(data))
+			}
+		}
+		return nil
 	},
 }
 
+// renderedService is a service's pack rendered by template render.
+type renderedService struct {
+	Service   string                   `json:"service" yaml:"service"`
+	Parent    string                   `json:"parent,omitempty" yaml:"parent,omitempty"` // service whose pack depends on this one's
+	Pack      string                   `json:"pack" yaml:"pack"`
+	Version   string                   `json:"version" yaml:"version"`
+	Source    packs.Source             `json:"source" yaml:"source"`
+	Resources *packs.Resources         `json:"resources" yaml:"resources"`
+	Secrets   []packs.SecretBinding    `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+	Configs   []packs.ConfigMapBinding `json:"configMapRefs,omitempty" yaml:"configMapRefs,omitempty"`
+	Jobs      []*config.Job            `json:"-" yaml:"-"` // the pack's and the service's, see packs.ServiceJobs
+}
+
+// renderProject renders the pack of every service of proj in env for
+// target, after validating their params (see resolvePacks). Services of
+// pack dependencies are rendered after the service depending on them, and
+// name it as their parent: Helm charts nest them as subcharts.
+func renderProject(proj *config.Project, env string, target packs.Target) ([]renderedService, error) {
+	if _, ok := proj.Environments[env]; !ok {
+		return nil, &errors.NotFoundError{Resource: "environment", Name: env, Message: "not defined in yar.yaml"}
+	}
+	registry, err := resolvePacks(proj)
+	if err != nil {
+		return nil, err
+	}
+	return renderServices(proj, registry, env, target)
+}
+
+// renderServices renders the services of proj, whose packs registry has
+// already resolved (see resolvePacks), like renderProject.
+func renderServices(proj *config.Project, registry *packs.PackRegistry, env string, target packs.Target) ([]renderedService, error) {
+	if _, ok := proj.Environments[env]; !ok {
+		return nil, &errors.NotFoundError{Resource: "environment", Name: env, Message: "not defined in yar.yaml"}
+	}
+	store, err := esoSecretStore(proj, env, target)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := make([]renderedService, 0, len(proj.Services))
+	parents := map[string]string{}
+	for _, svc := range proj.Services {
+		pack, err := registry.ResolveService(svc)
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range pack.Meta.Dependencies {
+			parents[packs.DependencyService(svc.Name, dep)] = svc.Name
+		}
+		r, err := pack.Render(packs.RenderContext{
+			Project:     proj.Project,
+			Environment: env,
+			Service:     svc,
+			Target:      target,
+			SecretStore: store,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("service %q: %w", svc.Name, err)
+		}
+		rendered = append(rendered, renderedService{
+			Service:   svc.Name,
+			Parent:    parents[svc.Name],
+			Pack:      pack.Name(),
+			Version:   pack.Version(),
+			Source:    pack.Source,
+			Resources: r.Resources,
+			Secrets:   r.Secrets,
+			Configs:   r.ConfigMaps,
+			Jobs:      packs.ServiceJobs(svc, r.Resources),
+		})
+	}
+	return rendered, nil
+}
+
+// serviceManifests is the Kubernetes objects of a rendered service.
+type serviceManifests struct {
+	renderedService
+	Objects []*unstructured.Unstructured
+}
+
+// renderManifests returns the Kubernetes objects each service of proj,
+// whose packs registry has already resolved, runs as in env (see
+// fleet.ServiceManifests), rendered for target, followed by a Job per
+// job of the service and its pack (see fleet.JobManifest). On helm, jobs are hooks weighted by
+// their service's dependency wave. runID names always-run jobs, so every
+// run with a new ID creates new Jobs.
+func renderManifests(proj *config.Project, registry *packs.PackRegistry, env string, target packs.Target, runID string) ([]serviceManifests, error) {
+	rendered, err := renderServices(proj, registry, env, target)
+	if err != nil {
+		return nil, err
+	}
+	store, err := esoSecretStore(proj, env, target)
+	if err != nil {
+		return nil, err
+	}
+	path, err := config.NewLoader().ProjectPath()
+	if err != nil {
+		return nil, err
+	}
+	waves, err := fleet.Waves(proj.Services)
+	if err != nil {
+		return nil, err
+	}
+	weights := make(map[string]int, len(proj.Services))
+	for i, wave := range waves {
+		for _, svc := range wave {
+			weights[svc.Name] = i
+		}
+	}
+
+	services := make(map[string]*config.Service, len(proj.Services))
+	for _, svc := range proj.Services {
+		services[svc.Name] = svc
+	}
+	manifests := make([]serviceManifests, len(rendered))
+	for i, rs := range rendered {
+		svc := services[rs.Service]
+		r := &packs.Rendered{Resources: rs.Resources, Secrets: rs.Secrets, ConfigMaps: rs.Configs}
+		objs := fleet.ServiceManifests(proj.Project, env, svc, r, fleet.ManifestOptions{SecretStore: store})
+		for _, job := range rs.Jobs {
+			hash, err := fleet.HashJob(job, filepath.Dir(path))
+			if err != nil {
+				return nil, err
+			}
+			objs = append(objs, fleet.JobManifest(proj.Project, env, svc, job, fleet.JobManifestOptions{
+				Namespace: svc.Namespace,
+				Hash:      hash,
+				RunID:     runID,
+				Helm:      target == packs.TargetHelm,
+				Weight:    weights[svc.Name],
+			}))
+		}
+		manifests[i] = serviceManifests{renderedService: rs, Objects: objs}
+	}
+	return manifests, nil
+}
+
+// projectManifests returns the objects of renderManifests in one list.
+func projectManifests(proj *config.Project, registry *packs.PackRegistry, env string, target packs.Target, runID string) ([]*unstructured.Unstructured, error) {
+	manifests, err := renderManifests(proj, registry, env, target, runID)
+	if err != nil {
+		return nil, err
+	}
+	var objs []*unstructured.Unstructured
+	for _, m := range manifests {
+		objs = append(objs, m.Objects...)
+	}
+	return objs, nil
+}
+
+// helmCharts returns a Helm chart per service of proj in env. The
+// services of pack dependencies become subcharts of their parent's chart,
+// named after the dependency.
+func helmCharts(proj *config.Project, registry *packs.PackRegistry, env string) ([]*fleet.HelmChart, error) {
+	manifests, err := renderManifests(proj, registry, env, packs.TargetHelm, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var charts []*fleet.HelmChart
+	byService := make(map[string]*fleet.HelmChart, len(manifests))
+	for _, m := range manifests {
+		chart := &fleet.HelmChart{
+			Name:        m.Service,
+			Version:     m.Version,
+			Description: fmt.Sprintf("%s service of %s, pack %s", m.Service, proj.Project, m.Pack),
+			Objects:     m.Objects,
+		}
+		byService[m.Service] = chart
+		parent, ok := byService[m.Parent]
+		if m.Parent == "" || !ok {
+			charts = append(charts, chart)
+			continue
+		}
+		chart.Name = strings.TrimPrefix(m.Service, m.Parent+"-")
+		parent.Subcharts = append(parent.Subcharts, chart)
+	}
+	return charts, nil
+}
+
+// chartFiles returns the files of charts, each under charts/<name>/.
+func chartFiles(charts []*fleet.HelmChart) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, chart := range charts {
+		chartFiles, err := chart.Files()
+		if err != nil {
+			return nil, fmt.Errorf("chart %s: %w", chart.Name, err)
+		}
+		for name, data := range chartFiles {
+			if templateValuesOnly && path.Base(name) != "values.yaml" {
+				continue
+			}
+			files[path.Join("charts", chart.Name, name)] = data
+		}
+	}
+	return files, nil
+}
+
+// manifestFiles returns the objects of proj's services in env as
+// manifests/<kind>.yaml files.
+func manifestFiles(proj *config.Project, registry *packs.PackRegistry, env string) (map[string][]byte, error) {
+	objs, err := projectManifests(proj, registry, env, packs.TargetManifest, "")
+	if err != nil {
+		return nil, err
+	}
+	byKind := map[string][]*unstructured.Unstructured{}
+	for _, obj := range objs {
+		kind := strings.ToLower(obj.GetKind())
+		byKind[kind] = append(byKind[kind], obj)
+	}
+	files := make(map[string][]byte, len(byKind))
+	for kind, objs := range byKind {
+		data, err := kubernetes.EncodeManifests(objs)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Join("manifests", kind+".yaml")] = data
+	}
+	return files, nil
+}
+
+// composeProject is a docker-compose.yaml file.
+type composeProject struct {
+	Name     string                     `yaml:"name"`
+	Services map[string]*composeService `yaml:"services"`
+	Volumes  map[string]struct{}        `yaml:"volumes,omitempty"`
+	Configs  map[string]composeSource   `yaml:"configs,omitempty"`
+	Secrets  map[string]composeSource   `yaml:"secrets,omitempty"`
+}
+
+// composeService is a service of a docker-compose.yaml file.
+type composeService struct {
+	Image       string            `yaml:"image"`
+	Entrypoint  []string          `yaml:"entrypoint,omitempty"`
+	Command     []string          `yaml:"command,omitempty"`
+	Environment map[string]string `yaml:"environment,omitempty"`
+	Ports       []string          `yaml:"ports,omitempty"`
+	Volumes     []string          `yaml:"volumes,omitempty"`
+	Configs     []composeMount    `yaml:"configs,omitempty"`
+	Secrets     []string          `yaml:"secrets,omitempty"`
+	DependsOn   []string          `yaml:"depends_on,omitempty"`
+}
+
+// composeSource is a top-level config or secret.
+type composeSource struct {
+	Content string `yaml:"content,omitempty"`
+	File    string `yaml:"file,omitempty"`
+}
+
+// composeMount mounts a config into a service.
+type composeMount struct {
+	Source string `yaml:"source"`
+	Target string `yaml:"target"`
+}
+
+// composeFiles returns docker-compose.yaml for proj's services in env,
+// from the containers fleet up runs on compose (see
+// renderComposeContainers).
+func composeFiles(ctx context.Context, proj *config.Project, registry *packs.PackRegistry, env string) (map[string][]byte, error) {
+	renderer, err := renderComposeContainers(proj, registry, env)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &composeProject{Name: proj.Project, Services: map[string]*composeService{}}
+	for _, svc := range proj.Services {
+		specs, err := renderer.RenderContainers(ctx, svc)
+		if err != nil {
+			return nil, err
+		}
+		for i, spec := range specs {
+			name := strings.TrimPrefix(spec.Name, proj.Project+"-")
+			out := &composeService{
+				Image:       spec.Image,
+				Entrypoint:  spec.Entrypoint,
+				Command:     spec.Cmd,
+				Environment: spec.Env,
+			}
+			if i == 0 {
+				out.DependsOn = svc.Requires
+			}
+			for _, p := range spec.Ports {
+				port := strconv.Itoa(p.ContainerPort)
+				if p.HostPort != 0 {
+					port = strconv.Itoa(p.HostPort) + ":" + port
+				}
+				if p.Protocol == packs.ProtocolUDP {
+					port += "/udp"
+				}
+				out.Ports = append(out.Ports, port)
+			}
+			for _, v := range spec.Volumes {
+				volume := svc.Name + "-" + v.Name
+				if file.Volumes == nil {
+					file.Volumes = map[string]struct{}{}
+				}
+				file.Volumes[volume] = struct{}{}
+				out.Volumes = append(out.Volumes, volume+":"+v.Target)
+			}
+			for _, f := range spec.Files {
+				if f.SecretRef != "" {
+					key := packs.SecretKey(f.SecretRef)
+					if file.Secrets == nil {
+						file.Secrets = map[string]composeSource{}
+					}
+					file.Secrets[key] = composeSource{File: "./secrets/" + key}
+					if !slices.Contains(out.Secrets, key) {
+						out.Secrets = append(out.Secrets, key)
+					}
+					continue
+				}
+				source := name + "-" + path.Base(f.Path)
+				if file.Configs == nil {
+					file.Configs = map[string]composeSource{}
+				}
+				for n := 2; ; n++ {
+					if _, taken := file.Configs[source]; !taken {
+						break
+					}
+					source = fmt.Sprintf("%s-%s-%d", name, path.Base(f.Path), n)
+				}
+				file.Configs[source] = composeSource{Content: f.Content}
+				out.Configs = append(out.Configs, composeMount{Source: source, Target: f.Path})
+			}
+			file.Services[name] = out
+		}
+	}
+
+	data, err := yaml.Marshal(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal compose file: %w", err)
+	}
+	return map[string][]byte{"docker-compose.yaml": data}, nil
+}
+
+// writeArtifacts writes files, by slash-separated path, under dir.
+func writeArtifacts(dir string, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(file), err)
+		}
+		if err := os.WriteFile(file, files[name], 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+		fmt.Printf("  wrote %s\n", file)
+	}
+	return nil
+}
+
+// packageChart archives chart as <name>-<version>.tgz in dir, the way
+// 'helm package' does, and returns the archive's path.
+func packageChart(dir string, chart *fleet.HelmChart) (string, error) {
+	files, err := chart.Files()
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		hdr := &tar.Header{Name: chart.Name + "/" + name, Mode: 0o644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	archive := filepath.Join(dir, fmt.Sprintf("%s-%s.tgz", chart.Name, chart.Version))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := os.WriteFile(archive, buf.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", archive, err)
+	}
+	return archive, nil
+}
+
+// esoSecretStore returns the ESO ClusterSecretStore secrets of env come
+// through on Kubernetes targets: the clusterSecretStore of the secret
+// provider env uses, if it sets one.
+func esoSecretStore(proj *config.Project, env string, target packs.Target) (string, error) {
+	if !target.Kubernetes() {
+		return "", nil
+	}
+	cfg, err := config.NewLoader().LoadGlobal()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Secrets == nil {
+		return "", nil
+	}
+	provider, ok := cfg.Secrets.Providers[proj.Environments[env].Secrets]
+	if !ok || provider == nil {
+		return "", nil
+	}
+	store, _ := provider.Config["clusterSecretStore"].(string)
+	return store, nil
+}
+
 var templatePublishCmd = &cobra.Command{
 	Use:   "publish",
 	Short: "Publish charts to artifact repository",
 	Long:  `Publish generated charts to an artifact repository.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: withActionLog(func(cmd *cobra.Command, args []string, log *action.Log) error {
 		fmt.Println("template publish: publishing charts")
-		fmt.Println("  [stub] would publish to configured repository")
-	},
+		stubAction(log, action.Action{Kind: action.KindChart, Op: "publish", Object: templateOutputDir, Detail: "configured repository"})
+		return nil
+	}),
 }
 
 func init() {
@@ -75,8 +613,10 @@ func init() {
 
 	// template render flags
 	templateRenderCmd.Flags().StringVar(&templateEnv, "env", "local", "Target environment")
+	templateRenderCmd.Flags().StringVar(&templateFormat, "format", "helm", "Output format: helm, compose, manifest")
 	templateCmd.AddCommand(templateRenderCmd)
 
 	// template publish
+	addDryRunFlag(templatePublishCmd)
 	templateCmd.AddCommand(templatePublishCmd)
 }
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	sigyaml "sigs.k8s.io/yaml"
+)
+
+// templateTestPack is a project pack depending on the built-in redis pack.
+var templateTestPack = map[string]string{
+	"meta.yaml": `name: app
+version: 1.2.0
+dependencies:
+  - name: cache
+    pack: redis
+`,
+	"schema.json": `{"type": "object", "properties": {"image": {"type": "string", "default": "acme/app:1"}}}`,
+	"templates/resources.yaml": `apiVersion: yar.io/v1
+kind: Pack
+metadata:
+  name: {{ .Service.Name }}
+spec:
+  containers:
+    - name: app
+      image: {{ .Params.image }}
+      ports:
+        - containerPort: 8080
+  services:
+    - name: {{ .Service.Name }}
+      port: 8080
+`,
+}
+
+func TestTemplateBuild_HelmSubcharts(t *testing.T) {
+	setupFleetTest(t)
+	project := "project: demo\nenvironments:\n  dev:\n    cluster: dev\n    secrets: local\nservices:\n  - name: web\n    pack: app\n    jobs:\n      - name: migrate\n        image: acme/app:1\n        run: onChange\n"
+	if err := os.WriteFile("yar.yaml", []byte(project), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range templateTestPack {
+		file := filepath.Join("packs", "app", name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := t.TempDir()
+
+	if err := runYar(t, "template", "build", "--env", "dev", "--format", "helm", "--output-dir", out); err != nil {
+		t.Fatalf("template build error = %v", err)
+	}
+	if _, err := os.Stat("yar.lock"); !os.IsNotExist(err) {
+		t.Errorf("template build wrote yar.lock: %v", err)
+	}
+
+	var files []string
+	err := filepath.WalkDir(out, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(out, file)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	want := []string{
+		"charts/web/Chart.yaml",
+		"charts/web/charts/cache/Chart.yaml",
+		"charts/web/charts/cache/templates/configmap.yaml",
+		"charts/web/charts/cache/templates/service.yaml",
+		"charts/web/charts/cache/templates/statefulset.yaml",
+		"charts/web/charts/cache/values.yaml",
+		"charts/web/templates/deployment.yaml",
+		"charts/web/templates/job.yaml",
+		"charts/web/templates/service.yaml",
+		"charts/web/values.yaml",
+	}
+	if diff := cmp.Diff(want, files); diff != "" {
+		t.Fatalf("files mismatch (-want +got):\n%s", diff)
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "charts", "web", "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values map[string]any
+	if err := sigyaml.Unmarshal(data, &values); err != nil {
+		t.Fatal(err)
+	}
+	wantValues := map[string]any{
+		"replicaCount": float64(1),
+		"images":       map[string]any{"app": "acme/app:1"},
+		"cache": map[string]any{
+			"replicaCount": float64(1),
+			"images":       map[string]any{"redis": "redis:7-alpine"},
+		},
+	}
+	if diff := cmp.Diff(wantValues, values); diff != "" {
+		t.Errorf("values mismatch (-want +got):\n%s", diff)
+	}
+
+	// web requires its cache, so its job runs after install, one wave later.
+	data, err = os.ReadFile(filepath.Join(out, "charts", "web", "templates", "job.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job map[string]any
+	if err := sigyaml.Unmarshal(data, &job); err != nil {
+		t.Fatal(err)
+	}
+	annotations := job["metadata"].(map[string]any)["annotations"].(map[string]any)
+	if annotations["helm.sh/hook"] != "post-install,post-upgrade" || annotations["helm.sh/hook-weight"] != "1" {
+		t.Errorf("job annotations = %v, want a post-install hook of weight 1", annotations)
+	}
+}
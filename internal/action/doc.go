@@ -0,0 +1,3 @@
+// Package action records the changes mutating commands make, so --dry-run
+// and real runs share one execution path.
+package action
@@ -0,0 +1,109 @@
+package action
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Action kinds.
+const (
+	KindDocker     = "docker"
+	KindKubernetes = "kubernetes"
+	KindFile       = "file"
+	KindHosts      = "hosts"
+	KindSecret     = "secret"
+	KindPack       = "pack"
+	KindChart      = "chart"
+	KindHook       = "hook"
+)
+
+// Action is one change a command makes, or would make in a dry run.
+// Secret actions name the secret only; values are never recorded
+// (INV-SEC-001).
+type Action struct {
+	Kind   string `json:"kind"`             // KindDocker, KindKubernetes, KindFile, ...
+	Op     string `json:"op"`               // Verb: apply, delete, patch, write, add, remove, ...
+	Object string `json:"object"`           // What is changed: object reference, path, hosts line, secret name
+	Detail string `json:"detail,omitempty"` // Extra context, such as a patch body or a namespace
+	Error  string `json:"error,omitempty"`  // Set if the action was attempted and failed
+}
+
+// String returns the action as "kind op object (detail)".
+func (a Action) String() string {
+	s := fmt.Sprintf("%s %s %s", a.Kind, a.Op, a.Object)
+	if a.Detail != "" {
+		s += " (" + a.Detail + ")"
+	}
+	return s
+}
+
+// Log records actions in the order they are taken. In a dry run, Do records
+// actions without executing them. A nil *Log is valid: it records nothing
+// and executes everything, so executors need no special case when no log
+// is configured.
+type Log struct {
+	dryRun bool
+
+	mu      sync.Mutex
+	actions []Action
+}
+
+// NewLog creates an action log. With dryRun, Do never executes.
+func NewLog(dryRun bool) *Log {
+	return &Log{dryRun: dryRun}
+}
+
+// DryRun reports whether actions are recorded without being executed.
+func (l *Log) DryRun() bool {
+	return l != nil && l.dryRun
+}
+
+// Record appends a to the log without executing anything. Executors use it
+// for the details of a change that Do carries out as a whole, such as the
+// lines of one file write.
+func (l *Log) Record(a Action) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.actions = append(l.actions, a)
+}
+
+// Do records a and, unless this is a dry run, executes fn. If fn fails the
+// recorded action carries the error. fn may be nil for actions that have no
+// executor yet.
+func (l *Log) Do(a Action, fn func() error) error {
+	if l == nil {
+		if fn == nil {
+			return nil
+		}
+		return fn()
+	}
+
+	l.mu.Lock()
+	i := len(l.actions)
+	l.actions = append(l.actions, a)
+	l.mu.Unlock()
+
+	if l.dryRun || fn == nil {
+		return nil
+	}
+	err := fn()
+	if err != nil {
+		l.mu.Lock()
+		l.actions[i].Error = err.Error()
+		l.mu.Unlock()
+	}
+	return err
+}
+
+// Actions returns a copy of the recorded actions.
+func (l *Log) Actions() []Action {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Action(nil), l.actions...)
+}
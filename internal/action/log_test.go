@@ -0,0 +1,101 @@
+package action
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLog_Do(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name    string
+		dryRun  bool
+		fn      func() error
+		wantRun bool
+		wantErr error
+		want    Action
+	}{
+		{
+			name:    "executes",
+			wantRun: true,
+			want:    Action{Kind: KindFile, Op: "write", Object: "/etc/hosts"},
+		},
+		{
+			name:   "dry run skips",
+			dryRun: true,
+			want:   Action{Kind: KindFile, Op: "write", Object: "/etc/hosts"},
+		},
+		{
+			name:    "failure recorded",
+			fn:      func() error { return boom },
+			wantRun: true,
+			wantErr: boom,
+			want:    Action{Kind: KindFile, Op: "write", Object: "/etc/hosts", Error: "boom"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := NewLog(tt.dryRun)
+			ran := false
+			err := log.Do(Action{Kind: KindFile, Op: "write", Object: "/etc/hosts"}, func() error {
+				ran = true
+				if tt.fn != nil {
+					return tt.fn()
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+			if ran != tt.wantRun {
+				t.Errorf("executed = %v, want %v", ran, tt.wantRun)
+			}
+			if diff := cmp.Diff([]Action{tt.want}, log.Actions()); diff != "" {
+				t.Errorf("Actions() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLog_Nil(t *testing.T) {
+	var log *Log
+	ran := false
+	if err := log.Do(Action{Kind: KindSecret, Op: "set", Object: "db"}, func() error { ran = true; return nil }); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if !ran {
+		t.Error("nil log did not execute the action")
+	}
+	if err := log.Do(Action{Kind: KindSecret, Op: "set", Object: "db"}, nil); err != nil {
+		t.Errorf("Do(nil) error = %v", err)
+	}
+	log.Record(Action{Kind: KindSecret})
+	if log.DryRun() || log.Actions() != nil {
+		t.Error("nil log should not be a dry run or hold actions")
+	}
+}
+
+func TestLog_Record(t *testing.T) {
+	log := NewLog(true)
+	log.Record(Action{Kind: KindHosts, Op: "add", Object: "10.0.0.1\tdb # yar:managed"})
+	_ = log.Do(Action{Kind: KindFile, Op: "write", Object: "/etc/hosts"}, nil)
+
+	want := []Action{
+		{Kind: KindHosts, Op: "add", Object: "10.0.0.1\tdb # yar:managed"},
+		{Kind: KindFile, Op: "write", Object: "/etc/hosts"},
+	}
+	if diff := cmp.Diff(want, log.Actions()); diff != "" {
+		t.Errorf("Actions() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAction_String(t *testing.T) {
+	a := Action{Kind: KindKubernetes, Op: "patch", Object: "Deployment shop/web", Detail: `{"spec":{"replicas":0}}`}
+	want := `kubernetes patch Deployment shop/web ({"spec":{"replicas":0}})`
+	if got := a.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strings"
 
 	"github.com/yar-run/yar/internal/errors"
 	"gopkg.in/yaml.v3"
@@ -131,5 +132,12 @@ func (l *Loader) LoadProject() (*Project, error) {
 		return nil, err
 	}
 
+	// pack: redis@^1.2 is short for pack: redis with packVersion: ^1.2.
+	for _, svc := range proj.Services {
+		if name, version, ok := strings.Cut(svc.Pack, "@"); ok {
+			svc.Pack, svc.PackVersion = name, version
+		}
+	}
+
 	return &proj, nil
 }
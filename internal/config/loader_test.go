@@ -73,6 +73,9 @@ func TestLoadGlobalValidFile(t *testing.T) {
 	if cfg.Network == nil || cfg.Network.CIDR != "172.16.34.0/23" {
 		t.Errorf("Network.CIDR = %v, want 172.16.34.0/23", cfg.Network)
 	}
+	if cfg.Packs == nil || len(cfg.Packs.Catalogs) != 2 || cfg.Packs.Catalogs[1].URL != "/srv/yar-catalog" {
+		t.Errorf("Packs = %+v, want two catalogs", cfg.Packs)
+	}
 }
 
 func TestLoadGlobalMinimalFile(t *testing.T) {
@@ -118,6 +121,30 @@ func TestLoadGlobalBadSchema(t *testing.T) {
 	}
 }
 
+func TestLoadGlobalInvalidCatalog(t *testing.T) {
+	l := NewLoader(WithGlobalPath("testdata/invalid/config-bad-catalog.yaml"))
+
+	_, err := l.LoadGlobal()
+	var valErr *errors.ValidationError
+	if !asValidationError(err, &valErr) {
+		t.Fatalf("expected ValidationError, got %T: %v", err, err)
+	}
+	want := []string{
+		`packs.catalogs[0].name must match pattern ^[a-z][a-z0-9-]*$ (got "Acme")`,
+		"packs.catalogs[1].publicKey must be a base64 ed25519 public key",
+		`packs.catalogs[2].name: duplicate catalog name "mirror"`,
+		"packs.catalogs[2].url is required",
+	}
+	if len(valErr.Errors) != len(want) {
+		t.Fatalf("Errors = %q, want %q", valErr.Errors, want)
+	}
+	for i := range want {
+		if valErr.Errors[i] != want[i] {
+			t.Errorf("Errors[%d] = %q, want %q", i, valErr.Errors[i], want[i])
+		}
+	}
+}
+
 func TestLoadProjectNotFound(t *testing.T) {
 	// Create empty temp directory
 	tmpDir := t.TempDir()
@@ -152,6 +179,23 @@ func TestLoadProjectValidFile(t *testing.T) {
 	if proj.Environments["prod"].Secrets != "azure" {
 		t.Errorf("Environments[prod].Secrets = %q, want azure", proj.Environments["prod"].Secrets)
 	}
+	jobs := proj.Services[2].Jobs
+	if len(jobs) != 1 {
+		t.Fatalf("len(Services[2].Jobs) = %d, want 1", len(jobs))
+	}
+	if jobs[0].Phase() != JobBefore || jobs[0].RunPolicy() != JobRunOnChange {
+		t.Errorf("job phase/run = %q/%q, want before/onChange", jobs[0].Phase(), jobs[0].RunPolicy())
+	}
+	if hooks := proj.Hooks.For(HookPostUp); len(hooks) != 1 || hooks[0].FailurePolicy() != HookOnFailureWarn {
+		t.Errorf("Hooks.For(post-up) = %v, want one hook with onFailure warn", hooks)
+	}
+	seed := proj.Services[2].Hooks.For(HookPostUp)
+	if len(seed) != 1 || seed[0].FailurePolicy() != HookOnFailureFail || seed[0].Env["SEED_SIZE"] != "small" {
+		t.Errorf("Services[2].Hooks.For(post-up) = %v, want the seed hook", seed)
+	}
+	if got := proj.Services[0].Hooks.For(HookPostUp); got != nil {
+		t.Errorf("Services[0].Hooks.For(post-up) = %v, want nil", got)
+	}
 }
 
 func TestLoadProjectMinimalFile(t *testing.T) {
@@ -182,6 +226,87 @@ func TestLoadProjectMissingRequiredField(t *testing.T) {
 	}
 }
 
+func TestLoadProjectInvalidJob(t *testing.T) {
+	l := NewLoader(WithProjectPath("testdata/invalid/project-bad-job.yaml"))
+
+	_, err := l.LoadProject()
+	var valErr *errors.ValidationError
+	if !asValidationError(err, &valErr) {
+		t.Fatalf("expected ValidationError, got %T: %v", err, err)
+	}
+	want := []string{
+		"services[0].jobs[0].image is required",
+		`services[0].jobs[0].when must be one of: before, after (got "during")`,
+	}
+	if len(valErr.Errors) != len(want) {
+		t.Fatalf("Errors = %q, want %q", valErr.Errors, want)
+	}
+	for i := range want {
+		if valErr.Errors[i] != want[i] {
+			t.Errorf("Errors[%d] = %q, want %q", i, valErr.Errors[i], want[i])
+		}
+	}
+}
+
+func TestLoadProjectInvalidHook(t *testing.T) {
+	l := NewLoader(WithProjectPath("testdata/invalid/project-bad-hook.yaml"))
+
+	_, err := l.LoadProject()
+	var valErr *errors.ValidationError
+	if !asValidationError(err, &valErr) {
+		t.Fatalf("expected ValidationError, got %T: %v", err, err)
+	}
+	want := []string{
+		"hooks.pre-up[0]: one of run or exec is required",
+		"hooks.post-down[0].service is required for exec in project hooks",
+		"services[0].hooks.post-up[0]: run and exec are mutually exclusive",
+		`services[0].hooks.post-up[0].timeout must be a positive duration (got "soon")`,
+		`services[0].hooks.post-up[0].onFailure must be one of: fail, warn (got "ignore")`,
+	}
+	if len(valErr.Errors) != len(want) {
+		t.Fatalf("Errors = %q, want %q", valErr.Errors, want)
+	}
+	for i := range want {
+		if valErr.Errors[i] != want[i] {
+			t.Errorf("Errors[%d] = %q, want %q", i, valErr.Errors[i], want[i])
+		}
+	}
+}
+
+func TestLoadProjectPackVersion(t *testing.T) {
+	l := NewLoader(WithProjectPath("testdata/valid/project-pack-version.yaml"))
+
+	proj, err := l.LoadProject()
+	if err != nil {
+		t.Fatalf("LoadProject() error = %v", err)
+	}
+	want := [][2]string{{"redis", "^1.2"}, {"postgres", "~15.4"}, {"node", ""}}
+	for i, svc := range proj.Services {
+		if svc.Pack != want[i][0] || svc.PackVersion != want[i][1] {
+			t.Errorf("services[%d] pack, packVersion = %q, %q; want %q, %q", i, svc.Pack, svc.PackVersion, want[i][0], want[i][1])
+		}
+	}
+
+	l = NewLoader(WithProjectPath("testdata/invalid/project-bad-pack-version.yaml"))
+	_, err = l.LoadProject()
+	var valErr *errors.ValidationError
+	if !asValidationError(err, &valErr) {
+		t.Fatalf("expected ValidationError, got %T: %v", err, err)
+	}
+	wantErrs := []string{
+		`services[0]: pack "redis@^1.2" has a version constraint and packVersion is set; use one of them`,
+		`services[1].pack must be <pack> or <pack>@<version constraint> (got "postgres@")`,
+	}
+	if len(valErr.Errors) != len(wantErrs) {
+		t.Fatalf("Errors = %q, want %q", valErr.Errors, wantErrs)
+	}
+	for i := range wantErrs {
+		if valErr.Errors[i] != wantErrs[i] {
+			t.Errorf("Errors[%d] = %q, want %q", i, valErr.Errors[i], wantErrs[i])
+		}
+	}
+}
+
 func TestLoadProjectSearchesParentDirs(t *testing.T) {
 	// Create temp directory structure
 	tmpDir := t.TempDir()
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/yar-run/yar/internal/errors"
 )
@@ -57,6 +60,31 @@ func ValidateConfig(cfg *Config) error {
 		}
 	}
 
+	// Validate pack catalogs if present
+	if cfg.Packs != nil {
+		catalogs := make(map[string]bool)
+		for i, c := range cfg.Packs.Catalogs {
+			field := fmt.Sprintf("packs.catalogs[%d]", i)
+			switch {
+			case c.Name == "":
+				errs = append(errs, field+".name is required")
+			case !isValidName(c.Name):
+				errs = append(errs, fmt.Sprintf("%s.name must match pattern ^[a-z][a-z0-9-]*$ (got %q)", field, c.Name))
+			case catalogs[c.Name]:
+				errs = append(errs, fmt.Sprintf("%s.name: duplicate catalog name %q", field, c.Name))
+			}
+			catalogs[c.Name] = true
+			if c.URL == "" {
+				errs = append(errs, field+".url is required")
+			}
+			if c.PublicKey != "" {
+				if key, err := base64.StdEncoding.DecodeString(c.PublicKey); err != nil || len(key) != ed25519.PublicKeySize {
+					errs = append(errs, field+".publicKey must be a base64 ed25519 public key")
+				}
+			}
+		}
+	}
+
 	// Validate secrets.local if present
 	if cfg.Secrets != nil && cfg.Secrets.Local != nil {
 		validLocal := map[string]bool{
@@ -127,7 +155,19 @@ func ValidateProject(proj *Project) error {
 		}
 		if svc.Pack == "" {
 			errs = append(errs, fmt.Sprintf("services[%d].pack is required", i))
+		} else if name, version, ok := strings.Cut(svc.Pack, "@"); ok {
+			switch {
+			case name == "" || version == "":
+				errs = append(errs, fmt.Sprintf("services[%d].pack must be <pack> or <pack>@<version constraint> (got %q)", i, svc.Pack))
+			case svc.PackVersion != "":
+				errs = append(errs, fmt.Sprintf("services[%d]: pack %q has a version constraint and packVersion is set; use one of them", i, svc.Pack))
+			}
 		}
+		errs = append(errs, validateJobs(i, svc.Jobs)...)
+	}
+	errs = append(errs, validateHooks("hooks", proj.Hooks, "", serviceNames)...)
+	for i, svc := range proj.Services {
+		errs = append(errs, validateHooks(fmt.Sprintf("services[%d].hooks", i), svc.Hooks, svc.Name, serviceNames)...)
 	}
 
 	if len(errs) > 0 {
@@ -141,6 +181,74 @@ func ValidateProject(proj *Project) error {
 	return nil
 }
 
+// validateJobs validates the jobs of the i-th service.
+func validateJobs(i int, jobs []*Job) []string {
+	var errs []string
+	names := make(map[string]bool)
+	for j, job := range jobs {
+		field := fmt.Sprintf("services[%d].jobs[%d]", i, j)
+		if job.Name == "" {
+			errs = append(errs, field+".name is required")
+		} else {
+			if names[job.Name] {
+				errs = append(errs, fmt.Sprintf("%s.name: duplicate job name %q", field, job.Name))
+			}
+			names[job.Name] = true
+			if !isValidName(job.Name) {
+				errs = append(errs, fmt.Sprintf("%s.name must match pattern ^[a-z][a-z0-9-]*$ (got %q)", field, job.Name))
+			}
+		}
+		if job.Image == "" {
+			errs = append(errs, field+".image is required")
+		}
+		if job.When != "" && job.When != JobBefore && job.When != JobAfter {
+			errs = append(errs, fmt.Sprintf("%s.when must be one of: before, after (got %q)", field, job.When))
+		}
+		if job.Run != "" && job.Run != JobRunAlways && job.Run != JobRunOnChange {
+			errs = append(errs, fmt.Sprintf("%s.run must be one of: always, onChange (got %q)", field, job.Run))
+		}
+	}
+	return errs
+}
+
+// validateHooks validates the hooks at field. service is the service
+// owning them, "" for project hooks; services are the known service names.
+func validateHooks(field string, hooks *Hooks, service string, services map[string]bool) []string {
+	var errs []string
+	for _, event := range HookEvents {
+		for j, hook := range hooks.For(event) {
+			f := fmt.Sprintf("%s.%s[%d]", field, event, j)
+			switch {
+			case hook.Run == "" && len(hook.Exec) == 0:
+				errs = append(errs, f+": one of run or exec is required")
+			case hook.Run != "" && len(hook.Exec) > 0:
+				errs = append(errs, f+": run and exec are mutually exclusive")
+			}
+			if hook.Name != "" && !isValidName(hook.Name) {
+				errs = append(errs, fmt.Sprintf("%s.name must match pattern ^[a-z][a-z0-9-]*$ (got %q)", f, hook.Name))
+			}
+			if hook.Service != "" {
+				if hook.Run != "" {
+					errs = append(errs, f+".service is only valid with exec")
+				} else if !services[hook.Service] {
+					errs = append(errs, fmt.Sprintf("%s.service: unknown service %q", f, hook.Service))
+				}
+			} else if len(hook.Exec) > 0 && service == "" {
+				errs = append(errs, f+".service is required for exec in project hooks")
+			}
+			if hook.Timeout != "" {
+				if d, err := time.ParseDuration(hook.Timeout); err != nil || d <= 0 {
+					errs = append(errs, fmt.Sprintf("%s.timeout must be a positive duration (got %q)", f, hook.Timeout))
+				}
+			}
+			if hook.OnFailure != "" && hook.OnFailure != HookOnFailureFail && hook.OnFailure != HookOnFailureWarn {
+				errs = append(errs, fmt.Sprintf("%s.onFailure must be one of: fail, warn (got %q)", f, hook.OnFailure))
+			}
+		}
+	}
+	return errs
+}
+
 // isValidName checks if a name matches the pattern ^[a-z][a-z0-9-]*$
 func isValidName(name string) bool {
 	if len(name) == 0 {
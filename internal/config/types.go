@@ -1,5 +1,7 @@
 package config
 
+import "strings"
+
 // Config represents global yar configuration (~/.config/yar/config.yaml)
 type Config struct {
 	Container string                    `yaml:"container" json:"container"`
@@ -8,6 +10,7 @@ type Config struct {
 	Network   *NetworkConfig            `yaml:"network,omitempty" json:"network,omitempty"`
 	Secrets   *SecretsConfig            `yaml:"secrets,omitempty" json:"secrets,omitempty"`
 	Clusters  map[string]*ClusterConfig `yaml:"clusters,omitempty" json:"clusters,omitempty"`
+	Packs     *PacksConfig              `yaml:"packs,omitempty" json:"packs,omitempty"`
 }
 
 // VPNConfig configures VPN connectivity
@@ -47,6 +50,19 @@ type SecretProviderConfig struct {
 	Config map[string]any `yaml:",inline" json:"-"`
 }
 
+// PacksConfig configures where packs are found
+type PacksConfig struct {
+	Catalogs []*CatalogConfig `yaml:"catalogs,omitempty" json:"catalogs,omitempty"`
+}
+
+// CatalogConfig configures a pack catalog: an index of packs and where to
+// install them from
+type CatalogConfig struct {
+	Name      string `yaml:"name" json:"name"`
+	URL       string `yaml:"url" json:"url"`                                 // http(s) URL, file or directory of the index
+	PublicKey string `yaml:"publicKey,omitempty" json:"publicKey,omitempty"` // base64 ed25519 key the index must be signed with
+}
+
 // ClusterConfig configures a deployment cluster
 type ClusterConfig struct {
 	Provider  string `yaml:"provider" json:"provider"`
@@ -59,6 +75,7 @@ type Project struct {
 	Project      string                  `yaml:"project" json:"project"`
 	Environments map[string]*Environment `yaml:"environments" json:"environments"`
 	Services     []*Service              `yaml:"services" json:"services"`
+	Hooks        *Hooks                  `yaml:"hooks,omitempty" json:"hooks,omitempty"`
 }
 
 // Environment defines a deployment environment
@@ -69,15 +86,143 @@ type Environment struct {
 
 // Service defines a service in the project
 type Service struct {
-	Name       string            `yaml:"name" json:"name"`
-	Namespace  string            `yaml:"namespace,omitempty" json:"namespace,omitempty"`
-	Pack       string            `yaml:"pack" json:"pack"`
-	Requires   []string          `yaml:"requires,omitempty" json:"requires,omitempty"`
-	Replicas   int               `yaml:"replicas,omitempty" json:"replicas,omitempty"`
-	Params     map[string]any    `yaml:"params,omitempty" json:"params,omitempty"`
-	Ingress    *IngressConfig    `yaml:"ingress,omitempty" json:"ingress,omitempty"`
-	Env        map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
-	SecretRefs map[string]string `yaml:"secretRefs,omitempty" json:"secretRefs,omitempty"`
+	Name        string            `yaml:"name" json:"name"`
+	Namespace   string            `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Pack        string            `yaml:"pack" json:"pack"`
+	PackVersion string            `yaml:"packVersion,omitempty" json:"packVersion,omitempty"` // version constraint, such as ^1.2
+	Requires    []string          `yaml:"requires,omitempty" json:"requires,omitempty"`
+	Replicas    int               `yaml:"replicas,omitempty" json:"replicas,omitempty"`
+	Params      map[string]any    `yaml:"params,omitempty" json:"params,omitempty"`
+	Ingress     *IngressConfig    `yaml:"ingress,omitempty" json:"ingress,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	SecretRefs  map[string]string `yaml:"secretRefs,omitempty" json:"secretRefs,omitempty"`
+	Jobs        []*Job            `yaml:"jobs,omitempty" json:"jobs,omitempty"`
+	Hooks       *Hooks            `yaml:"hooks,omitempty" json:"hooks,omitempty"`
+}
+
+// Job phases: when a job runs relative to its service.
+const (
+	JobBefore = "before" // After the service's requirements are ready, before the service starts
+	JobAfter  = "after"  // After the service is ready, before its dependents start
+)
+
+// Job run policies.
+const (
+	JobRunAlways   = "always"   // Run on every fleet up
+	JobRunOnChange = "onChange" // Run only when the job or its inputs changed since the last success
+)
+
+// Job defines a one-shot container run as a fleet step, such as a schema
+// migration or topic creation. A non-zero exit code fails the fleet step.
+type Job struct {
+	Name    string            `yaml:"name" json:"name"`
+	Image   string            `yaml:"image" json:"image"`
+	Command []string          `yaml:"command,omitempty" json:"command,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	When    string            `yaml:"when,omitempty" json:"when,omitempty"`     // JobBefore (default) or JobAfter
+	Run     string            `yaml:"run,omitempty" json:"run,omitempty"`       // JobRunAlways (default) or JobRunOnChange
+	Inputs  []string          `yaml:"inputs,omitempty" json:"inputs,omitempty"` // Globs relative to yar.yaml hashed for JobRunOnChange
+}
+
+// Phase returns the job's phase, defaulting to JobBefore.
+func (j *Job) Phase() string {
+	if j.When == "" {
+		return JobBefore
+	}
+	return j.When
+}
+
+// RunPolicy returns the job's run policy, defaulting to JobRunAlways.
+func (j *Job) RunPolicy() string {
+	if j.Run == "" {
+		return JobRunAlways
+	}
+	return j.Run
+}
+
+// Hook events: the fleet operations hooks run around.
+const (
+	HookPreUp       = "pre-up"
+	HookPostUp      = "post-up"
+	HookPreDown     = "pre-down"
+	HookPostDown    = "post-down"
+	HookPostDestroy = "post-destroy"
+)
+
+// HookEvents lists the hook events in the order of a fleet's lifecycle.
+var HookEvents = []string{HookPreUp, HookPostUp, HookPreDown, HookPostDown, HookPostDestroy}
+
+// Hook failure policies.
+const (
+	HookOnFailureFail = "fail" // A failed hook fails the operation
+	HookOnFailureWarn = "warn" // A failed hook is reported and the operation continues
+)
+
+// DefaultHookTimeout bounds a hook that declares no timeout.
+const DefaultHookTimeout = "5m"
+
+// Hooks lists the hooks of a project or service by event.
+type Hooks struct {
+	PreUp       []*Hook `yaml:"pre-up,omitempty" json:"pre-up,omitempty"`
+	PostUp      []*Hook `yaml:"post-up,omitempty" json:"post-up,omitempty"`
+	PreDown     []*Hook `yaml:"pre-down,omitempty" json:"pre-down,omitempty"`
+	PostDown    []*Hook `yaml:"post-down,omitempty" json:"post-down,omitempty"`
+	PostDestroy []*Hook `yaml:"post-destroy,omitempty" json:"post-destroy,omitempty"`
+}
+
+// For returns the hooks run on event. A nil *Hooks has none.
+func (h *Hooks) For(event string) []*Hook {
+	if h == nil {
+		return nil
+	}
+	switch event {
+	case HookPreUp:
+		return h.PreUp
+	case HookPostUp:
+		return h.PostUp
+	case HookPreDown:
+		return h.PreDown
+	case HookPostDown:
+		return h.PostDown
+	case HookPostDestroy:
+		return h.PostDestroy
+	}
+	return nil
+}
+
+// Hook defines a command run around a fleet operation, such as a seed
+// script after up. A hook runs either on the host (Run, through the shell,
+// in the directory of yar.yaml) or inside a service's container (Exec).
+// Hooks receive the fleet's service endpoints in their environment, never
+// secret values.
+type Hook struct {
+	Name      string            `yaml:"name,omitempty" json:"name,omitempty"`
+	Run       string            `yaml:"run,omitempty" json:"run,omitempty"`             // Shell command run on the host
+	Exec      []string          `yaml:"exec,omitempty" json:"exec,omitempty"`           // Command run in a service container
+	Service   string            `yaml:"service,omitempty" json:"service,omitempty"`     // Container for Exec; defaults to the hook's service
+	Env       map[string]string `yaml:"env,omitempty" json:"env,omitempty"`             // Extra environment variables
+	Timeout   string            `yaml:"timeout,omitempty" json:"timeout,omitempty"`     // Duration; DefaultHookTimeout when empty
+	OnFailure string            `yaml:"onFailure,omitempty" json:"onFailure,omitempty"` // HookOnFailureFail (default) or HookOnFailureWarn
+}
+
+// FailurePolicy returns the hook's failure policy, defaulting to
+// HookOnFailureFail.
+func (h *Hook) FailurePolicy() string {
+	if h.OnFailure == "" {
+		return HookOnFailureFail
+	}
+	return h.OnFailure
+}
+
+// DisplayName returns the hook's name, or its command if it has none.
+func (h *Hook) DisplayName() string {
+	switch {
+	case h.Name != "":
+		return h.Name
+	case h.Run != "":
+		return h.Run
+	}
+	return strings.Join(h.Exec, " ")
 }
 
 // IngressConfig configures ingress for a service
@@ -3,6 +3,7 @@ package docker
 import (
 	"context"
 	"crypto/tls"
+	"io"
 	"net/http"
 	"time"
 
@@ -17,6 +18,29 @@ type Client interface {
 	NetworkList(ctx context.Context, opts NetworkListOptions) ([]Network, error)
 	NetworkInspect(ctx context.Context, name string) (*Network, error)
 
+	// Container operations
+	ContainerList(ctx context.Context, opts ContainerListOptions) ([]Container, error)
+	ContainerInspect(ctx context.Context, id string) (*Container, error)
+	ContainerLogs(ctx context.Context, id string, opts LogOptions) (io.ReadCloser, error)
+	ContainerCreate(ctx context.Context, opts ContainerCreateOptions) (string, error)
+	ContainerStart(ctx context.Context, id string) error
+	ContainerStop(ctx context.Context, id string) error
+	ContainerWait(ctx context.Context, id string) (int64, error)
+	ContainerRemove(ctx context.Context, id string) error
+	ContainerExec(ctx context.Context, id string, opts ExecOptions) (int, error)
+
+	// File operations; content is a tar stream
+	CopyFromContainer(ctx context.Context, id, path string) (io.ReadCloser, error)
+	CopyToContainer(ctx context.Context, id, path string, content io.Reader) error
+
+	// Volume operations
+	VolumeList(ctx context.Context, opts VolumeListOptions) ([]Volume, error)
+	VolumeCreate(ctx context.Context, name string, opts VolumeCreateOptions) (*Volume, error)
+	VolumeRemove(ctx context.Context, name string) error
+
+	// Image operations
+	ImagePull(ctx context.Context, ref string) error
+
 	// Ping checks Docker daemon connectivity
 	Ping(ctx context.Context) error
 
@@ -0,0 +1,290 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+)
+
+// ContainerList lists containers with optional filters.
+func (c *dockerClient) ContainerList(ctx context.Context, opts ContainerListOptions) ([]Container, error) {
+	filterArgs := filters.NewArgs()
+	for key, values := range opts.Filters {
+		for _, value := range values {
+			filterArgs.Add(key, value)
+		}
+	}
+
+	containers, err := c.cli.ContainerList(ctx, container.ListOptions{
+		All:     opts.All,
+		Filters: filterArgs,
+	})
+	if err != nil {
+		return nil, ErrContainerList(err)
+	}
+
+	result := make([]Container, len(containers))
+	for i, ctr := range containers {
+		result[i] = containerFromDocker(ctr)
+	}
+
+	return result, nil
+}
+
+// ContainerInspect returns detailed information about a specific container.
+func (c *dockerClient) ContainerInspect(ctx context.Context, id string) (*Container, error) {
+	resp, err := c.cli.ContainerInspect(ctx, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "No such container") {
+			return nil, ErrContainerNotFound(id)
+		}
+		return nil, ErrContainerInspect(id, err)
+	}
+
+	ctr := containerFromDockerInspect(resp)
+	return &ctr, nil
+}
+
+// ContainerLogs returns the raw log stream of a container. Streams from
+// containers without a TTY are multiplexed; use DemuxLogs to split them.
+// The caller must close the returned reader.
+func (c *dockerClient) ContainerLogs(ctx context.Context, id string, opts LogOptions) (io.ReadCloser, error) {
+	rc, err := c.cli.ContainerLogs(ctx, id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Since:      opts.Since,
+		Tail:       opts.Tail,
+		Timestamps: opts.Timestamps,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "No such container") {
+			return nil, ErrContainerNotFound(id)
+		}
+		return nil, ErrContainerLogs(id, err)
+	}
+	return rc, nil
+}
+
+// ContainerCreate creates a container without starting it and returns its ID.
+func (c *dockerClient) ContainerCreate(ctx context.Context, opts ContainerCreateOptions) (string, error) {
+	hostConfig := &container.HostConfig{
+		NetworkMode: container.NetworkMode(opts.Network),
+		ExtraHosts:  opts.ExtraHosts,
+	}
+	for _, m := range opts.Mounts {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:     mount.Type(m.Type),
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
+
+	config := &container.Config{
+		Image:      opts.Image,
+		Entrypoint: opts.Entrypoint,
+		Cmd:        opts.Cmd,
+		Env:        opts.Env,
+		Labels:     opts.Labels,
+	}
+	if len(opts.Ports) > 0 {
+		config.ExposedPorts = nat.PortSet{}
+		hostConfig.PortBindings = nat.PortMap{}
+		for _, p := range opts.Ports {
+			proto := p.Protocol
+			if proto == "" {
+				proto = "tcp"
+			}
+			port := nat.Port(fmt.Sprintf("%d/%s", p.ContainerPort, proto))
+			config.ExposedPorts[port] = struct{}{}
+			if p.HostPort != 0 {
+				hostConfig.PortBindings[port] = append(hostConfig.PortBindings[port], nat.PortBinding{HostPort: strconv.Itoa(p.HostPort)})
+			}
+		}
+	}
+
+	var networking *network.NetworkingConfig
+	if opts.Network != "" && len(opts.Aliases) > 0 {
+		networking = &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+			opts.Network: {Aliases: opts.Aliases},
+		}}
+	}
+
+	resp, err := c.cli.ContainerCreate(ctx, config, hostConfig, networking, nil, opts.Name)
+	if err != nil {
+		return "", ErrContainerCreate(opts.Name, err)
+	}
+	return resp.ID, nil
+}
+
+// ContainerStart starts a created or stopped container.
+func (c *dockerClient) ContainerStart(ctx context.Context, id string) error {
+	if err := c.cli.ContainerStart(ctx, id, container.StartOptions{}); err != nil {
+		if strings.Contains(err.Error(), "No such container") {
+			return ErrContainerNotFound(id)
+		}
+		return ErrContainerStart(id, err)
+	}
+	return nil
+}
+
+// ContainerStop stops a running container with the daemon's default
+// grace period. Stopping a stopped container is not an error.
+func (c *dockerClient) ContainerStop(ctx context.Context, id string) error {
+	if err := c.cli.ContainerStop(ctx, id, container.StopOptions{}); err != nil {
+		if strings.Contains(err.Error(), "No such container") {
+			return ErrContainerNotFound(id)
+		}
+		return ErrContainerStop(id, err)
+	}
+	return nil
+}
+
+// ContainerWait blocks until a container stops and returns its exit code.
+func (c *dockerClient) ContainerWait(ctx context.Context, id string) (int64, error) {
+	respCh, errCh := c.cli.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+	select {
+	case resp := <-respCh:
+		if resp.Error != nil {
+			return resp.StatusCode, ErrContainerWait(id, errors.New(resp.Error.Message))
+		}
+		return resp.StatusCode, nil
+	case err := <-errCh:
+		return 0, ErrContainerWait(id, err)
+	}
+}
+
+// ContainerRemove force-removes a container and its anonymous volumes.
+// Removing a missing container is not an error.
+func (c *dockerClient) ContainerRemove(ctx context.Context, id string) error {
+	err := c.cli.ContainerRemove(ctx, id, container.RemoveOptions{Force: true, RemoveVolumes: true})
+	if err != nil && !strings.Contains(err.Error(), "No such container") {
+		return ErrContainerRemove(id, err)
+	}
+	return nil
+}
+
+// ContainerExec runs a command in a running container, streaming its
+// output to opts.Stdout and opts.Stderr, and returns its exit code once it
+// finishes.
+func (c *dockerClient) ContainerExec(ctx context.Context, id string, opts ExecOptions) (int, error) {
+	exec, err := c.cli.ContainerExecCreate(ctx, id, container.ExecOptions{
+		Cmd:          opts.Cmd,
+		Env:          opts.Env,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, ErrContainerExec(id, err)
+	}
+	resp, err := c.cli.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return 0, ErrContainerExec(id, err)
+	}
+	defer resp.Close()
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	if _, err := stdcopy.StdCopy(stdout, stderr, resp.Reader); err != nil {
+		return 0, ErrContainerExec(id, err)
+	}
+	inspect, err := c.cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return 0, ErrContainerExec(id, err)
+	}
+	return inspect.ExitCode, nil
+}
+
+// CopyFromContainer returns a tar stream of path inside a container. The
+// container does not need to be running. The caller must close the reader.
+func (c *dockerClient) CopyFromContainer(ctx context.Context, id, path string) (io.ReadCloser, error) {
+	rc, _, err := c.cli.CopyFromContainer(ctx, id, path)
+	if err != nil {
+		return nil, ErrContainerCopy(id, path, err)
+	}
+	return rc, nil
+}
+
+// CopyToContainer extracts a tar stream into path inside a container. The
+// container does not need to be running.
+func (c *dockerClient) CopyToContainer(ctx context.Context, id, path string, content io.Reader) error {
+	if err := c.cli.CopyToContainer(ctx, id, path, content, container.CopyToContainerOptions{}); err != nil {
+		return ErrContainerCopy(id, path, err)
+	}
+	return nil
+}
+
+// DemuxLogs copies a container log stream to stdout and stderr. Containers
+// started with a TTY produce a raw stream that goes entirely to stdout;
+// all others use Docker's multiplexed framing.
+func DemuxLogs(src io.Reader, tty bool, stdout, stderr io.Writer) error {
+	if tty {
+		_, err := io.Copy(stdout, src)
+		return err
+	}
+	_, err := stdcopy.StdCopy(stdout, stderr, src)
+	return err
+}
+
+// containerFromDocker converts a Docker container summary to our Container type.
+func containerFromDocker(c container.Summary) Container {
+	name := ""
+	if len(c.Names) > 0 {
+		name = strings.TrimPrefix(c.Names[0], "/")
+	}
+
+	return Container{
+		ID:      c.ID,
+		Name:    name,
+		Image:   c.Image,
+		State:   string(c.State),
+		Status:  c.Status,
+		Labels:  c.Labels,
+		Created: time.Unix(c.Created, 0),
+	}
+}
+
+// containerFromDockerInspect converts a Docker inspect response to our Container type.
+func containerFromDockerInspect(c container.InspectResponse) Container {
+	ctr := Container{}
+	if c.ContainerJSONBase != nil {
+		ctr.ID = c.ID
+		ctr.Name = strings.TrimPrefix(c.Name, "/")
+		ctr.Image = c.Image
+		ctr.RestartCount = c.RestartCount
+		if c.State != nil {
+			ctr.State = string(c.State.Status)
+			ctr.ExitCode = c.State.ExitCode
+			ctr.OOMKilled = c.State.OOMKilled
+			if c.State.Health != nil {
+				ctr.Health = string(c.State.Health.Status)
+			}
+		}
+		if created, err := time.Parse(time.RFC3339Nano, c.Created); err == nil {
+			ctr.Created = created
+		}
+	}
+	if c.Config != nil {
+		ctr.Image = c.Config.Image
+		ctr.Labels = c.Config.Labels
+		ctr.TTY = c.Config.Tty
+	}
+	return ctr
+}
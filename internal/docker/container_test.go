@@ -0,0 +1,125 @@
+package docker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDemuxLogs(t *testing.T) {
+	t.Parallel()
+
+	var muxed bytes.Buffer
+	stdcopy.NewStdWriter(&muxed, stdcopy.Stdout).Write([]byte("out line\n"))
+	stdcopy.NewStdWriter(&muxed, stdcopy.Stderr).Write([]byte("err line\n"))
+
+	tests := map[string]struct {
+		src        string
+		tty        bool
+		wantStdout string
+		wantStderr string
+	}{
+		"multiplexed stream": {
+			src:        muxed.String(),
+			tty:        false,
+			wantStdout: "out line\n",
+			wantStderr: "err line\n",
+		},
+		"tty stream": {
+			src:        "raw tty output\r\n",
+			tty:        true,
+			wantStdout: "raw tty output\r\n",
+			wantStderr: "",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout, stderr bytes.Buffer
+			if err := DemuxLogs(strings.NewReader(tc.src), tc.tty, &stdout, &stderr); err != nil {
+				t.Fatalf("DemuxLogs() error = %v", err)
+			}
+			if stdout.String() != tc.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tc.wantStdout)
+			}
+			if stderr.String() != tc.wantStderr {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tc.wantStderr)
+			}
+		})
+	}
+}
+
+func TestContainerFromDocker(t *testing.T) {
+	t.Parallel()
+
+	got := containerFromDocker(container.Summary{
+		ID:      "abc123",
+		Names:   []string{"/ai-agents-redis"},
+		Image:   "redis:7",
+		State:   container.StateRunning,
+		Status:  "Up 5 minutes",
+		Labels:  map[string]string{"yar.service": "redis"},
+		Created: 1700000000,
+	})
+
+	want := Container{
+		ID:      "abc123",
+		Name:    "ai-agents-redis",
+		Image:   "redis:7",
+		State:   "running",
+		Status:  "Up 5 minutes",
+		Labels:  map[string]string{"yar.service": "redis"},
+		Created: time.Unix(1700000000, 0),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("containerFromDocker() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestContainerFromDockerInspect(t *testing.T) {
+	t.Parallel()
+
+	got := containerFromDockerInspect(container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{
+			ID:           "abc123",
+			Name:         "/ai-agents-redis",
+			Created:      "2026-01-01T00:00:00Z",
+			RestartCount: 4,
+			State: &container.State{
+				Status:    container.StateExited,
+				ExitCode:  137,
+				OOMKilled: true,
+				Health:    &container.Health{Status: container.Unhealthy},
+			},
+		},
+		Config: &container.Config{
+			Image:  "redis:7",
+			Labels: map[string]string{"yar.service": "redis"},
+			Tty:    true,
+		},
+	})
+
+	want := Container{
+		ID:           "abc123",
+		Name:         "ai-agents-redis",
+		Image:        "redis:7",
+		State:        "exited",
+		Labels:       map[string]string{"yar.service": "redis"},
+		Created:      time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		TTY:          true,
+		RestartCount: 4,
+		ExitCode:     137,
+		OOMKilled:    true,
+		Health:       "unhealthy",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("containerFromDockerInspect() mismatch (-want +got):\n%s", diff)
+	}
+}
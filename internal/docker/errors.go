@@ -1,6 +1,10 @@
 package docker
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // DockerError represents a Docker operation failure.
 type DockerError struct {
@@ -53,6 +57,20 @@ func ErrNetworkInspect(name string, err error) *DockerError {
 	return NewDockerError("network.inspect", name, "failed to inspect network", err)
 }
 
+// IsNotFound reports whether err is, or wraps, a container or network not
+// found error.
+func IsNotFound(err error) bool {
+	var e *DockerError
+	return errors.As(err, &e) && e.Err == nil && strings.HasSuffix(e.Message, "not found")
+}
+
+// IsNetworkInUse reports whether err is, or wraps, an ErrNetworkInUse
+// error.
+func IsNetworkInUse(err error) bool {
+	var e *DockerError
+	return errors.As(err, &e) && e.Op == "network.remove" && strings.HasPrefix(e.Message, "network has ")
+}
+
 // ErrNetworkNotFound creates a network not found error.
 func ErrNetworkNotFound(name string) *DockerError {
 	return NewDockerError("network.inspect", name, "network not found", nil)
@@ -67,6 +85,82 @@ func ErrNetworkInUse(name string, containers []string) *DockerError {
 	}
 }
 
+// ErrContainerList creates a container listing error.
+func ErrContainerList(err error) *DockerError {
+	return NewDockerError("container.list", "", "failed to list containers", err)
+}
+
+// ErrContainerInspect creates a container inspect error.
+func ErrContainerInspect(id string, err error) *DockerError {
+	return NewDockerError("container.inspect", id, "failed to inspect container", err)
+}
+
+// ErrContainerLogs creates a container logs error.
+func ErrContainerLogs(id string, err error) *DockerError {
+	return NewDockerError("container.logs", id, "failed to read container logs", err)
+}
+
+// ErrContainerNotFound creates a container not found error.
+func ErrContainerNotFound(id string) *DockerError {
+	return NewDockerError("container.inspect", id, "container not found", nil)
+}
+
+// ErrContainerCreate creates a container creation error.
+func ErrContainerCreate(name string, err error) *DockerError {
+	return NewDockerError("container.create", name, "failed to create container", err)
+}
+
+// ErrContainerStart creates a container start error.
+func ErrContainerStart(id string, err error) *DockerError {
+	return NewDockerError("container.start", id, "failed to start container", err)
+}
+
+// ErrContainerStop creates a container stop error.
+func ErrContainerStop(id string, err error) *DockerError {
+	return NewDockerError("container.stop", id, "failed to stop container", err)
+}
+
+// ErrContainerWait creates a container wait error.
+func ErrContainerWait(id string, err error) *DockerError {
+	return NewDockerError("container.wait", id, "failed waiting for container", err)
+}
+
+// ErrContainerRemove creates a container removal error.
+func ErrContainerRemove(id string, err error) *DockerError {
+	return NewDockerError("container.remove", id, "failed to remove container", err)
+}
+
+// ErrContainerExec creates an error for a command that could not be run in
+// a container.
+func ErrContainerExec(id string, err error) *DockerError {
+	return NewDockerError("container.exec", id, "failed to run command in container", err)
+}
+
+// ErrContainerCopy creates an error for a failed copy to or from a container.
+func ErrContainerCopy(id, path string, err error) *DockerError {
+	return NewDockerError("container.copy", id+":"+path, "failed to copy container files", err)
+}
+
+// ErrVolumeList creates a volume listing error.
+func ErrVolumeList(err error) *DockerError {
+	return NewDockerError("volume.list", "", "failed to list volumes", err)
+}
+
+// ErrVolumeCreate creates a volume creation error.
+func ErrVolumeCreate(name string, err error) *DockerError {
+	return NewDockerError("volume.create", name, "failed to create volume", err)
+}
+
+// ErrVolumeRemove creates a volume removal error.
+func ErrVolumeRemove(name string, err error) *DockerError {
+	return NewDockerError("volume.remove", name, "failed to remove volume", err)
+}
+
+// ErrImagePull creates an image pull error.
+func ErrImagePull(ref string, err error) *DockerError {
+	return NewDockerError("image.pull", ref, "failed to pull image", err)
+}
+
 // ErrDaemonConnection creates a Docker daemon connection error.
 func ErrDaemonConnection(err error) *DockerError {
 	return &DockerError{
@@ -2,6 +2,7 @@ package docker
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -177,6 +178,24 @@ func TestErrorConstructors(t *testing.T) {
 			wantName:    "my-net",
 			wantHasErr:  false,
 		},
+		"ErrContainerCopy": {
+			constructor: func() *DockerError { return ErrContainerCopy("c-1", "/data", underlying) },
+			wantOp:      "container.copy",
+			wantName:    "c-1:/data",
+			wantHasErr:  true,
+		},
+		"ErrVolumeCreate": {
+			constructor: func() *DockerError { return ErrVolumeCreate("redis-data", underlying) },
+			wantOp:      "volume.create",
+			wantName:    "redis-data",
+			wantHasErr:  true,
+		},
+		"ErrImagePull": {
+			constructor: func() *DockerError { return ErrImagePull("redis:7", underlying) },
+			wantOp:      "image.pull",
+			wantName:    "redis:7",
+			wantHasErr:  true,
+		},
 		"ErrDaemonConnection": {
 			constructor: func() *DockerError { return ErrDaemonConnection(underlying) },
 			wantOp:      "connect",
@@ -248,3 +267,39 @@ func TestErrNetworkInUse_Message(t *testing.T) {
 		})
 	}
 }
+
+func TestIsNotFound(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		err  error
+		want bool
+	}{
+		"container not found": {err: ErrContainerNotFound("abc"), want: true},
+		"network not found":   {err: ErrNetworkNotFound("yar-net"), want: true},
+		"wrapped":             {err: fmt.Errorf("start: %w", ErrContainerNotFound("abc")), want: true},
+		"other docker error":  {err: ErrContainerStart("abc", errors.New("boom")), want: false},
+		"plain error":         {err: errors.New("not found"), want: false},
+		"nil":                 {err: nil, want: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := IsNotFound(tc.err); got != tc.want {
+				t.Errorf("IsNotFound(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsNetworkInUse(t *testing.T) {
+	t.Parallel()
+
+	if !IsNetworkInUse(fmt.Errorf("remove: %w", ErrNetworkInUse("yar-net", []string{"abc"}))) {
+		t.Error("IsNetworkInUse(ErrNetworkInUse) = false, want true")
+	}
+	if IsNetworkInUse(ErrNetworkRemove("yar-net", errors.New("boom"))) {
+		t.Error("IsNetworkInUse(ErrNetworkRemove) = true, want false")
+	}
+}
@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/docker/docker/api/types/image"
+)
+
+// pullMessage is the part of a pull progress message yar inspects.
+type pullMessage struct {
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail,omitempty"`
+	ErrorMessage string `json:"error,omitempty"`
+}
+
+// ImagePull pulls an image and waits for the pull to finish. Cancelling ctx
+// aborts the pull; the returned error then wraps ctx.Err().
+func (c *dockerClient) ImagePull(ctx context.Context, ref string) error {
+	rc, err := c.cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return ErrImagePull(ref, err)
+	}
+	defer rc.Close()
+
+	// The daemon keeps pulling until the progress stream is fully read, and
+	// reports failures inside the stream rather than as an HTTP error.
+	if err := readPullProgress(rc); err != nil {
+		if ctx.Err() != nil {
+			return ErrImagePull(ref, ctx.Err())
+		}
+		return ErrImagePull(ref, err)
+	}
+	return nil
+}
+
+// readPullProgress consumes a pull progress stream, returning the first
+// error message it reports.
+func readPullProgress(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg pullMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != nil && msg.Error.Message != "" {
+			return errors.New(msg.Error.Message)
+		}
+		if msg.ErrorMessage != "" {
+			return errors.New(msg.ErrorMessage)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadPullProgress(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		stream  string
+		wantErr string
+	}{
+		"success": {
+			stream: `{"status":"Pulling from library/redis","id":"7"}
+{"status":"Download complete","id":"abc"}
+{"status":"Status: Downloaded newer image for redis:7"}
+`,
+		},
+		"empty stream": {
+			stream: "",
+		},
+		"error detail": {
+			stream: `{"status":"Pulling from library/nope"}
+{"errorDetail":{"message":"manifest unknown"},"error":"manifest unknown"}
+`,
+			wantErr: "manifest unknown",
+		},
+		"error without detail": {
+			stream:  `{"error":"unauthorized"}`,
+			wantErr: "unauthorized",
+		},
+		"malformed": {
+			stream:  `{"status":`,
+			wantErr: "unexpected EOF",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := readPullProgress(strings.NewReader(tc.stream))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("readPullProgress() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("readPullProgress() error = %v, want containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
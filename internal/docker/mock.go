@@ -2,6 +2,9 @@ package docker
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"strings"
 	"sync"
 )
 
@@ -10,29 +13,79 @@ type MockClient struct {
 	mu sync.Mutex
 
 	// Mock responses
-	PingError            error
-	CloseError           error
-	NetworkCreateID      string
-	NetworkCreateError   error
-	NetworkRemoveError   error
-	NetworkListResult    []Network
-	NetworkListError     error
-	NetworkInspectResult *Network
-	NetworkInspectError  error
+	PingError               error
+	CloseError              error
+	NetworkCreateID         string
+	NetworkCreateError      error
+	NetworkRemoveError      error
+	NetworkListResult       []Network
+	NetworkListError        error
+	NetworkInspectResult    *Network
+	NetworkInspectError     error
+	ContainerListResult     []Container
+	ContainerListError      error
+	ContainerInspectResults map[string]*Container // keyed by container ID
+	ContainerInspectError   error
+	ContainerLogsResults    map[string]string // raw log stream keyed by container ID
+	ContainerLogsError      error
+	ContainerCreateError    error
+	ContainerStartError     error
+	ContainerStopError      error
+	ContainerWaitCode       int64
+	ContainerWaitError      error
+	ContainerRemoveError    error
+	ContainerExecCode       int
+	ContainerExecError      error
+	CopyFromContainerError  error
+	CopyToContainerError    error
+	VolumeListResult        []Volume
+	VolumeListError         error
+	VolumeCreateError       error
+	VolumeCreateResults     map[string]*Volume // existing volumes keyed by name, returned unchanged
+	VolumeRemoveError       error
+	ImagePullError          error
 
 	// Track calls
-	PingCalls           int
-	CloseCalls          int
-	NetworkCreateCalls  []NetworkCreateCall
-	NetworkRemoveCalls  []string
-	NetworkListCalls    []NetworkListOptions
-	NetworkInspectCalls []string
+	PingCalls             int
+	CloseCalls            int
+	NetworkCreateCalls    []NetworkCreateCall
+	NetworkRemoveCalls    []string
+	NetworkListCalls      []NetworkListOptions
+	NetworkInspectCalls   []string
+	ContainerListCalls    []ContainerListOptions
+	ContainerInspectCalls []string
+	ContainerLogsCalls    []ContainerLogsCall
+	ContainerCreateCalls  []ContainerCreateOptions
+	ContainerStartCalls   []string
+	ContainerStopCalls    []string
+	ContainerWaitCalls    []string
+	ContainerRemoveCalls  []string
+	ContainerExecCalls    []ContainerExecCall
+	CopyFromCalls         []CopyCall
+	CopyToCalls           []CopyCall
+	VolumeListCalls       []VolumeListOptions
+	VolumeCreateCalls     []VolumeCreateCall
+	VolumeRemoveCalls     []string
+	ImagePullCalls        []string
 
 	// Behavior callbacks (for complex scenarios)
 	OnNetworkCreate  func(ctx context.Context, name string, opts NetworkCreateOptions) (string, error)
 	OnNetworkRemove  func(ctx context.Context, name string) error
 	OnNetworkList    func(ctx context.Context, opts NetworkListOptions) ([]Network, error)
 	OnNetworkInspect func(ctx context.Context, name string) (*Network, error)
+	OnContainerList  func(ctx context.Context, opts ContainerListOptions) ([]Container, error)
+	OnContainerLogs  func(ctx context.Context, id string, opts LogOptions) (io.ReadCloser, error)
+	OnImagePull      func(ctx context.Context, ref string) error
+	OnContainerStart func(ctx context.Context, id string) error
+	OnContainerExec  func(ctx context.Context, id string, opts ExecOptions) (int, error)
+	OnCopyFrom       func(ctx context.Context, id, path string) (io.ReadCloser, error)
+	OnCopyTo         func(ctx context.Context, id, path string, content []byte) error
+}
+
+// ContainerExecCall records a ContainerExec call.
+type ContainerExecCall struct {
+	ID   string
+	Opts ExecOptions
 }
 
 // NetworkCreateCall records a NetworkCreate call.
@@ -41,6 +94,26 @@ type NetworkCreateCall struct {
 	Opts NetworkCreateOptions
 }
 
+// ContainerLogsCall records a ContainerLogs call.
+type ContainerLogsCall struct {
+	ID   string
+	Opts LogOptions
+}
+
+// CopyCall records a CopyFromContainer or CopyToContainer call. Content is
+// the tar stream passed to CopyToContainer.
+type CopyCall struct {
+	ID      string
+	Path    string
+	Content []byte
+}
+
+// VolumeCreateCall records a VolumeCreate call.
+type VolumeCreateCall struct {
+	Name string
+	Opts VolumeCreateOptions
+}
+
 // NewMockClient creates a new MockClient.
 func NewMockClient() *MockClient {
 	return &MockClient{}
@@ -135,6 +208,227 @@ func (m *MockClient) NetworkInspect(ctx context.Context, name string) (*Network,
 	return m.NetworkInspectResult, nil
 }
 
+// ContainerList implements Client.ContainerList.
+func (m *MockClient) ContainerList(ctx context.Context, opts ContainerListOptions) ([]Container, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ContainerListCalls = append(m.ContainerListCalls, opts)
+
+	if m.OnContainerList != nil {
+		return m.OnContainerList(ctx, opts)
+	}
+
+	if m.ContainerListError != nil {
+		return nil, m.ContainerListError
+	}
+
+	return m.ContainerListResult, nil
+}
+
+// ContainerInspect implements Client.ContainerInspect.
+func (m *MockClient) ContainerInspect(ctx context.Context, id string) (*Container, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ContainerInspectCalls = append(m.ContainerInspectCalls, id)
+
+	if m.ContainerInspectError != nil {
+		return nil, m.ContainerInspectError
+	}
+
+	ctr, ok := m.ContainerInspectResults[id]
+	if !ok {
+		return nil, ErrContainerNotFound(id)
+	}
+	return ctr, nil
+}
+
+// ContainerLogs implements Client.ContainerLogs.
+func (m *MockClient) ContainerLogs(ctx context.Context, id string, opts LogOptions) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ContainerLogsCalls = append(m.ContainerLogsCalls, ContainerLogsCall{ID: id, Opts: opts})
+
+	if m.OnContainerLogs != nil {
+		return m.OnContainerLogs(ctx, id, opts)
+	}
+
+	if m.ContainerLogsError != nil {
+		return nil, m.ContainerLogsError
+	}
+
+	return io.NopCloser(strings.NewReader(m.ContainerLogsResults[id])), nil
+}
+
+// ContainerCreate implements Client.ContainerCreate. IDs are generated
+// from the call count.
+func (m *MockClient) ContainerCreate(ctx context.Context, opts ContainerCreateOptions) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ContainerCreateCalls = append(m.ContainerCreateCalls, opts)
+
+	if m.ContainerCreateError != nil {
+		return "", m.ContainerCreateError
+	}
+	return fmt.Sprintf("mock-container-%d", len(m.ContainerCreateCalls)), nil
+}
+
+// ContainerStart implements Client.ContainerStart.
+func (m *MockClient) ContainerStart(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ContainerStartCalls = append(m.ContainerStartCalls, id)
+
+	if m.OnContainerStart != nil {
+		return m.OnContainerStart(ctx, id)
+	}
+
+	return m.ContainerStartError
+}
+
+// ContainerStop implements Client.ContainerStop.
+func (m *MockClient) ContainerStop(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ContainerStopCalls = append(m.ContainerStopCalls, id)
+	return m.ContainerStopError
+}
+
+// ContainerWait implements Client.ContainerWait.
+func (m *MockClient) ContainerWait(ctx context.Context, id string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ContainerWaitCalls = append(m.ContainerWaitCalls, id)
+
+	if m.ContainerWaitError != nil {
+		return 0, m.ContainerWaitError
+	}
+	return m.ContainerWaitCode, nil
+}
+
+// ContainerRemove implements Client.ContainerRemove.
+func (m *MockClient) ContainerRemove(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ContainerRemoveCalls = append(m.ContainerRemoveCalls, id)
+	return m.ContainerRemoveError
+}
+
+// ContainerExec implements Client.ContainerExec.
+func (m *MockClient) ContainerExec(ctx context.Context, id string, opts ExecOptions) (int, error) {
+	m.mu.Lock()
+	m.ContainerExecCalls = append(m.ContainerExecCalls, ContainerExecCall{ID: id, Opts: opts})
+	callback := m.OnContainerExec
+	m.mu.Unlock()
+
+	if callback != nil {
+		return callback(ctx, id, opts)
+	}
+	if m.ContainerExecError != nil {
+		return 0, m.ContainerExecError
+	}
+	return m.ContainerExecCode, nil
+}
+
+// CopyFromContainer implements Client.CopyFromContainer. Without a
+// callback it returns an empty stream.
+func (m *MockClient) CopyFromContainer(ctx context.Context, id, path string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.CopyFromCalls = append(m.CopyFromCalls, CopyCall{ID: id, Path: path})
+
+	if m.OnCopyFrom != nil {
+		return m.OnCopyFrom(ctx, id, path)
+	}
+
+	if m.CopyFromContainerError != nil {
+		return nil, m.CopyFromContainerError
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+// CopyToContainer implements Client.CopyToContainer. The content is read
+// fully and recorded.
+func (m *MockClient) CopyToContainer(ctx context.Context, id, path string, content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.CopyToCalls = append(m.CopyToCalls, CopyCall{ID: id, Path: path, Content: data})
+
+	if m.OnCopyTo != nil {
+		return m.OnCopyTo(ctx, id, path, data)
+	}
+
+	return m.CopyToContainerError
+}
+
+// VolumeList implements Client.VolumeList.
+func (m *MockClient) VolumeList(ctx context.Context, opts VolumeListOptions) ([]Volume, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.VolumeListCalls = append(m.VolumeListCalls, opts)
+
+	if m.VolumeListError != nil {
+		return nil, m.VolumeListError
+	}
+	return m.VolumeListResult, nil
+}
+
+// VolumeCreate implements Client.VolumeCreate.
+func (m *MockClient) VolumeCreate(ctx context.Context, name string, opts VolumeCreateOptions) (*Volume, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.VolumeCreateCalls = append(m.VolumeCreateCalls, VolumeCreateCall{Name: name, Opts: opts})
+
+	if m.VolumeCreateError != nil {
+		return nil, m.VolumeCreateError
+	}
+	if v, ok := m.VolumeCreateResults[name]; ok {
+		return v, nil
+	}
+	return &Volume{Name: name, Driver: "local", Labels: opts.Labels}, nil
+}
+
+// VolumeRemove implements Client.VolumeRemove.
+func (m *MockClient) VolumeRemove(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.VolumeRemoveCalls = append(m.VolumeRemoveCalls, name)
+	return m.VolumeRemoveError
+}
+
+// ImagePull implements Client.ImagePull.
+func (m *MockClient) ImagePull(ctx context.Context, ref string) error {
+	m.mu.Lock()
+	m.ImagePullCalls = append(m.ImagePullCalls, ref)
+	onImagePull := m.OnImagePull
+	pullErr := m.ImagePullError
+	m.mu.Unlock()
+
+	// The callback runs unlocked so it can block on ctx like a real pull.
+	if onImagePull != nil {
+		return onImagePull(ctx, ref)
+	}
+
+	return pullErr
+}
+
 // Reset clears all recorded calls and resets mock state.
 func (m *MockClient) Reset() {
 	m.mu.Lock()
@@ -146,6 +440,20 @@ func (m *MockClient) Reset() {
 	m.NetworkRemoveCalls = nil
 	m.NetworkListCalls = nil
 	m.NetworkInspectCalls = nil
+	m.ContainerListCalls = nil
+	m.ContainerInspectCalls = nil
+	m.ContainerLogsCalls = nil
+	m.ContainerCreateCalls = nil
+	m.ContainerStartCalls = nil
+	m.ContainerStopCalls = nil
+	m.ContainerWaitCalls = nil
+	m.ContainerRemoveCalls = nil
+	m.CopyFromCalls = nil
+	m.CopyToCalls = nil
+	m.VolumeListCalls = nil
+	m.VolumeCreateCalls = nil
+	m.VolumeRemoveCalls = nil
+	m.ImagePullCalls = nil
 }
 
 // Ensure MockClient implements Client.
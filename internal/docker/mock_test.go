@@ -3,6 +3,8 @@ package docker
 import (
 	"context"
 	"errors"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -479,6 +481,209 @@ func TestMockClient_NetworkInspect_RecordsName(t *testing.T) {
 	}
 }
 
+func TestMockClient_ContainerList(t *testing.T) {
+	t.Parallel()
+
+	mock := NewMockClient()
+	mock.ContainerListResult = []Container{{ID: "c-1", Name: "redis"}}
+
+	opts := ContainerListOptions{All: true, Filters: map[string][]string{"label": {"yar.managed=true"}}}
+	got, err := mock.ContainerList(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("ContainerList() error = %v", err)
+	}
+	if diff := cmp.Diff(mock.ContainerListResult, got); diff != "" {
+		t.Errorf("ContainerList() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]ContainerListOptions{opts}, mock.ContainerListCalls); diff != "" {
+		t.Errorf("ContainerListCalls mismatch (-want +got):\n%s", diff)
+	}
+
+	mock.ContainerListError = ErrContainerList(errors.New("boom"))
+	if _, err := mock.ContainerList(context.Background(), opts); err == nil {
+		t.Error("ContainerList() error = nil, want configured error")
+	}
+}
+
+func TestMockClient_ContainerInspect(t *testing.T) {
+	t.Parallel()
+
+	mock := NewMockClient()
+	mock.ContainerInspectResults = map[string]*Container{"c-1": {ID: "c-1", TTY: true}}
+
+	got, err := mock.ContainerInspect(context.Background(), "c-1")
+	if err != nil {
+		t.Fatalf("ContainerInspect() error = %v", err)
+	}
+	if !got.TTY {
+		t.Error("ContainerInspect() TTY = false, want true")
+	}
+
+	if _, err := mock.ContainerInspect(context.Background(), "missing"); err == nil {
+		t.Error("ContainerInspect(missing) error = nil, want not found")
+	}
+	if diff := cmp.Diff([]string{"c-1", "missing"}, mock.ContainerInspectCalls); diff != "" {
+		t.Errorf("ContainerInspectCalls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMockClient_ContainerLogs(t *testing.T) {
+	t.Parallel()
+
+	mock := NewMockClient()
+	mock.ContainerLogsResults = map[string]string{"c-1": "hello\n"}
+
+	rc, err := mock.ContainerLogs(context.Background(), "c-1", LogOptions{Follow: true})
+	if err != nil {
+		t.Fatalf("ContainerLogs() error = %v", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(data) != "hello\n" {
+		t.Errorf("ContainerLogs() = %q, want %q", data, "hello\n")
+	}
+	if len(mock.ContainerLogsCalls) != 1 || !mock.ContainerLogsCalls[0].Opts.Follow {
+		t.Errorf("ContainerLogsCalls = %+v, want one call with Follow", mock.ContainerLogsCalls)
+	}
+}
+
+func TestMockClient_ContainerLifecycle(t *testing.T) {
+	t.Parallel()
+
+	mock := NewMockClient()
+	mock.ContainerWaitCode = 3
+	ctx := context.Background()
+
+	opts := ContainerCreateOptions{
+		Image:  "busybox:stable",
+		Mounts: []Mount{{Type: "volume", Source: "redis-data", Target: "/data"}},
+	}
+	id, err := mock.ContainerCreate(ctx, opts)
+	if err != nil {
+		t.Fatalf("ContainerCreate() error = %v", err)
+	}
+	if id != "mock-container-1" {
+		t.Errorf("ContainerCreate() = %q, want mock-container-1", id)
+	}
+	if err := mock.ContainerStart(ctx, id); err != nil {
+		t.Fatalf("ContainerStart() error = %v", err)
+	}
+	code, err := mock.ContainerWait(ctx, id)
+	if err != nil || code != 3 {
+		t.Errorf("ContainerWait() = %d, %v, want 3, nil", code, err)
+	}
+	mock.ContainerExecCode = 1
+	exec := ExecOptions{Cmd: []string{"redis-cli", "ping"}, Env: []string{"A=1"}}
+	if code, err := mock.ContainerExec(ctx, id, exec); err != nil || code != 1 {
+		t.Errorf("ContainerExec() = %d, %v, want 1, nil", code, err)
+	}
+	if diff := cmp.Diff([]ContainerExecCall{{ID: id, Opts: exec}}, mock.ContainerExecCalls); diff != "" {
+		t.Errorf("ContainerExecCalls mismatch (-want +got):\n%s", diff)
+	}
+	if err := mock.ContainerStop(ctx, id); err != nil {
+		t.Fatalf("ContainerStop() error = %v", err)
+	}
+	if err := mock.ContainerRemove(ctx, id); err != nil {
+		t.Fatalf("ContainerRemove() error = %v", err)
+	}
+
+	if diff := cmp.Diff([]ContainerCreateOptions{opts}, mock.ContainerCreateCalls); diff != "" {
+		t.Errorf("ContainerCreateCalls mismatch (-want +got):\n%s", diff)
+	}
+	for name, calls := range map[string][]string{
+		"start":  mock.ContainerStartCalls,
+		"wait":   mock.ContainerWaitCalls,
+		"stop":   mock.ContainerStopCalls,
+		"remove": mock.ContainerRemoveCalls,
+	} {
+		if diff := cmp.Diff([]string{id}, calls); diff != "" {
+			t.Errorf("%s calls mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+}
+
+func TestMockClient_Copy(t *testing.T) {
+	t.Parallel()
+
+	mock := NewMockClient()
+	ctx := context.Background()
+
+	if err := mock.CopyToContainer(ctx, "c-1", "/", strings.NewReader("tar")); err != nil {
+		t.Fatalf("CopyToContainer() error = %v", err)
+	}
+	want := []CopyCall{{ID: "c-1", Path: "/", Content: []byte("tar")}}
+	if diff := cmp.Diff(want, mock.CopyToCalls); diff != "" {
+		t.Errorf("CopyToCalls mismatch (-want +got):\n%s", diff)
+	}
+
+	mock.OnCopyFrom = func(ctx context.Context, id, path string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(id + path)), nil
+	}
+	rc, err := mock.CopyFromContainer(ctx, "c-1", "/data")
+	if err != nil {
+		t.Fatalf("CopyFromContainer() error = %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	if string(data) != "c-1/data" {
+		t.Errorf("CopyFromContainer() = %q, want c-1/data", data)
+	}
+}
+
+func TestMockClient_Volumes(t *testing.T) {
+	t.Parallel()
+
+	mock := NewMockClient()
+	mock.VolumeListResult = []Volume{{Name: "redis-data"}}
+	ctx := context.Background()
+
+	got, err := mock.VolumeList(ctx, VolumeListOptions{Filters: map[string][]string{"label": {"yar.managed=true"}}})
+	if err != nil {
+		t.Fatalf("VolumeList() error = %v", err)
+	}
+	if diff := cmp.Diff(mock.VolumeListResult, got); diff != "" {
+		t.Errorf("VolumeList() mismatch (-want +got):\n%s", diff)
+	}
+
+	labels := map[string]string{"yar.service": "redis"}
+	v, err := mock.VolumeCreate(ctx, "redis-data", VolumeCreateOptions{Labels: labels})
+	if err != nil {
+		t.Fatalf("VolumeCreate() error = %v", err)
+	}
+	if v.Name != "redis-data" || v.Labels["yar.service"] != "redis" {
+		t.Errorf("VolumeCreate() = %+v", v)
+	}
+
+	mock.VolumeListError = ErrVolumeList(errors.New("boom"))
+	if _, err := mock.VolumeList(ctx, VolumeListOptions{}); err == nil {
+		t.Error("VolumeList() error = nil, want configured error")
+	}
+}
+
+func TestMockClient_ImagePull(t *testing.T) {
+	t.Parallel()
+
+	mock := NewMockClient()
+	mock.OnImagePull = func(ctx context.Context, ref string) error {
+		<-ctx.Done()
+		return ErrImagePull(ref, ctx.Err())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := mock.ImagePull(ctx, "redis:7")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ImagePull() error = %v, want context.Canceled", err)
+	}
+	if len(mock.ImagePullCalls) != 1 || mock.ImagePullCalls[0] != "redis:7" {
+		t.Errorf("ImagePullCalls = %v, want [redis:7]", mock.ImagePullCalls)
+	}
+}
+
 func TestMockClient_Reset(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,141 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/yar-run/yar/internal/action"
+)
+
+// recordingClient passes every change through an action log. Reads go to
+// the wrapped client, so a dry run plans against the live daemon.
+type recordingClient struct {
+	Client
+	log *action.Log
+
+	mu    sync.Mutex
+	names map[string]string // container ID to name, for readable actions
+}
+
+// NewRecordingClient returns a Client that records network, container and
+// volume changes and image pulls in log. In a dry run they are not sent to
+// the daemon: created containers and networks get their name as ID, and
+// ContainerWait reports exit code 0 at once, since nothing ran.
+func NewRecordingClient(client Client, log *action.Log) Client {
+	return &recordingClient{Client: client, log: log, names: make(map[string]string)}
+}
+
+// NetworkCreate implements Client.NetworkCreate.
+func (c *recordingClient) NetworkCreate(ctx context.Context, name string, opts NetworkCreateOptions) (string, error) {
+	id := name
+	err := c.log.Do(action.Action{Kind: action.KindDocker, Op: "create", Object: "network " + name}, func() error {
+		var err error
+		id, err = c.Client.NetworkCreate(ctx, name, opts)
+		return err
+	})
+	return id, err
+}
+
+// NetworkRemove implements Client.NetworkRemove.
+func (c *recordingClient) NetworkRemove(ctx context.Context, name string) error {
+	return c.log.Do(action.Action{Kind: action.KindDocker, Op: "remove", Object: "network " + name}, func() error {
+		return c.Client.NetworkRemove(ctx, name)
+	})
+}
+
+// ContainerCreate implements Client.ContainerCreate.
+func (c *recordingClient) ContainerCreate(ctx context.Context, opts ContainerCreateOptions) (string, error) {
+	id := opts.Name
+	err := c.log.Do(action.Action{Kind: action.KindDocker, Op: "create", Object: "container " + opts.Name, Detail: opts.Image}, func() error {
+		var err error
+		id, err = c.Client.ContainerCreate(ctx, opts)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.names[id] = opts.Name
+	c.mu.Unlock()
+	return id, nil
+}
+
+// ContainerStart implements Client.ContainerStart.
+func (c *recordingClient) ContainerStart(ctx context.Context, id string) error {
+	return c.log.Do(action.Action{Kind: action.KindDocker, Op: "start", Object: c.container(id)}, func() error {
+		return c.Client.ContainerStart(ctx, id)
+	})
+}
+
+// ContainerStop implements Client.ContainerStop.
+func (c *recordingClient) ContainerStop(ctx context.Context, id string) error {
+	return c.log.Do(action.Action{Kind: action.KindDocker, Op: "stop", Object: c.container(id)}, func() error {
+		return c.Client.ContainerStop(ctx, id)
+	})
+}
+
+// ContainerWait implements Client.ContainerWait. A dry run never started
+// the container, so it reports success without waiting.
+func (c *recordingClient) ContainerWait(ctx context.Context, id string) (int64, error) {
+	if c.log.DryRun() {
+		return 0, nil
+	}
+	return c.Client.ContainerWait(ctx, id)
+}
+
+// ContainerRemove implements Client.ContainerRemove.
+func (c *recordingClient) ContainerRemove(ctx context.Context, id string) error {
+	return c.log.Do(action.Action{Kind: action.KindDocker, Op: "remove", Object: c.container(id)}, func() error {
+		return c.Client.ContainerRemove(ctx, id)
+	})
+}
+
+// CopyToContainer implements Client.CopyToContainer.
+func (c *recordingClient) CopyToContainer(ctx context.Context, id, path string, content io.Reader) error {
+	return c.log.Do(action.Action{Kind: action.KindDocker, Op: "copy", Object: c.container(id) + ":" + path}, func() error {
+		return c.Client.CopyToContainer(ctx, id, path, content)
+	})
+}
+
+// VolumeCreate implements Client.VolumeCreate.
+func (c *recordingClient) VolumeCreate(ctx context.Context, name string, opts VolumeCreateOptions) (*Volume, error) {
+	v := &Volume{Name: name, Driver: opts.Driver, Labels: opts.Labels}
+	err := c.log.Do(action.Action{Kind: action.KindDocker, Op: "create", Object: "volume " + name}, func() error {
+		var err error
+		v, err = c.Client.VolumeCreate(ctx, name, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// VolumeRemove implements Client.VolumeRemove.
+func (c *recordingClient) VolumeRemove(ctx context.Context, name string) error {
+	return c.log.Do(action.Action{Kind: action.KindDocker, Op: "remove", Object: "volume " + name}, func() error {
+		return c.Client.VolumeRemove(ctx, name)
+	})
+}
+
+// ImagePull implements Client.ImagePull.
+func (c *recordingClient) ImagePull(ctx context.Context, ref string) error {
+	return c.log.Do(action.Action{Kind: action.KindDocker, Op: "pull", Object: "image " + ref}, func() error {
+		return c.Client.ImagePull(ctx, ref)
+	})
+}
+
+// container formats a container as "container <name>", using the name it
+// was created with through this client when id is an ID.
+func (c *recordingClient) container(id string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name, ok := c.names[id]; ok {
+		return "container " + name
+	}
+	return "container " + id
+}
+
+// Ensure recordingClient implements Client.
+var _ Client = (*recordingClient)(nil)
@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/action"
+)
+
+func TestRecordingClient(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	for _, dryRun := range []bool{false, true} {
+		mock := NewMockClient()
+		mock.ContainerWaitCode = 3
+		log := action.NewLog(dryRun)
+		client := NewRecordingClient(mock, log)
+
+		if _, err := client.NetworkCreate(ctx, "yar-net", NetworkCreateOptions{}); err != nil {
+			t.Fatalf("NetworkCreate() error = %v", err)
+		}
+		if _, err := client.VolumeCreate(ctx, "app-redis-data", VolumeCreateOptions{}); err != nil {
+			t.Fatalf("VolumeCreate() error = %v", err)
+		}
+		id, err := client.ContainerCreate(ctx, ContainerCreateOptions{Name: "app-redis", Image: "redis:7"})
+		if err != nil {
+			t.Fatalf("ContainerCreate() error = %v", err)
+		}
+		if err := client.CopyToContainer(ctx, id, "/", strings.NewReader("")); err != nil {
+			t.Fatalf("CopyToContainer() error = %v", err)
+		}
+		if err := client.ContainerStart(ctx, id); err != nil {
+			t.Fatalf("ContainerStart() error = %v", err)
+		}
+		code, err := client.ContainerWait(ctx, id)
+		if err != nil {
+			t.Fatalf("ContainerWait() error = %v", err)
+		}
+		if err := client.ContainerRemove(ctx, "other"); err != nil {
+			t.Fatalf("ContainerRemove() error = %v", err)
+		}
+		if err := client.VolumeRemove(ctx, "app-redis-data"); err != nil {
+			t.Fatalf("VolumeRemove() error = %v", err)
+		}
+
+		want := []action.Action{
+			{Kind: action.KindDocker, Op: "create", Object: "network yar-net"},
+			{Kind: action.KindDocker, Op: "create", Object: "volume app-redis-data"},
+			{Kind: action.KindDocker, Op: "create", Object: "container app-redis", Detail: "redis:7"},
+			{Kind: action.KindDocker, Op: "copy", Object: "container app-redis:/"},
+			{Kind: action.KindDocker, Op: "start", Object: "container app-redis"},
+			{Kind: action.KindDocker, Op: "remove", Object: "container other"},
+			{Kind: action.KindDocker, Op: "remove", Object: "volume app-redis-data"},
+		}
+		if diff := cmp.Diff(want, log.Actions()); diff != "" {
+			t.Errorf("dryRun=%v: actions mismatch (-want +got):\n%s", dryRun, diff)
+		}
+
+		sent := len(mock.NetworkCreateCalls) + len(mock.VolumeCreateCalls) + len(mock.ContainerCreateCalls) +
+			len(mock.CopyToCalls) + len(mock.ContainerStartCalls) + len(mock.ContainerRemoveCalls) + len(mock.VolumeRemoveCalls)
+		switch {
+		case dryRun && (sent != 0 || code != 0 || id != "app-redis"):
+			t.Errorf("dry run sent %d changes, wait code %d, id %q", sent, code, id)
+		case !dryRun && (sent != 7 || code != 3):
+			t.Errorf("sent %d changes, wait code %d, want 7 and 3", sent, code)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package docker
 
-import "time"
+import (
+	"io"
+	"time"
+)
 
 // Network represents a Docker network.
 type Network struct {
@@ -40,3 +43,93 @@ type NetworkCreateOptions struct {
 type NetworkListOptions struct {
 	Filters map[string][]string // Filter by name, id, driver, label, etc.
 }
+
+// Container represents a Docker container.
+type Container struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Image   string            `json:"image"`
+	State   string            `json:"state"`  // created, running, paused, restarting, exited, dead
+	Status  string            `json:"status"` // human-readable status (e.g., "Up 5 minutes")
+	Labels  map[string]string `json:"labels,omitempty"`
+	Created time.Time         `json:"created"`
+
+	// Populated by ContainerInspect only.
+	TTY          bool   `json:"tty"`
+	RestartCount int    `json:"restartCount"`     // restarts by the daemon's restart policy
+	ExitCode     int    `json:"exitCode"`         // exit code of the last run
+	OOMKilled    bool   `json:"oomKilled"`        // last run was killed for exceeding its memory limit
+	Health       string `json:"health,omitempty"` // healthcheck status: starting, healthy, unhealthy; empty without a healthcheck
+}
+
+// ContainerListOptions configures container listing.
+type ContainerListOptions struct {
+	All     bool                // Include stopped containers
+	Filters map[string][]string // Filter by name, id, label, status, etc.
+}
+
+// LogOptions configures container log retrieval.
+type LogOptions struct {
+	Follow     bool   // Stream new output as it is written
+	Since      string // Show logs since timestamp (RFC3339) or relative duration (e.g., "10m")
+	Tail       string // Number of lines from the end, or "all"
+	Timestamps bool   // Prefix each line with an RFC3339Nano timestamp
+}
+
+// ContainerCreateOptions configures container creation.
+type ContainerCreateOptions struct {
+	Name       string            // Container name (optional)
+	Image      string            // Image reference
+	Entrypoint []string          // Entrypoint overriding the image default (optional)
+	Cmd        []string          // Command overriding the image default
+	Env        []string          // Environment variables as KEY=value
+	Labels     map[string]string // Container labels
+	Mounts     []Mount           // Volume and bind mounts
+	Ports      []PortBinding     // Container ports published on the host (optional)
+	Network    string            // Network to attach to (optional)
+	Aliases    []string          // Names the container resolves as on Network (optional)
+	ExtraHosts []string          // Extra /etc/hosts entries as host:ip (optional)
+}
+
+// PortBinding publishes a container port on a host port.
+type PortBinding struct {
+	ContainerPort int
+	HostPort      int    // 0 exposes the port without publishing it
+	Protocol      string // "tcp" (default) or "udp"
+}
+
+// ExecOptions configures a command run in a running container.
+type ExecOptions struct {
+	Cmd    []string  // Command and arguments
+	Env    []string  // Extra environment variables as KEY=value
+	Stdout io.Writer // Receives standard output (optional)
+	Stderr io.Writer // Receives standard error (optional)
+}
+
+// Mount attaches a volume or host path to a container.
+type Mount struct {
+	Type     string // "volume" or "bind"
+	Source   string // Volume name or host path
+	Target   string // Path inside the container
+	ReadOnly bool
+}
+
+// Volume represents a Docker volume.
+type Volume struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	Mountpoint string            `json:"mountpoint"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Created    time.Time         `json:"created"`
+}
+
+// VolumeListOptions configures volume listing.
+type VolumeListOptions struct {
+	Filters map[string][]string // Filter by name, label, dangling, etc.
+}
+
+// VolumeCreateOptions configures volume creation.
+type VolumeCreateOptions struct {
+	Driver string            // Volume driver (default: "local")
+	Labels map[string]string // Volume labels
+}
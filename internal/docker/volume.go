@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// VolumeList lists volumes with optional filters.
+func (c *dockerClient) VolumeList(ctx context.Context, opts VolumeListOptions) ([]Volume, error) {
+	filterArgs := filters.NewArgs()
+	for key, values := range opts.Filters {
+		for _, value := range values {
+			filterArgs.Add(key, value)
+		}
+	}
+
+	resp, err := c.cli.VolumeList(ctx, volume.ListOptions{Filters: filterArgs})
+	if err != nil {
+		return nil, ErrVolumeList(err)
+	}
+
+	result := make([]Volume, 0, len(resp.Volumes))
+	for _, v := range resp.Volumes {
+		if v != nil {
+			result = append(result, volumeFromDocker(*v))
+		}
+	}
+	return result, nil
+}
+
+// VolumeCreate creates a volume. Creating an existing volume returns it
+// unchanged.
+func (c *dockerClient) VolumeCreate(ctx context.Context, name string, opts VolumeCreateOptions) (*Volume, error) {
+	resp, err := c.cli.VolumeCreate(ctx, volume.CreateOptions{
+		Name:   name,
+		Driver: opts.Driver,
+		Labels: opts.Labels,
+	})
+	if err != nil {
+		return nil, ErrVolumeCreate(name, err)
+	}
+	v := volumeFromDocker(resp)
+	return &v, nil
+}
+
+// VolumeRemove removes a volume. Removing a missing volume is not an
+// error (idempotent).
+func (c *dockerClient) VolumeRemove(ctx context.Context, name string) error {
+	err := c.cli.VolumeRemove(ctx, name, false)
+	if err != nil && !strings.Contains(err.Error(), "no such volume") {
+		return ErrVolumeRemove(name, err)
+	}
+	return nil
+}
+
+// volumeFromDocker converts a Docker volume to our Volume type.
+func volumeFromDocker(v volume.Volume) Volume {
+	result := Volume{
+		Name:       v.Name,
+		Driver:     v.Driver,
+		Mountpoint: v.Mountpoint,
+		Labels:     v.Labels,
+	}
+	if created, err := time.Parse(time.RFC3339, v.CreatedAt); err == nil {
+		result.Created = created
+	}
+	return result
+}
@@ -76,12 +76,20 @@ func (e *SecretError) Unwrap() error {
 // PackError represents pack-related errors
 type PackError struct {
 	Pack    string // pack name
+	File    string // file within the pack, if applicable
+	Line    int    // line within File, if known
 	Message string // description
 	Err     error  // underlying error
 }
 
 func (e *PackError) Error() string {
 	base := fmt.Sprintf("pack error: %s: %s", e.Pack, e.Message)
+	switch {
+	case e.File != "" && e.Line > 0:
+		base = fmt.Sprintf("pack error: %s: %s:%d: %s", e.Pack, e.File, e.Line, e.Message)
+	case e.File != "":
+		base = fmt.Sprintf("pack error: %s: %s: %s", e.Pack, e.File, e.Message)
+	}
 	if e.Err != nil {
 		return fmt.Sprintf("%s: %v", base, e.Err)
 	}
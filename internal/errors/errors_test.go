@@ -178,6 +178,25 @@ func TestPackError(t *testing.T) {
 		}
 	})
 
+	t.Run("Error formats with file and line", func(t *testing.T) {
+		err := &PackError{
+			Pack:    "redis",
+			File:    "meta.yaml",
+			Line:    3,
+			Message: "invalid version",
+		}
+		want := "pack error: redis: meta.yaml:3: invalid version"
+		if got := err.Error(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+
+		err.Line = 0
+		want = "pack error: redis: meta.yaml: invalid version"
+		if got := err.Error(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
 	t.Run("Unwrap returns underlying error", func(t *testing.T) {
 		underlying := errors.New("invalid yaml")
 		err := &PackError{
@@ -0,0 +1,337 @@
+package fleet
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// DefaultRollbackTimeout bounds how long an atomic rollback may take once the
+// operation it undoes has been interrupted.
+const DefaultRollbackTimeout = 2 * time.Minute
+
+// Resource kinds created by a driver.
+const (
+	ResourceContainer = "container"
+	ResourceNetwork   = "network"
+	ResourceVolume    = "volume"
+)
+
+// Resource is a resource created while applying a fleet.
+type Resource struct {
+	Kind    string // ResourceContainer, ResourceNetwork or ResourceVolume
+	Service string // Owning service; empty for shared resources
+	Name    string
+	ID      string
+}
+
+// ServiceDriver performs the per-service steps of bringing a fleet up.
+// Every method must return promptly once ctx is cancelled.
+type ServiceDriver interface {
+	// Start creates and starts a service. It returns the resources it
+	// created, including those created before a failure.
+	Start(ctx context.Context, svc *config.Service) ([]Resource, error)
+
+	// Ready blocks until the service is ready to serve its dependents.
+	Ready(ctx context.Context, svc *config.Service) error
+
+	// Remove deletes a resource previously returned by Start.
+	Remove(ctx context.Context, res Resource) error
+}
+
+// ApplyOptions configures Apply.
+type ApplyOptions struct {
+	Atomic          bool              // Roll back everything created by this run on failure or interruption
+	RollbackTimeout time.Duration     // Bound on rollback; DefaultRollbackTimeout when zero
+	Dir             string            // Directory job inputs are resolved against (the yar.yaml directory)
+	CompletedJobs   map[string]string // JobKey to the hash of its last successful run, from State.JobHashes
+}
+
+// ApplyResult describes what an Apply run did, including when it failed.
+type ApplyResult struct {
+	Created    []Resource  // Resources created by this run, in creation order
+	Ready      []string    // Services that became ready
+	Pending    []string    // Services never started
+	Jobs       []JobResult // Jobs that succeeded or were skipped, in completion order
+	RolledBack bool        // Created resources were removed again
+}
+
+// Waves groups services into dependency waves. Every service appears after
+// all services it requires, explicitly or through service discovery
+// templates in its env (see Requirements); services within a wave keep
+// their order in yar.yaml. Unknown dependencies and cycles are validation
+// errors.
+func Waves(services []*config.Service) ([][]*config.Service, error) {
+	index := make(map[string]int, len(services))
+	for i, svc := range services {
+		index[svc.Name] = i
+	}
+
+	requires := make(map[string][]string, len(services))
+	remaining := make(map[string]int, len(services))
+	for i, svc := range services {
+		deps, err := Requirements(svc)
+		if err != nil {
+			return nil, serviceFieldError(i, err)
+		}
+		for _, dep := range deps {
+			if _, ok := index[dep]; !ok {
+				return nil, &errors.ValidationError{
+					Field:   fmt.Sprintf("services[%d].requires", i),
+					Value:   dep,
+					Message: fmt.Sprintf("service %q requires unknown service", svc.Name),
+				}
+			}
+		}
+		requires[svc.Name] = deps
+		remaining[svc.Name] = len(deps)
+	}
+
+	var waves [][]*config.Service
+	done := make(map[string]bool, len(services))
+	for len(done) < len(services) {
+		var wave []*config.Service
+		for _, svc := range services {
+			if !done[svc.Name] && remaining[svc.Name] == 0 {
+				wave = append(wave, svc)
+			}
+		}
+		if len(wave) == 0 {
+			var cycle []string
+			for _, svc := range services {
+				if !done[svc.Name] {
+					cycle = append(cycle, svc.Name)
+				}
+			}
+			return nil, &errors.ValidationError{
+				Field:   "services.requires",
+				Value:   strings.Join(cycle, ", "),
+				Message: "dependency cycle",
+			}
+		}
+
+		for _, svc := range wave {
+			done[svc.Name] = true
+		}
+		for _, svc := range services {
+			for _, dep := range requires[svc.Name] {
+				for _, w := range wave {
+					if dep == w.Name {
+						remaining[svc.Name]--
+					}
+				}
+			}
+		}
+		waves = append(waves, wave)
+	}
+	return waves, nil
+}
+
+// Apply brings services up wave by wave. Services in a wave are started
+// concurrently, and the next wave starts only once every service in the
+// current one is ready. A service's before-jobs run once its requirements
+// are ready and before it starts; its after-jobs run once it is ready and
+// before its dependents start. Jobs with run policy onChange are skipped
+// when their hash matches opts.CompletedJobs.
+//
+// When ctx is cancelled no further wave is launched and the returned error
+// wraps ctx.Err(). On failure or interruption, services that are already
+// running are left alone unless opts.Atomic is set, in which case every
+// resource created by this run is removed in reverse order. The rollback
+// runs on a context detached from ctx so that it survives the interrupt.
+func Apply(ctx context.Context, driver ServiceDriver, services []*config.Service, opts ApplyOptions) (*ApplyResult, error) {
+	waves, err := Waves(services)
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := hashJobs(services, opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ApplyResult{}
+	started := make(map[string]bool, len(services))
+	var applyErr error
+	for i, wave := range waves {
+		if ctx.Err() != nil {
+			applyErr = ErrInterrupted(fmt.Sprintf("wave %d", i+1), ctx.Err())
+			break
+		}
+		for _, svc := range wave {
+			started[svc.Name] = true
+		}
+		if err := applyWave(ctx, driver, wave, hashes, opts.CompletedJobs, result); err != nil {
+			if ctx.Err() != nil {
+				err = ErrInterrupted(fmt.Sprintf("wave %d", i+1), stderrors.Join(ctx.Err(), err))
+			}
+			applyErr = err
+			break
+		}
+	}
+
+	for _, svc := range services {
+		if !started[svc.Name] {
+			result.Pending = append(result.Pending, svc.Name)
+		}
+	}
+	if applyErr == nil {
+		return result, nil
+	}
+
+	if opts.Atomic {
+		if err := rollback(ctx, driver, result.Created, opts.RollbackTimeout); err != nil {
+			return result, stderrors.Join(applyErr, err)
+		}
+		result.RolledBack = true
+	}
+	return result, applyErr
+}
+
+// applyWave starts every service of a wave, with its jobs, and waits until
+// all are ready. The first failure cancels the rest of the wave, so a
+// crash-looping service does not wait on its siblings, and is returned.
+func applyWave(ctx context.Context, driver ServiceDriver, wave []*config.Service, hashes, completed map[string]string, result *ApplyResult) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var first error
+	fail := func(err error) {
+		mu.Lock()
+		if first == nil {
+			first = err
+			cancel()
+		}
+		mu.Unlock()
+	}
+	record := func(res JobResult) {
+		mu.Lock()
+		result.Jobs = append(result.Jobs, res)
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for _, svc := range wave {
+		wg.Add(1)
+		go func(svc *config.Service) {
+			defer wg.Done()
+			if err := runJobs(ctx, driver, svc, config.JobBefore, hashes, completed, record); err != nil {
+				fail(err)
+				return
+			}
+			created, err := driver.Start(ctx, svc)
+			mu.Lock()
+			result.Created = append(result.Created, created...)
+			mu.Unlock()
+			if err != nil {
+				fail(ErrServiceStart(svc.Name, err))
+				return
+			}
+			if err := driver.Ready(ctx, svc); err != nil {
+				fail(ErrServiceReady(svc.Name, err))
+				return
+			}
+			mu.Lock()
+			result.Ready = append(result.Ready, svc.Name)
+			mu.Unlock()
+			if err := runJobs(ctx, driver, svc, config.JobAfter, hashes, completed, record); err != nil {
+				fail(err)
+			}
+		}(svc)
+	}
+	wg.Wait()
+	return first
+}
+
+// hashJobs hashes every job up front, so a bad input fails Apply before
+// anything starts.
+func hashJobs(services []*config.Service, dir string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	for _, svc := range services {
+		for _, job := range svc.Jobs {
+			hash, err := HashJob(job, dir)
+			if err != nil {
+				return nil, err
+			}
+			hashes[JobKey(svc.Name, job.Name)] = hash
+		}
+	}
+	return hashes, nil
+}
+
+// runJobs runs a service's jobs of one phase in declaration order.
+func runJobs(ctx context.Context, driver ServiceDriver, svc *config.Service, phase string, hashes, completed map[string]string, record func(JobResult)) error {
+	for _, job := range svc.Jobs {
+		if job.Phase() != phase {
+			continue
+		}
+		key := JobKey(svc.Name, job.Name)
+		res := JobResult{Service: svc.Name, Job: job.Name, Hash: hashes[key]}
+		if job.RunPolicy() == config.JobRunOnChange && completed[key] == res.Hash {
+			res.Skipped = true
+			record(res)
+			continue
+		}
+
+		runner, ok := driver.(JobRunner)
+		if !ok {
+			return ErrJob(key, stderrors.New("driver does not support jobs"))
+		}
+		if err := runner.RunJob(ctx, svc, job); err != nil {
+			return err
+		}
+		record(res)
+	}
+	return nil
+}
+
+// rollback removes created resources in reverse creation order. Removal
+// continues past individual failures so as much as possible is cleaned up.
+func rollback(ctx context.Context, driver ServiceDriver, created []Resource, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultRollbackTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(created) - 1; i >= 0; i-- {
+		res := created[i]
+		if err := driver.Remove(ctx, res); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", res.Kind, res.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return ErrRollback(fmt.Sprintf("%d resources", len(errs)), stderrors.Join(errs...))
+	}
+	return nil
+}
+
+// WaitReady polls check every interval until it reports ready, fails, or
+// ctx is done. Drivers use it for readiness probes so that interrupting a
+// stuck wait takes effect within one interval.
+func WaitReady(ctx context.Context, interval time.Duration, check func(context.Context) (bool, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ready, err := check(ctx)
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package fleet
+
+import (
+	"context"
+	stderrors "errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// fakeDriver records driver calls. Each started service creates one
+// container; services listed in block wait in Ready until ctx is done, and
+// those in failReady fail Ready.
+type fakeDriver struct {
+	mu        sync.Mutex
+	started   []string
+	removed   []string
+	failOn    map[string]error
+	failReady map[string]error
+	block     map[string]bool
+	onReady   func(svc string)
+	removeFn  func(ctx context.Context, res Resource) error
+}
+
+func (d *fakeDriver) Start(ctx context.Context, svc *config.Service) ([]Resource, error) {
+	d.mu.Lock()
+	d.started = append(d.started, svc.Name)
+	d.mu.Unlock()
+
+	created := []Resource{{Kind: ResourceContainer, Service: svc.Name, Name: "p-" + svc.Name}}
+	if err := d.failOn[svc.Name]; err != nil {
+		return created, err
+	}
+	return created, nil
+}
+
+func (d *fakeDriver) Ready(ctx context.Context, svc *config.Service) error {
+	if d.onReady != nil {
+		d.onReady(svc.Name)
+	}
+	if d.block[svc.Name] {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return d.failReady[svc.Name]
+}
+
+func (d *fakeDriver) Remove(ctx context.Context, res Resource) error {
+	if d.removeFn != nil {
+		if err := d.removeFn(ctx, res); err != nil {
+			return err
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.removed = append(d.removed, res.Name)
+	return nil
+}
+
+func testServices() []*config.Service {
+	return []*config.Service{
+		{Name: "app", Requires: []string{"db", "cache"}},
+		{Name: "db"},
+		{Name: "cache"},
+		{Name: "worker", Requires: []string{"app"}},
+	}
+}
+
+func waveNames(waves [][]*config.Service) [][]string {
+	var names [][]string
+	for _, wave := range waves {
+		var w []string
+		for _, svc := range wave {
+			w = append(w, svc.Name)
+		}
+		names = append(names, w)
+	}
+	return names
+}
+
+func TestWaves(t *testing.T) {
+	waves, err := Waves(testServices())
+	if err != nil {
+		t.Fatalf("Waves() error = %v", err)
+	}
+	want := [][]string{{"db", "cache"}, {"app"}, {"worker"}}
+	if diff := cmp.Diff(want, waveNames(waves)); diff != "" {
+		t.Errorf("Waves() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWaves_EnvReferences(t *testing.T) {
+	services := []*config.Service{
+		{Name: "app", Env: map[string]string{"DB": `postgres://{{ endpoint "db" }}/app`}},
+		{Name: "db"},
+	}
+	waves, err := Waves(services)
+	if err != nil {
+		t.Fatalf("Waves() error = %v", err)
+	}
+	want := [][]string{{"db"}, {"app"}}
+	if diff := cmp.Diff(want, waveNames(waves)); diff != "" {
+		t.Errorf("Waves() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWaves_Errors(t *testing.T) {
+	tests := map[string]struct {
+		services  []*config.Service
+		wantField string
+	}{
+		"unknown dependency": {
+			services:  []*config.Service{{Name: "a"}, {Name: "b", Requires: []string{"missing"}}},
+			wantField: "services[1].requires",
+		},
+		"cycle": {
+			services: []*config.Service{
+				{Name: "a", Requires: []string{"b"}},
+				{Name: "b", Requires: []string{"a"}},
+				{Name: "c"},
+			},
+			wantField: "services.requires",
+		},
+		"unknown env reference": {
+			services:  []*config.Service{{Name: "a"}, {Name: "b", Env: map[string]string{"HOST": `{{ service "missing" "host" }}`}}},
+			wantField: "services[1].requires",
+		},
+		"env reference cycle": {
+			services: []*config.Service{
+				{Name: "a", Requires: []string{"b"}},
+				{Name: "b", Env: map[string]string{"A": `{{ endpoint "a" }}`}},
+			},
+			wantField: "services.requires",
+		},
+		"invalid env template": {
+			services:  []*config.Service{{Name: "a"}, {Name: "b", Env: map[string]string{"HOST": `{{ service "a" "host" }`}}},
+			wantField: "services[1].env.HOST",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Waves(tc.services)
+			var verr *errors.ValidationError
+			if !stderrors.As(err, &verr) {
+				t.Fatalf("Waves() error = %v, want ValidationError", err)
+			}
+			if verr.Field != tc.wantField {
+				t.Errorf("Field = %q, want %q", verr.Field, tc.wantField)
+			}
+		})
+	}
+}
+
+func TestApply_Success(t *testing.T) {
+	d := &fakeDriver{}
+	result, err := Apply(context.Background(), d, testServices(), ApplyOptions{})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	// Wave order is fixed; order within the first wave is not.
+	if got := d.started[2:]; !cmp.Equal(got, []string{"app", "worker"}) {
+		t.Errorf("started = %v, want app then worker last", d.started)
+	}
+	if len(result.Created) != 4 || len(result.Ready) != 4 || len(result.Pending) != 0 {
+		t.Errorf("result = %+v, want 4 created, 4 ready, none pending", result)
+	}
+	if result.RolledBack {
+		t.Error("RolledBack = true, want false")
+	}
+}
+
+func TestApply_InterruptStopsLaunchingWaves(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Interrupt while "app" waits for readiness.
+	d := &fakeDriver{
+		block: map[string]bool{"app": true},
+		onReady: func(svc string) {
+			if svc == "app" {
+				cancel()
+			}
+		},
+	}
+
+	result, err := Apply(ctx, d, testServices(), ApplyOptions{})
+	if !stderrors.Is(err, context.Canceled) {
+		t.Fatalf("Apply() error = %v, want context.Canceled", err)
+	}
+	var ferr *FleetError
+	if !stderrors.As(err, &ferr) || ferr.Op != "apply" || ferr.Name != "wave 2" {
+		t.Errorf("Apply() error = %v, want apply interrupted in wave 2", err)
+	}
+
+	sort.Strings(result.Ready)
+	if diff := cmp.Diff([]string{"cache", "db"}, result.Ready); diff != "" {
+		t.Errorf("Ready mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"worker"}, result.Pending); diff != "" {
+		t.Errorf("Pending mismatch (-want +got):\n%s", diff)
+	}
+	if len(d.removed) != 0 {
+		t.Errorf("removed = %v, want nothing without --atomic", d.removed)
+	}
+}
+
+func TestApply_FailureCancelsWave(t *testing.T) {
+	crash := stderrors.New("crash-looping")
+	// db never becomes ready; cache fails while db is still waiting.
+	d := &fakeDriver{
+		block:     map[string]bool{"db": true},
+		failReady: map[string]error{"cache": crash},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Apply(context.Background(), d, testServices(), ApplyOptions{})
+		done <- err
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Apply() waited for the sibling that never becomes ready")
+	}
+	var ferr *FleetError
+	if !stderrors.Is(err, crash) || !stderrors.As(err, &ferr) || ferr.Op != "service.ready" || ferr.Name != "cache" {
+		t.Errorf("Apply() error = %v, want service.ready cache", err)
+	}
+}
+
+func TestApply_AtomicRollsBackOnInterrupt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := &fakeDriver{
+		block: map[string]bool{"app": true},
+		onReady: func(svc string) {
+			if svc == "app" {
+				cancel()
+			}
+		},
+		// Rollback must not see the cancelled context.
+		removeFn: func(ctx context.Context, res Resource) error {
+			return ctx.Err()
+		},
+	}
+
+	result, err := Apply(ctx, d, testServices(), ApplyOptions{Atomic: true})
+	if !stderrors.Is(err, context.Canceled) {
+		t.Fatalf("Apply() error = %v, want context.Canceled", err)
+	}
+	if !result.RolledBack {
+		t.Error("RolledBack = false, want true")
+	}
+
+	// Removal is the reverse of creation.
+	var want []string
+	for i := len(result.Created) - 1; i >= 0; i-- {
+		want = append(want, result.Created[i].Name)
+	}
+	if diff := cmp.Diff(want, d.removed); diff != "" {
+		t.Errorf("removed mismatch (-want +got):\n%s", diff)
+	}
+	if len(d.removed) != 3 {
+		t.Errorf("removed %d resources, want 3", len(d.removed))
+	}
+}
+
+func TestApply_AtomicRollsBackOnFailure(t *testing.T) {
+	boom := stderrors.New("boom")
+	d := &fakeDriver{failOn: map[string]error{"app": boom}}
+
+	result, err := Apply(context.Background(), d, testServices(), ApplyOptions{Atomic: true})
+	if !stderrors.Is(err, boom) {
+		t.Fatalf("Apply() error = %v, want boom", err)
+	}
+	var ferr *FleetError
+	if !stderrors.As(err, &ferr) || ferr.Op != "service.start" || ferr.Name != "app" {
+		t.Errorf("Apply() error = %v, want service.start app", err)
+	}
+	// The partially created app container is rolled back too.
+	if !result.RolledBack || len(d.removed) != 3 {
+		t.Errorf("RolledBack = %v, removed = %v, want 3 resources removed", result.RolledBack, d.removed)
+	}
+}
+
+func TestApply_RollbackErrors(t *testing.T) {
+	boom := stderrors.New("boom")
+	stuck := stderrors.New("in use")
+	d := &fakeDriver{
+		failOn: map[string]error{"app": boom},
+		removeFn: func(ctx context.Context, res Resource) error {
+			if res.Service == "db" {
+				return stuck
+			}
+			return nil
+		},
+	}
+
+	result, err := Apply(context.Background(), d, testServices(), ApplyOptions{Atomic: true})
+	if !stderrors.Is(err, boom) || !stderrors.Is(err, stuck) {
+		t.Fatalf("Apply() error = %v, want both apply and rollback errors", err)
+	}
+	if result.RolledBack {
+		t.Error("RolledBack = true, want false when removal failed")
+	}
+	if len(d.removed) != 2 {
+		t.Errorf("removed = %v, want the two removable resources", d.removed)
+	}
+}
+
+func TestApply_CancelledBeforeStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	d := &fakeDriver{}
+	result, err := Apply(ctx, d, testServices(), ApplyOptions{Atomic: true})
+	if !stderrors.Is(err, context.Canceled) {
+		t.Fatalf("Apply() error = %v, want context.Canceled", err)
+	}
+	if len(d.started) != 0 || len(result.Pending) != 4 {
+		t.Errorf("started = %v, pending = %v, want nothing started", d.started, result.Pending)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	t.Run("ready after polls", func(t *testing.T) {
+		calls := 0
+		err := WaitReady(context.Background(), time.Millisecond, func(context.Context) (bool, error) {
+			calls++
+			return calls == 3, nil
+		})
+		if err != nil || calls != 3 {
+			t.Errorf("WaitReady() = %v after %d calls, want nil after 3", err, calls)
+		}
+	})
+
+	t.Run("check error", func(t *testing.T) {
+		boom := stderrors.New("boom")
+		err := WaitReady(context.Background(), time.Millisecond, func(context.Context) (bool, error) {
+			return false, boom
+		})
+		if !stderrors.Is(err, boom) {
+			t.Errorf("WaitReady() = %v, want boom", err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		err := WaitReady(ctx, time.Hour, func(context.Context) (bool, error) {
+			return false, nil
+		})
+		if !stderrors.Is(err, context.Canceled) {
+			t.Errorf("WaitReady() = %v, want context.Canceled", err)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package fleet
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/yar-run/yar/internal/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	sigyaml "sigs.k8s.io/yaml"
+)
+
+// HelmChart is the Helm chart of a service: the objects its pack runs as
+// (see ServiceManifests), with the charts of the services of its pack
+// dependencies as subcharts.
+type HelmChart struct {
+	Name        string // the service's name, or the dependency's name for subcharts
+	Version     string // the pack's version
+	Description string
+	Objects     []*unstructured.Unstructured
+	Subcharts   []*HelmChart
+}
+
+// Values returns the chart's values: the replica count and container
+// images of its workload, and the values of each subchart under the
+// subchart's name, which Helm passes through to it.
+func (c *HelmChart) Values() map[string]any {
+	values := map[string]any{}
+	for _, obj := range c.Objects {
+		if !isRolloutKind(obj.GroupVersionKind()) {
+			continue
+		}
+		values["replicaCount"] = specReplicas(obj)
+		images := map[string]any{}
+		containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+		for _, ctr := range containers {
+			if m, ok := ctr.(map[string]any); ok {
+				images[fmt.Sprint(m["name"])] = m["image"]
+			}
+		}
+		values["images"] = images
+	}
+	for _, sub := range c.Subcharts {
+		values[sub.Name] = sub.Values()
+	}
+	return values
+}
+
+// Files returns the files of the chart by slash-separated path relative
+// to its directory: Chart.yaml, values.yaml, a template per object kind
+// and the subcharts under charts/<name>/. The workload's replica count
+// and images are read from values; other text that looks like a template
+// action is escaped.
+func (c *HelmChart) Files() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	chart, err := sigyaml.Marshal(map[string]any{
+		"apiVersion":  "v2",
+		"name":        c.Name,
+		"description": c.Description,
+		"type":        "application",
+		"version":     c.Version,
+	})
+	if err != nil {
+		return nil, err
+	}
+	files["Chart.yaml"] = chart
+	values, err := sigyaml.Marshal(c.Values())
+	if err != nil {
+		return nil, err
+	}
+	files["values.yaml"] = values
+
+	byKind := map[string][]*unstructured.Unstructured{}
+	var kinds []string
+	for _, obj := range c.Objects {
+		kind := strings.ToLower(obj.GetKind())
+		if _, ok := byKind[kind]; !ok {
+			kinds = append(kinds, kind)
+		}
+		byKind[kind] = append(byKind[kind], obj)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		tmpl, err := chartTemplate(byKind[kind])
+		if err != nil {
+			return nil, err
+		}
+		files["templates/"+kind+".yaml"] = tmpl
+	}
+
+	for _, sub := range c.Subcharts {
+		subFiles, err := sub.Files()
+		if err != nil {
+			return nil, err
+		}
+		for name, data := range subFiles {
+			files[path.Join("charts", sub.Name, name)] = data
+		}
+	}
+	return files, nil
+}
+
+// chartTemplate returns the Helm template of objs.
+func chartTemplate(objs []*unstructured.Unstructured) ([]byte, error) {
+	var actions []string
+	placeholder := func(action string) string {
+		actions = append(actions, action)
+		return fmt.Sprintf("yarvalue%dyar", len(actions)-1)
+	}
+
+	templated := make([]*unstructured.Unstructured, len(objs))
+	for i, obj := range objs {
+		obj = obj.DeepCopy()
+		if isRolloutKind(obj.GroupVersionKind()) {
+			_ = unstructured.SetNestedField(obj.Object, placeholder("{{ .Values.replicaCount }}"), "spec", "replicas")
+			containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+			for _, ctr := range containers {
+				if m, ok := ctr.(map[string]any); ok {
+					m["image"] = placeholder(fmt.Sprintf("{{ index .Values.images %q | quote }}", m["name"]))
+				}
+			}
+			_ = unstructured.SetNestedSlice(obj.Object, containers, "spec", "template", "spec", "containers")
+		}
+		templated[i] = obj
+	}
+
+	data, err := kubernetes.EncodeManifests(templated)
+	if err != nil {
+		return nil, err
+	}
+	// A raw string keeps the escape valid inside quoted YAML scalars.
+	text := strings.ReplaceAll(string(data), "{{", "{{`{{`}}")
+	for i, action := range actions {
+		text = strings.Replace(text, fmt.Sprintf("yarvalue%dyar", i), action, 1)
+	}
+	return []byte(text), nil
+}
@@ -0,0 +1,93 @@
+package fleet
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	sigyaml "sigs.k8s.io/yaml"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/packs"
+)
+
+func TestHelmChart_Files(t *testing.T) {
+	rendered := func(image string, content string) *packs.Rendered {
+		return &packs.Rendered{Resources: &packs.Resources{Spec: packs.PackSpec{
+			Containers: []packs.Container{{
+				Name:    "main",
+				Image:   image,
+				Volumes: []packs.Volume{{Name: "conf", MountPath: "/etc/app.conf", Content: content}},
+			}},
+			Services: []packs.ServiceSpec{{Name: "svc", Port: 80}},
+		}}}
+	}
+	chart := &HelmChart{
+		Name:    "api",
+		Version: "1.2.0",
+		Objects: ServiceManifests("shop", "prod", &config.Service{Name: "api", Replicas: 2}, rendered("acme/api:1", "greeting = {{ .Name }}\n"), ManifestOptions{}),
+		Subcharts: []*HelmChart{{
+			Name:    "cache",
+			Version: "1.0.0",
+			Objects: ServiceManifests("shop", "prod", &config.Service{Name: "api-cache"}, rendered("redis:7", "maxmemory 64mb\n"), ManifestOptions{}),
+		}},
+	}
+
+	files, err := chart.Files()
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{
+		"Chart.yaml",
+		"charts/cache/Chart.yaml",
+		"charts/cache/templates/configmap.yaml",
+		"charts/cache/templates/deployment.yaml",
+		"charts/cache/templates/service.yaml",
+		"charts/cache/values.yaml",
+		"templates/configmap.yaml",
+		"templates/deployment.yaml",
+		"templates/service.yaml",
+		"values.yaml",
+	}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Fatalf("files mismatch (-want +got):\n%s", diff)
+	}
+
+	var values map[string]any
+	if err := sigyaml.Unmarshal(files["values.yaml"], &values); err != nil {
+		t.Fatal(err)
+	}
+	wantValues := map[string]any{
+		"replicaCount": float64(2),
+		"images":       map[string]any{"main": "acme/api:1"},
+		"cache": map[string]any{
+			"replicaCount": float64(1),
+			"images":       map[string]any{"main": "redis:7"},
+		},
+	}
+	if diff := cmp.Diff(wantValues, values); diff != "" {
+		t.Errorf("values mismatch (-want +got):\n%s", diff)
+	}
+
+	deployment := string(files["templates/deployment.yaml"])
+	for _, action := range []string{"replicas: {{ .Values.replicaCount }}", `image: {{ index .Values.images "main" | quote }}`} {
+		if !strings.Contains(deployment, action) {
+			t.Errorf("deployment template has no %q:\n%s", action, deployment)
+		}
+	}
+
+	var configMap map[string]any
+	if err := sigyaml.Unmarshal(files["templates/configmap.yaml"], &configMap); err != nil {
+		t.Fatal(err)
+	}
+	data := configMap["data"].(map[string]any)
+	if got := data["main-conf"]; got != "greeting = {{`{{`}} .Name }}\n" {
+		t.Errorf("config content = %q, want the template action escaped", got)
+	}
+}
@@ -0,0 +1,346 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/yar-run/yar/internal/docker"
+)
+
+const (
+	// CrashLoopRestarts is the restart count from which a container whose
+	// last run failed counts as crash-looping.
+	CrashLoopRestarts = 3
+
+	// DefaultDiagnosticLogLines is how many log lines are kept for a
+	// failing service.
+	DefaultDiagnosticLogLines = 20
+)
+
+// stateRank orders derived states from best to worst. A service takes the
+// worst state of its containers or pods.
+var stateRank = map[string]int{
+	StateHealthy:      0,
+	StateStarting:     1,
+	StateUnhealthy:    2,
+	StateExited:       3,
+	StateCrashLooping: 4,
+}
+
+// Failing reports whether the service is in a state its last log lines
+// help to explain: crash-looping, unhealthy, or exited with an error.
+func (s ServiceStatus) Failing() bool {
+	switch s.State {
+	case StateCrashLooping, StateUnhealthy:
+		return true
+	case StateExited:
+		return s.ExitCode != 0 || s.OOMKilled
+	}
+	return false
+}
+
+// ServiceFailedError reports a service that crash-looped or exited while
+// the fleet was being brought up, so it can never become ready. Status
+// carries the diagnostics, including the last log lines.
+type ServiceFailedError struct {
+	Status ServiceStatus
+}
+
+// Error implements the error interface.
+func (e *ServiceFailedError) Error() string {
+	s := e.Status
+	var b strings.Builder
+	if s.State == StateCrashLooping {
+		fmt.Fprintf(&b, "%s is crash-looping after %d restarts, last exit code %d", s.Name, s.Restarts, s.ExitCode)
+	} else {
+		fmt.Fprintf(&b, "%s exited with code %d", s.Name, s.ExitCode)
+	}
+	switch {
+	case s.OOMKilled:
+		b.WriteString(" (OOMKilled)")
+	case s.Reason != "":
+		fmt.Fprintf(&b, " (%s)", s.Reason)
+	}
+	return b.String()
+}
+
+// Diagnostics returns the error followed by the service's last log lines.
+func (e *ServiceFailedError) Diagnostics() string {
+	var b strings.Builder
+	b.WriteString(e.Error())
+	b.WriteString("\n")
+	if len(e.Status.Logs) > 0 {
+		fmt.Fprintf(&b, "last %d log lines of %s:\n", len(e.Status.Logs), e.Status.Name)
+		for _, line := range e.Status.Logs {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// ComposeStatus reports the services of a Docker-backed project
+// environment from its labeled containers. The last tail log lines of each
+// failing service are included; none when tail is zero.
+func ComposeStatus(ctx context.Context, client docker.Client, project, env string, tail int) (*FleetStatus, error) {
+	services, worst, err := composeServices(ctx, client, project, env)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &FleetStatus{Environment: env, Healthy: len(services) > 0}
+	for _, s := range services {
+		if s.Failing() {
+			if s.Logs, err = containerLogTail(ctx, client, worst[s.Name], tail); err != nil {
+				return nil, err
+			}
+		}
+		if s.Status != StatusRunning {
+			status.Healthy = false
+		}
+		status.Services = append(status.Services, *s)
+	}
+	return status, nil
+}
+
+// ComposeReady waits until every container of service is healthy, polling
+// every interval. It fails fast with a ServiceFailedError, including the
+// last tail log lines, once a container crash-loops or exits.
+func ComposeReady(ctx context.Context, client docker.Client, project, env, service string, interval time.Duration, tail int) error {
+	return WaitReady(ctx, interval, func(ctx context.Context) (bool, error) {
+		services, worst, err := composeServices(ctx, client, project, env)
+		if err != nil {
+			return false, err
+		}
+		for _, s := range services {
+			if s.Name != service {
+				continue
+			}
+			switch s.State {
+			case StateCrashLooping, StateExited:
+				if s.Logs, err = containerLogTail(ctx, client, worst[s.Name], tail); err != nil {
+					return false, err
+				}
+				return false, &ServiceFailedError{Status: *s}
+			}
+			return s.Ready == s.Replicas, nil
+		}
+		return false, nil
+	})
+}
+
+// composeServices aggregates the labeled containers of a project
+// environment per service, sorted by name. worst maps each service to the
+// container that determined its state.
+func composeServices(ctx context.Context, client docker.Client, project, env string) ([]*ServiceStatus, map[string]docker.Container, error) {
+	sources, err := SelectLogSources(ctx, client, project, env, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byName := make(map[string]*ServiceStatus)
+	worst := make(map[string]docker.Container)
+	var services []*ServiceStatus
+	for _, src := range sources {
+		c := src.Container
+		if c.Labels[LabelJob] != "" {
+			continue // job containers are kept only when they failed, and ErrJob reports that
+		}
+		state := containerState(c)
+
+		s, ok := byName[src.Service]
+		if !ok {
+			s = &ServiceStatus{Name: src.Service, State: state}
+			byName[src.Service] = s
+			services = append(services, s)
+		}
+		s.Replicas++
+		s.Restarts += c.RestartCount
+		if state == StateHealthy {
+			s.Ready++
+		}
+		if _, seen := worst[s.Name]; !seen || stateRank[state] > stateRank[s.State] {
+			worst[s.Name] = c
+			s.State = state
+			s.ExitCode = c.ExitCode
+			s.OOMKilled = c.OOMKilled
+			s.Reason = ""
+			if c.OOMKilled {
+				s.Reason = "OOMKilled"
+			}
+		}
+	}
+
+	for _, s := range services {
+		s.Status = stateStatus(s.State)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services, worst, nil
+}
+
+// containerState derives the state of an inspected container. A container
+// the daemon keeps restarting, or that restarted CrashLoopRestarts times
+// after failing, is crash-looping.
+func containerState(c docker.Container) string {
+	if c.State == "restarting" || (c.RestartCount >= CrashLoopRestarts && c.ExitCode != 0) {
+		return StateCrashLooping
+	}
+	switch c.State {
+	case "exited", "dead":
+		return StateExited
+	case "running":
+		switch c.Health {
+		case "unhealthy":
+			return StateUnhealthy
+		case "starting":
+			return StateStarting
+		}
+		return StateHealthy
+	}
+	return StateStarting
+}
+
+// stateStatus maps a derived state to the coarser service status.
+func stateStatus(state string) string {
+	switch state {
+	case StateHealthy:
+		return StatusRunning
+	case StateStarting:
+		return StatusPending
+	case StateExited:
+		return StatusStopped
+	}
+	return StatusError
+}
+
+// containerLogTail returns the last tail lines of a container's stdout and
+// stderr.
+func containerLogTail(ctx context.Context, client docker.Client, c docker.Container, tail int) ([]string, error) {
+	if tail <= 0 {
+		return nil, nil
+	}
+	rc, err := client.ContainerLogs(ctx, c.ID, docker.LogOptions{Tail: strconv.Itoa(tail)})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	if err := docker.DemuxLogs(rc, c.TTY, &buf, &buf); err != nil {
+		return nil, docker.ErrContainerLogs(c.Name, err)
+	}
+	return logLines(buf.Bytes(), tail), nil
+}
+
+// logLines splits log output into at most the last tail lines, dropping
+// the carriage returns of TTY streams.
+func logLines(data []byte, tail int) []string {
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	if len(lines) > tail {
+		lines = lines[len(lines)-tail:]
+	}
+	return lines
+}
+
+// podDiagnosis is the derived state of a pod and the container that
+// determined it.
+type podDiagnosis struct {
+	pod       string
+	namespace string
+	container string
+	state     string
+	restarts  int
+	exitCode  int
+	oomKilled bool
+	reason    string
+	previous  bool // The failure is logged by the previous container instance
+}
+
+// diagnosePod derives the state of a pod from its container statuses. A
+// container waiting in CrashLoopBackOff, or one that restarted
+// CrashLoopRestarts times after failing and is not ready, is crash-looping.
+func diagnosePod(pod *unstructured.Unstructured) podDiagnosis {
+	diag := podDiagnosis{pod: pod.GetName(), namespace: pod.GetNamespace(), state: StateStarting}
+	if phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase"); phase == "Failed" {
+		diag.state = StateExited
+	}
+
+	statuses, _, _ := unstructured.NestedSlice(pod.Object, "status", "containerStatuses")
+	first := true
+	for _, s := range statuses {
+		cs, _ := s.(map[string]any)
+		c := diagnoseContainer(cs)
+		diag.restarts += c.restarts
+		if first || stateRank[c.state] > stateRank[diag.state] {
+			c.pod, c.namespace, c.restarts = diag.pod, diag.namespace, diag.restarts
+			diag = c
+		}
+		first = false
+	}
+	return diag
+}
+
+// diagnoseContainer derives the state of one entry of a pod's
+// status.containerStatuses.
+func diagnoseContainer(cs map[string]any) podDiagnosis {
+	name, _, _ := unstructured.NestedString(cs, "name")
+	restarts, _, _ := unstructured.NestedInt64(cs, "restartCount")
+	ready, _, _ := unstructured.NestedBool(cs, "ready")
+	diag := podDiagnosis{container: name, restarts: int(restarts), state: StateStarting}
+
+	if last, ok, _ := unstructured.NestedMap(cs, "lastState", "terminated"); ok {
+		code, _, _ := unstructured.NestedInt64(last, "exitCode")
+		reason, _, _ := unstructured.NestedString(last, "reason")
+		diag.exitCode = int(code)
+		diag.oomKilled = reason == "OOMKilled"
+		diag.previous = true
+	}
+
+	if waiting, ok, _ := unstructured.NestedMap(cs, "state", "waiting"); ok {
+		reason, _, _ := unstructured.NestedString(waiting, "reason")
+		switch {
+		case reason == "CrashLoopBackOff":
+			diag.state = StateCrashLooping
+		case failingReasons[reason]:
+			diag.state = StateUnhealthy
+		}
+		if failingReasons[reason] {
+			diag.reason = reason
+		}
+	}
+	if terminated, ok, _ := unstructured.NestedMap(cs, "state", "terminated"); ok {
+		code, _, _ := unstructured.NestedInt64(terminated, "exitCode")
+		reason, _, _ := unstructured.NestedString(terminated, "reason")
+		diag.state = StateExited
+		diag.exitCode = int(code)
+		diag.oomKilled = reason == "OOMKilled"
+		diag.previous = false
+	}
+	if _, ok, _ := unstructured.NestedMap(cs, "state", "running"); ok {
+		diag.state = StateStarting
+		if ready {
+			diag.state = StateHealthy
+		}
+	}
+
+	if diag.state != StateExited && !ready && diag.restarts >= CrashLoopRestarts && diag.exitCode != 0 {
+		diag.state = StateCrashLooping
+	}
+	if diag.reason == "" && diag.oomKilled {
+		diag.reason = "OOMKilled"
+	}
+	return diag
+}
@@ -0,0 +1,285 @@
+package fleet
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/kubernetes/kubetest"
+)
+
+// fakeLogReader returns the same logs for every pod, or streams by
+// pod/container when set, and records calls.
+type fakeLogReader struct {
+	logs    string
+	streams map[string]string
+	err     error
+	calls   []string
+}
+
+func (f *fakeLogReader) PodLogs(ctx context.Context, namespace, pod string, opts kubernetes.PodLogOptions) ([]byte, error) {
+	f.calls = append(f.calls, fmt.Sprintf("%s/%s/%s previous=%t tail=%d", namespace, pod, opts.Container, opts.Previous, opts.TailLines))
+	return []byte(f.logs), f.err
+}
+
+func (f *fakeLogReader) StreamPodLogs(ctx context.Context, namespace, pod string, opts kubernetes.PodLogOptions) (io.ReadCloser, error) {
+	f.calls = append(f.calls, fmt.Sprintf("%s/%s/%s follow=%t since=%d tail=%d", namespace, pod, opts.Container, opts.Follow, opts.SinceSeconds, opts.TailLines))
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.streams != nil {
+		return io.NopCloser(strings.NewReader(f.streams[pod+"/"+opts.Container])), nil
+	}
+	return io.NopCloser(strings.NewReader(f.logs)), nil
+}
+
+// crashLoopContainer returns a container status waiting in
+// CrashLoopBackOff after four failed runs.
+func crashLoopContainer(name string, exitCode int64, reason string) map[string]any {
+	return map[string]any{
+		"name":         name,
+		"restartCount": int64(4),
+		"state":        map[string]any{"waiting": map[string]any{"reason": "CrashLoopBackOff"}},
+		"lastState":    map[string]any{"terminated": map[string]any{"exitCode": exitCode, "reason": reason}},
+	}
+}
+
+func TestContainerState(t *testing.T) {
+	tests := map[string]struct {
+		c    docker.Container
+		want string
+	}{
+		"created":             {c: docker.Container{State: "created"}, want: StateStarting},
+		"running":             {c: docker.Container{State: "running"}, want: StateHealthy},
+		"health starting":     {c: docker.Container{State: "running", Health: "starting"}, want: StateStarting},
+		"unhealthy":           {c: docker.Container{State: "running", Health: "unhealthy"}, want: StateUnhealthy},
+		"exited":              {c: docker.Container{State: "exited", ExitCode: 1}, want: StateExited},
+		"restarting":          {c: docker.Container{State: "restarting"}, want: StateCrashLooping},
+		"repeated failures":   {c: docker.Container{State: "exited", RestartCount: 3, ExitCode: 1}, want: StateCrashLooping},
+		"restarted, exited 0": {c: docker.Container{State: "running", RestartCount: 5}, want: StateHealthy},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := containerState(tc.c); got != tc.want {
+				t.Errorf("containerState() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func newStatusMock(t *testing.T) *docker.MockClient {
+	t.Helper()
+	jobLabels := Labels("ai-agents", "local", "redis")
+	jobLabels[LabelJob] = "seed" // a failed job container, not a replica
+	mock := docker.NewMockClient()
+	mock.ContainerListResult = []docker.Container{
+		{ID: "c-app-1", Name: "ai-agents-app-1", Labels: Labels("ai-agents", "local", "app")},
+		{ID: "c-app-2", Name: "ai-agents-app-2", Labels: Labels("ai-agents", "local", "app")},
+		{ID: "c-redis", Name: "ai-agents-redis", Labels: Labels("ai-agents", "local", "redis")},
+		{ID: "c-redis-seed", Name: "ai-agents-redis-job-seed", Labels: jobLabels},
+	}
+	mock.ContainerInspectResults = map[string]*docker.Container{
+		"c-app-1":      {ID: "c-app-1", Name: "ai-agents-app-1", State: "running"},
+		"c-app-2":      {ID: "c-app-2", Name: "ai-agents-app-2", State: "restarting", RestartCount: 6, ExitCode: 137, OOMKilled: true},
+		"c-redis":      {ID: "c-redis", Name: "ai-agents-redis", State: "running", Health: "healthy", RestartCount: 1},
+		"c-redis-seed": {ID: "c-redis-seed", Name: "ai-agents-redis-job-seed", State: "exited", ExitCode: 1, Labels: jobLabels},
+	}
+	mock.ContainerLogsResults = map[string]string{
+		"c-app-2": muxed(t, "line 1\nline 2\nline 3\n", "killed\n"),
+	}
+	return mock
+}
+
+func TestComposeStatus(t *testing.T) {
+	mock := newStatusMock(t)
+
+	got, err := ComposeStatus(context.Background(), mock, "ai-agents", "local", 3)
+	if err != nil {
+		t.Fatalf("ComposeStatus() error = %v", err)
+	}
+
+	want := &FleetStatus{
+		Environment: "local",
+		Services: []ServiceStatus{
+			{
+				Name: "app", Status: StatusError, State: StateCrashLooping, Replicas: 2, Ready: 1,
+				Restarts: 6, ExitCode: 137, OOMKilled: true, Reason: "OOMKilled",
+				Logs: []string{"line 2", "line 3", "killed"},
+			},
+			{Name: "redis", Status: StatusRunning, State: StateHealthy, Replicas: 1, Ready: 1, Restarts: 1},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ComposeStatus() mismatch (-want +got):\n%s", diff)
+	}
+
+	// Logs are read only for the failing container.
+	if len(mock.ContainerLogsCalls) != 1 || mock.ContainerLogsCalls[0].ID != "c-app-2" || mock.ContainerLogsCalls[0].Opts.Tail != "3" {
+		t.Errorf("ContainerLogs calls = %+v, want one for c-app-2 with tail 3", mock.ContainerLogsCalls)
+	}
+}
+
+func TestComposeReady(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	mock := newStatusMock(t)
+
+	if err := ComposeReady(ctx, mock, "ai-agents", "local", "redis", time.Millisecond, 3); err != nil {
+		t.Errorf("ComposeReady(redis) error = %v", err)
+	}
+
+	// A crash loop fails on the first check instead of waiting for ctx.
+	err := ComposeReady(ctx, mock, "ai-agents", "local", "app", time.Millisecond, 3)
+	var failed *ServiceFailedError
+	if !stderrors.As(err, &failed) {
+		t.Fatalf("ComposeReady(app) error = %v, want ServiceFailedError", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("ComposeReady(app) waited for the deadline")
+	}
+	want := "app is crash-looping after 6 restarts, last exit code 137 (OOMKilled)\n" +
+		"last 3 log lines of app:\n  line 2\n  line 3\n  killed\n"
+	if diff := cmp.Diff(want, failed.Diagnostics()); diff != "" {
+		t.Errorf("Diagnostics() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestServiceFailedError(t *testing.T) {
+	tests := map[string]struct {
+		status ServiceStatus
+		want   string
+	}{
+		"crash loop": {
+			status: ServiceStatus{Name: "api", State: StateCrashLooping, Restarts: 4, ExitCode: 1, Reason: "CrashLoopBackOff"},
+			want:   "api is crash-looping after 4 restarts, last exit code 1 (CrashLoopBackOff)",
+		},
+		"exited": {
+			status: ServiceStatus{Name: "api", State: StateExited, ExitCode: 2},
+			want:   "api exited with code 2",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := &ServiceFailedError{Status: tc.status}
+			if got := err.Error(); got != tc.want {
+				t.Errorf("Error() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiagnosePod(t *testing.T) {
+	pod := func(phase string, statuses ...any) *unstructured.Unstructured {
+		obj := labeled(kubernetes.PodKind, "dev", "api-0", "dev", "api")
+		_ = unstructured.SetNestedField(obj.Object, phase, "status", "phase")
+		_ = unstructured.SetNestedSlice(obj.Object, statuses, "status", "containerStatuses")
+		return obj
+	}
+	running := func(name string, ready bool, restarts int64, last map[string]any) map[string]any {
+		cs := map[string]any{
+			"name":         name,
+			"ready":        ready,
+			"restartCount": restarts,
+			"state":        map[string]any{"running": map[string]any{}},
+		}
+		if last != nil {
+			cs["lastState"] = map[string]any{"terminated": last}
+		}
+		return cs
+	}
+
+	tests := map[string]struct {
+		pod  *unstructured.Unstructured
+		want podDiagnosis
+	}{
+		"pending without containers": {
+			pod:  pod("Pending"),
+			want: podDiagnosis{pod: "api-0", namespace: "dev", state: StateStarting},
+		},
+		"ready": {
+			pod:  pod("Running", running("api", true, 0, nil)),
+			want: podDiagnosis{pod: "api-0", namespace: "dev", container: "api", state: StateHealthy},
+		},
+		"crash loop backoff": {
+			pod: pod("Running", running("sidecar", true, 1, nil), crashLoopContainer("api", 1, "Error")),
+			want: podDiagnosis{
+				pod: "api-0", namespace: "dev", container: "api", state: StateCrashLooping,
+				restarts: 5, exitCode: 1, reason: "CrashLoopBackOff", previous: true,
+			},
+		},
+		"running between crashes": {
+			pod: pod("Running", running("api", false, 3, map[string]any{"exitCode": int64(137), "reason": "OOMKilled"})),
+			want: podDiagnosis{
+				pod: "api-0", namespace: "dev", container: "api", state: StateCrashLooping,
+				restarts: 3, exitCode: 137, oomKilled: true, reason: "OOMKilled", previous: true,
+			},
+		},
+		"image pull": {
+			pod: pod("Pending", map[string]any{
+				"name":  "api",
+				"state": map[string]any{"waiting": map[string]any{"reason": "ImagePullBackOff"}},
+			}),
+			want: podDiagnosis{pod: "api-0", namespace: "dev", container: "api", state: StateUnhealthy, reason: "ImagePullBackOff"},
+		},
+		"terminated": {
+			pod: pod("Failed", map[string]any{
+				"name":  "api",
+				"state": map[string]any{"terminated": map[string]any{"exitCode": int64(2), "reason": "Error"}},
+			}),
+			want: podDiagnosis{pod: "api-0", namespace: "dev", container: "api", state: StateExited, exitCode: 2},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := diagnosePod(tc.pod)
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(podDiagnosis{})); diff != "" {
+				t.Errorf("diagnosePod() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestK8sDriver_UpCrashLoopFailsFast(t *testing.T) {
+	ctx := context.Background()
+	crashPod := labeled(kubernetes.PodKind, "dev", "api-5d8f-x2", "dev", "api")
+	_ = unstructured.SetNestedSlice(crashPod.Object, []any{crashLoopContainer("api", 1, "Error")}, "status", "containerStatuses")
+
+	// Without a controller the deployment never becomes available, so only
+	// the crash-loop check can end the wait before the rollout timeout.
+	client, _ := kubetest.NewFakeClient("dev", crashPod)
+	logs := &fakeLogReader{logs: "panic: missing DATABASE_URL\n"}
+	d := newTestK8sDriver(client,
+		WithManifestRenderer(staticManifests(k8sManifests)),
+		WithRolloutTimeout(time.Minute),
+		WithLogReader(logs))
+
+	start := time.Now()
+	err := d.Up(ctx, k8sProject(), "dev", UpOptions{})
+	var failed *ServiceFailedError
+	if !stderrors.As(err, &failed) {
+		t.Fatalf("Up() error = %v, want ServiceFailedError", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Up() took %v, want it to fail fast", elapsed)
+	}
+	want := ServiceStatus{
+		Name: "api", Status: StatusError, State: StateCrashLooping,
+		Restarts: 4, ExitCode: 1, Reason: "CrashLoopBackOff",
+		Logs: []string{"panic: missing DATABASE_URL"},
+	}
+	if diff := cmp.Diff(want, failed.Status); diff != "" {
+		t.Errorf("Status mismatch (-want +got):\n%s", diff)
+	}
+}
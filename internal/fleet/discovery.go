@@ -0,0 +1,331 @@
+package fleet
+
+import (
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// Service discovery fields of the service template function.
+const (
+	FieldHost    = "host"
+	FieldPort    = "port"
+	FieldAddress = "address" // host:port
+)
+
+// Endpoint is where a service can be reached from the services of a
+// fleet.
+type Endpoint struct {
+	Host string
+	Port int // 0 if the service declares no port
+}
+
+// Address returns the endpoint as host:port.
+func (e Endpoint) Address() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// Endpoints maps service names to their endpoints in one environment.
+type Endpoints map[string]Endpoint
+
+// ComposeEndpoints returns the endpoints of services on a compose network:
+// their network aliases (see ServiceHostname) and container ports. project
+// is the name returned by InstanceProject.
+func ComposeEndpoints(project string, services []*config.Service) Endpoints {
+	endpoints := make(Endpoints, len(services))
+	for _, svc := range services {
+		endpoints[svc.Name] = Endpoint{Host: ServiceHostname(project, svc), Port: firstPort(project, svc)}
+	}
+	return endpoints
+}
+
+// K8sEndpoints returns the endpoints of services in a cluster: the FQDN of
+// their Kubernetes Service, <service>.<namespace>.svc.cluster.local, and
+// its port. Services without a namespace of their own run in namespace.
+func K8sEndpoints(project string, services []*config.Service, namespace string) Endpoints {
+	endpoints := make(Endpoints, len(services))
+	for _, svc := range services {
+		ns := svc.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+		if ns == "" {
+			ns = project
+		}
+		endpoints[svc.Name] = Endpoint{Host: svc.Name + "." + ns + ".svc.cluster.local", Port: firstPort(project, svc)}
+	}
+	return endpoints
+}
+
+// ForwardEndpoints returns the endpoints of forwarded services as seen from
+// local containers in a hybrid fleet: the target's in-cluster name, which
+// resolves to the container engine's host (see ContainerHosts), and the
+// forwarded port.
+func ForwardEndpoints(targets []ForwardTarget) Endpoints {
+	endpoints := make(Endpoints, len(targets))
+	for _, t := range targets {
+		if _, ok := endpoints[t.Service]; ok || len(t.Ports) == 0 {
+			continue
+		}
+		endpoints[t.Service] = Endpoint{Host: t.Hostnames()[0], Port: t.Ports[0].Port}
+	}
+	return endpoints
+}
+
+// firstPort returns the first container port svc declares, or 0.
+func firstPort(project string, svc *config.Service) int {
+	if ports := ServicePorts(project, svc); len(ports) > 0 {
+		return ports[0].Container
+	}
+	return 0
+}
+
+// EnvReferences returns the services that the env values of svc and its
+// jobs reference with the service or endpoint template functions, sorted.
+// A value that does not parse as a template is a validation error.
+func EnvReferences(svc *config.Service) ([]string, error) {
+	seen := make(map[string]bool)
+	collect := func(field string, env map[string]string) error {
+		for key, value := range env {
+			if !strings.Contains(value, "{{") {
+				continue
+			}
+			tmpl, err := parseEnv(key, value, nil)
+			if err != nil {
+				return &errors.ValidationError{
+					Field:   field + "." + key,
+					Value:   value,
+					Message: fmt.Sprintf("service %q: invalid template: %v", svc.Name, err),
+				}
+			}
+			walkReferences(tmpl.Root, seen)
+		}
+		return nil
+	}
+	if err := collect("env", svc.Env); err != nil {
+		return nil, err
+	}
+	for _, job := range svc.Jobs {
+		if err := collect("jobs."+job.Name+".env", job.Env); err != nil {
+			return nil, err
+		}
+	}
+
+	refs := make([]string, 0, len(seen))
+	for name := range seen {
+		refs = append(refs, name)
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// Requirements returns the services svc depends on: its requires, then
+// the services its env values reference that it does not already require.
+// A service referencing itself does not depend on itself.
+func Requirements(svc *config.Service) ([]string, error) {
+	refs, err := EnvReferences(svc)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return svc.Requires, nil
+	}
+	deps := append([]string(nil), svc.Requires...)
+	for _, ref := range refs {
+		if ref != svc.Name && !contains(deps, ref) {
+			deps = append(deps, ref)
+		}
+	}
+	return deps, nil
+}
+
+// ResolveEnv returns copies of services whose env values, and those of
+// their jobs, have the service and endpoint template functions replaced
+// with endpoints. Values without templates are copied unchanged.
+// References to other services in services become explicit requires of the
+// copies, so dependency order survives resolution; references to services
+// outside it, such as forwarded ones, do not.
+func ResolveEnv(services []*config.Service, endpoints Endpoints) ([]*config.Service, error) {
+	names := make(map[string]bool, len(services))
+	for _, svc := range services {
+		names[svc.Name] = true
+	}
+	resolved := make([]*config.Service, len(services))
+	for i, svc := range services {
+		refs, err := EnvReferences(svc)
+		if err != nil {
+			return nil, serviceFieldError(i, err)
+		}
+		copied := *svc
+		for _, ref := range refs {
+			if names[ref] && ref != svc.Name && !contains(copied.Requires, ref) {
+				copied.Requires = append(copied.Requires[:len(copied.Requires):len(copied.Requires)], ref)
+			}
+		}
+		if copied.Env, err = resolveEnv(svc.Name, svc.Env, endpoints); err != nil {
+			return nil, err
+		}
+		if len(svc.Jobs) > 0 {
+			copied.Jobs = make([]*config.Job, len(svc.Jobs))
+			for j, job := range svc.Jobs {
+				copiedJob := *job
+				if copiedJob.Env, err = resolveEnv(svc.Name+"/"+job.Name, job.Env, endpoints); err != nil {
+					return nil, err
+				}
+				copied.Jobs[j] = &copiedJob
+			}
+		}
+		resolved[i] = &copied
+	}
+	return resolved, nil
+}
+
+// serviceFieldError prefixes the field of a validation error about the
+// service at index i of yar.yaml with its path.
+func serviceFieldError(i int, err error) error {
+	var verr *errors.ValidationError
+	if stderrors.As(err, &verr) {
+		verr.Field = fmt.Sprintf("services[%d].%s", i, verr.Field)
+	}
+	return err
+}
+
+// resolveEnv executes the templates of env for owner.
+func resolveEnv(owner string, env map[string]string, endpoints Endpoints) (map[string]string, error) {
+	if env == nil {
+		return nil, nil
+	}
+	resolved := make(map[string]string, len(env))
+	for key, value := range env {
+		if !strings.Contains(value, "{{") {
+			resolved[key] = value
+			continue
+		}
+		tmpl, err := parseEnv(key, value, endpoints)
+		if err != nil {
+			return nil, ErrEnv(owner, key, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			return nil, ErrEnv(owner, key, unwrapExecError(err))
+		}
+		resolved[key] = buf.String()
+	}
+	return resolved, nil
+}
+
+// parseEnv parses an env value as a template with the service discovery
+// functions bound to endpoints.
+func parseEnv(key, value string, endpoints Endpoints) (*template.Template, error) {
+	lookup := func(name string) (Endpoint, error) {
+		e, ok := endpoints[name]
+		if !ok {
+			return Endpoint{}, fmt.Errorf("unknown service %q", name)
+		}
+		return e, nil
+	}
+	port := func(name string, e Endpoint) (string, error) {
+		if e.Port == 0 {
+			return "", fmt.Errorf("service %q declares no port", name)
+		}
+		return strconv.Itoa(e.Port), nil
+	}
+	funcs := template.FuncMap{
+		"service": func(name, field string) (string, error) {
+			e, err := lookup(name)
+			if err != nil {
+				return "", err
+			}
+			switch field {
+			case FieldHost:
+				return e.Host, nil
+			case FieldPort:
+				return port(name, e)
+			case FieldAddress:
+				if _, err := port(name, e); err != nil {
+					return "", err
+				}
+				return e.Address(), nil
+			}
+			return "", fmt.Errorf("unknown field %q; use host, port or address", field)
+		},
+		"endpoint": func(name string) (string, error) {
+			e, err := lookup(name)
+			if err != nil {
+				return "", err
+			}
+			if _, err := port(name, e); err != nil {
+				return "", err
+			}
+			return e.Address(), nil
+		},
+	}
+	return template.New(key).Funcs(funcs).Option("missingkey=error").Parse(value)
+}
+
+// walkReferences adds the service names passed as literals to service and
+// endpoint calls under node to seen.
+func walkReferences(node parse.Node, seen map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkReferences(child, seen)
+		}
+	case *parse.ActionNode:
+		walkReferences(n.Pipe, seen)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkReferences(cmd, seen)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) >= 2 {
+			if fn, ok := n.Args[0].(*parse.IdentifierNode); ok && (fn.Ident == "service" || fn.Ident == "endpoint") {
+				if name, ok := n.Args[1].(*parse.StringNode); ok {
+					seen[name.Text] = true
+				}
+			}
+		}
+		for _, arg := range n.Args {
+			walkReferences(arg, seen)
+		}
+	case *parse.IfNode:
+		walkReferences(n.Pipe, seen)
+		walkReferences(n.List, seen)
+		walkReferences(n.ElseList, seen)
+	case *parse.RangeNode:
+		walkReferences(n.Pipe, seen)
+		walkReferences(n.List, seen)
+		walkReferences(n.ElseList, seen)
+	case *parse.WithNode:
+		walkReferences(n.Pipe, seen)
+		walkReferences(n.List, seen)
+		walkReferences(n.ElseList, seen)
+	}
+}
+
+// unwrapExecError returns the error a template function returned, without
+// the template name and position text/template wraps it in.
+func unwrapExecError(err error) error {
+	for {
+		inner := stderrors.Unwrap(err)
+		if inner == nil {
+			return err
+		}
+		err = inner
+	}
+}
@@ -0,0 +1,214 @@
+package fleet
+
+import (
+	stderrors "errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+func discoveryServices() []*config.Service {
+	return []*config.Service{
+		{Name: "redis", Params: map[string]any{"ports": []any{map[string]any{"containerPort": 6379, "hostPort": 6379}}}},
+		{Name: "postgres", Namespace: "data", Params: map[string]any{"port": 5432}},
+		{Name: "worker"},
+		{
+			Name:     "app",
+			Requires: []string{"redis"},
+			Env: map[string]string{
+				"REDIS_URL": `redis://{{ endpoint "redis" }}/0`,
+				"PG_HOST":   `{{ service "postgres" "host" }}`,
+				"PG_PORT":   `{{ service "postgres" "port" }}`,
+				"LOG_LEVEL": "debug",
+			},
+			Jobs: []*config.Job{{Name: "migrate", Env: map[string]string{"DB": `{{ service "postgres" "address" }}`}}},
+		},
+	}
+}
+
+func TestEnvReferences(t *testing.T) {
+	services := discoveryServices()
+	refs, err := EnvReferences(services[3])
+	if err != nil {
+		t.Fatalf("EnvReferences() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"postgres", "redis"}, refs); diff != "" {
+		t.Errorf("EnvReferences() mismatch (-want +got):\n%s", diff)
+	}
+
+	// References inside conditionals and pipelines are found too.
+	svc := &config.Service{Name: "a", Env: map[string]string{
+		"X": `{{ if true }}{{ service "b" "host" | printf "%s" }}{{ else }}{{ endpoint "c" }}{{ end }}`,
+	}}
+	if refs, err = EnvReferences(svc); err != nil {
+		t.Fatalf("EnvReferences() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"b", "c"}, refs); diff != "" {
+		t.Errorf("EnvReferences() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEnvReferences_InvalidTemplate(t *testing.T) {
+	svc := &config.Service{Name: "app", Jobs: []*config.Job{{Name: "seed", Env: map[string]string{"X": "{{ service "}}}}
+	_, err := EnvReferences(svc)
+	var verr *errors.ValidationError
+	if !stderrors.As(err, &verr) {
+		t.Fatalf("EnvReferences() error = %v, want ValidationError", err)
+	}
+	if verr.Field != "jobs.seed.env.X" {
+		t.Errorf("Field = %q, want jobs.seed.env.X", verr.Field)
+	}
+}
+
+func TestRequirements(t *testing.T) {
+	services := discoveryServices()
+	deps, err := Requirements(services[3])
+	if err != nil {
+		t.Fatalf("Requirements() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"redis", "postgres"}, deps); diff != "" {
+		t.Errorf("Requirements() mismatch (-want +got):\n%s", diff)
+	}
+	if services[3].Requires[0] != "redis" || len(services[3].Requires) != 1 {
+		t.Errorf("Requirements() modified Requires: %v", services[3].Requires)
+	}
+
+	self := &config.Service{Name: "a", Env: map[string]string{"SELF": `{{ service "a" "host" }}`}}
+	if deps, _ := Requirements(self); len(deps) != 0 {
+		t.Errorf("Requirements(self reference) = %v, want none", deps)
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	services := discoveryServices()
+	tests := map[string]struct {
+		got  Endpoints
+		want Endpoints
+	}{
+		"compose": {
+			got: ComposeEndpoints("shop", services),
+			want: Endpoints{
+				"redis":    {Host: "redis.shop", Port: 6379},
+				"postgres": {Host: "postgres.data", Port: 5432},
+				"worker":   {Host: "worker.shop"},
+				"app":      {Host: "app.shop"},
+			},
+		},
+		"compose instance": {
+			got: ComposeEndpoints(InstanceProject("shop", "feat"), services[:1]),
+			want: Endpoints{
+				"redis": {Host: "redis.feat.shop", Port: 6379},
+			},
+		},
+		"k8s": {
+			got: K8sEndpoints("shop", services, "apps"),
+			want: Endpoints{
+				"redis":    {Host: "redis.apps.svc.cluster.local", Port: 6379},
+				"postgres": {Host: "postgres.data.svc.cluster.local", Port: 5432},
+				"worker":   {Host: "worker.apps.svc.cluster.local"},
+				"app":      {Host: "app.apps.svc.cluster.local"},
+			},
+		},
+		"k8s project namespace": {
+			got: K8sEndpoints("shop", services[:1], ""),
+			want: Endpoints{
+				"redis": {Host: "redis.shop.svc.cluster.local", Port: 6379},
+			},
+		},
+		"forward": {
+			got: ForwardEndpoints([]ForwardTarget{
+				{Service: "redis", Name: "redis", Namespace: "shop-redis", Ports: []ForwardPort{{Port: 6379, TargetPort: 6379}}},
+				{Service: "redis", Name: "redis-replica", Namespace: "shop-redis", Ports: []ForwardPort{{Port: 6380}}},
+				{Service: "worker", Name: "worker", Namespace: "shop"},
+			}),
+			want: Endpoints{
+				"redis": {Host: "redis.shop-redis", Port: 6379},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.got); diff != "" {
+				t.Errorf("endpoints mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	services := discoveryServices()
+	resolved, err := ResolveEnv(services, K8sEndpoints("shop", services, "apps"))
+	if err != nil {
+		t.Fatalf("ResolveEnv() error = %v", err)
+	}
+
+	app := resolved[3]
+	wantEnv := map[string]string{
+		"REDIS_URL": "redis://redis.apps.svc.cluster.local:6379/0",
+		"PG_HOST":   "postgres.data.svc.cluster.local",
+		"PG_PORT":   "5432",
+		"LOG_LEVEL": "debug",
+	}
+	if diff := cmp.Diff(wantEnv, app.Env); diff != "" {
+		t.Errorf("Env mismatch (-want +got):\n%s", diff)
+	}
+	if got := app.Jobs[0].Env["DB"]; got != "postgres.data.svc.cluster.local:5432" {
+		t.Errorf("job Env[DB] = %q", got)
+	}
+	if diff := cmp.Diff([]string{"redis", "postgres"}, app.Requires); diff != "" {
+		t.Errorf("Requires mismatch (-want +got):\n%s", diff)
+	}
+
+	// The input services keep their templates.
+	if diff := cmp.Diff(discoveryServices(), services); diff != "" {
+		t.Errorf("ResolveEnv() modified services (-want +got):\n%s", diff)
+	}
+
+	// References to services outside the resolved set, such as forwarded
+	// ones, do not become requires.
+	resolved, err = ResolveEnv(services[3:], Endpoints{
+		"redis":    {Host: "redis.shop-redis", Port: 6379},
+		"postgres": {Host: "postgres.data", Port: 5432},
+	})
+	if err != nil {
+		t.Fatalf("ResolveEnv(local) error = %v", err)
+	}
+	if got := resolved[0].Env["REDIS_URL"]; got != "redis://redis.shop-redis:6379/0" {
+		t.Errorf("Env[REDIS_URL] = %q", got)
+	}
+	if diff := cmp.Diff([]string{"redis"}, resolved[0].Requires); diff != "" {
+		t.Errorf("Requires mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestResolveEnv_Errors(t *testing.T) {
+	endpoints := Endpoints{"redis": {Host: "redis.shop", Port: 6379}, "worker": {Host: "worker.shop"}}
+	tests := map[string]struct {
+		value   string
+		wantErr string
+	}{
+		"unknown service": {`{{ service "nope" "host" }}`, `unknown service "nope"`},
+		"unknown field":   {`{{ service "redis" "ip" }}`, `unknown field "ip"`},
+		"no port":         {`{{ endpoint "worker" }}`, `service "worker" declares no port`},
+		"no port field":   {`{{ service "worker" "port" }}`, `service "worker" declares no port`},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			services := []*config.Service{{Name: "app", Env: map[string]string{"X": tc.value}}}
+			_, err := ResolveEnv(services, endpoints)
+			var ferr *FleetError
+			if !stderrors.As(err, &ferr) || ferr.Op != "env" || ferr.Name != "app X" {
+				t.Fatalf("ResolveEnv() error = %v, want env FleetError for app X", err)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) || strings.Contains(err.Error(), "executing") {
+				t.Errorf("ResolveEnv() error = %v, want %q without template position", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,572 @@
+package fleet
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+)
+
+const (
+	// LabelConfigHash records the HashConfig of the ContainerSpec a
+	// container was created from, so an unchanged container is kept.
+	LabelConfigHash = "yar.config-hash"
+
+	// DefaultReadyTimeout bounds how long Ready waits for the containers
+	// of a service to become healthy.
+	DefaultReadyTimeout = 5 * time.Minute
+
+	// defaultReadyPollInterval is how often Ready checks the containers of
+	// a service.
+	defaultReadyPollInterval = time.Second
+)
+
+// ContainerSpec is a container of a service as DockerServiceDriver runs
+// it, rendered from the service's pack for the compose target.
+type ContainerSpec struct {
+	Name       string               // Container name; ContainerName for the main container of a service
+	Image      string               // Image reference
+	Entrypoint []string             // Overrides the image entrypoint when set
+	Cmd        []string             // Overrides the image command when set
+	Env        map[string]string    // Environment variables
+	Ports      []docker.PortBinding // Ports exposed, and published when HostPort is set
+	Volumes    []VolumeMount        // Persistent volumes
+	Files      []ContainerFile      // Written into the container before it starts
+}
+
+// VolumeMount mounts a persistent volume of a service into a container.
+type VolumeMount struct {
+	Name   string // Volume name within the service; see VolumeName
+	Target string // Path inside the container
+}
+
+// ContainerFile is a file written into a container before it starts:
+// inline pack content, a configMap key, or a secret.
+type ContainerFile struct {
+	Path      string
+	Content   string
+	SecretRef string // Resolved through the driver's SecretResolver instead of Content
+}
+
+// SecretResolver resolves the secret references of container files.
+type SecretResolver interface {
+	// Resolve returns the value of a secret reference.
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// ContainerRenderer renders the containers of a service. The first
+// container is the service's main container, which gets its hostnames.
+type ContainerRenderer interface {
+	RenderContainers(ctx context.Context, svc *config.Service) ([]ContainerSpec, error)
+}
+
+// VolumeName returns the Docker volume of a service's persistent volume
+// for project, as returned by InstanceProject.
+func VolumeName(project, service, volume string) string {
+	return ContainerName(project, service) + "-" + volume
+}
+
+// DockerServiceDriver starts the services of a compose environment as
+// labeled containers on the fleet network. It implements ServiceDriver and
+// JobRunner for Apply. Containers whose spec is unchanged are kept;
+// changed ones are replaced.
+type DockerServiceDriver struct {
+	client        docker.Client
+	project       string
+	env           string
+	renderer      ContainerRenderer
+	network       string
+	extraHosts    []string
+	secrets       SecretResolver
+	actions       *action.Log
+	forceRecreate bool
+	pollInterval  time.Duration
+	readyTimeout  time.Duration
+	jobs          *DockerJobRunner
+
+	mu             sync.Mutex
+	networkChecked bool
+	started        map[string]*State // What the last Start of each service runs with
+}
+
+// DockerServiceOption configures a DockerServiceDriver.
+type DockerServiceOption func(*DockerServiceDriver)
+
+// WithContainerRenderer sets the renderer Start uses to produce
+// containers.
+func WithContainerRenderer(r ContainerRenderer) DockerServiceOption {
+	return func(d *DockerServiceDriver) {
+		d.renderer = r
+	}
+}
+
+// WithDockerNetwork attaches containers and job containers to network,
+// which Start creates if it does not exist. Use NetworkName.
+func WithDockerNetwork(network string) DockerServiceOption {
+	return func(d *DockerServiceDriver) {
+		d.network = network
+	}
+}
+
+// WithDockerExtraHosts adds Docker extra-hosts entries (host:ip) to every
+// container.
+func WithDockerExtraHosts(hosts []string) DockerServiceOption {
+	return func(d *DockerServiceDriver) {
+		d.extraHosts = hosts
+	}
+}
+
+// WithDockerSecrets sets the resolver for secret files. Without one,
+// starting a service that references a secret fails.
+func WithDockerSecrets(secrets SecretResolver) DockerServiceOption {
+	return func(d *DockerServiceDriver) {
+		d.secrets = secrets
+	}
+}
+
+// WithDockerActionLog records every change the driver makes in log. In a
+// dry run nothing is sent to the daemon, secrets are not resolved and
+// Ready returns at once.
+func WithDockerActionLog(log *action.Log) DockerServiceOption {
+	return func(d *DockerServiceDriver) {
+		d.actions = log
+	}
+}
+
+// WithDockerForceRecreate replaces containers even if their spec is
+// unchanged.
+func WithDockerForceRecreate() DockerServiceOption {
+	return func(d *DockerServiceDriver) {
+		d.forceRecreate = true
+	}
+}
+
+// WithDockerReadyInterval overrides how often Ready checks containers.
+func WithDockerReadyInterval(interval time.Duration) DockerServiceOption {
+	return func(d *DockerServiceDriver) {
+		d.pollInterval = interval
+	}
+}
+
+// WithDockerReadyTimeout overrides DefaultReadyTimeout.
+func WithDockerReadyTimeout(timeout time.Duration) DockerServiceOption {
+	return func(d *DockerServiceDriver) {
+		d.readyTimeout = timeout
+	}
+}
+
+// NewDockerServiceDriver creates a driver for the compose environment env
+// of project, as returned by InstanceProject.
+func NewDockerServiceDriver(client docker.Client, project, env string, opts ...DockerServiceOption) *DockerServiceDriver {
+	d := &DockerServiceDriver{
+		client:       client,
+		project:      project,
+		env:          env,
+		pollInterval: defaultReadyPollInterval,
+		readyTimeout: DefaultReadyTimeout,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.actions != nil {
+		d.client = docker.NewRecordingClient(d.client, d.actions)
+	}
+	d.jobs = NewDockerJobRunner(d.client, project, env, WithJobNetwork(d.network))
+	return d
+}
+
+// Start implements ServiceDriver. It creates the fleet network on first
+// use and the service's volumes if missing, then creates and starts each
+// container. The network and volumes are returned only if this call
+// created them, so a rollback never removes what an earlier run left.
+func (d *DockerServiceDriver) Start(ctx context.Context, svc *config.Service) ([]Resource, error) {
+	if d.renderer == nil {
+		return nil, NewFleetError("docker.render", svc.Name, "no container renderer configured", nil)
+	}
+	specs, err := d.renderer.RenderContainers(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []Resource
+	res, err := d.ensureNetwork(ctx)
+	if err != nil {
+		return nil, err
+	}
+	created = append(created, res...)
+
+	res, err = d.ensureVolumes(ctx, svc, specs)
+	created = append(created, res...)
+	if err != nil {
+		return created, err
+	}
+
+	started := NewState(d.project, d.env)
+	defer d.recordStarted(svc.Name, started)
+	for i, spec := range specs {
+		var aliases []string
+		if i == 0 {
+			aliases = []string{ServiceHostname(d.project, svc), svc.Name}
+		}
+		hash, err := HashConfig(struct {
+			Spec       ContainerSpec
+			Aliases    []string
+			Network    string
+			ExtraHosts []string
+		}{spec, aliases, d.network, d.extraHosts})
+		if err != nil {
+			return created, err
+		}
+		res, err := d.startContainer(ctx, svc, spec, aliases, hash)
+		created = append(created, res...)
+		if err != nil {
+			return created, err
+		}
+
+		started.AddContainer(ContainerRecord{Service: svc.Name, Name: spec.Name, ConfigHash: hash})
+		for _, p := range spec.Ports {
+			if p.HostPort != 0 {
+				started.AddPort(PortRecord{Service: svc.Name, ContainerPort: p.ContainerPort, HostPort: p.HostPort, Protocol: p.Protocol})
+			}
+		}
+		for _, f := range spec.Files {
+			if f.SecretRef != "" {
+				started.AddSecret(SecretRecord{Service: svc.Name, Name: f.SecretRef, Target: f.Path})
+			}
+		}
+	}
+	return created, nil
+}
+
+// recordStarted keeps what Start started of a service for recordService.
+func (d *DockerServiceDriver) recordStarted(service string, started *State) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.started == nil {
+		d.started = make(map[string]*State)
+	}
+	d.started[service] = started
+}
+
+// recordService implements stateRecorder. The service's ports and secrets
+// replace those recorded before, and its recorded containers get their
+// config hash.
+func (d *DockerServiceDriver) recordService(st *State, service string) {
+	d.mu.Lock()
+	started := d.started[service]
+	d.mu.Unlock()
+	if started == nil {
+		return
+	}
+
+	st.Ports = slices.DeleteFunc(st.Ports, func(p PortRecord) bool { return p.Service == service })
+	st.Ports = append(st.Ports, started.Ports...)
+	st.Secrets = slices.DeleteFunc(st.Secrets, func(sec SecretRecord) bool { return sec.Service == service })
+	st.Secrets = append(st.Secrets, started.Secrets...)
+	for _, c := range started.Containers {
+		for i := range st.Containers {
+			if st.Containers[i].Name == c.Name {
+				st.Containers[i].ConfigHash = c.ConfigHash
+			}
+		}
+	}
+}
+
+// Ready implements ServiceDriver with ComposeReady, giving up after the
+// ready timeout. A dry run started nothing, so there is nothing to wait
+// for.
+func (d *DockerServiceDriver) Ready(ctx context.Context, svc *config.Service) error {
+	if d.actions.DryRun() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.readyTimeout)
+	defer cancel()
+	return ComposeReady(ctx, d.client, d.project, d.env, svc.Name, d.pollInterval, DefaultDiagnosticLogLines)
+}
+
+// Remove implements ServiceDriver.
+func (d *DockerServiceDriver) Remove(ctx context.Context, res Resource) error {
+	switch res.Kind {
+	case ResourceContainer:
+		id := res.ID
+		if id == "" {
+			id = res.Name
+		}
+		return d.client.ContainerRemove(ctx, id)
+	case ResourceNetwork:
+		return d.client.NetworkRemove(ctx, res.Name)
+	case ResourceVolume:
+		return d.client.VolumeRemove(ctx, res.Name)
+	}
+	return fmt.Errorf("unknown resource kind %q", res.Kind)
+}
+
+// RunJob implements JobRunner with a DockerJobRunner on the fleet network.
+func (d *DockerServiceDriver) RunJob(ctx context.Context, svc *config.Service, job *config.Job) error {
+	return d.jobs.RunJob(ctx, svc, job)
+}
+
+// ensureNetwork creates the fleet network the first time it is called, if
+// it does not exist yet.
+func (d *DockerServiceDriver) ensureNetwork(ctx context.Context) ([]Resource, error) {
+	if d.network == "" {
+		return nil, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.networkChecked {
+		return nil, nil
+	}
+
+	networks, err := d.client.NetworkList(ctx, docker.NetworkListOptions{Filters: map[string][]string{"name": {d.network}}})
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range networks {
+		if n.Name == d.network {
+			d.networkChecked = true
+			return nil, nil
+		}
+	}
+	id, err := d.client.NetworkCreate(ctx, d.network, docker.NetworkCreateOptions{Labels: Labels(d.project, d.env, "")})
+	if err != nil {
+		return nil, err
+	}
+	d.networkChecked = true
+	return []Resource{{Kind: ResourceNetwork, Name: d.network, ID: id}}, nil
+}
+
+// ensureVolumes creates the persistent volumes of a service's containers
+// that don't exist yet.
+func (d *DockerServiceDriver) ensureVolumes(ctx context.Context, svc *config.Service, specs []ContainerSpec) ([]Resource, error) {
+	var names []string
+	for _, spec := range specs {
+		for _, v := range spec.Volumes {
+			names = append(names, VolumeName(d.project, svc.Name, v.Name))
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	existing, err := d.client.VolumeList(ctx, docker.VolumeListOptions{Filters: LabelFilters(d.project, d.env)})
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, v := range existing {
+		exists[v.Name] = true
+	}
+
+	var created []Resource
+	for _, name := range names {
+		if exists[name] {
+			continue
+		}
+		if _, err := d.client.VolumeCreate(ctx, name, docker.VolumeCreateOptions{Labels: Labels(d.project, d.env, svc.Name)}); err != nil {
+			return created, err
+		}
+		exists[name] = true
+		created = append(created, Resource{Kind: ResourceVolume, Service: svc.Name, Name: name})
+	}
+	return created, nil
+}
+
+// startContainer creates and starts one container, unless a container of
+// the same name was created from the same spec, as hash identifies it,
+// which is started if it is not running and otherwise left alone.
+func (d *DockerServiceDriver) startContainer(ctx context.Context, svc *config.Service, spec ContainerSpec, aliases []string, hash string) ([]Resource, error) {
+	existing, err := d.client.ContainerInspect(ctx, spec.Name)
+	switch {
+	case err != nil && !docker.IsNotFound(err):
+		return nil, err
+	case err == nil && !d.forceRecreate && existing.Labels[LabelConfigHash] == hash:
+		if existing.State == "running" {
+			return nil, nil
+		}
+		return nil, d.client.ContainerStart(ctx, existing.ID)
+	case err == nil:
+		if err := d.client.ContainerRemove(ctx, existing.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := d.files(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := Labels(d.project, d.env, svc.Name)
+	labels[LabelConfigHash] = hash
+	env := make([]string, 0, len(spec.Env))
+	for k, v := range spec.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	var mounts []docker.Mount
+	for _, v := range spec.Volumes {
+		mounts = append(mounts, docker.Mount{Type: "volume", Source: VolumeName(d.project, svc.Name, v.Name), Target: v.Target})
+	}
+
+	id, err := createContainer(ctx, d.client, docker.ContainerCreateOptions{
+		Name:       spec.Name,
+		Image:      spec.Image,
+		Entrypoint: spec.Entrypoint,
+		Cmd:        spec.Cmd,
+		Env:        env,
+		Labels:     labels,
+		Mounts:     mounts,
+		Ports:      spec.Ports,
+		Network:    d.network,
+		Aliases:    aliases,
+		ExtraHosts: d.extraHosts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	created := []Resource{{Kind: ResourceContainer, Service: svc.Name, Name: spec.Name, ID: id}}
+
+	if files != nil {
+		if err := d.client.CopyToContainer(ctx, id, "/", files); err != nil {
+			return created, err
+		}
+	}
+	return created, d.client.ContainerStart(ctx, id)
+}
+
+// files returns a tar stream of a container's files, with secrets
+// resolved, or nil if it has none. A dry run leaves secrets empty.
+func (d *DockerServiceDriver) files(ctx context.Context, spec ContainerSpec) (*bytes.Buffer, error) {
+	if len(spec.Files) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range spec.Files {
+		content, mode := f.Content, int64(0o644)
+		if f.SecretRef != "" {
+			mode = 0o400
+			if !d.actions.DryRun() {
+				if d.secrets == nil {
+					return nil, fmt.Errorf("secret %s for %s: no secret provider configured", f.SecretRef, f.Path)
+				}
+				value, err := d.secrets.Resolve(ctx, f.SecretRef)
+				if err != nil {
+					return nil, fmt.Errorf("secret %s for %s: %w", f.SecretRef, f.Path, err)
+				}
+				content = value
+			}
+		}
+
+		// The daemon creates missing parent directories on extraction.
+		name := path.Clean("/" + f.Path)[1:]
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: mode, Size: int64(len(content))}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// Ensure DockerServiceDriver implements ServiceDriver and JobRunner.
+var (
+	_ ServiceDriver = (*DockerServiceDriver)(nil)
+	_ JobRunner     = (*DockerServiceDriver)(nil)
+)
+
+// ComposeStop stops the running containers of a compose environment,
+// service by service in reverse dependency order (see Waves). Containers
+// of services no longer in waves go first; job containers are left alone.
+// Stopping goes on past failures, which are returned together.
+func ComposeStop(ctx context.Context, client docker.Client, project, env string, waves [][]*config.Service) error {
+	groups, err := composeContainers(ctx, client, project, env, waves)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := len(groups) - 1; i >= 0; i-- {
+		for _, c := range groups[i] {
+			if c.State != "running" {
+				continue
+			}
+			if err := client.ContainerStop(ctx, c.Name); err != nil {
+				errs = append(errs, fmt.Errorf("stop container %s: %w", c.Name, err))
+			}
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// ComposeRestart stops the containers of a compose environment like
+// ComposeStop, then starts every one of them in dependency order,
+// including those that were stopped already.
+func ComposeRestart(ctx context.Context, client docker.Client, project, env string, waves [][]*config.Service) error {
+	if err := ComposeStop(ctx, client, project, env, waves); err != nil {
+		return err
+	}
+	groups, err := composeContainers(ctx, client, project, env, waves)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		for _, c := range group {
+			if err := client.ContainerStart(ctx, c.Name); err != nil {
+				return fmt.Errorf("start container %s: %w", c.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// composeContainers returns the service containers of a compose
+// environment grouped by service in dependency order, followed by those
+// of services not in waves.
+func composeContainers(ctx context.Context, client docker.Client, project, env string, waves [][]*config.Service) ([][]docker.Container, error) {
+	containers, err := client.ContainerList(ctx, docker.ContainerListOptions{All: true, Filters: LabelFilters(project, env)})
+	if err != nil {
+		return nil, err
+	}
+	byService := make(map[string][]docker.Container)
+	for _, c := range containers {
+		if c.Labels[LabelJob] == "" {
+			byService[c.Labels[LabelService]] = append(byService[c.Labels[LabelService]], c)
+		}
+	}
+	for _, cs := range byService {
+		sort.Slice(cs, func(i, j int) bool { return cs[i].Name < cs[j].Name })
+	}
+
+	var groups [][]docker.Container
+	for _, wave := range waves {
+		for _, svc := range wave {
+			if cs, ok := byService[svc.Name]; ok {
+				groups = append(groups, cs)
+				delete(byService, svc.Name)
+			}
+		}
+	}
+	rest := make([]string, 0, len(byService))
+	for name := range byService {
+		rest = append(rest, name)
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		groups = append(groups, byService[name])
+	}
+	return groups, nil
+}
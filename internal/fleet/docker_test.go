@@ -0,0 +1,356 @@
+package fleet
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+)
+
+// containerRendererFunc adapts a function to ContainerRenderer.
+type containerRendererFunc func(svc *config.Service) ([]ContainerSpec, error)
+
+func (f containerRendererFunc) RenderContainers(ctx context.Context, svc *config.Service) ([]ContainerSpec, error) {
+	return f(svc)
+}
+
+// staticSecrets resolves secrets from a map.
+type staticSecrets map[string]string
+
+func (s staticSecrets) Resolve(ctx context.Context, ref string) (string, error) {
+	if v, ok := s[ref]; ok {
+		return v, nil
+	}
+	return "", stderrors.New("not found")
+}
+
+func postgresSpecs(svc *config.Service) ([]ContainerSpec, error) {
+	return []ContainerSpec{{
+		Name:    ContainerName("ai-agents", svc.Name),
+		Image:   "postgres:16-alpine",
+		Env:     map[string]string{"POSTGRES_PASSWORD_FILE": "/run/secrets/db_password", "PGPORT": "5432"},
+		Ports:   []docker.PortBinding{{ContainerPort: 5432, HostPort: 5432}},
+		Volumes: []VolumeMount{{Name: "data", Target: "/var/lib/postgresql/data"}},
+		Files: []ContainerFile{
+			{Path: "/run/secrets/db_password", SecretRef: "db_password"},
+			{Path: "/etc/postgresql/extra.conf", Content: "max_connections = 50\n"},
+		},
+	}}, nil
+}
+
+func TestDockerServiceDriver_Start(t *testing.T) {
+	ctx := context.Background()
+	svc := &config.Service{Name: "db"}
+	mock := docker.NewMockClient()
+	d := NewDockerServiceDriver(mock, "ai-agents", "local",
+		WithContainerRenderer(containerRendererFunc(postgresSpecs)),
+		WithDockerNetwork("yar-net"),
+		WithDockerExtraHosts([]string{"api.ai-agents:host-gateway"}),
+		WithDockerSecrets(staticSecrets{"db_password": "s3cret"}))
+
+	created, err := d.Start(ctx, svc)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	want := []Resource{
+		{Kind: ResourceNetwork, Name: "yar-net", ID: "mock-network-id-yar-net"},
+		{Kind: ResourceVolume, Service: "db", Name: "ai-agents-db-data"},
+		{Kind: ResourceContainer, Service: "db", Name: "ai-agents-db", ID: "mock-container-1"},
+	}
+	if diff := cmp.Diff(want, created); diff != "" {
+		t.Errorf("Start() resources mismatch (-want +got):\n%s", diff)
+	}
+
+	if len(mock.ContainerCreateCalls) != 1 {
+		t.Fatalf("ContainerCreate calls = %d, want 1", len(mock.ContainerCreateCalls))
+	}
+	opts := mock.ContainerCreateCalls[0]
+	if opts.Labels[LabelConfigHash] == "" || opts.Labels[LabelService] != "db" {
+		t.Errorf("labels = %v, want service and config hash", opts.Labels)
+	}
+	opts.Labels = nil
+	wantOpts := docker.ContainerCreateOptions{
+		Name:       "ai-agents-db",
+		Image:      "postgres:16-alpine",
+		Env:        []string{"PGPORT=5432", "POSTGRES_PASSWORD_FILE=/run/secrets/db_password"},
+		Mounts:     []docker.Mount{{Type: "volume", Source: "ai-agents-db-data", Target: "/var/lib/postgresql/data"}},
+		Ports:      []docker.PortBinding{{ContainerPort: 5432, HostPort: 5432}},
+		Network:    "yar-net",
+		Aliases:    []string{"db.ai-agents", "db"},
+		ExtraHosts: []string{"api.ai-agents:host-gateway"},
+	}
+	if diff := cmp.Diff(wantOpts, opts); diff != "" {
+		t.Errorf("ContainerCreate options mismatch (-want +got):\n%s", diff)
+	}
+
+	if len(mock.CopyToCalls) != 1 {
+		t.Fatalf("CopyToContainer calls = %d, want 1", len(mock.CopyToCalls))
+	}
+	wantFiles := map[string]string{
+		"run/secrets/db_password":   "s3cret",
+		"etc/postgresql/extra.conf": "max_connections = 50\n",
+	}
+	if diff := cmp.Diff(wantFiles, tarFiles(t, mock.CopyToCalls[0].Content)); diff != "" {
+		t.Errorf("copied files mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"mock-container-1"}, mock.ContainerStartCalls); diff != "" {
+		t.Errorf("ContainerStart calls mismatch (-want +got):\n%s", diff)
+	}
+
+	// The network is only checked once per driver.
+	if _, err := d.Start(ctx, &config.Service{Name: "cache"}); err != nil {
+		t.Fatalf("Start(cache) error = %v", err)
+	}
+	if len(mock.NetworkCreateCalls) != 1 || len(mock.NetworkListCalls) != 1 {
+		t.Errorf("network listed %d and created %d times, want once", len(mock.NetworkListCalls), len(mock.NetworkCreateCalls))
+	}
+}
+
+func TestDockerServiceDriver_StartExisting(t *testing.T) {
+	ctx := context.Background()
+	svc := &config.Service{Name: "db"}
+	opts := []DockerServiceOption{
+		WithContainerRenderer(containerRendererFunc(postgresSpecs)),
+		WithDockerNetwork("yar-net"),
+		WithDockerSecrets(staticSecrets{"db_password": "s3cret"}),
+	}
+
+	first := docker.NewMockClient()
+	if _, err := NewDockerServiceDriver(first, "ai-agents", "local", opts...).Start(ctx, svc); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	hash := first.ContainerCreateCalls[0].Labels[LabelConfigHash]
+
+	existing := func(state, hash string) *docker.MockClient {
+		mock := docker.NewMockClient()
+		mock.NetworkListResult = []docker.Network{{Name: "yar-net"}}
+		mock.VolumeListResult = []docker.Volume{{Name: "ai-agents-db-data"}}
+		mock.ContainerInspectResults = map[string]*docker.Container{
+			"ai-agents-db": {ID: "abc", Name: "ai-agents-db", State: state, Labels: map[string]string{LabelConfigHash: hash}},
+		}
+		return mock
+	}
+
+	t.Run("unchanged and running", func(t *testing.T) {
+		mock := existing("running", hash)
+		created, err := NewDockerServiceDriver(mock, "ai-agents", "local", opts...).Start(ctx, svc)
+		if err != nil || len(created) != 0 {
+			t.Fatalf("Start() = %v, %v, want nothing created", created, err)
+		}
+		if len(mock.ContainerCreateCalls)+len(mock.ContainerStartCalls)+len(mock.VolumeCreateCalls)+len(mock.NetworkCreateCalls) != 0 {
+			t.Error("Start() changed an unchanged service")
+		}
+	})
+
+	t.Run("unchanged and stopped", func(t *testing.T) {
+		mock := existing("exited", hash)
+		if _, err := NewDockerServiceDriver(mock, "ai-agents", "local", opts...).Start(ctx, svc); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		if diff := cmp.Diff([]string{"abc"}, mock.ContainerStartCalls); diff != "" || len(mock.ContainerCreateCalls) != 0 {
+			t.Errorf("want the existing container started, got starts %v and %d creates", mock.ContainerStartCalls, len(mock.ContainerCreateCalls))
+		}
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		mock := existing("running", "sha256:old")
+		created, err := NewDockerServiceDriver(mock, "ai-agents", "local", opts...).Start(ctx, svc)
+		if err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		if diff := cmp.Diff([]string{"abc"}, mock.ContainerRemoveCalls); diff != "" {
+			t.Errorf("ContainerRemove calls mismatch (-want +got):\n%s", diff)
+		}
+		want := []Resource{{Kind: ResourceContainer, Service: "db", Name: "ai-agents-db", ID: "mock-container-1"}}
+		if diff := cmp.Diff(want, created); diff != "" {
+			t.Errorf("Start() resources mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestDockerServiceDriver_RecordsState(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStateStore(t)
+	mock := docker.NewMockClient()
+	d := NewDockerServiceDriver(mock, "ai-agents", "local",
+		WithContainerRenderer(containerRendererFunc(postgresSpecs)),
+		WithDockerSecrets(staticSecrets{"db_password": "s3cret"}))
+
+	if _, err := RecordState(d, store, "ai-agents", "local").Start(ctx, &config.Service{Name: "db"}); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	st, err := store.Load("ai-agents", "local")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if diff := cmp.Diff([]PortRecord{{Service: "db", ContainerPort: 5432, HostPort: 5432}}, st.Ports); diff != "" {
+		t.Errorf("recorded ports mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]SecretRecord{{Service: "db", Name: "db_password", Target: "/run/secrets/db_password"}}, st.Secrets); diff != "" {
+		t.Errorf("recorded secrets mismatch (-want +got):\n%s", diff)
+	}
+	if hash := mock.ContainerCreateCalls[0].Labels[LabelConfigHash]; len(st.Containers) != 1 || st.Containers[0].ConfigHash != hash {
+		t.Errorf("recorded containers = %+v, want config hash %s", st.Containers, hash)
+	}
+}
+
+func TestDockerServiceDriver_ReadyTimeout(t *testing.T) {
+	mock := docker.NewMockClient()
+	mock.ContainerListResult = []docker.Container{
+		{ID: "c-db", Name: "ai-agents-db", Labels: Labels("ai-agents", "local", "db")},
+	}
+	mock.ContainerInspectResults = map[string]*docker.Container{
+		"c-db": {ID: "c-db", Name: "ai-agents-db", State: "running", Health: "starting"},
+	}
+	d := NewDockerServiceDriver(mock, "ai-agents", "local",
+		WithDockerReadyInterval(time.Millisecond),
+		WithDockerReadyTimeout(20*time.Millisecond))
+
+	err := d.Ready(context.Background(), &config.Service{Name: "db"})
+	if !stderrors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Ready() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestDockerServiceDriver_Secrets(t *testing.T) {
+	ctx := context.Background()
+	svc := &config.Service{Name: "db"}
+
+	t.Run("no provider", func(t *testing.T) {
+		mock := docker.NewMockClient()
+		d := NewDockerServiceDriver(mock, "ai-agents", "local", WithContainerRenderer(containerRendererFunc(postgresSpecs)))
+		_, err := d.Start(ctx, svc)
+		if err == nil || !strings.Contains(err.Error(), "secret db_password") {
+			t.Fatalf("Start() error = %v, want missing secret", err)
+		}
+		if len(mock.ContainerCreateCalls) != 0 {
+			t.Error("Start() created a container without its secret")
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		mock := docker.NewMockClient()
+		log := action.NewLog(true)
+		d := NewDockerServiceDriver(mock, "ai-agents", "local",
+			WithContainerRenderer(containerRendererFunc(postgresSpecs)),
+			WithDockerNetwork("yar-net"),
+			WithDockerActionLog(log))
+		if _, err := d.Start(ctx, svc); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		if err := d.Ready(ctx, svc); err != nil {
+			t.Fatalf("Ready() error = %v", err)
+		}
+		want := []action.Action{
+			{Kind: action.KindDocker, Op: "create", Object: "network yar-net"},
+			{Kind: action.KindDocker, Op: "create", Object: "volume ai-agents-db-data"},
+			{Kind: action.KindDocker, Op: "create", Object: "container ai-agents-db", Detail: "postgres:16-alpine"},
+			{Kind: action.KindDocker, Op: "copy", Object: "container ai-agents-db:/"},
+			{Kind: action.KindDocker, Op: "start", Object: "container ai-agents-db"},
+		}
+		if diff := cmp.Diff(want, log.Actions()); diff != "" {
+			t.Errorf("actions mismatch (-want +got):\n%s", diff)
+		}
+		if len(mock.ContainerCreateCalls)+len(mock.ContainerListCalls) != 0 {
+			t.Error("dry run created or waited for containers")
+		}
+	})
+}
+
+func TestComposeStopRestart(t *testing.T) {
+	ctx := context.Background()
+	container := func(name, service, state string) docker.Container {
+		return docker.Container{Name: name, State: state, Labels: Labels("ai-agents", "local", service)}
+	}
+	job := container("ai-agents-db-seed", "db", "exited")
+	job.Labels[LabelJob] = "seed"
+	mock := docker.NewMockClient()
+	mock.ContainerListResult = []docker.Container{
+		container("ai-agents-api", "api", "running"),
+		container("ai-agents-db", "db", "running"),
+		container("ai-agents-old", "old", "running"),
+		container("ai-agents-worker", "worker", "exited"),
+		job,
+	}
+	waves := [][]*config.Service{{{Name: "db"}}, {{Name: "api"}, {Name: "worker"}}}
+
+	if err := ComposeStop(ctx, mock, "ai-agents", "local", waves); err != nil {
+		t.Fatalf("ComposeStop() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"ai-agents-old", "ai-agents-api", "ai-agents-db"}, mock.ContainerStopCalls); diff != "" {
+		t.Errorf("ContainerStop calls mismatch (-want +got):\n%s", diff)
+	}
+
+	mock.ContainerStopCalls = nil
+	if err := ComposeRestart(ctx, mock, "ai-agents", "local", waves); err != nil {
+		t.Fatalf("ComposeRestart() error = %v", err)
+	}
+	if len(mock.ContainerStopCalls) != 3 {
+		t.Errorf("ContainerStop calls = %v, want the running containers stopped", mock.ContainerStopCalls)
+	}
+	want := []string{"ai-agents-db", "ai-agents-api", "ai-agents-worker", "ai-agents-old"}
+	if diff := cmp.Diff(want, mock.ContainerStartCalls); diff != "" {
+		t.Errorf("ContainerStart calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestApply_DockerServiceDriverRollback(t *testing.T) {
+	ctx := context.Background()
+	mock := docker.NewMockClient()
+	mock.ContainerStartError = stderrors.New("port is already allocated")
+	d := NewDockerServiceDriver(mock, "ai-agents", "local",
+		WithContainerRenderer(containerRendererFunc(postgresSpecs)),
+		WithDockerNetwork("yar-net"),
+		WithDockerSecrets(staticSecrets{"db_password": "s3cret"}))
+
+	result, err := Apply(ctx, d, []*config.Service{{Name: "db"}}, ApplyOptions{Atomic: true})
+	var ferr *FleetError
+	if !stderrors.As(err, &ferr) || ferr.Op != "service.start" {
+		t.Fatalf("Apply() error = %v, want service.start FleetError", err)
+	}
+	if !result.RolledBack {
+		t.Error("Apply() did not roll back")
+	}
+	if diff := cmp.Diff([]string{"mock-container-1"}, mock.ContainerRemoveCalls); diff != "" {
+		t.Errorf("ContainerRemove calls mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"ai-agents-db-data"}, mock.VolumeRemoveCalls); diff != "" {
+		t.Errorf("VolumeRemove calls mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"yar-net"}, mock.NetworkRemoveCalls); diff != "" {
+		t.Errorf("NetworkRemove calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestApply_DockerServiceDriverCrashLoop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	mock := docker.NewMockClient()
+	crashing := docker.Container{ID: "mock-container-1", Name: "ai-agents-db", State: "restarting", RestartCount: 6, ExitCode: 1,
+		Labels: Labels("ai-agents", "local", "db")}
+	mock.ContainerListResult = []docker.Container{crashing}
+	mock.ContainerInspectResults = map[string]*docker.Container{crashing.ID: &crashing}
+	d := NewDockerServiceDriver(mock, "ai-agents", "local",
+		WithContainerRenderer(containerRendererFunc(postgresSpecs)),
+		WithDockerSecrets(staticSecrets{"db_password": "s3cret"}),
+		WithDockerReadyInterval(time.Millisecond))
+
+	_, err := Apply(ctx, d, []*config.Service{{Name: "db"}}, ApplyOptions{})
+	var failed *ServiceFailedError
+	if !stderrors.As(err, &failed) {
+		t.Fatalf("Apply() error = %v, want ServiceFailedError", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Apply() waited for the deadline")
+	}
+	if failed.Status.Name != "db" || failed.Status.State != StateCrashLooping || failed.Status.Restarts != 6 {
+		t.Errorf("failed status = %+v, want db crash-looping after 6 restarts", failed.Status)
+	}
+}
@@ -0,0 +1,93 @@
+package fleet
+
+import (
+	"context"
+
+	"github.com/yar-run/yar/internal/config"
+)
+
+// Driver brings a project environment up and down on one kind of target.
+// The compose driver serves Docker environments and K8sDriver serves
+// environments whose cluster provider is k8s.
+type Driver interface {
+	// Up starts services
+	Up(ctx context.Context, project *config.Project, env string, opts UpOptions) error
+
+	// Down stops services
+	Down(ctx context.Context, project *config.Project, env string, opts DownOptions) error
+
+	// Destroy removes all resources
+	Destroy(ctx context.Context, project *config.Project, env string, opts DestroyOptions) error
+
+	// Status returns current state
+	Status(ctx context.Context, project *config.Project, env string) (*FleetStatus, error)
+
+	// Restart restarts services
+	Restart(ctx context.Context, project *config.Project, env string, opts RestartOptions) error
+}
+
+// UpOptions configures Driver.Up.
+type UpOptions struct {
+	Build         bool // Build images before starting
+	ForceRecreate bool // Recreate resources even if unchanged
+	Atomic        bool // Remove everything created by this run on failure or interruption
+}
+
+// DownOptions configures Driver.Down.
+type DownOptions struct{}
+
+// DestroyOptions configures Driver.Destroy.
+type DestroyOptions struct {
+	KeepVolumes bool // Don't remove volumes
+}
+
+// RestartOptions configures Driver.Restart.
+type RestartOptions struct {
+	Services []string // Restrict to these services; all when empty
+}
+
+// Service status values.
+const (
+	StatusRunning = "running"
+	StatusStopped = "stopped"
+	StatusPending = "pending" // Starting or rolling out
+	StatusError   = "error"
+)
+
+// Derived service states reported in ServiceStatus.State.
+const (
+	StateStarting     = "starting"
+	StateHealthy      = "healthy"
+	StateUnhealthy    = "unhealthy"
+	StateCrashLooping = "crash-looping"
+	StateExited       = "exited"
+)
+
+// FleetStatus is the observed state of a project environment.
+type FleetStatus struct {
+	Environment string
+	Services    []ServiceStatus
+	Networks    []NetworkStatus
+	Healthy     bool
+}
+
+// ServiceStatus is the observed state of one service.
+type ServiceStatus struct {
+	Name      string
+	Status    string // StatusRunning, StatusStopped, StatusPending or StatusError
+	State     string // StateStarting, StateHealthy, StateUnhealthy, StateCrashLooping or StateExited
+	Replicas  int
+	Ready     int
+	Endpoints []string
+	Restarts  int      // Container restarts across all replicas
+	ExitCode  int      // Last exit code of the failing container, if any
+	OOMKilled bool     // The last run of a container was killed for running out of memory
+	Reason    string   // Waiting or termination reason, such as CrashLoopBackOff
+	Logs      []string // Last log lines of a failing container
+}
+
+// NetworkStatus is an observed fleet network.
+type NetworkStatus struct {
+	Name string
+	ID   string
+}
@@ -0,0 +1,113 @@
+package fleet
+
+import "fmt"
+
+// FleetError represents a fleet operation failure.
+type FleetError struct {
+	Op      string // Operation: "state.load", "state.save", "state.lock", etc.
+	Name    string // Resource name (project/environment, file path, service)
+	Message string // Human-readable message
+	Err     error  // Underlying error
+}
+
+// Error implements the error interface.
+func (e *FleetError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("fleet %s %s: %s: %v", e.Op, e.Name, e.Message, e.Err)
+	}
+	return fmt.Sprintf("fleet %s %s: %s", e.Op, e.Name, e.Message)
+}
+
+// Unwrap returns the underlying error.
+func (e *FleetError) Unwrap() error {
+	return e.Err
+}
+
+// NewFleetError creates a new FleetError.
+func NewFleetError(op, name, message string, err error) *FleetError {
+	return &FleetError{
+		Op:      op,
+		Name:    name,
+		Message: message,
+		Err:     err,
+	}
+}
+
+// ErrStateLoad creates a state record read error.
+func ErrStateLoad(name string, err error) *FleetError {
+	return NewFleetError("state.load", name, "failed to read fleet state", err)
+}
+
+// ErrStateSave creates a state record write error.
+func ErrStateSave(name string, err error) *FleetError {
+	return NewFleetError("state.save", name, "failed to write fleet state", err)
+}
+
+// ErrStateLocked creates an error for a state record held by another writer.
+func ErrStateLocked(name string, err error) *FleetError {
+	return NewFleetError("state.lock", name, "fleet state is locked by another yar process", err)
+}
+
+// ErrLocked creates an error for an operation lock held by another yar
+// process. err says why waiting stopped, if the caller waited.
+func ErrLocked(name string, holder LockHolder, err error) *FleetError {
+	return NewFleetError("lock", name, "locked by "+holder.String(), err)
+}
+
+// ErrLock creates an error for an operation lock that could not be taken
+// or released.
+func ErrLock(name string, err error) *FleetError {
+	return NewFleetError("lock", name, "failed to lock", err)
+}
+
+// ErrHook creates an error for a lifecycle hook of event that failed.
+func ErrHook(event, name string, err error) *FleetError {
+	return NewFleetError("hook", event+" "+name, "hook failed", err)
+}
+
+// ErrEnv creates an error for an env value of owner, a service or
+// service/job, whose service discovery template could not be resolved.
+func ErrEnv(owner, key string, err error) *FleetError {
+	return NewFleetError("env", owner+" "+key, "failed to resolve env value", err)
+}
+
+// ErrServiceStart creates an error for a service that failed to start.
+func ErrServiceStart(service string, err error) *FleetError {
+	return NewFleetError("service.start", service, "failed to start service", err)
+}
+
+// ErrServiceReady creates an error for a service that never became ready.
+func ErrServiceReady(service string, err error) *FleetError {
+	return NewFleetError("service.ready", service, "service did not become ready", err)
+}
+
+// ErrInterrupted creates an error for an operation stopped by cancellation.
+// err is the context error, so errors.Is(e, context.Canceled) holds.
+func ErrInterrupted(name string, err error) *FleetError {
+	return NewFleetError("apply", name, "interrupted", err)
+}
+
+// ErrRollback creates an error for resources that could not be rolled back.
+func ErrRollback(name string, err error) *FleetError {
+	return NewFleetError("rollback", name, "failed to remove resources created by this run", err)
+}
+
+// ErrSnapshotSave creates an error for a snapshot that could not be written.
+func ErrSnapshotSave(name string, err error) *FleetError {
+	return NewFleetError("snapshot.save", name, "failed to write snapshot", err)
+}
+
+// ErrSnapshotRead creates an error for a snapshot that could not be read.
+func ErrSnapshotRead(name string, err error) *FleetError {
+	return NewFleetError("snapshot.read", name, "failed to read snapshot", err)
+}
+
+// ErrSnapshotRestore creates an error for a snapshot that could not be restored.
+func ErrSnapshotRestore(name string, err error) *FleetError {
+	return NewFleetError("snapshot.restore", name, "failed to restore snapshot", err)
+}
+
+// ErrJob creates an error for a service job that failed or could not run.
+func ErrJob(name string, err error) *FleetError {
+	return NewFleetError("job", name, "job failed", err)
+}
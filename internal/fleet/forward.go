@@ -0,0 +1,341 @@
+package fleet
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Port-forward defaults.
+const (
+	DefaultForwardAddress = "127.0.0.1"
+	defaultForwardRetry   = time.Second
+	maxForwardRetry       = 30 * time.Second
+)
+
+// ForwardTarget is a Kubernetes Service whose ports are forwarded locally.
+type ForwardTarget struct {
+	Service   string            // yar service (yar.service label)
+	Name      string            // Kubernetes Service name
+	Namespace string            // Kubernetes Service namespace
+	Selector  map[string]string // Pod selector of the Service
+	Ports     []ForwardPort     // Declared Service ports
+}
+
+// ForwardPort is a declared Service port. Exactly one of TargetPort and
+// TargetName is set; TargetName is resolved against the pod's containers.
+type ForwardPort struct {
+	Port       int
+	TargetPort int
+	TargetName string
+}
+
+// Hostnames returns the names the target resolves as inside the cluster,
+// most specific last.
+func (t ForwardTarget) Hostnames() []string {
+	base := t.Name + "." + t.Namespace
+	return []string{base, base + ".svc", base + ".svc.cluster.local"}
+}
+
+// ForwardEventType identifies a port-forward state change.
+type ForwardEventType string
+
+const (
+	ForwardConnected ForwardEventType = "connected"
+	ForwardLost      ForwardEventType = "lost"
+)
+
+// ForwardEvent reports a port-forward state change for a target.
+type ForwardEvent struct {
+	Type   ForwardEventType
+	Target ForwardTarget
+	Pod    string
+	Ports  []kubernetes.ForwardPort
+	Err    error         // Why the forward was lost
+	Retry  time.Duration // Delay before reconnecting
+}
+
+// Forwarder keeps port-forwards open to the pods behind Kubernetes
+// Services, moving to another pod whenever the forwarded one goes away.
+type Forwarder struct {
+	client  kubernetes.Client
+	pf      kubernetes.PortForwarder
+	address string
+	retry   time.Duration
+	events  func(ForwardEvent)
+}
+
+// ForwardOption configures a Forwarder.
+type ForwardOption func(*Forwarder)
+
+// WithForwardAddress sets the local listen address (default 127.0.0.1).
+func WithForwardAddress(address string) ForwardOption {
+	return func(f *Forwarder) {
+		f.address = address
+	}
+}
+
+// WithForwardRetry sets the initial reconnect delay. It doubles after each
+// failed attempt, up to 30s, and resets once a forward connects.
+func WithForwardRetry(retry time.Duration) ForwardOption {
+	return func(f *Forwarder) {
+		f.retry = retry
+	}
+}
+
+// WithForwardEvents sets a callback for connect and disconnect events. It
+// is called from multiple goroutines.
+func WithForwardEvents(fn func(ForwardEvent)) ForwardOption {
+	return func(f *Forwarder) {
+		f.events = fn
+	}
+}
+
+// NewForwarder creates a Forwarder that finds pods with client and opens
+// forwards with pf.
+func NewForwarder(client kubernetes.Client, pf kubernetes.PortForwarder, opts ...ForwardOption) *Forwarder {
+	f := &Forwarder{
+		client:  client,
+		pf:      pf,
+		address: DefaultForwardAddress,
+		retry:   defaultForwardRetry,
+		events:  func(ForwardEvent) {},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Run forwards every target until ctx is cancelled. Each Service port is
+// forwarded on the same local port, so two targets declaring the same port
+// are rejected before anything is opened.
+func (f *Forwarder) Run(ctx context.Context, targets []ForwardTarget) error {
+	owners := make(map[int]string)
+	for _, t := range targets {
+		for _, p := range t.Ports {
+			if owner, ok := owners[p.Port]; ok && owner != t.Name {
+				return &errors.ValidationError{
+					Field:   "ports",
+					Value:   p.Port,
+					Message: fmt.Sprintf("local port %d is declared by both %s and %s; forward them separately", p.Port, owner, t.Name),
+				}
+			}
+			owners[p.Port] = t.Name
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t ForwardTarget) {
+			defer wg.Done()
+			f.forward(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+	return nil
+}
+
+// forward keeps one target forwarded until ctx is cancelled.
+func (f *Forwarder) forward(ctx context.Context, t ForwardTarget) {
+	retry := f.retry
+	for {
+		pod, ports, err := f.resolve(ctx, t)
+		if err == nil {
+			ready := make(chan struct{})
+			done := make(chan struct{})
+			notified := make(chan struct{})
+			go func() {
+				defer close(notified)
+				select {
+				case <-ready:
+				case <-done:
+					// A forward that was ready and dropped at once is
+					// still reported as connected before it is lost.
+					select {
+					case <-ready:
+					default:
+						return
+					}
+				}
+				f.events(ForwardEvent{Type: ForwardConnected, Target: t, Pod: pod, Ports: ports})
+			}()
+			err = f.pf.PortForward(ctx, t.Namespace, pod, f.address, ports, ready)
+			close(done)
+			<-notified
+			select {
+			case <-ready:
+				retry = f.retry
+			default:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = NewFleetError("forward", t.Name, "port-forward closed", nil)
+		}
+
+		f.events(ForwardEvent{Type: ForwardLost, Target: t, Pod: pod, Err: err, Retry: retry})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, maxForwardRetry)
+	}
+}
+
+// resolve picks a ready pod behind the target and maps its ports.
+func (f *Forwarder) resolve(ctx context.Context, t ForwardTarget) (string, []kubernetes.ForwardPort, error) {
+	selector := labels.SelectorFromSet(t.Selector).String()
+	pods, err := f.client.List(ctx, kubernetes.PodKind, t.Namespace, selector)
+	if err != nil {
+		return "", nil, err
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].GetName() < pods[j].GetName() })
+
+	for i := range pods {
+		if !podReady(&pods[i]) {
+			continue
+		}
+		ports := make([]kubernetes.ForwardPort, 0, len(t.Ports))
+		for _, p := range t.Ports {
+			remote := p.TargetPort
+			if p.TargetName != "" {
+				remote = containerPort(&pods[i], p.TargetName)
+				if remote == 0 {
+					return "", nil, NewFleetError("forward", t.Name, fmt.Sprintf("pod %s has no container port named %q", pods[i].GetName(), p.TargetName), nil)
+				}
+			}
+			ports = append(ports, kubernetes.ForwardPort{Local: p.Port, Remote: remote})
+		}
+		return pods[i].GetName(), ports, nil
+	}
+	return "", nil, NewFleetError("forward", t.Name, "no ready pod behind service", nil)
+}
+
+// ForwardTargets returns the Services of a project environment that can be
+// forwarded, restricted to services when any are named. Services without a
+// pod selector or ports are skipped.
+func (d *K8sDriver) ForwardTargets(ctx context.Context, project *config.Project, env string, services []string) ([]ForwardTarget, error) {
+	selector := LabelSelector(project.Project, env)
+	found := make(map[string]bool)
+	var targets []ForwardTarget
+
+	for _, ns := range d.namespaces(project) {
+		items, err := d.client.List(ctx, kubernetes.ServiceKind, ns, selector)
+		if err != nil {
+			return nil, err
+		}
+		for i := range items {
+			svc := &items[i]
+			name := serviceName(svc)
+			if len(services) > 0 && !contains(services, name) {
+				continue
+			}
+			target, ok := forwardTarget(svc)
+			if !ok {
+				continue
+			}
+			target.Service = name
+			found[name] = true
+			targets = append(targets, target)
+		}
+	}
+
+	for _, name := range services {
+		if !found[name] {
+			return nil, &errors.NotFoundError{Resource: "service", Name: name, Message: "no forwardable Kubernetes Service in environment " + env}
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Namespace != targets[j].Namespace {
+			return targets[i].Namespace < targets[j].Namespace
+		}
+		return targets[i].Name < targets[j].Name
+	})
+	return targets, nil
+}
+
+// forwardTarget converts a Kubernetes Service into a ForwardTarget.
+func forwardTarget(svc *unstructured.Unstructured) (ForwardTarget, bool) {
+	selector, _, _ := unstructured.NestedStringMap(svc.Object, "spec", "selector")
+	ports, _, _ := unstructured.NestedSlice(svc.Object, "spec", "ports")
+	if len(selector) == 0 || len(ports) == 0 {
+		return ForwardTarget{}, false
+	}
+
+	target := ForwardTarget{Name: svc.GetName(), Namespace: svc.GetNamespace(), Selector: selector}
+	for _, p := range ports {
+		port, _ := p.(map[string]any)
+		if protocol, _, _ := unstructured.NestedString(port, "protocol"); protocol != "" && protocol != "TCP" {
+			continue
+		}
+		number, _, _ := unstructured.NestedInt64(port, "port")
+		fp := ForwardPort{Port: int(number), TargetPort: int(number)}
+		switch v := port["targetPort"].(type) {
+		case int64:
+			fp.TargetPort = int(v)
+		case float64:
+			fp.TargetPort = int(v)
+		case string:
+			fp.TargetPort, fp.TargetName = 0, v
+		}
+		target.Ports = append(target.Ports, fp)
+	}
+	return target, len(target.Ports) > 0
+}
+
+// podReady reports whether a pod is running, not terminating, and Ready.
+func podReady(pod *unstructured.Unstructured) bool {
+	if pod.GetDeletionTimestamp() != nil {
+		return false
+	}
+	if phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase"); phase != "Running" {
+		return false
+	}
+	conditions, _, _ := unstructured.NestedSlice(pod.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, _ := c.(map[string]any)
+		if cond["type"] == "Ready" {
+			return cond["status"] == "True"
+		}
+	}
+	return false
+}
+
+// containerPort returns the number of a named container port, or 0.
+func containerPort(pod *unstructured.Unstructured, name string) int {
+	containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", "containers")
+	for _, c := range containers {
+		container, _ := c.(map[string]any)
+		ports, _, _ := unstructured.NestedSlice(container, "ports")
+		for _, p := range ports {
+			port, _ := p.(map[string]any)
+			if port["name"] == name {
+				number, _, _ := unstructured.NestedInt64(port, "containerPort")
+				return int(number)
+			}
+		}
+	}
+	return 0
+}
+
+// ForwardHostnames returns the hostnames of all targets.
+func ForwardHostnames(targets []ForwardTarget) []string {
+	var names []string
+	for _, t := range targets {
+		names = append(names, t.Hostnames()...)
+	}
+	return names
+}
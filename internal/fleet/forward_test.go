@@ -0,0 +1,301 @@
+package fleet
+
+import (
+	"context"
+	stderrors "errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/kubernetes/kubetest"
+)
+
+// fakeForward is one PortForward call recorded by fakeForwarder.
+type fakeForward struct {
+	Namespace string
+	Pod       string
+	Address   string
+	Ports     []kubernetes.ForwardPort
+}
+
+// fakeForwarder records forwards. Each call becomes ready immediately and
+// then ends with the next error from drops, or blocks until cancellation
+// once drops is exhausted.
+type fakeForwarder struct {
+	mu     sync.Mutex
+	calls  []fakeForward
+	drops  []error
+	onCall func(n int)
+}
+
+func (f *fakeForwarder) PortForward(ctx context.Context, namespace, pod, address string, ports []kubernetes.ForwardPort, ready chan struct{}) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, fakeForward{Namespace: namespace, Pod: pod, Address: address, Ports: ports})
+	n := len(f.calls)
+	var drop error
+	if len(f.drops) > 0 {
+		drop, f.drops = f.drops[0], f.drops[1:]
+	}
+	onCall := f.onCall
+	f.mu.Unlock()
+
+	close(ready)
+	if onCall != nil {
+		onCall(n)
+	}
+	if drop != nil {
+		return drop
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (f *fakeForwarder) Calls() []fakeForward {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeForward(nil), f.calls...)
+}
+
+func forwardService(namespace, name, service string, ports ...map[string]any) *unstructured.Unstructured {
+	svc := labeled(kubernetes.ServiceKind, namespace, name, "dev", service)
+	list := make([]any, len(ports))
+	for i, p := range ports {
+		list[i] = p
+	}
+	svc.Object["spec"] = map[string]any{
+		"selector": map[string]any{"app": name},
+		"ports":    list,
+	}
+	return svc
+}
+
+func readyPod(namespace, name, app string, ready bool, containerPorts ...map[string]any) *unstructured.Unstructured {
+	pod := labeled(kubernetes.PodKind, namespace, name, "dev", app)
+	labels := pod.GetLabels()
+	labels["app"] = app
+	pod.SetLabels(labels)
+	status := "False"
+	if ready {
+		status = "True"
+	}
+	ports := make([]any, len(containerPorts))
+	for i, p := range containerPorts {
+		ports[i] = p
+	}
+	pod.Object["spec"] = map[string]any{
+		"containers": []any{map[string]any{"name": app, "ports": ports}},
+	}
+	pod.Object["status"] = map[string]any{
+		"phase":      "Running",
+		"conditions": []any{map[string]any{"type": "Ready", "status": status}},
+	}
+	return pod
+}
+
+func TestK8sDriver_ForwardTargets(t *testing.T) {
+	headless := labeled(kubernetes.ServiceKind, "dev", "external", "dev", "external")
+	headless.Object["spec"] = map[string]any{"type": "ExternalName", "externalName": "example.com"}
+	unmanaged := forwardService("dev", "unmanaged", "unmanaged", map[string]any{"port": int64(2)})
+	unmanaged.SetLabels(nil)
+
+	client, _ := kubetest.NewFakeClient("dev",
+		forwardService("dev", "redis", "redis", map[string]any{"port": int64(6379)}),
+		forwardService("dev", "api", "api",
+			map[string]any{"port": int64(80), "targetPort": "http"},
+			map[string]any{"port": int64(9090), "targetPort": int64(9091)},
+			map[string]any{"port": int64(53), "protocol": "UDP"},
+		),
+		headless,
+		forwardService("dev", "other", "other", map[string]any{"port": int64(1)}),
+		unmanaged,
+	)
+	d := newTestK8sDriver(client)
+
+	targets, err := d.ForwardTargets(context.Background(), k8sProject(), "dev", nil)
+	if err != nil {
+		t.Fatalf("ForwardTargets() error = %v", err)
+	}
+	want := []ForwardTarget{
+		{
+			Service: "api", Name: "api", Namespace: "dev",
+			Selector: map[string]string{"app": "api"},
+			Ports:    []ForwardPort{{Port: 80, TargetName: "http"}, {Port: 9090, TargetPort: 9091}},
+		},
+		{
+			Service: "other", Name: "other", Namespace: "dev",
+			Selector: map[string]string{"app": "other"},
+			Ports:    []ForwardPort{{Port: 1, TargetPort: 1}},
+		},
+		{
+			Service: "redis", Name: "redis", Namespace: "dev",
+			Selector: map[string]string{"app": "redis"},
+			Ports:    []ForwardPort{{Port: 6379, TargetPort: 6379}},
+		},
+	}
+	if diff := cmp.Diff(want, targets); diff != "" {
+		t.Errorf("ForwardTargets() mismatch (-want +got):\n%s", diff)
+	}
+
+	targets, err = d.ForwardTargets(context.Background(), k8sProject(), "dev", []string{"redis"})
+	if err != nil {
+		t.Fatalf("ForwardTargets(redis) error = %v", err)
+	}
+	if len(targets) != 1 || targets[0].Name != "redis" {
+		t.Errorf("ForwardTargets(redis) = %+v", targets)
+	}
+
+	_, err = d.ForwardTargets(context.Background(), k8sProject(), "dev", []string{"external"})
+	var nf *errors.NotFoundError
+	if !stderrors.As(err, &nf) {
+		t.Errorf("ForwardTargets(external) error = %v, want NotFoundError", err)
+	}
+}
+
+func TestForwardTarget_Hostnames(t *testing.T) {
+	target := ForwardTarget{Name: "redis", Namespace: "ai-agents-redis"}
+	want := []string{
+		"redis.ai-agents-redis",
+		"redis.ai-agents-redis.svc",
+		"redis.ai-agents-redis.svc.cluster.local",
+	}
+	if diff := cmp.Diff(want, target.Hostnames()); diff != "" {
+		t.Errorf("Hostnames() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestForwarder_ResolvesReadyPodAndNamedPorts(t *testing.T) {
+	client, _ := kubetest.NewFakeClient("dev",
+		readyPod("dev", "api-0", "api", false, map[string]any{"name": "http", "containerPort": int64(8080)}),
+		readyPod("dev", "api-1", "api", true, map[string]any{"name": "http", "containerPort": int64(8080)}),
+	)
+	pf := &fakeForwarder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	pf.onCall = func(int) { cancel() }
+
+	target := ForwardTarget{
+		Name: "api", Namespace: "dev",
+		Selector: map[string]string{"app": "api"},
+		Ports:    []ForwardPort{{Port: 80, TargetName: "http"}, {Port: 9090, TargetPort: 9091}},
+	}
+	f := NewForwarder(client, pf, WithForwardAddress("127.0.0.2"))
+	if err := f.Run(ctx, []ForwardTarget{target}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []fakeForward{{
+		Namespace: "dev", Pod: "api-1", Address: "127.0.0.2",
+		Ports: []kubernetes.ForwardPort{{Local: 80, Remote: 8080}, {Local: 9090, Remote: 9091}},
+	}}
+	if diff := cmp.Diff(want, pf.Calls()); diff != "" {
+		t.Errorf("forwards mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestForwarder_ReconnectsAfterLostConnection(t *testing.T) {
+	client, _ := kubetest.NewFakeClient("dev",
+		readyPod("dev", "redis-0", "redis", true),
+	)
+	pf := &fakeForwarder{drops: []error{stderrors.New("pod restarted")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	pf.onCall = func(n int) {
+		if n == 2 {
+			cancel()
+		}
+	}
+
+	var mu sync.Mutex
+	var events []ForwardEventType
+	f := NewForwarder(client, pf,
+		WithForwardRetry(time.Millisecond),
+		WithForwardEvents(func(e ForwardEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e.Type)
+		}),
+	)
+	target := ForwardTarget{
+		Name: "redis", Namespace: "dev",
+		Selector: map[string]string{"app": "redis"},
+		Ports:    []ForwardPort{{Port: 6379, TargetPort: 6379}},
+	}
+	if err := f.Run(ctx, []ForwardTarget{target}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got := len(pf.Calls()); got != 2 {
+		t.Errorf("PortForward calls = %d, want 2", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []ForwardEventType{ForwardConnected, ForwardLost, ForwardConnected}
+	if diff := cmp.Diff(want, events); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestForwarder_WaitsForReadyPod(t *testing.T) {
+	client, dyn := kubetest.NewFakeClient("dev")
+	pf := &fakeForwarder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	pf.onCall = func(int) { cancel() }
+
+	var once sync.Once
+	f := NewForwarder(client, pf,
+		WithForwardRetry(time.Millisecond),
+		WithForwardEvents(func(e ForwardEvent) {
+			if e.Type != ForwardLost {
+				return
+			}
+			// The pod appears after the first failed lookup.
+			once.Do(func() {
+				pod := readyPod("dev", "redis-0", "redis", true)
+				if err := dyn.Tracker().Add(pod); err != nil {
+					t.Error(err)
+				}
+			})
+		}),
+	)
+	target := ForwardTarget{
+		Name: "redis", Namespace: "dev",
+		Selector: map[string]string{"app": "redis"},
+		Ports:    []ForwardPort{{Port: 6379, TargetPort: 6379}},
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- f.Run(ctx, []ForwardTarget{target}) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		cancel()
+		t.Fatal("Run() did not connect once the pod became ready")
+	}
+	if calls := pf.Calls(); len(calls) != 1 || calls[0].Pod != "redis-0" {
+		t.Errorf("forwards = %+v", calls)
+	}
+}
+
+func TestForwarder_PortConflict(t *testing.T) {
+	client, _ := kubetest.NewFakeClient("dev")
+	pf := &fakeForwarder{}
+	targets := []ForwardTarget{
+		{Name: "a", Namespace: "dev", Ports: []ForwardPort{{Port: 8080, TargetPort: 8080}}},
+		{Name: "b", Namespace: "dev", Ports: []ForwardPort{{Port: 8080, TargetPort: 80}}},
+	}
+
+	err := NewForwarder(client, pf).Run(context.Background(), targets)
+	var ve *errors.ValidationError
+	if !stderrors.As(err, &ve) {
+		t.Fatalf("Run() error = %v, want ValidationError", err)
+	}
+	if len(pf.Calls()) != 0 {
+		t.Error("Run() opened forwards despite the conflict")
+	}
+}
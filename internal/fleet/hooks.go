@@ -0,0 +1,408 @@
+package fleet
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/platform"
+)
+
+// HookExec describes a hook command run inside a service's container.
+type HookExec struct {
+	Project string          // Project as returned by InstanceProject
+	Env     string          // Environment name
+	Service *config.Service // Service whose container runs the command
+	Cmd     []string        // Command and arguments
+	Environ []string        // Environment variables as KEY=value
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+// HookExecutor runs exec hooks inside service containers. Drivers that
+// support exec hooks provide one.
+type HookExecutor interface {
+	// ExecHook runs e.Cmd to completion and returns its exit code.
+	ExecHook(ctx context.Context, e HookExec) (int, error)
+}
+
+// HookShell runs a host hook's shell command in dir and returns its exit
+// code.
+type HookShell func(ctx context.Context, command, dir string, environ []string, stdout, stderr io.Writer) (int, error)
+
+// HookRunner runs the lifecycle hooks of a project and its services. Host
+// hooks run through the shell in the project directory; exec hooks run
+// through a HookExecutor. Every hook is recorded in the action log, so a
+// dry run lists the hooks without running them.
+type HookRunner struct {
+	project   *config.Project
+	env       string
+	dir       string
+	executor  HookExecutor
+	log       *action.Log
+	stdout    io.Writer
+	stderr    io.Writer
+	shell     HookShell
+	hostPorts bool
+}
+
+// HookOption configures a HookRunner.
+type HookOption func(*HookRunner)
+
+// WithHookDir sets the directory host hooks run in, normally the directory
+// of yar.yaml.
+func WithHookDir(dir string) HookOption {
+	return func(r *HookRunner) {
+		r.dir = dir
+	}
+}
+
+// WithHookExecutor sets the executor for exec hooks. Without one, exec
+// hooks fail.
+func WithHookExecutor(executor HookExecutor) HookOption {
+	return func(r *HookRunner) {
+		r.executor = executor
+	}
+}
+
+// WithHookActionLog records hooks in log; in a dry run they are not run.
+func WithHookActionLog(log *action.Log) HookOption {
+	return func(r *HookRunner) {
+		r.log = log
+	}
+}
+
+// WithHookOutput sets where hook output and warnings go. The defaults are
+// os.Stdout and os.Stderr.
+func WithHookOutput(stdout, stderr io.Writer) HookOption {
+	return func(r *HookRunner) {
+		r.stdout = stdout
+		r.stderr = stderr
+	}
+}
+
+// WithHookShell overrides how host hooks are run.
+func WithHookShell(shell HookShell) HookOption {
+	return func(r *HookRunner) {
+		r.shell = shell
+	}
+}
+
+// WithHookHostPorts adds the published host ports of services to the
+// environment of host hooks, for targets that publish ports on the host.
+func WithHookHostPorts() HookOption {
+	return func(r *HookRunner) {
+		r.hostPorts = true
+	}
+}
+
+// NewHookRunner creates a hook runner for a project environment. project
+// carries the instance project name, if any (see InstanceProject).
+func NewHookRunner(project *config.Project, env string, opts ...HookOption) *HookRunner {
+	r := &HookRunner{
+		project: project,
+		env:     env,
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+		shell:   runShell,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// HasHooks reports whether project or any of its services has hooks for
+// event.
+func HasHooks(project *config.Project, event string) bool {
+	if len(project.Hooks.For(event)) > 0 {
+		return true
+	}
+	for _, svc := range project.Services {
+		if len(svc.Hooks.For(event)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs the hooks of event. Service hooks run in dependency order for
+// up events and in reverse order otherwise; project hooks run before them
+// for pre- events and after them for post- events. A failed hook stops the
+// run with an error unless its failure policy is warn, in which case a
+// warning is printed and the run continues.
+func (r *HookRunner) Run(ctx context.Context, event string) error {
+	waves, err := Waves(r.project.Services)
+	if err != nil {
+		return err
+	}
+	var services []*config.Service
+	for _, wave := range waves {
+		services = append(services, wave...)
+	}
+	if event != config.HookPreUp && event != config.HookPostUp {
+		for i, j := 0, len(services)-1; i < j; i, j = i+1, j-1 {
+			services[i], services[j] = services[j], services[i]
+		}
+	}
+
+	type owned struct {
+		owner *config.Service
+		hook  *config.Hook
+	}
+	var hooks []owned
+	for _, svc := range services {
+		for _, hook := range svc.Hooks.For(event) {
+			hooks = append(hooks, owned{svc, hook})
+		}
+	}
+	var project []owned
+	for _, hook := range r.project.Hooks.For(event) {
+		project = append(project, owned{nil, hook})
+	}
+	if strings.HasPrefix(event, "pre-") {
+		hooks = append(project, hooks...)
+	} else {
+		hooks = append(hooks, project...)
+	}
+
+	for _, h := range hooks {
+		if err := ctx.Err(); err != nil {
+			return ErrInterrupted(event+" hooks", err)
+		}
+		if err := r.runHook(ctx, event, h.owner, h.hook); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runHook runs one hook of event, owned by owner or by the project if owner
+// is nil.
+func (r *HookRunner) runHook(ctx context.Context, event string, owner *config.Service, hook *config.Hook) error {
+	name := hook.DisplayName()
+	if owner != nil {
+		name = owner.Name + "/" + name
+	}
+	target, err := r.execTarget(owner, hook)
+	if err != nil {
+		return ErrHook(event, name, err)
+	}
+
+	a := action.Action{Kind: action.KindHook, Op: event, Object: name, Detail: "run: " + hook.Run}
+	if target != nil {
+		a.Detail = "exec in " + target.Name + ": " + strings.Join(hook.Exec, " ")
+	}
+	err = r.log.Do(a, func() error {
+		fmt.Fprintf(r.stderr, "running %s hook %s\n", event, name)
+		return r.execute(ctx, event, owner, target, hook)
+	})
+	if err == nil {
+		return nil
+	}
+	if hook.FailurePolicy() == config.HookOnFailureWarn {
+		fmt.Fprintf(r.stderr, "warning: %s hook %s failed: %v\n", event, name, err)
+		return nil
+	}
+	return ErrHook(event, name, err)
+}
+
+// execTarget returns the service whose container runs an exec hook, or nil
+// for a host hook.
+func (r *HookRunner) execTarget(owner *config.Service, hook *config.Hook) (*config.Service, error) {
+	if len(hook.Exec) == 0 {
+		return nil, nil
+	}
+	if hook.Service == "" {
+		if owner == nil {
+			return nil, stderrors.New("exec hooks of the project must name a service")
+		}
+		return owner, nil
+	}
+	for _, svc := range r.project.Services {
+		if svc.Name == hook.Service {
+			return svc, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown service %q", hook.Service)
+}
+
+// execute runs hook within its timeout.
+func (r *HookRunner) execute(ctx context.Context, event string, owner, target *config.Service, hook *config.Hook) error {
+	timeout := hook.Timeout
+	if timeout == "" {
+		timeout = config.DefaultHookTimeout
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout %q", timeout)
+	}
+	hookCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	environ := r.environ(event, owner, target == nil, hook)
+
+	var code int
+	if target == nil {
+		code, err = r.shell(hookCtx, hook.Run, r.dir, append(os.Environ(), environ...), r.stdout, r.stderr)
+	} else {
+		if r.executor == nil {
+			return stderrors.New("exec hooks are not supported in this environment")
+		}
+		code, err = r.executor.ExecHook(hookCtx, HookExec{
+			Project: r.project.Project,
+			Env:     r.env,
+			Service: target,
+			Cmd:     hook.Exec,
+			Environ: environ,
+			Stdout:  r.stdout,
+			Stderr:  r.stderr,
+		})
+	}
+	switch {
+	case stderrors.Is(hookCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+		return fmt.Errorf("timed out after %s", d)
+	case err != nil:
+		return err
+	case code != 0:
+		return fmt.Errorf("exited with code %d", code)
+	}
+	return nil
+}
+
+// environ returns the environment of a hook, sorted: the fleet's identity
+// and service endpoints, then the hook's env. Secret values are never
+// added (INV-SEC-001).
+func (r *HookRunner) environ(event string, owner *config.Service, host bool, hook *config.Hook) []string {
+	base, instance := SplitInstanceProject(r.project.Project)
+	vars := map[string]string{
+		"YAR_PROJECT": base,
+		"YAR_ENV":     r.env,
+		"YAR_HOOK":    event,
+	}
+	if instance != "" {
+		vars["YAR_INSTANCE"] = instance
+	}
+	if owner != nil {
+		vars["YAR_SERVICE"] = owner.Name
+	}
+	for _, svc := range r.project.Services {
+		prefix := "YAR_" + envName(svc.Name) + "_"
+		vars[prefix+"HOST"] = ServiceHostname(r.project.Project, svc)
+		ports := ServicePorts(r.project.Project, svc)
+		if len(ports) > 0 {
+			vars[prefix+"PORT"] = strconv.Itoa(ports[0].Container)
+		}
+		if host && r.hostPorts && len(ports) > 0 && ports[0].Host != 0 {
+			vars[prefix+"HOST_PORT"] = strconv.Itoa(ports[0].Host)
+		}
+	}
+	for k, v := range hook.Env {
+		vars[k] = v
+	}
+
+	environ := make([]string, 0, len(vars))
+	for k, v := range vars {
+		environ = append(environ, k+"="+v)
+	}
+	sort.Strings(environ)
+	return environ
+}
+
+// envName converts a service name into environment variable form:
+// my-db becomes MY_DB.
+func envName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// runShell is the default HookShell. A command interrupted by ctx is an
+// error, even if the shell reported an exit code.
+func runShell(ctx context.Context, command, dir string, environ []string, stdout, stderr io.Writer) (int, error) {
+	cmd := platform.ShellCommand(ctx, command)
+	cmd.Dir = dir
+	cmd.Env = environ
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	var exit *exec.ExitError
+	if stderrors.As(err, &exit) {
+		return exit.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// DockerHookExecutor runs exec hooks in a service's container.
+type DockerHookExecutor struct {
+	client docker.Client
+}
+
+// NewDockerHookExecutor creates a hook executor using client.
+func NewDockerHookExecutor(client docker.Client) *DockerHookExecutor {
+	return &DockerHookExecutor{client: client}
+}
+
+// ExecHook implements HookExecutor.
+func (x *DockerHookExecutor) ExecHook(ctx context.Context, e HookExec) (int, error) {
+	return x.client.ContainerExec(ctx, ContainerName(e.Project, e.Service.Name), docker.ExecOptions{
+		Cmd:    e.Cmd,
+		Env:    e.Environ,
+		Stdout: e.Stdout,
+		Stderr: e.Stderr,
+	})
+}
+
+// K8sHookExecutor runs exec hooks in a ready pod of a service. The pod
+// exec API takes no environment, so the command is wrapped in env(1).
+type K8sHookExecutor struct {
+	client   kubernetes.Client
+	executor kubernetes.Executor
+}
+
+// NewK8sHookExecutor creates a hook executor that finds pods with client
+// and runs commands in them with executor.
+func NewK8sHookExecutor(client kubernetes.Client, executor kubernetes.Executor) *K8sHookExecutor {
+	return &K8sHookExecutor{client: client, executor: executor}
+}
+
+// ExecHook implements HookExecutor.
+func (x *K8sHookExecutor) ExecHook(ctx context.Context, e HookExec) (int, error) {
+	selector := LabelSelector(e.Project, e.Env) + "," + LabelService + "=" + e.Service.Name + ",!" + LabelJob
+	pods, err := x.client.List(ctx, kubernetes.PodKind, e.Service.Namespace, selector)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].GetName() < pods[j].GetName() })
+
+	var pod *unstructured.Unstructured
+	for i := range pods {
+		if podReady(&pods[i]) {
+			pod = &pods[i]
+			break
+		}
+	}
+	if pod == nil {
+		return 0, fmt.Errorf("no ready pod for service %q", e.Service.Name)
+	}
+
+	cmd := append([]string{"env"}, e.Environ...)
+	cmd = append(cmd, e.Cmd...)
+	return x.executor.Exec(ctx, pod.GetNamespace(), pod.GetName(), "", cmd, e.Stdout, e.Stderr)
+}
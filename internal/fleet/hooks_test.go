@@ -0,0 +1,306 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/kubernetes/kubetest"
+)
+
+// recordingShell is a HookShell that records commands and their
+// environments and exits with the code configured for each command.
+type recordingShell struct {
+	codes    map[string]int
+	commands []string
+	environs [][]string
+}
+
+func (s *recordingShell) run(ctx context.Context, command, dir string, environ []string, stdout, stderr io.Writer) (int, error) {
+	s.commands = append(s.commands, command)
+	s.environs = append(s.environs, environ)
+	return s.codes[command], nil
+}
+
+func hookProject() *config.Project {
+	return &config.Project{
+		Project: "ai-agents",
+		Hooks: &config.Hooks{
+			PreUp:  []*config.Hook{{Run: "project-pre-up"}},
+			PostUp: []*config.Hook{{Run: "project-post-up"}},
+		},
+		Services: []*config.Service{
+			{Name: "app", Requires: []string{"redis"}, Hooks: &config.Hooks{
+				PreUp:   []*config.Hook{{Run: "app-pre-up"}},
+				PreDown: []*config.Hook{{Run: "app-pre-down"}},
+			}},
+			{Name: "redis", Params: map[string]any{"ports": []any{
+				map[string]any{"containerPort": 6379, "hostPort": 6379},
+			}}, Hooks: &config.Hooks{
+				PreUp:   []*config.Hook{{Run: "redis-pre-up"}},
+				PreDown: []*config.Hook{{Run: "redis-pre-down"}},
+			}},
+		},
+	}
+}
+
+func TestHookRunner_Order(t *testing.T) {
+	tests := []struct {
+		event string
+		want  []string
+	}{
+		{config.HookPreUp, []string{"project-pre-up", "redis-pre-up", "app-pre-up"}},
+		{config.HookPostUp, []string{"project-post-up"}},
+		{config.HookPreDown, []string{"app-pre-down", "redis-pre-down"}},
+		{config.HookPostDestroy, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			shell := &recordingShell{}
+			r := NewHookRunner(hookProject(), "local", WithHookShell(shell.run), WithHookOutput(io.Discard, io.Discard))
+			if err := r.Run(context.Background(), tt.event); err != nil {
+				t.Fatalf("Run() error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, shell.commands); diff != "" {
+				t.Errorf("commands mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHookRunner_Environ(t *testing.T) {
+	proj := hookProject()
+	proj.Project = InstanceProject("ai-agents", "feature-x")
+	proj.Hooks = &config.Hooks{PostUp: []*config.Hook{{
+		Run: "seed",
+		Env: map[string]string{"SEED": "small"},
+	}}}
+
+	shell := &recordingShell{}
+	r := NewHookRunner(proj, "local",
+		WithHookShell(shell.run),
+		WithHookOutput(io.Discard, io.Discard),
+		WithHookHostPorts())
+	if err := r.Run(context.Background(), config.HookPostUp); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	environ := shell.environs[0]
+	for _, want := range []string{
+		"YAR_PROJECT=ai-agents",
+		"YAR_INSTANCE=feature-x",
+		"YAR_ENV=local",
+		"YAR_HOOK=post-up",
+		"YAR_REDIS_HOST=redis.feature-x.ai-agents",
+		"YAR_REDIS_PORT=6379",
+		fmt.Sprintf("YAR_REDIS_HOST_PORT=%d", HostPort(proj.Project, 6379)),
+		"YAR_APP_HOST=app.feature-x.ai-agents",
+		"SEED=small",
+	} {
+		if !slices.Contains(environ, want) {
+			t.Errorf("environment lacks %s", want)
+		}
+	}
+	if slices.ContainsFunc(environ, func(v string) bool { return strings.HasPrefix(v, "YAR_SERVICE=") }) {
+		t.Error("project hook environment has YAR_SERVICE")
+	}
+}
+
+func TestHookRunner_Failure(t *testing.T) {
+	proj := hookProject()
+	shell := &recordingShell{codes: map[string]int{"redis-pre-up": 2}}
+	r := NewHookRunner(proj, "local", WithHookShell(shell.run), WithHookOutput(io.Discard, io.Discard))
+
+	err := r.Run(context.Background(), config.HookPreUp)
+	var fleetErr *FleetError
+	if !errors.As(err, &fleetErr) || fleetErr.Op != "hook" || fleetErr.Name != "pre-up redis/redis-pre-up" {
+		t.Fatalf("Run() error = %v, want hook error for redis/redis-pre-up", err)
+	}
+	if !strings.Contains(err.Error(), "exited with code 2") {
+		t.Errorf("Run() error = %v, want exit code", err)
+	}
+	if diff := cmp.Diff([]string{"project-pre-up", "redis-pre-up"}, shell.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+
+	// With onFailure: warn the run continues.
+	proj.Services[1].Hooks.PreUp[0].OnFailure = config.HookOnFailureWarn
+	shell = &recordingShell{codes: map[string]int{"redis-pre-up": 2}}
+	var stderr bytes.Buffer
+	r = NewHookRunner(proj, "local", WithHookShell(shell.run), WithHookOutput(io.Discard, &stderr))
+	if err := r.Run(context.Background(), config.HookPreUp); err != nil {
+		t.Fatalf("Run() with warn error: %v", err)
+	}
+	if len(shell.commands) != 3 {
+		t.Errorf("commands = %v, want all three hooks", shell.commands)
+	}
+	if !strings.Contains(stderr.String(), "warning: pre-up hook redis/redis-pre-up failed: exited with code 2") {
+		t.Errorf("stderr = %q, want a warning", stderr.String())
+	}
+}
+
+func TestHookRunner_Timeout(t *testing.T) {
+	proj := &config.Project{
+		Project:  "ai-agents",
+		Hooks:    &config.Hooks{PostUp: []*config.Hook{{Name: "slow", Run: "sleep", Timeout: "10ms"}}},
+		Services: []*config.Service{{Name: "redis"}},
+	}
+	shell := func(ctx context.Context, command, dir string, environ []string, stdout, stderr io.Writer) (int, error) {
+		<-ctx.Done()
+		return -1, ctx.Err()
+	}
+	r := NewHookRunner(proj, "local", WithHookShell(shell), WithHookOutput(io.Discard, io.Discard))
+
+	err := r.Run(context.Background(), config.HookPostUp)
+	if err == nil || !strings.Contains(err.Error(), "post-up slow: hook failed: timed out after 10ms") {
+		t.Fatalf("Run() error = %v, want timeout", err)
+	}
+}
+
+func TestHookRunner_DryRun(t *testing.T) {
+	proj := hookProject()
+	proj.Services[1].Hooks.PostUp = []*config.Hook{{Name: "seed", Exec: []string{"redis-cli", "ping"}}}
+	shell := &recordingShell{}
+	mock := docker.NewMockClient()
+	log := action.NewLog(true)
+	r := NewHookRunner(proj, "local",
+		WithHookShell(shell.run),
+		WithHookExecutor(NewDockerHookExecutor(mock)),
+		WithHookActionLog(log),
+		WithHookOutput(io.Discard, io.Discard))
+
+	if err := r.Run(context.Background(), config.HookPostUp); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if len(shell.commands) != 0 || len(mock.ContainerExecCalls) != 0 {
+		t.Errorf("dry run ran hooks: shell %v, exec %v", shell.commands, mock.ContainerExecCalls)
+	}
+	want := []action.Action{
+		{Kind: action.KindHook, Op: "post-up", Object: "redis/seed", Detail: "exec in redis: redis-cli ping"},
+		{Kind: action.KindHook, Op: "post-up", Object: "project-post-up", Detail: "run: project-post-up"},
+	}
+	if diff := cmp.Diff(want, log.Actions()); diff != "" {
+		t.Errorf("actions mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHookRunner_ExecWithoutExecutor(t *testing.T) {
+	proj := &config.Project{
+		Project:  "ai-agents",
+		Hooks:    &config.Hooks{PostUp: []*config.Hook{{Exec: []string{"true"}, Service: "redis"}}},
+		Services: []*config.Service{{Name: "redis"}},
+	}
+	r := NewHookRunner(proj, "local", WithHookOutput(io.Discard, io.Discard))
+
+	err := r.Run(context.Background(), config.HookPostUp)
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("Run() error = %v, want not supported", err)
+	}
+}
+
+func TestDockerHookExecutor(t *testing.T) {
+	mock := docker.NewMockClient()
+	mock.ContainerExecCode = 1
+	x := NewDockerHookExecutor(mock)
+
+	code, err := x.ExecHook(context.Background(), HookExec{
+		Project: InstanceProject("ai-agents", "feature-x"),
+		Service: &config.Service{Name: "redis"},
+		Cmd:     []string{"redis-cli", "ping"},
+		Environ: []string{"A=1"},
+	})
+	if err != nil || code != 1 {
+		t.Fatalf("ExecHook() = %d, %v, want 1, nil", code, err)
+	}
+	if len(mock.ContainerExecCalls) != 1 {
+		t.Fatalf("ContainerExecCalls = %v, want one call", mock.ContainerExecCalls)
+	}
+	call := mock.ContainerExecCalls[0]
+	if call.ID != "ai-agents.feature-x-redis" {
+		t.Errorf("exec container = %q, want ai-agents.feature-x-redis", call.ID)
+	}
+	if diff := cmp.Diff([]string{"A=1"}, call.Opts.Env); diff != "" {
+		t.Errorf("exec env mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// fakeExecutor records pod execs.
+type fakeExecutor struct {
+	pods []string
+	cmds [][]string
+}
+
+func (f *fakeExecutor) Exec(ctx context.Context, namespace, pod, container string, cmd []string, stdout, stderr io.Writer) (int, error) {
+	f.pods = append(f.pods, namespace+"/"+pod)
+	f.cmds = append(f.cmds, cmd)
+	return 0, nil
+}
+
+func TestK8sHookExecutor(t *testing.T) {
+	job := readyPod("dev", "redis-job-a", "redis", true)
+	labels := job.GetLabels()
+	labels[LabelJob] = "seed"
+	job.SetLabels(labels)
+	client, _ := kubetest.NewFakeClient("dev",
+		readyPod("dev", "redis-0", "redis", false),
+		readyPod("dev", "redis-1", "redis", true),
+		job,
+		readyPod("dev", "app-0", "app", true),
+	)
+	exec := &fakeExecutor{}
+	x := NewK8sHookExecutor(client, exec)
+
+	_, err := x.ExecHook(context.Background(), HookExec{
+		Project: "ai-agents",
+		Env:     "dev",
+		Service: &config.Service{Name: "redis"},
+		Cmd:     []string{"redis-cli", "ping"},
+		Environ: []string{"A=1"},
+	})
+	if err != nil {
+		t.Fatalf("ExecHook() error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"dev/redis-1"}, exec.pods); diff != "" {
+		t.Errorf("pods mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([][]string{{"env", "A=1", "redis-cli", "ping"}}, exec.cmds); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = x.ExecHook(context.Background(), HookExec{Project: "ai-agents", Env: "dev", Service: &config.Service{Name: "worker"}})
+	if err == nil || !strings.Contains(err.Error(), "no ready pod") {
+		t.Errorf("ExecHook(worker) error = %v, want no ready pod", err)
+	}
+}
+
+func TestRunShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	var stdout bytes.Buffer
+	code, err := runShell(context.Background(), "echo $GREETING; exit 3", t.TempDir(), []string{"GREETING=hi"}, &stdout, io.Discard)
+	if err != nil || code != 3 {
+		t.Fatalf("runShell() = %d, %v, want 3, nil", code, err)
+	}
+	if stdout.String() != "hi\n" {
+		t.Errorf("stdout = %q, want hi", stdout.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := runShell(ctx, "sleep 5", t.TempDir(), nil, io.Discard, io.Discard); err == nil {
+		t.Error("runShell() after cancellation succeeded, want error")
+	}
+}
@@ -0,0 +1,152 @@
+package fleet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/platform"
+)
+
+// HostGateway is the Docker extra-hosts address of the machine running the
+// container engine. Forwards listening there are reachable from containers.
+const HostGateway = "host-gateway"
+
+// DefaultBridgeNetwork is the Docker network whose gateway address
+// HostGateway resolves to on Linux.
+const DefaultBridgeNetwork = "bridge"
+
+// HybridPlan splits a fleet between services started locally and the
+// services they require, which are forwarded from a remote environment.
+type HybridPlan struct {
+	Local  []*config.Service // Services to start locally, requires limited to local services
+	Remote []string          // Services required by Local but not local, in yar.yaml order
+}
+
+// PlanHybrid builds the plan for running the named services locally. Only
+// direct requirements become remote: a remote service's own dependencies
+// are the remote environment's concern.
+func PlanHybrid(services []*config.Service, local []string) (*HybridPlan, error) {
+	if _, err := Waves(services); err != nil {
+		return nil, err
+	}
+	if len(local) == 0 {
+		return nil, &errors.ValidationError{
+			Field:   "local-services",
+			Value:   local,
+			Message: "at least one local service is required",
+		}
+	}
+
+	byName := make(map[string]*config.Service, len(services))
+	for _, svc := range services {
+		byName[svc.Name] = svc
+	}
+	isLocal := make(map[string]bool, len(local))
+	for _, name := range local {
+		if byName[name] == nil {
+			return nil, &errors.ValidationError{
+				Field:   "local-services",
+				Value:   name,
+				Message: fmt.Sprintf("unknown service %q", name),
+			}
+		}
+		isLocal[name] = true
+	}
+
+	plan := &HybridPlan{}
+	isRemote := make(map[string]bool)
+	for _, svc := range services {
+		if !isLocal[svc.Name] {
+			continue
+		}
+		deps, err := Requirements(svc)
+		if err != nil {
+			return nil, err
+		}
+		copied := *svc
+		copied.Requires = nil
+		for _, dep := range deps {
+			if isLocal[dep] {
+				copied.Requires = append(copied.Requires, dep)
+			} else {
+				isRemote[dep] = true
+			}
+		}
+		plan.Local = append(plan.Local, &copied)
+	}
+	for _, svc := range services {
+		if isRemote[svc.Name] {
+			plan.Remote = append(plan.Remote, svc.Name)
+		}
+	}
+	return plan, nil
+}
+
+// ContainerHosts returns Docker extra-hosts entries ("name:host-gateway")
+// pointing the targets' in-cluster names at the container engine's host,
+// so env values such as REDIS_HOST=redis.ai-agents-redis resolve to the
+// forwarded ports from inside local containers. The forwards must listen
+// where HostGateway points; see HybridForwardAddress.
+func ContainerHosts(targets []ForwardTarget) []string {
+	names := ForwardHostnames(targets)
+	hosts := make([]string, len(names))
+	for i, name := range names {
+		hosts[i] = name + ":" + HostGateway
+	}
+	return hosts
+}
+
+// HybridForwardAddress returns the address hybrid forwards listen on so
+// containers reach them through HostGateway, and a warning for the user
+// if there is one. Docker Desktop routes HostGateway to the host's
+// loopback, so requested is kept. With a native Linux engine HostGateway
+// is the gateway address of DefaultBridgeNetwork, which a loopback
+// listener can't be reached on, so a loopback requested address is
+// replaced by gateway, or by 0.0.0.0 with a warning if the gateway is
+// unknown. Docker Desktop for Linux is not told apart from a native
+// engine.
+func HybridForwardAddress(goos platform.OS, requested, gateway string) (string, string) {
+	ip := net.ParseIP(requested)
+	if goos != platform.Linux || (requested != "localhost" && (ip == nil || !ip.IsLoopback())) {
+		return requested, ""
+	}
+	if gateway != "" {
+		return gateway, ""
+	}
+	return "0.0.0.0", "Docker bridge gateway unknown; forwarding on all interfaces (0.0.0.0), reachable from other machines"
+}
+
+// BridgeGateway returns the gateway address of DefaultBridgeNetwork, where
+// HostGateway points on Linux.
+func BridgeGateway(ctx context.Context, client docker.Client) (string, error) {
+	bridge, err := client.NetworkInspect(ctx, DefaultBridgeNetwork)
+	if err != nil {
+		return "", err
+	}
+	if bridge.IPAM != nil {
+		for _, cfg := range bridge.IPAM.Config {
+			if ip := net.ParseIP(cfg.Gateway); ip != nil && ip.To4() != nil {
+				return cfg.Gateway, nil
+			}
+		}
+	}
+	return "", NewFleetError("forward", DefaultBridgeNetwork, "network has no IPv4 gateway", nil)
+}
+
+// String returns a one-line summary of the plan.
+func (p *HybridPlan) String() string {
+	local := make([]string, len(p.Local))
+	for i, svc := range p.Local {
+		local[i] = svc.Name
+	}
+	remote := "none"
+	if len(p.Remote) > 0 {
+		remote = strings.Join(p.Remote, ", ")
+	}
+	return fmt.Sprintf("local: %s; remote: %s", strings.Join(local, ", "), remote)
+}
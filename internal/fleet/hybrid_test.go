@@ -0,0 +1,168 @@
+package fleet
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/platform"
+)
+
+func hybridServices() []*config.Service {
+	return []*config.Service{
+		{Name: "postgres"},
+		{Name: "redis"},
+		{Name: "api", Requires: []string{"postgres", "redis"}},
+		{Name: "worker", Requires: []string{"redis", "api"}},
+		{Name: "app", Requires: []string{"api", "worker"}},
+	}
+}
+
+func TestPlanHybrid(t *testing.T) {
+	services := hybridServices()
+	plan, err := PlanHybrid(services, []string{"app", "worker"})
+	if err != nil {
+		t.Fatalf("PlanHybrid() error = %v", err)
+	}
+
+	want := &HybridPlan{
+		Local: []*config.Service{
+			{Name: "worker"},
+			{Name: "app", Requires: []string{"worker"}},
+		},
+		Remote: []string{"redis", "api"},
+	}
+	if diff := cmp.Diff(want, plan); diff != "" {
+		t.Errorf("PlanHybrid() mismatch (-want +got):\n%s", diff)
+	}
+	if got := plan.String(); got != "local: worker, app; remote: redis, api" {
+		t.Errorf("String() = %q", got)
+	}
+
+	// The project's services are not modified.
+	if diff := cmp.Diff(hybridServices(), services); diff != "" {
+		t.Errorf("PlanHybrid() modified services (-want +got):\n%s", diff)
+	}
+
+	// Local waves only order local services.
+	waves, err := Waves(plan.Local)
+	if err != nil {
+		t.Fatalf("Waves(plan.Local) error = %v", err)
+	}
+	if len(waves) != 2 || waves[0][0].Name != "worker" || waves[1][0].Name != "app" {
+		t.Errorf("Waves(plan.Local) = %v", waves)
+	}
+}
+
+func TestPlanHybrid_EnvReferences(t *testing.T) {
+	services := []*config.Service{
+		{Name: "redis"},
+		{Name: "app", Env: map[string]string{"REDIS": `{{ endpoint "redis" }}`}},
+	}
+	plan, err := PlanHybrid(services, []string{"app"})
+	if err != nil {
+		t.Fatalf("PlanHybrid() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"redis"}, plan.Remote); diff != "" {
+		t.Errorf("Remote mismatch (-want +got):\n%s", diff)
+	}
+	if len(plan.Local) != 1 || len(plan.Local[0].Requires) != 0 {
+		t.Errorf("Local = %v, want app without requires", plan.Local)
+	}
+}
+
+func TestPlanHybrid_NoRemote(t *testing.T) {
+	plan, err := PlanHybrid(hybridServices(), []string{"postgres"})
+	if err != nil {
+		t.Fatalf("PlanHybrid() error = %v", err)
+	}
+	if len(plan.Remote) != 0 {
+		t.Errorf("Remote = %v, want none", plan.Remote)
+	}
+	if got := plan.String(); got != "local: postgres; remote: none" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestPlanHybrid_Errors(t *testing.T) {
+	tests := map[string]struct {
+		services []*config.Service
+		local    []string
+	}{
+		"no local services": {hybridServices(), nil},
+		"unknown service":   {hybridServices(), []string{"app", "nope"}},
+		"invalid fleet":     {[]*config.Service{{Name: "a", Requires: []string{"b"}}}, []string{"a"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := PlanHybrid(tc.services, tc.local)
+			var ve *errors.ValidationError
+			if !stderrors.As(err, &ve) {
+				t.Errorf("PlanHybrid() error = %v, want ValidationError", err)
+			}
+		})
+	}
+}
+
+func TestContainerHosts(t *testing.T) {
+	targets := []ForwardTarget{{Name: "redis", Namespace: "ai-agents-redis"}}
+	want := []string{
+		"redis.ai-agents-redis:host-gateway",
+		"redis.ai-agents-redis.svc:host-gateway",
+		"redis.ai-agents-redis.svc.cluster.local:host-gateway",
+	}
+	if diff := cmp.Diff(want, ContainerHosts(targets)); diff != "" {
+		t.Errorf("ContainerHosts() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHybridForwardAddress(t *testing.T) {
+	tests := map[string]struct {
+		goos               platform.OS
+		requested, gateway string
+		want               string
+		warn               bool
+	}{
+		"docker desktop":         {platform.Darwin, "127.0.0.1", "", "127.0.0.1", false},
+		"linux bridge gateway":   {platform.Linux, "127.0.0.1", "172.17.0.1", "172.17.0.1", false},
+		"linux localhost":        {platform.Linux, "localhost", "172.17.0.1", "172.17.0.1", false},
+		"linux gateway unknown":  {platform.Linux, "127.0.0.1", "", "0.0.0.0", true},
+		"linux address kept":     {platform.Linux, "10.0.0.2", "172.17.0.1", "10.0.0.2", false},
+		"linux all interfaces":   {platform.Linux, "0.0.0.0", "172.17.0.1", "0.0.0.0", false},
+		"windows loopback works": {platform.Windows, "127.0.0.1", "172.17.0.1", "127.0.0.1", false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, warning := HybridForwardAddress(tc.goos, tc.requested, tc.gateway)
+			if got != tc.want || (warning != "") != tc.warn {
+				t.Errorf("HybridForwardAddress() = %q, %q; want %q, warning %t", got, warning, tc.want, tc.warn)
+			}
+		})
+	}
+}
+
+func TestBridgeGateway(t *testing.T) {
+	client := docker.NewMockClient()
+	client.NetworkInspectResult = &docker.Network{Name: "bridge", IPAM: &docker.IPAM{Config: []docker.IPAMConfig{
+		{Subnet: "fd00::/64", Gateway: "fd00::1"},
+		{Subnet: "172.17.0.0/16", Gateway: "172.17.0.1"},
+	}}}
+	got, err := BridgeGateway(context.Background(), client)
+	if err != nil || got != "172.17.0.1" {
+		t.Errorf("BridgeGateway() = %q, %v; want 172.17.0.1", got, err)
+	}
+	if diff := cmp.Diff([]string{DefaultBridgeNetwork}, client.NetworkInspectCalls); diff != "" {
+		t.Errorf("NetworkInspect calls mismatch (-want +got):\n%s", diff)
+	}
+
+	client.NetworkInspectResult = &docker.Network{Name: "bridge"}
+	if _, err := BridgeGateway(context.Background(), client); err == nil {
+		t.Error("BridgeGateway() error = nil for a network without a gateway")
+	}
+}
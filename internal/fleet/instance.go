@@ -0,0 +1,209 @@
+package fleet
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+const (
+	// InstanceSeparator joins a project name and an instance name into the
+	// name the instance's resources are labeled, named and recorded under.
+	// Project and instance names cannot contain it, so the join is
+	// reversible.
+	InstanceSeparator = "."
+
+	// MaxInstanceLength bounds instance names, which become part of
+	// container, network, volume and host names.
+	MaxInstanceLength = 30
+
+	// instancePortStep and instancePortSlots spread the host ports of
+	// instances: an instance's ports are offset by a multiple of
+	// instancePortStep chosen from its name.
+	instancePortStep  = 1000
+	instancePortSlots = 20
+)
+
+// ValidateInstance checks that name can be used as an instance name: it
+// must match ^[a-z][a-z0-9-]*$ and be at most MaxInstanceLength long.
+func ValidateInstance(name string) error {
+	valid := name != "" && len(name) <= MaxInstanceLength && name[0] >= 'a' && name[0] <= 'z'
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			valid = false
+		}
+	}
+	if !valid {
+		return &errors.ValidationError{
+			Field:   "instance",
+			Value:   name,
+			Message: fmt.Sprintf("instance names must match ^[a-z][a-z0-9-]*$ and be at most %d characters", MaxInstanceLength),
+		}
+	}
+	return nil
+}
+
+// InstanceFromBranch derives an instance name from a git branch name:
+// feature/ABC-123 becomes feature-abc-123. It returns "" if the branch
+// yields no usable name.
+func InstanceFromBranch(branch string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(branch) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			b.WriteRune(c)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	name := b.String()
+	if name != "" && (name[0] < 'a' || name[0] > 'z') {
+		name = "b-" + name
+	}
+	if len(name) > MaxInstanceLength {
+		name = name[:MaxInstanceLength]
+	}
+	return strings.TrimRight(name, "-")
+}
+
+// InstanceProject returns the name an instance of project runs as. The
+// default instance, "", runs as the project itself; instance feature-x of
+// ai-agents runs as ai-agents.feature-x. Every fleet operation takes this
+// name as its project, so labels, container and job names, state records,
+// snapshots and locks are all kept apart per instance.
+func InstanceProject(project, instance string) string {
+	if instance == "" {
+		return project
+	}
+	return project + InstanceSeparator + instance
+}
+
+// SplitInstanceProject splits a name returned by InstanceProject into the
+// project and instance names.
+func SplitInstanceProject(name string) (project, instance string) {
+	project, instance, _ = strings.Cut(name, InstanceSeparator)
+	return project, instance
+}
+
+// ContainerName returns the name of a service's container for project, as
+// returned by InstanceProject.
+func ContainerName(project, service string) string {
+	return project + "-" + service
+}
+
+// NetworkName returns the Docker network project, as returned by
+// InstanceProject, runs on. The default instance uses the configured
+// network; other instances get their own, such as
+// yar-net.ai-agents.feature-x. Inside it, services keep their plain
+// hostnames as aliases, so env wiring such as
+// REDIS_HOST: redis.ai-agents-redis works unchanged in every instance.
+func NetworkName(network, project string) string {
+	if _, instance := SplitInstanceProject(project); instance == "" {
+		return network
+	}
+	return network + InstanceSeparator + project
+}
+
+// ServiceHostname returns the name a service of project, as returned by
+// InstanceProject, resolves as: <service>.<namespace>, the namespace
+// defaulting to the project name. Instances insert their name before the
+// namespace, as in redis.feature-x.ai-agents-redis.
+func ServiceHostname(project string, svc *config.Service) string {
+	base, instance := SplitInstanceProject(project)
+	namespace := svc.Namespace
+	if namespace == "" {
+		namespace = base
+	}
+	if instance == "" {
+		return svc.Name + "." + namespace
+	}
+	return svc.Name + "." + instance + "." + namespace
+}
+
+// HostPort maps a host port declared in yar.yaml to the port project, as
+// returned by InstanceProject, publishes on. The default instance uses
+// ports unchanged. Other instances shift all their ports by the same
+// multiple of 1000, chosen from the instance name, so ports keep their
+// last digits and don't clash with the default instance; ports that would
+// pass 65535 are shifted down instead.
+func HostPort(project string, port int) int {
+	_, instance := SplitInstanceProject(project)
+	if instance == "" {
+		return port
+	}
+	h := fnv.New32a()
+	h.Write([]byte(instance))
+	offset := instancePortStep * (1 + int(h.Sum32()%instancePortSlots))
+	if port+offset > 65535 {
+		return port - offset
+	}
+	return port + offset
+}
+
+// PortMapping is a port a service declares in its params.
+type PortMapping struct {
+	Container int // Port inside the container
+	Host      int // Published host port, mapped by HostPort; 0 if not published
+}
+
+// ServicePorts returns the ports svc declares for project, as returned by
+// InstanceProject: the containerPort/hostPort entries of params.ports, or
+// else params.port.
+func ServicePorts(project string, svc *config.Service) []PortMapping {
+	var mappings []PortMapping
+	ports, _ := svc.Params["ports"].([]any)
+	for _, p := range ports {
+		port, _ := p.(map[string]any)
+		container, ok := port["containerPort"].(int)
+		if !ok {
+			continue
+		}
+		m := PortMapping{Container: container}
+		if host, ok := port["hostPort"].(int); ok {
+			m.Host = HostPort(project, host)
+		}
+		mappings = append(mappings, m)
+	}
+	if port, ok := svc.Params["port"].(int); ok && len(mappings) == 0 {
+		mappings = append(mappings, PortMapping{Container: port})
+	}
+	return mappings
+}
+
+// ListInstances returns the instances of project with containers in env,
+// sorted by name. The default instance is listed as "".
+func ListInstances(ctx context.Context, client docker.Client, project, env string) ([]string, error) {
+	containers, err := client.ContainerList(ctx, docker.ContainerListOptions{
+		All: true,
+		Filters: map[string][]string{
+			"label": {
+				LabelManaged + "=true",
+				LabelEnvironment + "=" + env,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var instances []string
+	for _, c := range containers {
+		base, instance := SplitInstanceProject(c.Labels[LabelProject])
+		if base != project || seen[instance] {
+			continue
+		}
+		seen[instance] = true
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+	return instances, nil
+}
@@ -0,0 +1,153 @@
+package fleet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+func TestValidateInstance(t *testing.T) {
+	for _, name := range []string{"feature-x", "pr-42", "a"} {
+		if err := ValidateInstance(name); err != nil {
+			t.Errorf("ValidateInstance(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "Feature", "42", "feature.x", "feature/x", "a-very-long-instance-name-over-30"} {
+		if _, ok := ValidateInstance(name).(*errors.ValidationError); !ok {
+			t.Errorf("ValidateInstance(%q) did not return a ValidationError", name)
+		}
+	}
+}
+
+func TestInstanceFromBranch(t *testing.T) {
+	tests := map[string]string{
+		"feature-x":                             "feature-x",
+		"feature/ABC-123":                       "feature-abc-123",
+		"fix//double__sep":                      "fix-double-sep",
+		"123-hotfix":                            "b-123-hotfix",
+		"users/sam/a-really-long-branch-name-x": "users-sam-a-really-long-branch",
+		"///":                                   "",
+	}
+	for branch, want := range tests {
+		got := InstanceFromBranch(branch)
+		if got != want {
+			t.Errorf("InstanceFromBranch(%q) = %q, want %q", branch, got, want)
+		}
+		if got != "" {
+			if err := ValidateInstance(got); err != nil {
+				t.Errorf("InstanceFromBranch(%q) = %q is not a valid instance: %v", branch, got, err)
+			}
+		}
+	}
+}
+
+func TestInstanceProject(t *testing.T) {
+	if got := InstanceProject("ai-agents", ""); got != "ai-agents" {
+		t.Errorf("InstanceProject(default) = %q, want ai-agents", got)
+	}
+	name := InstanceProject("ai-agents", "feature-x")
+	if name != "ai-agents.feature-x" {
+		t.Errorf("InstanceProject() = %q, want ai-agents.feature-x", name)
+	}
+	if project, instance := SplitInstanceProject(name); project != "ai-agents" || instance != "feature-x" {
+		t.Errorf("SplitInstanceProject(%q) = %q, %q", name, project, instance)
+	}
+	if project, instance := SplitInstanceProject("ai-agents"); project != "ai-agents" || instance != "" {
+		t.Errorf("SplitInstanceProject(default) = %q, %q", project, instance)
+	}
+}
+
+func TestLabels_Instance(t *testing.T) {
+	want := map[string]string{
+		LabelManaged:     "true",
+		LabelProject:     "ai-agents.feature-x",
+		LabelEnvironment: "local",
+		LabelService:     "redis",
+		LabelInstance:    "feature-x",
+	}
+	if diff := cmp.Diff(want, Labels(InstanceProject("ai-agents", "feature-x"), "local", "redis")); diff != "" {
+		t.Errorf("Labels() mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := Labels("ai-agents", "local", "redis")[LabelInstance]; ok {
+		t.Error("Labels() of the default instance has an instance label")
+	}
+}
+
+func TestServiceHostname(t *testing.T) {
+	redis := &config.Service{Name: "redis", Namespace: "ai-agents-redis"}
+	app := &config.Service{Name: "app"}
+
+	tests := []struct {
+		project string
+		svc     *config.Service
+		want    string
+	}{
+		{"ai-agents", redis, "redis.ai-agents-redis"},
+		{"ai-agents", app, "app.ai-agents"},
+		{"ai-agents.feature-x", redis, "redis.feature-x.ai-agents-redis"},
+		{"ai-agents.feature-x", app, "app.feature-x.ai-agents"},
+	}
+	for _, tt := range tests {
+		if got := ServiceHostname(tt.project, tt.svc); got != tt.want {
+			t.Errorf("ServiceHostname(%q, %s) = %q, want %q", tt.project, tt.svc.Name, got, tt.want)
+		}
+	}
+}
+
+func TestNetworkName(t *testing.T) {
+	if got := NetworkName("yar-net", "ai-agents"); got != "yar-net" {
+		t.Errorf("NetworkName(default) = %q, want yar-net", got)
+	}
+	if got := NetworkName("yar-net", "ai-agents.feature-x"); got != "yar-net.ai-agents.feature-x" {
+		t.Errorf("NetworkName(instance) = %q, want yar-net.ai-agents.feature-x", got)
+	}
+}
+
+func TestHostPort(t *testing.T) {
+	if got := HostPort("ai-agents", 6379); got != 6379 {
+		t.Errorf("HostPort(default, 6379) = %d, want 6379", got)
+	}
+
+	project := InstanceProject("ai-agents", "feature-x")
+	redis, app := HostPort(project, 6379), HostPort(project, 8080)
+	if redis == 6379 || redis%1000 != 379 {
+		t.Errorf("HostPort(instance, 6379) = %d, want 6379 shifted by a multiple of 1000", redis)
+	}
+	if app-8080 != redis-6379 {
+		t.Errorf("ports shifted unevenly: 6379 -> %d, 8080 -> %d", redis, app)
+	}
+	if got := HostPort(project, 6379); got != redis {
+		t.Errorf("HostPort() not stable: %d then %d", redis, got)
+	}
+	if got := HostPort(project, 65000); got < 1024 || got > 65535 || got == 65000 {
+		t.Errorf("HostPort(instance, 65000) = %d, want a shifted valid port", got)
+	}
+}
+
+func TestListInstances(t *testing.T) {
+	mock := docker.NewMockClient()
+	mock.ContainerListResult = []docker.Container{
+		{ID: "1", Labels: Labels("ai-agents", "local", "redis")},
+		{ID: "2", Labels: Labels(InstanceProject("ai-agents", "feature-x"), "local", "redis")},
+		{ID: "3", Labels: Labels(InstanceProject("ai-agents", "feature-x"), "local", "app")},
+		{ID: "4", Labels: Labels(InstanceProject("ai-agents", "bugfix"), "local", "redis")},
+		{ID: "5", Labels: Labels("ai-agents-web", "local", "redis")},
+	}
+
+	got, err := ListInstances(context.Background(), mock, "ai-agents", "local")
+	if err != nil {
+		t.Fatalf("ListInstances() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"", "bugfix", "feature-x"}, got); diff != "" {
+		t.Errorf("ListInstances() mismatch (-want +got):\n%s", diff)
+	}
+	want := []string{LabelManaged + "=true", LabelEnvironment + "=local"}
+	if diff := cmp.Diff(want, mock.ContainerListCalls[0].Filters["label"]); diff != "" {
+		t.Errorf("ContainerList label filters mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,292 @@
+package fleet
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/kubernetes"
+)
+
+const (
+	// LabelJob marks containers and Kubernetes Jobs run for a service job.
+	LabelJob = "yar.job"
+
+	// AnnotationJobPhase records a rendered Job's phase (config.JobBefore
+	// or config.JobAfter) so K8sDriver can order it around its service.
+	AnnotationJobPhase = "yar.job-phase"
+)
+
+// JobRunner runs service jobs to completion. Drivers that support jobs
+// implement it alongside ServiceDriver.
+type JobRunner interface {
+	// RunJob runs job once and returns an error unless it exits with code 0.
+	RunJob(ctx context.Context, svc *config.Service, job *config.Job) error
+}
+
+// JobResult describes one job considered by Apply.
+type JobResult struct {
+	Service string
+	Job     string
+	Hash    string // Hash of the job spec and its inputs
+	Skipped bool   // Not run: run policy onChange and nothing changed
+}
+
+// JobKey identifies a job within a project.
+func JobKey(service, job string) string {
+	return service + "/" + job
+}
+
+// HashJob returns a content hash of a job's spec and the contents of the
+// files matched by its inputs, which are resolved relative to dir. An input
+// that matches no file is a validation error, so a typo cannot silently
+// stop a job from re-running.
+func HashJob(job *config.Job, dir string) (string, error) {
+	type input struct {
+		Path    string
+		Content []byte
+	}
+	var inputs []input
+	for _, pattern := range job.Inputs {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil || len(matches) == 0 {
+			return "", &errors.ValidationError{
+				Field:   "jobs.inputs",
+				Value:   pattern,
+				Message: fmt.Sprintf("job %q input matches no files", job.Name),
+			}
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			content, err := os.ReadFile(m)
+			if err != nil {
+				return "", ErrJob(job.Name, err)
+			}
+			rel, _ := filepath.Rel(dir, m)
+			inputs = append(inputs, input{Path: filepath.ToSlash(rel), Content: content})
+		}
+	}
+
+	return HashConfig(struct {
+		Job    *config.Job
+		Inputs []input
+	}{job, inputs})
+}
+
+// DockerJobRunner runs jobs as one-shot containers labelled with the fleet
+// labels and LabelJob. Successful job containers are removed; failed ones
+// are kept so their logs can be inspected.
+type DockerJobRunner struct {
+	client  docker.Client
+	project string
+	env     string
+	network string
+}
+
+// DockerJobOption configures a DockerJobRunner.
+type DockerJobOption func(*DockerJobRunner)
+
+// WithJobNetwork attaches job containers to a network so they can reach
+// the fleet's services by name.
+func WithJobNetwork(network string) DockerJobOption {
+	return func(r *DockerJobRunner) {
+		r.network = network
+	}
+}
+
+// NewDockerJobRunner creates a job runner for a project environment.
+func NewDockerJobRunner(client docker.Client, project, env string, opts ...DockerJobOption) *DockerJobRunner {
+	r := &DockerJobRunner{
+		client:  client,
+		project: project,
+		env:     env,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// ContainerName returns the name of a job's container.
+func (r *DockerJobRunner) ContainerName(svc *config.Service, job *config.Job) string {
+	return ContainerName(r.project, svc.Name) + "-job-" + job.Name
+}
+
+// RunJob implements JobRunner. A container left over from a previous
+// failed run is replaced.
+func (r *DockerJobRunner) RunJob(ctx context.Context, svc *config.Service, job *config.Job) error {
+	name := r.ContainerName(svc, job)
+	key := JobKey(svc.Name, job.Name)
+
+	if err := r.client.ContainerRemove(ctx, name); err != nil {
+		return ErrJob(key, err)
+	}
+
+	labels := Labels(r.project, r.env, svc.Name)
+	labels[LabelJob] = job.Name
+	env := make([]string, 0, len(job.Env))
+	for k, v := range job.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+
+	id, err := createContainer(ctx, r.client, docker.ContainerCreateOptions{
+		Name:    name,
+		Image:   job.Image,
+		Cmd:     job.Command,
+		Env:     env,
+		Labels:  labels,
+		Network: r.network,
+	})
+	if err != nil {
+		return ErrJob(key, err)
+	}
+	if err := r.client.ContainerStart(ctx, id); err != nil {
+		return ErrJob(key, err)
+	}
+	code, err := r.client.ContainerWait(ctx, id)
+	if err != nil {
+		return ErrJob(key, err)
+	}
+	if code != 0 {
+		return ErrJob(key, fmt.Errorf("exited with code %d; see 'docker logs %s'", code, name))
+	}
+	if err := r.client.ContainerRemove(context.WithoutCancel(ctx), id); err != nil {
+		return ErrJob(key, err)
+	}
+	return nil
+}
+
+// JobManifestOptions configures JobManifest.
+type JobManifestOptions struct {
+	Namespace string // Namespace of the Job; the client default when empty
+	Hash      string // HashJob result; names onChange jobs so a change creates a new Job
+	RunID     string // Suffix naming always-run jobs so every up creates a new Job
+	Helm      bool   // Add Helm hook annotations for chart output
+	Weight    int    // Helm hook weight; jobs of earlier dependency waves get lower weights
+}
+
+// JobManifest renders a service job as a Kubernetes Job. Jobs are
+// immutable, so the name carries the input hash (onChange) or a run ID
+// (always); Jobs of earlier runs are pruned by label like other objects.
+//
+// With opts.Helm the Job becomes a hook. Helm runs pre-install hooks before
+// any chart resource exists, so only before-jobs of services without
+// requirements are pre-install hooks; the rest run post-install, ordered by
+// weight.
+func JobManifest(project, env string, svc *config.Service, job *config.Job, opts JobManifestOptions) *unstructured.Unstructured {
+	name := svc.Name + "-" + job.Name
+	switch {
+	case job.RunPolicy() == config.JobRunOnChange && opts.Hash != "":
+		name += "-" + shortHash(opts.Hash)
+	case job.RunPolicy() == config.JobRunAlways && opts.RunID != "":
+		name += "-" + opts.RunID
+	}
+
+	labels := Labels(project, env, svc.Name)
+	labels[LabelJob] = job.Name
+
+	container := map[string]any{
+		"name":  job.Name,
+		"image": job.Image,
+	}
+	if len(job.Command) > 0 {
+		command := make([]any, len(job.Command))
+		for i, c := range job.Command {
+			command[i] = c
+		}
+		container["command"] = command
+	}
+	if len(job.Env) > 0 {
+		keys := make([]string, 0, len(job.Env))
+		for k := range job.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		env := make([]any, len(keys))
+		for i, k := range keys {
+			env[i] = map[string]any{"name": k, "value": job.Env[k]}
+		}
+		container["env"] = env
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"spec": map[string]any{
+			"backoffLimit": int64(0),
+			"template": map[string]any{
+				"spec": map[string]any{
+					"restartPolicy": "Never",
+					"containers":    []any{container},
+				},
+			},
+		},
+	}}
+	obj.SetGroupVersionKind(kubernetes.JobKind)
+	obj.SetName(name)
+	obj.SetNamespace(opts.Namespace)
+	obj.SetLabels(labels)
+	_ = unstructured.SetNestedStringMap(obj.Object, labels, "spec", "template", "metadata", "labels")
+
+	annotations := map[string]string{AnnotationJobPhase: job.Phase()}
+	if opts.Helm {
+		hook := "post-install,post-upgrade"
+		if job.Phase() == config.JobBefore && len(svc.Requires) == 0 {
+			hook = "pre-install,pre-upgrade"
+		}
+		annotations["helm.sh/hook"] = hook
+		annotations["helm.sh/hook-weight"] = fmt.Sprint(opts.Weight)
+		annotations["helm.sh/hook-delete-policy"] = "before-hook-creation"
+	}
+	obj.SetAnnotations(annotations)
+	return obj
+}
+
+// jobComplete reports whether a Kubernetes Job has succeeded. A failed Job
+// is an error carrying the failure reason.
+func jobComplete(obj *unstructured.Unstructured) (bool, error) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]any)
+		if !ok || cond["status"] != "True" {
+			continue
+		}
+		switch cond["type"] {
+		case "Complete":
+			return true, nil
+		case "Failed":
+			return false, stderrors.New(strings.TrimSpace(fmt.Sprintf("%v: %v", cond["reason"], cond["message"])))
+		}
+	}
+	return false, nil
+}
+
+// createContainer creates a container, pulling its image once if the
+// first attempt fails.
+func createContainer(ctx context.Context, client docker.Client, opts docker.ContainerCreateOptions) (string, error) {
+	id, err := client.ContainerCreate(ctx, opts)
+	if err == nil {
+		return id, nil
+	}
+	if perr := client.ImagePull(ctx, opts.Image); perr != nil {
+		return "", stderrors.Join(err, perr)
+	}
+	return client.ContainerCreate(ctx, opts)
+}
+
+// shortHash returns the first 8 hex digits of a HashConfig result.
+func shortHash(hash string) string {
+	hash = strings.TrimPrefix(hash, "sha256:")
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
@@ -0,0 +1,405 @@
+package fleet
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	sigyaml "sigs.k8s.io/yaml"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/kubernetes/kubetest"
+)
+
+func migrateJob() *config.Job {
+	return &config.Job{
+		Name:    "migrate",
+		Image:   "ai-agents/app:latest",
+		Command: []string{"alembic", "upgrade", "head"},
+		Env:     map[string]string{"DB_HOST": "db", "A": "1"},
+	}
+}
+
+func TestHashJob(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "migrations"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, "migrations", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("001.sql", "create table a;")
+
+	job := migrateJob()
+	job.Run = config.JobRunOnChange
+	job.Inputs = []string{"migrations/*.sql"}
+
+	first, err := HashJob(job, dir)
+	if err != nil {
+		t.Fatalf("HashJob() error = %v", err)
+	}
+	if again, _ := HashJob(job, dir); again != first {
+		t.Errorf("HashJob() not stable: %s != %s", again, first)
+	}
+
+	write("002.sql", "create table b;")
+	added, _ := HashJob(job, dir)
+	if added == first {
+		t.Error("HashJob() unchanged after adding an input file")
+	}
+
+	job.Command = []string{"alembic", "upgrade", "+1"}
+	if changed, _ := HashJob(job, dir); changed == added {
+		t.Error("HashJob() unchanged after changing the command")
+	}
+
+	job.Inputs = []string{"migratons/*.sql"}
+	_, err = HashJob(job, dir)
+	var verr *errors.ValidationError
+	if !stderrors.As(err, &verr) {
+		t.Errorf("HashJob() with unmatched input error = %v, want ValidationError", err)
+	}
+}
+
+func TestDockerJobRunner(t *testing.T) {
+	ctx := context.Background()
+	svc := &config.Service{Name: "app"}
+
+	t.Run("success", func(t *testing.T) {
+		mock := docker.NewMockClient()
+		r := NewDockerJobRunner(mock, "ai-agents", "local", WithJobNetwork("yar-net"))
+
+		if err := r.RunJob(ctx, svc, migrateJob()); err != nil {
+			t.Fatalf("RunJob() error = %v", err)
+		}
+
+		labels := Labels("ai-agents", "local", "app")
+		labels[LabelJob] = "migrate"
+		want := []docker.ContainerCreateOptions{{
+			Name:    "ai-agents-app-job-migrate",
+			Image:   "ai-agents/app:latest",
+			Cmd:     []string{"alembic", "upgrade", "head"},
+			Env:     []string{"A=1", "DB_HOST=db"},
+			Labels:  labels,
+			Network: "yar-net",
+		}}
+		if diff := cmp.Diff(want, mock.ContainerCreateCalls); diff != "" {
+			t.Errorf("ContainerCreate calls mismatch (-want +got):\n%s", diff)
+		}
+		// A leftover container is removed by name first; the finished one by ID.
+		if diff := cmp.Diff([]string{"ai-agents-app-job-migrate", "mock-container-1"}, mock.ContainerRemoveCalls); diff != "" {
+			t.Errorf("ContainerRemove calls mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("non-zero exit", func(t *testing.T) {
+		mock := docker.NewMockClient()
+		mock.ContainerWaitCode = 3
+		r := NewDockerJobRunner(mock, "ai-agents", "local")
+
+		err := r.RunJob(ctx, svc, migrateJob())
+		var ferr *FleetError
+		if !stderrors.As(err, &ferr) || ferr.Op != "job" || ferr.Name != "app/migrate" {
+			t.Fatalf("RunJob() error = %v, want job FleetError for app/migrate", err)
+		}
+		if !strings.Contains(err.Error(), "exited with code 3") {
+			t.Errorf("RunJob() error = %v, want exit code", err)
+		}
+		// The failed container is kept for inspection.
+		if diff := cmp.Diff([]string{"ai-agents-app-job-migrate"}, mock.ContainerRemoveCalls); diff != "" {
+			t.Errorf("ContainerRemove calls mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestJobManifest(t *testing.T) {
+	job := migrateJob()
+	job.Run = config.JobRunOnChange
+	svc := &config.Service{Name: "app", Requires: []string{"db"}}
+
+	obj := JobManifest("ai-agents", "dev", svc, job, JobManifestOptions{
+		Namespace: "agents",
+		Hash:      "sha256:0123456789abcdef",
+	})
+	data, err := sigyaml.Marshal(obj.Object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: batch/v1
+kind: Job
+metadata:
+  annotations:
+    yar.job-phase: before
+  labels:
+    yar.environment: dev
+    yar.job: migrate
+    yar.managed: "true"
+    yar.project: ai-agents
+    yar.service: app
+  name: app-migrate-01234567
+  namespace: agents
+spec:
+  backoffLimit: 0
+  template:
+    metadata:
+      labels:
+        yar.environment: dev
+        yar.job: migrate
+        yar.managed: "true"
+        yar.project: ai-agents
+        yar.service: app
+    spec:
+      containers:
+      - command:
+        - alembic
+        - upgrade
+        - head
+        env:
+        - name: A
+          value: "1"
+        - name: DB_HOST
+          value: db
+        image: ai-agents/app:latest
+        name: migrate
+      restartPolicy: Never
+`
+	if diff := cmp.Diff(want, string(data)); diff != "" {
+		t.Errorf("JobManifest() mismatch (-want +got):\n%s", diff)
+	}
+
+	tests := map[string]struct {
+		svc      *config.Service
+		when     string
+		wantHook string
+	}{
+		"before without requirements": {&config.Service{Name: "db"}, config.JobBefore, "pre-install,pre-upgrade"},
+		"before with requirements":    {svc, config.JobBefore, "post-install,post-upgrade"},
+		"after":                       {&config.Service{Name: "db"}, config.JobAfter, "post-install,post-upgrade"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			job := migrateJob()
+			job.When = tt.when
+			obj := JobManifest("ai-agents", "dev", tt.svc, job, JobManifestOptions{Helm: true, Weight: 2, RunID: "r1"})
+			annotations := obj.GetAnnotations()
+			if annotations["helm.sh/hook"] != tt.wantHook || annotations["helm.sh/hook-weight"] != "2" {
+				t.Errorf("hook annotations = %v, want hook %s weight 2", annotations, tt.wantHook)
+			}
+			if want := tt.svc.Name + "-migrate-r1"; obj.GetName() != want {
+				t.Errorf("name = %s, want %s", obj.GetName(), want)
+			}
+		})
+	}
+}
+
+func TestJobComplete(t *testing.T) {
+	job := func(conditions ...map[string]any) *unstructured.Unstructured {
+		list := make([]any, len(conditions))
+		for i, c := range conditions {
+			list[i] = c
+		}
+		return &unstructured.Unstructured{Object: map[string]any{"status": map[string]any{"conditions": list}}}
+	}
+
+	if done, err := jobComplete(job()); done || err != nil {
+		t.Errorf("running job = %v, %v; want false, nil", done, err)
+	}
+	if done, err := jobComplete(job(map[string]any{"type": "Complete", "status": "True"})); !done || err != nil {
+		t.Errorf("complete job = %v, %v; want true, nil", done, err)
+	}
+	_, err := jobComplete(job(map[string]any{"type": "Failed", "status": "True", "reason": "BackoffLimitExceeded", "message": "Job has reached the specified backoff limit"}))
+	if err == nil || !strings.Contains(err.Error(), "BackoffLimitExceeded") {
+		t.Errorf("failed job error = %v, want BackoffLimitExceeded", err)
+	}
+}
+
+// jobDriver is a fakeDriver that runs jobs, logging every step in order.
+type jobDriver struct {
+	fakeDriver
+	logMu   sync.Mutex
+	log     []string
+	failJob string
+}
+
+func (d *jobDriver) record(event string) {
+	d.logMu.Lock()
+	defer d.logMu.Unlock()
+	d.log = append(d.log, event)
+}
+
+func (d *jobDriver) Start(ctx context.Context, svc *config.Service) ([]Resource, error) {
+	d.record("start " + svc.Name)
+	return d.fakeDriver.Start(ctx, svc)
+}
+
+func (d *jobDriver) RunJob(ctx context.Context, svc *config.Service, job *config.Job) error {
+	d.record("job " + JobKey(svc.Name, job.Name))
+	if JobKey(svc.Name, job.Name) == d.failJob {
+		return ErrJob(d.failJob, stderrors.New("exited with code 1"))
+	}
+	return nil
+}
+
+func jobServices() []*config.Service {
+	return []*config.Service{
+		{Name: "db", Jobs: []*config.Job{{Name: "seed", Image: "db", When: config.JobAfter}}},
+		{Name: "app", Requires: []string{"db"}, Jobs: []*config.Job{
+			{Name: "migrate", Image: "app", Run: config.JobRunOnChange},
+		}},
+	}
+}
+
+func TestApply_Jobs(t *testing.T) {
+	ctx := context.Background()
+
+	d := &jobDriver{}
+	result, err := Apply(ctx, d, jobServices(), ApplyOptions{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	want := []string{"start db", "job db/seed", "job app/migrate", "start app"}
+	if diff := cmp.Diff(want, d.log); diff != "" {
+		t.Errorf("step order mismatch (-want +got):\n%s", diff)
+	}
+	if len(result.Jobs) != 2 || result.Jobs[1].Hash == "" {
+		t.Fatalf("Jobs = %+v, want two hashed results", result.Jobs)
+	}
+
+	// An unchanged onChange job is skipped; always-run jobs run again.
+	completed := map[string]string{JobKey("app", "migrate"): result.Jobs[1].Hash}
+	d = &jobDriver{}
+	result, err = Apply(ctx, d, jobServices(), ApplyOptions{Dir: t.TempDir(), CompletedJobs: completed})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{"start db", "job db/seed", "start app"}, d.log); diff != "" {
+		t.Errorf("step order mismatch (-want +got):\n%s", diff)
+	}
+	if !result.Jobs[1].Skipped {
+		t.Errorf("Jobs[1] = %+v, want skipped", result.Jobs[1])
+	}
+}
+
+func TestApply_JobFailureStopsService(t *testing.T) {
+	d := &jobDriver{failJob: "app/migrate"}
+	result, err := Apply(context.Background(), d, jobServices(), ApplyOptions{Dir: t.TempDir()})
+
+	var ferr *FleetError
+	if !stderrors.As(err, &ferr) || ferr.Op != "job" {
+		t.Fatalf("Apply() error = %v, want job FleetError", err)
+	}
+	if diff := cmp.Diff([]string{"start db", "job db/seed", "job app/migrate"}, d.log); diff != "" {
+		t.Errorf("step order mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"db"}, result.Ready); diff != "" {
+		t.Errorf("Ready mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestApply_JobsUnsupported(t *testing.T) {
+	_, err := Apply(context.Background(), &fakeDriver{}, jobServices(), ApplyOptions{Dir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "does not support jobs") {
+		t.Errorf("Apply() error = %v, want unsupported jobs error", err)
+	}
+}
+
+// jobController completes (or fails) Jobs on every get, standing in for
+// the cluster's job controller.
+func jobController(dyn *dynamicfake.FakeDynamicClient, status string) {
+	dyn.PrependReactor("get", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetActionImpl)
+		obj, err := dyn.Tracker().Get(get.GetResource(), get.GetNamespace(), get.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return true, nil, err
+		}
+		u := obj.(*unstructured.Unstructured).DeepCopy()
+		conditions := []any{map[string]any{"type": status, "status": "True", "reason": "BackoffLimitExceeded"}}
+		_ = unstructured.SetNestedSlice(u.Object, conditions, "status", "conditions")
+		return true, u, nil
+	})
+}
+
+func jobManifests(t *testing.T) (*config.Project, ManifestRenderer) {
+	t.Helper()
+	project := &config.Project{
+		Project: "ai-agents",
+		Services: []*config.Service{
+			{Name: "db"},
+			{Name: "app", Requires: []string{"db"}, Jobs: []*config.Job{migrateJob()}},
+		},
+	}
+	deployment := func(name string) string {
+		return `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ` + name + `
+  labels:
+    yar.service: ` + name + `
+spec:
+  replicas: 1
+`
+	}
+	job, err := sigyaml.Marshal(JobManifest("ai-agents", "dev", project.Services[1], migrateJob(), JobManifestOptions{}).Object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := deployment("app") + "---\n" + string(job) + "---\n" + deployment("db")
+	return project, staticManifests(data)
+}
+
+func TestK8sDriver_UpRunsJobsBetweenWaves(t *testing.T) {
+	ctx := context.Background()
+	client, dyn := kubetest.NewFakeClient("dev")
+	rolloutController(dyn)
+	jobController(dyn, "Complete")
+	project, renderer := jobManifests(t)
+	d := newTestK8sDriver(client, WithManifestRenderer(renderer))
+
+	if err := d.Up(ctx, project, "dev", UpOptions{}); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	var order []string
+	for _, action := range dyn.Actions() {
+		if patch, ok := action.(k8stesting.PatchActionImpl); ok {
+			order = append(order, patch.GetResource().Resource+"/"+patch.GetName())
+		}
+	}
+	want := []string{"deployments/db", "jobs/app-migrate", "deployments/app"}
+	if diff := cmp.Diff(want, order); diff != "" {
+		t.Errorf("apply order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestK8sDriver_UpJobFailure(t *testing.T) {
+	ctx := context.Background()
+	client, dyn := kubetest.NewFakeClient("dev")
+	rolloutController(dyn)
+	jobController(dyn, "Failed")
+	project, renderer := jobManifests(t)
+	d := newTestK8sDriver(client, WithManifestRenderer(renderer))
+
+	err := d.Up(ctx, project, "dev", UpOptions{})
+	var ferr *FleetError
+	if !stderrors.As(err, &ferr) || ferr.Op != "job" || ferr.Name != "app/migrate" {
+		t.Fatalf("Up() error = %v, want job FleetError for app/migrate", err)
+	}
+	if _, err := client.Get(ctx, kubernetes.DeploymentKind, "dev", "app"); !kubernetes.IsNotFound(err) {
+		t.Errorf("app deployment applied after its job failed (err = %v)", err)
+	}
+}
@@ -0,0 +1,925 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/kubernetes"
+)
+
+const (
+	// DefaultRolloutTimeout bounds how long Up and Restart wait for the
+	// rollouts, or jobs, of one step.
+	DefaultRolloutTimeout = 5 * time.Minute
+
+	// defaultRolloutPollInterval is how often rollout status is checked.
+	defaultRolloutPollInterval = 2 * time.Second
+
+	// restartedAtAnnotation is set on pod templates to trigger a rollout,
+	// like kubectl rollout restart.
+	restartedAtAnnotation = "yar.restartedAt"
+)
+
+// prunableKinds are the kinds yar creates, deletes and prunes by label, in
+// deletion order. Namespaces are never deleted since they may be shared.
+var prunableKinds = []schema.GroupVersionKind{
+	kubernetes.IngressKind,
+	kubernetes.CronJobKind,
+	kubernetes.JobKind,
+	kubernetes.DeploymentKind,
+	kubernetes.StatefulSetKind,
+	kubernetes.DaemonSetKind,
+	kubernetes.ServiceKind,
+	kubernetes.ConfigMapKind,
+	kubernetes.SecretKind,
+	kubernetes.PVCKind,
+}
+
+// rolloutKinds are the workload kinds Up waits for and Status reports.
+var rolloutKinds = []schema.GroupVersionKind{
+	kubernetes.DeploymentKind,
+	kubernetes.StatefulSetKind,
+	kubernetes.DaemonSetKind,
+}
+
+// failingReasons are container waiting reasons that mark a pod as failing
+// rather than still starting.
+var failingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
+
+// ManifestRenderer renders the Kubernetes manifests of a project
+// environment as a stream of YAML documents. Objects that belong to a
+// service carry the LabelService label.
+type ManifestRenderer interface {
+	RenderManifests(ctx context.Context, project *config.Project, env string) ([]byte, error)
+}
+
+// K8sDriver runs fleets on Kubernetes. Up applies rendered manifests with
+// server-side apply, labels every object for pruning and waits for
+// rollouts; Down scales workloads to zero; Destroy deletes by label.
+type K8sDriver struct {
+	client         kubernetes.Client
+	renderer       ManifestRenderer
+	logReader      kubernetes.LogReader
+	actions        *action.Log
+	rolloutTimeout time.Duration
+	pollInterval   time.Duration
+	now            func() time.Time
+}
+
+// K8sOption configures a K8sDriver.
+type K8sOption func(*K8sDriver)
+
+// WithManifestRenderer sets the renderer Up uses to produce manifests.
+func WithManifestRenderer(r ManifestRenderer) K8sOption {
+	return func(d *K8sDriver) {
+		d.renderer = r
+	}
+}
+
+// WithLogReader sets the reader used to include the last log lines of
+// failing pods in Status and in crash-loop errors.
+func WithLogReader(r kubernetes.LogReader) K8sOption {
+	return func(d *K8sDriver) {
+		d.logReader = r
+	}
+}
+
+// WithActionLog records every change the driver makes in log. In a dry
+// run nothing is sent to the cluster and Up and Restart don't wait for
+// rollouts, since none start.
+func WithActionLog(log *action.Log) K8sOption {
+	return func(d *K8sDriver) {
+		d.actions = log
+	}
+}
+
+// WithRolloutTimeout overrides DefaultRolloutTimeout.
+func WithRolloutTimeout(timeout time.Duration) K8sOption {
+	return func(d *K8sDriver) {
+		d.rolloutTimeout = timeout
+	}
+}
+
+// WithRolloutPollInterval overrides how often rollout status is checked.
+func WithRolloutPollInterval(interval time.Duration) K8sOption {
+	return func(d *K8sDriver) {
+		d.pollInterval = interval
+	}
+}
+
+// NewK8sDriver creates a Kubernetes driver using client.
+func NewK8sDriver(client kubernetes.Client, opts ...K8sOption) *K8sDriver {
+	d := &K8sDriver{
+		client:         client,
+		rolloutTimeout: DefaultRolloutTimeout,
+		pollInterval:   defaultRolloutPollInterval,
+		now:            time.Now,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.actions != nil {
+		d.client = kubernetes.NewRecordingClient(d.client, d.actions)
+	}
+	return d
+}
+
+// Up implements Driver.Up. Objects are applied namespaces first, then
+// workloads wave by wave in dependency order with each service's jobs
+// around them (see applySteps); previously applied objects no longer
+// rendered are pruned, and Up returns once every workload has rolled out.
+// With opts.Atomic, objects created by this run are deleted again on
+// failure or interrupt.
+func (d *K8sDriver) Up(ctx context.Context, project *config.Project, env string, opts UpOptions) error {
+	name := project.Project + "/" + env
+	if d.renderer == nil {
+		return NewFleetError("k8s.render", name, "no manifest renderer configured", nil)
+	}
+	data, err := d.renderer.RenderManifests(ctx, project, env)
+	if err != nil {
+		return NewFleetError("k8s.render", name, "failed to render manifests", err)
+	}
+	objs, err := kubernetes.DecodeManifests(data)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		labelObject(obj, project.Project, env)
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		return applyRank(objs[i].GroupVersionKind()) < applyRank(objs[j].GroupVersionKind())
+	})
+
+	steps, err := applySteps(project, objs)
+	if err != nil {
+		return err
+	}
+
+	var created []*unstructured.Unstructured
+	err = d.apply(ctx, project, env, steps, &created)
+	if err != nil && ctx.Err() != nil {
+		err = ErrInterrupted(name, stderrors.Join(ctx.Err(), err))
+	}
+	if err != nil && opts.Atomic {
+		if rbErr := d.deleteObjects(ctx, created); rbErr != nil {
+			return stderrors.Join(err, ErrRollback(name, rbErr))
+		}
+	}
+	return err
+}
+
+// apply applies steps in order, waiting after each step for its workloads
+// to roll out and its yar jobs to complete, then prunes stale objects.
+// Objects that did not exist before are appended to created.
+func (d *K8sDriver) apply(ctx context.Context, project *config.Project, env string, steps [][]*unstructured.Unstructured, created *[]*unstructured.Unstructured) error {
+	applied := make(map[string]bool)
+	namespaces := d.namespaces(project)
+
+	for _, step := range steps {
+		workloads, jobs, err := d.applyStep(ctx, step, applied, &namespaces, created)
+		if err != nil {
+			return err
+		}
+		if err := d.waitRollouts(ctx, workloads); err != nil {
+			return err
+		}
+		if err := d.waitJobs(ctx, jobs); err != nil {
+			return err
+		}
+	}
+	return d.prune(ctx, project.Project, env, namespaces, applied)
+}
+
+// applyStep applies the objects of one step and returns the workloads and
+// yar jobs among them.
+func (d *K8sDriver) applyStep(ctx context.Context, objs []*unstructured.Unstructured, applied map[string]bool, namespaces *[]string, created *[]*unstructured.Unstructured) ([]*unstructured.Unstructured, []*unstructured.Unstructured, error) {
+	var workloads, jobs []*unstructured.Unstructured
+	for _, obj := range objs {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		gvk := obj.GroupVersionKind()
+		_, err := d.client.Get(ctx, gvk, obj.GetNamespace(), obj.GetName())
+		exists := err == nil
+		if err != nil && !kubernetes.IsNotFound(err) {
+			return nil, nil, err
+		}
+
+		result, err := d.client.Apply(ctx, obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !exists {
+			*created = append(*created, result)
+		}
+
+		applied[objectKey(gvk, result.GetNamespace(), result.GetName())] = true
+		if ns := result.GetNamespace(); ns != "" && !contains(*namespaces, ns) {
+			*namespaces = append(*namespaces, ns)
+		}
+		switch {
+		case isRolloutKind(gvk):
+			workloads = append(workloads, result)
+		case isServiceJob(result):
+			jobs = append(jobs, result)
+		}
+	}
+	return workloads, jobs, nil
+}
+
+// prune deletes labeled objects of the project environment that were not
+// part of the applied set.
+func (d *K8sDriver) prune(ctx context.Context, project, env string, namespaces []string, applied map[string]bool) error {
+	selector := LabelSelector(project, env)
+	for _, ns := range namespaces {
+		for _, gvk := range prunableKinds {
+			items, err := d.client.List(ctx, gvk, ns, selector)
+			if err != nil {
+				return err
+			}
+			for i := range items {
+				if applied[objectKey(gvk, ns, items[i].GetName())] {
+					continue
+				}
+				if err := d.client.Delete(ctx, gvk, ns, items[i].GetName()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Down implements Driver.Down by scaling Deployments and StatefulSets to
+// zero. The next Up restores the rendered replica counts.
+func (d *K8sDriver) Down(ctx context.Context, project *config.Project, env string, opts DownOptions) error {
+	patch := []byte(`{"spec":{"replicas":0}}`)
+	return d.eachWorkload(ctx, project, env, nil, []schema.GroupVersionKind{
+		kubernetes.DeploymentKind,
+		kubernetes.StatefulSetKind,
+	}, func(obj *unstructured.Unstructured) error {
+		return d.client.Patch(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), types.MergePatchType, patch)
+	})
+}
+
+// Restart implements Driver.Restart with a rolling restart of each
+// workload, then waits for the rollouts to complete.
+func (d *K8sDriver) Restart(ctx context.Context, project *config.Project, env string, opts RestartOptions) error {
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"template": map[string]any{
+				"metadata": map[string]any{
+					"annotations": map[string]string{
+						restartedAtAnnotation: d.now().UTC().Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var workloads []*unstructured.Unstructured
+	err = d.eachWorkload(ctx, project, env, opts.Services, rolloutKinds, func(obj *unstructured.Unstructured) error {
+		if err := d.client.Patch(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), types.MergePatchType, patch); err != nil {
+			return err
+		}
+		workloads = append(workloads, obj)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return d.waitRollouts(ctx, workloads)
+}
+
+// Destroy implements Driver.Destroy by deleting every labeled object of the
+// project environment. PersistentVolumeClaims are kept with KeepVolumes.
+func (d *K8sDriver) Destroy(ctx context.Context, project *config.Project, env string, opts DestroyOptions) error {
+	selector := LabelSelector(project.Project, env)
+	for _, ns := range d.namespaces(project) {
+		for _, gvk := range prunableKinds {
+			if opts.KeepVolumes && gvk == kubernetes.PVCKind {
+				continue
+			}
+			items, err := d.client.List(ctx, gvk, ns, selector)
+			if err != nil {
+				return err
+			}
+			for i := range items {
+				if err := d.client.Delete(ctx, gvk, ns, items[i].GetName()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Status implements Driver.Status from workload and pod state, with the
+// derived state of each service and, when a log reader is set, the last
+// log lines of failing services. Endpoints are the in-cluster DNS names of
+// each service's Services, plus any load balancer addresses.
+func (d *K8sDriver) Status(ctx context.Context, project *config.Project, env string) (*FleetStatus, error) {
+	selector := LabelSelector(project.Project, env)
+	byName := make(map[string]*ServiceStatus)
+	get := func(name string) *ServiceStatus {
+		s, ok := byName[name]
+		if !ok {
+			s = &ServiceStatus{Name: name}
+			byName[name] = s
+		}
+		return s
+	}
+	worst := make(map[string]podDiagnosis)
+
+	for _, ns := range d.namespaces(project) {
+		for _, gvk := range rolloutKinds {
+			items, err := d.client.List(ctx, gvk, ns, selector)
+			if err != nil {
+				return nil, err
+			}
+			for i := range items {
+				items[i].SetGroupVersionKind(gvk)
+				replicas, ready := workloadReplicas(&items[i])
+				s := get(serviceName(&items[i]))
+				s.Replicas += replicas
+				s.Ready += ready
+			}
+		}
+
+		pods, err := d.client.List(ctx, kubernetes.PodKind, ns, selector)
+		if err != nil {
+			return nil, err
+		}
+		for i := range pods {
+			s, ok := byName[serviceName(&pods[i])]
+			if !ok {
+				continue
+			}
+			diag := diagnosePod(&pods[i])
+			s.Restarts += diag.restarts
+			if cur, seen := worst[s.Name]; !seen || stateRank[diag.state] > stateRank[cur.state] {
+				worst[s.Name] = diag
+			}
+		}
+
+		services, err := d.client.List(ctx, kubernetes.ServiceKind, ns, selector)
+		if err != nil {
+			return nil, err
+		}
+		for i := range services {
+			if s, ok := byName[serviceName(&services[i])]; ok {
+				s.Endpoints = append(s.Endpoints, serviceEndpoints(&services[i])...)
+			}
+		}
+	}
+
+	status := &FleetStatus{Environment: env, Healthy: len(byName) > 0}
+	for _, s := range byName {
+		switch {
+		case s.Replicas == 0:
+			s.Status = StatusStopped
+		case s.Ready >= s.Replicas:
+			s.Status = StatusRunning
+		default:
+			s.Status = StatusPending
+		}
+		if diag, ok := worst[s.Name]; ok {
+			d.applyDiagnosis(ctx, s, diag)
+		} else {
+			s.State = map[string]string{
+				StatusStopped: StateExited,
+				StatusRunning: StateHealthy,
+				StatusPending: StateStarting,
+			}[s.Status]
+		}
+		if s.Status != StatusRunning {
+			status.Healthy = false
+		}
+		status.Services = append(status.Services, *s)
+	}
+	sort.Slice(status.Services, func(i, j int) bool {
+		return status.Services[i].Name < status.Services[j].Name
+	})
+	return status, nil
+}
+
+// Logs merges the logs of every container of the project environment's
+// pods into w, restricted to services when any are named, like
+// StreamLogs: each line is prefixed with its pod name, or pod/container
+// for pods with several containers. With opts.Follow, pods that start
+// later are not picked up.
+func (d *K8sDriver) Logs(ctx context.Context, project *config.Project, env string, services []string, opts LogOptions, w io.Writer) error {
+	if d.logReader == nil {
+		return stderrors.New("no log reader configured")
+	}
+	podOpts, err := podLogOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	selector := LabelSelector(project.Project, env)
+	found := make(map[string]bool)
+	var streams []logStream
+	for _, ns := range d.namespaces(project) {
+		pods, err := d.client.List(ctx, kubernetes.PodKind, ns, selector)
+		if err != nil {
+			return err
+		}
+		for i := range pods {
+			pod := &pods[i]
+			svc := serviceName(pod)
+			if len(services) > 0 && !contains(services, svc) {
+				continue
+			}
+			found[svc] = true
+
+			containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", "containers")
+			for _, c := range containers {
+				container, _ := c.(map[string]any)["name"].(string)
+				name := pod.GetName()
+				if len(containers) > 1 {
+					name += "/" + container
+				}
+				copts := podOpts
+				copts.Container = container
+				streams = append(streams, logStream{
+					service: svc,
+					name:    name,
+					tty:     true,
+					open: func(ctx context.Context) (io.ReadCloser, error) {
+						return d.logReader.StreamPodLogs(ctx, pod.GetNamespace(), pod.GetName(), copts)
+					},
+					readErr: func(err error) error { return kubernetes.ErrPodLogs(pod.GetName(), pod.GetNamespace(), err) },
+				})
+			}
+		}
+	}
+
+	for _, svc := range services {
+		if !found[svc] {
+			return &errors.NotFoundError{
+				Resource: "service",
+				Name:     svc,
+				Message:  fmt.Sprintf("no pods for service in %s/%s", project.Project, env),
+			}
+		}
+	}
+	if len(streams) == 0 {
+		return &errors.NotFoundError{
+			Resource: "pod",
+			Name:     project.Project + "/" + env,
+			Message:  "no pods found",
+		}
+	}
+	sort.SliceStable(streams, func(i, j int) bool {
+		if streams[i].service != streams[j].service {
+			return streams[i].service < streams[j].service
+		}
+		return streams[i].name < streams[j].name
+	})
+	return mergeLogs(ctx, streams, opts, w)
+}
+
+// podLogOptions maps the Docker-style Since and Tail of opts to pod log
+// options. Since is a duration such as 10m or an RFC 3339 time.
+func podLogOptions(opts LogOptions) (kubernetes.PodLogOptions, error) {
+	podOpts := kubernetes.PodLogOptions{Follow: opts.Follow, Timestamps: true}
+	if opts.Since != "" {
+		if dur, err := time.ParseDuration(opts.Since); err == nil {
+			podOpts.SinceSeconds = max(int64(dur.Seconds()), 1)
+		} else if t, err := time.Parse(time.RFC3339, opts.Since); err == nil {
+			podOpts.SinceTime = t
+		} else {
+			return podOpts, &errors.ValidationError{Field: "since", Value: opts.Since, Message: "must be a duration such as 10m or an RFC 3339 time"}
+		}
+	}
+	if opts.Tail != "" && opts.Tail != "all" {
+		n, err := strconv.ParseInt(opts.Tail, 10, 64)
+		if err != nil || n < 0 {
+			return podOpts, &errors.ValidationError{Field: "tail", Value: opts.Tail, Message: "must be a number of lines or all"}
+		}
+		podOpts.TailLines = n
+	}
+	return podOpts, nil
+}
+
+// eachWorkload calls fn for every labeled object of the given kinds,
+// restricted to services when any are named.
+func (d *K8sDriver) eachWorkload(ctx context.Context, project *config.Project, env string, services []string, kinds []schema.GroupVersionKind, fn func(*unstructured.Unstructured) error) error {
+	selector := LabelSelector(project.Project, env)
+	for _, ns := range d.namespaces(project) {
+		for _, gvk := range kinds {
+			items, err := d.client.List(ctx, gvk, ns, selector)
+			if err != nil {
+				return err
+			}
+			for i := range items {
+				if len(services) > 0 && !contains(services, serviceName(&items[i])) {
+					continue
+				}
+				items[i].SetGroupVersionKind(gvk)
+				if err := fn(&items[i]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// waitRollouts waits until every workload has rolled out, the rollout
+// timeout elapses, or ctx is cancelled. A workload with a crash-looping
+// pod fails immediately with a ServiceFailedError.
+func (d *K8sDriver) waitRollouts(ctx context.Context, workloads []*unstructured.Unstructured) error {
+	if d.actions.DryRun() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.rolloutTimeout)
+	defer cancel()
+
+	for _, w := range workloads {
+		gvk := w.GroupVersionKind()
+		name := gvk.Kind + "/" + w.GetName()
+		err := WaitReady(ctx, d.pollInterval, func(ctx context.Context) (bool, error) {
+			current, err := d.client.Get(ctx, gvk, w.GetNamespace(), w.GetName())
+			if err != nil {
+				return false, err
+			}
+			done, err := rolloutComplete(current)
+			if done || err != nil {
+				return done, err
+			}
+			return false, d.checkCrashLoop(ctx, current)
+		})
+		if err != nil {
+			return NewFleetError("k8s.rollout", name, "rollout did not complete", err)
+		}
+	}
+	return nil
+}
+
+// checkCrashLoop returns a ServiceFailedError, with the last log lines,
+// if a pod of the workload's service is crash-looping.
+func (d *K8sDriver) checkCrashLoop(ctx context.Context, workload *unstructured.Unstructured) error {
+	labels := workload.GetLabels()
+	service := labels[LabelService]
+	if service == "" {
+		return nil
+	}
+	selector := LabelSelector(labels[LabelProject], labels[LabelEnvironment]) + "," + LabelService + "=" + service
+	pods, err := d.client.List(ctx, kubernetes.PodKind, workload.GetNamespace(), selector)
+	if err != nil {
+		return err
+	}
+
+	s := ServiceStatus{Name: service}
+	var crashing *podDiagnosis
+	for i := range pods {
+		diag := diagnosePod(&pods[i])
+		s.Restarts += diag.restarts
+		if diag.state == StateCrashLooping && crashing == nil {
+			crashing = &diag
+		}
+	}
+	if crashing == nil {
+		return nil
+	}
+	d.applyDiagnosis(ctx, &s, *crashing)
+	return &ServiceFailedError{Status: s}
+}
+
+// applyDiagnosis sets the derived state of s from the diagnosis of its
+// worst pod, with the pod's last log lines when the service is failing.
+// A log read failure leaves Logs empty rather than failing the status.
+func (d *K8sDriver) applyDiagnosis(ctx context.Context, s *ServiceStatus, diag podDiagnosis) {
+	s.State = diag.state
+	s.ExitCode = diag.exitCode
+	s.OOMKilled = diag.oomKilled
+	s.Reason = diag.reason
+	if s.State == StateCrashLooping || s.State == StateUnhealthy {
+		s.Status = StatusError
+	}
+	if !s.Failing() || d.logReader == nil {
+		return
+	}
+	out, err := d.logReader.PodLogs(ctx, diag.namespace, diag.pod, kubernetes.PodLogOptions{
+		Container: diag.container,
+		TailLines: DefaultDiagnosticLogLines,
+		Previous:  diag.previous,
+	})
+	if err == nil {
+		s.Logs = logLines(out, DefaultDiagnosticLogLines)
+	}
+}
+
+// waitJobs waits until every job has completed, the rollout timeout
+// elapses, or ctx is cancelled. A failed job fails immediately.
+func (d *K8sDriver) waitJobs(ctx context.Context, jobs []*unstructured.Unstructured) error {
+	if d.actions.DryRun() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.rolloutTimeout)
+	defer cancel()
+
+	for _, j := range jobs {
+		err := WaitReady(ctx, d.pollInterval, func(ctx context.Context) (bool, error) {
+			current, err := d.client.Get(ctx, kubernetes.JobKind, j.GetNamespace(), j.GetName())
+			if err != nil {
+				return false, err
+			}
+			return jobComplete(current)
+		})
+		if err != nil {
+			return ErrJob(j.GetLabels()[LabelService]+"/"+j.GetLabels()[LabelJob], err)
+		}
+	}
+	return nil
+}
+
+// deleteObjects deletes objs in reverse order on a context detached from
+// ctx, so it also runs after an interrupt.
+func (d *K8sDriver) deleteObjects(ctx context.Context, objs []*unstructured.Unstructured) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), DefaultRollbackTimeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(objs) - 1; i >= 0; i-- {
+		obj := objs[i]
+		if err := d.client.Delete(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// namespaces returns the default namespace followed by any per-service
+// namespaces of the project.
+func (d *K8sDriver) namespaces(project *config.Project) []string {
+	namespaces := []string{d.client.Namespace()}
+	for _, svc := range project.Services {
+		if svc.Namespace != "" && !contains(namespaces, svc.Namespace) {
+			namespaces = append(namespaces, svc.Namespace)
+		}
+	}
+	return namespaces
+}
+
+// labelObject adds the fleet labels to obj and to the pod and volume claim
+// templates of workloads, so pods and claims can be selected too.
+func labelObject(obj *unstructured.Unstructured, project, env string) {
+	service := obj.GetLabels()[LabelService]
+	add := func(fields ...string) {
+		labels, _, _ := unstructured.NestedStringMap(obj.Object, fields...)
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		for k, v := range Labels(project, env, service) {
+			labels[k] = v
+		}
+		_ = unstructured.SetNestedStringMap(obj.Object, labels, fields...)
+	}
+
+	add("metadata", "labels")
+	switch obj.GroupVersionKind() {
+	case kubernetes.DeploymentKind, kubernetes.StatefulSetKind, kubernetes.DaemonSetKind, kubernetes.JobKind:
+		add("spec", "template", "metadata", "labels")
+	case kubernetes.CronJobKind:
+		add("spec", "jobTemplate", "spec", "template", "metadata", "labels")
+	}
+
+	if obj.GroupVersionKind() == kubernetes.StatefulSetKind {
+		claims, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+		for i, c := range claims {
+			claim, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			u := &unstructured.Unstructured{Object: claim}
+			labels := u.GetLabels()
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			for k, v := range Labels(project, env, service) {
+				labels[k] = v
+			}
+			u.SetLabels(labels)
+			claims[i] = u.Object
+		}
+		if claims != nil {
+			_ = unstructured.SetNestedSlice(obj.Object, claims, "spec", "volumeClaimTemplates")
+		}
+	}
+}
+
+// applySteps splits objects, already ordered by applyRank, into steps
+// applied one after the other: first everything but workloads, yar jobs
+// and ingresses; then, for each dependency wave, the wave's before-jobs,
+// its workloads and its after-jobs; finally ingresses. Workloads of
+// unknown services join the last wave.
+func applySteps(project *config.Project, objs []*unstructured.Unstructured) ([][]*unstructured.Unstructured, error) {
+	waves, err := Waves(project.Services)
+	if err != nil {
+		return nil, err
+	}
+	waveOf := make(map[string]int)
+	for i, wave := range waves {
+		for _, svc := range wave {
+			waveOf[svc.Name] = i
+		}
+	}
+	last := len(waves) - 1
+	if last < 0 {
+		last = 0
+	}
+
+	steps := make([][]*unstructured.Unstructured, 3*(last+1)+2)
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		wave, ok := waveOf[obj.GetLabels()[LabelService]]
+		if !ok {
+			wave = last
+		}
+
+		step := 0
+		switch {
+		case gvk == kubernetes.IngressKind:
+			step = len(steps) - 1
+		case isServiceJob(obj) && obj.GetAnnotations()[AnnotationJobPhase] == config.JobAfter:
+			step = 3*wave + 3
+		case isServiceJob(obj):
+			step = 3*wave + 1
+		case applyRank(gvk) == applyRank(kubernetes.DeploymentKind):
+			step = 3*wave + 2
+		}
+		steps[step] = append(steps[step], obj)
+	}
+	return steps, nil
+}
+
+// isServiceJob reports whether obj is a Job rendered from a service job.
+func isServiceJob(obj *unstructured.Unstructured) bool {
+	return obj.GroupVersionKind() == kubernetes.JobKind && obj.GetLabels()[LabelJob] != ""
+}
+
+// applyRank orders kinds for apply: namespaces, then configuration and
+// storage, then services, then workloads, then ingresses.
+func applyRank(gvk schema.GroupVersionKind) int {
+	switch gvk {
+	case kubernetes.NamespaceKind:
+		return 0
+	case kubernetes.ConfigMapKind, kubernetes.SecretKind, kubernetes.PVCKind:
+		return 1
+	case kubernetes.ServiceKind:
+		return 3
+	case kubernetes.DeploymentKind, kubernetes.StatefulSetKind, kubernetes.DaemonSetKind,
+		kubernetes.JobKind, kubernetes.CronJobKind:
+		return 4
+	case kubernetes.IngressKind:
+		return 5
+	}
+	return 2
+}
+
+// rolloutComplete reports whether a workload has finished rolling out,
+// following the same rules as kubectl rollout status.
+func rolloutComplete(obj *unstructured.Unstructured) (bool, error) {
+	generation := obj.GetGeneration()
+	observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observed < generation {
+		return false, nil
+	}
+
+	status := func(field string) int64 {
+		v, _, _ := unstructured.NestedInt64(obj.Object, "status", field)
+		return v
+	}
+
+	switch obj.GroupVersionKind() {
+	case kubernetes.DeploymentKind:
+		conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		for _, c := range conditions {
+			cond, _ := c.(map[string]any)
+			if cond["type"] == "Progressing" && cond["reason"] == "ProgressDeadlineExceeded" {
+				return false, fmt.Errorf("deployment %s exceeded its progress deadline", obj.GetName())
+			}
+		}
+		replicas := specReplicas(obj)
+		return status("updatedReplicas") >= replicas &&
+			status("replicas") <= status("updatedReplicas") &&
+			status("availableReplicas") >= replicas, nil
+	case kubernetes.StatefulSetKind:
+		replicas := specReplicas(obj)
+		return status("readyReplicas") >= replicas && status("updatedReplicas") >= replicas, nil
+	case kubernetes.DaemonSetKind:
+		desired := status("desiredNumberScheduled")
+		return status("updatedNumberScheduled") >= desired && status("numberAvailable") >= desired, nil
+	}
+	return true, nil
+}
+
+// workloadReplicas returns the desired and ready replica counts of a
+// workload.
+func workloadReplicas(obj *unstructured.Unstructured) (int, int) {
+	if obj.GroupVersionKind() == kubernetes.DaemonSetKind {
+		desired, _, _ := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+		ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "numberReady")
+		return int(desired), int(ready)
+	}
+	ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+	return int(specReplicas(obj)), int(ready)
+}
+
+// specReplicas returns spec.replicas, which defaults to 1 when unset.
+func specReplicas(obj *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return replicas
+}
+
+// serviceEndpoints returns the in-cluster DNS endpoints and load balancer
+// addresses of a Kubernetes Service.
+func serviceEndpoints(svc *unstructured.Unstructured) []string {
+	ports, _, _ := unstructured.NestedSlice(svc.Object, "spec", "ports")
+	ingress, _, _ := unstructured.NestedSlice(svc.Object, "status", "loadBalancer", "ingress")
+
+	var endpoints []string
+	for _, p := range ports {
+		port, _ := p.(map[string]any)
+		number, _, _ := unstructured.NestedInt64(port, "port")
+		endpoints = append(endpoints, fmt.Sprintf("%s.%s.svc:%d", svc.GetName(), svc.GetNamespace(), number))
+		for _, in := range ingress {
+			lb, _ := in.(map[string]any)
+			host, _ := lb["ip"].(string)
+			if host == "" {
+				host, _ = lb["hostname"].(string)
+			}
+			if host != "" {
+				endpoints = append(endpoints, fmt.Sprintf("%s:%d", host, number))
+			}
+		}
+	}
+	return endpoints
+}
+
+// serviceName returns the yar service an object belongs to, falling back
+// to the object name for objects rendered without a service label.
+func serviceName(obj *unstructured.Unstructured) string {
+	if svc := obj.GetLabels()[LabelService]; svc != "" {
+		return svc
+	}
+	return obj.GetName()
+}
+
+// objectKey identifies an object across kinds and namespaces.
+func objectKey(gvk schema.GroupVersionKind, namespace, name string) string {
+	return gvk.GroupKind().String() + "/" + namespace + "/" + name
+}
+
+// isRolloutKind reports whether gvk is a workload kind with a rollout.
+func isRolloutKind(gvk schema.GroupVersionKind) bool {
+	for _, k := range rolloutKinds {
+		if gvk == k {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Ensure K8sDriver implements Driver.
+var _ Driver = (*K8sDriver)(nil)
@@ -0,0 +1,577 @@
+package fleet
+
+import (
+	"context"
+	stderrors "errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/kubernetes/kubetest"
+)
+
+// renderFunc adapts a function to ManifestRenderer.
+type renderFunc func(ctx context.Context, project *config.Project, env string) ([]byte, error)
+
+func (f renderFunc) RenderManifests(ctx context.Context, project *config.Project, env string) ([]byte, error) {
+	return f(ctx, project, env)
+}
+
+func staticManifests(data string) ManifestRenderer {
+	return renderFunc(func(context.Context, *config.Project, string) ([]byte, error) {
+		return []byte(data), nil
+	})
+}
+
+const k8sManifests = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  labels:
+    yar.service: api
+spec:
+  replicas: 2
+  template:
+    metadata:
+      labels:
+        app: api
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+  labels:
+    yar.service: api
+spec:
+  ports:
+    - port: 8080
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: api-config
+  labels:
+    yar.service: api
+`
+
+func k8sProject() *config.Project {
+	return &config.Project{
+		Project:  "ai-agents",
+		Services: []*config.Service{{Name: "api"}},
+	}
+}
+
+// rolloutController makes workloads report a completed rollout on every
+// get, standing in for the cluster's controllers.
+func rolloutController(dyn *dynamicfake.FakeDynamicClient) {
+	dyn.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetActionImpl)
+		obj, err := dyn.Tracker().Get(get.GetResource(), get.GetNamespace(), get.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return true, nil, err
+		}
+		u := obj.(*unstructured.Unstructured).DeepCopy()
+		replicas := specReplicas(u)
+		for _, field := range []string{"replicas", "updatedReplicas", "readyReplicas", "availableReplicas"} {
+			_ = unstructured.SetNestedField(u.Object, replicas, "status", field)
+		}
+		return true, u, nil
+	})
+}
+
+func labeled(gvk schema.GroupVersionKind, namespace, name, env, service string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{}}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(Labels("ai-agents", env, service))
+	return obj
+}
+
+func newTestK8sDriver(client kubernetes.Client, opts ...K8sOption) *K8sDriver {
+	opts = append([]K8sOption{
+		WithRolloutPollInterval(time.Millisecond),
+		WithRolloutTimeout(time.Second),
+	}, opts...)
+	return NewK8sDriver(client, opts...)
+}
+
+func names(items []unstructured.Unstructured) []string {
+	var out []string
+	for _, item := range items {
+		out = append(out, item.GetName())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestK8sDriver_UpAppliesLabeledObjects(t *testing.T) {
+	ctx := context.Background()
+	client, dyn := kubetest.NewFakeClient("dev")
+	rolloutController(dyn)
+	d := newTestK8sDriver(client, WithManifestRenderer(staticManifests(k8sManifests)))
+
+	if err := d.Up(ctx, k8sProject(), "dev", UpOptions{}); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	deploy, err := client.Get(ctx, kubernetes.DeploymentKind, "dev", "api")
+	if err != nil {
+		t.Fatalf("Get(deployment) error = %v", err)
+	}
+	want := Labels("ai-agents", "dev", "api")
+	if diff := cmp.Diff(want, deploy.GetLabels()); diff != "" {
+		t.Errorf("deployment labels mismatch (-want +got):\n%s", diff)
+	}
+	podLabels, _, _ := unstructured.NestedStringMap(deploy.Object, "spec", "template", "metadata", "labels")
+	want["app"] = "api"
+	if diff := cmp.Diff(want, podLabels); diff != "" {
+		t.Errorf("pod template labels mismatch (-want +got):\n%s", diff)
+	}
+
+	// Configuration is applied before workloads.
+	var order []string
+	for _, action := range dyn.Actions() {
+		if patch, ok := action.(k8stesting.PatchActionImpl); ok {
+			order = append(order, patch.GetResource().Resource)
+		}
+	}
+	if diff := cmp.Diff([]string{"configmaps", "services", "deployments"}, order); diff != "" {
+		t.Errorf("apply order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestK8sDriver_UpPrunesStaleObjects(t *testing.T) {
+	ctx := context.Background()
+	client, dyn := kubetest.NewFakeClient("dev",
+		labeled(kubernetes.ConfigMapKind, "dev", "old-config", "dev", "api"),
+		labeled(kubernetes.ConfigMapKind, "dev", "prod-config", "prod", "api"),
+	)
+	rolloutController(dyn)
+	d := newTestK8sDriver(client, WithManifestRenderer(staticManifests(k8sManifests)))
+
+	if err := d.Up(ctx, k8sProject(), "dev", UpOptions{}); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	items, err := client.List(ctx, kubernetes.ConfigMapKind, "dev", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"api-config", "prod-config"}, names(items)); diff != "" {
+		t.Errorf("configmaps mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestK8sDriver_UpDryRun(t *testing.T) {
+	ctx := context.Background()
+	client, dyn := kubetest.NewFakeClient("dev",
+		labeled(kubernetes.ConfigMapKind, "dev", "old-config", "dev", "api"),
+	)
+
+	// Nothing rolls out in a dry run, so Up must not wait.
+	dryRun := action.NewLog(true)
+	d := newTestK8sDriver(client, WithManifestRenderer(staticManifests(k8sManifests)), WithActionLog(dryRun))
+	if err := d.Up(ctx, k8sProject(), "dev", UpOptions{}); err != nil {
+		t.Fatalf("Up() dry run error = %v", err)
+	}
+	for _, a := range dyn.Actions() {
+		if verb := a.GetVerb(); verb != "get" && verb != "list" {
+			t.Errorf("dry run sent %s %s", verb, a.GetResource().Resource)
+		}
+	}
+	want := []action.Action{
+		{Kind: action.KindKubernetes, Op: "apply", Object: "ConfigMap dev/api-config"},
+		{Kind: action.KindKubernetes, Op: "apply", Object: "Service dev/api"},
+		{Kind: action.KindKubernetes, Op: "apply", Object: "Deployment dev/api"},
+		{Kind: action.KindKubernetes, Op: "delete", Object: "ConfigMap dev/old-config"},
+	}
+	if diff := cmp.Diff(want, dryRun.Actions()); diff != "" {
+		t.Errorf("dry run actions mismatch (-want +got):\n%s", diff)
+	}
+
+	// The real run takes exactly the actions the dry run reported.
+	rolloutController(dyn)
+	live := action.NewLog(false)
+	d = newTestK8sDriver(client, WithManifestRenderer(staticManifests(k8sManifests)), WithActionLog(live))
+	if err := d.Up(ctx, k8sProject(), "dev", UpOptions{}); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if diff := cmp.Diff(dryRun.Actions(), live.Actions()); diff != "" {
+		t.Errorf("real run diverged from dry run (-dry +real):\n%s", diff)
+	}
+}
+
+func TestK8sDriver_UpRolloutTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		atomic bool
+		want   []string
+	}{
+		"leaves objects":          {atomic: false, want: []string{"api-config"}},
+		"atomic removes new ones": {atomic: true, want: []string{"api-config"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Without a controller the deployment never becomes available.
+			client, _ := kubetest.NewFakeClient("dev",
+				labeled(kubernetes.ConfigMapKind, "dev", "api-config", "dev", "api"),
+			)
+			d := newTestK8sDriver(client,
+				WithManifestRenderer(staticManifests(k8sManifests)),
+				WithRolloutTimeout(20*time.Millisecond))
+
+			err := d.Up(ctx, k8sProject(), "dev", UpOptions{Atomic: tc.atomic})
+			var ferr *FleetError
+			if !stderrors.As(err, &ferr) || ferr.Op != "k8s.rollout" {
+				t.Fatalf("Up() error = %v, want k8s.rollout error", err)
+			}
+
+			_, err = client.Get(ctx, kubernetes.DeploymentKind, "dev", "api")
+			if tc.atomic && !kubernetes.IsNotFound(err) {
+				t.Errorf("deployment still exists after atomic rollback (err = %v)", err)
+			}
+			if !tc.atomic && err != nil {
+				t.Errorf("deployment removed without --atomic: %v", err)
+			}
+
+			// The pre-existing config map is never rolled back.
+			items, err := client.List(ctx, kubernetes.ConfigMapKind, "dev", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, names(items)); diff != "" {
+				t.Errorf("configmaps mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestK8sDriver_UpInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client, _ := kubetest.NewFakeClient("dev")
+	d := newTestK8sDriver(client, WithManifestRenderer(staticManifests(k8sManifests)))
+
+	err := d.Up(ctx, k8sProject(), "dev", UpOptions{})
+	if !stderrors.Is(err, context.Canceled) {
+		t.Fatalf("Up() error = %v, want context.Canceled", err)
+	}
+	items, _ := client.List(context.Background(), kubernetes.ConfigMapKind, "dev", "")
+	if len(items) != 0 {
+		t.Errorf("applied %v after interrupt, want nothing", names(items))
+	}
+}
+
+func TestK8sDriver_UpWithoutRenderer(t *testing.T) {
+	client, _ := kubetest.NewFakeClient("dev")
+	err := newTestK8sDriver(client).Up(context.Background(), k8sProject(), "dev", UpOptions{})
+	var ferr *FleetError
+	if !stderrors.As(err, &ferr) || ferr.Op != "k8s.render" {
+		t.Errorf("Up() error = %v, want k8s.render error", err)
+	}
+}
+
+func TestK8sDriver_DownScalesToZero(t *testing.T) {
+	ctx := context.Background()
+	deploy := labeled(kubernetes.DeploymentKind, "dev", "api", "dev", "api")
+	_ = unstructured.SetNestedField(deploy.Object, int64(3), "spec", "replicas")
+	other := labeled(kubernetes.DeploymentKind, "dev", "prod-api", "prod", "api")
+	_ = unstructured.SetNestedField(other.Object, int64(3), "spec", "replicas")
+	client, _ := kubetest.NewFakeClient("dev", deploy, other)
+
+	if err := newTestK8sDriver(client).Down(ctx, k8sProject(), "dev", DownOptions{}); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+
+	for name, want := range map[string]int64{"api": 0, "prod-api": 3} {
+		got, err := client.Get(ctx, kubernetes.DeploymentKind, "dev", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replicas := specReplicas(got); replicas != want {
+			t.Errorf("%s replicas = %d, want %d", name, replicas, want)
+		}
+	}
+}
+
+func TestK8sDriver_Destroy(t *testing.T) {
+	ctx := context.Background()
+	objects := func() []runtime.Object {
+		return []runtime.Object{
+			labeled(kubernetes.DeploymentKind, "dev", "api", "dev", "api"),
+			labeled(kubernetes.ServiceKind, "dev", "api", "dev", "api"),
+			labeled(kubernetes.PVCKind, "dev", "data", "dev", "api"),
+			labeled(kubernetes.ServiceKind, "dev", "prod-api", "prod", "api"),
+			labeled(kubernetes.SecretKind, "team-b", "creds", "dev", "worker"),
+		}
+	}
+	project := k8sProject()
+	project.Services = append(project.Services, &config.Service{Name: "worker", Namespace: "team-b"})
+
+	tests := map[string]struct {
+		keepVolumes bool
+		wantPVCs    []string
+	}{
+		"all":          {keepVolumes: false, wantPVCs: nil},
+		"keep volumes": {keepVolumes: true, wantPVCs: []string{"data"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client, _ := kubetest.NewFakeClient("dev", objects()...)
+			if err := newTestK8sDriver(client).Destroy(ctx, project, "dev", DestroyOptions{KeepVolumes: tc.keepVolumes}); err != nil {
+				t.Fatalf("Destroy() error = %v", err)
+			}
+
+			remaining := map[string][]string{}
+			for _, gvk := range []schema.GroupVersionKind{kubernetes.DeploymentKind, kubernetes.ServiceKind, kubernetes.PVCKind} {
+				items, _ := client.List(ctx, gvk, "dev", "")
+				remaining[gvk.Kind] = names(items)
+			}
+			secrets, _ := client.List(ctx, kubernetes.SecretKind, "team-b", "")
+
+			if len(remaining["Deployment"]) != 0 || len(secrets) != 0 {
+				t.Errorf("deployments = %v, secrets = %v, want all removed", remaining["Deployment"], names(secrets))
+			}
+			if diff := cmp.Diff([]string{"prod-api"}, remaining["Service"]); diff != "" {
+				t.Errorf("services mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantPVCs, remaining["PersistentVolumeClaim"]); diff != "" {
+				t.Errorf("PVCs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestK8sDriver_Status(t *testing.T) {
+	ctx := context.Background()
+
+	running := labeled(kubernetes.DeploymentKind, "dev", "api", "dev", "api")
+	_ = unstructured.SetNestedField(running.Object, int64(2), "spec", "replicas")
+	_ = unstructured.SetNestedField(running.Object, int64(2), "status", "readyReplicas")
+
+	stopped := labeled(kubernetes.DeploymentKind, "dev", "worker", "dev", "worker")
+	_ = unstructured.SetNestedField(stopped.Object, int64(0), "spec", "replicas")
+
+	crashing := labeled(kubernetes.StatefulSetKind, "dev", "db", "dev", "db")
+	crashPod := labeled(kubernetes.PodKind, "dev", "db-0", "dev", "db")
+	_ = unstructured.SetNestedSlice(crashPod.Object, []any{crashLoopContainer("db", 137, "OOMKilled")}, "status", "containerStatuses")
+
+	starting := labeled(kubernetes.DeploymentKind, "dev", "cache", "dev", "cache")
+
+	svc := labeled(kubernetes.ServiceKind, "dev", "api", "dev", "api")
+	_ = unstructured.SetNestedSlice(svc.Object, []any{map[string]any{"port": int64(8080)}}, "spec", "ports")
+	_ = unstructured.SetNestedSlice(svc.Object, []any{map[string]any{"ip": "10.0.0.5"}}, "status", "loadBalancer", "ingress")
+
+	client, _ := kubetest.NewFakeClient("dev", running, stopped, crashing, crashPod, starting, svc)
+
+	logs := &fakeLogReader{logs: "starting\nout of memory\n"}
+
+	got, err := newTestK8sDriver(client, WithLogReader(logs)).Status(ctx, k8sProject(), "dev")
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+
+	want := &FleetStatus{
+		Environment: "dev",
+		Services: []ServiceStatus{
+			{Name: "api", Status: StatusRunning, State: StateHealthy, Replicas: 2, Ready: 2, Endpoints: []string{"api.dev.svc:8080", "10.0.0.5:8080"}},
+			{Name: "cache", Status: StatusPending, State: StateStarting, Replicas: 1},
+			{
+				Name: "db", Status: StatusError, State: StateCrashLooping, Replicas: 1,
+				Restarts: 4, ExitCode: 137, OOMKilled: true, Reason: "CrashLoopBackOff",
+				Logs: []string{"starting", "out of memory"},
+			},
+			{Name: "worker", Status: StatusStopped, State: StateExited},
+		},
+		Healthy: false,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Status() mismatch (-want +got):\n%s", diff)
+	}
+
+	wantCalls := []string{"dev/db-0/db previous=true tail=20"}
+	if diff := cmp.Diff(wantCalls, logs.calls); diff != "" {
+		t.Errorf("PodLogs calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestK8sDriver_Logs(t *testing.T) {
+	ctx := context.Background()
+	pod := func(name, service string, containers ...string) *unstructured.Unstructured {
+		obj := labeled(kubernetes.PodKind, "dev", name, "dev", service)
+		var specs []any
+		for _, c := range containers {
+			specs = append(specs, map[string]any{"name": c})
+		}
+		_ = unstructured.SetNestedSlice(obj.Object, specs, "spec", "containers")
+		return obj
+	}
+	client, _ := kubetest.NewFakeClient("dev", pod("api-1", "api", "api", "proxy"), pod("db-0", "db", "db"))
+	logs := &fakeLogReader{streams: map[string]string{
+		"api-1/api":   "2024-05-01T10:00:01Z listening\n",
+		"api-1/proxy": "2024-05-01T10:00:00Z proxy up\n2024-05-01T10:00:02Z GET /health\n",
+		"db-0/db":     "2024-05-01T10:00:00Z ready\n",
+	}}
+	d := newTestK8sDriver(client, WithLogReader(logs))
+	project := &config.Project{Project: "ai-agents", Services: []*config.Service{{Name: "api"}, {Name: "db"}}}
+
+	var out strings.Builder
+	if err := d.Logs(ctx, project, "dev", []string{"api"}, LogOptions{Since: "10m", Tail: "50"}, &out); err != nil {
+		t.Fatalf("Logs() error = %v", err)
+	}
+	want := "api-1/proxy | proxy up\n" +
+		"api-1/api   | listening\n" +
+		"api-1/proxy | GET /health\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("Logs() output mismatch (-want +got):\n%s", diff)
+	}
+	wantCalls := []string{"dev/api-1/api follow=false since=600 tail=50", "dev/api-1/proxy follow=false since=600 tail=50"}
+	if diff := cmp.Diff(wantCalls, logs.calls); diff != "" {
+		t.Errorf("StreamPodLogs calls mismatch (-want +got):\n%s", diff)
+	}
+
+	var notFound *errors.NotFoundError
+	if err := d.Logs(ctx, project, "dev", []string{"worker"}, LogOptions{}, &out); !stderrors.As(err, &notFound) {
+		t.Errorf("Logs(worker) error = %v, want NotFoundError", err)
+	}
+	var verr *errors.ValidationError
+	if err := d.Logs(ctx, project, "dev", nil, LogOptions{Since: "yesterday"}, &out); !stderrors.As(err, &verr) {
+		t.Errorf("Logs(since yesterday) error = %v, want ValidationError", err)
+	}
+}
+
+func TestK8sDriver_StatusHealthy(t *testing.T) {
+	deploy := labeled(kubernetes.DeploymentKind, "dev", "api", "dev", "api")
+	_ = unstructured.SetNestedField(deploy.Object, int64(1), "status", "readyReplicas")
+	client, _ := kubetest.NewFakeClient("dev", deploy)
+
+	got, err := newTestK8sDriver(client).Status(context.Background(), k8sProject(), "dev")
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if !got.Healthy {
+		t.Errorf("Healthy = false, want true for %+v", got.Services)
+	}
+}
+
+func TestK8sDriver_Restart(t *testing.T) {
+	ctx := context.Background()
+	client, dyn := kubetest.NewFakeClient("dev",
+		labeled(kubernetes.DeploymentKind, "dev", "api", "dev", "api"),
+		labeled(kubernetes.DeploymentKind, "dev", "worker", "dev", "worker"),
+	)
+	rolloutController(dyn)
+	d := newTestK8sDriver(client)
+	d.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	if err := d.Restart(ctx, k8sProject(), "dev", RestartOptions{Services: []string{"api"}}); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+
+	for name, want := range map[string]string{"api": "2026-01-02T03:04:05Z", "worker": ""} {
+		obj, err := client.Get(ctx, kubernetes.DeploymentKind, "dev", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, _ := unstructured.NestedString(obj.Object, "spec", "template", "metadata", "annotations", restartedAtAnnotation)
+		if got != want {
+			t.Errorf("%s restartedAt = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRolloutComplete(t *testing.T) {
+	workload := func(gvk schema.GroupVersionKind, spec, status map[string]any) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]any{"spec": spec, "status": status}}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetName("w")
+		return obj
+	}
+
+	tests := map[string]struct {
+		obj     *unstructured.Unstructured
+		want    bool
+		wantErr bool
+	}{
+		"deployment available": {
+			obj: workload(kubernetes.DeploymentKind, map[string]any{"replicas": int64(2)},
+				map[string]any{"replicas": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(2)}),
+			want: true,
+		},
+		"deployment old replicas remain": {
+			obj: workload(kubernetes.DeploymentKind, map[string]any{"replicas": int64(2)},
+				map[string]any{"replicas": int64(3), "updatedReplicas": int64(2), "availableReplicas": int64(2)}),
+			want: false,
+		},
+		"deployment generation not observed": {
+			obj: func() *unstructured.Unstructured {
+				o := workload(kubernetes.DeploymentKind, map[string]any{"replicas": int64(1)},
+					map[string]any{"replicas": int64(1), "updatedReplicas": int64(1), "availableReplicas": int64(1), "observedGeneration": int64(1)})
+				o.SetGeneration(2)
+				return o
+			}(),
+			want: false,
+		},
+		"deployment deadline exceeded": {
+			obj: workload(kubernetes.DeploymentKind, map[string]any{},
+				map[string]any{"conditions": []any{map[string]any{"type": "Progressing", "reason": "ProgressDeadlineExceeded"}}}),
+			wantErr: true,
+		},
+		"statefulset ready": {
+			obj: workload(kubernetes.StatefulSetKind, map[string]any{"replicas": int64(1)},
+				map[string]any{"readyReplicas": int64(1), "updatedReplicas": int64(1)}),
+			want: true,
+		},
+		"daemonset partially available": {
+			obj: workload(kubernetes.DaemonSetKind, map[string]any{},
+				map[string]any{"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(3), "numberAvailable": int64(2)}),
+			want: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := rolloutComplete(tc.obj)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("rolloutComplete() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("rolloutComplete() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLabelObject_StatefulSetClaims(t *testing.T) {
+	obj := labeled(kubernetes.StatefulSetKind, "", "db", "dev", "db")
+	obj.SetLabels(map[string]string{LabelService: "db"})
+	_ = unstructured.SetNestedSlice(obj.Object, []any{
+		map[string]any{"metadata": map[string]any{"name": "data"}},
+	}, "spec", "volumeClaimTemplates")
+
+	labelObject(obj, "ai-agents", "dev")
+
+	claims, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+	claim := &unstructured.Unstructured{Object: claims[0].(map[string]any)}
+	if diff := cmp.Diff(Labels("ai-agents", "dev", "db"), claim.GetLabels()); diff != "" {
+		t.Errorf("claim labels mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,49 @@
+package fleet
+
+// Labels applied to every Docker and Kubernetes resource yar creates. They
+// let commands find a project's containers, networks, volumes and cluster
+// objects without consulting yar.yaml.
+const (
+	LabelManaged     = "yar.managed"
+	LabelProject     = "yar.project"
+	LabelEnvironment = "yar.environment"
+	LabelService     = "yar.service"
+	LabelInstance    = "yar.instance"
+)
+
+// Labels returns the labels for a resource belonging to a service.
+// An empty service yields fleet-wide labels (networks, shared volumes).
+// For an instance project (see InstanceProject), LabelProject holds the
+// instance project and LabelInstance the instance name.
+func Labels(project, env, service string) map[string]string {
+	labels := map[string]string{
+		LabelManaged:     "true",
+		LabelProject:     project,
+		LabelEnvironment: env,
+	}
+	if service != "" {
+		labels[LabelService] = service
+	}
+	if _, instance := SplitInstanceProject(project); instance != "" {
+		labels[LabelInstance] = instance
+	}
+	return labels
+}
+
+// LabelFilters returns Docker list filters selecting the resources of a
+// project environment.
+func LabelFilters(project, env string) map[string][]string {
+	return map[string][]string{
+		"label": {
+			LabelManaged + "=true",
+			LabelProject + "=" + project,
+			LabelEnvironment + "=" + env,
+		},
+	}
+}
+
+// LabelSelector returns a Kubernetes label selector matching the resources
+// of a project environment.
+func LabelSelector(project, env string) string {
+	return LabelManaged + "=true," + LabelProject + "=" + project + "," + LabelEnvironment + "=" + env
+}
@@ -0,0 +1,321 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/yar-run/yar/internal/kubernetes"
+)
+
+const (
+	// DefaultLeaseDuration is how long a fleet lease stays valid without
+	// being renewed. Holders renew it every third of the duration, so a
+	// lease outlives its holder by at most this long.
+	DefaultLeaseDuration = 30 * time.Second
+
+	// leaseNamePrefix prefixes the names of fleet leases.
+	leaseNamePrefix = "yar-lock-"
+
+	// leaseHolderAnnotation records the LockHolder of a lease as JSON.
+	leaseHolderAnnotation = "yar.lockHolder"
+
+	// leaseReleaseTimeout bounds releasing a lease, which may happen after
+	// the operation's context was cancelled.
+	leaseReleaseTimeout = 10 * time.Second
+)
+
+// LeaseLocker serializes mutating yar operations on a shared cluster with
+// a coordination.k8s.io Lease per project environment in the client's
+// namespace. It complements Locker, which only sees processes on the same
+// machine. A lease not renewed within its duration is expired and taken
+// over by the next caller (INV-FLT-007).
+type LeaseLocker struct {
+	client   kubernetes.Client
+	duration time.Duration
+	interval time.Duration
+	now      func() time.Time
+}
+
+// LeaseOption configures a LeaseLocker.
+type LeaseOption func(*LeaseLocker)
+
+// WithLeaseDuration overrides DefaultLeaseDuration.
+func WithLeaseDuration(duration time.Duration) LeaseOption {
+	return func(l *LeaseLocker) {
+		l.duration = duration
+	}
+}
+
+// WithLeasePollInterval overrides how often a held lease is re-checked.
+func WithLeasePollInterval(interval time.Duration) LeaseOption {
+	return func(l *LeaseLocker) {
+		l.interval = interval
+	}
+}
+
+// NewLeaseLocker creates a lease locker using client. The client should
+// not record actions: leases are taken outside dry runs only.
+func NewLeaseLocker(client kubernetes.Client, opts ...LeaseOption) *LeaseLocker {
+	l := &LeaseLocker{
+		client:   client,
+		duration: DefaultLeaseDuration,
+		interval: 2 * time.Second,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// LeaseName returns the Lease name of a project environment.
+func LeaseName(project, env string) string {
+	return leaseNamePrefix + dnsLabel(project) + "-" + dnsLabel(env)
+}
+
+// Lock takes the lease of a project environment for holder, waiting like
+// Locker.Lock. While held, the lease is renewed in the background. The
+// returned function stops renewing and deletes the lease if it is still
+// ours.
+func (l *LeaseLocker) Lock(ctx context.Context, project, env string, holder LockHolder, opts LockOptions) (func() error, error) {
+	name := FleetLockName(project, env)
+	identity := leaseIdentity(holder)
+	annotation, err := json.Marshal(holder)
+	if err != nil {
+		return nil, ErrLock(name, err)
+	}
+
+	var lease *unstructured.Unstructured
+	err = waitForLock(ctx, name, opts, l.interval, func() (*LockHolder, error) {
+		created, err := l.client.Create(ctx, l.newLease(project, env, identity, string(annotation)))
+		if err == nil {
+			lease = created
+			return nil, nil
+		}
+		if !kubernetes.IsAlreadyExists(err) {
+			return nil, err
+		}
+
+		current, err := l.client.Get(ctx, kubernetes.LeaseKind, "", LeaseName(project, env))
+		if kubernetes.IsNotFound(err) {
+			return nil, errRetryLock // Released since we tried
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !l.expired(current) {
+			return leaseHolder(current), nil
+		}
+
+		// Take over the expired lease. The update carries the
+		// resourceVersion read above, so of two callers taking it over at
+		// once only one succeeds.
+		l.claim(current, identity, string(annotation), true)
+		updated, err := l.client.Update(ctx, current)
+		if kubernetes.IsConflict(err) || kubernetes.IsNotFound(err) {
+			return nil, errRetryLock
+		}
+		if err != nil {
+			return nil, err
+		}
+		lease = updated
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &leaseRenewal{locker: l, identity: identity, lease: lease, stop: make(chan struct{}), done: make(chan struct{})}
+	go r.run()
+	return func() error { return r.release(name) }, nil
+}
+
+// newLease returns a Lease held by identity.
+func (l *LeaseLocker) newLease(project, env, identity, annotation string) *unstructured.Unstructured {
+	lease := &unstructured.Unstructured{}
+	lease.SetGroupVersionKind(kubernetes.LeaseKind)
+	lease.SetName(LeaseName(project, env))
+	lease.SetLabels(Labels(project, env, ""))
+	l.claim(lease, identity, annotation, true)
+	return lease
+}
+
+// claim records identity as the holder of lease, renewed now. acquire also
+// resets the acquire time, for a new holder.
+func (l *LeaseLocker) claim(lease *unstructured.Unstructured, identity, annotation string, acquire bool) {
+	now := l.now().UTC().Format(metav1.RFC3339Micro)
+	spec := map[string]any{}
+	if existing, ok, _ := unstructured.NestedMap(lease.Object, "spec"); ok {
+		spec = existing
+	}
+	spec["holderIdentity"] = identity
+	spec["leaseDurationSeconds"] = int64(l.duration.Seconds())
+	spec["renewTime"] = now
+	if acquire {
+		spec["acquireTime"] = now
+	}
+	_ = unstructured.SetNestedMap(lease.Object, spec, "spec")
+
+	annotations := lease.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[leaseHolderAnnotation] = annotation
+	lease.SetAnnotations(annotations)
+}
+
+// expired reports whether lease was not renewed within its duration, or
+// records no holder at all.
+func (l *LeaseLocker) expired(lease *unstructured.Unstructured) bool {
+	identity, _, _ := unstructured.NestedString(lease.Object, "spec", "holderIdentity")
+	if identity == "" {
+		return true
+	}
+	seconds, _, _ := unstructured.NestedInt64(lease.Object, "spec", "leaseDurationSeconds")
+	renewed, ok := leaseTime(lease, "renewTime")
+	if !ok {
+		renewed, ok = leaseTime(lease, "acquireTime")
+	}
+	if !ok {
+		return true
+	}
+	return l.now().After(renewed.Add(time.Duration(seconds) * time.Second))
+}
+
+// leaseRenewal keeps a taken lease alive until released.
+type leaseRenewal struct {
+	locker   *LeaseLocker
+	identity string
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+
+	mu    sync.Mutex
+	lease *unstructured.Unstructured
+}
+
+// run renews the lease every third of its duration. A failed renewal is
+// retried on the next tick; the lease only expires if renewals keep
+// failing for its whole duration.
+func (r *leaseRenewal) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.locker.duration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.renew()
+		}
+	}
+}
+
+// renew updates the lease's renew time if it is still ours.
+func (r *leaseRenewal) renew() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.locker.duration/3)
+	defer cancel()
+	current, err := r.locker.client.Get(ctx, kubernetes.LeaseKind, r.lease.GetNamespace(), r.lease.GetName())
+	if err != nil || leaseIdentityOf(current) != r.identity {
+		return
+	}
+	r.locker.claim(current, r.identity, current.GetAnnotations()[leaseHolderAnnotation], false)
+	if updated, err := r.locker.client.Update(ctx, current); err == nil {
+		r.lease = updated
+	}
+}
+
+// release stops renewing and deletes the lease unless another holder took
+// it over since.
+func (r *leaseRenewal) release(name string) error {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), leaseReleaseTimeout)
+	defer cancel()
+	current, err := r.locker.client.Get(ctx, kubernetes.LeaseKind, r.lease.GetNamespace(), r.lease.GetName())
+	if kubernetes.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return ErrLock(name, err)
+	}
+	if leaseIdentityOf(current) != r.identity {
+		return nil
+	}
+	if err := r.locker.client.Delete(ctx, kubernetes.LeaseKind, current.GetNamespace(), current.GetName()); err != nil {
+		return ErrLock(name, err)
+	}
+	return nil
+}
+
+// leaseIdentity returns the holderIdentity of holder's leases.
+func leaseIdentity(holder LockHolder) string {
+	return holder.Host + "/" + strconv.Itoa(holder.PID)
+}
+
+// leaseIdentityOf returns the holderIdentity recorded in lease.
+func leaseIdentityOf(lease *unstructured.Unstructured) string {
+	identity, _, _ := unstructured.NestedString(lease.Object, "spec", "holderIdentity")
+	return identity
+}
+
+// leaseHolder returns the holder recorded in lease. Leases taken by other
+// tools carry no holder annotation; their holderIdentity is used instead.
+func leaseHolder(lease *unstructured.Unstructured) *LockHolder {
+	var holder LockHolder
+	if json.Unmarshal([]byte(lease.GetAnnotations()[leaseHolderAnnotation]), &holder) == nil && holder.PID != 0 {
+		return &holder
+	}
+	identity := leaseIdentityOf(lease)
+	if host, pid, ok := strings.Cut(identity, "/"); ok {
+		holder.Host = host
+		holder.PID, _ = strconv.Atoi(pid)
+	}
+	if t, ok := leaseTime(lease, "acquireTime"); ok {
+		holder.StartedAt = t
+	}
+	return &holder
+}
+
+// leaseTime parses a MicroTime field of a lease spec.
+func leaseTime(lease *unstructured.Unstructured, field string) (time.Time, bool) {
+	s, _, _ := unstructured.NestedString(lease.Object, "spec", field)
+	if s == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(metav1.RFC3339Micro, s)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			return time.Time{}, false
+		}
+	}
+	return t, true
+}
+
+// dnsLabel lowercases s and replaces characters not allowed in Kubernetes
+// object names with '-'.
+func dnsLabel(s string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, s), "-")
+}
@@ -0,0 +1,178 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/kubernetes/kubetest"
+)
+
+// newTestLease returns a lease of shop/dev held by identity, last renewed
+// at renewed.
+func newTestLease(identity string, renewed time.Time) *unstructured.Unstructured {
+	lease := &unstructured.Unstructured{}
+	lease.SetGroupVersionKind(kubernetes.LeaseKind)
+	lease.SetNamespace("dev")
+	lease.SetName(LeaseName("shop", "dev"))
+	_ = unstructured.SetNestedMap(lease.Object, map[string]any{
+		"holderIdentity":       identity,
+		"leaseDurationSeconds": int64(30),
+		"acquireTime":          renewed.UTC().Format(metav1.RFC3339Micro),
+		"renewTime":            renewed.UTC().Format(metav1.RFC3339Micro),
+	}, "spec")
+	return lease
+}
+
+func getLease(t *testing.T, client kubernetes.Client) *unstructured.Unstructured {
+	t.Helper()
+	lease, err := client.Get(context.Background(), kubernetes.LeaseKind, "dev", LeaseName("shop", "dev"))
+	if err != nil {
+		t.Fatalf("Get(lease) error = %v", err)
+	}
+	return lease
+}
+
+func TestLeaseName(t *testing.T) {
+	if got, want := LeaseName("Shop_API", "dev.eu"), "yar-lock-shop-api-dev-eu"; got != want {
+		t.Errorf("LeaseName() = %q, want %q", got, want)
+	}
+}
+
+func TestLeaseLocker_LockAndRelease(t *testing.T) {
+	ctx := context.Background()
+	client, _ := kubetest.NewFakeClient("dev")
+	l := NewLeaseLocker(client, WithLeasePollInterval(time.Millisecond))
+	holder := LockHolder{PID: 4242, Host: "laptop", Command: "yar fleet up dev", StartedAt: time.Now().UTC()}
+
+	release, err := l.Lock(ctx, "shop", "dev", holder, LockOptions{})
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	lease := getLease(t, client)
+	if got := leaseIdentityOf(lease); got != "laptop/4242" {
+		t.Errorf("holderIdentity = %q, want laptop/4242", got)
+	}
+	if lease.GetLabels()[LabelProject] != "shop" || lease.GetLabels()[LabelEnvironment] != "dev" {
+		t.Errorf("lease labels = %v", lease.GetLabels())
+	}
+	var recorded LockHolder
+	if err := json.Unmarshal([]byte(lease.GetAnnotations()[leaseHolderAnnotation]), &recorded); err != nil || recorded.Command != holder.Command {
+		t.Errorf("holder annotation = %q", lease.GetAnnotations()[leaseHolderAnnotation])
+	}
+
+	other := LockHolder{PID: 7, Host: "desktop", Command: "yar fleet down dev"}
+	_, err = l.Lock(ctx, "shop", "dev", other, LockOptions{NoWait: true})
+	var fleetErr *FleetError
+	if !stderrors.As(err, &fleetErr) || fleetErr.Op != "lock" || !strings.Contains(err.Error(), "pid 4242 on laptop") {
+		t.Fatalf("Lock() while held error = %v, want lock error naming the holder", err)
+	}
+
+	if err := release(); err != nil {
+		t.Fatalf("release() error = %v", err)
+	}
+	if _, err := client.Get(ctx, kubernetes.LeaseKind, "dev", LeaseName("shop", "dev")); !kubernetes.IsNotFound(err) {
+		t.Errorf("lease after release: error = %v, want not found", err)
+	}
+}
+
+func TestLeaseLocker_TakesOverExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	client, dyn := kubetest.NewFakeClient("dev", newTestLease("desktop/7", time.Now().Add(-time.Minute)))
+	l := NewLeaseLocker(client, WithLeasePollInterval(time.Millisecond))
+
+	// The first takeover loses a race with another caller; the fake does
+	// not check resourceVersions, so the conflict is injected.
+	conflicts := 0
+	dyn.PrependReactor("update", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, "lock", stderrors.New("stale"))
+	})
+
+	release, err := l.Lock(ctx, "shop", "dev", LockHolder{PID: 4242, Host: "laptop"}, LockOptions{NoWait: true})
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer release()
+	if conflicts != 1 {
+		t.Errorf("conflicts = %d, want 1", conflicts)
+	}
+	if got := leaseIdentityOf(getLease(t, client)); got != "laptop/4242" {
+		t.Errorf("holderIdentity = %q, want laptop/4242", got)
+	}
+}
+
+func TestLeaseLocker_ForeignHolder(t *testing.T) {
+	client, _ := kubetest.NewFakeClient("dev", newTestLease("desktop/7", time.Now()))
+	l := NewLeaseLocker(client, WithLeasePollInterval(time.Millisecond))
+
+	_, err := l.Lock(context.Background(), "shop", "dev", LockHolder{PID: 4242, Host: "laptop"}, LockOptions{Timeout: 10 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "pid 7 on desktop") || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Lock() error = %v, want timeout naming pid 7 on desktop", err)
+	}
+}
+
+func TestLeaseLocker_RenewsUntilReleased(t *testing.T) {
+	client, _ := kubetest.NewFakeClient("dev")
+	l := NewLeaseLocker(client, WithLeaseDuration(30*time.Millisecond))
+	release, err := l.Lock(context.Background(), "shop", "dev", LockHolder{PID: 4242, Host: "laptop"}, LockOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := leaseTime(getLease(t, client), "renewTime")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		renewed, _ := leaseTime(getLease(t, client), "renewTime")
+		if renewed.After(first) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("lease was not renewed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := release(); err != nil {
+		t.Fatalf("release() error = %v", err)
+	}
+}
+
+func TestLeaseLocker_ReleaseKeepsOtherHolder(t *testing.T) {
+	ctx := context.Background()
+	client, _ := kubetest.NewFakeClient("dev")
+	l := NewLeaseLocker(client)
+	release, err := l.Lock(ctx, "shop", "dev", LockHolder{PID: 4242, Host: "laptop"}, LockOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another holder took the lease over after it expired.
+	lease := getLease(t, client)
+	_ = unstructured.SetNestedField(lease.Object, "desktop/7", "spec", "holderIdentity")
+	if _, err := client.Update(ctx, lease); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := release(); err != nil {
+		t.Fatalf("release() error = %v", err)
+	}
+	if got := leaseIdentityOf(getLease(t, client)); got != "desktop/7" {
+		t.Errorf("holderIdentity after release = %q, want desktop/7", got)
+	}
+}
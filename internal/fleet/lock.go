@@ -0,0 +1,352 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/platform"
+)
+
+const (
+	// LockDirName is the directory under platform.DataDir() holding
+	// operation locks.
+	LockDirName = "locks"
+
+	// DefaultLockTimeout bounds how long an operation waits for another yar
+	// process to release a lock.
+	DefaultLockTimeout = 2 * time.Minute
+
+	// lockFileExt is the file extension of an operation lock.
+	lockFileExt = ".lock"
+
+	// defaultLockPollInterval is how often a held lock is re-checked.
+	defaultLockPollInterval = 250 * time.Millisecond
+
+	// unreadableLockAge is how old a lock file without a valid holder must
+	// be before it counts as stale. A younger one may still be being
+	// written by the process that created it.
+	unreadableLockAge = 5 * time.Second
+)
+
+// LockHolder identifies the yar process holding an operation lock.
+type LockHolder struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// NewLockHolder describes the current process running command.
+func NewLockHolder(command string) LockHolder {
+	host, _ := os.Hostname()
+	return LockHolder{
+		PID:       os.Getpid(),
+		Host:      host,
+		Command:   command,
+		StartedAt: time.Now().UTC(),
+	}
+}
+
+// String returns the holder as `pid 4242 on laptop ("yar fleet up") since
+// 15:04:05`.
+func (h LockHolder) String() string {
+	if h.PID == 0 {
+		return "an unknown process"
+	}
+	s := fmt.Sprintf("pid %d", h.PID)
+	if h.Host != "" {
+		s += " on " + h.Host
+	}
+	if h.Command != "" {
+		s += fmt.Sprintf(" (%q)", h.Command)
+	}
+	if !h.StartedAt.IsZero() {
+		s += " since " + h.StartedAt.Local().Format(time.DateTime)
+	}
+	return s
+}
+
+// LockOptions configures how an operation lock is acquired.
+type LockOptions struct {
+	Timeout time.Duration    // How long to wait for the holder; DefaultLockTimeout when zero
+	NoWait  bool             // Fail at once if the lock is held
+	OnWait  func(LockHolder) // Called once if the lock is held and the caller waits
+}
+
+// Locker serializes mutating yar operations across processes with
+// advisory lock files under <DataDir>/locks. A lock file records its
+// holder; a lock whose holder process is gone on this host is stale and is
+// broken by the next caller (INV-FLT-007).
+type Locker struct {
+	dir      string
+	interval time.Duration
+	alive    func(pid int) bool
+	host     string
+}
+
+// LockerOption configures a Locker.
+type LockerOption func(*Locker)
+
+// WithLockDir sets the directory holding lock files.
+func WithLockDir(dir string) LockerOption {
+	return func(l *Locker) {
+		l.dir = dir
+	}
+}
+
+// WithLockPollInterval overrides how often a held lock is re-checked.
+func WithLockPollInterval(interval time.Duration) LockerOption {
+	return func(l *Locker) {
+		l.interval = interval
+	}
+}
+
+// NewLocker creates a locker. Defaults to <DataDir>/locks.
+func NewLocker(opts ...LockerOption) (*Locker, error) {
+	host, _ := os.Hostname()
+	l := &Locker{
+		interval: defaultLockPollInterval,
+		alive:    platform.ProcessAlive,
+		host:     host,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if l.dir == "" {
+		dataDir, err := platform.DataDir()
+		if err != nil {
+			return nil, ErrLock("", err)
+		}
+		l.dir = filepath.Join(dataDir, LockDirName)
+	}
+	return l, nil
+}
+
+// FleetLockName returns the lock name of a project environment.
+func FleetLockName(project, env string) string {
+	return project + "/" + env
+}
+
+// Path returns the lock file path for name.
+func (l *Locker) Path(name string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(name)+lockFileExt)
+}
+
+// Lock takes the lock name for holder, waiting for another holder to
+// release it unless opts.NoWait is set. It fails with a FleetError naming
+// the other holder once opts.Timeout elapses or ctx is cancelled. The lock
+// is released by calling the returned function.
+func (l *Locker) Lock(ctx context.Context, name string, holder LockHolder, opts LockOptions) (func() error, error) {
+	if err := checkLockName(name); err != nil {
+		return nil, err
+	}
+	path := l.Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, ErrLock(name, err)
+	}
+	data, err := json.Marshal(holder)
+	if err != nil {
+		return nil, ErrLock(name, err)
+	}
+
+	var release func() error
+	err = waitForLock(ctx, name, opts, l.interval, func() (*LockHolder, error) {
+		created, err := createLockFile(path, data)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			release = func() error { return l.release(name, data) }
+			return nil, nil
+		}
+
+		current, raw, info, err := readLockFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if info == nil {
+			return nil, errRetryLock // Released since we tried
+		}
+		if l.stale(current, info) {
+			if err := breakLockFile(path, raw); err != nil {
+				return nil, err
+			}
+			return nil, errRetryLock
+		}
+		if current == nil {
+			return &LockHolder{}, nil
+		}
+		return current, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// errRetryLock is returned by a waitForLock attempt that found the lock
+// free again, or just broke it, and should be retried at once.
+var errRetryLock = stderrors.New("retry lock")
+
+// waitForLock calls try until it takes the lock, which it signals by
+// returning a nil holder and error. While another holder has the lock it
+// waits as opts say, re-trying every interval. Errors other than
+// errRetryLock are wrapped and returned.
+func waitForLock(ctx context.Context, name string, opts LockOptions, interval time.Duration, try func() (*LockHolder, error)) error {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultLockTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	waited := false
+	for {
+		holder, err := try()
+		if err == errRetryLock {
+			continue
+		}
+		if err != nil {
+			return ErrLock(name, err)
+		}
+		if holder == nil {
+			return nil
+		}
+
+		if opts.NoWait {
+			return ErrLocked(name, *holder, nil)
+		}
+		if !waited && opts.OnWait != nil {
+			opts.OnWait(*holder)
+		}
+		waited = true
+		if time.Now().After(deadline) {
+			return ErrLocked(name, *holder, fmt.Errorf("timed out after %s", timeout))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrLocked(name, *holder, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// release removes the lock file if it still records the holder written by
+// Lock, so a lock broken as stale and taken by another process is left
+// alone.
+func (l *Locker) release(name string, data []byte) error {
+	path := l.Path(name)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return ErrLock(name, err)
+	}
+	if !bytes.Equal(raw, data) {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return ErrLock(name, err)
+	}
+	return nil
+}
+
+// stale reports whether a lock can be broken: its holder ran on this host
+// and is no longer running, or it has no readable holder and is older than
+// unreadableLockAge.
+func (l *Locker) stale(holder *LockHolder, info os.FileInfo) bool {
+	if holder == nil {
+		return time.Since(info.ModTime()) > unreadableLockAge
+	}
+	return holder.Host == l.host && !l.alive(holder.PID)
+}
+
+// createLockFile creates path exclusively with data. It reports false if
+// the file exists. O_EXCL creation is atomic on every supported platform.
+func createLockFile(path string, data []byte) (bool, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return false, err
+	}
+	return true, nil
+}
+
+// readLockFile returns the holder recorded in path, nil if it cannot be
+// parsed, and the raw content. info is nil if the file no longer exists.
+func readLockFile(path string) (holder *LockHolder, raw []byte, info os.FileInfo, err error) {
+	info, err = os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil, nil
+		}
+		return nil, nil, nil, err
+	}
+	raw, err = os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil, nil
+		}
+		return nil, nil, nil, err
+	}
+	var h LockHolder
+	if json.Unmarshal(raw, &h) != nil || h.PID == 0 {
+		return nil, raw, info, nil
+	}
+	return &h, raw, info, nil
+}
+
+// breakLockFile removes a stale lock file, unless its content changed
+// since it was judged stale, meaning another process broke it and took
+// the lock in the meantime.
+func breakLockFile(path string, raw []byte) error {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !bytes.Equal(current, raw) {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// checkLockName rejects lock names with segments that would escape the
+// lock directory.
+func checkLockName(name string) error {
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." || strings.Contains(part, `\`) {
+			return &errors.ValidationError{
+				Field:   "lock",
+				Value:   name,
+				Message: "lock names must be non-empty path segments",
+			}
+		}
+	}
+	return nil
+}
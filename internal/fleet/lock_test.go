@@ -0,0 +1,258 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yar-run/yar/internal/errors"
+)
+
+func newTestLocker(t *testing.T) *Locker {
+	t.Helper()
+	l, err := NewLocker(WithLockDir(t.TempDir()), WithLockPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewLocker() error = %v", err)
+	}
+	return l
+}
+
+// writeLock writes a lock file for holder as another process would.
+func writeLock(t *testing.T, l *Locker, name string, holder LockHolder) {
+	t.Helper()
+	data, err := json.Marshal(holder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := l.Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewLocker_DefaultDir(t *testing.T) {
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+
+	l, err := NewLocker()
+	if err != nil {
+		t.Fatalf("NewLocker() error = %v", err)
+	}
+	want := filepath.Join(dataHome, "yar", LockDirName, "shop", "local.lock")
+	if got := l.Path(FleetLockName("shop", "local")); got != want {
+		t.Errorf("Path() = %q, want %q", got, want)
+	}
+}
+
+func TestLocker_LockAndRelease(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocker(t)
+	name := FleetLockName("shop", "local")
+
+	release, err := l.Lock(ctx, name, NewLockHolder("yar fleet up"), LockOptions{})
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	// The lock records its holder for other processes.
+	data, err := os.ReadFile(l.Path(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var holder LockHolder
+	if err := json.Unmarshal(data, &holder); err != nil {
+		t.Fatal(err)
+	}
+	if holder.PID != os.Getpid() || holder.Command != "yar fleet up" || holder.StartedAt.IsZero() {
+		t.Errorf("recorded holder = %+v", holder)
+	}
+
+	_, err = l.Lock(ctx, name, NewLockHolder("yar fleet down"), LockOptions{NoWait: true})
+	var fleetErr *FleetError
+	if !stderrors.As(err, &fleetErr) || fleetErr.Op != "lock" {
+		t.Fatalf("Lock() while held error = %v, want lock FleetError", err)
+	}
+	if !strings.Contains(err.Error(), `"yar fleet up"`) {
+		t.Errorf("error %q does not name the holder's command", err)
+	}
+
+	if err := release(); err != nil {
+		t.Fatalf("release() error = %v", err)
+	}
+	if _, err := os.Stat(l.Path(name)); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists after release: %v", err)
+	}
+	release, err = l.Lock(ctx, name, NewLockHolder("yar fleet down"), LockOptions{NoWait: true})
+	if err != nil {
+		t.Fatalf("Lock() after release error = %v", err)
+	}
+	release()
+}
+
+func TestLocker_WaitsForHolder(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocker(t)
+
+	release, err := l.Lock(ctx, "hosts", NewLockHolder("yar hosts set"), LockOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waits := 0
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+
+	release2, err := l.Lock(ctx, "hosts", NewLockHolder("yar hosts delete"), LockOptions{
+		Timeout: 5 * time.Second,
+		OnWait: func(h LockHolder) {
+			waits++
+			if h.Command != "yar hosts set" {
+				t.Errorf("OnWait holder = %+v", h)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer release2()
+	if waits != 1 {
+		t.Errorf("OnWait called %d times, want 1", waits)
+	}
+}
+
+func TestLocker_Timeout(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocker(t)
+	release, err := l.Lock(ctx, "hosts", NewLockHolder("yar hosts set"), LockOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	_, err = l.Lock(ctx, "hosts", NewLockHolder("yar hosts delete"), LockOptions{Timeout: 20 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 20ms") {
+		t.Errorf("Lock() error = %v, want timeout", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = l.Lock(cancelled, "hosts", NewLockHolder("yar hosts delete"), LockOptions{})
+	if !stderrors.Is(err, context.Canceled) {
+		t.Errorf("Lock() cancelled error = %v, want context.Canceled", err)
+	}
+}
+
+func TestLocker_BreaksStaleLocks(t *testing.T) {
+	ctx := context.Background()
+	dead := LockHolder{PID: 4242, Command: "yar fleet up", StartedAt: time.Now()}
+
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T, l *Locker)
+		wantHeld bool
+	}{
+		{
+			name: "dead holder on this host",
+			setup: func(t *testing.T, l *Locker) {
+				h := dead
+				h.Host = l.host
+				writeLock(t, l, "shop/local", h)
+			},
+		},
+		{
+			name: "holder on another host",
+			setup: func(t *testing.T, l *Locker) {
+				h := dead
+				h.Host = "elsewhere"
+				writeLock(t, l, "shop/local", h)
+			},
+			wantHeld: true,
+		},
+		{
+			name: "old unreadable lock",
+			setup: func(t *testing.T, l *Locker) {
+				path := l.Path("shop/local")
+				os.MkdirAll(filepath.Dir(path), 0755)
+				os.WriteFile(path, nil, 0644)
+				old := time.Now().Add(-time.Minute)
+				if err := os.Chtimes(path, old, old); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "fresh unreadable lock",
+			setup: func(t *testing.T, l *Locker) {
+				path := l.Path("shop/local")
+				os.MkdirAll(filepath.Dir(path), 0755)
+				os.WriteFile(path, nil, 0644)
+			},
+			wantHeld: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLocker(t)
+			l.alive = func(pid int) bool { return pid != dead.PID }
+			tt.setup(t, l)
+
+			release, err := l.Lock(ctx, "shop/local", NewLockHolder("yar fleet down"), LockOptions{NoWait: true})
+			if held := err != nil; held != tt.wantHeld {
+				t.Fatalf("Lock() error = %v, want held = %v", err, tt.wantHeld)
+			}
+			if release != nil {
+				release()
+			}
+		})
+	}
+}
+
+func TestLocker_ReleaseKeepsOtherHolder(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocker(t)
+	release, err := l.Lock(ctx, "hosts", NewLockHolder("yar hosts set"), LockOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process broke the lock as stale and took it.
+	other := LockHolder{PID: 99, Host: "elsewhere", Command: "yar hosts delete", StartedAt: time.Now()}
+	writeLock(t, l, "hosts", other)
+
+	if err := release(); err != nil {
+		t.Fatalf("release() error = %v", err)
+	}
+	if _, err := os.Stat(l.Path("hosts")); err != nil {
+		t.Errorf("release() removed another holder's lock: %v", err)
+	}
+}
+
+func TestLocker_RejectsUnsafeNames(t *testing.T) {
+	l := newTestLocker(t)
+	for _, name := range []string{"", "shop/", "../x", "shop/..", `a\b`} {
+		_, err := l.Lock(context.Background(), name, NewLockHolder("yar"), LockOptions{NoWait: true})
+		if _, ok := err.(*errors.ValidationError); !ok {
+			t.Errorf("Lock(%q) error = %v, want ValidationError", name, err)
+		}
+	}
+}
+
+func TestLockHolder_String(t *testing.T) {
+	h := LockHolder{PID: 4242, Host: "laptop", Command: "yar fleet up dev"}
+	if got, want := h.String(), `pid 4242 on laptop ("yar fleet up dev")`; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := (LockHolder{}).String(); got != "an unknown process" {
+		t.Errorf("String() of empty holder = %q", got)
+	}
+}
@@ -0,0 +1,282 @@
+package fleet
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// maxLogLineSize bounds a single log line.
+const maxLogLineSize = 1024 * 1024
+
+// logColors are the ANSI colors assigned to services. Red is left out so
+// it stays reserved for errors.
+var logColors = []string{"36", "32", "33", "35", "34", "96", "92", "93", "95", "94"}
+
+// LogOptions configures fleet log streaming.
+type LogOptions struct {
+	Follow     bool           // Keep streaming new output
+	Since      string         // Only show logs since timestamp or relative duration
+	Tail       string         // Lines from the end of each container's log, or "all"
+	Timestamps bool           // Show the timestamp of each line
+	Grep       *regexp.Regexp // Only show lines matching this pattern
+	Color      bool           // Colorize the per-container prefix
+}
+
+// LogSource is a container whose logs are streamed.
+type LogSource struct {
+	Service   string
+	Container docker.Container
+}
+
+// LogLine is a single line of container output.
+type LogLine struct {
+	Time      time.Time
+	Service   string
+	Container string
+	Stream    string // stdout or stderr
+	Text      string
+}
+
+// SelectLogSources returns the containers of a project environment, all
+// replicas included, restricted to the given services when any are named.
+// Each container is inspected so TTY streams can be told apart from
+// multiplexed ones.
+func SelectLogSources(ctx context.Context, client docker.Client, project, env string, services []string) ([]LogSource, error) {
+	containers, err := client.ContainerList(ctx, docker.ContainerListOptions{
+		All:     true,
+		Filters: LabelFilters(project, env),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(services))
+	for _, svc := range services {
+		wanted[svc] = true
+	}
+
+	found := make(map[string]bool)
+	var sources []LogSource
+	for _, c := range containers {
+		svc := c.Labels[LabelService]
+		if len(wanted) > 0 && !wanted[svc] {
+			continue
+		}
+		found[svc] = true
+
+		inspected, err := client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, LogSource{Service: svc, Container: *inspected})
+	}
+
+	for _, svc := range services {
+		if !found[svc] {
+			return nil, &errors.NotFoundError{
+				Resource: "service",
+				Name:     svc,
+				Message:  fmt.Sprintf("no containers for service in %s/%s", project, env),
+			}
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Service != sources[j].Service {
+			return sources[i].Service < sources[j].Service
+		}
+		return sources[i].Container.Name < sources[j].Container.Name
+	})
+	return sources, nil
+}
+
+// logStream is the output of one container, on Docker or Kubernetes.
+type logStream struct {
+	service string
+	name    string                                           // Prefix of the stream's lines
+	tty     bool                                             // One raw stream rather than Docker's multiplexed stdout and stderr
+	open    func(ctx context.Context) (io.ReadCloser, error) // Opens the stream, with timestamps
+	readErr func(err error) error                            // Wraps an error reading the stream
+}
+
+// StreamLogs merges the stdout and stderr of all sources into w. Each line
+// is prefixed with its container name. Without Follow, all lines are
+// collected and written in timestamp order; with Follow, lines are written
+// as they arrive until ctx is cancelled or every stream ends.
+func StreamLogs(ctx context.Context, client docker.Client, sources []LogSource, opts LogOptions, w io.Writer) error {
+	streams := make([]logStream, len(sources))
+	for i, src := range sources {
+		streams[i] = logStream{
+			service: src.Service,
+			name:    src.Container.Name,
+			tty:     src.Container.TTY,
+			open: func(ctx context.Context) (io.ReadCloser, error) {
+				// Timestamps are always requested so lines can be ordered;
+				// they are stripped on output unless the caller asked for them.
+				return client.ContainerLogs(ctx, src.Container.ID, docker.LogOptions{
+					Follow:     opts.Follow,
+					Since:      opts.Since,
+					Tail:       opts.Tail,
+					Timestamps: true,
+				})
+			},
+			readErr: func(err error) error { return docker.ErrContainerLogs(src.Container.Name, err) },
+		}
+	}
+	return mergeLogs(ctx, streams, opts, w)
+}
+
+// mergeLogs merges the lines of streams into w as StreamLogs describes.
+func mergeLogs(ctx context.Context, streams []logStream, opts LogOptions, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	width := 0
+	for _, s := range streams {
+		if len(s.name) > width {
+			width = len(s.name)
+		}
+	}
+
+	lines := make(chan LogLine, 256)
+	errs := make(chan error, len(streams))
+	var wg sync.WaitGroup
+
+	for _, s := range streams {
+		rc, err := s.open(ctx)
+		if err != nil {
+			cancel()
+			wg.Wait()
+			return err
+		}
+
+		wg.Add(1)
+		go func(s logStream, rc io.ReadCloser) {
+			defer wg.Done()
+			defer rc.Close()
+			if err := readLogStream(ctx, s, rc, opts.Grep, lines); err != nil {
+				errs <- err
+			}
+		}(s, rc)
+	}
+
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	var collected []LogLine
+	for line := range lines {
+		if opts.Follow {
+			writeLogLine(w, line, width, opts)
+			continue
+		}
+		collected = append(collected, line)
+	}
+
+	sort.SliceStable(collected, func(i, j int) bool {
+		return collected[i].Time.Before(collected[j].Time)
+	})
+	for _, line := range collected {
+		writeLogLine(w, line, width, opts)
+	}
+
+	close(errs)
+	for err := range errs {
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLogStream demultiplexes one stream and sends its lines to out.
+func readLogStream(ctx context.Context, s logStream, rc io.Reader, grep *regexp.Regexp, out chan<- LogLine) error {
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+
+	demuxDone := make(chan error, 1)
+	go func() {
+		err := docker.DemuxLogs(rc, s.tty, stdoutW, stderrW)
+		stdoutW.Close()
+		stderrW.Close()
+		demuxDone <- err
+	}()
+
+	var wg sync.WaitGroup
+	for stream, r := range map[string]*io.PipeReader{"stdout": stdoutR, "stderr": stderrR} {
+		wg.Add(1)
+		go func(stream string, r *io.PipeReader) {
+			defer wg.Done()
+			// Closing the reader unblocks the demultiplexer if we stop early.
+			defer r.Close()
+			scanner := bufio.NewScanner(r)
+			scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+			for scanner.Scan() {
+				line := parseLogLine(scanner.Text())
+				if grep != nil && !grep.MatchString(line.Text) {
+					continue
+				}
+				line.Service = s.service
+				line.Container = s.name
+				line.Stream = stream
+				select {
+				case out <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(stream, r)
+	}
+	wg.Wait()
+
+	if err := <-demuxDone; err != nil && err != io.ErrClosedPipe && ctx.Err() == nil {
+		return s.readErr(err)
+	}
+	return nil
+}
+
+// parseLogLine splits a Docker or Kubernetes timestamp prefix from a log line. Lines
+// without a parseable timestamp keep a zero time and their full text.
+func parseLogLine(raw string) LogLine {
+	raw = strings.TrimSuffix(raw, "\r")
+	ts, text, ok := strings.Cut(raw, " ")
+	if ok {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return LogLine{Time: t, Text: text}
+		}
+	}
+	return LogLine{Text: raw}
+}
+
+// writeLogLine writes a prefixed log line.
+func writeLogLine(w io.Writer, line LogLine, width int, opts LogOptions) {
+	prefix := fmt.Sprintf("%-*s |", width, line.Container)
+	if opts.Color {
+		prefix = "\x1b[" + ServiceColor(line.Service) + "m" + prefix + "\x1b[0m"
+	}
+	if opts.Timestamps && !line.Time.IsZero() {
+		fmt.Fprintf(w, "%s %s %s\n", prefix, line.Time.Format(time.RFC3339Nano), line.Text)
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", prefix, line.Text)
+}
+
+// ServiceColor returns the ANSI color code for a service. The color depends
+// only on the service name, so it is stable across runs and replicas.
+func ServiceColor(service string) string {
+	h := fnv.New32a()
+	h.Write([]byte(service))
+	return logColors[h.Sum32()%uint32(len(logColors))]
+}
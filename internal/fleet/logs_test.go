@@ -0,0 +1,252 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/google/go-cmp/cmp"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// muxed builds a multiplexed Docker log stream from stdout and stderr text.
+func muxed(t *testing.T, stdout, stderr string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if stdout != "" {
+		if _, err := stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(stdout)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stderr != "" {
+		if _, err := stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte(stderr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+func newLogsMock(t *testing.T) *docker.MockClient {
+	t.Helper()
+	mock := docker.NewMockClient()
+	mock.ContainerListResult = []docker.Container{
+		{ID: "c-app-2", Name: "ai-agents-app-2", Labels: Labels("ai-agents", "local", "app")},
+		{ID: "c-redis", Name: "ai-agents-redis", Labels: Labels("ai-agents", "local", "redis")},
+		{ID: "c-app-1", Name: "ai-agents-app-1", Labels: Labels("ai-agents", "local", "app")},
+	}
+	mock.ContainerInspectResults = map[string]*docker.Container{
+		"c-app-1": {ID: "c-app-1", Name: "ai-agents-app-1"},
+		"c-app-2": {ID: "c-app-2", Name: "ai-agents-app-2"},
+		"c-redis": {ID: "c-redis", Name: "ai-agents-redis", TTY: true},
+	}
+	mock.ContainerLogsResults = map[string]string{
+		"c-app-1": muxed(t,
+			"2026-01-01T00:00:01.000000000Z app1 started\n",
+			"2026-01-01T00:00:04.000000000Z app1 warning\n"),
+		"c-app-2": muxed(t,
+			"2026-01-01T00:00:03.000000000Z app2 started\n",
+			""),
+		// TTY containers produce a raw, unframed stream.
+		"c-redis": "2026-01-01T00:00:02.000000000Z redis ready\r\n",
+	}
+	return mock
+}
+
+func TestSelectLogSources(t *testing.T) {
+	ctx := context.Background()
+	mock := newLogsMock(t)
+
+	sources, err := SelectLogSources(ctx, mock, "ai-agents", "local", nil)
+	if err != nil {
+		t.Fatalf("SelectLogSources() error = %v", err)
+	}
+
+	var names []string
+	for _, src := range sources {
+		names = append(names, src.Container.Name)
+	}
+	want := []string{"ai-agents-app-1", "ai-agents-app-2", "ai-agents-redis"}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("sources mismatch (-want +got):\n%s", diff)
+	}
+	if !sources[2].Container.TTY {
+		t.Error("redis source TTY = false, want true (from inspect)")
+	}
+
+	if len(mock.ContainerListCalls) != 1 {
+		t.Fatalf("ContainerList calls = %d, want 1", len(mock.ContainerListCalls))
+	}
+	call := mock.ContainerListCalls[0]
+	if !call.All {
+		t.Error("ContainerList All = false, want true")
+	}
+	if diff := cmp.Diff(LabelFilters("ai-agents", "local"), call.Filters); diff != "" {
+		t.Errorf("ContainerList filters mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSelectLogSources_ServiceFilter(t *testing.T) {
+	ctx := context.Background()
+	mock := newLogsMock(t)
+
+	sources, err := SelectLogSources(ctx, mock, "ai-agents", "local", []string{"redis"})
+	if err != nil {
+		t.Fatalf("SelectLogSources() error = %v", err)
+	}
+	if len(sources) != 1 || sources[0].Service != "redis" {
+		t.Errorf("SelectLogSources(redis) = %+v, want only redis", sources)
+	}
+
+	_, err = SelectLogSources(ctx, mock, "ai-agents", "local", []string{"kafka"})
+	if _, ok := err.(*errors.NotFoundError); !ok {
+		t.Errorf("SelectLogSources(kafka) error = %T (%v), want *errors.NotFoundError", err, err)
+	}
+}
+
+func TestStreamLogs_MergesByTimestamp(t *testing.T) {
+	ctx := context.Background()
+	mock := newLogsMock(t)
+
+	sources, err := SelectLogSources(ctx, mock, "ai-agents", "local", nil)
+	if err != nil {
+		t.Fatalf("SelectLogSources() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := StreamLogs(ctx, mock, sources, LogOptions{Tail: "all"}, &out); err != nil {
+		t.Fatalf("StreamLogs() error = %v", err)
+	}
+
+	want := strings.Join([]string{
+		"ai-agents-app-1 | app1 started",
+		"ai-agents-redis | redis ready",
+		"ai-agents-app-2 | app2 started",
+		"ai-agents-app-1 | app1 warning",
+	}, "\n") + "\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("StreamLogs() output mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, call := range mock.ContainerLogsCalls {
+		if !call.Opts.Timestamps {
+			t.Errorf("ContainerLogs(%s) Timestamps = false, want true for ordering", call.ID)
+		}
+		if call.Opts.Tail != "all" {
+			t.Errorf("ContainerLogs(%s) Tail = %q, want %q", call.ID, call.Opts.Tail, "all")
+		}
+	}
+}
+
+func TestStreamLogs_TimestampsAndGrep(t *testing.T) {
+	ctx := context.Background()
+	mock := newLogsMock(t)
+
+	sources, err := SelectLogSources(ctx, mock, "ai-agents", "local", []string{"app"})
+	if err != nil {
+		t.Fatalf("SelectLogSources() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	opts := LogOptions{Timestamps: true, Grep: regexp.MustCompile("started")}
+	if err := StreamLogs(ctx, mock, sources, opts, &out); err != nil {
+		t.Fatalf("StreamLogs() error = %v", err)
+	}
+
+	want := "ai-agents-app-1 | 2026-01-01T00:00:01Z app1 started\n" +
+		"ai-agents-app-2 | 2026-01-01T00:00:03Z app2 started\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("StreamLogs() output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStreamLogs_Color(t *testing.T) {
+	ctx := context.Background()
+	mock := newLogsMock(t)
+
+	sources, err := SelectLogSources(ctx, mock, "ai-agents", "local", []string{"redis"})
+	if err != nil {
+		t.Fatalf("SelectLogSources() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := StreamLogs(ctx, mock, sources, LogOptions{Color: true}, &out); err != nil {
+		t.Fatalf("StreamLogs() error = %v", err)
+	}
+
+	want := "\x1b[" + ServiceColor("redis") + "mai-agents-redis |\x1b[0m redis ready\n"
+	if out.String() != want {
+		t.Errorf("StreamLogs() = %q, want %q", out.String(), want)
+	}
+}
+
+func TestStreamLogs_LogsError(t *testing.T) {
+	ctx := context.Background()
+	mock := newLogsMock(t)
+	mock.ContainerLogsError = docker.ErrContainerLogs("c-app-1", context.DeadlineExceeded)
+
+	sources, err := SelectLogSources(ctx, mock, "ai-agents", "local", nil)
+	if err != nil {
+		t.Fatalf("SelectLogSources() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := StreamLogs(ctx, mock, sources, LogOptions{}, &out); err == nil {
+		t.Error("StreamLogs() error = nil, want error")
+	}
+}
+
+func TestServiceColor_Stable(t *testing.T) {
+	if ServiceColor("redis") != ServiceColor("redis") {
+		t.Error("ServiceColor() not stable")
+	}
+	for _, svc := range []string{"app", "redis", "kafka", "postgres", ""} {
+		if c := ServiceColor(svc); c == "31" || c == "" {
+			t.Errorf("ServiceColor(%q) = %q, want non-red color", svc, c)
+		}
+	}
+}
+
+func TestParseLogLine(t *testing.T) {
+	tests := map[string]struct {
+		raw      string
+		wantText string
+		wantTime bool
+	}{
+		"with timestamp":    {raw: "2026-01-01T00:00:01.5Z hello world", wantText: "hello world", wantTime: true},
+		"without timestamp": {raw: "hello world", wantText: "hello world"},
+		"carriage return":   {raw: "2026-01-01T00:00:01Z tty line\r", wantText: "tty line", wantTime: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := parseLogLine(tc.raw)
+			if got.Text != tc.wantText {
+				t.Errorf("Text = %q, want %q", got.Text, tc.wantText)
+			}
+			if got.Time.IsZero() == tc.wantTime {
+				t.Errorf("Time = %v, want set = %v", got.Time, tc.wantTime)
+			}
+		})
+	}
+}
+
+func TestLabels(t *testing.T) {
+	got := Labels("ai-agents", "local", "redis")
+	want := map[string]string{
+		LabelManaged:     "true",
+		LabelProject:     "ai-agents",
+		LabelEnvironment: "local",
+		LabelService:     "redis",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Labels() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, ok := Labels("ai-agents", "local", "")[LabelService]; ok {
+		t.Error("Labels() with empty service set service label")
+	}
+}
@@ -0,0 +1,409 @@
+package fleet
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/packs"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ExternalSecretKind is the ESO kind secrets come through when the
+// environment's secret provider sets a ClusterSecretStore.
+var ExternalSecretKind = schema.GroupVersionKind{Group: "external-secrets.io", Version: "v1beta1", Kind: "ExternalSecret"}
+
+// DefaultVolumeSize is the size of persistent volume claims whose pack
+// volume sets none.
+const DefaultVolumeSize = "1Gi"
+
+// ManifestOptions configures ServiceManifests.
+type ManifestOptions struct {
+	SecretStore string // ESO ClusterSecretStore for the service's own secretRefs; see packs.RenderContext
+}
+
+// ServiceManifests returns the Kubernetes objects the pack rendered for svc
+// runs as: a Deployment, or a StatefulSet if a container has persistent
+// volumes, its Services, Ingresses and ConfigMaps, and an ExternalSecret
+// per secret that comes through ESO. Every object carries the labels of
+// svc. The service's own env and secretRefs are added to the main (first)
+// container, as on compose.
+//
+// Secrets that do not come through ESO are referenced by name only: the
+// <service>-secrets Secret must exist in the namespace, since yar has no
+// secret provider to fill it from.
+func ServiceManifests(project, env string, svc *config.Service, r *packs.Rendered, opts ManifestOptions) []*unstructured.Unstructured {
+	m := &manifestBuilder{project: project, env: env, svc: svc}
+	spec := r.Resources.Spec
+
+	secrets := append([]packs.SecretBinding(nil), r.Secrets...)
+	refs := make([]string, 0, len(svc.SecretRefs))
+	for name := range svc.SecretRefs {
+		refs = append(refs, name)
+	}
+	sort.Strings(refs)
+	for _, name := range refs {
+		ref := svc.SecretRefs[name]
+		if !slices.ContainsFunc(secrets, func(b packs.SecretBinding) bool { return b.Ref == ref }) {
+			secrets = append(secrets, packs.SecretBinding{Ref: ref, Name: svc.Name + "-secrets", Key: packs.SecretKey(ref), Store: opts.SecretStore})
+		}
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, cm := range spec.ConfigMaps {
+		obj := m.object(kubernetes.ConfigMapKind, svc.Name+"-"+cm.Name)
+		_ = unstructured.SetNestedStringMap(obj.Object, cm.Data, "data")
+		objs = append(objs, obj)
+	}
+	if files := m.files(spec.Containers); len(files) > 0 {
+		obj := m.object(kubernetes.ConfigMapKind, m.filesName())
+		_ = unstructured.SetNestedStringMap(obj.Object, files, "data")
+		objs = append(objs, obj)
+	}
+	objs = append(objs, m.externalSecrets(secrets)...)
+	objs = append(objs, m.workload(spec.Containers))
+	for _, s := range spec.Services {
+		objs = append(objs, m.service(s))
+	}
+	for _, ing := range spec.Ingress {
+		objs = append(objs, m.ingress(ing))
+	}
+	return objs
+}
+
+// manifestBuilder builds the objects of one service.
+type manifestBuilder struct {
+	project string
+	env     string
+	svc     *config.Service
+}
+
+// object returns an empty object of kind named name, labeled for the
+// service.
+func (m *manifestBuilder) object(gvk schema.GroupVersionKind, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{}}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(name)
+	obj.SetNamespace(m.svc.Namespace)
+	obj.SetLabels(Labels(m.project, m.env, m.svc.Name))
+	return obj
+}
+
+// filesName is the ConfigMap holding the inline content of the service's
+// volumes.
+func (m *manifestBuilder) filesName() string {
+	return m.svc.Name + "-files"
+}
+
+// fileKey is the key of a content volume in the files ConfigMap.
+func fileKey(container string, v packs.Volume) string {
+	return container + "-" + v.Name
+}
+
+// files returns the inline content of the containers' volumes by key.
+func (m *manifestBuilder) files(containers []packs.Container) map[string]string {
+	files := map[string]string{}
+	for _, c := range containers {
+		for _, v := range c.Volumes {
+			if !v.Persistent && v.Content != "" {
+				files[fileKey(c.Name, v)] = v.Content
+			}
+		}
+	}
+	return files
+}
+
+// externalSecrets returns an ExternalSecret per secret name bound to a
+// ClusterSecretStore.
+func (m *manifestBuilder) externalSecrets(secrets []packs.SecretBinding) []*unstructured.Unstructured {
+	var objs []*unstructured.Unstructured
+	byName := map[string]*unstructured.Unstructured{}
+	for _, b := range secrets {
+		if b.Store == "" {
+			continue
+		}
+		obj, ok := byName[b.Name]
+		if !ok {
+			obj = m.object(ExternalSecretKind, b.Name)
+			obj.Object["spec"] = map[string]any{
+				"secretStoreRef": map[string]any{"kind": "ClusterSecretStore", "name": b.Store},
+				"target":         map[string]any{"name": b.Name},
+				"data":           []any{},
+			}
+			byName[b.Name] = obj
+			objs = append(objs, obj)
+		}
+		spec := obj.Object["spec"].(map[string]any)
+		spec["data"] = append(spec["data"].([]any), map[string]any{
+			"secretKey": b.Key,
+			"remoteRef": map[string]any{"key": b.Ref},
+		})
+	}
+	return objs
+}
+
+// workload returns the Deployment or StatefulSet running containers.
+func (m *manifestBuilder) workload(containers []packs.Container) *unstructured.Unstructured {
+	var (
+		podContainers []any
+		claims        []any
+		claimed       = map[string]bool{}
+		files         bool
+	)
+	for i, c := range containers {
+		container := m.container(c, i == 0)
+		var mounts []any
+		for _, v := range c.Volumes {
+			switch {
+			case v.Persistent:
+				mounts = append(mounts, map[string]any{"name": v.Name, "mountPath": v.MountPath})
+				if claimed[v.Name] {
+					continue
+				}
+				claimed[v.Name] = true
+				size := v.Size
+				if size == "" {
+					size = DefaultVolumeSize
+				}
+				claims = append(claims, map[string]any{
+					"metadata": map[string]any{"name": v.Name},
+					"spec": map[string]any{
+						"accessModes": []any{"ReadWriteOnce"},
+						"resources":   map[string]any{"requests": map[string]any{"storage": size}},
+					},
+				})
+			case v.Content != "":
+				files = true
+				mounts = append(mounts, map[string]any{"name": "files", "mountPath": v.MountPath, "subPath": fileKey(c.Name, v)})
+			}
+		}
+		if len(mounts) > 0 {
+			container["volumeMounts"] = mounts
+		}
+		podContainers = append(podContainers, container)
+	}
+
+	labels := Labels(m.project, m.env, m.svc.Name)
+	podSpec := map[string]any{"containers": podContainers}
+	if files {
+		podSpec["volumes"] = []any{map[string]any{
+			"name":      "files",
+			"configMap": map[string]any{"name": m.filesName()},
+		}}
+	}
+	replicas := int64(m.svc.Replicas)
+	if replicas < 1 {
+		replicas = 1
+	}
+	spec := map[string]any{
+		"replicas": replicas,
+		"selector": map[string]any{"matchLabels": stringMap(labels)},
+		"template": map[string]any{
+			"metadata": map[string]any{"labels": stringMap(labels)},
+			"spec":     podSpec,
+		},
+	}
+
+	kind := kubernetes.DeploymentKind
+	if len(claims) > 0 {
+		kind = kubernetes.StatefulSetKind
+		spec["serviceName"] = m.svc.Name
+		spec["volumeClaimTemplates"] = claims
+	}
+	obj := m.object(kind, m.svc.Name)
+	obj.Object["spec"] = spec
+	return obj
+}
+
+// container returns the pod container of c. The main container gets the
+// service's own env and secretRefs.
+func (m *manifestBuilder) container(c packs.Container, main bool) map[string]any {
+	container := map[string]any{"name": c.Name, "image": c.Image}
+	if len(c.Command) > 0 {
+		container["command"] = anySlice(c.Command)
+	}
+	if len(c.Args) > 0 {
+		container["args"] = anySlice(c.Args)
+	}
+
+	var ports []any
+	for _, p := range c.Ports {
+		protocol := strings.ToUpper(p.Protocol)
+		if protocol == "" {
+			protocol = "TCP"
+		}
+		ports = append(ports, map[string]any{"containerPort": int64(p.ContainerPort), "protocol": protocol})
+	}
+	if len(ports) > 0 {
+		container["ports"] = ports
+	}
+
+	var names []string
+	env := map[string]map[string]any{}
+	set := func(name string, entry map[string]any) {
+		if _, ok := env[name]; !ok {
+			names = append(names, name)
+		}
+		env[name] = entry
+	}
+	secretEnv := func(name, ref string) map[string]any {
+		return map[string]any{"name": name, "valueFrom": map[string]any{
+			"secretKeyRef": map[string]any{"name": m.svc.Name + "-secrets", "key": packs.SecretKey(ref)},
+		}}
+	}
+	for _, e := range c.Env {
+		if e.SecretRef != "" {
+			set(e.Name, secretEnv(e.Name, e.SecretRef))
+		} else {
+			set(e.Name, map[string]any{"name": e.Name, "value": e.Value})
+		}
+	}
+	if main {
+		for _, k := range sortedKeys(m.svc.Env) {
+			set(k, map[string]any{"name": k, "value": m.svc.Env[k]})
+		}
+		for _, k := range sortedKeys(m.svc.SecretRefs) {
+			set(k, secretEnv(k, m.svc.SecretRefs[k]))
+		}
+	}
+	if len(names) > 0 {
+		entries := make([]any, len(names))
+		for i, name := range names {
+			entries[i] = env[name]
+		}
+		container["env"] = entries
+	}
+
+	if res := c.Resources; res != nil {
+		resources := map[string]any{}
+		if l := resourceList(res.Requests); len(l) > 0 {
+			resources["requests"] = l
+		}
+		if l := resourceList(res.Limits); len(l) > 0 {
+			resources["limits"] = l
+		}
+		if len(resources) > 0 {
+			container["resources"] = resources
+		}
+	}
+	if p := probe(c.LivenessProbe); p != nil {
+		container["livenessProbe"] = p
+	}
+	if p := probe(c.ReadinessProbe); p != nil {
+		container["readinessProbe"] = p
+	}
+	return container
+}
+
+// service returns the Service of s, selecting the service's pods.
+func (m *manifestBuilder) service(s packs.ServiceSpec) *unstructured.Unstructured {
+	target := s.TargetPort
+	if target == 0 {
+		target = s.Port
+	}
+	typ := s.Type
+	if typ == "" {
+		typ = packs.ServiceClusterIP
+	}
+	obj := m.object(kubernetes.ServiceKind, s.Name)
+	obj.Object["spec"] = map[string]any{
+		"type":     typ,
+		"selector": stringMap(Labels(m.project, m.env, m.svc.Name)),
+		"ports": []any{map[string]any{
+			"port":       int64(s.Port),
+			"targetPort": int64(target),
+			"protocol":   "TCP",
+		}},
+	}
+	return obj
+}
+
+// ingress returns the Ingress of ing.
+func (m *manifestBuilder) ingress(ing packs.Ingress) *unstructured.Unstructured {
+	path := ing.Path
+	if path == "" {
+		path = "/"
+	}
+	spec := map[string]any{
+		"rules": []any{map[string]any{
+			"host": ing.Host,
+			"http": map[string]any{"paths": []any{map[string]any{
+				"path":     path,
+				"pathType": "Prefix",
+				"backend": map[string]any{"service": map[string]any{
+					"name": ing.ServiceName,
+					"port": map[string]any{"number": int64(ing.ServicePort)},
+				}},
+			}}},
+		}},
+	}
+	if ing.TLS {
+		spec["tls"] = []any{map[string]any{"hosts": []any{ing.Host}, "secretName": ing.Name + "-tls"}}
+	}
+	obj := m.object(kubernetes.IngressKind, ing.Name)
+	obj.Object["spec"] = spec
+	return obj
+}
+
+// probe returns the Kubernetes form of p, or nil.
+func probe(p *packs.Probe) map[string]any {
+	if p == nil {
+		return nil
+	}
+	out := map[string]any{}
+	switch {
+	case p.HTTPGet != nil:
+		out["httpGet"] = map[string]any{"path": p.HTTPGet.Path, "port": int64(p.HTTPGet.Port)}
+	case p.TCPSocket != nil:
+		out["tcpSocket"] = map[string]any{"port": int64(p.TCPSocket.Port)}
+	default:
+		return nil
+	}
+	if p.InitialDelaySeconds > 0 {
+		out["initialDelaySeconds"] = int64(p.InitialDelaySeconds)
+	}
+	if p.PeriodSeconds > 0 {
+		out["periodSeconds"] = int64(p.PeriodSeconds)
+	}
+	return out
+}
+
+// resourceList returns the Kubernetes form of l.
+func resourceList(l packs.ResourceList) map[string]any {
+	out := map[string]any{}
+	if l.Memory != "" {
+		out["memory"] = l.Memory
+	}
+	if l.CPU != "" {
+		out["cpu"] = l.CPU
+	}
+	return out
+}
+
+func anySlice(s []string) []any {
+	out := make([]any, len(s))
+	for i, v := range s {
+		out[i] = v
+	}
+	return out
+}
+
+func stringMap(m map[string]string) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
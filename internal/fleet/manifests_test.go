@@ -0,0 +1,103 @@
+package fleet
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/packs"
+)
+
+func TestServiceManifests(t *testing.T) {
+	svc := &config.Service{
+		Name:       "db",
+		Namespace:  "dev",
+		Env:        map[string]string{"PGDATA": "/var/lib/postgresql/data/pg"},
+		SecretRefs: map[string]string{"BACKUP_TOKEN": "backup_token"},
+	}
+	rendered := &packs.Rendered{
+		Resources: &packs.Resources{Spec: packs.PackSpec{
+			Containers: []packs.Container{{
+				Name:  "postgres",
+				Image: "postgres:16-alpine",
+				Ports: []packs.Port{{ContainerPort: 5432, HostPort: 5432}},
+				Env:   []packs.EnvVar{{Name: "POSTGRES_PASSWORD", SecretRef: "db_password"}, {Name: "PGPORT", Value: "5432"}},
+				Volumes: []packs.Volume{
+					{Name: "data", MountPath: "/var/lib/postgresql/data", Persistent: true, Size: "5Gi"},
+					{Name: "conf", MountPath: "/etc/postgresql/extra.conf", Content: "max_connections = 50\n"},
+				},
+				ReadinessProbe: &packs.Probe{TCPSocket: &packs.TCPSocketAction{Port: 5432}, PeriodSeconds: 5},
+			}},
+			Services:   []packs.ServiceSpec{{Name: "db", Port: 5432}},
+			ConfigMaps: []packs.ConfigMap{{Name: "init", Data: map[string]string{"init.sql": "select 1;"}}},
+		}},
+		Secrets: []packs.SecretBinding{{Ref: "db_password", Name: "db-secrets", Key: "db_password", Store: "vault"}},
+	}
+
+	objs := ServiceManifests("ai-agents", "dev", svc, rendered, ManifestOptions{SecretStore: "vault"})
+	var names []string
+	byKind := map[string]*unstructured.Unstructured{}
+	for _, obj := range objs {
+		names = append(names, obj.GetKind()+"/"+obj.GetName())
+		byKind[obj.GetKind()] = obj
+		if obj.GetNamespace() != "dev" || obj.GetLabels()[LabelService] != "db" {
+			t.Errorf("%s/%s namespace %q labels %v, want dev and service db", obj.GetKind(), obj.GetName(), obj.GetNamespace(), obj.GetLabels())
+		}
+	}
+	want := []string{"ConfigMap/db-init", "ConfigMap/db-files", "ExternalSecret/db-secrets", "StatefulSet/db", "Service/db"}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Fatalf("objects mismatch (-want +got):\n%s", diff)
+	}
+
+	containers, _, _ := unstructured.NestedSlice(byKind["StatefulSet"].Object, "spec", "template", "spec", "containers")
+	wantContainer := map[string]any{
+		"name":  "postgres",
+		"image": "postgres:16-alpine",
+		"ports": []any{map[string]any{"containerPort": int64(5432), "protocol": "TCP"}},
+		"env": []any{
+			map[string]any{"name": "POSTGRES_PASSWORD", "valueFrom": map[string]any{"secretKeyRef": map[string]any{"name": "db-secrets", "key": "db_password"}}},
+			map[string]any{"name": "PGPORT", "value": "5432"},
+			map[string]any{"name": "PGDATA", "value": "/var/lib/postgresql/data/pg"},
+			map[string]any{"name": "BACKUP_TOKEN", "valueFrom": map[string]any{"secretKeyRef": map[string]any{"name": "db-secrets", "key": "backup_token"}}},
+		},
+		"volumeMounts": []any{
+			map[string]any{"name": "data", "mountPath": "/var/lib/postgresql/data"},
+			map[string]any{"name": "files", "mountPath": "/etc/postgresql/extra.conf", "subPath": "postgres-conf"},
+		},
+		"readinessProbe": map[string]any{"tcpSocket": map[string]any{"port": int64(5432)}, "periodSeconds": int64(5)},
+	}
+	if diff := cmp.Diff([]any{wantContainer}, containers); diff != "" {
+		t.Errorf("containers mismatch (-want +got):\n%s", diff)
+	}
+	claims, _, _ := unstructured.NestedSlice(byKind["StatefulSet"].Object, "spec", "volumeClaimTemplates")
+	wantClaims := []any{map[string]any{
+		"metadata": map[string]any{"name": "data"},
+		"spec": map[string]any{
+			"accessModes": []any{"ReadWriteOnce"},
+			"resources":   map[string]any{"requests": map[string]any{"storage": "5Gi"}},
+		},
+	}}
+	if diff := cmp.Diff(wantClaims, claims); diff != "" {
+		t.Errorf("volumeClaimTemplates mismatch (-want +got):\n%s", diff)
+	}
+
+	data, _, _ := unstructured.NestedSlice(byKind["ExternalSecret"].Object, "spec", "data")
+	wantData := []any{
+		map[string]any{"secretKey": "db_password", "remoteRef": map[string]any{"key": "db_password"}},
+		map[string]any{"secretKey": "backup_token", "remoteRef": map[string]any{"key": "backup_token"}},
+	}
+	if diff := cmp.Diff(wantData, data); diff != "" {
+		t.Errorf("ExternalSecret data mismatch (-want +got):\n%s", diff)
+	}
+
+	// Without persistent volumes the service runs as a Deployment.
+	rendered.Resources.Spec.Containers[0].Volumes = nil
+	objs = ServiceManifests("ai-agents", "dev", &config.Service{Name: "db", Replicas: 2}, rendered, ManifestOptions{})
+	deploy := objs[len(objs)-2]
+	replicas, _, _ := unstructured.NestedInt64(deploy.Object, "spec", "replicas")
+	if deploy.GetKind() != "Deployment" || replicas != 2 {
+		t.Errorf("workload = %s with %d replicas, want a Deployment with 2", deploy.GetKind(), replicas)
+	}
+}
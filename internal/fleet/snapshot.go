@@ -0,0 +1,673 @@
+package fleet
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/packs"
+	"github.com/yar-run/yar/internal/platform"
+)
+
+const (
+	// SnapshotDirName is the directory under platform.DataDir() holding snapshots.
+	SnapshotDirName = "snapshots"
+	// SnapshotExt is the file extension of a snapshot archive.
+	SnapshotExt = ".tar.gz"
+	// DefaultSnapshotImage is the helper image used to read and write volumes.
+	DefaultSnapshotImage = "busybox:stable"
+
+	// snapshotManifest is the first entry of every snapshot archive.
+	snapshotManifest = "manifest.json"
+	// snapshotRoot is where the helper container mounts volumes; archive
+	// entries for volume v live under volumes/v/.
+	snapshotRoot = "volumes"
+)
+
+// SnapshotManifest describes a snapshot archive.
+type SnapshotManifest struct {
+	Name         string            `json:"name"`
+	Project      string            `json:"project"`
+	Environment  string            `json:"environment"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	Packs        map[string]string `json:"packs,omitempty"`        // service -> pack reference at save time
+	PackVersions map[string]string `json:"packVersions,omitempty"` // service -> pack version yar.lock recorded at save time
+	Volumes      []VolumeRecord    `json:"volumes"`
+}
+
+// SnapshotStore saves and restores the yar-labelled volumes of a compose
+// environment. Snapshots live at <dir>/<project>/<env>/<name>.tar.gz: a
+// gzipped tar holding manifest.json followed by volumes/<volume>/...
+type SnapshotStore struct {
+	dir   string
+	image string
+	lock  *packs.ProjectLock
+	now   func() time.Time
+}
+
+// SnapshotOption configures a SnapshotStore.
+type SnapshotOption func(*SnapshotStore)
+
+// WithSnapshotDir sets the directory holding snapshots.
+func WithSnapshotDir(dir string) SnapshotOption {
+	return func(s *SnapshotStore) {
+		s.dir = dir
+	}
+}
+
+// WithSnapshotImage sets the helper image (default busybox:stable). It
+// must provide sh and find.
+func WithSnapshotImage(image string) SnapshotOption {
+	return func(s *SnapshotStore) {
+		s.image = image
+	}
+}
+
+// WithSnapshotPackLock records the pack versions lock holds for the
+// project's services in the manifests Save writes, so a restore can tell
+// when the packs have changed since (see SnapshotManifest.PackSkew).
+func WithSnapshotPackLock(lock *packs.ProjectLock) SnapshotOption {
+	return func(s *SnapshotStore) {
+		s.lock = lock
+	}
+}
+
+// NewSnapshotStore creates a snapshot store. Defaults to <DataDir>/snapshots.
+func NewSnapshotStore(opts ...SnapshotOption) (*SnapshotStore, error) {
+	s := &SnapshotStore{
+		image: DefaultSnapshotImage,
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.dir == "" {
+		dataDir, err := platform.DataDir()
+		if err != nil {
+			return nil, ErrSnapshotRead("", err)
+		}
+		s.dir = filepath.Join(dataDir, SnapshotDirName)
+	}
+	return s, nil
+}
+
+// Dir returns the directory holding snapshots.
+func (s *SnapshotStore) Dir() string {
+	return s.dir
+}
+
+// PackLock returns the project lock set with WithSnapshotPackLock, or nil.
+func (s *SnapshotStore) PackLock() *packs.ProjectLock {
+	return s.lock
+}
+
+// Path returns the archive path of a snapshot.
+func (s *SnapshotStore) Path(project, env, name string) string {
+	return filepath.Join(s.dir, project, env, name+SnapshotExt)
+}
+
+// Save stops the services owning the environment's volumes, archives the
+// volumes, and starts the services again. An existing snapshot with the
+// same name is replaced only once the new archive is complete.
+func (s *SnapshotStore) Save(ctx context.Context, client docker.Client, project *config.Project, env, name string) (manifest *SnapshotManifest, err error) {
+	if err := checkSnapshotKey(project.Project, env, name); err != nil {
+		return nil, err
+	}
+
+	volumes, err := client.VolumeList(ctx, docker.VolumeListOptions{Filters: LabelFilters(project.Project, env)})
+	if err != nil {
+		return nil, err
+	}
+	if len(volumes) == 0 {
+		return nil, &errors.NotFoundError{
+			Resource: "volumes",
+			Name:     project.Project + "/" + env,
+			Message:  "no yar-managed volumes to snapshot",
+		}
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+
+	manifest = &SnapshotManifest{
+		Name:        name,
+		Project:     project.Project,
+		Environment: env,
+		CreatedAt:   s.now().UTC(),
+		Packs:       make(map[string]string),
+	}
+	for _, svc := range project.Services {
+		manifest.Packs[svc.Name] = svc.Pack
+		if locked := s.lock.Locked(svc); locked != nil {
+			if manifest.PackVersions == nil {
+				manifest.PackVersions = make(map[string]string)
+			}
+			manifest.PackVersions[svc.Name] = locked.Version
+		}
+	}
+	for _, v := range volumes {
+		manifest.Volumes = append(manifest.Volumes, VolumeRecord{Service: v.Labels[LabelService], Name: v.Name})
+	}
+
+	restart, err := stopVolumeOwners(ctx, client, project.Project, env, manifest.Volumes)
+	defer func() {
+		if rerr := restart(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}()
+	if err != nil {
+		return nil, ErrSnapshotSave(name, err)
+	}
+
+	helper, err := s.createHelper(ctx, client, manifest.Volumes, nil)
+	if err != nil {
+		return nil, ErrSnapshotSave(name, err)
+	}
+	defer client.ContainerRemove(context.WithoutCancel(ctx), helper)
+
+	rc, err := client.CopyFromContainer(ctx, helper, "/"+snapshotRoot)
+	if err != nil {
+		return nil, ErrSnapshotSave(name, err)
+	}
+	defer rc.Close()
+
+	dest := s.Path(project.Project, env, name)
+	if err := writeSnapshot(dest, manifest, rc); err != nil {
+		return nil, ErrSnapshotSave(name, err)
+	}
+	return manifest, nil
+}
+
+// Restore stops the services owning the snapshot's volumes, replaces the
+// volumes' contents with the snapshot, and starts the services again.
+// Missing volumes are created with the environment's labels; existing ones
+// must carry yar's labels for the project, or nothing is touched.
+func (s *SnapshotStore) Restore(ctx context.Context, client docker.Client, project *config.Project, env, name string) (manifest *SnapshotManifest, err error) {
+	manifest, err = s.Load(project.Project, env, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSnapshotVolumes(manifest); err != nil {
+		return nil, err
+	}
+
+	// Look at every volume, not just the environment's: a volume of the
+	// same name yar does not manage for this project must not be wiped.
+	existing, err := client.VolumeList(ctx, docker.VolumeListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]docker.Volume, len(existing))
+	for _, v := range existing {
+		have[v.Name] = v
+	}
+	for _, v := range manifest.Volumes {
+		vol, ok := have[v.Name]
+		if ok && (vol.Labels[LabelManaged] != "true" || vol.Labels[LabelProject] != project.Project) {
+			return nil, &errors.ValidationError{
+				Field:   "volume",
+				Value:   v.Name,
+				Message: fmt.Sprintf("volume exists but is not managed by yar for project %q; remove or rename it before restoring", project.Project),
+			}
+		}
+	}
+	for _, v := range manifest.Volumes {
+		if _, ok := have[v.Name]; ok {
+			continue
+		}
+		opts := docker.VolumeCreateOptions{Labels: Labels(project.Project, env, v.Service)}
+		if _, err := client.VolumeCreate(ctx, v.Name, opts); err != nil {
+			return nil, ErrSnapshotRestore(name, err)
+		}
+	}
+
+	restart, err := stopVolumeOwners(ctx, client, project.Project, env, manifest.Volumes)
+	defer func() {
+		if rerr := restart(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}()
+	if err != nil {
+		return nil, ErrSnapshotRestore(name, err)
+	}
+
+	// Empty the volumes, keeping the mount points themselves.
+	wipe := []string{"find", "/" + snapshotRoot, "-mindepth", "2", "-delete"}
+	cleaner, err := s.createHelper(ctx, client, manifest.Volumes, wipe)
+	if err != nil {
+		return nil, ErrSnapshotRestore(name, err)
+	}
+	defer client.ContainerRemove(context.WithoutCancel(ctx), cleaner)
+	if err := client.ContainerStart(ctx, cleaner); err != nil {
+		return nil, ErrSnapshotRestore(name, err)
+	}
+	code, err := client.ContainerWait(ctx, cleaner)
+	if err != nil {
+		return nil, ErrSnapshotRestore(name, err)
+	}
+	if code != 0 {
+		return nil, ErrSnapshotRestore(name, fmt.Errorf("clearing volumes exited with code %d", code))
+	}
+
+	helper, err := s.createHelper(ctx, client, manifest.Volumes, nil)
+	if err != nil {
+		return nil, ErrSnapshotRestore(name, err)
+	}
+	defer client.ContainerRemove(context.WithoutCancel(ctx), helper)
+
+	f, err := os.Open(s.Path(project.Project, env, name))
+	if err != nil {
+		return nil, ErrSnapshotRestore(name, err)
+	}
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(copyVolumeEntries(f, pw))
+	}()
+	if err := client.CopyToContainer(ctx, helper, "/", pr); err != nil {
+		pr.CloseWithError(err)
+		return nil, ErrSnapshotRestore(name, err)
+	}
+	return manifest, nil
+}
+
+// PackSkew describes how the packs of project's services differ from when
+// the snapshot was saved: a changed pack reference, or a version other than
+// the one lock now holds. Restored data may not suit the pack in use.
+func (m *SnapshotManifest) PackSkew(project *config.Project, lock *packs.ProjectLock) []string {
+	var skew []string
+	for _, svc := range project.Services {
+		if pack, ok := m.Packs[svc.Name]; ok && pack != svc.Pack {
+			skew = append(skew, fmt.Sprintf("snapshot was taken with %s using pack '%s', now '%s'", svc.Name, pack, svc.Pack))
+			continue
+		}
+		saved, ok := m.PackVersions[svc.Name]
+		if !ok {
+			continue
+		}
+		if locked := lock.Locked(svc); locked != nil && locked.Version != saved {
+			skew = append(skew, fmt.Sprintf("snapshot was taken with %s using pack %s %s, now %s", svc.Name, svc.Pack, saved, locked.Version))
+		}
+	}
+	return skew
+}
+
+// Load reads the manifest of a snapshot.
+func (s *SnapshotStore) Load(project, env, name string) (*SnapshotManifest, error) {
+	if err := checkSnapshotKey(project, env, name); err != nil {
+		return nil, err
+	}
+	manifest, err := ReadSnapshotManifest(s.Path(project, env, name))
+	if err != nil {
+		if stderrors.Is(err, os.ErrNotExist) {
+			return nil, &errors.NotFoundError{
+				Resource: "snapshot",
+				Name:     name,
+				Message:  fmt.Sprintf("no snapshot for %s/%s; see 'yar fleet snapshot list'", project, env),
+			}
+		}
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// List returns the snapshots of a project environment, newest first.
+func (s *SnapshotStore) List(project, env string) ([]*SnapshotManifest, error) {
+	if err := checkSnapshotKey(project, env, "list"); err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(s.dir, project, env, "*"+SnapshotExt))
+	if err != nil {
+		return nil, ErrSnapshotRead("", err)
+	}
+
+	manifests := make([]*SnapshotManifest, 0, len(matches))
+	for _, m := range matches {
+		manifest, err := ReadSnapshotManifest(m)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].CreatedAt.After(manifests[j].CreatedAt)
+	})
+	return manifests, nil
+}
+
+// Delete removes a snapshot.
+func (s *SnapshotStore) Delete(project, env, name string) error {
+	if _, err := s.Load(project, env, name); err != nil {
+		return err
+	}
+	if err := os.Remove(s.Path(project, env, name)); err != nil {
+		return NewFleetError("snapshot.delete", name, "failed to delete snapshot", err)
+	}
+	return nil
+}
+
+// Export copies a snapshot archive to dest so it can be shared.
+func (s *SnapshotStore) Export(project, env, name, dest string) error {
+	if _, err := s.Load(project, env, name); err != nil {
+		return err
+	}
+	if err := copyFile(s.Path(project, env, name), dest); err != nil {
+		return ErrSnapshotRead(name, err)
+	}
+	return nil
+}
+
+// Import adds a shared snapshot archive to a project environment. The
+// archive must belong to the same project; it is stored under env and
+// renamed when name is non-empty. An existing snapshot is not overwritten.
+func (s *SnapshotStore) Import(project, env, src, name string) (*SnapshotManifest, error) {
+	manifest, err := ReadSnapshotManifest(src)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Project != project {
+		return nil, &errors.ValidationError{
+			Field:   "project",
+			Value:   manifest.Project,
+			Message: fmt.Sprintf("snapshot belongs to project %q, not %q", manifest.Project, project),
+		}
+	}
+	if err := checkSnapshotVolumes(manifest); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = manifest.Name
+	}
+	if err := checkSnapshotKey(project, env, name); err != nil {
+		return nil, err
+	}
+
+	dest := s.Path(project, env, name)
+	if _, err := os.Stat(dest); err == nil {
+		return nil, &errors.ValidationError{
+			Field:   "snapshot",
+			Value:   name,
+			Message: "a snapshot with this name already exists; delete it or import with another name",
+		}
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, ErrSnapshotSave(name, err)
+	}
+	defer f.Close()
+
+	manifest.Name = name
+	manifest.Environment = env
+	if err := writeSnapshotFrom(dest, manifest, f); err != nil {
+		return nil, ErrSnapshotSave(name, err)
+	}
+	return manifest, nil
+}
+
+// ReadSnapshotManifest reads the manifest of a snapshot archive.
+func ReadSnapshotManifest(archive string) (*SnapshotManifest, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, ErrSnapshotRead(archive, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, ErrSnapshotRead(archive, err)
+	}
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != snapshotManifest {
+		return nil, ErrSnapshotRead(archive, fmt.Errorf("not a yar snapshot: missing %s", snapshotManifest))
+	}
+
+	var manifest SnapshotManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, ErrSnapshotRead(archive, err)
+	}
+	return &manifest, nil
+}
+
+// createHelper creates a helper container mounting every volume at
+// /volumes/<name>, pulling the helper image if it is missing.
+func (s *SnapshotStore) createHelper(ctx context.Context, client docker.Client, volumes []VolumeRecord, cmd []string) (string, error) {
+	opts := docker.ContainerCreateOptions{
+		Image:  s.image,
+		Cmd:    cmd,
+		Labels: map[string]string{LabelManaged: "true"},
+	}
+	for _, v := range volumes {
+		opts.Mounts = append(opts.Mounts, docker.Mount{
+			Type:   "volume",
+			Source: v.Name,
+			Target: "/" + snapshotRoot + "/" + v.Name,
+		})
+	}
+
+	return createContainer(ctx, client, opts)
+}
+
+// stopVolumeOwners stops the running containers of the services owning
+// volumes, or of every service when a volume is fleet-wide. The returned
+// function starts them again on a context detached from ctx.
+func stopVolumeOwners(ctx context.Context, client docker.Client, project, env string, volumes []VolumeRecord) (func() error, error) {
+	owners := make(map[string]bool)
+	all := false
+	for _, v := range volumes {
+		if v.Service == "" {
+			all = true
+		}
+		owners[v.Service] = true
+	}
+
+	var stopped []string
+	restart := func() error {
+		ctx := context.WithoutCancel(ctx)
+		var errs []error
+		for _, id := range stopped {
+			if err := client.ContainerStart(ctx, id); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return stderrors.Join(errs...)
+	}
+
+	filters := LabelFilters(project, env)
+	filters["status"] = []string{"running"}
+	containers, err := client.ContainerList(ctx, docker.ContainerListOptions{Filters: filters})
+	if err != nil {
+		return restart, err
+	}
+	for _, c := range containers {
+		if !all && !owners[c.Labels[LabelService]] {
+			continue
+		}
+		if err := client.ContainerStop(ctx, c.ID); err != nil {
+			return restart, err
+		}
+		stopped = append(stopped, c.ID)
+	}
+	return restart, nil
+}
+
+// writeSnapshot writes manifest and the volume entries of a helper
+// container's tar stream to dest atomically.
+func writeSnapshot(dest string, manifest *SnapshotManifest, volumes io.Reader) error {
+	return writeArchive(dest, manifest, func(tw *tar.Writer) error {
+		tr := tar.NewReader(volumes)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// writeSnapshotFrom writes manifest and the volume entries of an existing
+// snapshot archive to dest atomically.
+func writeSnapshotFrom(dest string, manifest *SnapshotManifest, archive io.Reader) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(copyVolumeEntries(archive, pw))
+	}()
+	defer pr.Close()
+	return writeSnapshot(dest, manifest, pr)
+}
+
+// writeArchive writes a gzipped tar with the manifest first, then the
+// entries produced by body, to a temporary file renamed over dest.
+func writeArchive(dest string, manifest *SnapshotManifest, body func(*tar.Writer) error) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+	hdr := &tar.Header{Name: snapshotManifest, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if err := body(tw); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// copyVolumeEntries writes the volume entries of a snapshot archive to w
+// as a plain tar stream rooted at /.
+func copyVolumeEntries(archive io.Reader, w io.Writer) error {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return tw.Close()
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Name == snapshotManifest {
+			continue
+		}
+		clean := path.Clean(hdr.Name)
+		if clean != snapshotRoot && !strings.HasPrefix(clean, snapshotRoot+"/") {
+			return fmt.Errorf("unexpected entry %q outside %s/", hdr.Name, snapshotRoot)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// copyFile copies src to dest, creating dest's directory.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if dir := filepath.Dir(dest); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// checkSnapshotVolumes validates that the volumes of manifest are named
+// like the volumes of its project (see VolumeName), so a crafted archive
+// cannot restore into volumes of another project.
+func checkSnapshotVolumes(manifest *SnapshotManifest) error {
+	for _, v := range manifest.Volumes {
+		if !strings.HasPrefix(v.Name, manifest.Project+"-") {
+			return &errors.ValidationError{
+				Field:   "volume",
+				Value:   v.Name,
+				Message: fmt.Sprintf("snapshot volume does not belong to project %q", manifest.Project),
+			}
+		}
+	}
+	return nil
+}
+
+// checkSnapshotKey validates that project, env and name are usable as path
+// segments.
+func checkSnapshotKey(project, env, name string) error {
+	for _, part := range []string{project, env, name} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return &errors.ValidationError{
+				Field:   "snapshot",
+				Value:   project + "/" + env + "/" + name,
+				Message: "project, environment and snapshot names must be non-empty path segments",
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,397 @@
+package fleet
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	stderrors "errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/docker"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/packs"
+)
+
+// volumeTar builds the tar stream a helper container returns for /volumes.
+func volumeTar(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "volumes/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tarFiles returns the regular files of a tar stream.
+func tarFiles(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(content)
+	}
+}
+
+func snapshotProject() *config.Project {
+	return &config.Project{
+		Project: "ai-agents",
+		Services: []*config.Service{
+			{Name: "redis", Pack: "redis"},
+			{Name: "app", Pack: "python-app", Requires: []string{"redis"}},
+		},
+	}
+}
+
+func newSnapshotMock(t *testing.T, files map[string]string) *docker.MockClient {
+	t.Helper()
+	mock := docker.NewMockClient()
+	mock.VolumeListResult = []docker.Volume{
+		{Name: "ai-agents-redis-data", Labels: Labels("ai-agents", "local", "redis")},
+	}
+	mock.ContainerListResult = []docker.Container{
+		{ID: "c-redis", Labels: Labels("ai-agents", "local", "redis")},
+		{ID: "c-app", Labels: Labels("ai-agents", "local", "app")},
+	}
+	data := volumeTar(t, files)
+	mock.OnCopyFrom = func(ctx context.Context, id, path string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return mock
+}
+
+func newTestSnapshotStore(t *testing.T) *SnapshotStore {
+	t.Helper()
+	store, err := NewSnapshotStore(WithSnapshotDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.now = func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) }
+	return store
+}
+
+func TestSnapshotStore_SaveRestore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSnapshotStore(t)
+	files := map[string]string{"volumes/ai-agents-redis-data/dump.rdb": "REDIS0011"}
+	mock := newSnapshotMock(t, files)
+
+	manifest, err := store.Save(ctx, mock, snapshotProject(), "local", "before-migration")
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	want := &SnapshotManifest{
+		Name:        "before-migration",
+		Project:     "ai-agents",
+		Environment: "local",
+		CreatedAt:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Packs:       map[string]string{"redis": "redis", "app": "python-app"},
+		Volumes:     []VolumeRecord{{Service: "redis", Name: "ai-agents-redis-data"}},
+	}
+	if diff := cmp.Diff(want, manifest); diff != "" {
+		t.Errorf("Save() manifest mismatch (-want +got):\n%s", diff)
+	}
+
+	// Only the volume's owner is stopped, and it is started again.
+	if diff := cmp.Diff([]string{"c-redis"}, mock.ContainerStopCalls); diff != "" {
+		t.Errorf("stopped containers mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"c-redis"}, mock.ContainerStartCalls); diff != "" {
+		t.Errorf("started containers mismatch (-want +got):\n%s", diff)
+	}
+	helper := mock.ContainerCreateCalls[0]
+	wantMounts := []docker.Mount{{Type: "volume", Source: "ai-agents-redis-data", Target: "/volumes/ai-agents-redis-data"}}
+	if diff := cmp.Diff(wantMounts, helper.Mounts); diff != "" {
+		t.Errorf("helper mounts mismatch (-want +got):\n%s", diff)
+	}
+	if len(mock.ContainerRemoveCalls) != 1 {
+		t.Errorf("helper containers removed = %d, want 1", len(mock.ContainerRemoveCalls))
+	}
+
+	loaded, err := store.Load("ai-agents", "local", "before-migration")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if diff := cmp.Diff(want, loaded); diff != "" {
+		t.Errorf("Load() mismatch (-want +got):\n%s", diff)
+	}
+
+	mock.Reset()
+	if _, err := store.Restore(ctx, mock, snapshotProject(), "local", "before-migration"); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	// A wipe helper runs first, then the archive is copied into a fresh helper.
+	if len(mock.ContainerCreateCalls) != 2 {
+		t.Fatalf("helpers created = %d, want 2", len(mock.ContainerCreateCalls))
+	}
+	if mock.ContainerCreateCalls[0].Cmd == nil || mock.ContainerCreateCalls[1].Cmd != nil {
+		t.Errorf("helper commands = %v, %v; want wipe then idle", mock.ContainerCreateCalls[0].Cmd, mock.ContainerCreateCalls[1].Cmd)
+	}
+	if len(mock.CopyToCalls) != 1 {
+		t.Fatalf("CopyToContainer calls = %d, want 1", len(mock.CopyToCalls))
+	}
+	if got := mock.CopyToCalls[0].Path; got != "/" {
+		t.Errorf("CopyToContainer path = %q, want /", got)
+	}
+	if diff := cmp.Diff(files, tarFiles(t, mock.CopyToCalls[0].Content)); diff != "" {
+		t.Errorf("restored files mismatch (-want +got):\n%s", diff)
+	}
+	if len(mock.VolumeCreateCalls) != 0 {
+		t.Errorf("VolumeCreate calls = %v, want none", mock.VolumeCreateCalls)
+	}
+}
+
+func TestSnapshotStore_RestoreCreatesMissingVolumes(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSnapshotStore(t)
+	mock := newSnapshotMock(t, map[string]string{"volumes/ai-agents-redis-data/dump.rdb": "x"})
+	if _, err := store.Save(ctx, mock, snapshotProject(), "local", "s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.Reset()
+	mock.VolumeListResult = nil
+	if _, err := store.Restore(ctx, mock, snapshotProject(), "local", "s1"); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	want := []docker.VolumeCreateCall{{
+		Name: "ai-agents-redis-data",
+		Opts: docker.VolumeCreateOptions{Labels: Labels("ai-agents", "local", "redis")},
+	}}
+	if diff := cmp.Diff(want, mock.VolumeCreateCalls); diff != "" {
+		t.Errorf("VolumeCreate calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSnapshotStore_RestoreRefusesForeignVolumes(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+	}{
+		{name: "unlabelled", labels: nil},
+		{name: "other project", labels: Labels("billing", "local", "redis")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newTestSnapshotStore(t)
+			mock := newSnapshotMock(t, map[string]string{"volumes/ai-agents-redis-data/dump.rdb": "x"})
+			if _, err := store.Save(ctx, mock, snapshotProject(), "local", "s1"); err != nil {
+				t.Fatal(err)
+			}
+
+			mock.Reset()
+			mock.VolumeListResult = []docker.Volume{{Name: "ai-agents-redis-data", Labels: tt.labels}}
+			var validation *errors.ValidationError
+			if _, err := store.Restore(ctx, mock, snapshotProject(), "local", "s1"); !stderrors.As(err, &validation) {
+				t.Fatalf("Restore() error = %v, want ValidationError", err)
+			}
+			if len(mock.VolumeCreateCalls) != 0 || len(mock.ContainerStopCalls) != 0 || len(mock.ContainerCreateCalls) != 0 {
+				t.Errorf("Restore() touched volumes: created %v, stopped %v, helpers %d",
+					mock.VolumeCreateCalls, mock.ContainerStopCalls, len(mock.ContainerCreateCalls))
+			}
+		})
+	}
+}
+
+func TestSnapshotStore_PackVersions(t *testing.T) {
+	ctx := context.Background()
+	lock := &packs.ProjectLock{Services: map[string]*packs.LockedPack{
+		"redis": {Pack: "redis", Version: "1.2.0"},
+	}}
+	store, err := NewSnapshotStore(WithSnapshotDir(t.TempDir()), WithSnapshotPackLock(lock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := newSnapshotMock(t, map[string]string{"volumes/ai-agents-redis-data/dump.rdb": "x"})
+
+	manifest, err := store.Save(ctx, mock, snapshotProject(), "local", "s1")
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if diff := cmp.Diff(map[string]string{"redis": "1.2.0"}, manifest.PackVersions); diff != "" {
+		t.Errorf("PackVersions mismatch (-want +got):\n%s", diff)
+	}
+
+	if skew := manifest.PackSkew(snapshotProject(), lock); len(skew) != 0 {
+		t.Errorf("PackSkew() = %v, want none", skew)
+	}
+	lock.Services["redis"].Version = "2.0.0"
+	project := snapshotProject()
+	project.Services[1].Pack = "node-app"
+	want := []string{
+		"snapshot was taken with redis using pack redis 1.2.0, now 2.0.0",
+		"snapshot was taken with app using pack 'python-app', now 'node-app'",
+	}
+	if diff := cmp.Diff(want, manifest.PackSkew(project, lock)); diff != "" {
+		t.Errorf("PackSkew() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSnapshotStore_RestoreWipeFailure(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSnapshotStore(t)
+	mock := newSnapshotMock(t, map[string]string{"volumes/ai-agents-redis-data/dump.rdb": "x"})
+	if _, err := store.Save(ctx, mock, snapshotProject(), "local", "s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.Reset()
+	mock.ContainerWaitCode = 1
+	_, err := store.Restore(ctx, mock, snapshotProject(), "local", "s1")
+	var fleetErr *FleetError
+	if !stderrors.As(err, &fleetErr) || fleetErr.Op != "snapshot.restore" {
+		t.Fatalf("Restore() error = %v, want snapshot.restore FleetError", err)
+	}
+	if len(mock.CopyToCalls) != 0 {
+		t.Error("archive copied after wipe failed")
+	}
+	// Stopped services are started again even on failure.
+	if diff := cmp.Diff([]string{"c-redis"}, mock.ContainerStopCalls); diff != "" {
+		t.Errorf("stopped containers mismatch (-want +got):\n%s", diff)
+	}
+	if len(mock.ContainerStartCalls) != 2 { // wipe helper + c-redis
+		t.Errorf("ContainerStart calls = %v", mock.ContainerStartCalls)
+	}
+}
+
+func TestSnapshotStore_SaveErrors(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSnapshotStore(t)
+
+	mock := docker.NewMockClient()
+	_, err := store.Save(ctx, mock, snapshotProject(), "local", "empty")
+	var notFound *errors.NotFoundError
+	if !stderrors.As(err, &notFound) {
+		t.Errorf("Save() without volumes error = %v, want NotFoundError", err)
+	}
+
+	_, err = store.Save(ctx, mock, snapshotProject(), "local", "../escape")
+	var validation *errors.ValidationError
+	if !stderrors.As(err, &validation) {
+		t.Errorf("Save() with bad name error = %v, want ValidationError", err)
+	}
+}
+
+func TestSnapshotStore_SavePullsHelperImage(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSnapshotStore(t)
+	mock := newSnapshotMock(t, map[string]string{"volumes/ai-agents-redis-data/dump.rdb": "x"})
+	mock.ContainerCreateError = stderrors.New("No such image: busybox:stable")
+	mock.OnImagePull = func(ctx context.Context, ref string) error {
+		mock.ContainerCreateError = nil
+		return nil
+	}
+
+	if _, err := store.Save(ctx, mock, snapshotProject(), "local", "s1"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if diff := cmp.Diff([]string{DefaultSnapshotImage}, mock.ImagePullCalls); diff != "" {
+		t.Errorf("ImagePull calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSnapshotStore_ListDeleteExportImport(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSnapshotStore(t)
+	mock := newSnapshotMock(t, map[string]string{"volumes/ai-agents-redis-data/dump.rdb": "x"})
+
+	for i, name := range []string{"first", "second"} {
+		store.now = func() time.Time { return time.Date(2026, 1, 1, i, 0, 0, 0, time.UTC) }
+		if _, err := store.Save(ctx, mock, snapshotProject(), "local", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := store.List("ai-agents", "local")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var names []string
+	for _, m := range list {
+		names = append(names, m.Name)
+	}
+	if diff := cmp.Diff([]string{"second", "first"}, names); diff != "" {
+		t.Errorf("List() mismatch (-want +got):\n%s", diff)
+	}
+
+	shared := filepath.Join(t.TempDir(), "out", "first.tar.gz")
+	if err := store.Export("ai-agents", "local", "first", shared); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	if err := store.Delete("ai-agents", "local", "first"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	var notFound *errors.NotFoundError
+	if err := store.Delete("ai-agents", "local", "first"); !stderrors.As(err, &notFound) {
+		t.Errorf("second Delete() error = %v, want NotFoundError", err)
+	}
+
+	// A colleague imports the export into another environment under a new name.
+	other := newTestSnapshotStore(t)
+	imported, err := other.Import("ai-agents", "staging", shared, "from-alice")
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if imported.Name != "from-alice" || imported.Environment != "staging" {
+		t.Errorf("Import() = %s/%s, want staging/from-alice", imported.Environment, imported.Name)
+	}
+	if _, err := os.Stat(other.Path("ai-agents", "staging", "from-alice")); err != nil {
+		t.Errorf("imported archive missing: %v", err)
+	}
+
+	var validation *errors.ValidationError
+	if _, err := other.Import("ai-agents", "staging", shared, "from-alice"); !stderrors.As(err, &validation) {
+		t.Errorf("Import() over existing error = %v, want ValidationError", err)
+	}
+	if _, err := other.Import("billing", "local", shared, ""); !stderrors.As(err, &validation) {
+		t.Errorf("Import() into other project error = %v, want ValidationError", err)
+	}
+
+	// An archive naming volumes of another project is refused.
+	crafted := filepath.Join(t.TempDir(), "crafted.tar.gz")
+	manifest := &SnapshotManifest{
+		Name:    "crafted",
+		Project: "ai-agents",
+		Volumes: []VolumeRecord{{Service: "redis", Name: "billing-postgres-data"}},
+	}
+	if err := writeSnapshot(crafted, manifest, bytes.NewReader(volumeTar(t, nil))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Import("ai-agents", "staging", crafted, ""); !stderrors.As(err, &validation) {
+		t.Errorf("Import() of foreign volumes error = %v, want ValidationError", err)
+	}
+}
@@ -0,0 +1,562 @@
+package fleet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/platform"
+)
+
+const (
+	// StateDirName is the directory under platform.DataDir() holding fleet state records.
+	StateDirName = "state"
+	// stateFileExt is the file extension of a state record.
+	stateFileExt = ".json"
+	// DefaultStateLockTimeout bounds how long a writer waits for the state lock.
+	DefaultStateLockTimeout = 10 * time.Second
+)
+
+// State records what a fleet operation actually created for one project
+// environment. destroy, status and hosts cleanup act on this record rather
+// than on yar.yaml, so resources are still found after the project config
+// changes or a service is deleted (INV-FLT-003, INV-NET-002).
+type State struct {
+	Project     string            `json:"project"`
+	Environment string            `json:"environment"`
+	ConfigHash  string            `json:"configHash,omitempty"` // hash of the rendered config applied
+	Containers  []ContainerRecord `json:"containers,omitempty"`
+	Networks    []NetworkRecord   `json:"networks,omitempty"`
+	Volumes     []VolumeRecord    `json:"volumes,omitempty"`
+	Hosts       []HostRecord      `json:"hosts,omitempty"`
+	Ports       []PortRecord      `json:"ports,omitempty"`
+	Secrets     []SecretRecord    `json:"secrets,omitempty"`
+	Jobs        []JobRecord       `json:"jobs,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+// ContainerRecord identifies a container created for a service.
+type ContainerRecord struct {
+	Service    string `json:"service"`
+	Name       string `json:"name"`
+	ID         string `json:"id"`
+	ConfigHash string `json:"configHash,omitempty"` // LabelConfigHash of the container
+}
+
+// NetworkRecord identifies a network created for the fleet.
+type NetworkRecord struct {
+	Name string `json:"name"`
+	ID   string `json:"id,omitempty"`
+}
+
+// VolumeRecord identifies a volume created for a service.
+type VolumeRecord struct {
+	Service string `json:"service"`
+	Name    string `json:"name"`
+}
+
+// HostRecord identifies a hosts file entry added for the fleet.
+type HostRecord struct {
+	Name string `json:"name"`
+	IP   string `json:"ip"`
+}
+
+// PortRecord identifies a host port assigned to a service.
+type PortRecord struct {
+	Service       string `json:"service"`
+	ContainerPort int    `json:"containerPort"`
+	HostPort      int    `json:"hostPort"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// SecretRecord identifies a secret mounted into a service.
+// Only names are recorded; secret values never reach the state file (INV-SEC-001).
+type SecretRecord struct {
+	Service string `json:"service"`
+	Name    string `json:"name"`
+	Target  string `json:"target,omitempty"` // mount path or env var inside the container
+}
+
+// JobRecord records the last successful run of a service job.
+type JobRecord struct {
+	Service     string    `json:"service"`
+	Name        string    `json:"name"`
+	Hash        string    `json:"hash"` // HashJob of the job and its inputs
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+// NewState returns an empty state record for a project environment.
+func NewState(project, env string) *State {
+	return &State{
+		Project:     project,
+		Environment: env,
+	}
+}
+
+// AddContainer records a container, replacing any record with the same name.
+func (s *State) AddContainer(rec ContainerRecord) {
+	for i := range s.Containers {
+		if s.Containers[i].Name == rec.Name {
+			s.Containers[i] = rec
+			return
+		}
+	}
+	s.Containers = append(s.Containers, rec)
+}
+
+// AddNetwork records a network, replacing any record with the same name.
+func (s *State) AddNetwork(rec NetworkRecord) {
+	for i := range s.Networks {
+		if s.Networks[i].Name == rec.Name {
+			s.Networks[i] = rec
+			return
+		}
+	}
+	s.Networks = append(s.Networks, rec)
+}
+
+// AddVolume records a volume, replacing any record with the same name.
+func (s *State) AddVolume(rec VolumeRecord) {
+	for i := range s.Volumes {
+		if s.Volumes[i].Name == rec.Name {
+			s.Volumes[i] = rec
+			return
+		}
+	}
+	s.Volumes = append(s.Volumes, rec)
+}
+
+// AddHost records a hosts entry, replacing any record with the same name.
+func (s *State) AddHost(rec HostRecord) {
+	for i := range s.Hosts {
+		if s.Hosts[i].Name == rec.Name {
+			s.Hosts[i] = rec
+			return
+		}
+	}
+	s.Hosts = append(s.Hosts, rec)
+}
+
+// AddPort records a port assignment, replacing any record for the same
+// service, container port and protocol.
+func (s *State) AddPort(rec PortRecord) {
+	for i := range s.Ports {
+		p := s.Ports[i]
+		if p.Service == rec.Service && p.ContainerPort == rec.ContainerPort && p.Protocol == rec.Protocol {
+			s.Ports[i] = rec
+			return
+		}
+	}
+	s.Ports = append(s.Ports, rec)
+}
+
+// AddSecret records a secret mount, replacing any record for the same
+// service and secret name.
+func (s *State) AddSecret(rec SecretRecord) {
+	for i := range s.Secrets {
+		if s.Secrets[i].Service == rec.Service && s.Secrets[i].Name == rec.Name {
+			s.Secrets[i] = rec
+			return
+		}
+	}
+	s.Secrets = append(s.Secrets, rec)
+}
+
+// AddJob records a successful job run, replacing any record for the same job.
+func (s *State) AddJob(rec JobRecord) {
+	for i := range s.Jobs {
+		if s.Jobs[i].Service == rec.Service && s.Jobs[i].Name == rec.Name {
+			s.Jobs[i] = rec
+			return
+		}
+	}
+	s.Jobs = append(s.Jobs, rec)
+}
+
+// AddJobResults records the jobs an Apply run completed at the given time.
+// Skipped jobs keep the record of their last run.
+func (s *State) AddJobResults(jobs []JobResult, at time.Time) {
+	for _, j := range jobs {
+		if !j.Skipped {
+			s.AddJob(JobRecord{Service: j.Service, Name: j.Job, Hash: j.Hash, CompletedAt: at})
+		}
+	}
+}
+
+// AddResource records a resource returned by ServiceDriver.Start.
+func (s *State) AddResource(res Resource) {
+	switch res.Kind {
+	case ResourceContainer:
+		s.AddContainer(ContainerRecord{Service: res.Service, Name: res.Name, ID: res.ID})
+	case ResourceNetwork:
+		s.AddNetwork(NetworkRecord{Name: res.Name, ID: res.ID})
+	case ResourceVolume:
+		s.AddVolume(VolumeRecord{Service: res.Service, Name: res.Name})
+	}
+}
+
+// RemoveResource drops the record of a resource. Removing the last
+// container of a service drops its ports and secrets too.
+func (s *State) RemoveResource(res Resource) {
+	switch res.Kind {
+	case ResourceContainer:
+		s.Containers = slices.DeleteFunc(s.Containers, func(c ContainerRecord) bool { return c.Name == res.Name })
+		if !slices.ContainsFunc(s.Containers, func(c ContainerRecord) bool { return c.Service == res.Service }) {
+			s.Ports = slices.DeleteFunc(s.Ports, func(p PortRecord) bool { return p.Service == res.Service })
+			s.Secrets = slices.DeleteFunc(s.Secrets, func(sec SecretRecord) bool { return sec.Service == res.Service })
+		}
+	case ResourceNetwork:
+		s.Networks = slices.DeleteFunc(s.Networks, func(n NetworkRecord) bool { return n.Name == res.Name })
+	case ResourceVolume:
+		s.Volumes = slices.DeleteFunc(s.Volumes, func(v VolumeRecord) bool { return v.Name == res.Name })
+	}
+}
+
+// Resources returns the recorded containers, volumes and networks in the
+// order they can be removed: containers before the volumes and networks
+// they use.
+func (s *State) Resources() []Resource {
+	var resources []Resource
+	for _, c := range s.Containers {
+		resources = append(resources, Resource{Kind: ResourceContainer, Service: c.Service, Name: c.Name, ID: c.ID})
+	}
+	for _, v := range s.Volumes {
+		resources = append(resources, Resource{Kind: ResourceVolume, Service: v.Service, Name: v.Name})
+	}
+	for _, n := range s.Networks {
+		resources = append(resources, Resource{Kind: ResourceNetwork, Name: n.Name, ID: n.ID})
+	}
+	return resources
+}
+
+// JobHashes returns the hash of each job's last successful run by JobKey,
+// for ApplyOptions.CompletedJobs.
+func (s *State) JobHashes() map[string]string {
+	hashes := make(map[string]string, len(s.Jobs))
+	for _, j := range s.Jobs {
+		hashes[JobKey(j.Service, j.Name)] = j.Hash
+	}
+	return hashes
+}
+
+// Empty reports whether the record holds no resources.
+func (s *State) Empty() bool {
+	return len(s.Containers) == 0 && len(s.Networks) == 0 && len(s.Volumes) == 0 &&
+		len(s.Hosts) == 0 && len(s.Ports) == 0 && len(s.Secrets) == 0
+}
+
+// HashConfig returns a stable content hash of a rendered configuration.
+func HashConfig(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// StateStore persists fleet state records under platform.DataDir().
+// Records live at <dir>/<project>/<env>.json and every write is atomic
+// and serialized through a Locker lock file next to the record, so a lock
+// left by a crashed writer is broken rather than waited out.
+type StateStore struct {
+	dir         string
+	lockTimeout time.Duration
+	locker      *Locker
+}
+
+// StateOption configures a StateStore.
+type StateOption func(*StateStore)
+
+// WithStateDir sets the directory holding state records.
+func WithStateDir(dir string) StateOption {
+	return func(s *StateStore) {
+		s.dir = dir
+	}
+}
+
+// WithStateLockTimeout sets how long writers wait for the state lock.
+func WithStateLockTimeout(timeout time.Duration) StateOption {
+	return func(s *StateStore) {
+		s.lockTimeout = timeout
+	}
+}
+
+// NewStateStore creates a state store. Defaults to <DataDir>/state.
+func NewStateStore(opts ...StateOption) (*StateStore, error) {
+	s := &StateStore{
+		lockTimeout: DefaultStateLockTimeout,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.dir == "" {
+		dataDir, err := platform.DataDir()
+		if err != nil {
+			return nil, ErrStateLoad("", err)
+		}
+		s.dir = filepath.Join(dataDir, StateDirName)
+	}
+
+	locker, err := NewLocker(WithLockDir(s.dir))
+	if err != nil {
+		return nil, err
+	}
+	s.locker = locker
+	return s, nil
+}
+
+// Dir returns the directory holding state records.
+func (s *StateStore) Dir() string {
+	return s.dir
+}
+
+// Path returns the state record path for a project environment.
+func (s *StateStore) Path(project, env string) string {
+	return filepath.Join(s.dir, project, env+stateFileExt)
+}
+
+// Load reads the state record for a project environment.
+// Returns NotFoundError if nothing has been recorded.
+func (s *StateStore) Load(project, env string) (*State, error) {
+	if err := checkStateKey(project, env); err != nil {
+		return nil, err
+	}
+
+	path := s.Path(project, env)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &errors.NotFoundError{
+				Resource: "fleet state",
+				Name:     project + "/" + env,
+				Message:  "no resources recorded; run 'yar fleet up' first",
+			}
+		}
+		return nil, ErrStateLoad(path, err)
+	}
+
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, ErrStateLoad(path, err)
+	}
+	return &st, nil
+}
+
+// Save writes a state record, replacing any existing one.
+func (s *StateStore) Save(st *State) error {
+	_, err := s.Update(st.Project, st.Environment, func(cur *State) error {
+		*cur = *st
+		return nil
+	})
+	return err
+}
+
+// Update loads the record for a project environment (or starts an empty one),
+// applies fn and writes the result atomically, all while holding the writer
+// lock. Returns the record as written.
+func (s *StateStore) Update(project, env string, fn func(*State) error) (*State, error) {
+	if err := checkStateKey(project, env); err != nil {
+		return nil, err
+	}
+
+	path := s.Path(project, env)
+	unlock, err := s.lock(project, env)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	st, err := s.Load(project, env)
+	if err != nil {
+		var notFound *errors.NotFoundError
+		if !stderrors.As(err, &notFound) {
+			return nil, err
+		}
+		st = NewState(project, env)
+	}
+
+	if err := fn(st); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if st.CreatedAt.IsZero() {
+		st.CreatedAt = now
+	}
+	st.UpdatedAt = now
+	st.Project = project
+	st.Environment = env
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return nil, ErrStateSave(path, err)
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return nil, ErrStateSave(path, err)
+	}
+	return st, nil
+}
+
+// Delete removes the state record for a project environment.
+// Returns nil if no record exists (idempotent).
+func (s *StateStore) Delete(project, env string) error {
+	if err := checkStateKey(project, env); err != nil {
+		return err
+	}
+
+	path := s.Path(project, env)
+	unlock, err := s.lock(project, env)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return ErrStateSave(path, err)
+	}
+	return nil
+}
+
+// lock takes the writer lock of a project environment's record.
+func (s *StateStore) lock(project, env string) (func() error, error) {
+	holder := NewLockHolder("fleet state " + FleetLockName(project, env))
+	unlock, err := s.locker.Lock(context.Background(), FleetLockName(project, env), holder, LockOptions{Timeout: s.lockTimeout})
+	if err != nil {
+		return nil, ErrStateLocked(s.Path(project, env), err)
+	}
+	return unlock, nil
+}
+
+// checkStateKey rejects project or environment names that would escape the state directory.
+func checkStateKey(project, env string) error {
+	for _, part := range []string{project, env} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return &errors.ValidationError{
+				Field:   "fleet state",
+				Value:   project + "/" + env,
+				Message: "project and environment names must be non-empty path segments",
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it over path, so readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// stateRecorder is implemented by drivers that know more of a started
+// service than the resources Start returns.
+type stateRecorder interface {
+	// recordService records what the last Start of service runs with:
+	// its published ports, secret files and container config hashes.
+	recordService(st *State, service string)
+}
+
+// stateDriver keeps the state record of a project environment in step
+// with what its ServiceDriver creates and removes.
+type stateDriver struct {
+	ServiceDriver
+	store   *StateStore
+	project string
+	env     string
+}
+
+// RecordState wraps driver so the resources each Start creates are added
+// to the state record of project env as soon as Start returns, and those
+// Remove deletes are dropped from it. A failed or killed run thus leaves a
+// record that destroy can act on (INV-FLT-003). Drivers that know the
+// ports and secrets a service runs with have them recorded too. Jobs are
+// passed on to driver if it is a JobRunner.
+func RecordState(driver ServiceDriver, store *StateStore, project, env string) ServiceDriver {
+	return &stateDriver{ServiceDriver: driver, store: store, project: project, env: env}
+}
+
+// Start implements ServiceDriver.
+func (d *stateDriver) Start(ctx context.Context, svc *config.Service) ([]Resource, error) {
+	created, err := d.ServiceDriver.Start(ctx, svc)
+	recorder, ok := d.ServiceDriver.(stateRecorder)
+	if len(created) == 0 && !ok {
+		return created, err
+	}
+	if _, serr := d.store.Update(d.project, d.env, func(st *State) error {
+		for _, res := range created {
+			st.AddResource(res)
+		}
+		if ok {
+			recorder.recordService(st, svc.Name)
+		}
+		return nil
+	}); serr != nil {
+		return created, stderrors.Join(err, serr)
+	}
+	return created, err
+}
+
+// Remove implements ServiceDriver.
+func (d *stateDriver) Remove(ctx context.Context, res Resource) error {
+	if err := d.ServiceDriver.Remove(ctx, res); err != nil {
+		return err
+	}
+	_, err := d.store.Update(d.project, d.env, func(st *State) error {
+		st.RemoveResource(res)
+		return nil
+	})
+	return err
+}
+
+// RunJob implements JobRunner.
+func (d *stateDriver) RunJob(ctx context.Context, svc *config.Service, job *config.Job) error {
+	runner, ok := d.ServiceDriver.(JobRunner)
+	if !ok {
+		return ErrJob(JobKey(svc.Name, job.Name), stderrors.New("driver does not support jobs"))
+	}
+	return runner.RunJob(ctx, svc, job)
+}
@@ -0,0 +1,459 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+func newTestStateStore(t *testing.T, opts ...StateOption) *StateStore {
+	t.Helper()
+	opts = append([]StateOption{WithStateDir(t.TempDir())}, opts...)
+	store, err := NewStateStore(opts...)
+	if err != nil {
+		t.Fatalf("NewStateStore() error = %v", err)
+	}
+	return store
+}
+
+func TestNewStateStore_DefaultDir(t *testing.T) {
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+
+	store, err := NewStateStore()
+	if err != nil {
+		t.Fatalf("NewStateStore() error = %v", err)
+	}
+
+	want := filepath.Join(dataHome, "yar", StateDirName)
+	if store.Dir() != want {
+		t.Errorf("Dir() = %q, want %q", store.Dir(), want)
+	}
+}
+
+func TestStateStore_Path(t *testing.T) {
+	store, err := NewStateStore(WithStateDir("/data/state"))
+	if err != nil {
+		t.Fatalf("NewStateStore() error = %v", err)
+	}
+
+	got := store.Path("ai-agents", "local")
+	want := filepath.Join("/data/state", "ai-agents", "local.json")
+	if got != want {
+		t.Errorf("Path() = %q, want %q", got, want)
+	}
+}
+
+func TestStateStore_LoadNotFound(t *testing.T) {
+	store := newTestStateStore(t)
+
+	_, err := store.Load("ai-agents", "local")
+	if _, ok := err.(*errors.NotFoundError); !ok {
+		t.Fatalf("Load() error = %T (%v), want *errors.NotFoundError", err, err)
+	}
+}
+
+func TestStateStore_UpdateAndLoad(t *testing.T) {
+	store := newTestStateStore(t)
+
+	written, err := store.Update("ai-agents", "local", func(st *State) error {
+		st.ConfigHash = "sha256:abc"
+		st.AddNetwork(NetworkRecord{Name: "yar-net", ID: "net-1"})
+		st.AddContainer(ContainerRecord{Service: "redis", Name: "ai-agents-redis", ID: "c-1"})
+		st.AddVolume(VolumeRecord{Service: "redis", Name: "ai-agents-redis-data"})
+		st.AddHost(HostRecord{Name: "redis.ai-agents-redis", IP: "172.16.34.2"})
+		st.AddPort(PortRecord{Service: "redis", ContainerPort: 6379, HostPort: 6379, Protocol: "tcp"})
+		st.AddSecret(SecretRecord{Service: "redis", Name: "redis_pass", Target: "/run/secrets/redis_pass"})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if written.CreatedAt.IsZero() || written.UpdatedAt.IsZero() {
+		t.Error("Update() did not set timestamps")
+	}
+
+	got, err := store.Load("ai-agents", "local")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if diff := cmp.Diff(written, got); diff != "" {
+		t.Errorf("Load() mismatch (-written +loaded):\n%s", diff)
+	}
+	if got.Project != "ai-agents" || got.Environment != "local" {
+		t.Errorf("Load() key = %s/%s, want ai-agents/local", got.Project, got.Environment)
+	}
+}
+
+func TestStateStore_UpdatePreservesCreatedAt(t *testing.T) {
+	store := newTestStateStore(t)
+
+	first, err := store.Update("ai-agents", "local", func(st *State) error { return nil })
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	second, err := store.Update("ai-agents", "local", func(st *State) error {
+		st.AddNetwork(NetworkRecord{Name: "yar-net"})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("CreatedAt changed: %v -> %v", first.CreatedAt, second.CreatedAt)
+	}
+}
+
+func TestStateStore_UpdateCallbackError(t *testing.T) {
+	store := newTestStateStore(t)
+	wantErr := fmt.Errorf("boom")
+
+	_, err := store.Update("ai-agents", "local", func(st *State) error { return wantErr })
+	if err != wantErr {
+		t.Fatalf("Update() error = %v, want %v", err, wantErr)
+	}
+	if _, err := os.Stat(store.Path("ai-agents", "local")); !os.IsNotExist(err) {
+		t.Errorf("record written despite callback error (stat err = %v)", err)
+	}
+}
+
+func TestStateStore_AtomicWriteLeavesNoTempFiles(t *testing.T) {
+	store := newTestStateStore(t)
+
+	if err := store.Save(NewState("ai-agents", "local")); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(store.Dir(), "ai-agents"))
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if diff := cmp.Diff([]string{"local.json"}, names); diff != "" {
+		t.Errorf("state dir contents mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStateStore_ConcurrentUpdates(t *testing.T) {
+	store := newTestStateStore(t)
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := store.Update("ai-agents", "local", func(st *State) error {
+				st.AddContainer(ContainerRecord{
+					Service: "app",
+					Name:    fmt.Sprintf("ai-agents-app-%d", i),
+					ID:      fmt.Sprintf("c-%d", i),
+				})
+				return nil
+			})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+
+	st, err := store.Load("ai-agents", "local")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(st.Containers) != writers {
+		t.Errorf("len(Containers) = %d, want %d (lost update)", len(st.Containers), writers)
+	}
+}
+
+func TestStateStore_LockTimeout(t *testing.T) {
+	store := newTestStateStore(t, WithStateLockTimeout(100*time.Millisecond))
+
+	lockPath := store.locker.Path(FleetLockName("ai-agents", "local"))
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lockPath, []byte("12345\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := store.Update("ai-agents", "local", func(st *State) error { return nil })
+	fleetErr, ok := err.(*FleetError)
+	if !ok {
+		t.Fatalf("Update() error = %T (%v), want *FleetError", err, err)
+	}
+	if fleetErr.Op != "state.lock" {
+		t.Errorf("FleetError.Op = %q, want %q", fleetErr.Op, "state.lock")
+	}
+}
+
+func TestStateStore_StaleLock(t *testing.T) {
+	store := newTestStateStore(t, WithStateLockTimeout(100*time.Millisecond))
+	store.locker.alive = func(pid int) bool { return false }
+
+	holder, err := json.Marshal(NewLockHolder("yar fleet up"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockPath := store.locker.Path(FleetLockName("ai-agents", "local"))
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lockPath, holder, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Update("ai-agents", "local", func(st *State) error { return nil }); err != nil {
+		t.Fatalf("Update() with a stale lock error = %v", err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind after Update(): %v", err)
+	}
+}
+
+func TestStateStore_Delete(t *testing.T) {
+	store := newTestStateStore(t)
+
+	if err := store.Save(NewState("ai-agents", "local")); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.Delete("ai-agents", "local"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Load("ai-agents", "local"); err == nil {
+		t.Error("Load() after Delete() succeeded, want NotFoundError")
+	}
+
+	// Idempotent
+	if err := store.Delete("ai-agents", "local"); err != nil {
+		t.Errorf("second Delete() error = %v", err)
+	}
+}
+
+func TestStateStore_RejectsUnsafeKeys(t *testing.T) {
+	store := newTestStateStore(t)
+
+	tests := map[string]struct {
+		project string
+		env     string
+	}{
+		"empty project":     {project: "", env: "local"},
+		"empty env":         {project: "ai-agents", env: ""},
+		"parent traversal":  {project: "..", env: "local"},
+		"slash in env":      {project: "ai-agents", env: "../other"},
+		"backslash project": {project: `a\b`, env: "local"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := store.Load(tc.project, tc.env)
+			if _, ok := err.(*errors.ValidationError); !ok {
+				t.Errorf("Load(%q, %q) error = %T (%v), want *errors.ValidationError", tc.project, tc.env, err, err)
+			}
+		})
+	}
+}
+
+func TestState_AddIsIdempotent(t *testing.T) {
+	st := NewState("ai-agents", "local")
+
+	for i := 0; i < 2; i++ {
+		st.AddContainer(ContainerRecord{Service: "redis", Name: "ai-agents-redis", ID: fmt.Sprintf("c-%d", i)})
+		st.AddNetwork(NetworkRecord{Name: "yar-net"})
+		st.AddVolume(VolumeRecord{Service: "redis", Name: "redis-data"})
+		st.AddHost(HostRecord{Name: "redis.ai-agents-redis", IP: "172.16.34.2"})
+		st.AddPort(PortRecord{Service: "redis", ContainerPort: 6379, HostPort: 6379, Protocol: "tcp"})
+		st.AddSecret(SecretRecord{Service: "redis", Name: "redis_pass"})
+	}
+
+	counts := map[string]int{
+		"Containers": len(st.Containers),
+		"Networks":   len(st.Networks),
+		"Volumes":    len(st.Volumes),
+		"Hosts":      len(st.Hosts),
+		"Ports":      len(st.Ports),
+		"Secrets":    len(st.Secrets),
+	}
+	for field, n := range counts {
+		if n != 1 {
+			t.Errorf("len(%s) = %d, want 1", field, n)
+		}
+	}
+	if st.Containers[0].ID != "c-1" {
+		t.Errorf("AddContainer did not replace record: ID = %q, want %q", st.Containers[0].ID, "c-1")
+	}
+}
+
+func TestState_RemoveResource(t *testing.T) {
+	st := NewState("ai-agents", "local")
+	st.AddNetwork(NetworkRecord{Name: "yar-net"})
+	st.AddContainer(ContainerRecord{Service: "app", Name: "ai-agents-app"})
+	st.AddContainer(ContainerRecord{Service: "app", Name: "ai-agents-app-worker"})
+	st.AddPort(PortRecord{Service: "app", ContainerPort: 8080, HostPort: 8080})
+	st.AddSecret(SecretRecord{Service: "app", Name: "app_token"})
+
+	st.RemoveResource(Resource{Kind: ResourceContainer, Service: "app", Name: "ai-agents-app"})
+	if len(st.Ports) != 1 || len(st.Secrets) != 1 {
+		t.Errorf("ports and secrets dropped with containers of the service left: %+v, %+v", st.Ports, st.Secrets)
+	}
+
+	st.RemoveResource(Resource{Kind: ResourceContainer, Service: "app", Name: "ai-agents-app-worker"})
+	if len(st.Ports) != 0 || len(st.Secrets) != 0 {
+		t.Errorf("ports and secrets kept after the last container: %+v, %+v", st.Ports, st.Secrets)
+	}
+	if st.Empty() {
+		t.Error("Empty() = true with a network recorded, want false")
+	}
+	st.RemoveResource(Resource{Kind: ResourceNetwork, Name: "yar-net"})
+	if !st.Empty() {
+		t.Errorf("Empty() = false, want true: %+v", st)
+	}
+}
+
+func TestState_Resources(t *testing.T) {
+	st := NewState("ai-agents", "local")
+	created := []Resource{
+		{Kind: ResourceNetwork, Name: "yar-net", ID: "n1"},
+		{Kind: ResourceVolume, Service: "db", Name: "ai-agents-db-data"},
+		{Kind: ResourceContainer, Service: "db", Name: "ai-agents-db", ID: "c1"},
+	}
+	for _, res := range created {
+		st.AddResource(res)
+	}
+
+	want := []Resource{created[2], created[1], created[0]}
+	if diff := cmp.Diff(want, st.Resources()); diff != "" {
+		t.Errorf("Resources() mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, res := range created {
+		st.RemoveResource(res)
+	}
+	if !st.Empty() {
+		t.Errorf("record not empty after RemoveResource: %+v", st)
+	}
+}
+
+func TestState_AddJobResults(t *testing.T) {
+	st := NewState("ai-agents", "local")
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	st.AddJob(JobRecord{Service: "db", Name: "seed", Hash: "sha256:seed", CompletedAt: earlier})
+
+	now := earlier.Add(time.Hour)
+	st.AddJobResults([]JobResult{
+		{Service: "db", Job: "migrate", Hash: "sha256:migrate"},
+		{Service: "db", Job: "seed", Hash: "sha256:seed", Skipped: true},
+	}, now)
+
+	want := []JobRecord{
+		{Service: "db", Name: "seed", Hash: "sha256:seed", CompletedAt: earlier},
+		{Service: "db", Name: "migrate", Hash: "sha256:migrate", CompletedAt: now},
+	}
+	if diff := cmp.Diff(want, st.Jobs); diff != "" {
+		t.Errorf("job records mismatch (-want +got):\n%s", diff)
+	}
+	if got := st.JobHashes()["db/migrate"]; got != "sha256:migrate" {
+		t.Errorf("JobHashes()[db/migrate] = %q, want sha256:migrate", got)
+	}
+}
+
+func TestRecordState(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStateStore(t)
+	inner := &fakeDriver{failOn: map[string]error{"app": stderrors.New("boom")}}
+	driver := RecordState(inner, store, "ai-agents", "local")
+
+	if _, err := driver.Start(ctx, &config.Service{Name: "db"}); err != nil {
+		t.Fatalf("Start(db) error = %v", err)
+	}
+	// A failed start still records what it created.
+	if _, err := driver.Start(ctx, &config.Service{Name: "app"}); err == nil {
+		t.Fatal("Start(app) error = nil, want failure")
+	}
+	st, err := store.Load("ai-agents", "local")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := []ContainerRecord{{Service: "db", Name: "p-db"}, {Service: "app", Name: "p-app"}}
+	if diff := cmp.Diff(want, st.Containers); diff != "" {
+		t.Errorf("recorded containers mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := driver.Remove(ctx, Resource{Kind: ResourceContainer, Service: "db", Name: "p-db"}); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	st, _ = store.Load("ai-agents", "local")
+	if diff := cmp.Diff(want[1:], st.Containers); diff != "" {
+		t.Errorf("containers after Remove mismatch (-want +got):\n%s", diff)
+	}
+
+	err = driver.(JobRunner).RunJob(ctx, &config.Service{Name: "db"}, migrateJob())
+	var ferr *FleetError
+	if !stderrors.As(err, &ferr) || ferr.Op != "job" {
+		t.Errorf("RunJob() error = %v, want job FleetError for a driver without jobs", err)
+	}
+}
+
+func TestHashConfig(t *testing.T) {
+	a, err := HashConfig(map[string]any{"project": "ai-agents", "replicas": 1})
+	if err != nil {
+		t.Fatalf("HashConfig() error = %v", err)
+	}
+	b, err := HashConfig(map[string]any{"replicas": 1, "project": "ai-agents"})
+	if err != nil {
+		t.Fatalf("HashConfig() error = %v", err)
+	}
+	c, err := HashConfig(map[string]any{"project": "ai-agents", "replicas": 2})
+	if err != nil {
+		t.Fatalf("HashConfig() error = %v", err)
+	}
+
+	if a != b {
+		t.Errorf("HashConfig() not stable across key order: %q != %q", a, b)
+	}
+	if a == c {
+		t.Error("HashConfig() same hash for different configs")
+	}
+	if len(a) != len("sha256:")+64 {
+		t.Errorf("HashConfig() = %q, want sha256:<64 hex>", a)
+	}
+}
+
+func TestFleetError(t *testing.T) {
+	inner := fmt.Errorf("disk full")
+	err := ErrStateSave("/data/state/p/local.json", inner)
+
+	want := "fleet state.save /data/state/p/local.json: failed to write fleet state: disk full"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if err.Unwrap() != inner {
+		t.Errorf("Unwrap() = %v, want %v", err.Unwrap(), inner)
+	}
+
+	noInner := NewFleetError("state.lock", "p/local", "locked", nil)
+	if noInner.Error() != "fleet state.lock p/local: locked" {
+		t.Errorf("Error() = %q", noInner.Error())
+	}
+}
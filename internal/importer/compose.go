@@ -0,0 +1,532 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/compose-spec/compose-go/v2/types"
+	"gopkg.in/yaml.v3"
+
+	"github.com/yar-run/yar/internal/config"
+)
+
+// GenericPack is the built-in pack used for services whose image matches
+// no other built-in pack. It runs the image as is.
+const GenericPack = "container"
+
+// builtinPacks maps the last path component of an image repository to the
+// built-in pack that provides it.
+var builtinPacks = map[string]string{
+	"redis":      "redis",
+	"postgres":   "postgres",
+	"postgresql": "postgres",
+	"kafka":      "kafka",
+	"cp-kafka":   "kafka",
+}
+
+// packEnvParams maps environment variables read by the images of built-in
+// packs to the pack params that set them. Params ending in Ref take a
+// secret reference, to which the value is moved.
+var packEnvParams = map[string]map[string]string{
+	"redis":    {"REDIS_PASSWORD": "passwordRef"},
+	"postgres": {"POSTGRES_PASSWORD": "passwordRef", "POSTGRES_DB": "database", "POSTGRES_USER": "user"},
+}
+
+// packRequiredSecrets names, for built-in packs requiring a secret param,
+// the environment variable the secret reference is named after when the
+// compose file does not set it.
+var packRequiredSecrets = map[string]string{
+	"postgres": "POSTGRES_PASSWORD",
+}
+
+// secretKey matches environment variable names whose values are treated
+// as secrets.
+var secretKey = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|private_?key|credential)`)
+
+// hostVariable matches a ${VAR} or $VAR reference to the host environment.
+var hostVariable = regexp.MustCompile(`\$\{?[A-Za-z_][A-Za-z0-9_]*`)
+
+// handledKeys are the compose service keys ImportCompose translates. Any
+// other key set on a service is reported.
+var handledKeys = map[string]bool{
+	"image":       true,
+	"command":     true,
+	"entrypoint":  true,
+	"environment": true,
+	"ports":       true,
+	"volumes":     true,
+	"depends_on":  true,
+	"healthcheck": true,
+	"deploy":      true,
+	"scale":       true,
+	"networks":    true,
+}
+
+// ComposeOptions configures ImportCompose.
+type ComposeOptions struct {
+	Project string // Project name; the compose name or directory name when empty
+}
+
+// Note is one entry of the import report: something that was changed,
+// moved or could not be translated.
+type Note struct {
+	Service string // Empty for project-level notes
+	Field   string // Compose key, such as "build" or "environment.DB_PASSWORD"
+	Message string
+}
+
+// String formats the note for display.
+func (n Note) String() string {
+	switch {
+	case n.Service == "":
+		return fmt.Sprintf("%s: %s", n.Field, n.Message)
+	case n.Field == "":
+		return fmt.Sprintf("%s: %s", n.Service, n.Message)
+	}
+	return fmt.Sprintf("%s.%s: %s", n.Service, n.Field, n.Message)
+}
+
+// MovedSecret is a plaintext environment value moved into secretRefs. The
+// value is not kept; it must be stored under Ref with 'yar secret set'.
+type MovedSecret struct {
+	Service string
+	Env     string
+	Ref     string
+}
+
+// ComposeResult is a project imported from a compose file. Secrets lists
+// the environment values moved into secretRefs; they are not repeated in
+// Notes.
+type ComposeResult struct {
+	Project *config.Project
+	Secrets []MovedSecret
+	Notes   []Note
+}
+
+// ImportCompose converts a compose file into a yar project with a single
+// local environment. Each service uses the built-in pack matching its
+// image, or GenericPack, and gets only params the pack's schema declares:
+// the image and ports of every service, the variables of packEnvParams,
+// and the command, entrypoint and named volumes of generic services.
+// depends_on becomes requires, replicas carry over, and other environment
+// values become env or, when their name looks like a secret, secretRefs.
+// Healthchecks and bind mounts have no pack equivalent and are reported.
+// Variables are not interpolated, so ${VAR} references are kept and
+// reported.
+func ImportCompose(ctx context.Context, path string, opts ComposeOptions) (*ComposeResult, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, ErrComposeLoad(path, err)
+	}
+
+	loadOpts := []cli.ProjectOptionsFn{
+		cli.WithWorkingDirectory(filepath.Dir(abs)),
+		cli.WithInterpolation(false),
+		cli.WithResolvedPaths(false),
+		cli.WithDiscardEnvFile,
+	}
+	if opts.Project != "" {
+		loadOpts = append(loadOpts, cli.WithName(projectName(opts.Project)))
+	}
+
+	po, err := cli.NewProjectOptions([]string{abs}, loadOpts...)
+	if err != nil {
+		return nil, ErrComposeLoad(path, err)
+	}
+	cp, err := po.LoadProject(ctx)
+	if err != nil {
+		return nil, ErrComposeLoad(path, err)
+	}
+
+	c := &converter{
+		result: &ComposeResult{Project: &config.Project{
+			Project: projectName(cp.Name),
+			Environments: map[string]*config.Environment{
+				"local": {Cluster: "local", Secrets: "local"},
+			},
+		}},
+		names: make(map[string]string, len(cp.Services)),
+	}
+	c.convert(cp)
+
+	if err := config.ValidateProject(c.result.Project); err != nil {
+		return nil, ErrComposeConvert(path, err)
+	}
+	return c.result, nil
+}
+
+// YAML encodes the imported project as yar.yaml content, with a header
+// naming the compose file it came from.
+func (r *ComposeResult) YAML(source string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Imported from %s by 'yar project import compose'.\n", source)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(r.Project); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// converter accumulates the result of one import.
+type converter struct {
+	result *ComposeResult
+	names  map[string]string // compose service name to yar service name
+}
+
+// note adds an entry to the report.
+func (c *converter) note(service, field, format string, args ...any) {
+	c.result.Notes = append(c.result.Notes, Note{Service: service, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// convert converts every service, in name order, and reports the
+// top-level elements yar does not model.
+func (c *converter) convert(cp *types.Project) {
+	composeNames := make([]string, 0, len(cp.Services))
+	for name := range cp.Services {
+		composeNames = append(composeNames, name)
+	}
+	sort.Strings(composeNames)
+	for _, name := range composeNames {
+		c.names[name] = serviceName(name)
+	}
+
+	for _, name := range composeNames {
+		c.result.Project.Services = append(c.result.Project.Services, c.service(cp.Services[name]))
+	}
+
+	for _, name := range sortedKeys(cp.Networks) {
+		if name != "default" {
+			c.note("", "networks."+name, "not translated; all services share the fleet network")
+		}
+	}
+	for _, name := range sortedKeys(cp.Volumes) {
+		if v := cp.Volumes[name]; v.Driver != "" || bool(v.External) {
+			c.note("", "volumes."+name, "driver and external volumes are not translated; yar creates its own volume")
+		}
+	}
+	for _, name := range sortedKeys(cp.Secrets) {
+		c.note("", "secrets."+name, "not translated; store it with 'yar secret set' and reference it from secretRefs")
+	}
+	for _, name := range sortedKeys(cp.Configs) {
+		c.note("", "configs."+name, "not translated")
+	}
+}
+
+// service converts one compose service.
+func (c *converter) service(sc types.ServiceConfig) *config.Service {
+	svc := &config.Service{Name: c.names[sc.Name], Params: map[string]any{}}
+	if svc.Name != sc.Name {
+		c.note(svc.Name, "", "renamed from %q to match ^[a-z][a-z0-9-]*$", sc.Name)
+	}
+
+	repo, tag := splitImage(sc.Image)
+	if pack, ok := builtinPacks[repo[strings.LastIndex(repo, "/")+1:]]; ok && sc.Image != "" {
+		svc.Pack = pack
+		if tag != "" && tag != "latest" {
+			svc.Params["image"] = sc.Image
+		}
+		if sc.Command != nil || sc.Entrypoint != nil {
+			c.note(svc.Name, "command", "not translated; the %s pack sets its own command", pack)
+		}
+	} else {
+		svc.Pack = GenericPack
+		if sc.Image == "" {
+			c.note(svc.Name, "image", "missing; set params.image to an image built from the compose build context")
+		} else {
+			svc.Params["image"] = sc.Image
+		}
+		if len(sc.Command) > 0 {
+			svc.Params["command"] = stringsParam(sc.Command)
+		}
+		if len(sc.Entrypoint) > 0 {
+			svc.Params["entrypoint"] = stringsParam(sc.Entrypoint)
+		}
+	}
+
+	c.requires(svc, sc)
+	c.environment(svc, sc)
+	c.ports(svc, sc)
+	c.volumes(svc, sc)
+	c.healthcheck(svc, sc)
+	c.replicas(svc, sc)
+	c.requiredSecrets(svc)
+
+	for _, key := range unhandledKeys(sc) {
+		if key == "build" {
+			c.note(svc.Name, key, "not translated; yar runs prebuilt images, so build and push params.image separately")
+			continue
+		}
+		c.note(svc.Name, key, "not translated")
+	}
+	if len(svc.Params) == 0 {
+		svc.Params = nil
+	}
+	return svc
+}
+
+// requires maps depends_on to requires.
+func (c *converter) requires(svc *config.Service, sc types.ServiceConfig) {
+	for _, dep := range sortedKeys(sc.DependsOn) {
+		svc.Requires = append(svc.Requires, c.names[dep])
+		if sc.DependsOn[dep].Condition == types.ServiceConditionCompletedSuccessfully {
+			c.note(svc.Name, "depends_on."+dep, "waits for completion; consider turning %s into a job of %s", dep, svc.Name)
+		}
+	}
+}
+
+// environment splits environment values into the params of packEnvParams,
+// env and secretRefs.
+func (c *converter) environment(svc *config.Service, sc types.ServiceConfig) {
+	for _, key := range sortedKeys(sc.Environment) {
+		value := sc.Environment[key]
+		field := "environment." + key
+		param, isParam := packEnvParams[svc.Pack][key]
+		switch {
+		case value == nil:
+			c.note(svc.Name, field, "not translated; its value comes from the host environment")
+		case isParam && strings.HasSuffix(param, "Ref"):
+			ref := secretRefName(svc.Name, key)
+			svc.Params[param] = ref
+			c.result.Secrets = append(c.result.Secrets, MovedSecret{Service: svc.Name, Env: key, Ref: ref})
+		case isParam:
+			svc.Params[param] = *value
+			if hostVariable.MatchString(*value) {
+				c.note(svc.Name, field, "references a host variable, which yar does not interpolate")
+			}
+		case secretKey.MatchString(key):
+			ref := secretRefName(svc.Name, key)
+			if svc.SecretRefs == nil {
+				svc.SecretRefs = map[string]string{}
+			}
+			svc.SecretRefs[key] = ref
+			c.result.Secrets = append(c.result.Secrets, MovedSecret{Service: svc.Name, Env: key, Ref: ref})
+		default:
+			if svc.Env == nil {
+				svc.Env = map[string]string{}
+			}
+			svc.Env[key] = *value
+			if hostVariable.MatchString(*value) {
+				c.note(svc.Name, field, "references a host variable, which yar does not interpolate")
+			}
+		}
+	}
+}
+
+// ports maps published ports to params.ports.
+func (c *converter) ports(svc *config.Service, sc types.ServiceConfig) {
+	var ports []any
+	for i, p := range sc.Ports {
+		port := map[string]any{"containerPort": int(p.Target)}
+		if p.Published != "" {
+			if host, err := strconv.Atoi(p.Published); err == nil {
+				port["hostPort"] = host
+			} else {
+				c.note(svc.Name, fmt.Sprintf("ports[%d]", i), "published range %q not translated; only the container port is kept", p.Published)
+			}
+		}
+		if p.Protocol != "" && p.Protocol != "tcp" {
+			port["protocol"] = p.Protocol
+		}
+		if p.HostIP != "" {
+			c.note(svc.Name, fmt.Sprintf("ports[%d]", i), "host IP %s not translated", p.HostIP)
+		}
+		ports = append(ports, port)
+	}
+	if len(ports) > 0 {
+		svc.Params["ports"] = ports
+	}
+}
+
+// volumes maps the named volumes of generic services to params.volumes.
+// Built-in packs manage their own volumes.
+func (c *converter) volumes(svc *config.Service, sc types.ServiceConfig) {
+	var volumes []any
+	for i, v := range sc.Volumes {
+		field := fmt.Sprintf("volumes[%d]", i)
+		switch {
+		case svc.Pack != GenericPack:
+			c.note(svc.Name, field, "not translated; the %s pack manages its own volumes", svc.Pack)
+		case v.Type == types.VolumeTypeVolume:
+			name := v.Source
+			if name == "" {
+				name = fmt.Sprintf("%s-%d", svc.Name, i)
+			}
+			volumes = append(volumes, map[string]any{"name": name, "mountPath": v.Target})
+		case v.Type == types.VolumeTypeBind:
+			c.note(svc.Name, field, "bind mount of %s not translated; the %s pack mounts only named volumes", v.Source, GenericPack)
+		default:
+			c.note(svc.Name, field, "%s mount not translated", v.Type)
+		}
+	}
+	if len(volumes) > 0 {
+		svc.Params["volumes"] = volumes
+	}
+}
+
+// healthcheck reports a compose healthcheck, which packs cannot express:
+// their probes check TCP or HTTP rather than run a command.
+func (c *converter) healthcheck(svc *config.Service, sc types.ServiceConfig) {
+	hc := sc.HealthCheck
+	if hc == nil {
+		return
+	}
+	switch {
+	case hc.Disable || len(hc.Test) == 0 || hc.Test[0] == "NONE":
+		c.note(svc.Name, "healthcheck", "disabled; not translated")
+	case svc.Pack != GenericPack:
+		c.note(svc.Name, "healthcheck", "not translated; the %s pack sets its own readiness probe", svc.Pack)
+	default:
+		c.note(svc.Name, "healthcheck", "not translated; the %s pack has no command healthchecks", GenericPack)
+	}
+}
+
+// requiredSecrets sets a reference for the secret params of
+// packRequiredSecrets the compose file left unset, and reports that the
+// secret must be stored.
+func (c *converter) requiredSecrets(svc *config.Service) {
+	env, ok := packRequiredSecrets[svc.Pack]
+	if !ok {
+		return
+	}
+	param := packEnvParams[svc.Pack][env]
+	if _, set := svc.Params[param]; set {
+		return
+	}
+	ref := secretRefName(svc.Name, env)
+	svc.Params[param] = ref
+	c.note(svc.Name, "environment."+env, "not set; the %s pack requires it, so store it with 'yar secret set %s'", svc.Pack, ref)
+}
+
+// replicas maps deploy.replicas or scale to replicas and reports other
+// deploy settings.
+func (c *converter) replicas(svc *config.Service, sc types.ServiceConfig) {
+	switch {
+	case sc.Deploy != nil && sc.Deploy.Replicas != nil:
+		svc.Replicas = *sc.Deploy.Replicas
+	case sc.Scale != nil:
+		svc.Replicas = *sc.Scale
+	}
+	if sc.Deploy == nil {
+		return
+	}
+	deploy := *sc.Deploy
+	deploy.Replicas = nil
+	for _, key := range setKeys(deploy) {
+		c.note(svc.Name, "deploy."+key, "not translated")
+	}
+}
+
+// unhandledKeys returns the compose keys set on a service that are not
+// translated. Attaching only to the default network is not reported.
+func unhandledKeys(sc types.ServiceConfig) []string {
+	var keys []string
+	for _, key := range setKeys(sc) {
+		if key == "networks" && onlyDefaultNetwork(sc.Networks) {
+			continue
+		}
+		if !handledKeys[key] || key == "networks" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// onlyDefaultNetwork reports whether a service attaches to no network but
+// the implicit default one.
+func onlyDefaultNetwork(networks map[string]*types.ServiceNetworkConfig) bool {
+	for name := range networks {
+		if name != "default" {
+			return false
+		}
+	}
+	return true
+}
+
+// setKeys returns the sorted keys a compose value sets, from its JSON
+// encoding, which omits unset fields.
+func setKeys(v any) []string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	var keys []string
+	for key, value := range m {
+		if obj, ok := value.(map[string]any); value == nil || (ok && len(obj) == 0) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitImage splits an image reference into repository and tag. Digests
+// are dropped.
+func splitImage(image string) (string, string) {
+	image, _, _ = strings.Cut(image, "@")
+	slash := strings.LastIndex(image, "/")
+	if colon := strings.LastIndex(image, ":"); colon > slash {
+		return image[:colon], image[colon+1:]
+	}
+	return image, ""
+}
+
+// stringsParam returns ss as the []any a param decoded from yar.yaml holds,
+// so the params validate as if loaded from the written file.
+func stringsParam(ss []string) []any {
+	out := make([]any, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
+
+// invalidNameChars matches runs of characters not allowed in yar names.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// serviceName converts a compose service name to a valid yar name.
+func serviceName(name string) string {
+	name = strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		name = "svc-" + name
+	}
+	return strings.TrimSuffix(name, "-")
+}
+
+// projectName converts a compose project or directory name to a valid
+// yar project name.
+func projectName(name string) string {
+	return serviceName(name)
+}
+
+// secretRefName returns the secret reference for an environment variable
+// of a service, such as db_postgres_password.
+func secretRefName(service, env string) string {
+	return strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(service+"_"+env), "_"), "_")
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,210 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/packs"
+)
+
+func TestImportCompose(t *testing.T) {
+	result, err := ImportCompose(context.Background(), "testdata/shop/docker-compose.yaml", ComposeOptions{})
+	if err != nil {
+		t.Fatalf("ImportCompose() error = %v", err)
+	}
+
+	got, err := result.YAML("docker-compose.yaml")
+	if err != nil {
+		t.Fatalf("YAML() error = %v", err)
+	}
+	want, err := os.ReadFile("testdata/shop/yar.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Errorf("yar.yaml mismatch (-want +got):\n%s", diff)
+	}
+	for _, plaintext := range []string{"hunter2", "abc123"} {
+		if bytes.Contains(got, []byte(plaintext)) {
+			t.Errorf("yar.yaml contains the plaintext secret %q", plaintext)
+		}
+	}
+
+	wantSecrets := []MovedSecret{
+		{Service: "db", Env: "POSTGRES_PASSWORD", Ref: "db_postgres_password"},
+		{Service: "web-app", Env: "API_TOKEN", Ref: "web_app_api_token"},
+	}
+	if diff := cmp.Diff(wantSecrets, result.Secrets); diff != "" {
+		t.Errorf("Secrets mismatch (-want +got):\n%s", diff)
+	}
+
+	var notes []string
+	for _, n := range result.Notes {
+		notes = append(notes, n.String())
+	}
+	wantNotes := []string{
+		"cache.command: not translated; the redis pack sets its own command",
+		"db.volumes[0]: not translated; the postgres pack manages its own volumes",
+		"db.healthcheck: not translated; the postgres pack sets its own readiness probe",
+		"migrate.networks: not translated",
+		`web-app: renamed from "web_app" to match ^[a-z][a-z0-9-]*$`,
+		"web-app.depends_on.migrate: waits for completion; consider turning migrate into a job of web-app",
+		"web-app.environment.HOME_DIR: not translated; its value comes from the host environment",
+		"web-app.environment.LOG_LEVEL: references a host variable, which yar does not interpolate",
+		"web-app.volumes[0]: bind mount of ./config not translated; the container pack mounts only named volumes",
+		"web-app.deploy.resources: not translated",
+		"web-app.build: not translated; yar runs prebuilt images, so build and push params.image separately",
+		"web-app.restart: not translated",
+		"networks.backend: not translated; all services share the fleet network",
+	}
+	if diff := cmp.Diff(wantNotes, notes); diff != "" {
+		t.Errorf("Notes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestImportCompose_ApplyParams checks that imported params are valid for
+// the built-in packs, so the imported project renders as is.
+func TestImportCompose_ApplyParams(t *testing.T) {
+	result, err := ImportCompose(context.Background(), "testdata/shop/docker-compose.yaml", ComposeOptions{})
+	if err != nil {
+		t.Fatalf("ImportCompose() error = %v", err)
+	}
+	registry, err := packs.NewPackRegistry(packs.WithProjectDir(t.TempDir()), packs.WithUserDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	services, err := packs.ApplyParams(registry, result.Project.Services)
+	if err != nil {
+		t.Fatalf("ApplyParams() error = %v", err)
+	}
+	images := map[string]any{}
+	for _, svc := range services {
+		images[svc.Name] = svc.Params["image"]
+	}
+	want := map[string]any{
+		"cache":   "redis:7",
+		"db":      "postgres:16-alpine",
+		"migrate": "acme/shop-web:1.4",
+		"web-app": "acme/shop-web:1.4",
+	}
+	if diff := cmp.Diff(want, images); diff != "" {
+		t.Errorf("images mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestImportCompose_RequiredSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compose.yaml")
+	if err := os.WriteFile(path, []byte("services:\n  db:\n    image: postgres\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ImportCompose(context.Background(), path, ComposeOptions{Project: "shop"})
+	if err != nil {
+		t.Fatalf("ImportCompose() error = %v", err)
+	}
+	want := []*config.Service{{Name: "db", Pack: "postgres", Params: map[string]any{"passwordRef": "db_postgres_password"}}}
+	if diff := cmp.Diff(want, result.Project.Services); diff != "" {
+		t.Errorf("Services mismatch (-want +got):\n%s", diff)
+	}
+	wantNotes := []Note{{
+		Service: "db",
+		Field:   "environment.POSTGRES_PASSWORD",
+		Message: "not set; the postgres pack requires it, so store it with 'yar secret set db_postgres_password'",
+	}}
+	if diff := cmp.Diff(wantNotes, result.Notes); diff != "" {
+		t.Errorf("Notes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestImportCompose_ProjectName(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "My_Repo")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "compose.yaml")
+	if err := os.WriteFile(path, []byte("services:\n  web:\n    image: nginx:1.27\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		opts ComposeOptions
+		want string
+	}{
+		"from directory": {want: "my-repo"},
+		"explicit":       {opts: ComposeOptions{Project: "storefront"}, want: "storefront"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := ImportCompose(context.Background(), path, tc.opts)
+			if err != nil {
+				t.Fatalf("ImportCompose() error = %v", err)
+			}
+			if result.Project.Project != tc.want {
+				t.Errorf("Project = %q, want %q", result.Project.Project, tc.want)
+			}
+			want := []*config.Service{{Name: "web", Pack: GenericPack, Params: map[string]any{"image": "nginx:1.27"}}}
+			if diff := cmp.Diff(want, result.Project.Services); diff != "" {
+				t.Errorf("Services mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestImportCompose_LoadError(t *testing.T) {
+	_, err := ImportCompose(context.Background(), filepath.Join(t.TempDir(), "missing.yaml"), ComposeOptions{})
+	var ierr *ImportError
+	if !stderrors.As(err, &ierr) || ierr.Op != "compose.load" {
+		t.Fatalf("ImportCompose() error = %v, want compose.load ImportError", err)
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := map[string]struct {
+		image    string
+		repo     string
+		tag      string
+		wantPack string
+	}{
+		"official":        {image: "redis:7", repo: "redis", tag: "7", wantPack: "redis"},
+		"namespaced":      {image: "bitnami/postgresql:16", repo: "bitnami/postgresql", tag: "16", wantPack: "postgres"},
+		"registry port":   {image: "localhost:5000/kafka", repo: "localhost:5000/kafka", wantPack: "kafka"},
+		"digest":          {image: "confluentinc/cp-kafka:7.6@sha256:abc", repo: "confluentinc/cp-kafka", tag: "7.6", wantPack: "kafka"},
+		"no built-in":     {image: "nginx", repo: "nginx"},
+		"suffix mismatch": {image: "acme/redis-exporter:1", repo: "acme/redis-exporter", tag: "1"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo, tag := splitImage(tc.image)
+			if repo != tc.repo || tag != tc.tag {
+				t.Errorf("splitImage(%q) = %q, %q, want %q, %q", tc.image, repo, tag, tc.repo, tc.tag)
+			}
+			if got := builtinPacks[filepath.Base(repo)]; got != tc.wantPack {
+				t.Errorf("built-in pack for %q = %q, want %q", tc.image, got, tc.wantPack)
+			}
+		})
+	}
+}
+
+func TestServiceName(t *testing.T) {
+	tests := map[string]string{
+		"web":          "web",
+		"web_app":      "web-app",
+		"Web.App":      "web-app",
+		"2fa":          "svc-2fa",
+		"-worker-":     "worker",
+		"api__gateway": "api-gateway",
+	}
+	for in, want := range tests {
+		if got := serviceName(in); got != want {
+			t.Errorf("serviceName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
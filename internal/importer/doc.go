@@ -0,0 +1,3 @@
+// Package importer converts existing project definitions, such as
+// docker-compose files, into yar.yaml.
+package importer
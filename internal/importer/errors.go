@@ -0,0 +1,46 @@
+package importer
+
+import "fmt"
+
+// ImportError represents a failure to import a project definition.
+type ImportError struct {
+	Op      string // Operation: "compose.load", "compose.convert"
+	Name    string // Source file path
+	Message string // Human-readable message
+	Err     error  // Underlying error
+}
+
+// Error implements the error interface.
+func (e *ImportError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("import %s %s: %s: %v", e.Op, e.Name, e.Message, e.Err)
+	}
+	return fmt.Sprintf("import %s %s: %s", e.Op, e.Name, e.Message)
+}
+
+// Unwrap returns the underlying error.
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// NewImportError creates a new ImportError.
+func NewImportError(op, name, message string, err error) *ImportError {
+	return &ImportError{
+		Op:      op,
+		Name:    name,
+		Message: message,
+		Err:     err,
+	}
+}
+
+// ErrComposeLoad creates an error for a compose file that could not be
+// read or parsed.
+func ErrComposeLoad(path string, err error) *ImportError {
+	return NewImportError("compose.load", path, "failed to load compose file", err)
+}
+
+// ErrComposeConvert creates an error for a compose project that converts
+// to an invalid yar project.
+func ErrComposeConvert(path string, err error) *ImportError {
+	return NewImportError("compose.convert", path, "imported project is not valid", err)
+}
@@ -0,0 +1,35 @@
+package importer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestImportError_Error(t *testing.T) {
+	underlying := errors.New("yaml: line 3: did not find expected key")
+	tests := map[string]struct {
+		err  *ImportError
+		want string
+	}{
+		"load": {
+			err:  ErrComposeLoad("docker-compose.yaml", underlying),
+			want: "import compose.load docker-compose.yaml: failed to load compose file: yaml: line 3: did not find expected key",
+		},
+		"no cause": {
+			err:  NewImportError("compose.convert", "docker-compose.yaml", "no services", nil),
+			want: "import compose.convert docker-compose.yaml: no services",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.err.Error(); got != tc.want {
+				t.Errorf("Error() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	if !errors.Is(ErrComposeConvert("x", underlying), underlying) {
+		t.Error("errors.Is(ErrComposeConvert(underlying), underlying) = false, want true")
+	}
+}
@@ -0,0 +1,312 @@
+package kubernetes
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// FieldManager is the server-side apply field manager yar applies as.
+const FieldManager = "yar"
+
+// Client provides Kubernetes operations on arbitrary resource kinds.
+// Namespace arguments may be empty to use the client's default namespace;
+// they are ignored for cluster-scoped kinds.
+type Client interface {
+	// Namespace returns the default namespace.
+	Namespace() string
+
+	// Apply creates or updates obj with server-side apply, taking ownership
+	// of conflicting fields. Objects without a namespace get the default one.
+	Apply(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+
+	// Create creates obj. It fails with an error IsAlreadyExists detects if
+	// the object exists.
+	Create(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+
+	// Update replaces obj. It fails with an error IsConflict detects if
+	// obj's resourceVersion is no longer current.
+	Update(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+
+	// Get returns a single resource.
+	Get(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error)
+
+	// List returns resources matching a label selector.
+	List(ctx context.Context, gvk schema.GroupVersionKind, namespace, selector string) ([]unstructured.Unstructured, error)
+
+	// Patch applies a patch of the given type to a resource.
+	Patch(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, pt types.PatchType, data []byte) error
+
+	// Delete removes a resource. Deleting a missing resource is not an error.
+	Delete(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) error
+}
+
+// clientOptions holds configuration for the Kubernetes client.
+type clientOptions struct {
+	kubeconfig string
+	context    string
+	namespace  string
+}
+
+// Option configures the Kubernetes client.
+type Option func(*clientOptions)
+
+// WithKubeconfig sets an explicit kubeconfig path instead of the default
+// loading rules ($KUBECONFIG, then ~/.kube/config).
+func WithKubeconfig(path string) Option {
+	return func(o *clientOptions) {
+		o.kubeconfig = path
+	}
+}
+
+// WithContext selects a kubeconfig context instead of the current one.
+func WithContext(name string) Option {
+	return func(o *clientOptions) {
+		o.context = name
+	}
+}
+
+// WithNamespace sets the default namespace instead of the context's.
+func WithNamespace(namespace string) Option {
+	return func(o *clientOptions) {
+		o.namespace = namespace
+	}
+}
+
+// kubeClient implements Client with the client-go dynamic client.
+type kubeClient struct {
+	dyn       dynamic.Interface
+	mapper    meta.RESTMapper
+	namespace string
+}
+
+// NewClient creates a Kubernetes client from kubeconfig with the given
+// options. No request is made until the first operation.
+func NewClient(opts ...Option) (Client, error) {
+	options := &clientOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	restConfig, namespace, err := loadConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, ErrClusterConnection(options.context, err)
+	}
+	disc, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, ErrClusterConnection(options.context, err)
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(disc))
+
+	return NewClientFromDynamic(dyn, mapper, namespace), nil
+}
+
+// loadConfig resolves the REST config and default namespace from kubeconfig.
+func loadConfig(options *clientOptions) (*rest.Config, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if options.kubeconfig != "" {
+		rules.ExplicitPath = options.kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: options.context}
+	if options.namespace != "" {
+		overrides.Context.Namespace = options.namespace
+	}
+	cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	restConfig, err := cc.ClientConfig()
+	if err != nil {
+		return nil, "", ErrClusterConnection(options.context, err)
+	}
+	namespace, _, err := cc.Namespace()
+	if err != nil {
+		return nil, "", ErrClusterConnection(options.context, err)
+	}
+	return restConfig, namespace, nil
+}
+
+// NewClientFromDynamic creates a Client from an existing dynamic client and
+// REST mapper. Tests use it with client-go's fake dynamic client.
+func NewClientFromDynamic(dyn dynamic.Interface, mapper meta.RESTMapper, namespace string) Client {
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	return &kubeClient{dyn: dyn, mapper: mapper, namespace: namespace}
+}
+
+// Namespace implements Client.Namespace.
+func (c *kubeClient) Namespace() string {
+	return c.namespace
+}
+
+// Apply implements Client.Apply.
+func (c *kubeClient) Apply(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk := obj.GroupVersionKind()
+	ri, namespaced, err := c.resource(gvk, obj.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+
+	obj = obj.DeepCopy()
+	if namespaced && obj.GetNamespace() == "" {
+		obj.SetNamespace(c.namespace)
+	}
+
+	applied, err := ri.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+		FieldManager: FieldManager,
+		Force:        true,
+	})
+	if err != nil {
+		return nil, ErrApply(gvk.Kind, obj.GetName(), obj.GetNamespace(), err)
+	}
+	return applied, nil
+}
+
+// Create implements Client.Create.
+func (c *kubeClient) Create(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk := obj.GroupVersionKind()
+	ri, namespaced, err := c.resource(gvk, obj.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	obj = obj.DeepCopy()
+	if namespaced && obj.GetNamespace() == "" {
+		obj.SetNamespace(c.namespace)
+	}
+
+	created, err := ri.Create(ctx, obj, metav1.CreateOptions{FieldManager: FieldManager})
+	if err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return nil, ErrAlreadyExists(gvk.Kind, obj.GetName(), obj.GetNamespace())
+		}
+		return nil, ErrCreate(gvk.Kind, obj.GetName(), obj.GetNamespace(), err)
+	}
+	return created, nil
+}
+
+// Update implements Client.Update.
+func (c *kubeClient) Update(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk := obj.GroupVersionKind()
+	ri, namespaced, err := c.resource(gvk, obj.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	obj = obj.DeepCopy()
+	if namespaced && obj.GetNamespace() == "" {
+		obj.SetNamespace(c.namespace)
+	}
+
+	updated, err := ri.Update(ctx, obj, metav1.UpdateOptions{FieldManager: FieldManager})
+	if err != nil {
+		switch {
+		case apierrors.IsConflict(err):
+			return nil, ErrConflict(gvk.Kind, obj.GetName(), obj.GetNamespace())
+		case apierrors.IsNotFound(err):
+			return nil, ErrNotFound(gvk.Kind, obj.GetName(), obj.GetNamespace())
+		}
+		return nil, ErrUpdate(gvk.Kind, obj.GetName(), obj.GetNamespace(), err)
+	}
+	return updated, nil
+}
+
+// Get implements Client.Get.
+func (c *kubeClient) Get(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, error) {
+	ri, _, err := c.resource(gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := ri.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, ErrNotFound(gvk.Kind, name, c.ns(namespace))
+		}
+		return nil, ErrGet(gvk.Kind, name, c.ns(namespace), err)
+	}
+	return obj, nil
+}
+
+// List implements Client.List.
+func (c *kubeClient) List(ctx context.Context, gvk schema.GroupVersionKind, namespace, selector string) ([]unstructured.Unstructured, error) {
+	ri, _, err := c.resource(gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
+	list, err := ri.List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, ErrList(gvk.Kind, c.ns(namespace), err)
+	}
+	return list.Items, nil
+}
+
+// Patch implements Client.Patch.
+func (c *kubeClient) Patch(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, pt types.PatchType, data []byte) error {
+	ri, _, err := c.resource(gvk, namespace)
+	if err != nil {
+		return err
+	}
+	if _, err := ri.Patch(ctx, name, pt, data, metav1.PatchOptions{FieldManager: FieldManager}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ErrNotFound(gvk.Kind, name, c.ns(namespace))
+		}
+		return ErrPatch(gvk.Kind, name, c.ns(namespace), err)
+	}
+	return nil
+}
+
+// Delete implements Client.Delete.
+func (c *kubeClient) Delete(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) error {
+	ri, _, err := c.resource(gvk, namespace)
+	if err != nil {
+		return err
+	}
+	// Background propagation lets owned objects (ReplicaSets, Pods) be
+	// garbage collected instead of orphaned.
+	propagation := metav1.DeletePropagationBackground
+	err = ri.Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ErrDelete(gvk.Kind, name, c.ns(namespace), err)
+	}
+	return nil
+}
+
+// resource returns the dynamic resource interface for gvk, scoped to
+// namespace when the kind is namespaced.
+func (c *kubeClient) resource(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, bool, error) {
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, false, ErrUnknownKind(gvk.String(), err)
+		}
+		return nil, false, ErrDiscovery(gvk.String(), err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.dyn.Resource(mapping.Resource), false, nil
+	}
+	return c.dyn.Resource(mapping.Resource).Namespace(c.ns(namespace)), true, nil
+}
+
+// ns returns namespace, or the default namespace if it is empty.
+func (c *kubeClient) ns(namespace string) string {
+	if namespace == "" {
+		return c.namespace
+	}
+	return namespace
+}
+
+// Ensure kubeClient implements Client.
+var _ Client = (*kubeClient)(nil)
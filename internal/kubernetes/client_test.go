@@ -0,0 +1,212 @@
+package kubernetes_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/kubernetes/kubetest"
+)
+
+func newObject(gvk schema.GroupVersionKind, namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{}}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(labels)
+	return obj
+}
+
+func TestClient_ApplyCreatesAndUpdates(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	client, dyn := kubetest.NewFakeClient("dev")
+
+	obj := newObject(kubernetes.ConfigMapKind, "", "app-config", map[string]string{"yar.project": "p"})
+	if err := unstructured.SetNestedField(obj.Object, "1", "data", "version"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Apply(ctx, obj); err != nil {
+		t.Fatalf("Apply() create error = %v", err)
+	}
+
+	if err := unstructured.SetNestedField(obj.Object, "2", "data", "version"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Apply(ctx, obj); err != nil {
+		t.Fatalf("Apply() update error = %v", err)
+	}
+
+	got, err := client.Get(ctx, kubernetes.ConfigMapKind, "", "app-config")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.GetNamespace() != "dev" {
+		t.Errorf("namespace = %q, want default namespace dev", got.GetNamespace())
+	}
+	if v, _, _ := unstructured.NestedString(got.Object, "data", "version"); v != "2" {
+		t.Errorf("data.version = %q, want 2", v)
+	}
+
+	// Every apply is a server-side apply patch. The fake does not record
+	// patch options, so the field manager cannot be checked here.
+	var applies int
+	for _, action := range dyn.Actions() {
+		patch, ok := action.(k8stesting.PatchActionImpl)
+		if !ok {
+			continue
+		}
+		if patch.GetPatchType() != types.ApplyPatchType {
+			t.Errorf("patch type = %s, want apply", patch.GetPatchType())
+		}
+		applies++
+	}
+	if applies != 2 {
+		t.Errorf("apply patches = %d, want 2", applies)
+	}
+}
+
+func TestClient_ApplyClusterScoped(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	client, _ := kubetest.NewFakeClient("dev")
+
+	applied, err := client.Apply(ctx, newObject(kubernetes.NamespaceKind, "", "team-a", nil))
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if applied.GetNamespace() != "" {
+		t.Errorf("namespace = %q, want none for a cluster-scoped kind", applied.GetNamespace())
+	}
+}
+
+func TestClient_CreateAndUpdate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	client, dyn := kubetest.NewFakeClient("dev")
+
+	created, err := client.Create(ctx, newObject(kubernetes.LeaseKind, "", "lock", nil))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if created.GetNamespace() != "dev" {
+		t.Errorf("namespace = %q, want default namespace dev", created.GetNamespace())
+	}
+	if _, err := client.Create(ctx, newObject(kubernetes.LeaseKind, "", "lock", nil)); !kubernetes.IsAlreadyExists(err) {
+		t.Errorf("Create() existing error = %v, want already exists", err)
+	}
+
+	created.SetLabels(map[string]string{"holder": "a"})
+	if _, err := client.Update(ctx, created); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	got, err := client.Get(ctx, kubernetes.LeaseKind, "", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetLabels()["holder"] != "a" {
+		t.Errorf("labels = %v, want holder=a", got.GetLabels())
+	}
+
+	// The fake does not check resourceVersions; a real API server answers
+	// a stale update with 409 Conflict.
+	dyn.PrependReactor("update", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, "lock", errors.New("stale"))
+	})
+	if _, err := client.Update(ctx, created); !kubernetes.IsConflict(err) {
+		t.Errorf("Update() stale error = %v, want conflict", err)
+	}
+}
+
+func TestClient_ListBySelector(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	client, _ := kubetest.NewFakeClient("dev",
+		newObject(kubernetes.ServiceKind, "dev", "api", map[string]string{"yar.project": "p"}),
+		newObject(kubernetes.ServiceKind, "dev", "other", map[string]string{"yar.project": "q"}),
+		newObject(kubernetes.ServiceKind, "prod", "api", map[string]string{"yar.project": "p"}),
+	)
+
+	items, err := client.List(ctx, kubernetes.ServiceKind, "", "yar.project=p")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(items) != 1 || items[0].GetName() != "api" || items[0].GetNamespace() != "dev" {
+		t.Errorf("List() = %v, want dev/api only", items)
+	}
+}
+
+func TestClient_GetNotFound(t *testing.T) {
+	t.Parallel()
+	client, _ := kubetest.NewFakeClient("dev")
+
+	_, err := client.Get(context.Background(), kubernetes.DeploymentKind, "", "missing")
+	if !kubernetes.IsNotFound(err) {
+		t.Errorf("Get() error = %v, want not found", err)
+	}
+}
+
+func TestClient_Patch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	client, _ := kubetest.NewFakeClient("dev", newObject(kubernetes.DeploymentKind, "dev", "api", nil))
+
+	if err := client.Patch(ctx, kubernetes.DeploymentKind, "", "api", types.MergePatchType, []byte(`{"spec":{"replicas":0}}`)); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	got, err := client.Get(ctx, kubernetes.DeploymentKind, "", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replicas, _, _ := unstructured.NestedInt64(got.Object, "spec", "replicas"); replicas != 0 {
+		t.Errorf("spec.replicas = %d, want 0", replicas)
+	}
+
+	err = client.Patch(ctx, kubernetes.DeploymentKind, "", "missing", types.MergePatchType, []byte(`{}`))
+	if !kubernetes.IsNotFound(err) {
+		t.Errorf("Patch() missing error = %v, want not found", err)
+	}
+}
+
+func TestClient_DeleteIsIdempotent(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	client, _ := kubetest.NewFakeClient("dev", newObject(kubernetes.SecretKind, "dev", "creds", nil))
+
+	for i := 0; i < 2; i++ {
+		if err := client.Delete(ctx, kubernetes.SecretKind, "", "creds"); err != nil {
+			t.Fatalf("Delete() #%d error = %v", i+1, err)
+		}
+	}
+	if _, err := client.Get(ctx, kubernetes.SecretKind, "", "creds"); !kubernetes.IsNotFound(err) {
+		t.Errorf("Get() after delete error = %v, want not found", err)
+	}
+}
+
+func TestClient_UnknownKind(t *testing.T) {
+	t.Parallel()
+	client, _ := kubetest.NewFakeClient("dev")
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+	_, err := client.List(context.Background(), gvk, "", "")
+	var kerr *kubernetes.KubernetesError
+	if !errors.As(err, &kerr) || kerr.Op != "mapping" {
+		t.Errorf("List() error = %v, want mapping error", err)
+	}
+}
+
+func TestNewClientFromDynamic_DefaultNamespace(t *testing.T) {
+	t.Parallel()
+	client, _ := kubetest.NewFakeClient("")
+	if got := client.Namespace(); got != "default" {
+		t.Errorf("Namespace() = %q, want default", got)
+	}
+}
@@ -0,0 +1,157 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinels wrapped by ErrNotFound, ErrAlreadyExists and ErrConflict so
+// IsNotFound, IsAlreadyExists and IsConflict can detect them.
+var (
+	errNotFound      = errors.New("not found")
+	errAlreadyExists = errors.New("already exists")
+	errConflict      = errors.New("conflict")
+)
+
+// KubernetesError represents a Kubernetes API operation failure.
+type KubernetesError struct {
+	Op        string // Operation: "apply", "get", "list", "delete", "patch", etc.
+	Kind      string // Resource kind (Deployment, Service, etc.)
+	Name      string // Resource name
+	Namespace string // Namespace, empty for cluster-scoped resources
+	Message   string // Human-readable message
+	Err       error  // Underlying error
+}
+
+// Error implements the error interface.
+func (e *KubernetesError) Error() string {
+	target := e.Kind
+	if e.Name != "" {
+		target += "/" + e.Name
+	}
+	if e.Namespace != "" {
+		target += " in " + e.Namespace
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("kubernetes %s %s: %s: %v", e.Op, target, e.Message, e.Err)
+	}
+	return fmt.Sprintf("kubernetes %s %s: %s", e.Op, target, e.Message)
+}
+
+// Unwrap returns the underlying error.
+func (e *KubernetesError) Unwrap() error {
+	return e.Err
+}
+
+// NewKubernetesError creates a new KubernetesError.
+func NewKubernetesError(op, kind, name, namespace, message string, err error) *KubernetesError {
+	return &KubernetesError{
+		Op:        op,
+		Kind:      kind,
+		Name:      name,
+		Namespace: namespace,
+		Message:   message,
+		Err:       err,
+	}
+}
+
+// ErrApply creates a server-side apply error.
+func ErrApply(kind, name, namespace string, err error) *KubernetesError {
+	return NewKubernetesError("apply", kind, name, namespace, "failed to apply resource", err)
+}
+
+// ErrCreate creates a resource creation error.
+func ErrCreate(kind, name, namespace string, err error) *KubernetesError {
+	return NewKubernetesError("create", kind, name, namespace, "failed to create resource", err)
+}
+
+// ErrUpdate creates a resource update error.
+func ErrUpdate(kind, name, namespace string, err error) *KubernetesError {
+	return NewKubernetesError("update", kind, name, namespace, "failed to update resource", err)
+}
+
+// ErrGet creates a resource read error.
+func ErrGet(kind, name, namespace string, err error) *KubernetesError {
+	return NewKubernetesError("get", kind, name, namespace, "failed to get resource", err)
+}
+
+// ErrList creates a resource list error.
+func ErrList(kind, namespace string, err error) *KubernetesError {
+	return NewKubernetesError("list", kind, "", namespace, "failed to list resources", err)
+}
+
+// ErrDelete creates a resource deletion error.
+func ErrDelete(kind, name, namespace string, err error) *KubernetesError {
+	return NewKubernetesError("delete", kind, name, namespace, "failed to delete resource", err)
+}
+
+// ErrPatch creates a resource patch error.
+func ErrPatch(kind, name, namespace string, err error) *KubernetesError {
+	return NewKubernetesError("patch", kind, name, namespace, "failed to patch resource", err)
+}
+
+// ErrNotFound creates an error for a resource that does not exist.
+func ErrNotFound(kind, name, namespace string) *KubernetesError {
+	return NewKubernetesError("get", kind, name, namespace, "resource not found", errNotFound)
+}
+
+// ErrAlreadyExists creates an error for creating a resource that exists.
+func ErrAlreadyExists(kind, name, namespace string) *KubernetesError {
+	return NewKubernetesError("create", kind, name, namespace, "resource already exists", errAlreadyExists)
+}
+
+// ErrConflict creates an error for an update based on a stale
+// resourceVersion.
+func ErrConflict(kind, name, namespace string) *KubernetesError {
+	return NewKubernetesError("update", kind, name, namespace, "resource was modified concurrently", errConflict)
+}
+
+// ErrUnknownKind creates an error for a kind the cluster does not serve.
+func ErrUnknownKind(kind string, err error) *KubernetesError {
+	return NewKubernetesError("mapping", kind, "", "", "resource kind not served by the cluster", err)
+}
+
+// ErrDiscovery creates an error for a failed API discovery request.
+func ErrDiscovery(kind string, err error) *KubernetesError {
+	return NewKubernetesError("mapping", kind, "", "", "failed to discover cluster API resources", err)
+}
+
+// ErrManifest creates a manifest decoding error.
+func ErrManifest(err error) *KubernetesError {
+	return NewKubernetesError("decode", "manifest", "", "", "invalid manifest", err)
+}
+
+// ErrClusterConnection creates a cluster configuration or connection error.
+func ErrClusterConnection(context string, err error) *KubernetesError {
+	return NewKubernetesError("connect", "context", context, "", "failed to configure cluster client", err)
+}
+
+// ErrPortForward creates a port-forward error.
+func ErrPortForward(pod, namespace string, err error) *KubernetesError {
+	return NewKubernetesError("portforward", "Pod", pod, namespace, "port-forward failed", err)
+}
+
+// ErrExec creates an error for a command that could not be run in a pod.
+func ErrExec(pod, namespace string, err error) *KubernetesError {
+	return NewKubernetesError("exec", "Pod", pod, namespace, "failed to run command in pod", err)
+}
+
+// ErrPodLogs creates a pod log read error.
+func ErrPodLogs(pod, namespace string, err error) *KubernetesError {
+	return NewKubernetesError("logs", "Pod", pod, namespace, "failed to read logs", err)
+}
+
+// IsNotFound reports whether err is, or wraps, an ErrNotFound error.
+func IsNotFound(err error) bool {
+	return errors.Is(err, errNotFound)
+}
+
+// IsAlreadyExists reports whether err is, or wraps, an ErrAlreadyExists error.
+func IsAlreadyExists(err error) bool {
+	return errors.Is(err, errAlreadyExists)
+}
+
+// IsConflict reports whether err is, or wraps, an ErrConflict error.
+func IsConflict(err error) bool {
+	return errors.Is(err, errConflict)
+}
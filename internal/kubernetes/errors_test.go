@@ -0,0 +1,84 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKubernetesError_Error(t *testing.T) {
+	t.Parallel()
+
+	underlying := errors.New("forbidden")
+	tests := map[string]struct {
+		err  *KubernetesError
+		want string
+	}{
+		"namespaced with cause": {
+			err:  ErrApply("Deployment", "api", "dev", underlying),
+			want: "kubernetes apply Deployment/api in dev: failed to apply resource: forbidden",
+		},
+		"list without name": {
+			err:  ErrList("Pod", "dev", underlying),
+			want: "kubernetes list Pod in dev: failed to list resources: forbidden",
+		},
+		"port-forward": {
+			err:  ErrPortForward("redis-0", "dev", errConnectionLost),
+			want: "kubernetes portforward Pod/redis-0 in dev: port-forward failed: lost connection to pod",
+		},
+		"pod logs": {
+			err:  ErrPodLogs("api-0", "dev", errors.New("404 Not Found")),
+			want: "kubernetes logs Pod/api-0 in dev: failed to read logs: 404 Not Found",
+		},
+		"already exists": {
+			err:  ErrAlreadyExists("Lease", "yar-lock", "dev"),
+			want: "kubernetes create Lease/yar-lock in dev: resource already exists: already exists",
+		},
+		"no cause": {
+			err:  NewKubernetesError("rollout", "Deployment", "api", "", "timed out", nil),
+			want: "kubernetes rollout Deployment/api: timed out",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := tc.err.Error(); got != tc.want {
+				t.Errorf("Error() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKubernetesError_Unwrap(t *testing.T) {
+	t.Parallel()
+
+	underlying := errors.New("boom")
+	if err := ErrDelete("Service", "api", "dev", underlying); !errors.Is(err, underlying) {
+		t.Error("errors.Is(ErrDelete(underlying), underlying) = false, want true")
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	t.Parallel()
+
+	if !IsNotFound(ErrNotFound("Pod", "x", "dev")) {
+		t.Error("IsNotFound(ErrNotFound) = false, want true")
+	}
+	if IsNotFound(ErrGet("Pod", "x", "dev", errors.New("boom"))) {
+		t.Error("IsNotFound(ErrGet) = true, want false")
+	}
+	if IsNotFound(nil) {
+		t.Error("IsNotFound(nil) = true, want false")
+	}
+}
+
+func TestIsAlreadyExistsAndIsConflict(t *testing.T) {
+	t.Parallel()
+
+	if !IsAlreadyExists(ErrAlreadyExists("Lease", "x", "dev")) || IsAlreadyExists(ErrConflict("Lease", "x", "dev")) {
+		t.Error("IsAlreadyExists does not match only ErrAlreadyExists")
+	}
+	if !IsConflict(ErrConflict("Lease", "x", "dev")) || IsConflict(ErrNotFound("Lease", "x", "dev")) {
+		t.Error("IsConflict does not match only ErrConflict")
+	}
+}
@@ -0,0 +1,81 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// Executor runs commands in pod containers through the API server.
+type Executor interface {
+	// Exec runs cmd in a container of pod, streaming its output to stdout
+	// and stderr, and returns its exit code once it finishes. An empty
+	// container selects the pod's only or default container.
+	Exec(ctx context.Context, namespace, pod, container string, cmd []string, stdout, stderr io.Writer) (int, error)
+}
+
+// spdyExecutor implements Executor with client-go's SPDY executor.
+type spdyExecutor struct {
+	config    *rest.Config
+	namespace string
+}
+
+// NewExecutor creates an Executor from kubeconfig with the same options as
+// NewClient.
+func NewExecutor(opts ...Option) (Executor, error) {
+	options := &clientOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	restConfig, namespace, err := loadConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	return &spdyExecutor{config: restConfig, namespace: namespace}, nil
+}
+
+// Exec implements Executor.Exec.
+func (e *spdyExecutor) Exec(ctx context.Context, namespace, pod, container string, cmd []string, stdout, stderr io.Writer) (int, error) {
+	if namespace == "" {
+		namespace = e.namespace
+	}
+
+	u, _, err := rest.DefaultServerUrlFor(e.config)
+	if err != nil {
+		return 0, ErrExec(pod, namespace, err)
+	}
+	u.Path = path.Join(u.Path, "api/v1/namespaces", namespace, "pods", pod, "exec")
+	query := url.Values{"stdout": {"true"}, "stderr": {"true"}, "command": cmd}
+	if container != "" {
+		query.Set("container", container)
+	}
+	u.RawQuery = query.Encode()
+
+	executor, err := remotecommand.NewSPDYExecutor(e.config, http.MethodPost, u)
+	if err != nil {
+		return 0, ErrExec(pod, namespace, err)
+	}
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: stdout, Stderr: stderr})
+	var exit utilexec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitStatus(), nil
+	}
+	if err != nil {
+		return 0, ErrExec(pod, namespace, err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,32 @@
+package kubernetes
+
+import "k8s.io/apimachinery/pkg/runtime/schema"
+
+// Common resource kinds.
+var (
+	NamespaceKind   = schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}
+	PodKind         = schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	ServiceKind     = schema.GroupVersionKind{Version: "v1", Kind: "Service"}
+	ConfigMapKind   = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	SecretKind      = schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	PVCKind         = schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"}
+	DeploymentKind  = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	StatefulSetKind = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}
+	DaemonSetKind   = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"}
+	JobKind         = schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}
+	CronJobKind     = schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"}
+	IngressKind     = schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"}
+	LeaseKind       = schema.GroupVersionKind{Group: "coordination.k8s.io", Version: "v1", Kind: "Lease"}
+)
+
+// clusterScopedKinds are the kinds above that have no namespace.
+var clusterScopedKinds = map[schema.GroupKind]bool{
+	NamespaceKind.GroupKind(): true,
+}
+
+// isClusterScoped reports whether gvk is one of the common cluster-scoped
+// kinds. It lets callers without a REST mapper default namespaces the way
+// the API server does.
+func isClusterScoped(gvk schema.GroupVersionKind) bool {
+	return clusterScopedKinds[gvk.GroupKind()]
+}
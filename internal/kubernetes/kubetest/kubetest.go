@@ -0,0 +1,98 @@
+// Package kubetest provides a fake Kubernetes client for tests.
+package kubetest
+
+import (
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/yar-run/yar/internal/kubernetes"
+)
+
+// fakeKinds are the kinds served by NewFakeClient.
+var fakeKinds = []schema.GroupVersionKind{
+	kubernetes.NamespaceKind, kubernetes.PodKind, kubernetes.ServiceKind, kubernetes.ConfigMapKind,
+	kubernetes.SecretKind, kubernetes.PVCKind, kubernetes.DeploymentKind, kubernetes.StatefulSetKind,
+	kubernetes.DaemonSetKind, kubernetes.JobKind, kubernetes.CronJobKind, kubernetes.IngressKind,
+	kubernetes.LeaseKind,
+}
+
+// NewFakeClient returns a kubernetes.Client backed by client-go's fake dynamic client,
+// serving the common kinds above, and the fake itself so tests can seed
+// status or inspect actions. The fake's own apply support requires objects
+// to exist; here apply creates missing objects and merges into existing
+// ones, standing in for a real API server's server-side apply.
+func NewFakeClient(namespace string, objects ...runtime.Object) (kubernetes.Client, *dynamicfake.FakeDynamicClient) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	listKinds := make(map[schema.GroupVersionResource]string, len(fakeKinds))
+	for _, gvk := range fakeKinds {
+		scope := meta.RESTScopeNamespace
+		if gvk == kubernetes.NamespaceKind {
+			scope = meta.RESTScopeRoot
+		}
+		mapper.Add(gvk, scope)
+		gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+		listKinds[gvr] = gvk.Kind + "List"
+	}
+
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+	dyn.PrependReactor("patch", "*", fakeApplyReactor(dyn.Tracker()))
+
+	return kubernetes.NewClientFromDynamic(dyn, mapper, namespace), dyn
+}
+
+// fakeApplyReactor handles apply patches by creating the object or merging
+// the patch into the existing one.
+func fakeApplyReactor(tracker k8stesting.ObjectTracker) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch, ok := action.(k8stesting.PatchActionImpl)
+		if !ok || patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+
+		applied := &unstructured.Unstructured{}
+		if err := json.Unmarshal(patch.GetPatch(), &applied.Object); err != nil {
+			return true, nil, err
+		}
+		gvr, ns, name := patch.GetResource(), patch.GetNamespace(), patch.GetName()
+
+		existing, err := tracker.Get(gvr, ns, name, metav1.GetOptions{})
+		if err != nil {
+			if err := tracker.Create(gvr, applied, ns); err != nil {
+				return true, nil, err
+			}
+			return true, applied, nil
+		}
+
+		current, err := runtime.DefaultUnstructuredConverter.ToUnstructured(existing)
+		if err != nil {
+			return true, nil, err
+		}
+		merged := &unstructured.Unstructured{Object: mergeObjects(current, applied.Object)}
+		if err := tracker.Update(gvr, merged, ns); err != nil {
+			return true, nil, err
+		}
+		return true, merged, nil
+	}
+}
+
+// mergeObjects merges patch into base recursively; patch values win.
+func mergeObjects(base, patch map[string]any) map[string]any {
+	for k, v := range patch {
+		pm, ok := v.(map[string]any)
+		bm, bok := base[k].(map[string]any)
+		if ok && bok {
+			base[k] = mergeObjects(bm, pm)
+			continue
+		}
+		base[k] = v
+	}
+	return base
+}
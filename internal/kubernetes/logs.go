@@ -0,0 +1,140 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// maxErrorBody bounds how much of an error response is quoted.
+const maxErrorBody = 512
+
+// PodLogOptions selects the log lines PodLogs returns.
+type PodLogOptions struct {
+	Container    string    // Container name; required for pods with several containers
+	TailLines    int64     // Lines from the end of the log; all when zero
+	Previous     bool      // Read the previous, terminated instance of the container
+	Follow       bool      // Keep streaming new lines (StreamPodLogs only)
+	Timestamps   bool      // Prefix each line with its RFC 3339 timestamp
+	SinceSeconds int64     // Only lines from the last this many seconds
+	SinceTime    time.Time // Only lines from this time on; ignored with SinceSeconds
+}
+
+// LogReader reads pod logs through the API server.
+type LogReader interface {
+	// PodLogs returns the selected log lines of a pod container.
+	PodLogs(ctx context.Context, namespace, pod string, opts PodLogOptions) ([]byte, error)
+
+	// StreamPodLogs streams the selected log lines of a pod container
+	// until the log ends, or with opts.Follow until ctx is cancelled.
+	StreamPodLogs(ctx context.Context, namespace, pod string, opts PodLogOptions) (io.ReadCloser, error)
+}
+
+// restLogReader implements LogReader with a plain GET on the pod's log
+// subresource.
+type restLogReader struct {
+	config    *rest.Config
+	client    *http.Client
+	namespace string
+}
+
+// NewLogReader creates a LogReader from kubeconfig with the same options
+// as NewClient.
+func NewLogReader(opts ...Option) (LogReader, error) {
+	options := &clientOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	restConfig, namespace, err := loadConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := rest.HTTPClientFor(restConfig)
+	if err != nil {
+		return nil, ErrClusterConnection(options.context, err)
+	}
+	return &restLogReader{config: restConfig, client: httpClient, namespace: namespace}, nil
+}
+
+// PodLogs implements LogReader.PodLogs.
+func (r *restLogReader) PodLogs(ctx context.Context, namespace, pod string, opts PodLogOptions) ([]byte, error) {
+	opts.Follow = false
+	rc, err := r.StreamPodLogs(ctx, namespace, pod, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	body, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, ErrPodLogs(pod, r.namespaceOr(namespace), err)
+	}
+	return body, nil
+}
+
+// StreamPodLogs implements LogReader.StreamPodLogs.
+func (r *restLogReader) StreamPodLogs(ctx context.Context, namespace, pod string, opts PodLogOptions) (io.ReadCloser, error) {
+	namespace = r.namespaceOr(namespace)
+
+	u, _, err := rest.DefaultServerUrlFor(r.config)
+	if err != nil {
+		return nil, ErrPodLogs(pod, namespace, err)
+	}
+	u.Path = path.Join(u.Path, "api/v1/namespaces", namespace, "pods", pod, "log")
+	query := url.Values{}
+	if opts.Container != "" {
+		query.Set("container", opts.Container)
+	}
+	if opts.TailLines > 0 {
+		query.Set("tailLines", strconv.FormatInt(opts.TailLines, 10))
+	}
+	if opts.Previous {
+		query.Set("previous", "true")
+	}
+	if opts.Follow {
+		query.Set("follow", "true")
+	}
+	if opts.Timestamps {
+		query.Set("timestamps", "true")
+	}
+	switch {
+	case opts.SinceSeconds > 0:
+		query.Set("sinceSeconds", strconv.FormatInt(opts.SinceSeconds, 10))
+	case !opts.SinceTime.IsZero():
+		query.Set("sinceTime", opts.SinceTime.UTC().Format(time.RFC3339))
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ErrPodLogs(pod, namespace, err)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, ErrPodLogs(pod, namespace, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, ErrPodLogs(pod, namespace, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body))))
+	}
+	return resp.Body, nil
+}
+
+// namespaceOr returns namespace, or the reader's default namespace when
+// it is empty.
+func (r *restLogReader) namespaceOr(namespace string) string {
+	if namespace == "" {
+		return r.namespace
+	}
+	return namespace
+}
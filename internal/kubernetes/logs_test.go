@@ -0,0 +1,98 @@
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+func newTestLogReader(t *testing.T, handler http.HandlerFunc) LogReader {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	config := &rest.Config{Host: srv.URL}
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &restLogReader{config: config, client: httpClient, namespace: "dev"}
+}
+
+func TestLogReader_PodLogs(t *testing.T) {
+	t.Parallel()
+
+	var gotPath, gotQuery string
+	r := newTestLogReader(t, func(w http.ResponseWriter, req *http.Request) {
+		gotPath, gotQuery = req.URL.Path, req.URL.RawQuery
+		_, _ = w.Write([]byte("panic: boom\n"))
+	})
+
+	out, err := r.PodLogs(context.Background(), "", "api-0", PodLogOptions{Container: "api", TailLines: 20, Previous: true})
+	if err != nil {
+		t.Fatalf("PodLogs() error = %v", err)
+	}
+	if string(out) != "panic: boom\n" {
+		t.Errorf("PodLogs() = %q, want %q", out, "panic: boom\n")
+	}
+	if want := "/api/v1/namespaces/dev/pods/api-0/log"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+	if want := "container=api&previous=true&tailLines=20"; gotQuery != want {
+		t.Errorf("query = %q, want %q", gotQuery, want)
+	}
+}
+
+func TestLogReader_StreamPodLogs(t *testing.T) {
+	t.Parallel()
+
+	var gotQuery string
+	r := newTestLogReader(t, func(w http.ResponseWriter, req *http.Request) {
+		gotQuery = req.URL.RawQuery
+		_, _ = w.Write([]byte("2024-05-01T10:00:00Z ready\n"))
+	})
+
+	rc, err := r.StreamPodLogs(context.Background(), "", "api-0", PodLogOptions{Follow: true, Timestamps: true, SinceSeconds: 600})
+	if err != nil {
+		t.Fatalf("StreamPodLogs() error = %v", err)
+	}
+	defer rc.Close()
+	out, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "2024-05-01T10:00:00Z ready\n" {
+		t.Errorf("StreamPodLogs() read %q", out)
+	}
+	if want := "follow=true&sinceSeconds=600&timestamps=true"; gotQuery != want {
+		t.Errorf("query = %q, want %q", gotQuery, want)
+	}
+
+	since := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	rc, err = r.StreamPodLogs(context.Background(), "", "api-0", PodLogOptions{SinceTime: since})
+	if err != nil {
+		t.Fatalf("StreamPodLogs() error = %v", err)
+	}
+	rc.Close()
+	if want := "sinceTime=2024-05-01T10%3A00%3A00Z"; gotQuery != want {
+		t.Errorf("query = %q, want %q", gotQuery, want)
+	}
+}
+
+func TestLogReader_PodLogsError(t *testing.T) {
+	t.Parallel()
+
+	r := newTestLogReader(t, func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, `previous terminated container "api" not found`, http.StatusBadRequest)
+	})
+
+	_, err := r.PodLogs(context.Background(), "dev", "api-0", PodLogOptions{Previous: true})
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request: previous terminated container") {
+		t.Fatalf("PodLogs() error = %v, want 400 with the server message", err)
+	}
+}
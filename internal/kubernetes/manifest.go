@@ -0,0 +1,67 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	sigyaml "sigs.k8s.io/yaml"
+)
+
+// DecodeManifests decodes a stream of YAML or JSON documents into objects.
+// Empty documents are skipped and List kinds are flattened into their items.
+func DecodeManifests(data []byte) ([]*unstructured.Unstructured, error) {
+	dec := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+
+	var objs []*unstructured.Unstructured
+	for {
+		var raw map[string]any
+		if err := dec.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return objs, nil
+			}
+			return nil, ErrManifest(err)
+		}
+		if len(raw) == 0 {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{Object: raw}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, ErrManifest(err)
+			}
+			for i := range list.Items {
+				objs = append(objs, &list.Items[i])
+			}
+			continue
+		}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, ErrManifest(fmt.Errorf("object %q has no apiVersion or kind", obj.GetName()))
+		}
+		if obj.GetName() == "" {
+			return nil, ErrManifest(fmt.Errorf("%s object has no metadata.name", obj.GetKind()))
+		}
+		objs = append(objs, obj)
+	}
+}
+
+// EncodeManifests encodes objects as a stream of YAML documents that
+// DecodeManifests reads back.
+func EncodeManifests(objs []*unstructured.Unstructured) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, obj := range objs {
+		data, err := sigyaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, ErrManifest(err)
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
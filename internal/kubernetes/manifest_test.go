@@ -0,0 +1,124 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeManifests(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+# comment-only document
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: team-a
+spec:
+  replicas: 2
+---
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: Service
+    metadata:
+      name: api
+  - apiVersion: v1
+    kind: Secret
+    metadata:
+      name: creds
+`)
+
+	objs, err := DecodeManifests(data)
+	if err != nil {
+		t.Fatalf("DecodeManifests() error = %v", err)
+	}
+
+	var got []string
+	for _, obj := range objs {
+		got = append(got, obj.GetKind()+"/"+obj.GetName())
+	}
+	want := []string{"ConfigMap/config", "Deployment/api", "Service/api", "Secret/creds"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DecodeManifests() mismatch (-want +got):\n%s", diff)
+	}
+	if objs[1].GetNamespace() != "team-a" {
+		t.Errorf("namespace = %q, want team-a", objs[1].GetNamespace())
+	}
+}
+
+func TestDecodeManifests_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"missing kind": "apiVersion: v1\nmetadata:\n  name: x\n",
+		"missing name": "apiVersion: v1\nkind: ConfigMap\nmetadata: {}\n",
+		"invalid yaml": "apiVersion: v1\nkind: [\n",
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := DecodeManifests([]byte(data))
+			var kerr *KubernetesError
+			if !errors.As(err, &kerr) || kerr.Op != "decode" {
+				t.Errorf("DecodeManifests() error = %v, want decode error", err)
+			}
+		})
+	}
+}
+
+func TestEncodeManifests(t *testing.T) {
+	t.Parallel()
+
+	objs, err := DecodeManifests([]byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  key: value
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  replicas: 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := EncodeManifests(objs)
+	if err != nil {
+		t.Fatalf("EncodeManifests() error = %v", err)
+	}
+	want := `apiVersion: v1
+data:
+  key: value
+kind: ConfigMap
+metadata:
+  name: config
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  replicas: 2
+`
+	if diff := cmp.Diff(want, string(data)); diff != "" {
+		t.Errorf("EncodeManifests() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,99 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// errConnectionLost is returned when a forward ends without cancellation.
+var errConnectionLost = errors.New("lost connection to pod")
+
+// ForwardPort maps a local port to a pod port.
+type ForwardPort struct {
+	Local  int
+	Remote int
+}
+
+// PortForwarder opens port-forwards to pods through the API server.
+type PortForwarder interface {
+	// PortForward listens on address and forwards ports to the pod. It
+	// closes ready once the listeners are up and blocks until ctx is
+	// cancelled (returning nil) or the connection to the pod is lost.
+	PortForward(ctx context.Context, namespace, pod, address string, ports []ForwardPort, ready chan struct{}) error
+}
+
+// spdyForwarder implements PortForwarder with client-go's SPDY dialer.
+type spdyForwarder struct {
+	config    *rest.Config
+	namespace string
+}
+
+// NewPortForwarder creates a PortForwarder from kubeconfig with the same
+// options as NewClient.
+func NewPortForwarder(opts ...Option) (PortForwarder, error) {
+	options := &clientOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	restConfig, namespace, err := loadConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	return &spdyForwarder{config: restConfig, namespace: namespace}, nil
+}
+
+// PortForward implements PortForwarder.PortForward.
+func (f *spdyForwarder) PortForward(ctx context.Context, namespace, pod, address string, ports []ForwardPort, ready chan struct{}) error {
+	if namespace == "" {
+		namespace = f.namespace
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(f.config)
+	if err != nil {
+		return ErrPortForward(pod, namespace, err)
+	}
+	u, _, err := rest.DefaultServerUrlFor(f.config)
+	if err != nil {
+		return ErrPortForward(pod, namespace, err)
+	}
+	u.Path = path.Join(u.Path, "api/v1/namespaces", namespace, "pods", pod, "portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, u)
+
+	specs := make([]string, len(ports))
+	for i, p := range ports {
+		specs[i] = fmt.Sprintf("%d:%d", p.Local, p.Remote)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(stop)
+		case <-done:
+		}
+	}()
+
+	pf, err := portforward.NewOnAddresses(dialer, []string{address}, specs, stop, ready, io.Discard, io.Discard)
+	if err != nil {
+		return ErrPortForward(pod, namespace, err)
+	}
+	err = pf.ForwardPorts()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err == nil {
+		err = errConnectionLost
+	}
+	return ErrPortForward(pod, namespace, err)
+}
@@ -0,0 +1,95 @@
+package kubernetes
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/yar-run/yar/internal/action"
+)
+
+// recordingClient passes every change through an action log. Reads go to
+// the wrapped client, so a dry run plans against the live cluster.
+type recordingClient struct {
+	Client
+	log *action.Log
+}
+
+// NewRecordingClient returns a Client that records Apply, Create, Update,
+// Patch and Delete in log. In a dry run they are not sent to the cluster: Apply returns the
+// object as it would be submitted.
+func NewRecordingClient(client Client, log *action.Log) Client {
+	return &recordingClient{Client: client, log: log}
+}
+
+// Apply implements Client.Apply.
+func (c *recordingClient) Apply(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	return c.write(ctx, "apply", obj, c.Client.Apply)
+}
+
+// Create implements Client.Create.
+func (c *recordingClient) Create(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	return c.write(ctx, "create", obj, c.Client.Create)
+}
+
+// Update implements Client.Update.
+func (c *recordingClient) Update(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	return c.write(ctx, "update", obj, c.Client.Update)
+}
+
+// write records op on obj and, unless this is a dry run, sends it with fn.
+// In a dry run it returns obj as it would be submitted.
+func (c *recordingClient) write(ctx context.Context, op string, obj *unstructured.Unstructured, fn func(context.Context, *unstructured.Unstructured) (*unstructured.Unstructured, error)) (*unstructured.Unstructured, error) {
+	result := obj.DeepCopy()
+	if result.GetNamespace() == "" && !isClusterScoped(obj.GroupVersionKind()) {
+		result.SetNamespace(c.Namespace())
+	}
+	a := action.Action{Kind: action.KindKubernetes, Op: op, Object: objectRef(obj.GroupVersionKind(), result.GetNamespace(), result.GetName())}
+	err := c.log.Do(a, func() error {
+		var err error
+		result, err = fn(ctx, obj)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Patch implements Client.Patch.
+func (c *recordingClient) Patch(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, pt types.PatchType, data []byte) error {
+	a := action.Action{Kind: action.KindKubernetes, Op: "patch", Object: objectRef(gvk, c.ns(namespace, gvk), name), Detail: string(data)}
+	return c.log.Do(a, func() error {
+		return c.Client.Patch(ctx, gvk, namespace, name, pt, data)
+	})
+}
+
+// Delete implements Client.Delete.
+func (c *recordingClient) Delete(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) error {
+	a := action.Action{Kind: action.KindKubernetes, Op: "delete", Object: objectRef(gvk, c.ns(namespace, gvk), name)}
+	return c.log.Do(a, func() error {
+		return c.Client.Delete(ctx, gvk, namespace, name)
+	})
+}
+
+// Ensure recordingClient implements Client.
+var _ Client = (*recordingClient)(nil)
+
+// ns returns namespace, or the default namespace for namespaced kinds.
+func (c *recordingClient) ns(namespace string, gvk schema.GroupVersionKind) string {
+	if namespace == "" && !isClusterScoped(gvk) {
+		return c.Namespace()
+	}
+	return namespace
+}
+
+// objectRef formats an object as "Kind namespace/name", or "Kind name" for
+// cluster-scoped objects.
+func objectRef(gvk schema.GroupVersionKind, namespace, name string) string {
+	if namespace == "" {
+		return gvk.Kind + " " + name
+	}
+	return gvk.Kind + " " + namespace + "/" + name
+}
@@ -0,0 +1,70 @@
+package kubernetes_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/kubernetes"
+	"github.com/yar-run/yar/internal/kubernetes/kubetest"
+)
+
+func TestRecordingClient(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	for _, dryRun := range []bool{false, true} {
+		fake, dyn := kubetest.NewFakeClient("dev", newObject(kubernetes.DeploymentKind, "dev", "web", nil), newObject(kubernetes.ConfigMapKind, "dev", "old", nil))
+		log := action.NewLog(dryRun)
+		client := kubernetes.NewRecordingClient(fake, log)
+
+		applied, err := client.Apply(ctx, newObject(kubernetes.ConfigMapKind, "", "app-config", nil))
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if applied.GetNamespace() != "dev" {
+			t.Errorf("dryRun=%v: applied namespace = %q, want dev", dryRun, applied.GetNamespace())
+		}
+		if _, err := client.Apply(ctx, newObject(kubernetes.NamespaceKind, "", "team-a", nil)); err != nil {
+			t.Fatalf("Apply() namespace error = %v", err)
+		}
+		if err := client.Patch(ctx, kubernetes.DeploymentKind, "", "web", types.MergePatchType, []byte(`{"spec":{"replicas":0}}`)); err != nil {
+			t.Fatalf("Patch() error = %v", err)
+		}
+		if err := client.Delete(ctx, kubernetes.ConfigMapKind, "dev", "old"); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+
+		want := []action.Action{
+			{Kind: action.KindKubernetes, Op: "apply", Object: "ConfigMap dev/app-config"},
+			{Kind: action.KindKubernetes, Op: "apply", Object: "Namespace team-a"},
+			{Kind: action.KindKubernetes, Op: "patch", Object: "Deployment dev/web", Detail: `{"spec":{"replicas":0}}`},
+			{Kind: action.KindKubernetes, Op: "delete", Object: "ConfigMap dev/old"},
+		}
+		if diff := cmp.Diff(want, log.Actions()); diff != "" {
+			t.Errorf("dryRun=%v: actions mismatch (-want +got):\n%s", dryRun, diff)
+		}
+
+		// Reads still reach the cluster; changes only outside a dry run.
+		var changes int
+		for _, a := range dyn.Actions() {
+			switch a.GetVerb() {
+			case "patch", "delete", "create", "update":
+				changes++
+			}
+		}
+		if dryRun && changes != 0 {
+			t.Errorf("dry run sent %d changes to the cluster", changes)
+		}
+		if !dryRun && changes != 4 {
+			t.Errorf("changes = %d, want 4", changes)
+		}
+		_, err = fake.Get(ctx, kubernetes.ConfigMapKind, "dev", "old")
+		if deleted := kubernetes.IsNotFound(err); deleted == dryRun {
+			t.Errorf("dryRun=%v: old deleted = %v", dryRun, deleted)
+		}
+	}
+}
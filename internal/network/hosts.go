@@ -0,0 +1,250 @@
+package network
+
+import (
+	stderrors "errors"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/platform"
+)
+
+// ManagedMarker is the comment appended to every hosts line yar writes.
+// Lines without it are never modified.
+const ManagedMarker = "# yar:managed"
+
+// HostEntry is a single name-to-address mapping.
+type HostEntry struct {
+	Name string
+	IP   string
+}
+
+// Hosts reads and edits the yar-managed entries of a hosts file.
+type Hosts struct {
+	path    string
+	actions *action.Log
+}
+
+// HostsOption configures Hosts.
+type HostsOption func(*Hosts)
+
+// WithHostsPath sets the hosts file path instead of the platform default.
+func WithHostsPath(path string) HostsOption {
+	return func(h *Hosts) {
+		h.path = path
+	}
+}
+
+// WithHostsActionLog records the lines each change adds and removes, and
+// the file write, in log. In a dry run the file is not written.
+func WithHostsActionLog(log *action.Log) HostsOption {
+	return func(h *Hosts) {
+		h.actions = log
+	}
+}
+
+// NewHosts creates a Hosts for the platform hosts file.
+func NewHosts(opts ...HostsOption) *Hosts {
+	h := &Hosts{path: DefaultHostsPath()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// DefaultHostsPath returns the hosts file location for the current platform.
+func DefaultHostsPath() string {
+	if platform.Platform() == platform.Windows {
+		return `C:\Windows\System32\drivers\etc\hosts`
+	}
+	return "/etc/hosts"
+}
+
+// Path returns the hosts file path.
+func (h *Hosts) Path() string {
+	return h.path
+}
+
+// List returns the yar-managed entries in file order.
+func (h *Hosts) List() ([]HostEntry, error) {
+	lines, _, err := h.read()
+	if err != nil {
+		return nil, err
+	}
+	var entries []HostEntry
+	for _, line := range lines {
+		entries = append(entries, parseManaged(line)...)
+	}
+	return entries, nil
+}
+
+// Get returns the yar-managed entry for name.
+func (h *Hosts) Get(name string) (HostEntry, error) {
+	entries, err := h.List()
+	if err != nil {
+		return HostEntry{}, err
+	}
+	for _, e := range entries {
+		if e.Name == name {
+			return e, nil
+		}
+	}
+	return HostEntry{}, &errors.NotFoundError{Resource: "host entry", Name: name, Message: "no yar-managed entry in " + h.path}
+}
+
+// Set adds or replaces yar-managed entries. Existing managed lines for the
+// same names are removed; unmanaged lines are left untouched.
+func (h *Hosts) Set(entries ...HostEntry) error {
+	names := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if e.Name == "" || strings.ContainsAny(e.Name, " \t#") {
+			return &errors.ValidationError{Field: "name", Value: e.Name, Message: "invalid host name"}
+		}
+		if net.ParseIP(e.IP) == nil {
+			return &errors.ValidationError{Field: "ip", Value: e.IP, Message: "invalid IP address"}
+		}
+		names[e.Name] = true
+	}
+
+	old, mode, err := h.read()
+	if err != nil {
+		return err
+	}
+	lines, _ := removeManaged(old, names)
+	for _, e := range entries {
+		lines = append(lines, e.IP+"\t"+e.Name+" "+ManagedMarker)
+	}
+	return h.write(old, lines, mode)
+}
+
+// Delete removes the yar-managed entries for names. Names without an entry
+// are ignored, so Delete is idempotent.
+func (h *Hosts) Delete(names ...string) error {
+	lines, mode, err := h.read()
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	kept, changed := removeManaged(lines, set)
+	if !changed {
+		return nil
+	}
+	return h.write(lines, kept, mode)
+}
+
+// read returns the file's lines (without the trailing newline) and mode.
+func (h *Hosts) read() ([]string, fs.FileMode, error) {
+	info, err := os.Stat(h.path)
+	if err != nil {
+		return nil, 0, &errors.NetworkError{Op: "hosts", Target: h.path, Message: "failed to read hosts file", Err: err}
+	}
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		return nil, 0, &errors.NetworkError{Op: "hosts", Target: h.path, Message: "failed to read hosts file", Err: err}
+	}
+	content := strings.TrimRight(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if content == "" {
+		return nil, info.Mode().Perm(), nil
+	}
+	return strings.Split(content, "\n"), info.Mode().Perm(), nil
+}
+
+// write replaces the file's old lines with lines in place, recording the
+// lines removed and added. A rename would replace the inode, which breaks
+// hosts files bind-mounted into containers.
+func (h *Hosts) write(old, lines []string, mode fs.FileMode) error {
+	removed, added := diffLines(old, lines)
+	for _, line := range removed {
+		h.actions.Record(action.Action{Kind: action.KindHosts, Op: "remove", Object: line})
+	}
+	for _, line := range added {
+		h.actions.Record(action.Action{Kind: action.KindHosts, Op: "add", Object: line})
+	}
+
+	content := strings.Join(lines, "\n") + "\n"
+	return h.actions.Do(action.Action{Kind: action.KindFile, Op: "write", Object: h.path}, func() error {
+		if err := os.WriteFile(h.path, []byte(content), mode); err != nil {
+			msg := "failed to write hosts file"
+			if stderrors.Is(err, fs.ErrPermission) {
+				msg += " (try again with sudo)"
+			}
+			return &errors.NetworkError{Op: "hosts", Target: h.path, Message: msg, Err: err}
+		}
+		return nil
+	})
+}
+
+// diffLines returns the lines of old missing from lines, and the lines of
+// lines missing from old, each in order.
+func diffLines(old, lines []string) (removed, added []string) {
+	count := make(map[string]int, len(old))
+	for _, line := range old {
+		count[line]++
+	}
+	for _, line := range lines {
+		if count[line] > 0 {
+			count[line]--
+			continue
+		}
+		added = append(added, line)
+	}
+	for _, line := range old {
+		if count[line] > 0 {
+			count[line]--
+			removed = append(removed, line)
+		}
+	}
+	return removed, added
+}
+
+// parseManaged returns the entries of a yar-managed line, or nil for any
+// other line.
+func parseManaged(line string) []HostEntry {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "#") || !strings.HasSuffix(line, ManagedMarker) {
+		return nil
+	}
+	fields := strings.Fields(strings.TrimSuffix(line, ManagedMarker))
+	if len(fields) < 2 {
+		return nil
+	}
+	entries := make([]HostEntry, 0, len(fields)-1)
+	for _, name := range fields[1:] {
+		entries = append(entries, HostEntry{Name: name, IP: fields[0]})
+	}
+	return entries
+}
+
+// removeManaged drops names from managed lines, removing lines left empty.
+// changed reports whether any line was touched.
+func removeManaged(lines []string, names map[string]bool) (kept []string, changed bool) {
+	kept = make([]string, 0, len(lines))
+	for _, line := range lines {
+		entries := parseManaged(line)
+		if entries == nil {
+			kept = append(kept, line)
+			continue
+		}
+		var rest []string
+		for _, e := range entries {
+			if !names[e.Name] {
+				rest = append(rest, e.Name)
+			}
+		}
+		switch {
+		case len(rest) == len(entries):
+			kept = append(kept, line)
+			continue
+		case len(rest) > 0:
+			kept = append(kept, entries[0].IP+"\t"+strings.Join(rest, " ")+" "+ManagedMarker)
+		}
+		changed = true
+	}
+	return kept, changed
+}
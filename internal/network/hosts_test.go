@@ -0,0 +1,191 @@
+package network
+
+import (
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+const baseHosts = `127.0.0.1	localhost
+::1	localhost
+# 10.0.0.1	commented # yar:managed
+10.0.0.5	intranet
+`
+
+func newTestHosts(t *testing.T, content string) *Hosts {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return NewHosts(WithHostsPath(path))
+}
+
+func readHosts(t *testing.T, h *Hosts) string {
+	t.Helper()
+	data, err := os.ReadFile(h.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestHosts_SetAndList(t *testing.T) {
+	h := newTestHosts(t, baseHosts)
+
+	err := h.Set(
+		HostEntry{Name: "redis.ai-agents-redis", IP: "127.0.0.1"},
+		HostEntry{Name: "api.ai-agents-redis", IP: "127.0.0.1"},
+	)
+	if err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	want := baseHosts +
+		"127.0.0.1\tredis.ai-agents-redis # yar:managed\n" +
+		"127.0.0.1\tapi.ai-agents-redis # yar:managed\n"
+	if diff := cmp.Diff(want, readHosts(t, h)); diff != "" {
+		t.Errorf("file mismatch (-want +got):\n%s", diff)
+	}
+
+	entries, err := h.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	wantEntries := []HostEntry{
+		{Name: "redis.ai-agents-redis", IP: "127.0.0.1"},
+		{Name: "api.ai-agents-redis", IP: "127.0.0.1"},
+	}
+	if diff := cmp.Diff(wantEntries, entries); diff != "" {
+		t.Errorf("List() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHosts_SetReplacesManagedOnly(t *testing.T) {
+	h := newTestHosts(t, baseHosts+"127.0.0.1\tdb # yar:managed\n")
+
+	if err := h.Set(HostEntry{Name: "db", IP: "127.0.0.2"}, HostEntry{Name: "intranet", IP: "127.0.0.3"}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	want := baseHosts +
+		"127.0.0.2\tdb # yar:managed\n" +
+		"127.0.0.3\tintranet # yar:managed\n"
+	if diff := cmp.Diff(want, readHosts(t, h)); diff != "" {
+		t.Errorf("file mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHosts_Get(t *testing.T) {
+	h := newTestHosts(t, baseHosts+"127.0.0.1\tdb cache # yar:managed\n")
+
+	got, err := h.Get("cache")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got != (HostEntry{Name: "cache", IP: "127.0.0.1"}) {
+		t.Errorf("Get() = %+v", got)
+	}
+
+	_, err = h.Get("intranet")
+	var nf *errors.NotFoundError
+	if !stderrors.As(err, &nf) {
+		t.Errorf("Get(unmanaged) error = %v, want NotFoundError", err)
+	}
+}
+
+func TestHosts_Delete(t *testing.T) {
+	h := newTestHosts(t, baseHosts+"127.0.0.1\tdb cache # yar:managed\n127.0.0.1\tweb # yar:managed\n")
+
+	if err := h.Delete("db", "web", "intranet", "missing"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	want := baseHosts + "127.0.0.1\tcache # yar:managed\n"
+	if diff := cmp.Diff(want, readHosts(t, h)); diff != "" {
+		t.Errorf("file mismatch (-want +got):\n%s", diff)
+	}
+
+	// Deleting again leaves the file untouched.
+	if err := h.Delete("db"); err != nil {
+		t.Fatalf("Delete() second call error = %v", err)
+	}
+	if diff := cmp.Diff(want, readHosts(t, h)); diff != "" {
+		t.Errorf("file changed on idempotent delete (-want +got):\n%s", diff)
+	}
+}
+
+func TestHosts_ActionLog(t *testing.T) {
+	content := baseHosts + "127.0.0.1\tdb cache # yar:managed\n"
+
+	for _, dryRun := range []bool{false, true} {
+		h := newTestHosts(t, content)
+		log := action.NewLog(dryRun)
+		h = NewHosts(WithHostsPath(h.Path()), WithHostsActionLog(log))
+
+		if err := h.Set(HostEntry{Name: "db", IP: "10.0.0.2"}); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+
+		want := []action.Action{
+			{Kind: action.KindHosts, Op: "remove", Object: "127.0.0.1\tdb cache # yar:managed"},
+			{Kind: action.KindHosts, Op: "add", Object: "127.0.0.1\tcache # yar:managed"},
+			{Kind: action.KindHosts, Op: "add", Object: "10.0.0.2\tdb # yar:managed"},
+			{Kind: action.KindFile, Op: "write", Object: h.Path()},
+		}
+		if diff := cmp.Diff(want, log.Actions()); diff != "" {
+			t.Errorf("dryRun=%v: actions mismatch (-want +got):\n%s", dryRun, diff)
+		}
+
+		wantFile := baseHosts + "127.0.0.1\tcache # yar:managed\n10.0.0.2\tdb # yar:managed\n"
+		if dryRun {
+			wantFile = content
+		}
+		if diff := cmp.Diff(wantFile, readHosts(t, h)); diff != "" {
+			t.Errorf("dryRun=%v: file mismatch (-want +got):\n%s", dryRun, diff)
+		}
+	}
+}
+
+func TestHosts_SetValidation(t *testing.T) {
+	h := newTestHosts(t, baseHosts)
+
+	tests := []struct {
+		name  string
+		entry HostEntry
+	}{
+		{"empty name", HostEntry{Name: "", IP: "127.0.0.1"}},
+		{"name with space", HostEntry{Name: "a b", IP: "127.0.0.1"}},
+		{"bad ip", HostEntry{Name: "db", IP: "not-an-ip"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := h.Set(tt.entry)
+			var ve *errors.ValidationError
+			if !stderrors.As(err, &ve) {
+				t.Errorf("Set() error = %v, want ValidationError", err)
+			}
+		})
+	}
+	if diff := cmp.Diff(baseHosts, readHosts(t, h)); diff != "" {
+		t.Errorf("file modified by invalid Set (-want +got):\n%s", diff)
+	}
+}
+
+func TestHosts_MissingFile(t *testing.T) {
+	h := NewHosts(WithHostsPath(filepath.Join(t.TempDir(), "missing")))
+
+	_, err := h.List()
+	var ne *errors.NetworkError
+	if !stderrors.As(err, &ne) {
+		t.Fatalf("List() error = %v, want NetworkError", err)
+	}
+	if ne.Op != "hosts" {
+		t.Errorf("Op = %q, want hosts", ne.Op)
+	}
+}
@@ -0,0 +1,518 @@
+package packs
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/platform"
+	"gopkg.in/yaml.v3"
+)
+
+// FileCatalogIndex is the index file of a catalog directory.
+const FileCatalogIndex = "index.yaml"
+
+// maxIndexSize limits the size of catalog index files.
+const maxIndexSize = 16 << 20
+
+// Catalog index signatures and checksums sit next to the index, as
+// index.yaml.sig (base64 ed25519 signature of the index) and
+// index.yaml.sha256 (hex sha256, as written by sha256sum).
+const (
+	suffixSignature = ".sig"
+	suffixChecksum  = ".sha256"
+)
+
+// CatalogIndex is a catalog index: the packs a catalog offers and where to
+// install each version from.
+//
+//	apiVersion: yar.io/v1
+//	kind: PackCatalog
+//	packs:
+//	  - name: redis
+//	    description: Redis in-memory data store
+//	    tags: [database, cache]
+//	    versions:
+//	      - version: 1.2.0
+//	        source: redis-1.2.0.tgz
+//	        sha256: 4f1c...
+//	      - version: 1.1.0
+//	        source: git+https://github.com/acme/packs.git#redis-v1.1.0
+//	        path: redis
+type CatalogIndex struct {
+	APIVersion string         `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string         `yaml:"kind" json:"kind"`
+	Packs      []*CatalogPack `yaml:"packs" json:"packs"`
+}
+
+// CatalogPack is a pack listed in a catalog.
+type CatalogPack struct {
+	Name        string            `yaml:"name" json:"name"`
+	Description string            `yaml:"description,omitempty" json:"description,omitempty"`
+	Tags        []string          `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Versions    []*CatalogVersion `yaml:"versions" json:"versions"` // highest first
+	Catalog     string            `yaml:"-" json:"catalog"`         // name of the catalog listing it
+}
+
+// CatalogVersion is a version of a catalog pack.
+type CatalogVersion struct {
+	Version string `yaml:"version" json:"version"`
+	Source  string `yaml:"source" json:"source"`                     // install source, relative ones resolved against the index
+	Path    string `yaml:"path,omitempty" json:"path,omitempty"`     // pack directory inside the source
+	SHA256  string `yaml:"sha256,omitempty" json:"sha256,omitempty"` // of tarball sources
+}
+
+// Latest returns the highest version that is not a pre-release, or the
+// highest pre-release if there is nothing else.
+func (p *CatalogPack) Latest() *CatalogVersion {
+	for _, v := range p.Versions {
+		if s, _ := parseSemver(v.Version); len(s.pre) == 0 {
+			return v
+		}
+	}
+	if len(p.Versions) > 0 {
+		return p.Versions[0]
+	}
+	return nil
+}
+
+// matches reports whether term, lowercased, is in the pack's name,
+// description or tags.
+func (p *CatalogPack) matches(term string) bool {
+	if strings.Contains(p.Name, term) || strings.Contains(strings.ToLower(p.Description), term) {
+		return true
+	}
+	for _, tag := range p.Tags {
+		if strings.Contains(strings.ToLower(tag), term) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCatalogIndex parses and validates a catalog index. Relative
+// sources are resolved against base, the URL or path of the index.
+func ParseCatalogIndex(data []byte, base string) (*CatalogIndex, error) {
+	var index CatalogIndex
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid catalog index: %w", err)
+	}
+	if index.APIVersion != "yar.io/v1" || index.Kind != "PackCatalog" {
+		return nil, fmt.Errorf("not a catalog index: want apiVersion yar.io/v1 and kind PackCatalog, got %q and %q", index.APIVersion, index.Kind)
+	}
+	seen := make(map[string]bool, len(index.Packs))
+	for i, p := range index.Packs {
+		switch {
+		case p == nil || !namePattern.MatchString(p.Name):
+			return nil, fmt.Errorf("invalid catalog index: packs[%d] has no valid name", i)
+		case seen[p.Name]:
+			return nil, fmt.Errorf("invalid catalog index: pack %s is listed twice", p.Name)
+		case len(p.Versions) == 0:
+			return nil, fmt.Errorf("invalid catalog index: pack %s has no versions", p.Name)
+		}
+		seen[p.Name] = true
+		versions := make(map[string]bool, len(p.Versions))
+		for _, v := range p.Versions {
+			switch {
+			case v == nil || !ValidVersion(v.Version):
+				return nil, fmt.Errorf("invalid catalog index: pack %s has a version that is not a semantic version", p.Name)
+			case versions[v.Version]:
+				return nil, fmt.Errorf("invalid catalog index: pack %s lists version %s twice", p.Name, v.Version)
+			case v.Source == "":
+				return nil, fmt.Errorf("invalid catalog index: pack %s %s has no source", p.Name, v.Version)
+			}
+			versions[v.Version] = true
+			v.Source = resolveCatalogSource(base, v.Source)
+		}
+		sort.SliceStable(p.Versions, func(a, b int) bool {
+			return CompareVersions(p.Versions[a].Version, p.Versions[b].Version) > 0
+		})
+	}
+	return &index, nil
+}
+
+// resolveCatalogSource resolves a relative install source against base.
+func resolveCatalogSource(base, source string) string {
+	if strings.Contains(source, "://") || strings.HasPrefix(source, "git+") || strings.HasPrefix(source, "git@") || filepath.IsAbs(source) {
+		return source
+	}
+	if isHTTP(base) {
+		b, err := url.Parse(base)
+		if err != nil {
+			return source
+		}
+		ref, err := url.Parse(source)
+		if err != nil {
+			return source
+		}
+		return b.ResolveReference(ref).String()
+	}
+	return filepath.Join(filepath.Dir(base), filepath.FromSlash(source))
+}
+
+// VerifyCatalogIndex checks index against its signature, a base64 ed25519
+// signature made with publicKey (base64), and its checksum file content.
+// A signature is required if publicKey is set; either may be nil
+// otherwise. It returns how the index was verified: "signature", "sha256"
+// or "".
+func VerifyCatalogIndex(index, signature, checksum []byte, publicKey string) (string, error) {
+	if publicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return "", fmt.Errorf("invalid catalog public key")
+		}
+		if signature == nil {
+			return "", fmt.Errorf("catalog index is not signed; %s%s is missing", FileCatalogIndex, suffixSignature)
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil || !ed25519.Verify(ed25519.PublicKey(key), index, sig) {
+			return "", fmt.Errorf("catalog index signature does not verify with the configured public key")
+		}
+		return "signature", nil
+	}
+	if checksum != nil {
+		fields := strings.Fields(string(checksum))
+		sum := sha256.Sum256(index)
+		if len(fields) == 0 || !strings.EqualFold(fields[0], hex.EncodeToString(sum[:])) {
+			return "", fmt.Errorf("catalog index does not match its checksum %s%s", FileCatalogIndex, suffixChecksum)
+		}
+		return "sha256", nil
+	}
+	return "", nil
+}
+
+// Catalog reads pack catalogs. Update fetches their indexes into the
+// cache; everything else works offline from it.
+type Catalog struct {
+	sources []*config.CatalogConfig
+	dir     string
+	client  *http.Client
+}
+
+// CatalogOption configures a Catalog.
+type CatalogOption func(*Catalog)
+
+// WithCatalogCacheDir sets the directory fetched indexes are kept in, by
+// default catalogs/ in the yar cache directory.
+func WithCatalogCacheDir(dir string) CatalogOption {
+	return func(c *Catalog) {
+		c.dir = dir
+	}
+}
+
+// WithCatalogHTTPClient sets the client for http(s) catalogs.
+func WithCatalogHTTPClient(client *http.Client) CatalogOption {
+	return func(c *Catalog) {
+		c.client = client
+	}
+}
+
+// NewCatalog creates a catalog reader for the configured catalogs.
+func NewCatalog(sources []*config.CatalogConfig, opts ...CatalogOption) (*Catalog, error) {
+	c := &Catalog{sources: sources, client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.dir == "" {
+		dir, err := platform.CacheDir()
+		if err != nil {
+			return nil, err
+		}
+		c.dir = filepath.Join(dir, "catalogs")
+	}
+	return c, nil
+}
+
+// cachedCatalog is a fetched index, kept as <cache>/<catalog>.json.
+type cachedCatalog struct {
+	URL       string    `json:"url"`
+	Location  string    `json:"location"` // where the index was read, for relative sources
+	FetchedAt time.Time `json:"fetchedAt"`
+	Verified  string    `json:"verified,omitempty"`
+	Signature string    `json:"signature,omitempty"`
+	Index     string    `json:"index"`
+}
+
+// CatalogUpdate is the outcome of fetching one catalog.
+type CatalogUpdate struct {
+	Name     string `yaml:"name" json:"name"`
+	URL      string `yaml:"url" json:"url"`
+	Packs    int    `yaml:"packs" json:"packs"`
+	Verified string `yaml:"verified,omitempty" json:"verified,omitempty"` // signature, sha256 or empty
+	Err      error  `yaml:"-" json:"-"`
+}
+
+// Update fetches and verifies the index of every catalog and replaces
+// its cached copy. A catalog that fails keeps its previous copy.
+func (c *Catalog) Update(ctx context.Context) []CatalogUpdate {
+	updates := make([]CatalogUpdate, 0, len(c.sources))
+	for _, src := range c.sources {
+		u := CatalogUpdate{Name: src.Name, URL: src.URL}
+		u.Packs, u.Verified, u.Err = c.update(ctx, src)
+		updates = append(updates, u)
+	}
+	return updates
+}
+
+func (c *Catalog) update(ctx context.Context, src *config.CatalogConfig) (int, string, error) {
+	location, err := indexLocation(src.URL)
+	if err != nil {
+		return 0, "", err
+	}
+	data, err := c.read(ctx, location)
+	if err != nil {
+		return 0, "", err
+	}
+	if data == nil {
+		return 0, "", fmt.Errorf("%s not found", location)
+	}
+	signature, err := c.read(ctx, location+suffixSignature)
+	if err != nil {
+		return 0, "", err
+	}
+	checksum, err := c.read(ctx, location+suffixChecksum)
+	if err != nil {
+		return 0, "", err
+	}
+	verified, err := VerifyCatalogIndex(data, signature, checksum, src.PublicKey)
+	if err != nil {
+		return 0, "", err
+	}
+	// Local files are the user's own; an index fetched over the network
+	// must come with a checksum at least.
+	if verified == "" && isHTTP(location) {
+		return 0, "", fmt.Errorf("catalog index has neither a signature nor a checksum (%s%s)", location, suffixChecksum)
+	}
+	index, err := ParseCatalogIndex(data, location)
+	if err != nil {
+		return 0, "", err
+	}
+
+	cached, err := json.MarshalIndent(cachedCatalog{
+		URL:       src.URL,
+		Location:  location,
+		FetchedAt: time.Now().UTC().Truncate(time.Second),
+		Verified:  verified,
+		Signature: strings.TrimSpace(string(signature)),
+		Index:     string(data),
+	}, "", "  ")
+	if err != nil {
+		return 0, "", err
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return 0, "", err
+	}
+	path := c.cachePath(src.Name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, cached, 0o644); err != nil {
+		return 0, "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, "", err
+	}
+	return len(index.Packs), verified, nil
+}
+
+// indexLocation returns the URL or absolute path of a catalog's index.
+func indexLocation(source string) (string, error) {
+	if isHTTP(source) {
+		return source, nil
+	}
+	path, err := platform.ExpandPath(strings.TrimPrefix(source, "file://"))
+	if err != nil {
+		return "", err
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, FileCatalogIndex)
+	}
+	return path, nil
+}
+
+// read returns the content of a file or http(s) URL, or nil if it does not
+// exist.
+func (c *Catalog) read(ctx context.Context, location string) ([]byte, error) {
+	var r io.Reader
+	if isHTTP(location) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("GET %s: %s", location, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(location)
+		if err != nil {
+			if stderrors.Is(err, fs.ErrNotExist) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxIndexSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxIndexSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", location, maxIndexSize)
+	}
+	return data, nil
+}
+
+func (c *Catalog) cachePath(name string) string {
+	return filepath.Join(c.dir, name+".json")
+}
+
+// load returns the cached index of src, or nil if it has not been fetched
+// from its current URL.
+func (c *Catalog) load(src *config.CatalogConfig) (*CatalogIndex, error) {
+	path := c.cachePath(src.Name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if stderrors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var cached cachedCatalog
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, &errors.ConfigError{Path: path, Message: "invalid cached catalog; run yar fleet update", Err: err}
+	}
+	if cached.URL != src.URL {
+		return nil, nil
+	}
+	// Check the signature again, in case the key was set after the fetch.
+	var signature []byte
+	if cached.Signature != "" {
+		signature = []byte(cached.Signature)
+	}
+	if _, err := VerifyCatalogIndex([]byte(cached.Index), signature, nil, src.PublicKey); err != nil {
+		return nil, &errors.ConfigError{Path: path, Message: "cached catalog " + src.Name + " does not verify; run yar fleet update", Err: err}
+	}
+	index, err := ParseCatalogIndex([]byte(cached.Index), cached.Location)
+	if err != nil {
+		return nil, &errors.ConfigError{Path: path, Message: "invalid cached catalog; run yar fleet update", Err: err}
+	}
+	for _, p := range index.Packs {
+		p.Catalog = src.Name
+	}
+	return index, nil
+}
+
+// Unfetched returns the names of the catalogs with no cached index.
+func (c *Catalog) Unfetched() []string {
+	var names []string
+	for _, src := range c.sources {
+		if index, err := c.load(src); index == nil && err == nil {
+			names = append(names, src.Name)
+		}
+	}
+	return names
+}
+
+// Packs returns the packs of every fetched catalog, by name and then in
+// catalog order.
+func (c *Catalog) Packs() ([]*CatalogPack, error) {
+	var all []*CatalogPack
+	for _, src := range c.sources {
+		index, err := c.load(src)
+		if err != nil {
+			return nil, err
+		}
+		if index != nil {
+			all = append(all, index.Packs...)
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all, nil
+}
+
+// Search returns the packs whose name, description or tags contain term,
+// ignoring case.
+func (c *Catalog) Search(term string) ([]*CatalogPack, error) {
+	all, err := c.Packs()
+	if err != nil {
+		return nil, err
+	}
+	term = strings.ToLower(strings.TrimSpace(term))
+	var found []*CatalogPack
+	for _, p := range all {
+		if p.matches(term) {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+// Find returns the highest version of pack name matching constraint
+// (any release if empty) across the catalogs; on a tie the catalog listed
+// first wins.
+func (c *Catalog) Find(name, constraint string) (*CatalogPack, *CatalogVersion, error) {
+	if constraint == "" {
+		constraint = "*"
+	}
+	con, err := ParseConstraint(constraint)
+	if err != nil {
+		return nil, nil, &errors.ValidationError{Field: "version", Value: constraint, Message: err.Error()}
+	}
+	all, err := c.Packs()
+	if err != nil {
+		return nil, nil, err
+	}
+	var bestPack *CatalogPack
+	var best *CatalogVersion
+	var available []string
+	for _, p := range all {
+		if p.Name != name {
+			continue
+		}
+		for _, v := range p.Versions {
+			available = append(available, v.Version+" ("+p.Catalog+")")
+			if con.Check(v.Version) && (best == nil || CompareVersions(v.Version, best.Version) > 0) {
+				bestPack, best = p, v
+			}
+		}
+	}
+	switch {
+	case best != nil:
+		return bestPack, best, nil
+	case len(available) == 0:
+		return nil, nil, &errors.NotFoundError{Resource: "pack", Name: name, Message: "not in any fetched catalog; run yar fleet update to refresh them"}
+	}
+	return nil, nil, &errors.NotFoundError{
+		Resource: "pack",
+		Name:     name + "@" + constraint,
+		Message:  "no catalog version matches; available: " + strings.Join(available, ", "),
+	}
+}
@@ -0,0 +1,305 @@
+package packs
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yar-run/yar/internal/config"
+)
+
+const testCatalogIndex = `apiVersion: yar.io/v1
+kind: PackCatalog
+packs:
+  - name: redis
+    description: Redis in-memory data store
+    tags: [database, cache]
+    versions:
+      - version: 1.1.0
+        source: git+https://example.com/packs.git#redis-v1.1.0
+        path: redis
+      - version: 1.2.0
+        source: redis-1.2.0.tgz
+        sha256: SUM
+      - version: 2.0.0-rc.1
+        source: oci://ghcr.io/acme/redis:2.0.0-rc.1
+  - name: postgres
+    description: PostgreSQL database
+    tags: [database, sql]
+    versions:
+      - version: 3.0.0
+        source: ./postgres
+`
+
+// testCatalogDir writes a catalog directory holding testCatalogIndex and
+// the redis 1.2.0 tarball it lists.
+func testCatalogDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	tgz := tarball(t, packFiles("", "redis", "1.2.0"))
+	sum := sha256.Sum256(tgz)
+	index := strings.Replace(testCatalogIndex, "SUM", hex.EncodeToString(sum[:]), 1)
+	if err := os.WriteFile(filepath.Join(dir, "redis-1.2.0.tgz"), tgz, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, FileCatalogIndex), []byte(index), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func testCatalog(t *testing.T, sources ...*config.CatalogConfig) *Catalog {
+	t.Helper()
+	c, err := NewCatalog(sources, WithCatalogCacheDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func updateCatalog(t *testing.T, c *Catalog) {
+	t.Helper()
+	for _, u := range c.Update(context.Background()) {
+		if u.Err != nil {
+			t.Fatalf("Update() catalog %s error = %v", u.Name, u.Err)
+		}
+	}
+}
+
+func TestCatalog_LocalDirectory(t *testing.T) {
+	dir := testCatalogDir(t)
+	c := testCatalog(t, &config.CatalogConfig{Name: "local", URL: dir})
+
+	if got := c.Unfetched(); !cmp.Equal(got, []string{"local"}) {
+		t.Errorf("Unfetched() before Update = %v", got)
+	}
+	updates := c.Update(context.Background())
+	if len(updates) != 1 || updates[0].Err != nil || updates[0].Packs != 2 || updates[0].Verified != "" {
+		t.Fatalf("Update() = %+v", updates)
+	}
+
+	// Everything else works from the cache.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	packs, err := c.Packs()
+	if err != nil {
+		t.Fatalf("Packs() error = %v", err)
+	}
+	var names []string
+	for _, p := range packs {
+		names = append(names, p.Name+"@"+p.Latest().Version+"/"+p.Catalog)
+	}
+	if want := []string{"postgres@3.0.0/local", "redis@1.2.0/local"}; !cmp.Equal(names, want) {
+		t.Errorf("Packs() = %v, want %v", names, want)
+	}
+
+	redis := packs[1]
+	var versions []string
+	for _, v := range redis.Versions {
+		versions = append(versions, v.Version)
+	}
+	if want := []string{"2.0.0-rc.1", "1.2.0", "1.1.0"}; !cmp.Equal(versions, want) {
+		t.Errorf("redis versions = %v, want %v", versions, want)
+	}
+	if got, want := redis.Versions[1].Source, filepath.Join(dir, "redis-1.2.0.tgz"); got != want {
+		t.Errorf("relative source = %s, want %s", got, want)
+	}
+	if got, want := packs[0].Versions[0].Source, filepath.Join(dir, "postgres"); got != want {
+		t.Errorf("relative source = %s, want %s", got, want)
+	}
+	if got := redis.Versions[0].Source; got != "oci://ghcr.io/acme/redis:2.0.0-rc.1" {
+		t.Errorf("absolute source = %s", got)
+	}
+}
+
+func TestCatalog_Search(t *testing.T) {
+	c := testCatalog(t, &config.CatalogConfig{Name: "local", URL: testCatalogDir(t)})
+	updateCatalog(t, c)
+
+	for term, want := range map[string][]string{
+		"redis":    {"redis"},
+		"DATABASE": {"postgres", "redis"},
+		"sql":      {"postgres"},
+		"in-mem":   {"redis"},
+		"mongo":    nil,
+	} {
+		found, err := c.Search(term)
+		if err != nil {
+			t.Fatalf("Search(%q) error = %v", term, err)
+		}
+		var names []string
+		for _, p := range found {
+			names = append(names, p.Name)
+		}
+		if !cmp.Equal(names, want) {
+			t.Errorf("Search(%q) = %v, want %v", term, names, want)
+		}
+	}
+}
+
+func TestCatalog_Find(t *testing.T) {
+	dir := testCatalogDir(t)
+	c := testCatalog(t, &config.CatalogConfig{Name: "local", URL: filepath.Join(dir, FileCatalogIndex)})
+	updateCatalog(t, c)
+
+	for constraint, want := range map[string]string{
+		"":           "1.2.0",
+		"~1.1":       "1.1.0",
+		"^2.0.0-rc":  "2.0.0-rc.1",
+		"1.2.0 || 3": "1.2.0",
+	} {
+		_, v, err := c.Find("redis", constraint)
+		if err != nil || v.Version != want {
+			t.Errorf("Find(redis, %q) = %v, %v; want %s", constraint, v, err, want)
+		}
+	}
+	for name, wantErr := range map[string]string{
+		"redis@^3": "no catalog version matches; available: 2.0.0-rc.1 (local), 1.2.0 (local), 1.1.0 (local)",
+		"mongo@":   "not in any fetched catalog",
+		"redis@>x": "invalid version constraint",
+	} {
+		name, constraint, _ := strings.Cut(name, "@")
+		if _, _, err := c.Find(name, constraint); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("Find(%s, %q) error = %v, want %q", name, constraint, err, wantErr)
+		}
+	}
+
+	// The version found installs, checked against the catalog's sha256.
+	_, v, _ := c.Find("redis", "")
+	got, err := testInstaller(t).Install(context.Background(), v.Source, InstallOptions{Path: v.Path, SHA256: v.SHA256})
+	if err != nil || got.Version != "1.2.0" {
+		t.Errorf("Install(%s) = %+v, %v", v.Source, got, err)
+	}
+}
+
+func TestCatalog_HTTP(t *testing.T) {
+	index := []byte(testCatalogIndex)
+	sum := sha256.Sum256(index)
+	checksum := hex.EncodeToString(sum[:]) + "  index.yaml\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/good/index.yaml", "/bad/index.yaml", "/bare/index.yaml":
+			w.Write(index)
+		case "/good/index.yaml.sha256":
+			w.Write([]byte(checksum))
+		case "/bad/index.yaml.sha256":
+			w.Write([]byte(strings.Repeat("0", 64)))
+		case "/fail/index.yaml":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := testCatalog(t,
+		&config.CatalogConfig{Name: "good", URL: srv.URL + "/good/index.yaml"},
+		&config.CatalogConfig{Name: "bad", URL: srv.URL + "/bad/index.yaml"},
+		&config.CatalogConfig{Name: "bare", URL: srv.URL + "/bare/index.yaml"},
+		&config.CatalogConfig{Name: "fail", URL: srv.URL + "/fail/index.yaml"},
+		&config.CatalogConfig{Name: "none", URL: srv.URL + "/none/index.yaml"},
+	)
+	updates := c.Update(context.Background())
+	wantErrs := map[string]string{
+		"bad":  "does not match its checksum",
+		"bare": "neither a signature nor a checksum",
+		"fail": "500",
+		"none": "not found",
+	}
+	for _, u := range updates {
+		if want := wantErrs[u.Name]; want == "" {
+			if u.Err != nil || u.Verified != "sha256" || u.Packs != 2 {
+				t.Errorf("Update() %s = %+v", u.Name, u)
+			}
+		} else if u.Err == nil || !strings.Contains(u.Err.Error(), want) {
+			t.Errorf("Update() %s error = %v, want %q", u.Name, u.Err, want)
+		}
+	}
+	if got, want := c.Unfetched(), []string{"bad", "bare", "fail", "none"}; !cmp.Equal(got, want) {
+		t.Errorf("Unfetched() = %v, want %v", got, want)
+	}
+
+	_, v, err := c.Find("redis", "1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := srv.URL + "/good/redis-1.2.0.tgz"; v.Source != want {
+		t.Errorf("relative source = %s, want %s", v.Source, want)
+	}
+}
+
+func TestCatalog_Signature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(pub)
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	otherKey := base64.StdEncoding.EncodeToString(otherPub)
+
+	dir := testCatalogDir(t)
+	index := filepath.Join(dir, FileCatalogIndex)
+	data, err := os.ReadFile(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a signature, a catalog with a key does not update.
+	c := testCatalog(t, &config.CatalogConfig{Name: "signed", URL: dir, PublicKey: key})
+	if u := c.Update(context.Background()); u[0].Err == nil || !strings.Contains(u[0].Err.Error(), "not signed") {
+		t.Errorf("Update() unsigned error = %v", u[0].Err)
+	}
+
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))
+	if err := os.WriteFile(index+".sig", []byte(sig+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if u := c.Update(context.Background()); u[0].Err != nil || u[0].Verified != "signature" {
+		t.Errorf("Update() signed = %+v", u[0])
+	}
+
+	bad := testCatalog(t, &config.CatalogConfig{Name: "signed", URL: dir, PublicKey: otherKey})
+	if u := bad.Update(context.Background()); u[0].Err == nil || !strings.Contains(u[0].Err.Error(), "does not verify") {
+		t.Errorf("Update() with another key error = %v", u[0].Err)
+	}
+
+	// The cached index is checked against the key when read.
+	c.sources[0].PublicKey = otherKey
+	if _, err := c.Packs(); err == nil || !strings.Contains(err.Error(), "run yar fleet update") {
+		t.Errorf("Packs() after key change error = %v", err)
+	}
+
+	// A changed URL leaves the catalog unfetched.
+	c.sources[0].URL = index
+	if packs, err := c.Packs(); err != nil || len(packs) != 0 {
+		t.Errorf("Packs() after URL change = %v, %v", packs, err)
+	}
+}
+
+func TestParseCatalogIndex_Invalid(t *testing.T) {
+	for name, tc := range map[string]struct{ index, wantErr string }{
+		"kind":          {"apiVersion: yar.io/v1\nkind: Pack\n", "not a catalog index"},
+		"yaml":          {"packs: [", "invalid catalog index"},
+		"name":          {"apiVersion: yar.io/v1\nkind: PackCatalog\npacks:\n  - name: Redis\n", "packs[0] has no valid name"},
+		"duplicate":     {"apiVersion: yar.io/v1\nkind: PackCatalog\npacks:\n  - {name: a, versions: [{version: 1.0.0, source: a}]}\n  - {name: a, versions: [{version: 1.0.0, source: a}]}\n", "listed twice"},
+		"no versions":   {"apiVersion: yar.io/v1\nkind: PackCatalog\npacks:\n  - name: a\n", "has no versions"},
+		"version":       {"apiVersion: yar.io/v1\nkind: PackCatalog\npacks:\n  - {name: a, versions: [{version: latest, source: a}]}\n", "not a semantic version"},
+		"same version":  {"apiVersion: yar.io/v1\nkind: PackCatalog\npacks:\n  - {name: a, versions: [{version: 1.0.0, source: a}, {version: 1.0.0, source: b}]}\n", "lists version 1.0.0 twice"},
+		"empty source":  {"apiVersion: yar.io/v1\nkind: PackCatalog\npacks:\n  - {name: a, versions: [{version: 1.0.0}]}\n", "has no source"},
+		"missing field": {"kind: PackCatalog\n", "not a catalog index"},
+	} {
+		if _, err := ParseCatalogIndex([]byte(tc.index), "/catalog/index.yaml"); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: ParseCatalogIndex() error = %v, want %q", name, err, tc.wantErr)
+		}
+	}
+}
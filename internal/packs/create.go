@@ -0,0 +1,141 @@
+package packs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// scaffoldName stands for the pack name in scaffoldFiles.
+const scaffoldName = "__NAME__"
+
+// scaffoldFiles are the files of a new pack: a web service container
+// showing params with schema defaults, defaults.yaml, a range, an
+// optional secret and a readiness probe. yar pack lint passes on it.
+var scaffoldFiles = []struct{ path, content string }{
+	{FileMeta, `name: __NAME__
+version: 0.1.0
+description: __NAME__ service
+tags: [web]
+# maintainer: Platform team <platform@example.com>
+# minYarVersion: 1.0.0
+# Packs to run next to every service using this one, as <service>-<name>:
+# dependencies:
+#   - name: db
+#     pack: postgres
+#     version: ^1
+#     params:
+#       passwordRef: __NAME___db_password
+`},
+	{FileSchema, `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "https://yar.io/packs/__NAME__/schema.json",
+  "type": "object",
+  "properties": {
+    "image": {
+      "type": "string",
+      "description": "Container image",
+      "default": "nginx:1.27-alpine"
+    },
+    "port": {
+      "type": "integer",
+      "description": "Port the container listens on",
+      "default": 80,
+      "minimum": 1,
+      "maximum": 65535
+    },
+    "healthPath": {
+      "type": "string",
+      "description": "HTTP path of the readiness probe",
+      "default": "/"
+    },
+    "env": {
+      "type": "object",
+      "description": "Extra environment variables",
+      "additionalProperties": { "type": "string" }
+    },
+    "apiKeyRef": {
+      "type": "string",
+      "description": "Secret reference for an API key; none if unset"
+    }
+  }
+}
+`},
+	{FileDefaults, `# Values for params yar.yaml does not set. They override the defaults of
+# schema.json and are checked against it.
+env:
+  LOG_LEVEL: info
+`},
+	{filepath.Join(DirTemplates, FileResources), `# Rendered for every service using the pack, with:
+#   .Params       params: schema.json defaults < defaults.yaml < yar.yaml
+#   .Service      .Name, .Namespace, .Pack, .Replicas, .Requires
+#   .Project      .Name
+#   .Environment  .Name, .Target (compose, helm or manifest)
+#   .Dependencies by name in meta.yaml: .Name (the service), .Pack
+# Check it with yar pack lint.
+apiVersion: yar.io/v1
+kind: Pack
+metadata:
+  name: {{ .Service.Name }}
+spec:
+  containers:
+    - name: __NAME__
+      image: {{ .Params.image | quote }}
+      ports:
+        - containerPort: {{ .Params.port }}
+      env:
+        {{- range $name, $value := .Params.env }}
+        - name: {{ $name }}
+          value: {{ $value | quote }}
+        {{- end }}
+        {{- if .Params.apiKeyRef }}
+        - name: API_KEY
+          secretRef: {{ .Params.apiKeyRef | quote }}
+        {{- end }}
+      readinessProbe:
+        httpGet:
+          path: {{ .Params.healthPath }}
+          port: {{ .Params.port }}
+        periodSeconds: 10
+  services:
+    - name: {{ .Service.Name }}
+      port: {{ .Params.port }}
+`},
+}
+
+// Create writes a new pack named name to dir/name, with an example of
+// every pack file. It refuses to write into an existing directory, and
+// writes through log.
+func Create(dir, name string, log *action.Log) (string, error) {
+	if !namePattern.MatchString(name) {
+		return "", &errors.ValidationError{Field: "name", Value: name, Message: "pack name must match pattern ^[a-z][a-z0-9-]*$"}
+	}
+	root, err := filepath.Abs(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(root); err == nil {
+		return "", fmt.Errorf("%s already exists", root)
+	}
+	detail := fmt.Sprintf("%d files in %s", len(scaffoldFiles), root)
+	err = log.Do(action.Action{Kind: action.KindPack, Op: "create", Object: name, Detail: detail}, func() error {
+		for _, f := range scaffoldFiles {
+			path := filepath.Join(root, f.path)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, []byte(strings.ReplaceAll(f.content, scaffoldName, name)), 0o644); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return root, nil
+}
@@ -0,0 +1,48 @@
+package packs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yar-run/yar/internal/action"
+)
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	root, err := Create(dir, "web-api", nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	pack, err := Load(root)
+	if err != nil {
+		t.Fatalf("Load() of the new pack error = %v", err)
+	}
+	if pack.Name() != "web-api" || pack.Version() != "0.1.0" {
+		t.Errorf("Name(), Version() = %s, %s", pack.Name(), pack.Version())
+	}
+	if issues := Lint(root); len(issues) > 0 {
+		t.Errorf("Lint() of the new pack = %v", issues)
+	}
+
+	if _, err := Create(dir, "web-api", nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Create() over an existing pack error = %v", err)
+	}
+	if _, err := Create(dir, "Web", nil); err == nil {
+		t.Error("Create() with an invalid name error = nil")
+	}
+}
+
+func TestCreate_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	log := action.NewLog(true)
+	root, err := Create(dir, "web", log)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := Load(root); err == nil {
+		t.Error("dry run created the pack")
+	}
+	if actions := log.Actions(); len(actions) != 1 || actions[0].Op != "create" {
+		t.Errorf("actions = %+v", actions)
+	}
+}
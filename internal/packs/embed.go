@@ -0,0 +1,12 @@
+package packs
+
+import "embed"
+
+// builtinFS holds the packs built into yar, one directory per pack under
+// builtin/.
+//
+//go:embed builtin
+var builtinFS embed.FS
+
+// builtinDir is the directory of builtinFS holding the packs.
+const builtinDir = "builtin"
@@ -0,0 +1,167 @@
+package packs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxArchiveSize limits the unpacked size of pack archives.
+const maxArchiveSize = 64 << 20
+
+// fetchTarball unpacks a local or http(s) .tgz into dir and returns its
+// digest, checking it against want if set.
+func (i *Installer) fetchTarball(ctx context.Context, location, dir, want string) (string, error) {
+	var r io.ReadCloser
+	if isHTTP(location) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := i.client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return "", fmt.Errorf("GET %s: %s", location, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(location)
+		if err != nil {
+			return "", err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, maxArchiveSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxArchiveSize {
+		return "", fmt.Errorf("archive is larger than %d MiB", maxArchiveSize>>20)
+	}
+	digest := sha256Digest(data)
+	if want != "" && digest != "sha256:"+strings.TrimPrefix(want, "sha256:") {
+		return "", fmt.Errorf("archive digest %s does not match the expected sha256:%s", digest, strings.TrimPrefix(want, "sha256:"))
+	}
+	if err := untar(bytes.NewReader(data), dir); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// untar unpacks the gzipped tar stream r into dir. Only regular files and
+// directories are unpacked; entries that are links or would land outside
+// dir are errors.
+func untar(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("not a gzipped tar archive: %w", err)
+	}
+	defer gz.Close()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "." {
+			continue
+		}
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("archive entry %q is outside the pack", hdr.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			total += hdr.Size
+			if total > maxArchiveSize {
+				return fmt.Errorf("archive unpacks to more than %d MiB", maxArchiveSize>>20)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, io.LimitReader(tr, hdr.Size)); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader, tar.TypeXHeader:
+		default:
+			return fmt.Errorf("archive entry %q: only regular files and directories are allowed in packs", hdr.Name)
+		}
+	}
+}
+
+// fetchGit checks out ref of the repository at url into dir and returns
+// the commit. An empty ref is the default branch. git must be installed.
+func (i *Installer) fetchGit(ctx context.Context, url, ref, dir string) (string, error) {
+	if _, err := i.runGit(ctx, "", "clone", "--quiet", "--no-checkout", "--", url, dir); err != nil {
+		return "", err
+	}
+	if ref != "" {
+		if _, err := i.runGit(ctx, dir, "checkout", "--quiet", "--detach", ref); err != nil {
+			// Branches other than the default one only exist as
+			// remote-tracking branches after a clone.
+			if _, retryErr := i.runGit(ctx, dir, "checkout", "--quiet", "--detach", "origin/"+ref); retryErr != nil {
+				return "", fmt.Errorf("ref %q: %w", ref, err)
+			}
+		}
+	} else if _, err := i.runGit(ctx, dir, "checkout", "--quiet", "--detach"); err != nil {
+		return "", err
+	}
+	commit, err := i.runGit(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return commit, os.RemoveAll(filepath.Join(dir, ".git"))
+}
+
+// runGit runs git in dir and returns its trimmed output. Prompts are
+// disabled, so missing credentials fail instead of hanging.
+func (i *Installer) runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, i.git, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
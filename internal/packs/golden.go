@@ -0,0 +1,395 @@
+package packs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Files of a pack's golden tests: tests/<case>/params.yaml, and the
+// expected output of the case for each target in tests/<case>/<target>.yaml.
+const (
+	DirTests       = "tests"
+	FileTestParams = "params.yaml"
+)
+
+// Golden test statuses.
+const (
+	TestPass    = "pass"
+	TestFail    = "fail"    // output differs from the golden file, or it is missing
+	TestError   = "error"   // params are invalid or rendering failed
+	TestUpdated = "updated" // the golden file was (re)written by an update run
+)
+
+// Identity of golden test renders.
+const (
+	testProject     = "test"
+	testEnvironment = "test"
+)
+
+// goldenHeader starts every golden file.
+const goldenHeader = "# Rendered by yar pack test from params.yaml; rewrite with yar pack test --update.\n"
+
+// TestOptions configures RunTests.
+type TestOptions struct {
+	Update bool        // rewrite golden files that differ or are missing
+	Log    *action.Log // writes of an update run go through it
+}
+
+// TestReport is the result of a pack's golden tests.
+type TestReport struct {
+	Pack    string       `json:"pack" yaml:"pack"`
+	Version string       `json:"version" yaml:"version"`
+	Dir     string       `json:"dir" yaml:"dir"`
+	Results []TestResult `json:"results" yaml:"results"`
+}
+
+// TestResult is the result of one case for one target.
+type TestResult struct {
+	Case     string        `json:"case" yaml:"case"`
+	Target   Target        `json:"target" yaml:"target"`
+	File     string        `json:"file" yaml:"file"` // golden file, relative to the pack directory
+	Status   string        `json:"status" yaml:"status"`
+	Message  string        `json:"message,omitempty" yaml:"message,omitempty"`
+	Diff     string        `json:"diff,omitempty" yaml:"diff,omitempty"` // unified diff, golden file to output
+	Duration time.Duration `json:"duration" yaml:"duration"`
+}
+
+// Count returns the number of results with status.
+func (r *TestReport) Count(status string) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Passed reports whether no result failed or errored.
+func (r *TestReport) Passed() bool {
+	return r.Count(TestFail) == 0 && r.Count(TestError) == 0
+}
+
+// goldenOutput is the content of a golden file: what the pack renders for
+// a target, before generators turn it into compose files, charts or
+// manifests.
+type goldenOutput struct {
+	Resources  *Resources         `yaml:"resources"`
+	Secrets    []SecretBinding    `yaml:"secrets,omitempty"`
+	ConfigMaps []ConfigMapBinding `yaml:"configMapRefs,omitempty"`
+}
+
+// RunTests runs the golden tests of the pack in dir. Each directory
+// under tests/ is a case: the pack is rendered for every target with the
+// case's params.yaml (merged with the pack defaults, see Pack.Params) as
+// the params of a service named after the pack, and the output compared
+// with tests/<case>/<target>.yaml. With Update, differing and missing
+// golden files are rewritten instead of failing. A pack without tests
+// has an empty report.
+func RunTests(dir string, opts TestOptions) (*TestReport, error) {
+	pack, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	report := &TestReport{Pack: pack.Name(), Version: pack.Version(), Dir: dir, Results: []TestResult{}}
+
+	entries, err := os.ReadDir(filepath.Join(dir, DirTests))
+	if os.IsNotExist(err) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cases []string
+	for _, e := range entries {
+		if e.IsDir() {
+			cases = append(cases, e.Name())
+		}
+	}
+	sort.Strings(cases)
+
+	for _, name := range cases {
+		results, err := runCase(pack, dir, name, opts)
+		if err != nil {
+			return nil, err
+		}
+		report.Results = append(report.Results, results...)
+	}
+	return report, nil
+}
+
+// runCase runs the case name of pack in dir for every target.
+func runCase(pack *Pack, dir, name string, opts TestOptions) ([]TestResult, error) {
+	caseDir := filepath.Join(DirTests, name)
+	results := make([]TestResult, len(Targets))
+	for i, target := range Targets {
+		results[i] = TestResult{Case: name, Target: target, File: filepath.ToSlash(filepath.Join(caseDir, string(target)+".yaml"))}
+	}
+	fail := func(status, format string, args ...any) []TestResult {
+		for i := range results {
+			results[i].Status, results[i].Message = status, fmt.Sprintf(format, args...)
+		}
+		return results
+	}
+
+	paramsFile := filepath.ToSlash(filepath.Join(caseDir, FileTestParams))
+	var params map[string]any
+	data, err := os.ReadFile(filepath.Join(dir, paramsFile))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := yaml.Unmarshal(data, &params); err != nil {
+			return fail(TestError, "%s: invalid YAML: %v", paramsFile, err), nil
+		}
+	}
+	params, err = pack.Params("params", params)
+	if err != nil {
+		return fail(TestError, "%s: %v", paramsFile, err), nil
+	}
+
+	for i, target := range Targets {
+		start := time.Now()
+		results[i].Status, results[i].Message, results[i].Diff, err = runTarget(pack, dir, results[i].File, target, params, opts)
+		results[i].Duration = time.Since(start)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// runTarget renders pack for target with params and compares the output
+// with the golden file file, returning the status, message and diff of
+// the result. Errors are failures to read or write the golden file.
+func runTarget(pack *Pack, dir, file string, target Target, params map[string]any, opts TestOptions) (string, string, string, error) {
+	r, err := pack.Render(RenderContext{
+		Project:     testProject,
+		Environment: testEnvironment,
+		Service:     &config.Service{Name: pack.Name(), Pack: pack.Name(), Replicas: 1, Params: params},
+		Target:      target,
+	})
+	if err != nil {
+		return TestError, err.Error(), "", nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString(goldenHeader)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(goldenOutput{Resources: r.Resources, Secrets: r.Secrets, ConfigMaps: r.ConfigMaps}); err != nil {
+		return "", "", "", fmt.Errorf("failed to marshal output: %w", err)
+	}
+	got := buf.String()
+
+	path := filepath.Join(dir, file)
+	want, err := os.ReadFile(path)
+	missing := os.IsNotExist(err)
+	if err != nil && !missing {
+		return "", "", "", err
+	}
+	if !missing && string(want) == got {
+		return TestPass, "", "", nil
+	}
+
+	if !opts.Update {
+		if missing {
+			return TestFail, fmt.Sprintf("%s does not exist; run yar pack test --update to create it", file), "", nil
+		}
+		return TestFail, fmt.Sprintf("output differs from %s", file), unifiedDiff(file, "output", string(want), got), nil
+	}
+	op, detail := "update", fmt.Sprintf("golden file of pack %s", pack.Name())
+	if missing {
+		op = "create"
+	}
+	err = opts.Log.Do(action.Action{Kind: action.KindFile, Op: op, Object: path, Detail: detail}, func() error {
+		return os.WriteFile(path, []byte(got), 0o644)
+	})
+	if err != nil {
+		return "", "", "", err
+	}
+	if opts.Log.DryRun() {
+		return TestUpdated, fmt.Sprintf("would write %s", file), "", nil
+	}
+	return TestUpdated, fmt.Sprintf("wrote %s", file), "", nil
+}
+
+// diffContext is the number of unchanged lines around changes in diffs.
+const diffContext = 3
+
+// unifiedDiff returns a unified diff from want, named from, to got,
+// named to.
+func unifiedDiff(from, to, want, got string) string {
+	a, b := splitLines(want), splitLines(got)
+
+	// Longest common subsequence table, suffixes of a and b.
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Edit script: ' ', '-' or '+' and the line.
+	type edit struct {
+		op   byte
+		line string
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", from, to)
+	for start := 0; start < len(edits); {
+		// Find the next change and the end of its hunk.
+		for start < len(edits) && edits[start].op == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		lo := max(start-diffContext, 0)
+		hi, unchanged := start, 0
+		for hi < len(edits) && unchanged <= 2*diffContext {
+			if edits[hi].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			hi++
+		}
+		hi -= max(unchanged-diffContext, 0)
+
+		aLine, bLine := 1, 1
+		for _, e := range edits[:lo] {
+			if e.op != '+' {
+				aLine++
+			}
+			if e.op != '-' {
+				bLine++
+			}
+		}
+		aLen, bLen := 0, 0
+		for _, e := range edits[lo:hi] {
+			if e.op != '+' {
+				aLen++
+			}
+			if e.op != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", aLine, aLen, bLine, bLen)
+		for _, e := range edits[lo:hi] {
+			fmt.Fprintf(&buf, "%c%s\n", e.op, e.line)
+		}
+		start = hi
+	}
+	return buf.String()
+}
+
+// splitLines splits s into lines without their newlines.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// JUnit returns the report as JUnit XML: a test suite for the pack with a
+// test case per case and target, named <case>/<target>.
+func (r *TestReport) JUnit() ([]byte, error) {
+	type failure struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+	type testCase struct {
+		Name      string   `xml:"name,attr"`
+		ClassName string   `xml:"classname,attr"`
+		Time      string   `xml:"time,attr"`
+		Failure   *failure `xml:"failure,omitempty"`
+		Error     *failure `xml:"error,omitempty"`
+		SystemOut string   `xml:"system-out,omitempty"`
+	}
+	type testSuite struct {
+		XMLName  xml.Name   `xml:"testsuite"`
+		Name     string     `xml:"name,attr"`
+		Tests    int        `xml:"tests,attr"`
+		Failures int        `xml:"failures,attr"`
+		Errors   int        `xml:"errors,attr"`
+		Time     string     `xml:"time,attr"`
+		Cases    []testCase `xml:"testcase"`
+	}
+	type testSuites struct {
+		XMLName  xml.Name    `xml:"testsuites"`
+		Tests    int         `xml:"tests,attr"`
+		Failures int         `xml:"failures,attr"`
+		Errors   int         `xml:"errors,attr"`
+		Time     string      `xml:"time,attr"`
+		Suites   []testSuite `xml:"testsuite"`
+	}
+
+	seconds := func(d time.Duration) string { return fmt.Sprintf("%.3f", d.Seconds()) }
+	suite := testSuite{
+		Name:     fmt.Sprintf("pack/%s", r.Pack),
+		Tests:    len(r.Results),
+		Failures: r.Count(TestFail),
+		Errors:   r.Count(TestError),
+	}
+	var total time.Duration
+	for _, res := range r.Results {
+		total += res.Duration
+		tc := testCase{Name: res.Case + "/" + string(res.Target), ClassName: r.Pack, Time: seconds(res.Duration)}
+		switch res.Status {
+		case TestFail:
+			tc.Failure = &failure{Message: res.Message, Text: res.Diff}
+		case TestError:
+			tc.Error = &failure{Message: res.Message}
+		case TestUpdated:
+			tc.SystemOut = res.Message
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Time = seconds(total)
+
+	data, err := xml.MarshalIndent(testSuites{
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Time:     suite.Time,
+		Suites:   []testSuite{suite},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
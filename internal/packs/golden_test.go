@@ -0,0 +1,198 @@
+package packs
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yar-run/yar/internal/action"
+)
+
+func TestRunTests_Builtin(t *testing.T) {
+	for _, name := range []string{"redis", "postgres", "kafka", "container"} {
+		report, err := RunTests(filepath.Join(builtinDir, name), TestOptions{})
+		if err != nil {
+			t.Fatalf("RunTests(%s) error = %v", name, err)
+		}
+		if len(report.Results) == 0 {
+			t.Errorf("RunTests(%s) has no results", name)
+		}
+		for _, r := range report.Results {
+			if r.Status != TestPass {
+				t.Errorf("%s %s/%s: %s: %s\n%s", name, r.Case, r.Target, r.Status, r.Message, r.Diff)
+			}
+		}
+	}
+}
+
+// goldenPack returns a pack whose image is a param, with a test case.
+func goldenPack(t *testing.T) string {
+	return lintPack(t, "web", map[string]string{
+		"meta.yaml":   "name: web\nversion: 1.0.0\n",
+		"schema.json": `{"type": "object", "properties": {"image": {"type": "string", "default": "nginx"}}}`,
+		"templates/resources.yaml": `apiVersion: yar.io/v1
+kind: Pack
+metadata:
+  name: {{ .Service.Name }}
+spec:
+  containers:
+    - name: web
+      image: {{ .Params.image }}
+`,
+		"tests/custom/params.yaml": "image: caddy\n",
+	})
+}
+
+func statuses(report *TestReport) []string {
+	var s []string
+	for _, r := range report.Results {
+		s = append(s, r.Case+"/"+string(r.Target)+" "+r.Status)
+	}
+	return s
+}
+
+func TestRunTests(t *testing.T) {
+	dir := goldenPack(t)
+	run := func(opts TestOptions) *TestReport {
+		t.Helper()
+		report, err := RunTests(dir, opts)
+		if err != nil {
+			t.Fatalf("RunTests() error = %v", err)
+		}
+		return report
+	}
+
+	report := run(TestOptions{})
+	want := []string{"custom/compose fail", "custom/helm fail", "custom/manifest fail"}
+	if diff := cmp.Diff(want, statuses(report)); diff != "" {
+		t.Errorf("without golden files (-want +got):\n%s", diff)
+	}
+	if msg := report.Results[0].Message; !strings.Contains(msg, "tests/custom/compose.yaml does not exist") {
+		t.Errorf("message = %q", msg)
+	}
+
+	log := action.NewLog(true)
+	run(TestOptions{Update: true, Log: log})
+	if len(log.Actions()) != 3 {
+		t.Errorf("dry run actions = %v, want 3", log.Actions())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tests/custom/compose.yaml")); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote golden files")
+	}
+
+	report = run(TestOptions{Update: true})
+	if report.Count(TestUpdated) != 3 || !report.Passed() {
+		t.Errorf("update = %v", statuses(report))
+	}
+	golden, err := os.ReadFile(filepath.Join(dir, "tests/custom/helm.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(golden), "image: caddy") {
+		t.Errorf("golden file =\n%s", golden)
+	}
+	if report = run(TestOptions{}); report.Count(TestPass) != 3 {
+		t.Errorf("after update = %v", statuses(report))
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "tests/custom/params.yaml"), []byte("image: httpd\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report = run(TestOptions{})
+	if report.Count(TestFail) != 3 {
+		t.Fatalf("after params change = %v", statuses(report))
+	}
+	wantDiff := `--- tests/custom/compose.yaml
++++ output
+@@ -7,4 +7,4 @@
+   spec:
+     containers:
+       - name: web
+-        image: caddy
++        image: httpd
+`
+	if diff := cmp.Diff(wantDiff, report.Results[0].Diff); diff != "" {
+		t.Errorf("diff (-want +got):\n%s", diff)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "tests/custom/params.yaml"), []byte("image: 42\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report = run(TestOptions{Update: true})
+	if report.Count(TestError) != 3 || !strings.Contains(report.Results[0].Message, "params.image") {
+		t.Errorf("invalid params = %v: %s", statuses(report), report.Results[0].Message)
+	}
+}
+
+func TestRunTests_NoTests(t *testing.T) {
+	dir := lintPack(t, "empty", packFiles("", "empty", "1.0.0"))
+	report, err := RunTests(dir, TestOptions{})
+	if err != nil {
+		t.Fatalf("RunTests() error = %v", err)
+	}
+	if len(report.Results) != 0 || !report.Passed() {
+		t.Errorf("RunTests() = %+v", report)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	want := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	got := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	wantDiff := `--- want
++++ got
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -10,3 +10,4 @@
+ j
+ k
+ l
++m
+`
+	if diff := cmp.Diff(wantDiff, unifiedDiff("want", "got", want, got)); diff != "" {
+		t.Errorf("unifiedDiff() (-want +got):\n%s", diff)
+	}
+}
+
+func TestTestReport_JUnit(t *testing.T) {
+	report := &TestReport{Pack: "web", Version: "1.0.0", Results: []TestResult{
+		{Case: "a", Target: TargetCompose, Status: TestPass},
+		{Case: "a", Target: TargetHelm, Status: TestFail, Message: "output differs", Diff: "-x\n+y\n"},
+		{Case: "a", Target: TargetManifest, Status: TestError, Message: "render failed"},
+	}}
+	data, err := report.JUnit()
+	if err != nil {
+		t.Fatalf("JUnit() error = %v", err)
+	}
+	var suites struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Errors   int `xml:"errors,attr"`
+		Suite    struct {
+			Name  string `xml:"name,attr"`
+			Cases []struct {
+				Name    string `xml:"name,attr"`
+				Failure *struct {
+					Message string `xml:"message,attr"`
+					Text    string `xml:",chardata"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("JUnit() is not XML: %v\n%s", err, data)
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || suites.Errors != 1 || suites.Suite.Name != "pack/web" {
+		t.Errorf("JUnit() =\n%s", data)
+	}
+	if c := suites.Suite.Cases[1]; c.Name != "a/helm" || c.Failure == nil || c.Failure.Text != "-x\n+y\n" {
+		t.Errorf("failing case = %+v", c)
+	}
+}
@@ -0,0 +1,540 @@
+package packs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/platform"
+	"gopkg.in/yaml.v3"
+)
+
+// FileInstallLock records the packs installed in a user pack directory.
+const FileInstallLock = "packs.lock"
+
+// Origin is the kind of place a pack is installed from.
+type Origin string
+
+// Install origins.
+const (
+	OriginDir     Origin = "dir"     // a local pack directory
+	OriginTarball Origin = "tarball" // a .tgz or .tar.gz file or http(s) URL
+	OriginGit     Origin = "git"     // a git repository at a tag, branch or commit
+	OriginOCI     Origin = "oci"     // an OCI artifact in a registry
+)
+
+// InstallSource is a parsed pack install source.
+type InstallSource struct {
+	Origin   Origin
+	Location string // path, URL or OCI reference without the oci:// scheme
+	Ref      string // git tag, branch or commit; empty for the default branch
+}
+
+// String returns the source as pack install accepts it.
+func (s InstallSource) String() string {
+	switch s.Origin {
+	case OriginGit:
+		if s.Ref != "" {
+			return "git+" + s.Location + "#" + s.Ref
+		}
+		return "git+" + s.Location
+	case OriginOCI:
+		return "oci://" + s.Location
+	}
+	return s.Location
+}
+
+// ParseInstallSource parses a pack install source:
+//
+//	./packs/redis                          pack directory
+//	redis-1.2.0.tgz, https://host/r.tgz    tarball
+//	git+https://host/packs.git#v1.2.0      git repository at a tag or commit
+//	https://host/packs.git#v1.2.0          (URLs ending in .git need no git+)
+//	oci://ghcr.io/acme/packs/redis:1.2.0   OCI artifact, by tag or @sha256:...
+//
+// Local paths are made absolute.
+func ParseInstallSource(s string) (InstallSource, error) {
+	switch {
+	case strings.HasPrefix(s, "oci://"):
+		ref := strings.TrimPrefix(s, "oci://")
+		if _, err := parseOCIReference(ref); err != nil {
+			return InstallSource{}, err
+		}
+		return InstallSource{Origin: OriginOCI, Location: ref}, nil
+	case strings.HasPrefix(s, "git+"), strings.HasPrefix(s, "git@"), strings.HasSuffix(strings.SplitN(s, "#", 2)[0], ".git"):
+		location, ref, _ := strings.Cut(strings.TrimPrefix(s, "git+"), "#")
+		if location == "" || strings.HasPrefix(location, "-") {
+			return InstallSource{}, &errors.ValidationError{Field: "source", Value: s, Message: "git source needs a repository URL"}
+		}
+		if strings.HasPrefix(ref, "-") {
+			return InstallSource{}, &errors.ValidationError{Field: "source", Value: s, Message: "invalid git ref " + ref}
+		}
+		return InstallSource{Origin: OriginGit, Location: location, Ref: ref}, nil
+	case strings.HasSuffix(s, ".tgz"), strings.HasSuffix(s, ".tar.gz"):
+		if isHTTP(s) {
+			return InstallSource{Origin: OriginTarball, Location: s}, nil
+		}
+		abs, err := filepath.Abs(s)
+		if err != nil {
+			return InstallSource{}, err
+		}
+		return InstallSource{Origin: OriginTarball, Location: abs}, nil
+	}
+	if info, err := os.Stat(s); err == nil && info.IsDir() {
+		abs, err := filepath.Abs(s)
+		if err != nil {
+			return InstallSource{}, err
+		}
+		return InstallSource{Origin: OriginDir, Location: abs}, nil
+	}
+	return InstallSource{}, &errors.ValidationError{
+		Field:   "source",
+		Value:   s,
+		Message: "not a pack directory, .tgz, git URL or oci:// reference",
+	}
+}
+
+func isHTTP(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// InstallLock is the content of packs.lock: where each installed pack came
+// from and the digest of its files.
+type InstallLock struct {
+	Packs map[string]*InstalledPack `yaml:"packs" json:"packs"`
+}
+
+// InstalledPack is a pack recorded in packs.lock.
+type InstalledPack struct {
+	Name        string    `yaml:"-" json:"name"`
+	Version     string    `yaml:"version" json:"version"`
+	Source      string    `yaml:"source" json:"source"`                         // as parsed by ParseInstallSource
+	Path        string    `yaml:"path,omitempty" json:"path,omitempty"`         // pack directory inside the source
+	Resolved    string    `yaml:"resolved,omitempty" json:"resolved,omitempty"` // git commit, OCI manifest digest or tarball digest
+	Digest      string    `yaml:"digest" json:"digest"`                         // see Digest
+	InstalledAt time.Time `yaml:"installedAt" json:"installedAt"`
+}
+
+// Installer installs packs into a user pack directory.
+type Installer struct {
+	dir    string
+	client *http.Client
+	git    string
+	log    *action.Log
+}
+
+// InstallerOption configures an Installer.
+type InstallerOption func(*Installer)
+
+// WithInstallDir sets the directory packs are installed into, by default
+// packs/ in the yar config directory (the registry's user source).
+func WithInstallDir(dir string) InstallerOption {
+	return func(i *Installer) {
+		i.dir = dir
+	}
+}
+
+// WithHTTPClient sets the client for tarball URLs and OCI registries.
+func WithHTTPClient(client *http.Client) InstallerOption {
+	return func(i *Installer) {
+		i.client = client
+	}
+}
+
+// WithInstallLog makes the installer's changes through log, so a dry run
+// fetches and validates packs without installing or removing anything.
+func WithInstallLog(log *action.Log) InstallerOption {
+	return func(i *Installer) {
+		i.log = log
+	}
+}
+
+// NewInstaller creates an installer.
+func NewInstaller(opts ...InstallerOption) (*Installer, error) {
+	i := &Installer{client: http.DefaultClient, git: "git"}
+	for _, opt := range opts {
+		opt(i)
+	}
+	if i.dir == "" {
+		dir, err := platform.ConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		i.dir = filepath.Join(dir, DirPacks)
+	}
+	return i, nil
+}
+
+// Dir returns the directory packs are installed into.
+func (i *Installer) Dir() string {
+	return i.dir
+}
+
+// InstallOptions are options for Install.
+type InstallOptions struct {
+	Path   string // directory of the pack inside the source, for repositories and archives holding several packs
+	SHA256 string // expected sha256 of a tarball, hex
+}
+
+// Install fetches a pack from source (see ParseInstallSource), validates
+// it with the loader and installs it under its name, replacing any
+// installed version. The digest of its files is recorded in packs.lock.
+func (i *Installer) Install(ctx context.Context, source string, opts InstallOptions) (*InstalledPack, error) {
+	src, err := ParseInstallSource(source)
+	if err != nil {
+		return nil, err
+	}
+	if !i.log.DryRun() {
+		if err := os.MkdirAll(i.dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	work, err := os.MkdirTemp(stagingParent(i.dir), ".install-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(work)
+
+	fetched := filepath.Join(work, "src")
+	resolved, err := i.fetch(ctx, src, fetched, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", src, err)
+	}
+	root, err := packRoot(fetched, opts.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", src, err)
+	}
+
+	name, err := metaName(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", src, err)
+	}
+	staged := filepath.Join(work, "pack", name)
+	if err := copyPack(root, staged); err != nil {
+		return nil, fmt.Errorf("%s: %w", src, err)
+	}
+	pack, err := Load(staged)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := Digest(os.DirFS(staged), ".")
+	if err != nil {
+		return nil, err
+	}
+
+	installed := &InstalledPack{
+		Name:        pack.Name(),
+		Version:     pack.Version(),
+		Source:      src.String(),
+		Path:        opts.Path,
+		Resolved:    resolved,
+		Digest:      digest,
+		InstalledAt: time.Now().UTC().Truncate(time.Second),
+	}
+	dest := filepath.Join(i.dir, pack.Name())
+	detail := fmt.Sprintf("%s from %s, %s", pack.Version(), src, digest)
+	err = i.log.Do(action.Action{Kind: action.KindPack, Op: "install", Object: pack.Name(), Detail: detail}, func() error {
+		if err := replaceDir(staged, dest); err != nil {
+			return err
+		}
+		return i.updateLock(func(lock *InstallLock) {
+			lock.Packs[pack.Name()] = installed
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return installed, nil
+}
+
+// Remove deletes installed pack name and its packs.lock entry.
+func (i *Installer) Remove(name string) error {
+	dest := filepath.Join(i.dir, name)
+	if info, err := os.Stat(dest); !namePattern.MatchString(name) || err != nil || !info.IsDir() {
+		return &errors.NotFoundError{Resource: "pack", Name: name, Message: "not installed in " + i.dir}
+	}
+	return i.log.Do(action.Action{Kind: action.KindPack, Op: "remove", Object: name, Detail: dest}, func() error {
+		if err := os.RemoveAll(dest); err != nil {
+			return err
+		}
+		return i.updateLock(func(lock *InstallLock) {
+			delete(lock.Packs, name)
+		})
+	})
+}
+
+// Lock returns packs.lock. A missing file is an empty lock.
+func (i *Installer) Lock() (*InstallLock, error) {
+	return readInstallLock(filepath.Join(i.dir, FileInstallLock))
+}
+
+// updateLock applies fn to packs.lock and writes it back.
+func (i *Installer) updateLock(fn func(*InstallLock)) error {
+	path := filepath.Join(i.dir, FileInstallLock)
+	lock, err := readInstallLock(path)
+	if err != nil {
+		return err
+	}
+	fn(lock)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(lock); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readInstallLock reads a packs.lock file.
+func readInstallLock(path string) (*InstallLock, error) {
+	lock := &InstallLock{Packs: map[string]*InstalledPack{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if stderrors.Is(err, fs.ErrNotExist) {
+			return lock, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, lock); err != nil {
+		return nil, &errors.ConfigError{Path: path, Message: "invalid pack lock file", Err: err}
+	}
+	if lock.Packs == nil {
+		lock.Packs = map[string]*InstalledPack{}
+	}
+	for name, p := range lock.Packs {
+		p.Name = name
+	}
+	return lock, nil
+}
+
+// fetch puts the files of src into dir and returns what src resolved to.
+func (i *Installer) fetch(ctx context.Context, src InstallSource, dir string, opts InstallOptions) (string, error) {
+	switch src.Origin {
+	case OriginDir:
+		return "", copyPack(src.Location, dir)
+	case OriginTarball:
+		return i.fetchTarball(ctx, src.Location, dir, opts.SHA256)
+	case OriginGit:
+		return i.fetchGit(ctx, src.Location, src.Ref, dir)
+	case OriginOCI:
+		return i.fetchOCI(ctx, src.Location, dir)
+	}
+	return "", fmt.Errorf("unknown pack source origin %q", src.Origin)
+}
+
+// stagingParent returns where installs are staged: next to the install
+// directory so the final rename does not cross file systems, or the
+// system temp directory if it does not exist yet (dry runs).
+func stagingParent(dir string) string {
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return dir
+	}
+	return ""
+}
+
+// packRoot returns the pack directory in a fetched tree: sub if set,
+// else the root if it has meta.yaml, else its only directory.
+func packRoot(dir, sub string) (string, error) {
+	if sub != "" {
+		clean := path.Clean("/" + filepath.ToSlash(sub))
+		root := filepath.Join(dir, filepath.FromSlash(clean))
+		if _, err := os.Stat(filepath.Join(root, FileMeta)); err != nil {
+			return "", fmt.Errorf("no %s in %s", FileMeta, sub)
+		}
+		return root, nil
+	}
+	if _, err := os.Stat(filepath.Join(dir, FileMeta)); err == nil {
+		return dir, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var dirs []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			dirs = append(dirs, e.Name())
+		}
+	}
+	if len(dirs) == 1 {
+		if _, err := os.Stat(filepath.Join(dir, dirs[0], FileMeta)); err == nil {
+			return filepath.Join(dir, dirs[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no %s at the top level; use --path to select the pack directory", FileMeta)
+}
+
+// metaName reads the pack name from meta.yaml in dir. The loader checks
+// the rest once the pack is staged under that name.
+func metaName(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, FileMeta))
+	if err != nil {
+		return "", err
+	}
+	var meta struct {
+		Name string `yaml:"name"`
+	}
+	if err := yaml.Unmarshal(data, &meta); err != nil || !namePattern.MatchString(meta.Name) {
+		return "", fmt.Errorf("%s has no valid pack name", FileMeta)
+	}
+	return meta.Name, nil
+}
+
+// copyPack copies the regular files and directories under src to dst,
+// skipping hidden entries such as .git. Symlinks are errors: an installed
+// pack must not reach outside its directory.
+func copyPack(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if rel != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case d.Type().IsRegular():
+			return copyFile(p, target)
+		}
+		return fmt.Errorf("%s: only regular files and directories are allowed in packs", filepath.ToSlash(rel))
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// replaceDir moves src to dst, replacing dst. The previous dst is kept
+// until src is in place, and restored if the move fails.
+func replaceDir(src, dst string) error {
+	old := ""
+	if _, err := os.Stat(dst); err == nil {
+		old = filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".old")
+		os.RemoveAll(old)
+		if err := os.Rename(dst, old); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(src, dst); err != nil {
+		if old != "" {
+			os.Rename(old, dst)
+		}
+		return err
+	}
+	if old != "" {
+		return os.RemoveAll(old)
+	}
+	return nil
+}
+
+// Digest returns the sha256 digest of the files of the pack directory
+// dir of fsys, as "sha256:<hex>". It covers each regular file's path and
+// content, in path order, so it changes when any file is added, removed,
+// renamed or edited. Hidden files are ignored, as they are not installed.
+func Digest(fsys fs.FS, dir string) (string, error) {
+	h := sha256.New()
+	err := fs.WalkDir(fsys, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, dir), "/")
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(h, "%s\x00%s\n", rel, hex.EncodeToString(sum[:]))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyInstalled checks the files of installed pack name in dir against
+// the digest packs.lock records for it. Packs without a lock entry, such
+// as ones copied in by hand, are not checked.
+func verifyInstalled(dir, name string) error {
+	lock, err := readInstallLock(filepath.Join(dir, FileInstallLock))
+	if err != nil {
+		return err
+	}
+	entry, ok := lock.Packs[name]
+	if !ok {
+		return nil
+	}
+	digest, err := Digest(os.DirFS(filepath.Join(dir, name)), ".")
+	if err != nil {
+		return err
+	}
+	if digest != entry.Digest {
+		return &errors.PackError{
+			Pack:    name,
+			File:    FileInstallLock,
+			Message: fmt.Sprintf("installed files do not match the recorded digest %s (got %s); reinstall with: yar pack install %s", entry.Digest, digest, entry.Source),
+		}
+	}
+	return nil
+}
+
+// List returns the recorded packs sorted by name.
+func (l *InstallLock) List() []*InstalledPack {
+	list := make([]*InstalledPack, 0, len(l.Packs))
+	for _, p := range l.Packs {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
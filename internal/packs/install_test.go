@@ -0,0 +1,345 @@
+package packs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// testInstaller returns an installer for a temporary user pack directory.
+func testInstaller(t *testing.T, opts ...InstallerOption) *Installer {
+	t.Helper()
+	i, err := NewInstaller(append([]InstallerOption{WithInstallDir(t.TempDir())}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+// tarball returns a gzipped tar of files, keyed by slash path.
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// packFiles returns the files of a minimal pack under prefix.
+func packFiles(prefix, name, version string) map[string]string {
+	return map[string]string{
+		prefix + "meta.yaml":                "name: " + name + "\nversion: " + version + "\n",
+		prefix + "schema.json":              `{"type": "object"}`,
+		prefix + "templates/resources.yaml": "apiVersion: yar.io/v1\nkind: Pack\n",
+	}
+}
+
+func TestParseInstallSource(t *testing.T) {
+	abs, _ := filepath.Abs("testdata/redis")
+	tgz, _ := filepath.Abs("redis-1.0.0.tgz")
+
+	tests := map[string]InstallSource{
+		"testdata/redis":                    {Origin: OriginDir, Location: abs},
+		"redis-1.0.0.tgz":                   {Origin: OriginTarball, Location: tgz},
+		"https://example.com/redis.tar.gz":  {Origin: OriginTarball, Location: "https://example.com/redis.tar.gz"},
+		"git+https://example.com/packs#v1":  {Origin: OriginGit, Location: "https://example.com/packs", Ref: "v1"},
+		"https://example.com/packs.git":     {Origin: OriginGit, Location: "https://example.com/packs.git"},
+		"git@example.com:acme/packs.git#a1": {Origin: OriginGit, Location: "git@example.com:acme/packs.git", Ref: "a1"},
+		"oci://localhost:5000/packs/redis":  {Origin: OriginOCI, Location: "localhost:5000/packs/redis"},
+	}
+	for s, want := range tests {
+		got, err := ParseInstallSource(s)
+		if err != nil {
+			t.Errorf("ParseInstallSource(%q) error = %v", s, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseInstallSource(%q) = %+v, want %+v", s, got, want)
+		}
+	}
+
+	for _, s := range []string{"redis", "git+#v1", "git+https://example.com/p#--upload-pack=x", "oci://redis", "oci://host/Redis:1"} {
+		if _, err := ParseInstallSource(s); err == nil {
+			t.Errorf("ParseInstallSource(%q) error = nil", s)
+		}
+	}
+}
+
+func TestInstaller_InstallDir(t *testing.T) {
+	i := testInstaller(t)
+	source, _ := filepath.Abs("testdata/redis")
+
+	got, err := i.Install(context.Background(), "testdata/redis", InstallOptions{})
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if got.Name != "redis" || got.Version != "1.2.0" || got.Source != source || !strings.HasPrefix(got.Digest, "sha256:") {
+		t.Errorf("Install() = %+v", got)
+	}
+	want, err := Digest(os.DirFS("testdata/redis"), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Digest != want {
+		t.Errorf("Digest = %s, want the source's %s", got.Digest, want)
+	}
+
+	lock, err := i.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*InstalledPack{got}, lock.List()); diff != "" {
+		t.Errorf("Lock() mismatch (-want +got):\n%s", diff)
+	}
+
+	r, err := NewPackRegistry(WithUserDir(i.Dir()), WithBuiltins(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack, err := r.Resolve("redis")
+	if err != nil || pack.Source != SourceUser {
+		t.Fatalf("Resolve() = %v, %v", pack, err)
+	}
+
+	if err := i.Remove("redis"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(i.Dir(), "redis")); !os.IsNotExist(err) {
+		t.Errorf("pack directory still exists after Remove: %v", err)
+	}
+	if lock, _ := i.Lock(); len(lock.Packs) != 0 {
+		t.Errorf("Lock() after Remove = %v", lock.Packs)
+	}
+	var nf *errors.NotFoundError
+	if err := i.Remove("redis"); !stderrors.As(err, &nf) {
+		t.Errorf("Remove() of a missing pack error = %v, want NotFoundError", err)
+	}
+}
+
+func TestInstaller_DryRun(t *testing.T) {
+	log := action.NewLog(true)
+	i := testInstaller(t, WithInstallLog(log))
+
+	if _, err := i.Install(context.Background(), "testdata/redis", InstallOptions{}); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	entries, err := os.ReadDir(i.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("dry run left %d entries in the install directory", len(entries))
+	}
+	if actions := log.Actions(); len(actions) != 1 || actions[0].Op != "install" || actions[0].Object != "redis" {
+		t.Errorf("Actions() = %+v", actions)
+	}
+}
+
+func TestInstaller_InstallTarball(t *testing.T) {
+	data := tarball(t, packFiles("redis/", "redis", "2.0.0"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/redis-2.0.0.tgz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+	local := filepath.Join(t.TempDir(), "redis-2.0.0.tgz")
+	if err := os.WriteFile(local, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256Digest(data)
+
+	for _, source := range []string{local, srv.URL + "/redis-2.0.0.tgz"} {
+		i := testInstaller(t, WithHTTPClient(srv.Client()))
+		got, err := i.Install(context.Background(), source, InstallOptions{SHA256: strings.TrimPrefix(sum, "sha256:")})
+		if err != nil {
+			t.Fatalf("Install(%s) error = %v", source, err)
+		}
+		if got.Version != "2.0.0" || got.Resolved != sum {
+			t.Errorf("Install(%s) = %+v", source, got)
+		}
+	}
+
+	i := testInstaller(t, WithHTTPClient(srv.Client()))
+	if _, err := i.Install(context.Background(), local, InstallOptions{SHA256: strings.Repeat("0", 64)}); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Install() with a wrong sha256 error = %v", err)
+	}
+	if _, err := i.Install(context.Background(), srv.URL+"/missing.tgz", InstallOptions{}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Install() of a missing URL error = %v", err)
+	}
+}
+
+func TestInstaller_InstallErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, files map[string]string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, tarball(t, files), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	two := packFiles("a/", "a", "1.0.0")
+	for k, v := range packFiles("b/", "b", "1.0.0") {
+		two[k] = v
+	}
+	invalid := packFiles("", "bad", "1.0.0")
+	invalid["schema.json"] = "{"
+
+	tests := map[string]struct {
+		source  string
+		opts    InstallOptions
+		wantErr string
+	}{
+		"traversal":    {write("evil.tgz", map[string]string{"../evil": "x"}), InstallOptions{}, "outside the pack"},
+		"ambiguous":    {write("two.tgz", two), InstallOptions{}, "use --path"},
+		"missing path": {write("two2.tgz", two), InstallOptions{Path: "c"}, "no meta.yaml in c"},
+		"invalid pack": {write("bad.tgz", invalid), InstallOptions{}, "schema.json"},
+		"missing file": {filepath.Join(dir, "none.tgz"), InstallOptions{}, "no such file"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			i := testInstaller(t)
+			_, err := i.Install(context.Background(), tc.source, tc.opts)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Install() error = %v, want %q", err, tc.wantErr)
+			}
+			if lock, _ := i.Lock(); len(lock.Packs) != 0 {
+				t.Errorf("failed install recorded %v", lock.Packs)
+			}
+		})
+	}
+
+	i := testInstaller(t)
+	got, err := i.Install(context.Background(), write("two3.tgz", two), InstallOptions{Path: "b"})
+	if err != nil || got.Name != "b" || got.Path != "b" {
+		t.Errorf("Install() with Path = %+v, %v", got, err)
+	}
+}
+
+// gitRepo creates a git repository with pack "redis" at 1.0.0, tagged
+// v1.0.0, and at 2.0.0 on the default branch. It returns the repository
+// and the commit of v1.0.0.
+func gitRepo(t *testing.T) (string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(version string) {
+		writePack(t, filepath.Join(dir, "packs"), "redis", version)
+		git("add", "-A")
+		git("commit", "--quiet", "-m", version)
+	}
+	git("init", "--quiet")
+	commit("1.0.0")
+	git("tag", "v1.0.0")
+	first := git("rev-parse", "HEAD")
+	commit("2.0.0")
+	return dir, first
+}
+
+func TestInstaller_InstallGit(t *testing.T) {
+	repo, first := gitRepo(t)
+
+	tests := map[string]struct {
+		source      string
+		wantVersion string
+	}{
+		"tag":            {"git+file://" + repo + "#v1.0.0", "1.0.0"},
+		"commit":         {"git+file://" + repo + "#" + first, "1.0.0"},
+		"default branch": {"git+file://" + repo, "2.0.0"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			i := testInstaller(t)
+			got, err := i.Install(context.Background(), tc.source, InstallOptions{Path: "packs/redis"})
+			if err != nil {
+				t.Fatalf("Install() error = %v", err)
+			}
+			if got.Version != tc.wantVersion || len(got.Resolved) != 40 || got.Source != tc.source {
+				t.Errorf("Install() = %+v", got)
+			}
+			if tc.wantVersion == "1.0.0" && got.Resolved != first {
+				t.Errorf("Resolved = %s, want %s", got.Resolved, first)
+			}
+			if _, err := os.Stat(filepath.Join(i.Dir(), "redis", ".git")); !os.IsNotExist(err) {
+				t.Errorf("installed pack has .git: %v", err)
+			}
+		})
+	}
+
+	i := testInstaller(t)
+	if _, err := i.Install(context.Background(), "git+file://"+repo+"#v9", InstallOptions{Path: "packs/redis"}); err == nil || !strings.Contains(err.Error(), `ref "v9"`) {
+		t.Errorf("Install() of a missing ref error = %v", err)
+	}
+}
+
+func TestVerifyInstalled(t *testing.T) {
+	i := testInstaller(t)
+	if _, err := i.Install(context.Background(), "testdata/redis", InstallOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	writePack(t, i.Dir(), "postgres", "1.0.0") // copied in by hand: not checked
+	r, err := NewPackRegistry(WithUserDir(i.Dir()), WithBuiltins(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Resolve("postgres"); err != nil {
+		t.Errorf("Resolve() of an unlocked pack error = %v", err)
+	}
+
+	path := filepath.Join(i.Dir(), "redis", "defaults.yaml")
+	if err := os.WriteFile(path, []byte("maxMemory: 1gb\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Resolve("redis")
+	var perr *errors.PackError
+	if !stderrors.As(err, &perr) || perr.File != FileInstallLock || !strings.Contains(err.Error(), "yar pack install") {
+		t.Errorf("Resolve() of a modified pack error = %v, want PackError", err)
+	}
+}
@@ -0,0 +1,442 @@
+package packs
+
+import (
+	stderrors "errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// Lint severities. Errors make a pack unusable or wrong for some
+// services; warnings are likely mistakes.
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintIssue is a problem Lint found in a pack.
+type LintIssue struct {
+	Severity string `yaml:"severity" json:"severity"`
+	File     string `yaml:"file,omitempty" json:"file,omitempty"` // relative to the pack directory
+	Line     int    `yaml:"line,omitempty" json:"line,omitempty"`
+	Message  string `yaml:"message" json:"message"`
+}
+
+// String formats the issue as file:line: severity: message.
+func (i LintIssue) String() string {
+	switch {
+	case i.File != "" && i.Line > 0:
+		return fmt.Sprintf("%s:%d: %s: %s", i.File, i.Line, i.Severity, i.Message)
+	case i.File != "":
+		return fmt.Sprintf("%s: %s: %s", i.File, i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+}
+
+// schemaTypeNames are the JSON Schema type names.
+var schemaTypeNames = map[string]bool{
+	"string": true, "integer": true, "number": true, "boolean": true,
+	"object": true, "array": true, "null": true,
+}
+
+// Lint checks the pack in dir. Beyond loading it (meta.yaml, schema.json
+// and template compilation, see LoadFS), it checks that schema.json is a
+// usable schema whose defaults, with defaults.yaml, are valid params; that
+// templates reference only declared params and every declared param is
+// used; and that the pack renders for every target with its default
+// params. Required params without a default are given an example value of
+// their type. A pack that does not load has only its load error.
+func Lint(dir string) []LintIssue {
+	pack, err := Load(dir)
+	if err != nil {
+		return []LintIssue{issueOf(err, "")}
+	}
+	l := &linter{pack: pack}
+	l.lintMeta()
+	l.lintSchema("", pack.Schema)
+	l.lintParamRefs()
+	if params := l.lintParams(); params != nil {
+		l.lintRender(params)
+	}
+	return l.issues
+}
+
+// issueOf converts an error to an error issue, prefixing its message.
+func issueOf(err error, prefix string) LintIssue {
+	issue := LintIssue{Severity: LintError, Message: err.Error()}
+	var packErr *errors.PackError
+	if stderrors.As(err, &packErr) {
+		issue.File, issue.Line, issue.Message = packErr.File, packErr.Line, packErr.Message
+		if packErr.Err != nil {
+			issue.Message += ": " + packErr.Err.Error()
+		}
+	}
+	issue.Message = prefix + issue.Message
+	return issue
+}
+
+// linter collects the issues of one pack.
+type linter struct {
+	pack   *Pack
+	issues []LintIssue
+}
+
+func (l *linter) add(severity, file string, line int, format string, args ...any) {
+	l.issues = append(l.issues, LintIssue{Severity: severity, File: file, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// lintMeta checks the meta.yaml fields loading does not require.
+func (l *linter) lintMeta() {
+	if strings.TrimSpace(l.pack.Meta.Description) == "" {
+		l.add(LintWarning, FileMeta, 0, "description is empty; pack list, pack search and catalogs show it")
+	}
+}
+
+// lintSchema checks the schema at path (a JSON pointer below the root)
+// and the schemas it contains.
+func (l *linter) lintSchema(at string, schema map[string]any) {
+	where := func() string {
+		if at == "" {
+			return "schema"
+		}
+		return at
+	}
+	switch t := schema["type"].(type) {
+	case nil:
+	case string:
+		if !schemaTypeNames[t] {
+			l.add(LintError, FileSchema, 0, "%s: unknown type %q", where(), t)
+		}
+	case []any:
+		for _, e := range t {
+			if s, _ := e.(string); !schemaTypeNames[s] {
+				l.add(LintError, FileSchema, 0, "%s: unknown type %v", where(), e)
+			}
+		}
+	default:
+		l.add(LintError, FileSchema, 0, "%s: type must be a string or an array of strings", where())
+	}
+	if ref, ok := schema["$ref"]; ok {
+		if s, _ := ref.(string); lookupPointer(l.pack.Schema, s) == nil {
+			l.add(LintError, FileSchema, 0, "%s: $ref %v does not resolve; only local references such as #/$defs/port are supported", where(), ref)
+		}
+	}
+	if enum, ok := schema["enum"]; ok {
+		if list, _ := enum.([]any); len(list) == 0 {
+			l.add(LintError, FileSchema, 0, "%s: enum must be a non-empty array", where())
+		}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if _, err := regexp.Compile(pattern); err != nil {
+			l.add(LintError, FileSchema, 0, "%s: pattern %q does not compile: %v", where(), pattern, err)
+		}
+	}
+
+	props, hasProps := schema["properties"].(map[string]any)
+	if _, ok := schema["properties"]; ok && !hasProps {
+		l.add(LintError, FileSchema, 0, "%s: properties must be an object", where())
+	}
+	if required, ok := schema["required"]; ok {
+		list, isList := required.([]any)
+		if !isList {
+			l.add(LintError, FileSchema, 0, "%s: required must be an array of property names", where())
+		}
+		for _, r := range list {
+			if name, _ := r.(string); hasProps && props[name] == nil {
+				l.add(LintError, FileSchema, 0, "%s: required property %v is not declared in properties", where(), r)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(props) {
+		sub := at + "/properties/" + name
+		propSchema, ok := props[name].(map[string]any)
+		if !ok {
+			l.add(LintError, FileSchema, 0, "%s must be a schema object", sub)
+			continue
+		}
+		if at == "" {
+			if _, ok := propSchema["description"].(string); !ok {
+				l.add(LintWarning, FileSchema, 0, "parameter %s has no description; parameter errors show it", name)
+			}
+		}
+		if def, ok := propSchema["default"]; ok {
+			v := &paramValidator{root: l.pack.Schema}
+			v.validate(sub+"/default", normalize(def), propSchema)
+			for _, e := range v.errs {
+				l.add(LintError, FileSchema, 0, "%s", e)
+			}
+		}
+		l.lintSchema(sub, propSchema)
+	}
+	for _, key := range []string{"items", "additionalProperties"} {
+		if sub, ok := schema[key].(map[string]any); ok {
+			l.lintSchema(at+"/"+key, sub)
+		}
+	}
+	for _, key := range []string{"$defs", "definitions"} {
+		defs, _ := schema[key].(map[string]any)
+		for _, name := range sortedKeys(defs) {
+			if sub, ok := defs[name].(map[string]any); ok {
+				l.lintSchema(at+"/"+key+"/"+name, sub)
+			}
+		}
+	}
+}
+
+// lintParamRefs checks .Params references in templates against the
+// schema's top-level properties.
+func (l *linter) lintParamRefs() {
+	props, ok := l.pack.Schema["properties"].(map[string]any)
+	if !ok {
+		return // any params
+	}
+	refs, whole := paramRefs(l.pack.Templates)
+
+	open := false
+	switch a := l.pack.Schema["additionalProperties"].(type) {
+	case bool:
+		open = a
+	case map[string]any:
+		open = true
+	}
+	deps := make(map[string]bool, len(l.pack.Meta.Dependencies))
+	for _, dep := range l.pack.Meta.Dependencies {
+		deps[dep.Name] = true
+	}
+	used := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		used[ref.name] = true
+		if props[ref.name] == nil && commonParams[ref.name] == nil && !deps[ref.name] && !open {
+			msg := fmt.Sprintf(".Params.%s is not declared in %s", ref.name, FileSchema)
+			if s := suggest(ref.name, props); s != "" {
+				msg += "; did you mean " + s + "?"
+			}
+			l.add(LintError, ref.file, ref.line, "%s", msg)
+		}
+	}
+	// A template using .Params as a whole may read any of them.
+	if whole {
+		return
+	}
+	for _, name := range sortedKeys(props) {
+		if !used[name] && commonParams[name] == nil {
+			l.add(LintWarning, FileSchema, 0, "parameter %s is not used by any template", name)
+		}
+	}
+}
+
+// lintParams checks the params a service using the pack with no params
+// of its own gets, and returns them, or nil if they are invalid.
+func (l *linter) lintParams() map[string]any {
+	params, err := l.pack.Params("params", l.requiredExamples())
+	if err != nil {
+		var verr *errors.ValidationError
+		if stderrors.As(err, &verr) {
+			for _, e := range verr.Errors {
+				l.add(LintError, "", 0, "default params are invalid: %s", e)
+			}
+			return nil
+		}
+		l.issues = append(l.issues, issueOf(err, "default params: "))
+		return nil
+	}
+	return params
+}
+
+// requiredExamples returns example values for the required top-level
+// params that have no default.
+func (l *linter) requiredExamples() map[string]any {
+	required, _ := l.pack.Schema["required"].([]any)
+	props, _ := l.pack.Schema["properties"].(map[string]any)
+	fileDefaults, _ := normalize(l.pack.Defaults).(map[string]any)
+	defaults := mergeParams(defaultsOf(l.pack.Schema, l.pack.Schema), fileDefaults)
+	v := &paramValidator{root: l.pack.Schema}
+	examples := map[string]any{}
+	for _, r := range required {
+		name, _ := r.(string)
+		if _, ok := defaults[name]; ok || props[name] == nil {
+			continue
+		}
+		examples[name] = exampleValue(v.deref(asSchema(props[name])))
+	}
+	return examples
+}
+
+// exampleValue returns a value of the schema's type: its first example or
+// enum value, or else a placeholder.
+func exampleValue(schema map[string]any) any {
+	if examples, ok := schema["examples"].([]any); ok && len(examples) > 0 {
+		return normalize(examples[0])
+	}
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return normalize(enum[0])
+	}
+	types := schemaTypes(schema)
+	if len(types) == 0 {
+		return "example"
+	}
+	switch types[0] {
+	case "integer", "number":
+		if min, ok := number(schema["minimum"]); ok {
+			return min
+		}
+		return 1
+	case "boolean":
+		return true
+	case "object":
+		return map[string]any{}
+	case "array":
+		return []any{}
+	}
+	return "example"
+}
+
+// lintRender renders the pack for every target with params.
+func (l *linter) lintRender(params map[string]any) {
+	for _, target := range Targets {
+		_, err := l.pack.Render(RenderContext{
+			Project:     "lint",
+			Environment: "lint",
+			Service:     &config.Service{Name: l.pack.Name(), Pack: l.pack.Name(), Replicas: 1, Params: params},
+			Target:      target,
+		})
+		if err != nil {
+			l.issues = append(l.issues, issueOf(err, fmt.Sprintf("rendering for %s with the default params: ", target)))
+		}
+	}
+}
+
+// paramRef is a .Params.<name> reference in a template.
+type paramRef struct {
+	name, file string
+	line       int
+}
+
+// paramRefs returns the top-level params templates reference, as
+// .Params.name, $.Params.name or index .Params "name", and whether any
+// uses .Params as a whole.
+func paramRefs(set *template.Template) ([]paramRef, bool) {
+	var refs []paramRef
+	whole := false
+	for _, t := range set.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+		tree := t.Tree
+		ref := func(name string, node parse.Node) {
+			file, line := t.Name(), 0
+			if loc, _ := tree.ErrorContext(node); loc != "" {
+				parts := strings.Split(loc, ":")
+				if len(parts) >= 3 {
+					file = strings.Join(parts[:len(parts)-2], ":")
+					line, _ = strconv.Atoi(parts[len(parts)-2])
+				}
+			}
+			refs = append(refs, paramRef{name: name, file: path.Join(DirTemplates, file), line: line})
+		}
+		var walk func(parse.Node)
+		walk = func(node parse.Node) {
+			switch n := node.(type) {
+			case *parse.ListNode:
+				if n == nil {
+					return
+				}
+				for _, c := range n.Nodes {
+					walk(c)
+				}
+			case *parse.ActionNode:
+				walk(n.Pipe)
+			case *parse.IfNode:
+				walk(n.Pipe)
+				walk(n.List)
+				walk(n.ElseList)
+			case *parse.RangeNode:
+				walk(n.Pipe)
+				walk(n.List)
+				walk(n.ElseList)
+			case *parse.WithNode:
+				walk(n.Pipe)
+				walk(n.List)
+				walk(n.ElseList)
+			case *parse.TemplateNode:
+				walk(n.Pipe)
+			case *parse.PipeNode:
+				if n == nil {
+					return
+				}
+				for _, c := range n.Cmds {
+					walk(c)
+				}
+			case *parse.CommandNode:
+				args := n.Args
+				// index .Params "name"
+				if len(args) >= 3 {
+					if id, ok := args[0].(*parse.IdentifierNode); ok && id.Ident == "index" && isParams(args[1]) {
+						if s, ok := args[2].(*parse.StringNode); ok {
+							ref(s.Text, s)
+							args = args[3:]
+						}
+					}
+				}
+				for _, a := range args {
+					walk(a)
+				}
+			case *parse.ChainNode:
+				walk(n.Node)
+			case *parse.FieldNode:
+				if len(n.Ident) > 0 && n.Ident[0] == "Params" {
+					if len(n.Ident) > 1 {
+						ref(n.Ident[1], n)
+					} else {
+						whole = true
+					}
+				}
+			case *parse.VariableNode:
+				if len(n.Ident) > 1 && n.Ident[0] == "$" && n.Ident[1] == "Params" {
+					if len(n.Ident) > 2 {
+						ref(n.Ident[2], n)
+					} else {
+						whole = true
+					}
+				}
+			}
+		}
+		walk(tree.Root)
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].file != refs[j].file {
+			return refs[i].file < refs[j].file
+		}
+		return refs[i].line < refs[j].line
+	})
+	return refs, whole
+}
+
+// isParams reports whether node is .Params or $.Params.
+func isParams(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		return len(n.Ident) == 1 && n.Ident[0] == "Params"
+	case *parse.VariableNode:
+		return len(n.Ident) == 2 && n.Ident[0] == "$" && n.Ident[1] == "Params"
+	}
+	return false
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
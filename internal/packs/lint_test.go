@@ -0,0 +1,154 @@
+package packs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// lintPack writes files, keyed by slash path, to a new pack directory
+// name and returns it.
+func lintPack(t *testing.T, name string, files map[string]string) string {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), name)
+	for p, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestLint_Builtin(t *testing.T) {
+	for _, name := range []string{"redis", "postgres", "kafka", "container"} {
+		if issues := Lint(filepath.Join(builtinDir, name)); len(issues) > 0 {
+			t.Errorf("Lint(%s) = %v", name, issues)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	dir := lintPack(t, "web", map[string]string{
+		"meta.yaml": "name: web\nversion: 1.0.0\n",
+		"schema.json": `{
+  "type": "object",
+  "properties": {
+    "image": {"type": "string", "description": "Image", "default": "nginx"},
+    "port": {"type": "integer", "description": "Port", "default": "eighty"},
+    "mode": {"type": "string", "enum": []},
+    "size": {"type": "text", "description": "Size"},
+    "unused": {"type": "string", "description": "Never read"},
+    "token": {"$ref": "#/$defs/missing", "description": "Token"}
+  },
+  "required": ["image", "replicas"]
+}`,
+		"defaults.yaml": "image: 42\n",
+		"templates/resources.yaml": `apiVersion: yar.io/v1
+kind: Pack
+metadata:
+  name: {{ .Service.Name }}
+spec:
+  containers:
+    - name: web
+      image: {{ .Params.imag }}
+      args: [{{ index .Params "mode" | quote }}, {{ $.Params.size | quote }}, {{ .Params.token | quote }}]
+      ports:
+        - containerPort: {{ .Params.port }}
+`,
+	})
+
+	want := []LintIssue{
+		{Severity: LintWarning, File: "meta.yaml", Message: "description is empty; pack list, pack search and catalogs show it"},
+		{Severity: LintError, File: "schema.json", Message: "schema: required property replicas is not declared in properties"},
+		{Severity: LintWarning, File: "schema.json", Message: "parameter mode has no description; parameter errors show it"},
+		{Severity: LintError, File: "schema.json", Message: "/properties/mode: enum must be a non-empty array"},
+		{Severity: LintError, File: "schema.json", Message: "/properties/port/default: must be integer (got \"eighty\") (description: Port)"},
+		{Severity: LintError, File: "schema.json", Message: "/properties/size: unknown type \"text\""},
+		{Severity: LintError, File: "schema.json", Message: "/properties/token: $ref #/$defs/missing does not resolve; only local references such as #/$defs/port are supported"},
+		{Severity: LintError, File: "templates/resources.yaml", Line: 8, Message: ".Params.imag is not declared in schema.json; did you mean image?"},
+		{Severity: LintWarning, File: "schema.json", Message: "parameter image is not used by any template"},
+		{Severity: LintWarning, File: "schema.json", Message: "parameter unused is not used by any template"},
+		{Severity: LintError, Message: "default params are invalid: params.replicas: is required"},
+		{Severity: LintError, Message: "default params are invalid: params.image: must be string (got 42) (description: Image)"},
+		{Severity: LintError, Message: "default params are invalid: params.port: must be integer (got \"eighty\") (description: Port)"},
+	}
+	if diff := cmp.Diff(want, Lint(dir)); diff != "" {
+		t.Errorf("Lint() (-want +got):\n%s", diff)
+	}
+}
+
+func TestLint_Render(t *testing.T) {
+	dir := lintPack(t, "web", map[string]string{
+		"meta.yaml":   "name: web\nversion: 1.0.0\ndescription: Web\n",
+		"schema.json": `{"type": "object", "properties": {"keyRef": {"type": "string", "description": "Key"}}, "required": ["keyRef"]}`,
+		"templates/resources.yaml": `apiVersion: yar.io/v1
+kind: Pack
+metadata:
+  name: {{ .Service.Name }}
+spec:
+  containers:
+    - name: web
+      image: nginx
+      env:
+        - name: KEY
+          secretRef: {{ .Params.keyRef }}
+      {{- if .Environment.Target.Kubernetes }}
+      replicas: 2
+      {{- end }}
+`,
+	})
+
+	issues := Lint(dir)
+	var got []string
+	for _, i := range issues {
+		got = append(got, i.String())
+	}
+	// keyRef is required without a default, so it renders with an example.
+	want := []string{
+		`templates/resources.yaml:12: error: rendering for helm with the default params: invalid YAML: field replicas not found in type packs.Container`,
+		`templates/resources.yaml:12: error: rendering for manifest with the default params: invalid YAML: field replicas not found in type packs.Container`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Lint() (-want +got):\n%s", diff)
+	}
+}
+
+func TestLint_NotLoading(t *testing.T) {
+	dir := lintPack(t, "web", map[string]string{
+		"meta.yaml":                "name: web\nversion: 1.0.0\n",
+		"schema.json":              `{"type": "object"}`,
+		"templates/resources.yaml": "{{ .Params.x \n",
+	})
+	issues := Lint(dir)
+	if len(issues) != 1 || issues[0].File != "templates/resources.yaml" || issues[0].Line != 2 || issues[0].Severity != LintError {
+		t.Errorf("Lint() = %v", issues)
+	}
+}
+
+func TestLint_WholeParams(t *testing.T) {
+	dir := lintPack(t, "web", map[string]string{
+		"meta.yaml":                "name: web\nversion: 1.0.0\ndescription: Web\n",
+		"schema.json":              `{"type": "object", "properties": {"a": {"type": "string", "description": "A"}}}`,
+		"templates/resources.yaml": "apiVersion: yar.io/v1\nkind: Pack\nmetadata:\n  name: web\nspec:\n  containers:\n    - name: web\n      image: nginx\n# {{ toJson .Params }}\n",
+	})
+	if issues := Lint(dir); len(issues) != 0 {
+		t.Errorf("Lint() = %v, want no unused parameter warning", issues)
+	}
+}
+
+func TestLint_Dependencies(t *testing.T) {
+	dir := lintPack(t, "web", map[string]string{
+		"meta.yaml":                "name: web\nversion: 1.0.0\ndescription: Web\ndependencies:\n  - name: db\n    pack: postgres\n",
+		"schema.json":              `{"type": "object", "properties": {}}`,
+		"templates/resources.yaml": "apiVersion: yar.io/v1\nkind: Pack\nmetadata:\n  name: web\nspec:\n  containers:\n    - name: web\n      image: nginx\n      args: [{{ .Dependencies.db.Name | quote }}, {{ .Params.db.database | default \"app\" | quote }}]\n",
+	})
+	if issues := Lint(dir); len(issues) != 0 {
+		t.Errorf("Lint() = %v, want .Params.db declared by the dependency", issues)
+	}
+}
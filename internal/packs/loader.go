@@ -0,0 +1,312 @@
+package packs
+
+import (
+	"bytes"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/yar-run/yar/internal/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	namePattern    = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	versionPattern = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+	// yamlLinePattern finds the line in yaml.v3 error messages.
+	yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	// templateLinePattern finds the file and line in text/template parse
+	// errors: "template: resources.yaml:12: function "x" not defined".
+	templateLinePattern = regexp.MustCompile(`^template: ([^:]+):(\d+):(?:\d+:)? ?(.*)$`)
+)
+
+// ValidVersion reports whether v is a semantic version, such as 1.2.3 or
+// 2.0.0-rc.1.
+func ValidVersion(v string) bool {
+	return versionPattern.MatchString(v)
+}
+
+// Load loads and validates the pack in dir. The pack's name must match
+// the directory's.
+func Load(dir string) (*Pack, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, &errors.PackError{Pack: filepath.Base(dir), Message: "invalid pack directory", Err: err}
+	}
+	pack, err := LoadFS(os.DirFS(filepath.Dir(abs)), filepath.Base(abs))
+	if err != nil {
+		return nil, err
+	}
+	pack.Dir = abs
+	return pack, nil
+}
+
+// LoadFS loads and validates the pack in directory dir of fsys, such as an
+// embedded file system. It enforces INV-PCK-001 and INV-PCK-003: meta.yaml,
+// schema.json and templates/resources.yaml must exist, the name must match
+// the directory, the version must be semantic, and every template must
+// compile. Problems are PackErrors naming the file and, where known, the
+// line.
+func LoadFS(fsys fs.FS, dir string) (*Pack, error) {
+	l := &packLoader{fsys: fsys, dir: dir, name: path.Base(dir)}
+
+	meta, err := l.loadMeta()
+	if err != nil {
+		return nil, err
+	}
+	schema, err := l.loadSchema()
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := l.loadDefaults()
+	if err != nil {
+		return nil, err
+	}
+	templates, err := l.loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	return &Pack{Meta: *meta, Schema: schema, Defaults: defaults, Templates: templates, Dir: dir}, nil
+}
+
+// packLoader reads the files of one pack.
+type packLoader struct {
+	fsys fs.FS
+	dir  string
+	name string // directory name, until meta.yaml confirms it
+}
+
+// errorf creates a PackError for file at line (0 if unknown).
+func (l *packLoader) errorf(file string, line int, err error, format string, args ...any) *errors.PackError {
+	return &errors.PackError{Pack: l.name, File: file, Line: line, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// read returns the content of file, relative to the pack directory.
+// Missing required files are errors; missing optional ones return nil.
+func (l *packLoader) read(file string, required bool) ([]byte, error) {
+	data, err := fs.ReadFile(l.fsys, path.Join(l.dir, file))
+	if err == nil {
+		return data, nil
+	}
+	if stderrors.Is(err, fs.ErrNotExist) {
+		if !required {
+			return nil, nil
+		}
+		if _, statErr := fs.Stat(l.fsys, l.dir); statErr != nil {
+			return nil, &errors.NotFoundError{Resource: "pack", Name: l.name, Message: "pack directory not found"}
+		}
+		return nil, l.errorf(file, 0, nil, "required file is missing")
+	}
+	return nil, l.errorf(file, 0, err, "failed to read file")
+}
+
+// loadMeta reads and validates meta.yaml.
+func (l *packLoader) loadMeta() (*PackMeta, error) {
+	data, err := l.read(FileMeta, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta PackMeta
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&meta); err != nil {
+		return nil, l.yamlError(FileMeta, err)
+	}
+	var doc yaml.Node
+	_ = yaml.Unmarshal(data, &doc)
+
+	switch {
+	case meta.Name == "":
+		return nil, l.errorf(FileMeta, 1, nil, "name is required")
+	case !namePattern.MatchString(meta.Name):
+		return nil, l.errorf(FileMeta, keyLine(&doc, "name"), nil, "name must match pattern ^[a-z][a-z0-9-]*$ (got %q)", meta.Name)
+	case meta.Name != l.name:
+		return nil, l.errorf(FileMeta, keyLine(&doc, "name"), nil, "name %q does not match directory %q", meta.Name, l.name)
+	case meta.Version == "":
+		return nil, l.errorf(FileMeta, 1, nil, "version is required")
+	case !ValidVersion(meta.Version):
+		return nil, l.errorf(FileMeta, keyLine(&doc, "version"), nil, "version must be a semantic version such as 1.2.3 (got %q)", meta.Version)
+	case meta.MinYarVersion != "" && !ValidVersion(strings.TrimPrefix(meta.MinYarVersion, "v")):
+		return nil, l.errorf(FileMeta, keyLine(&doc, "minYarVersion"), nil, "minYarVersion must be a semantic version such as 1.2.3 (got %q)", meta.MinYarVersion)
+	}
+	if err := l.checkDependencies(&meta, keyLine(&doc, "dependencies")); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// checkDependencies validates the dependencies of meta, defaulting their
+// names, reporting problems at line.
+func (l *packLoader) checkDependencies(meta *PackMeta, line int) error {
+	names := map[string]bool{}
+	for i := range meta.Dependencies {
+		dep := &meta.Dependencies[i]
+		if dep.Name == "" {
+			dep.Name = dep.Pack
+		}
+		switch {
+		case dep.Pack == "":
+			return l.errorf(FileMeta, line, nil, "dependencies[%d].pack is required", i)
+		case !namePattern.MatchString(dep.Pack):
+			return l.errorf(FileMeta, line, nil, "dependencies[%d].pack must match pattern ^[a-z][a-z0-9-]*$ (got %q)", i, dep.Pack)
+		case !namePattern.MatchString(dep.Name):
+			return l.errorf(FileMeta, line, nil, "dependencies[%d].name must match pattern ^[a-z][a-z0-9-]*$ (got %q)", i, dep.Name)
+		case names[dep.Name]:
+			return l.errorf(FileMeta, line, nil, "dependencies[%d].name %q is used by another dependency", i, dep.Name)
+		case commonParams[dep.Name] != nil:
+			return l.errorf(FileMeta, line, nil, "dependencies[%d].name %q is reserved for the params yar reads", i, dep.Name)
+		}
+		if dep.Version != "" {
+			if _, err := ParseConstraint(dep.Version); err != nil {
+				return l.errorf(FileMeta, line, nil, "dependencies[%d].version: %v", i, err)
+			}
+		}
+		names[dep.Name] = true
+	}
+	return nil
+}
+
+// loadSchema reads schema.json, which must be a JSON object describing an
+// object.
+func (l *packLoader) loadSchema() (map[string]any, error) {
+	data, err := l.read(FileSchema, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case stderrors.As(err, &syntaxErr):
+			return nil, l.errorf(FileSchema, offsetLine(data, syntaxErr.Offset), nil, "invalid JSON: %v", err)
+		case stderrors.As(err, &typeErr):
+			return nil, l.errorf(FileSchema, 1, nil, "schema must be a JSON object")
+		}
+		return nil, l.errorf(FileSchema, 0, err, "invalid JSON")
+	}
+	if schema == nil {
+		return nil, l.errorf(FileSchema, 1, nil, "schema must be a JSON object")
+	}
+	if t, ok := schema["type"]; ok && t != "object" {
+		return nil, l.errorf(FileSchema, 0, nil, `parameter schema must have type "object" (got %v)`, t)
+	}
+	return schema, nil
+}
+
+// loadDefaults reads the optional defaults.yaml, which must be a mapping.
+func (l *packLoader) loadDefaults() (map[string]any, error) {
+	data, err := l.read(FileDefaults, false)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var defaults map[string]any
+	if err := yaml.Unmarshal(data, &defaults); err != nil {
+		var typeErr *yaml.TypeError
+		if stderrors.As(err, &typeErr) {
+			return nil, l.errorf(FileDefaults, 1, nil, "defaults must be a mapping of parameter names to values")
+		}
+		return nil, l.yamlError(FileDefaults, err)
+	}
+	return defaults, nil
+}
+
+// loadTemplates compiles every file under templates/ into one template
+// set, naming each by its path below templates/ so templates can include
+// each other. resources.yaml is required.
+func (l *packLoader) loadTemplates() (*template.Template, error) {
+	resources := path.Join(DirTemplates, FileResources)
+	if _, err := l.read(resources, true); err != nil {
+		return nil, err
+	}
+
+	root := path.Join(l.dir, DirTemplates)
+	// The unnamed root only holds the set: a root sharing a file's name
+	// would shadow that file in clones.
+	set := template.New("").Funcs(parseFuncs()).Option("missingkey=zero")
+	err := fs.WalkDir(l.fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := strings.TrimPrefix(p, root+"/")
+		file := path.Join(DirTemplates, name)
+		data, err := fs.ReadFile(l.fsys, p)
+		if err != nil {
+			return l.errorf(file, 0, err, "failed to read file")
+		}
+		if _, err := set.New(name).Parse(string(data)); err != nil {
+			return l.templateError(file, err)
+		}
+		return nil
+	})
+	if err != nil {
+		var packErr *errors.PackError
+		if stderrors.As(err, &packErr) {
+			return nil, err
+		}
+		return nil, l.errorf(DirTemplates, 0, err, "failed to read templates")
+	}
+	return set, nil
+}
+
+// yamlError converts a yaml.v3 error in file into a PackError with its line.
+func (l *packLoader) yamlError(file string, err error) error {
+	msg := err.Error()
+	var typeErr *yaml.TypeError
+	if stderrors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		msg = typeErr.Errors[0]
+	}
+	if m := yamlLinePattern.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return l.errorf(file, line, nil, "invalid YAML: %s", m[2])
+	}
+	return l.errorf(file, 0, err, "invalid YAML")
+}
+
+// templateError converts a template parse error in file into a PackError
+// with its line.
+func (l *packLoader) templateError(file string, err error) error {
+	if m := templateLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		return l.errorf(file, line, nil, "template does not compile: %s", m[3])
+	}
+	return l.errorf(file, 0, err, "template does not compile")
+}
+
+// keyLine returns the line of key in the YAML mapping doc, or 1.
+func keyLine(doc *yaml.Node, key string) int {
+	node := doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i].Line
+			}
+		}
+	}
+	return 1
+}
+
+// offsetLine returns the line of byte offset in data.
+func offsetLine(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,137 @@
+package packs
+
+import (
+	stderrors "errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// validPack returns the files of a minimal valid pack named name.
+func validPack(name string) fstest.MapFS {
+	return fstest.MapFS{
+		name + "/meta.yaml":                {Data: []byte("name: " + name + "\nversion: 1.0.0\n")},
+		name + "/schema.json":              {Data: []byte(`{"type": "object"}`)},
+		name + "/templates/resources.yaml": {Data: []byte("apiVersion: yar.io/v1\nkind: Pack\n")},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	pack, err := Load("testdata/redis")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if pack.Name() != "redis" || pack.Version() != "1.2.0" {
+		t.Errorf("Name(), Version() = %q, %q", pack.Name(), pack.Version())
+	}
+	if pack.Meta.Description != "Redis in-memory data store" || len(pack.Meta.Tags) != 2 || pack.Meta.MinYarVersion != "0.1.0" {
+		t.Errorf("Meta = %+v", pack.Meta)
+	}
+	if abs, _ := filepath.Abs("testdata/redis"); pack.Dir != abs {
+		t.Errorf("Dir = %q, want %q", pack.Dir, abs)
+	}
+	if props, ok := pack.Schema["properties"].(map[string]any); !ok || props["port"] == nil {
+		t.Errorf("Schema = %v", pack.Schema)
+	}
+	if pack.Defaults["maxMemory"] != "256mb" {
+		t.Errorf("Defaults = %v", pack.Defaults)
+	}
+	for _, name := range []string{FileResources, "files/redis.conf"} {
+		if pack.Templates.Lookup(name) == nil {
+			t.Errorf("template %q not loaded", name)
+		}
+	}
+}
+
+func TestLoadFS_Minimal(t *testing.T) {
+	pack, err := LoadFS(validPack("cache"), "cache")
+	if err != nil {
+		t.Fatalf("LoadFS() error = %v", err)
+	}
+	if pack.Name() != "cache" || pack.Defaults != nil || pack.Dir != "cache" {
+		t.Errorf("pack = %+v", pack)
+	}
+}
+
+func TestLoadFS_NotFound(t *testing.T) {
+	_, err := LoadFS(validPack("cache"), "missing")
+	var nf *errors.NotFoundError
+	if !stderrors.As(err, &nf) || nf.Resource != "pack" || nf.Name != "missing" {
+		t.Errorf("LoadFS() error = %v, want pack NotFoundError", err)
+	}
+}
+
+func TestLoadFS_Errors(t *testing.T) {
+	tests := map[string]struct {
+		file     string // file to replace, or remove if data is nil
+		data     string
+		remove   bool
+		wantFile string
+		wantLine int
+		wantMsg  string
+	}{
+		"missing meta":             {file: "meta.yaml", remove: true, wantFile: "meta.yaml", wantMsg: "required file is missing"},
+		"missing schema":           {file: "schema.json", remove: true, wantFile: "schema.json", wantMsg: "required file is missing"},
+		"missing resources":        {file: "templates/resources.yaml", remove: true, wantFile: "templates/resources.yaml", wantMsg: "required file is missing"},
+		"meta syntax":              {file: "meta.yaml", data: "name: cache\nversion: 1.0.0\n  bad: x\n", wantFile: "meta.yaml", wantLine: 3, wantMsg: "invalid YAML"},
+		"meta unknown field":       {file: "meta.yaml", data: "name: cache\nversion: 1.0.0\nverison: 1.0.1\n", wantFile: "meta.yaml", wantLine: 3, wantMsg: "field verison not found"},
+		"name missing":             {file: "meta.yaml", data: "version: 1.0.0\n", wantFile: "meta.yaml", wantLine: 1, wantMsg: "name is required"},
+		"name mismatch":            {file: "meta.yaml", data: "# cache pack\nname: redis\nversion: 1.0.0\n", wantFile: "meta.yaml", wantLine: 2, wantMsg: `name "redis" does not match directory "cache"`},
+		"name pattern":             {file: "meta.yaml", data: "name: Cache\nversion: 1.0.0\n", wantFile: "meta.yaml", wantLine: 1, wantMsg: "must match pattern"},
+		"version missing":          {file: "meta.yaml", data: "name: cache\n", wantFile: "meta.yaml", wantLine: 1, wantMsg: "version is required"},
+		"version not semver":       {file: "meta.yaml", data: "name: cache\nversion: \"1.0\"\n", wantFile: "meta.yaml", wantLine: 2, wantMsg: "semantic version"},
+		"minYarVersion":            {file: "meta.yaml", data: "name: cache\nversion: 1.0.0\nminYarVersion: latest\n", wantFile: "meta.yaml", wantLine: 3, wantMsg: "minYarVersion must be"},
+		"dependency pack missing":  {file: "meta.yaml", data: "name: cache\nversion: 1.0.0\ndependencies:\n  - name: db\n", wantFile: "meta.yaml", wantLine: 3, wantMsg: "dependencies[0].pack is required"},
+		"dependency name twice":    {file: "meta.yaml", data: "name: cache\nversion: 1.0.0\ndependencies:\n  - pack: redis\n  - pack: redis\n", wantFile: "meta.yaml", wantLine: 3, wantMsg: `dependencies[1].name "redis" is used by another dependency`},
+		"dependency name reserved": {file: "meta.yaml", data: "name: cache\nversion: 1.0.0\ndependencies:\n  - {name: ports, pack: redis}\n", wantFile: "meta.yaml", wantLine: 3, wantMsg: "reserved"},
+		"dependency version":       {file: "meta.yaml", data: "name: cache\nversion: 1.0.0\ndependencies:\n  - {pack: redis, version: latest}\n", wantFile: "meta.yaml", wantLine: 3, wantMsg: "dependencies[0].version"},
+		"schema syntax":            {file: "schema.json", data: "{\n  \"type\": \"object\",\n}\n", wantFile: "schema.json", wantLine: 3, wantMsg: "invalid JSON"},
+		"schema not object":        {file: "schema.json", data: "[]", wantFile: "schema.json", wantLine: 1, wantMsg: "must be a JSON object"},
+		"schema type":              {file: "schema.json", data: `{"type": "string"}`, wantFile: "schema.json", wantMsg: `must have type "object"`},
+		"defaults not mapping":     {file: "defaults.yaml", data: "- a\n- b\n", wantFile: "defaults.yaml", wantLine: 1, wantMsg: "must be a mapping"},
+		"defaults syntax":          {file: "defaults.yaml", data: "port: 1\n  bad: [\n", wantFile: "defaults.yaml", wantLine: 2, wantMsg: "invalid YAML"},
+		"template syntax":          {file: "templates/resources.yaml", data: "kind: Pack\nimage: {{ .Params.image }\n", wantFile: "templates/resources.yaml", wantLine: 2, wantMsg: "template does not compile"},
+		"template unknown func":    {file: "templates/resources.yaml", data: "kind: Pack\n\nimage: {{ toUpper .Params.image }}\n", wantFile: "templates/resources.yaml", wantLine: 3, wantMsg: `function "toUpper" not defined`},
+		"nested template invalid":  {file: "templates/files/app.conf", data: "{{ if .Params.debug }}debug", wantFile: "templates/files/app.conf", wantLine: 1, wantMsg: "template does not compile"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fsys := validPack("cache")
+			if tc.remove {
+				delete(fsys, "cache/"+tc.file)
+			} else {
+				fsys["cache/"+tc.file] = &fstest.MapFile{Data: []byte(tc.data)}
+			}
+
+			_, err := LoadFS(fsys, "cache")
+			var perr *errors.PackError
+			if !stderrors.As(err, &perr) {
+				t.Fatalf("LoadFS() error = %v, want PackError", err)
+			}
+			if perr.Pack != "cache" || perr.File != tc.wantFile || perr.Line != tc.wantLine {
+				t.Errorf("PackError at %s %s:%d, want cache %s:%d (%v)", perr.Pack, perr.File, perr.Line, tc.wantFile, tc.wantLine, err)
+			}
+			if !strings.Contains(err.Error(), tc.wantMsg) {
+				t.Errorf("LoadFS() error = %v, want %q", err, tc.wantMsg)
+			}
+		})
+	}
+}
+
+func TestValidVersion(t *testing.T) {
+	for _, v := range []string{"0.1.0", "1.2.3", "10.0.0-rc.1", "1.0.0+build.5"} {
+		if !ValidVersion(v) {
+			t.Errorf("ValidVersion(%q) = false", v)
+		}
+	}
+	for _, v := range []string{"", "1", "1.2", "v1.2.3", "01.2.3", "1.2.3.4", "latest"} {
+		if ValidVersion(v) {
+			t.Errorf("ValidVersion(%q) = true", v)
+		}
+	}
+}
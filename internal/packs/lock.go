@@ -0,0 +1,132 @@
+package packs
+
+import (
+	"bytes"
+	stderrors "errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// FileProjectLock records, next to yar.yaml, the pack version each
+// service runs.
+const FileProjectLock = "yar.lock"
+
+// projectLockHeader starts every yar.lock yar writes.
+const projectLockHeader = "# Pack versions of the services of yar.yaml, written by yar.\n# Commit this file so everyone runs the same packs.\n"
+
+// ProjectLock is the content of yar.lock.
+type ProjectLock struct {
+	Services map[string]*LockedPack `yaml:"services" json:"services"`
+}
+
+// LockedPack is the pack version yar.lock records for a service.
+type LockedPack struct {
+	Pack    string `yaml:"pack" json:"pack"`
+	Version string `yaml:"version" json:"version"`
+	Source  Source `yaml:"source" json:"source"` // where it was found when recorded
+}
+
+// ReadProjectLock reads yar.lock in the project directory dir. A missing
+// file is an empty lock.
+func ReadProjectLock(dir string) (*ProjectLock, error) {
+	lock := &ProjectLock{Services: map[string]*LockedPack{}}
+	path := filepath.Join(dir, FileProjectLock)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if stderrors.Is(err, fs.ErrNotExist) {
+			return lock, nil
+		}
+		return nil, &errors.ConfigError{Path: path, Message: "failed to read project lock", Err: err}
+	}
+	if err := yaml.Unmarshal(data, lock); err != nil {
+		return nil, &errors.ConfigError{Path: path, Message: "invalid project lock", Err: err}
+	}
+	if lock.Services == nil {
+		lock.Services = map[string]*LockedPack{}
+	}
+	return lock, nil
+}
+
+// Locked returns the entry of svc if it is for svc's pack, or nil.
+func (l *ProjectLock) Locked(svc *config.Service) *LockedPack {
+	return l.lookup(svc.Name, svc.Pack)
+}
+
+// lookup returns the entry of service if it is for pack.
+func (l *ProjectLock) lookup(service, pack string) *LockedPack {
+	if l == nil {
+		return nil
+	}
+	if e := l.Services[service]; e != nil && e.Pack == pack && ValidVersion(e.Version) {
+		return e
+	}
+	return nil
+}
+
+// record sets the entry of service to pack.
+func (l *ProjectLock) record(service string, pack *Pack) {
+	if l == nil {
+		return
+	}
+	l.Services[service] = &LockedPack{Pack: pack.Name(), Version: pack.Version(), Source: pack.Source}
+}
+
+// ProjectLock returns the project's lock, with the choices ResolveService
+// has made so far; nil without a project directory.
+func (r *PackRegistry) ProjectLock() *ProjectLock {
+	return r.lock
+}
+
+// WriteProjectLock saves the pack versions ResolveService chose to
+// yar.lock next to yar.yaml, dropping entries of services not in
+// services. It writes through log, and only if the content changed.
+func (r *PackRegistry) WriteProjectLock(services []*config.Service, log *action.Log) error {
+	if r.lock == nil {
+		return nil
+	}
+	keep := make(map[string]bool, len(services))
+	for _, svc := range services {
+		keep[svc.Name] = true
+	}
+	for name := range r.lock.Services {
+		if !keep[name] {
+			delete(r.lock.Services, name)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(projectLockHeader)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(r.lock); err != nil {
+		return err
+	}
+	path := filepath.Join(r.projectDir, FileProjectLock)
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, buf.Bytes()) {
+		return nil
+	}
+	return log.Do(action.Action{Kind: action.KindFile, Op: "write", Object: path, Detail: "pack versions"}, func() error {
+		tmp, err := os.CreateTemp(r.projectDir, "."+FileProjectLock+".tmp-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := tmp.Write(buf.Bytes()); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+			return err
+		}
+		return os.Rename(tmp.Name(), path)
+	})
+}
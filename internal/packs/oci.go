@@ -0,0 +1,275 @@
+package packs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Media types of pack artifacts. A pack artifact's layer is the pack
+// directory as a gzipped tar, like the tarballs pack install accepts.
+const (
+	MediaTypePackConfig = "application/vnd.yar.pack.config.v1+json"
+	MediaTypePackLayer  = "application/vnd.yar.pack.layer.v1.tar+gzip"
+	mediaTypeManifest   = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// maxManifestSize limits OCI manifests.
+const maxManifestSize = 4 << 20
+
+// ociReference is a parsed oci:// reference.
+type ociReference struct {
+	Host       string
+	Repository string
+	Tag        string // set unless Digest is
+	Digest     string // sha256:<hex>
+}
+
+var (
+	ociRepositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?:/[a-z0-9]+(?:[._-][a-z0-9]+)*)*$`)
+	ociTagPattern        = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	ociDigestPattern     = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// parseOCIReference parses host[:port]/repository(:tag|@sha256:digest),
+// without the oci:// scheme. The tag defaults to latest.
+func parseOCIReference(s string) (ociReference, error) {
+	invalid := func(msg string) (ociReference, error) {
+		return ociReference{}, fmt.Errorf("invalid OCI reference %q: %s", s, msg)
+	}
+	host, rest, ok := strings.Cut(s, "/")
+	if !ok || host == "" || rest == "" {
+		return invalid("want oci://host/repository:tag")
+	}
+	ref := ociReference{Host: host}
+	if repo, digest, ok := strings.Cut(rest, "@"); ok {
+		if !ociDigestPattern.MatchString(digest) {
+			return invalid("digest must be sha256:<64 hex digits>")
+		}
+		ref.Repository, ref.Digest = repo, digest
+	} else if i := strings.LastIndex(rest, ":"); i >= 0 {
+		ref.Repository, ref.Tag = rest[:i], rest[i+1:]
+		if !ociTagPattern.MatchString(ref.Tag) {
+			return invalid("invalid tag")
+		}
+	} else {
+		ref.Repository, ref.Tag = rest, "latest"
+	}
+	if !ociRepositoryPattern.MatchString(ref.Repository) {
+		return invalid("invalid repository name")
+	}
+	return ref, nil
+}
+
+// reference returns the tag or digest to request.
+func (r ociReference) reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// baseURL returns the registry's API base. Registries on loopback
+// addresses are spoken to over plain HTTP, as docker does.
+func (r ociReference) baseURL() string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return "http://" + r.Host
+	}
+	return "https://" + r.Host
+}
+
+// ociManifest is the part of an OCI image manifest pack installs read.
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// fetchOCI unpacks the pack layer of the artifact at ref into dir and
+// returns the manifest digest. Blobs are verified against their digests,
+// and the manifest against the reference's digest if it has one.
+func (i *Installer) fetchOCI(ctx context.Context, reference, dir string) (string, error) {
+	ref, err := parseOCIReference(reference)
+	if err != nil {
+		return "", err
+	}
+	reg := &ociRegistry{client: i.client, ref: ref}
+
+	data, err := reg.get(ctx, "manifests/"+ref.reference(), mediaTypeManifest, maxManifestSize)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256Digest(data)
+	if ref.Digest != "" && digest != ref.Digest {
+		return "", fmt.Errorf("manifest digest %s does not match %s", digest, ref.Digest)
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", fmt.Errorf("invalid manifest: %w", err)
+	}
+	layer, err := packLayer(manifest)
+	if err != nil {
+		return "", err
+	}
+
+	blob, err := reg.get(ctx, "blobs/"+layer.Digest, "", maxArchiveSize)
+	if err != nil {
+		return "", err
+	}
+	if got := sha256Digest(blob); got != layer.Digest {
+		return "", fmt.Errorf("layer digest %s does not match %s", got, layer.Digest)
+	}
+	if err := untar(bytes.NewReader(blob), dir); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// packLayer returns the pack layer of a manifest: the layer with the pack
+// media type, or the only gzipped tar layer.
+func packLayer(m ociManifest) (ociDescriptor, error) {
+	var tars []ociDescriptor
+	for _, l := range m.Layers {
+		if l.MediaType == MediaTypePackLayer {
+			return l, nil
+		}
+		if strings.HasSuffix(l.MediaType, "tar+gzip") {
+			tars = append(tars, l)
+		}
+	}
+	if len(tars) == 1 {
+		return tars[0], nil
+	}
+	return ociDescriptor{}, fmt.Errorf("artifact has no %s layer", MediaTypePackLayer)
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ociRegistry reads from one repository of an OCI distribution registry,
+// getting an anonymous bearer token when the registry asks for one.
+type ociRegistry struct {
+	client *http.Client
+	ref    ociReference
+	token  string
+}
+
+// get returns the content at path below the repository's API URL.
+func (r *ociRegistry) get(ctx context.Context, path, accept string, limit int64) ([]byte, error) {
+	u := r.ref.baseURL() + "/v2/" + r.ref.Repository + "/" + path
+	resp, err := r.do(ctx, u, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && r.token == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if r.token, err = r.fetchToken(ctx, challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = r.do(ctx, u, accept); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("GET %s: response larger than %d bytes", u, limit)
+	}
+	return data, nil
+}
+
+func (r *ociRegistry) do(ctx context.Context, u, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	return r.client.Do(req)
+}
+
+// challengePattern matches the parameters of a Bearer challenge.
+var challengePattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// fetchToken gets an anonymous pull token as a Bearer challenge asks.
+func (r *ociRegistry) fetchToken(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("registry %s requires authentication, which pack install does not support", r.ref.Host)
+	}
+	values := map[string]string{}
+	for _, m := range challengePattern.FindAllStringSubmatch(params, -1) {
+		values[m[1]] = m[2]
+	}
+	if values["realm"] == "" {
+		return "", fmt.Errorf("registry %s sent a Bearer challenge without realm", r.ref.Host)
+	}
+	q := url.Values{}
+	if s := values["service"]; s != "" {
+		q.Set("service", s)
+	}
+	scope := values["scope"]
+	if scope == "" {
+		scope = "repository:" + r.ref.Repository + ":pull"
+	}
+	q.Set("scope", scope)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, values["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry %s token: %s", r.ref.Host, resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("registry %s token: %w", r.ref.Host, err)
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+	if body.Token == "" {
+		return "", fmt.Errorf("registry %s returned no token", r.ref.Host)
+	}
+	return body.Token, nil
+}
@@ -0,0 +1,115 @@
+package packs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testOCIRegistry serves pack "redis" as acme/redis:1.0.0 and requires a
+// bearer token from its /token endpoint. It returns the registry host and
+// the manifest digest.
+func testOCIRegistry(t *testing.T, layerType string) (string, string) {
+	t.Helper()
+	layer := tarball(t, packFiles("", "redis", "1.0.0"))
+	manifest, err := json.Marshal(ociManifest{
+		MediaType: mediaTypeManifest,
+		Config:    ociDescriptor{MediaType: MediaTypePackConfig, Digest: sha256Digest([]byte("{}")), Size: 2},
+		Layers:    []ociDescriptor{{MediaType: layerType, Digest: sha256Digest(layer), Size: int64(len(layer))}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256Digest(manifest)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:acme/redis:pull" {
+				http.Error(w, "bad scope", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"token": "secret"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/acme/redis/manifests/1.0.0", "/v2/acme/redis/manifests/" + digest:
+			w.Header().Set("Content-Type", mediaTypeManifest)
+			w.Write(manifest)
+		case "/v2/acme/redis/blobs/" + sha256Digest(layer):
+			w.Write(layer)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://"), digest
+}
+
+func TestInstaller_InstallOCI(t *testing.T) {
+	host, digest := testOCIRegistry(t, MediaTypePackLayer)
+
+	for _, ref := range []string{host + "/acme/redis:1.0.0", host + "/acme/redis@" + digest} {
+		i := testInstaller(t)
+		got, err := i.Install(context.Background(), "oci://"+ref, InstallOptions{})
+		if err != nil {
+			t.Fatalf("Install(%s) error = %v", ref, err)
+		}
+		if got.Name != "redis" || got.Version != "1.0.0" || got.Resolved != digest || got.Source != "oci://"+ref {
+			t.Errorf("Install(%s) = %+v", ref, got)
+		}
+	}
+
+	i := testInstaller(t)
+	for ref, wantErr := range map[string]string{
+		host + "/acme/redis:2.0.0":                             "404",
+		host + "/acme/redis@sha256:" + strings.Repeat("0", 64): "404",
+	} {
+		if _, err := i.Install(context.Background(), "oci://"+ref, InstallOptions{}); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("Install(%s) error = %v, want %q", ref, err, wantErr)
+		}
+	}
+}
+
+func TestInstaller_InstallOCIWrongLayer(t *testing.T) {
+	host, _ := testOCIRegistry(t, "application/vnd.oci.image.config.v1+json")
+
+	_, err := testInstaller(t).Install(context.Background(), "oci://"+host+"/acme/redis:1.0.0", InstallOptions{})
+	if err == nil || !strings.Contains(err.Error(), MediaTypePackLayer) {
+		t.Errorf("Install() error = %v, want missing pack layer", err)
+	}
+}
+
+func TestParseOCIReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	tests := map[string]ociReference{
+		"ghcr.io/acme/packs/redis":        {Host: "ghcr.io", Repository: "acme/packs/redis", Tag: "latest"},
+		"localhost:5000/redis:1.2.0":      {Host: "localhost:5000", Repository: "redis", Tag: "1.2.0"},
+		"ghcr.io/acme/redis@" + digest:    {Host: "ghcr.io", Repository: "acme/redis", Digest: digest},
+		"127.0.0.1:5000/a.b/c-d_e:v1.2_3": {Host: "127.0.0.1:5000", Repository: "a.b/c-d_e", Tag: "v1.2_3"},
+	}
+	for s, want := range tests {
+		got, err := parseOCIReference(s)
+		if err != nil || got != want {
+			t.Errorf("parseOCIReference(%q) = %+v, %v; want %+v", s, got, err, want)
+		}
+	}
+	for s, want := range map[string]string{
+		"localhost:5000/redis:1.2.0": "http://localhost:5000",
+		"[::1]:5000/redis":           "http://[::1]:5000",
+		"ghcr.io/acme/redis":         "https://ghcr.io",
+	} {
+		ref, _ := parseOCIReference(s)
+		if got := ref.baseURL(); got != want {
+			t.Errorf("baseURL(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
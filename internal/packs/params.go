@@ -0,0 +1,617 @@
+package packs
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// Params returns the parameters of a service using the pack: the schema's
+// default keywords, overridden by defaults.yaml, overridden by params.
+// Objects are merged key by key; other values replace each other. The
+// result is validated against schema.json (INV-PCK-002), with problems
+// reported as a ValidationError whose Errors name their location below
+// field, such as services[0].params.port.
+//
+// Unlike plain JSON Schema, an object schema with properties rejects keys
+// it does not declare unless it sets additionalProperties, so typos in
+// yar.yaml are errors rather than silently ignored. The commonParams yar
+// reads itself are accepted by every pack, and so is an object of params
+// for each dependency, named after it; ApplyParams validates those
+// against the dependency's schema.
+func (p *Pack) Params(field string, params map[string]any) (map[string]any, error) {
+	schema := withCommonParams(p.Schema, p.Meta.Dependencies)
+	defaults, _ := normalize(p.Defaults).(map[string]any)
+	values, _ := normalize(params).(map[string]any)
+	merged := mergeParams(mergeParams(defaultsOf(schema, schema), defaults), values)
+	if merged == nil {
+		merged = map[string]any{}
+	}
+
+	v := &paramValidator{root: schema}
+	v.validate(field, merged, schema)
+	if len(v.errs) > 0 {
+		return nil, &errors.ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("invalid parameters for pack %s", p.Name()),
+			Errors:  v.errs,
+		}
+	}
+	return merged, nil
+}
+
+// commonParams are the params yar itself reads for every service,
+// whatever its pack, by schema. A pack schema declaring one of them
+// replaces yar's.
+var commonParams = map[string]any{
+	// Published ports, see fleet.ServicePorts.
+	"ports": map[string]any{
+		"type":        "array",
+		"description": "Ports published on the host",
+		"items": map[string]any{
+			"type":     "object",
+			"required": []any{"containerPort"},
+			"properties": map[string]any{
+				"containerPort": map[string]any{"type": "integer", "minimum": 1, "maximum": 65535},
+				"hostPort":      map[string]any{"type": "integer", "minimum": 1, "maximum": 65535},
+				"protocol":      map[string]any{"type": "string", "enum": []any{ProtocolTCP, ProtocolUDP}},
+			},
+		},
+	},
+}
+
+// withCommonParams returns schema with the commonParams and the params
+// objects of deps it does not declare added to its properties. Schemas
+// without properties accept any params and are returned unchanged.
+func withCommonParams(schema map[string]any, deps []Dependency) map[string]any {
+	props, ok := schema["properties"].(map[string]any)
+	if !ok {
+		return schema
+	}
+	merged := make(map[string]any, len(props)+len(commonParams)+len(deps))
+	for name, s := range commonParams {
+		merged[name] = s
+	}
+	for _, dep := range deps {
+		merged[dep.Name] = map[string]any{
+			"type":                 "object",
+			"description":          fmt.Sprintf("Params of the %s service (pack %s)", dep.Name, dep.Pack),
+			"additionalProperties": true,
+			"default":              map[string]any{},
+		}
+	}
+	for name, s := range props {
+		merged[name] = s
+	}
+	out := make(map[string]any, len(schema))
+	for k, e := range schema {
+		out[k] = e
+	}
+	out["properties"] = merged
+	return out
+}
+
+// ApplyParams resolves the pack of every service through registry (see
+// PackRegistry.ResolveService) and returns copies of the services with
+// their params replaced by the pack's validated params (see Pack.Params).
+// Each service is followed by the services of its pack's dependencies,
+// and theirs, which it requires (see Dependency). Parameter problems of
+// all services are reported together.
+func ApplyParams(registry *PackRegistry, services []*config.Service) ([]*config.Service, error) {
+	a := &paramApplier{registry: registry, names: map[string]bool{}}
+	for _, svc := range services {
+		a.names[svc.Name] = true
+	}
+	resolved := make([]*config.Service, 0, len(services))
+	for i, svc := range services {
+		applied, err := a.apply(svc, fmt.Sprintf("services[%d].params", i), nil)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, applied...)
+	}
+	if len(a.errs) > 0 {
+		return nil, &errors.ValidationError{Field: "services", Message: "invalid pack parameters", Errors: a.errs}
+	}
+	return resolved, nil
+}
+
+// paramApplier applies the params of services and their dependencies.
+type paramApplier struct {
+	registry *PackRegistry
+	names    map[string]bool // service names in use
+	errs     []string
+}
+
+// apply returns svc with its pack's params, followed by the services of
+// the pack's dependencies. field locates svc's params in errors; parents
+// are the packs of the services svc is a dependency of.
+func (a *paramApplier) apply(svc *config.Service, field string, parents []string) ([]*config.Service, error) {
+	pack, err := a.registry.ResolveService(svc)
+	if err != nil {
+		return nil, fmt.Errorf("service %q: %w", svc.Name, err)
+	}
+	params, err := pack.Params(field, svc.Params)
+	if err != nil {
+		verr, ok := err.(*errors.ValidationError)
+		if !ok {
+			return nil, err
+		}
+		// Go on with the params as given, to report the problems of the
+		// dependencies too.
+		a.errs = append(a.errs, verr.Errors...)
+		params, _ = normalize(svc.Params).(map[string]any)
+	}
+	copied := *svc
+	copied.Params = params
+	copied.Requires = append([]string(nil), svc.Requires...)
+	applied := []*config.Service{&copied}
+
+	parents = append(parents[:len(parents):len(parents)], pack.Name())
+	for _, dep := range pack.Meta.Dependencies {
+		if slices.Contains(parents, dep.Pack) {
+			return nil, &errors.PackError{Pack: pack.Name(), File: FileMeta, Message: fmt.Sprintf(
+				"dependency cycle: %s -> %s", strings.Join(parents, " -> "), dep.Pack)}
+		}
+		name := DependencyService(svc.Name, dep)
+		if a.names[name] {
+			a.errs = append(a.errs, fmt.Sprintf("%s: service %s of dependency %s conflicts with another service of that name", field, name, dep.Name))
+			continue
+		}
+		a.names[name] = true
+		copied.Requires = append(copied.Requires, name)
+
+		defaults, _ := normalize(dep.Params).(map[string]any)
+		passed, _ := params[dep.Name].(map[string]any)
+		deps, err := a.apply(&config.Service{
+			Name:        name,
+			Namespace:   svc.Namespace,
+			Pack:        dep.Pack,
+			PackVersion: dep.Version,
+			Params:      mergeParams(defaults, passed),
+		}, field+"."+dep.Name, parents)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s of pack %s: %w", dep.Name, pack.Name(), err)
+		}
+		applied = append(applied, deps...)
+	}
+	return applied, nil
+}
+
+// paramValidator collects the problems of a value against a schema.
+type paramValidator struct {
+	root map[string]any // schema $ref pointers resolve against
+	errs []string
+}
+
+// errorf records a problem at path, adding the schema's description.
+func (v *paramValidator) errorf(path string, schema map[string]any, format string, args ...any) {
+	msg := path + ": " + fmt.Sprintf(format, args...)
+	if desc, ok := schema["description"].(string); ok && desc != "" {
+		msg += " (description: " + desc + ")"
+	}
+	v.errs = append(v.errs, msg)
+}
+
+// validate checks value at path against schema.
+func (v *paramValidator) validate(path string, value any, schema map[string]any) {
+	schema = v.deref(schema)
+	if schema == nil {
+		return
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 && !matchesType(value, types) {
+		v.errorf(path, schema, "must be %s (got %s)", strings.Join(types, " or "), describe(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok && !containsValue(enum, value) {
+		v.errorf(path, schema, "must be one of: %s (got %s)", formatValues(enum), describe(value))
+	}
+	if c, ok := schema["const"]; ok && !equalValues(c, value) {
+		v.errorf(path, schema, "must be %s (got %s)", describe(c), describe(value))
+	}
+
+	switch val := value.(type) {
+	case string:
+		v.validateString(path, val, schema)
+	case map[string]any:
+		v.validateObject(path, val, schema)
+	case []any:
+		if n, ok := number(schema["minItems"]); ok && float64(len(val)) < n {
+			v.errorf(path, schema, "must have at least %v items (got %d)", n, len(val))
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(val)) > n {
+			v.errorf(path, schema, "must have at most %v items (got %d)", n, len(val))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				v.validate(fmt.Sprintf("%s[%d]", path, i), item, items)
+			}
+		}
+	default:
+		if n, ok := number(value); ok {
+			v.validateNumber(path, n, schema)
+		}
+	}
+}
+
+func (v *paramValidator) validateString(path, s string, schema map[string]any) {
+	if n, ok := number(schema["minLength"]); ok && float64(len([]rune(s))) < n {
+		v.errorf(path, schema, "must be at least %v characters long (got %q)", n, s)
+	}
+	if n, ok := number(schema["maxLength"]); ok && float64(len([]rune(s))) > n {
+		v.errorf(path, schema, "must be at most %v characters long (got %q)", n, s)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.errorf(path, schema, "schema pattern %q is invalid: %v", pattern, err)
+		} else if !re.MatchString(s) {
+			v.errorf(path, schema, "must match pattern %s (got %q)", pattern, s)
+		}
+	}
+}
+
+func (v *paramValidator) validateNumber(path string, n float64, schema map[string]any) {
+	if min, ok := number(schema["minimum"]); ok && n < min {
+		v.errorf(path, schema, "must be at least %v (got %v)", min, n)
+	}
+	if max, ok := number(schema["maximum"]); ok && n > max {
+		v.errorf(path, schema, "must be at most %v (got %v)", max, n)
+	}
+	if min, ok := number(schema["exclusiveMinimum"]); ok && n <= min {
+		v.errorf(path, schema, "must be greater than %v (got %v)", min, n)
+	}
+	if max, ok := number(schema["exclusiveMaximum"]); ok && n >= max {
+		v.errorf(path, schema, "must be less than %v (got %v)", max, n)
+	}
+}
+
+func (v *paramValidator) validateObject(path string, obj map[string]any, schema map[string]any) {
+	props, _ := schema["properties"].(map[string]any)
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := obj[name]; !ok {
+				propSchema, _ := props[name].(map[string]any)
+				v.errorf(path+"."+name, v.deref(propSchema), "is required")
+			}
+		}
+	}
+
+	additional, hasAdditional := schema["additionalProperties"]
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if propSchema, ok := props[key].(map[string]any); ok {
+			v.validate(path+"."+key, obj[key], propSchema)
+			continue
+		}
+		switch a := additional.(type) {
+		case map[string]any:
+			v.validate(path+"."+key, obj[key], a)
+		case bool:
+			if !a {
+				v.unknown(path, key, props)
+			}
+		default:
+			if !hasAdditional && props != nil {
+				v.unknown(path, key, props)
+			}
+		}
+	}
+}
+
+// unknown records an undeclared key, suggesting a declared one it is
+// probably a typo of.
+func (v *paramValidator) unknown(path, key string, props map[string]any) {
+	msg := path + "." + key + ": unknown parameter"
+	if s := suggest(key, props); s != "" {
+		msg += "; did you mean " + s + "?"
+	} else if len(props) > 0 {
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		msg += " (known: " + strings.Join(names, ", ") + ")"
+	}
+	v.errs = append(v.errs, msg)
+}
+
+// deref resolves a local $ref such as "#/$defs/port" against the root
+// schema. Keywords next to $ref, such as default or description, take
+// precedence over the referenced schema's. Unresolvable references
+// validate nothing.
+func (v *paramValidator) deref(schema map[string]any) map[string]any {
+	for i := 0; schema != nil && i < 10; i++ {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		target := lookupPointer(v.root, ref)
+		if target == nil {
+			return nil
+		}
+		merged := make(map[string]any, len(target)+len(schema))
+		for k, e := range target {
+			merged[k] = e
+		}
+		for k, e := range schema {
+			if k != "$ref" {
+				merged[k] = e
+			}
+		}
+		schema = merged
+	}
+	return schema
+}
+
+// lookupPointer returns the schema at a local JSON pointer, or nil.
+func lookupPointer(root map[string]any, ref string) map[string]any {
+	if !strings.HasPrefix(ref, "#") {
+		return nil
+	}
+	node := any(root)
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = m[part]
+	}
+	schema, _ := node.(map[string]any)
+	return schema
+}
+
+// defaultsOf returns the values of the default keywords of an object
+// schema's properties, recursing into nested object schemas.
+func defaultsOf(schema, root map[string]any) map[string]any {
+	v := &paramValidator{root: root}
+	schema = v.deref(schema)
+	props, _ := schema["properties"].(map[string]any)
+	var defaults map[string]any
+	for name, p := range props {
+		propSchema := v.deref(asSchema(p))
+		if propSchema == nil {
+			continue
+		}
+		value, ok := propSchema["default"]
+		if nested := defaultsOf(propSchema, root); nested != nil {
+			base, _ := normalize(value).(map[string]any)
+			value, ok = mergeParams(nested, base), true
+		}
+		if ok {
+			if defaults == nil {
+				defaults = make(map[string]any)
+			}
+			defaults[name] = normalize(value)
+		}
+	}
+	return defaults
+}
+
+func asSchema(v any) map[string]any {
+	schema, _ := v.(map[string]any)
+	return schema
+}
+
+// mergeParams returns base overridden by override. Nested objects are
+// merged; other values are replaced. Neither argument is modified.
+func mergeParams(base, override map[string]any) map[string]any {
+	if base == nil && override == nil {
+		return nil
+	}
+	merged := make(map[string]any, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		if bm, ok := merged[k].(map[string]any); ok {
+			if om, ok := v.(map[string]any); ok {
+				merged[k] = mergeParams(bm, om)
+				continue
+			}
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// normalize returns a deep copy of a YAML or JSON value with whole
+// floating point numbers turned into ints, so defaults from schema.json
+// and values from yar.yaml compare and render alike.
+func normalize(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		if v == nil {
+			return v
+		}
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = normalize(e)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = normalize(e)
+		}
+		return out
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int(v)
+		}
+	}
+	return value
+}
+
+// schemaTypes returns the types a schema allows.
+func schemaTypes(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// matchesType reports whether value has one of the JSON Schema types.
+func matchesType(value any, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "null":
+			if value == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := value.(bool); ok {
+				return true
+			}
+		case "string":
+			if _, ok := value.(string); ok {
+				return true
+			}
+		case "integer":
+			if n, ok := number(value); ok && n == math.Trunc(n) {
+				return true
+			}
+		case "number":
+			if _, ok := number(value); ok {
+				return true
+			}
+		case "array":
+			if _, ok := value.([]any); ok {
+				return true
+			}
+		case "object":
+			if _, ok := value.(map[string]any); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// number returns value as a float64 if it is a number.
+func number(value any) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// equalValues compares YAML and JSON values, treating equal numbers of
+// different types as equal.
+func equalValues(a, b any) bool {
+	if na, ok := number(a); ok {
+		nb, ok := number(b)
+		return ok && na == nb
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func containsValue(list []any, value any) bool {
+	for _, e := range list {
+		if equalValues(e, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe formats a value for an error message.
+func describe(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	}
+	return fmt.Sprint(value)
+}
+
+func formatValues(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = describe(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// suggest returns the declared property key most likely meant, or "".
+// Keys match if they are equal ignoring case, "-" and "_", within a small
+// edit distance of each other, or if the key abbreviates the property.
+func suggest(key string, props map[string]any) string {
+	fold := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+	best, bestDist := "", -1
+	for name := range props {
+		d := editDistance(fold(key), fold(name))
+		if len(key) >= 3 && strings.HasPrefix(fold(name), fold(key)) {
+			d = min(d, 1)
+		}
+		limit := 2
+		if len(name) < 5 {
+			limit = 1
+		}
+		if d <= limit && (bestDist < 0 || d < bestDist || (d == bestDist && name < best)) {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
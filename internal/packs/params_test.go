@@ -0,0 +1,316 @@
+package packs
+
+import (
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// paramsSchema is a schema exercising the supported keywords.
+const paramsSchema = `{
+  "type": "object",
+  "$defs": {
+    "port": {"type": "integer", "minimum": 1, "maximum": 65535, "description": "TCP port"}
+  },
+  "properties": {
+    "image": {"type": "string", "default": "app:1", "pattern": "^[a-z0-9./:-]+$", "description": "Container image"},
+    "port": {"$ref": "#/$defs/port", "default": 8080},
+    "replicas": {"type": "integer", "default": 1, "exclusiveMinimum": 0},
+    "mode": {"type": "string", "enum": ["dev", "prod"], "default": "dev"},
+    "passwordRef": {"type": "string", "minLength": 1, "description": "Secret reference for the password"},
+    "ratio": {"type": ["number", "null"]},
+    "tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+    "resources": {
+      "type": "object",
+      "properties": {
+        "memory": {"type": "string", "default": "128Mi"},
+        "cpu": {"type": "string"}
+      }
+    },
+    "labels": {"type": "object", "additionalProperties": {"type": "string"}},
+    "extra": {"type": "object"}
+  },
+  "required": ["passwordRef"]
+}`
+
+func paramsPack(t *testing.T, defaults string) *Pack {
+	t.Helper()
+	fsys := validPack("app")
+	fsys["app/schema.json"] = &fstest.MapFile{Data: []byte(paramsSchema)}
+	if defaults != "" {
+		fsys["app/defaults.yaml"] = &fstest.MapFile{Data: []byte(defaults)}
+	}
+	pack, err := LoadFS(fsys, "app")
+	if err != nil {
+		t.Fatalf("LoadFS() error = %v", err)
+	}
+	return pack
+}
+
+func TestPack_Params(t *testing.T) {
+	pack := paramsPack(t, "mode: prod\nresources:\n  cpu: 500m\n")
+
+	got, err := pack.Params("services[0].params", map[string]any{
+		"passwordRef": "app/password",
+		"replicas":    3.0,
+		"resources":   map[string]any{"memory": "1Gi"},
+		"labels":      map[string]any{"team": "core"},
+		"extra":       map[string]any{"anything": true},
+		"ratio":       nil,
+	})
+	if err != nil {
+		t.Fatalf("Params() error = %v", err)
+	}
+	want := map[string]any{
+		"image":       "app:1",
+		"port":        8080,
+		"replicas":    3,
+		"mode":        "prod",
+		"passwordRef": "app/password",
+		"ratio":       nil,
+		"resources":   map[string]any{"memory": "1Gi", "cpu": "500m"},
+		"labels":      map[string]any{"team": "core"},
+		"extra":       map[string]any{"anything": true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Params() mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := pack.Defaults["image"]; ok {
+		t.Errorf("Params() modified the pack defaults: %v", pack.Defaults)
+	}
+}
+
+func TestPack_ParamsErrors(t *testing.T) {
+	pack := paramsPack(t, "")
+
+	tests := map[string]struct {
+		params map[string]any
+		want   string
+	}{
+		"required":           {map[string]any{}, "services[1].params.passwordRef: is required (description: Secret reference for the password)"},
+		"typo":               {map[string]any{"passwordRef": "p", "pasword_ref": "p"}, "services[1].params.pasword_ref: unknown parameter; did you mean passwordRef?"},
+		"unknown":            {map[string]any{"passwordRef": "p", "volume": "x"}, "services[1].params.volume: unknown parameter (known: extra, image,"},
+		"nested unknown":     {map[string]any{"passwordRef": "p", "resources": map[string]any{"mem": "1Gi"}}, "services[1].params.resources.mem: unknown parameter; did you mean memory?"},
+		"type":               {map[string]any{"passwordRef": "p", "port": "80"}, `services[1].params.port: must be integer (got "80") (description: TCP port)`},
+		"not whole":          {map[string]any{"passwordRef": "p", "port": 80.5}, "services[1].params.port: must be integer (got 80.5)"},
+		"maximum":            {map[string]any{"passwordRef": "p", "port": 70000}, "services[1].params.port: must be at most 65535 (got 70000) (description: TCP port)"},
+		"exclusive minimum":  {map[string]any{"passwordRef": "p", "replicas": 0}, "services[1].params.replicas: must be greater than 0 (got 0)"},
+		"enum":               {map[string]any{"passwordRef": "p", "mode": "test"}, `services[1].params.mode: must be one of: "dev", "prod" (got "test")`},
+		"pattern":            {map[string]any{"passwordRef": "p", "image": "App"}, `services[1].params.image: must match pattern ^[a-z0-9./:-]+$ (got "App")`},
+		"min length":         {map[string]any{"passwordRef": ""}, `services[1].params.passwordRef: must be at least 1 characters long (got "")`},
+		"items":              {map[string]any{"passwordRef": "p", "tags": []any{"a", 1}}, "services[1].params.tags[1]: must be string (got 1)"},
+		"max items":          {map[string]any{"passwordRef": "p", "tags": []any{"a", "b", "c"}}, "services[1].params.tags: must have at most 2 items (got 3)"},
+		"type array":         {map[string]any{"passwordRef": "p", "ratio": "half"}, `services[1].params.ratio: must be number or null (got "half")`},
+		"additional schema":  {map[string]any{"passwordRef": "p", "labels": map[string]any{"team": 1}}, "services[1].params.labels.team: must be string (got 1)"},
+		"object not mapping": {map[string]any{"passwordRef": "p", "resources": "1Gi"}, `services[1].params.resources: must be object (got "1Gi")`},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := pack.Params("services[1].params", tc.params)
+			var verr *errors.ValidationError
+			if !stderrors.As(err, &verr) {
+				t.Fatalf("Params() error = %v, want ValidationError", err)
+			}
+			if verr.Field != "services[1].params" || verr.Message != "invalid parameters for pack app" {
+				t.Errorf("ValidationError = %q: %q", verr.Field, verr.Message)
+			}
+			if len(verr.Errors) != 1 || !strings.HasPrefix(verr.Errors[0], tc.want) {
+				t.Errorf("Errors = %q, want one starting with %q", verr.Errors, tc.want)
+			}
+		})
+	}
+}
+
+func TestPack_ParamsPermissiveSchema(t *testing.T) {
+	pack, err := LoadFS(validPack("cache"), "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := pack.Params("services[0].params", map[string]any{"anything": 1})
+	if err != nil {
+		t.Fatalf("Params() error = %v", err)
+	}
+	if diff := cmp.Diff(map[string]any{"anything": 1}, got); diff != "" {
+		t.Errorf("Params() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestApplyParams(t *testing.T) {
+	r, err := NewPackRegistry(WithUserDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := []*config.Service{
+		{Name: "cache", Pack: "redis", Params: map[string]any{"maxMemory": "64mb"}},
+		{Name: "db", Pack: "postgres", Params: map[string]any{"passwordRef": "db/password"}},
+	}
+
+	got, err := ApplyParams(r, services)
+	if err != nil {
+		t.Fatalf("ApplyParams() error = %v", err)
+	}
+	if got[0].Params["port"] != 6379 || got[0].Params["maxMemory"] != "64mb" || got[1].Params["database"] != "app" {
+		t.Errorf("ApplyParams() params = %v, %v", got[0].Params, got[1].Params)
+	}
+	if _, ok := services[0].Params["port"]; ok {
+		t.Errorf("ApplyParams() modified its input: %v", services[0].Params)
+	}
+
+	services[0].Params = map[string]any{"port": 0}
+	services[1].Params = nil
+	_, err = ApplyParams(r, services)
+	var verr *errors.ValidationError
+	if !stderrors.As(err, &verr) {
+		t.Fatalf("ApplyParams() error = %v, want ValidationError", err)
+	}
+	want := []string{
+		"services[0].params.port: must be at least 1 (got 0) (description: Port Redis listens on)",
+		"services[1].params.passwordRef: is required (description: Secret reference for the superuser password)",
+	}
+	if diff := cmp.Diff(want, verr.Errors); diff != "" {
+		t.Errorf("Errors mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = ApplyParams(r, []*config.Service{{Name: "web", Pack: "node"}})
+	var nf *errors.NotFoundError
+	if !stderrors.As(err, &nf) || !strings.Contains(err.Error(), `service "web"`) {
+		t.Errorf("ApplyParams() error = %v, want pack NotFoundError for web", err)
+	}
+}
+
+func TestApplyParams_Dependencies(t *testing.T) {
+	project := t.TempDir()
+	dir := filepath.Join(project, DirPacks)
+	writeFiles := func(name string, files map[string]string) {
+		t.Helper()
+		for file, data := range files {
+			path := filepath.Join(dir, name, file)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeFiles("app", map[string]string{
+		"meta.yaml": `name: app
+version: 1.0.0
+dependencies:
+  - name: db
+    pack: postgres
+    version: ^1
+    params:
+      passwordRef: app/db-password
+      database: app
+  - pack: redis
+`,
+		"schema.json":              `{"type": "object", "properties": {"image": {"type": "string", "default": "app"}}}`,
+		"templates/resources.yaml": "apiVersion: yar.io/v1\nkind: Pack\n",
+	})
+	r, err := NewPackRegistry(WithProjectDir(project), WithUserDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := []*config.Service{
+		{Name: "web", Pack: "app", Requires: []string{"queue"}, Params: map[string]any{"db": map[string]any{"database": "shop"}}},
+		{Name: "queue", Pack: "redis"},
+	}
+	got, err := ApplyParams(r, services)
+	if err != nil {
+		t.Fatalf("ApplyParams() error = %v", err)
+	}
+	var names []string
+	for _, svc := range got {
+		names = append(names, svc.Name+":"+svc.Pack)
+	}
+	if diff := cmp.Diff([]string{"web:app", "web-db:postgres", "web-redis:redis", "queue:redis"}, names); diff != "" {
+		t.Errorf("services (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"queue", "web-db", "web-redis"}, got[0].Requires); diff != "" {
+		t.Errorf("web requires (-want +got):\n%s", diff)
+	}
+	if len(services[0].Requires) != 1 {
+		t.Errorf("ApplyParams() modified its input: %v", services[0].Requires)
+	}
+	db := got[1]
+	if db.Params["database"] != "shop" || db.Params["passwordRef"] != "app/db-password" || db.Params["port"] != 5432 || db.PackVersion != "^1" {
+		t.Errorf("web-db = %+v", db)
+	}
+
+	services[0].Params = map[string]any{"db": map[string]any{"port": 0}, "cache": map[string]any{}}
+	_, err = ApplyParams(r, services)
+	var verr *errors.ValidationError
+	if !stderrors.As(err, &verr) {
+		t.Fatalf("ApplyParams() error = %v, want ValidationError", err)
+	}
+	want := []string{
+		"services[0].params.cache: unknown parameter",
+		"services[0].params.db.port: must be at least 1 (got 0) (description: Port PostgreSQL listens on)",
+	}
+	if len(verr.Errors) != len(want) {
+		t.Fatalf("Errors = %q, want %q", verr.Errors, want)
+	}
+	for i, e := range verr.Errors {
+		if !strings.HasPrefix(e, want[i]) {
+			t.Errorf("Errors[%d] = %q, want %q", i, e, want[i])
+		}
+	}
+
+	// Names of dependency services must be free.
+	services = []*config.Service{{Name: "web", Pack: "app"}, {Name: "web-redis", Pack: "redis"}}
+	if _, err := ApplyParams(r, services); err == nil || !strings.Contains(err.Error(), "service web-redis of dependency redis conflicts") {
+		t.Errorf("ApplyParams() error = %v, want conflict", err)
+	}
+
+	// Cycles are pack errors.
+	writeFiles("loop", map[string]string{
+		"meta.yaml":                "name: loop\nversion: 1.0.0\ndependencies:\n  - pack: app\n",
+		"schema.json":              `{"type": "object"}`,
+		"templates/resources.yaml": "apiVersion: yar.io/v1\nkind: Pack\n",
+	})
+	writeFiles("app", map[string]string{"meta.yaml": "name: app\nversion: 1.0.0\ndependencies:\n  - pack: loop\n"})
+	r, err = NewPackRegistry(WithProjectDir(project), WithUserDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplyParams(r, []*config.Service{{Name: "web", Pack: "app"}}); err == nil || !strings.Contains(err.Error(), "dependency cycle: app -> loop -> app") {
+		t.Errorf("ApplyParams() error = %v, want cycle", err)
+	}
+}
+
+func TestPack_ParamsCommon(t *testing.T) {
+	pack := paramsPack(t, "")
+
+	ports := []any{map[string]any{"containerPort": 6379, "hostPort": 6379}}
+	got, err := pack.Params("services[0].params", map[string]any{"passwordRef": "p", "ports": ports})
+	if err != nil {
+		t.Fatalf("Params() error = %v", err)
+	}
+	if diff := cmp.Diff(ports, got["ports"]); diff != "" {
+		t.Errorf("ports mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = pack.Params("services[0].params", map[string]any{"passwordRef": "p", "ports": []any{map[string]any{"hostPort": 80, "protocol": "sctp"}}})
+	var verr *errors.ValidationError
+	if !stderrors.As(err, &verr) {
+		t.Fatalf("Params() error = %v, want ValidationError", err)
+	}
+	want := []string{
+		"services[0].params.ports[0].containerPort: is required",
+		`services[0].params.ports[0].protocol: must be one of: "tcp", "udp" (got "sctp")`,
+	}
+	if diff := cmp.Diff(want, verr.Errors); diff != "" {
+		t.Errorf("Errors mismatch (-want +got):\n%s", diff)
+	}
+}
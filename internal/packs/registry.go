@@ -0,0 +1,406 @@
+package packs
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+	"github.com/yar-run/yar/internal/platform"
+)
+
+// Source says where a registry found a pack.
+type Source string
+
+// Pack sources, in precedence order: a pack in an earlier source shadows
+// packs of the same name in later ones.
+const (
+	SourceProject Source = "project" // ./packs next to yar.yaml
+	SourceUser    Source = "user"    // packs in the yar config directory
+	SourceBuiltin Source = "builtin" // packs built into yar
+)
+
+// DirPacks is the name of the pack directories of projects and users.
+const DirPacks = "packs"
+
+// PackRegistry finds packs by name in the project, user and built-in
+// sources.
+type PackRegistry struct {
+	projectDir string
+	userDir    string
+	builtins   fs.FS
+	builtinDir string
+	yarVersion string
+	lock       *ProjectLock // yar.lock of the project, if there is one
+}
+
+// RegistryOption configures a PackRegistry.
+type RegistryOption func(*PackRegistry)
+
+// WithProjectDir sets the directory of yar.yaml, whose packs/ directory
+// holds the project's packs.
+func WithProjectDir(dir string) RegistryOption {
+	return func(r *PackRegistry) {
+		r.projectDir = dir
+	}
+}
+
+// WithUserDir sets the directory holding user packs, by default packs/ in
+// the yar config directory.
+func WithUserDir(dir string) RegistryOption {
+	return func(r *PackRegistry) {
+		r.userDir = dir
+	}
+}
+
+// WithBuiltins replaces the built-in packs with the pack directories at
+// the root of fsys. A nil fsys disables built-in packs.
+func WithBuiltins(fsys fs.FS) RegistryOption {
+	return func(r *PackRegistry) {
+		r.builtins = fsys
+		r.builtinDir = "."
+	}
+}
+
+// WithYarVersion sets the running yar version. Packs whose minYarVersion
+// is newer fail to resolve. Without it, or for development builds whose
+// version is not semantic, minYarVersion is not checked.
+func WithYarVersion(version string) RegistryOption {
+	return func(r *PackRegistry) {
+		r.yarVersion = version
+	}
+}
+
+// NewPackRegistry creates a registry. Without WithProjectDir it has no
+// project packs and no project lock.
+func NewPackRegistry(opts ...RegistryOption) (*PackRegistry, error) {
+	r := &PackRegistry{builtins: builtinFS, builtinDir: builtinDir}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.userDir == "" {
+		dir, err := platform.ConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		r.userDir = filepath.Join(dir, DirPacks)
+	}
+	if r.projectDir != "" {
+		lock, err := ReadProjectLock(r.projectDir)
+		if err != nil {
+			return nil, err
+		}
+		r.lock = lock
+	}
+	return r, nil
+}
+
+// RegistrySource is one place a registry searches for packs.
+type RegistrySource struct {
+	Source Source
+	Path   string // directory on disk; empty for built-in packs
+	fsys   fs.FS
+	dir    string // directory of fsys holding the packs
+}
+
+// Sources returns the places the registry searches, in precedence order.
+func (r *PackRegistry) Sources() []RegistrySource {
+	var sources []RegistrySource
+	if r.projectDir != "" {
+		dir := filepath.Join(r.projectDir, DirPacks)
+		sources = append(sources, RegistrySource{Source: SourceProject, Path: dir, fsys: os.DirFS(dir), dir: "."})
+	}
+	sources = append(sources, RegistrySource{Source: SourceUser, Path: r.userDir, fsys: os.DirFS(r.userDir), dir: "."})
+	if r.builtins != nil {
+		sources = append(sources, RegistrySource{Source: SourceBuiltin, fsys: r.builtins, dir: r.builtinDir})
+	}
+	return sources
+}
+
+// String returns the source's directory, or "built-in" for built-in
+// packs.
+func (s RegistrySource) String() string {
+	if s.Path == "" {
+		return "built-in"
+	}
+	return s.Path
+}
+
+// has reports whether the source has a directory for pack name.
+func (s RegistrySource) has(name string) bool {
+	info, err := fs.Stat(s.fsys, path.Join(s.dir, name))
+	return err == nil && info.IsDir()
+}
+
+// load loads pack name from the source. Installed user packs are first
+// checked against packs.lock.
+func (s RegistrySource) load(name string) (*Pack, error) {
+	var pack *Pack
+	var err error
+	if s.Source == SourceUser {
+		if err := verifyInstalled(s.Path, name); err != nil {
+			return nil, err
+		}
+	}
+	if s.Path != "" {
+		pack, err = Load(filepath.Join(s.Path, name))
+	} else {
+		pack, err = LoadFS(s.fsys, path.Join(s.dir, name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	pack.Source = s.Source
+	return pack, nil
+}
+
+// names returns the pack directories of the source, sorted. A missing
+// directory has none.
+func (s RegistrySource) names() ([]string, error) {
+	entries, err := fs.ReadDir(s.fsys, s.dir)
+	if err != nil {
+		if stderrors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, &errors.PackError{Pack: string(s.Source), Message: "failed to read pack directory " + s.String(), Err: err}
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Resolve loads pack name from the first source that has it. A pack that
+// exists but fails to load is an error; the registry does not fall back
+// to a shadowed pack.
+func (r *PackRegistry) Resolve(name string) (*Pack, error) {
+	if namePattern.MatchString(name) {
+		for _, s := range r.Sources() {
+			if s.has(name) {
+				return r.load(s, name)
+			}
+		}
+	}
+	return nil, r.notFound(name, "")
+}
+
+// ResolveVersion loads the highest version of pack name that satisfies
+// constraint (see ParseConstraint) from any source. Sources break ties in
+// precedence order. Without a constraint it is Resolve.
+func (r *PackRegistry) ResolveVersion(name, constraint string) (*Pack, error) {
+	if constraint == "" {
+		return r.Resolve(name)
+	}
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return nil, &errors.ValidationError{Field: "packVersion", Value: constraint, Message: err.Error()}
+	}
+	candidates, err := r.candidates(name)
+	if err != nil {
+		return nil, err
+	}
+	var best *Pack
+	for _, pack := range candidates {
+		if c.Check(pack.Version()) && (best == nil || CompareVersions(pack.Version(), best.Version()) > 0) {
+			best = pack
+		}
+	}
+	if best == nil {
+		return nil, r.notFound(name+"@"+constraint, "no version matches; available: "+describeCandidates(candidates))
+	}
+	if err := r.checkYarVersion(best); err != nil {
+		return nil, err
+	}
+	return best, nil
+}
+
+// ResolveService loads the pack of svc. The version yar.lock records for
+// the service is used while it still satisfies svc.PackVersion, so every
+// checkout of the project runs the same pack versions; otherwise the pack
+// is resolved as ResolveVersion does. The choice is recorded in the lock,
+// which WriteProjectLock saves.
+func (r *PackRegistry) ResolveService(svc *config.Service) (*Pack, error) {
+	var pack *Pack
+	var err error
+	locked := r.lock.lookup(svc.Name, svc.Pack)
+	if locked != nil && svc.PackVersion != "" {
+		c, err := ParseConstraint(svc.PackVersion)
+		if err != nil {
+			return nil, &errors.ValidationError{Field: "packVersion", Value: svc.PackVersion, Message: err.Error()}
+		}
+		if !c.Check(locked.Version) {
+			locked = nil
+		}
+	}
+	if locked != nil {
+		pack, err = r.resolveLocked(svc.Name, locked)
+	} else {
+		pack, err = r.ResolveVersion(svc.Pack, svc.PackVersion)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.lock.record(svc.Name, pack)
+	return pack, nil
+}
+
+// resolveLocked loads the version of a pack yar.lock pins for service.
+func (r *PackRegistry) resolveLocked(service string, locked *LockedPack) (*Pack, error) {
+	candidates, err := r.candidates(locked.Pack)
+	if err != nil {
+		return nil, err
+	}
+	for _, pack := range candidates {
+		if pack.Version() == locked.Version {
+			if err := r.checkYarVersion(pack); err != nil {
+				return nil, err
+			}
+			return pack, nil
+		}
+	}
+	available := "none"
+	if len(candidates) > 0 {
+		available = describeCandidates(candidates)
+	}
+	return nil, r.notFound(locked.Pack+"@"+locked.Version, fmt.Sprintf(
+		"%s pins this version for service %s, but it is not available (available: %s); install it, or delete services.%s from %s to use another version",
+		FileProjectLock, service, available, service, FileProjectLock))
+}
+
+// candidates loads pack name from every source that has it, in precedence
+// order. A copy that fails to load is an error, as in Resolve.
+func (r *PackRegistry) candidates(name string) ([]*Pack, error) {
+	var packs []*Pack
+	if namePattern.MatchString(name) {
+		for _, s := range r.Sources() {
+			if !s.has(name) {
+				continue
+			}
+			pack, err := s.load(name)
+			if err != nil {
+				return nil, err
+			}
+			packs = append(packs, pack)
+		}
+	}
+	if len(packs) == 0 {
+		return nil, r.notFound(name, "")
+	}
+	return packs, nil
+}
+
+// describeCandidates lists the versions and sources of packs.
+func describeCandidates(packs []*Pack) string {
+	list := make([]string, len(packs))
+	for i, p := range packs {
+		list[i] = fmt.Sprintf("%s (%s)", p.Version(), p.Source)
+	}
+	return strings.Join(list, ", ")
+}
+
+// notFound returns the error for a pack no source has. Without a message,
+// it lists the places searched.
+func (r *PackRegistry) notFound(name, message string) error {
+	if message == "" {
+		var searched []string
+		for _, s := range r.Sources() {
+			searched = append(searched, s.String())
+		}
+		message = "searched " + strings.Join(searched, ", ")
+	}
+	return &errors.NotFoundError{Resource: "pack", Name: name, Message: message}
+}
+
+// load loads pack name from s and checks its minYarVersion.
+func (r *PackRegistry) load(s RegistrySource, name string) (*Pack, error) {
+	pack, err := s.load(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkYarVersion(pack); err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// checkYarVersion returns an error if pack needs a newer yar than the
+// running one.
+func (r *PackRegistry) checkYarVersion(pack *Pack) error {
+	running, ok := parseSemver(r.yarVersion)
+	if !ok || pack.Meta.MinYarVersion == "" {
+		return nil
+	}
+	if min, ok := parseSemver(pack.Meta.MinYarVersion); ok && min.compare(running) > 0 {
+		return &errors.PackError{
+			Pack:    pack.Name(),
+			File:    FileMeta,
+			Message: fmt.Sprintf("pack %s %s needs yar %s or newer, but this is yar %s; upgrade yar or use an older version of the pack", pack.Name(), pack.Version(), pack.Meta.MinYarVersion, r.yarVersion),
+		}
+	}
+	return nil
+}
+
+// PackEntry is a pack found by List.
+type PackEntry struct {
+	Name       string `json:"name"`
+	Source     Source `json:"source"`
+	Path       string `json:"path,omitempty"`       // empty for built-in packs
+	Pack       *Pack  `json:"-"`                    // nil if Err is set
+	Err        error  `json:"-"`                    // why the pack failed to load
+	ShadowedBy Source `json:"shadowedBy,omitempty"` // source of the pack Resolve returns instead
+}
+
+// Active reports whether Resolve returns this entry's pack.
+func (e PackEntry) Active() bool {
+	return e.ShadowedBy == ""
+}
+
+// Describe returns the entry's version and description, or a note about
+// its load error.
+func (e PackEntry) Describe() (version, description string) {
+	if e.Err != nil {
+		return "-", fmt.Sprintf("invalid: %v", e.Err)
+	}
+	return e.Pack.Version(), e.Pack.Meta.Description
+}
+
+// List returns every pack of every source, sorted by name and then by
+// precedence. Packs that fail to load are listed with their error, so a
+// broken pack is visible rather than missing.
+func (r *PackRegistry) List() ([]PackEntry, error) {
+	var entries []PackEntry
+	active := make(map[string]Source)
+	for _, s := range r.Sources() {
+		names, err := s.names()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			entry := PackEntry{Name: name, Source: s.Source}
+			if s.Path != "" {
+				entry.Path = filepath.Join(s.Path, name)
+			}
+			entry.Pack, entry.Err = r.load(s, name)
+			if winner, ok := active[name]; ok {
+				entry.ShadowedBy = winner
+			} else {
+				active[name] = s.Source
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
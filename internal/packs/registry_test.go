@@ -0,0 +1,326 @@
+package packs
+
+import (
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/action"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// writePack writes a minimal pack named name with version to dir.
+func writePack(t *testing.T, dir, name, version string) {
+	t.Helper()
+	files := map[string]string{
+		"meta.yaml":                "name: " + name + "\nversion: " + version + "\ndescription: " + name + " " + version + "\n",
+		"schema.json":              `{"type": "object"}`,
+		"templates/resources.yaml": "apiVersion: yar.io/v1\nkind: Pack\n",
+	}
+	for file, data := range files {
+		path := filepath.Join(dir, name, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testRegistry returns a registry with project packs redis 3.0.0 and a
+// broken kafka, user packs redis 2.0.0 and postgres 2.0.0, and built-in
+// redis, postgres and nats at 1.0.0.
+func testRegistry(t *testing.T) (*PackRegistry, string, string) {
+	t.Helper()
+	project := t.TempDir()
+	user := t.TempDir()
+	writePack(t, filepath.Join(project, DirPacks), "redis", "3.0.0")
+	writePack(t, filepath.Join(project, DirPacks), "kafka", "1.0")
+	writePack(t, user, "redis", "2.0.0")
+	writePack(t, user, "postgres", "2.0.0")
+	if err := os.WriteFile(filepath.Join(user, "README.md"), []byte("not a pack"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	builtins := fstest.MapFS{}
+	for _, name := range []string{"redis", "postgres", "nats"} {
+		for file, data := range validPack(name) {
+			builtins[file] = data
+		}
+	}
+
+	r, err := NewPackRegistry(WithProjectDir(project), WithUserDir(user), WithBuiltins(builtins))
+	if err != nil {
+		t.Fatalf("NewPackRegistry() error = %v", err)
+	}
+	return r, filepath.Join(project, DirPacks), user
+}
+
+func TestPackRegistry_Resolve(t *testing.T) {
+	r, projectPacks, userPacks := testRegistry(t)
+
+	tests := map[string]struct {
+		name        string
+		wantVersion string
+		wantSource  Source
+		wantDir     string
+	}{
+		"project shadows user and builtin": {"redis", "3.0.0", SourceProject, filepath.Join(projectPacks, "redis")},
+		"user shadows builtin":             {"postgres", "2.0.0", SourceUser, filepath.Join(userPacks, "postgres")},
+		"builtin":                          {"nats", "1.0.0", SourceBuiltin, "nats"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			pack, err := r.Resolve(tc.name)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if pack.Version() != tc.wantVersion || pack.Source != tc.wantSource || pack.Dir != tc.wantDir {
+				t.Errorf("Resolve() = %s %s from %s in %s, want %s from %s in %s",
+					pack.Name(), pack.Version(), pack.Source, pack.Dir, tc.wantVersion, tc.wantSource, tc.wantDir)
+			}
+		})
+	}
+}
+
+func TestPackRegistry_ResolveErrors(t *testing.T) {
+	r, projectPacks, _ := testRegistry(t)
+
+	// A broken pack is an error, not a reason to fall back.
+	_, err := r.Resolve("kafka")
+	var perr *errors.PackError
+	if !stderrors.As(err, &perr) || perr.Pack != "kafka" || perr.File != FileMeta {
+		t.Errorf("Resolve(kafka) error = %v, want meta.yaml PackError", err)
+	}
+
+	for _, name := range []string{"mysql", "../redis", "Redis"} {
+		_, err := r.Resolve(name)
+		var nf *errors.NotFoundError
+		if !stderrors.As(err, &nf) || nf.Resource != "pack" || nf.Name != name {
+			t.Fatalf("Resolve(%q) error = %v, want pack NotFoundError", name, err)
+		}
+		if !strings.Contains(nf.Message, projectPacks) || !strings.Contains(nf.Message, "built-in") {
+			t.Errorf("NotFoundError message %q does not list the searched sources", nf.Message)
+		}
+	}
+}
+
+func TestPackRegistry_ResolveVersion(t *testing.T) {
+	r, _, _ := testRegistry(t)
+
+	tests := map[string]struct {
+		name, constraint string
+		wantVersion      string
+		wantSource       Source
+	}{
+		"highest match":      {"redis", ">=1", "3.0.0", SourceProject},
+		"shadowed user":      {"redis", "^2", "2.0.0", SourceUser},
+		"shadowed builtin":   {"redis", "~1.0", "1.0.0", SourceBuiltin},
+		"no constraint":      {"postgres", "", "2.0.0", SourceUser},
+		"single source":      {"nats", "^1", "1.0.0", SourceBuiltin},
+		"precedence on ties": {"postgres", "1.0.0 || 2.0.0", "2.0.0", SourceUser},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			pack, err := r.ResolveVersion(tc.name, tc.constraint)
+			if err != nil {
+				t.Fatalf("ResolveVersion() error = %v", err)
+			}
+			if pack.Version() != tc.wantVersion || pack.Source != tc.wantSource {
+				t.Errorf("ResolveVersion() = %s from %s, want %s from %s", pack.Version(), pack.Source, tc.wantVersion, tc.wantSource)
+			}
+		})
+	}
+
+	_, err := r.ResolveVersion("redis", "^4")
+	var nf *errors.NotFoundError
+	if !stderrors.As(err, &nf) || nf.Name != "redis@^4" || !strings.Contains(nf.Message, "available: 3.0.0 (project), 2.0.0 (user), 1.0.0 (builtin)") {
+		t.Errorf("ResolveVersion(^4) error = %v, want NotFoundError listing versions", err)
+	}
+	var verr *errors.ValidationError
+	if _, err := r.ResolveVersion("redis", "latest"); !stderrors.As(err, &verr) || verr.Field != "packVersion" {
+		t.Errorf("ResolveVersion(latest) error = %v, want packVersion ValidationError", err)
+	}
+	var perr *errors.PackError
+	if _, err := r.ResolveVersion("kafka", "*"); !stderrors.As(err, &perr) {
+		t.Errorf("ResolveVersion(kafka) error = %v, want PackError", err)
+	}
+}
+
+func TestPackRegistry_ResolveService(t *testing.T) {
+	r, projectPacks, _ := testRegistry(t)
+	project := filepath.Dir(projectPacks)
+	lock := "services:\n" +
+		"  cache: {pack: redis, version: 2.0.0, source: user}\n" +
+		"  queue: {pack: redis, version: 2.0.0, source: user}\n" +
+		"  db: {pack: postgres, version: 9.9.9, source: user}\n" +
+		"  old: {pack: nats, version: 1.0.0, source: builtin}\n"
+	if err := os.WriteFile(filepath.Join(project, FileProjectLock), []byte(lock), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewPackRegistry(WithProjectDir(project), WithUserDir(r.userDir), WithBuiltins(r.builtins))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		svc         *config.Service
+		wantVersion string
+	}{
+		{&config.Service{Name: "cache", Pack: "redis"}, "2.0.0"},                    // pinned over the project's 3.0.0
+		{&config.Service{Name: "queue", Pack: "redis", PackVersion: "^3"}, "3.0.0"}, // pin no longer satisfies
+		{&config.Service{Name: "events", Pack: "nats"}, "1.0.0"},                    // not locked yet
+	}
+	for _, tc := range tests {
+		pack, err := r.ResolveService(tc.svc)
+		if err != nil {
+			t.Fatalf("ResolveService(%s) error = %v", tc.svc.Name, err)
+		}
+		if pack.Version() != tc.wantVersion {
+			t.Errorf("ResolveService(%s) = %s, want %s", tc.svc.Name, pack.Version(), tc.wantVersion)
+		}
+	}
+	_, err = r.ResolveService(&config.Service{Name: "db", Pack: "postgres"})
+	var nf *errors.NotFoundError
+	if !stderrors.As(err, &nf) || !strings.Contains(nf.Message, "delete services.db from yar.lock") || !strings.Contains(nf.Message, "2.0.0 (user), 1.0.0 (builtin)") {
+		t.Errorf("ResolveService(db) error = %v, want NotFoundError for the pinned version", err)
+	}
+
+	services := []*config.Service{{Name: "cache"}, {Name: "queue"}, {Name: "events"}, {Name: "db"}}
+	log := action.NewLog(false)
+	if err := r.WriteProjectLock(services, log); err != nil {
+		t.Fatalf("WriteProjectLock() error = %v", err)
+	}
+	got, err := ReadProjectLock(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*LockedPack{
+		"cache":  {Pack: "redis", Version: "2.0.0", Source: SourceUser},
+		"queue":  {Pack: "redis", Version: "3.0.0", Source: SourceProject},
+		"events": {Pack: "nats", Version: "1.0.0", Source: SourceBuiltin},
+		"db":     {Pack: "postgres", Version: "9.9.9", Source: SourceUser},
+	}
+	if diff := cmp.Diff(want, got.Services); diff != "" {
+		t.Errorf("yar.lock mismatch (-want +got):\n%s", diff)
+	}
+	if err := r.WriteProjectLock(services, log); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(log.Actions()); n != 1 {
+		t.Errorf("WriteProjectLock() wrote %d times, want once for an unchanged lock", n)
+	}
+}
+
+func TestPackRegistry_MinYarVersion(t *testing.T) {
+	builtins := validPack("nats")
+	builtins["nats/meta.yaml"] = &fstest.MapFile{Data: []byte("name: nats\nversion: 1.0.0\nminYarVersion: 0.5.0\n")}
+
+	for version, wantErr := range map[string]bool{"0.4.2": true, "v0.5.0": false, "1.0.0": false, "dev": false, "": false} {
+		r, err := NewPackRegistry(WithUserDir(t.TempDir()), WithBuiltins(builtins), WithYarVersion(version))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = r.Resolve("nats")
+		var perr *errors.PackError
+		if gotErr := stderrors.As(err, &perr); gotErr != wantErr {
+			t.Errorf("yar %q: Resolve() error = %v, want error %v", version, err, wantErr)
+		}
+		if wantErr && !strings.Contains(err.Error(), "needs yar 0.5.0 or newer") {
+			t.Errorf("yar %q: Resolve() error = %v", version, err)
+		}
+		if entries, _ := r.List(); (entries[0].Err != nil) != wantErr {
+			t.Errorf("yar %q: List() entry error = %v", version, entries[0].Err)
+		}
+	}
+}
+
+func TestPackRegistry_List(t *testing.T) {
+	r, projectPacks, userPacks := testRegistry(t)
+
+	entries, err := r.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	type row struct {
+		Name, Version string
+		Source        Source
+		Path          string
+		ShadowedBy    Source
+	}
+	var got []row
+	for _, e := range entries {
+		version, _ := e.Describe()
+		got = append(got, row{e.Name, version, e.Source, e.Path, e.ShadowedBy})
+	}
+	want := []row{
+		{"kafka", "-", SourceProject, filepath.Join(projectPacks, "kafka"), ""},
+		{"nats", "1.0.0", SourceBuiltin, "", ""},
+		{"postgres", "2.0.0", SourceUser, filepath.Join(userPacks, "postgres"), ""},
+		{"postgres", "1.0.0", SourceBuiltin, "", SourceUser},
+		{"redis", "3.0.0", SourceProject, filepath.Join(projectPacks, "redis"), ""},
+		{"redis", "2.0.0", SourceUser, filepath.Join(userPacks, "redis"), SourceProject},
+		{"redis", "1.0.0", SourceBuiltin, "", SourceProject},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("List() mismatch (-want +got):\n%s", diff)
+	}
+
+	if entries[0].Active() != true || entries[0].Err == nil {
+		t.Errorf("kafka entry = %+v, want active with a load error", entries[0])
+	}
+	if _, desc := entries[0].Describe(); !strings.HasPrefix(desc, "invalid: pack error: kafka: meta.yaml") {
+		t.Errorf("Describe() description = %q", desc)
+	}
+	if entries[3].Active() {
+		t.Errorf("shadowed postgres entry is active")
+	}
+}
+
+func TestPackRegistry_MissingDirectories(t *testing.T) {
+	r, err := NewPackRegistry(WithProjectDir(t.TempDir()), WithUserDir(filepath.Join(t.TempDir(), "none")), WithBuiltins(nil))
+	if err != nil {
+		t.Fatalf("NewPackRegistry() error = %v", err)
+	}
+	entries, err := r.List()
+	if err != nil || len(entries) != 0 {
+		t.Errorf("List() = %v, %v, want no packs", entries, err)
+	}
+	if got := len(r.Sources()); got != 2 {
+		t.Errorf("Sources() has %d entries, want project and user", got)
+	}
+}
+
+func TestBuiltinPacks(t *testing.T) {
+	r, err := NewPackRegistry(WithUserDir(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewPackRegistry() error = %v", err)
+	}
+	entries, err := r.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.Err != nil {
+			t.Errorf("built-in pack %s: %v", e.Name, e.Err)
+		}
+		if e.Source != SourceBuiltin {
+			t.Errorf("pack %s source = %s, want builtin", e.Name, e.Source)
+		}
+		names = append(names, e.Name)
+	}
+	if diff := cmp.Diff([]string{"container", "kafka", "postgres", "redis"}, names); diff != "" {
+		t.Errorf("built-in packs mismatch (-want +got):\n%s", diff)
+	}
+}
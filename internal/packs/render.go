@@ -0,0 +1,445 @@
+package packs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Target is an output format packs are rendered for.
+type Target string
+
+// Output targets.
+const (
+	TargetCompose  Target = "compose"
+	TargetHelm     Target = "helm"
+	TargetManifest Target = "manifest"
+)
+
+// Targets lists every output target.
+var Targets = []Target{TargetCompose, TargetHelm, TargetManifest}
+
+// Kubernetes reports whether the target runs on Kubernetes.
+func (t Target) Kubernetes() bool {
+	return t == TargetHelm || t == TargetManifest
+}
+
+// Where rendered references point on compose.
+const (
+	ComposeSecretsDir = "/run/secrets"
+	ComposeConfigsDir = "/run/configs"
+)
+
+// RenderContext is what a pack is rendered for.
+type RenderContext struct {
+	Project     string
+	Environment string
+	Service     *config.Service // with params resolved by Pack.Params
+	Target      Target
+	SecretStore string // ESO ClusterSecretStore; empty for Secrets created by yar on Kubernetes targets
+}
+
+// TemplateData is the data pack templates are executed with. It holds
+// references to secrets, never their values: rendering has no access to
+// a secret provider.
+type TemplateData struct {
+	Params       map[string]any
+	Project      ProjectData
+	Service      ServiceData
+	Environment  EnvironmentData
+	Dependencies map[string]DependencyData // by dependency name
+}
+
+// ProjectData is the project as templates see it.
+type ProjectData struct {
+	Name string
+}
+
+// ServiceData is the service as templates see it.
+type ServiceData struct {
+	Name      string
+	Namespace string
+	Pack      string
+	Replicas  int
+	Requires  []string
+}
+
+// DependencyData is a dependency of the pack as templates see it.
+type DependencyData struct {
+	Name string // service the dependency runs as, see DependencyService
+	Pack string
+}
+
+// EnvironmentData is the environment as templates see it.
+type EnvironmentData struct {
+	Name   string
+	Target Target
+}
+
+// Rendered is a pack rendered for a service.
+type Rendered struct {
+	Resources  *Resources
+	Secrets    []SecretBinding    // secrets referenced by env entries and secretRef, in order of first use
+	ConfigMaps []ConfigMapBinding // configMapRef references, in order of first use
+}
+
+// SecretBinding is a secret a rendered pack references, and where the
+// target finds it at runtime. Generators turn bindings into compose
+// secrets, Kubernetes Secrets or ESO ExternalSecrets.
+type SecretBinding struct {
+	Ref      string `json:"ref" yaml:"ref"`                               // key in the secret provider
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty"` // from a provider-qualified reference
+	Env      string `json:"env,omitempty" yaml:"env,omitempty"`           // from an environment-scoped reference
+	Name     string `json:"name" yaml:"name"`                             // compose secret, or Kubernetes Secret or ExternalSecret target
+	Key      string `json:"key" yaml:"key"`                               // key in the Kubernetes Secret
+	Store    string `json:"store,omitempty" yaml:"store,omitempty"`       // ESO ClusterSecretStore, if the secret comes through ESO
+}
+
+// ConfigMapBinding is a key of one of the pack's configMaps referenced
+// through configMapRef.
+type ConfigMapBinding struct {
+	ConfigMap string `json:"configMap" yaml:"configMap"` // name in spec.configMaps
+	Key       string `json:"key" yaml:"key"`
+	Name      string `json:"name" yaml:"name"` // compose config or Kubernetes ConfigMap
+}
+
+// Render executes the pack's resources.yaml for ctx and parses the result
+// (see ParseResources). Template failures are pack errors at the failing
+// template's line.
+func (p *Pack) Render(ctx RenderContext) (*Rendered, error) {
+	r := &renderer{pack: p, ctx: ctx, secrets: map[string]bool{}, configMaps: map[string]bool{}}
+	tmpl, err := p.Templates.Clone()
+	if err != nil {
+		return nil, &errors.PackError{Pack: p.Name(), Message: "failed to prepare templates", Err: err}
+	}
+	tmpl.Funcs(r.funcs(tmpl))
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, FileResources, r.data()); err != nil {
+		return nil, r.execError(err)
+	}
+
+	res, err := ParseResources(p.Name(), buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range res.Spec.Containers {
+		for _, e := range c.Env {
+			if e.SecretRef != "" {
+				r.bindSecret(e.SecretRef)
+			}
+		}
+	}
+	if err := r.checkConfigMaps(res); err != nil {
+		return nil, err
+	}
+	return &Rendered{Resources: res, Secrets: r.bound, ConfigMaps: r.boundConfigMaps}, nil
+}
+
+// renderer renders one pack for one RenderContext.
+type renderer struct {
+	pack            *Pack
+	ctx             RenderContext
+	bound           []SecretBinding
+	secrets         map[string]bool // bound refs
+	boundConfigMaps []ConfigMapBinding
+	configMaps      map[string]bool // bound configMap/key pairs
+}
+
+func (r *renderer) data() TemplateData {
+	svc := r.ctx.Service
+	if svc == nil {
+		svc = &config.Service{}
+	}
+	params := svc.Params
+	if params == nil {
+		params = map[string]any{}
+	}
+	deps := make(map[string]DependencyData, len(r.pack.Meta.Dependencies))
+	for _, dep := range r.pack.Meta.Dependencies {
+		deps[dep.Name] = DependencyData{Name: DependencyService(svc.Name, dep), Pack: dep.Pack}
+	}
+	return TemplateData{
+		Params:  params,
+		Project: ProjectData{Name: r.ctx.Project},
+		Service: ServiceData{
+			Name:      svc.Name,
+			Namespace: svc.Namespace,
+			Pack:      svc.Pack,
+			Replicas:  svc.Replicas,
+			Requires:  append([]string(nil), svc.Requires...),
+		},
+		Environment:  EnvironmentData{Name: r.ctx.Environment, Target: r.ctx.Target},
+		Dependencies: deps,
+	}
+}
+
+// funcs returns the implementations of FuncNames for tmpl.
+func (r *renderer) funcs(tmpl *template.Template) template.FuncMap {
+	return template.FuncMap{
+		"default":  defaultFunc,
+		"required": requiredFunc,
+		"include": func(name string, data any) (string, error) {
+			var buf bytes.Buffer
+			if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+				return "", err
+			}
+			return buf.String(), nil
+		},
+		"toYaml":       toYaml,
+		"toJson":       toJSON,
+		"indent":       indent,
+		"nindent":      func(n int, s string) string { return "\n" + indent(n, s) },
+		"quote":        quote,
+		"squote":       squote,
+		"secretRef":    r.secretRef,
+		"configMapRef": r.configMapRef,
+	}
+}
+
+// secretRef renders a reference to a secret for the target: the path of
+// its compose secret file, or a secretKeyRef on Kubernetes. ref is a
+// reference as written in yar.yaml: a key, or a mapping with key and
+// optional provider and env.
+func (r *renderer) secretRef(ref any) (string, error) {
+	b, err := parseSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	b = r.bind(b)
+	if !r.ctx.Target.Kubernetes() {
+		return ComposeSecretsDir + "/" + b.Name, nil
+	}
+	return toJSON(map[string]any{"secretKeyRef": map[string]string{"name": b.Name, "key": b.Key}})
+}
+
+// bindSecret records an env secretRef; it is validated by ParseResources.
+func (r *renderer) bindSecret(ref string) {
+	r.bind(SecretBinding{Ref: ref})
+}
+
+// bind completes b for the target and records it once.
+func (r *renderer) bind(b SecretBinding) SecretBinding {
+	b.Key = SecretKey(b.Ref)
+	if r.ctx.Target.Kubernetes() {
+		b.Name = r.serviceName() + "-secrets"
+		b.Store = r.ctx.SecretStore
+	} else {
+		b.Name = b.Key
+	}
+	id := b.Provider + "\x00" + b.Env + "\x00" + b.Ref
+	if !r.secrets[id] {
+		r.secrets[id] = true
+		r.bound = append(r.bound, b)
+	}
+	return b
+}
+
+// configMapRef renders a reference to key of one of the pack's
+// configMaps: the path of the compose config file, or a configMapKeyRef
+// on Kubernetes.
+func (r *renderer) configMapRef(name, key string) (string, error) {
+	if name == "" || key == "" {
+		return "", fmt.Errorf("configMapRef needs a configMap name and a key")
+	}
+	full := r.serviceName() + "-" + name
+	if id := name + "\x00" + key; !r.configMaps[id] {
+		r.configMaps[id] = true
+		r.boundConfigMaps = append(r.boundConfigMaps, ConfigMapBinding{ConfigMap: name, Key: key, Name: full})
+	}
+	if !r.ctx.Target.Kubernetes() {
+		return ComposeConfigsDir + "/" + full + "/" + key, nil
+	}
+	return toJSON(map[string]any{"configMapKeyRef": map[string]string{"name": full, "key": key}})
+}
+
+// checkConfigMaps reports configMapRef references to configMaps or keys
+// the rendered spec does not declare.
+func (r *renderer) checkConfigMaps(res *Resources) error {
+	for _, b := range r.boundConfigMaps {
+		var data map[string]string
+		found := false
+		for _, cm := range res.Spec.ConfigMaps {
+			if cm.Name == b.ConfigMap {
+				data, found = cm.Data, true
+				break
+			}
+		}
+		file := DirTemplates + "/" + FileResources
+		if !found {
+			return &errors.PackError{Pack: r.pack.Name(), File: file, Message: fmt.Sprintf("configMapRef: spec.configMaps has no configMap %q", b.ConfigMap)}
+		}
+		if _, ok := data[b.Key]; !ok {
+			return &errors.PackError{Pack: r.pack.Name(), File: file, Message: fmt.Sprintf("configMapRef: configMap %q has no key %q", b.ConfigMap, b.Key)}
+		}
+	}
+	return nil
+}
+
+func (r *renderer) serviceName() string {
+	if r.ctx.Service != nil && r.ctx.Service.Name != "" {
+		return r.ctx.Service.Name
+	}
+	return r.pack.Name()
+}
+
+// execPattern matches the context text/template puts before the error of
+// a failing call.
+var execPattern = regexp.MustCompile(`^executing "[^"]*" at <.*?>: (?:error calling \w+: )?(.*)$`)
+
+// execError turns a template execution error into a pack error at the
+// innermost failing template and line.
+func (r *renderer) execError(err error) error {
+	file, line, msg := "", 0, err.Error()
+	for {
+		m := templateLinePattern.FindStringSubmatch(msg)
+		if m == nil {
+			break
+		}
+		file = DirTemplates + "/" + m[1]
+		line, _ = strconv.Atoi(m[2])
+		msg = m[3]
+		if e := execPattern.FindStringSubmatch(msg); e != nil {
+			msg = e[1]
+		}
+	}
+	if file == "" {
+		return &errors.PackError{Pack: r.pack.Name(), File: DirTemplates + "/" + FileResources, Message: "template failed", Err: err}
+	}
+	return &errors.PackError{Pack: r.pack.Name(), File: file, Line: line, Message: "template failed: " + msg}
+}
+
+// parseSecretRef parses a secret reference: a key, or a mapping with key
+// and optional provider and env.
+func parseSecretRef(ref any) (SecretBinding, error) {
+	switch v := ref.(type) {
+	case string:
+		if v == "" {
+			return SecretBinding{}, fmt.Errorf("secretRef needs a secret reference")
+		}
+		return SecretBinding{Ref: v}, nil
+	case map[string]any:
+		var b SecretBinding
+		for k, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return SecretBinding{}, fmt.Errorf("secretRef: %s must be a string", k)
+			}
+			switch k {
+			case "key":
+				b.Ref = s
+			case "provider":
+				b.Provider = s
+			case "env":
+				b.Env = s
+			default:
+				return SecretBinding{}, fmt.Errorf("secretRef: unknown field %s (want key, provider, env)", k)
+			}
+		}
+		if b.Ref == "" {
+			return SecretBinding{}, fmt.Errorf("secretRef: key is required")
+		}
+		return b, nil
+	case nil:
+		return SecretBinding{}, fmt.Errorf("secretRef needs a secret reference")
+	}
+	return SecretBinding{}, fmt.Errorf("secretRef: reference must be a string or a mapping (got %T)", ref)
+}
+
+// secretKeyChars matches characters not allowed in Secret keys.
+var secretKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]+`)
+
+// SecretKey returns the Secret key and compose secret name of ref.
+func SecretKey(ref string) string {
+	return secretKeyChars.ReplaceAllString(ref, "_")
+}
+
+// empty reports whether v is empty in the sense of default and required:
+// nil, false, zero, or an empty string, slice or map.
+func empty(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+// defaultFunc returns value, or def if value is empty. Used as
+// {{ .Params.image | default "redis:7" }}.
+func defaultFunc(def any, value ...any) any {
+	if len(value) == 0 || empty(value[0]) {
+		return def
+	}
+	return value[0]
+}
+
+// requiredFunc fails rendering with msg if value is nil or "".
+func requiredFunc(msg string, value any) (any, error) {
+	if s, ok := value.(string); value == nil || (ok && s == "") {
+		return nil, fmt.Errorf("%s", msg)
+	}
+	return value, nil
+}
+
+// toYaml returns v as YAML without the trailing newline.
+func toYaml(v any) (string, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// toJSON returns v as compact JSON.
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// indent prefixes every line of s with n spaces.
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// quote returns its arguments as double-quoted strings, separated by
+// spaces. Nil arguments are skipped.
+func quote(args ...any) string {
+	var out []string
+	for _, a := range args {
+		if a != nil {
+			out = append(out, strconv.Quote(fmt.Sprint(a)))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// squote returns its arguments as single-quoted YAML strings, separated
+// by spaces. Nil arguments are skipped.
+func squote(args ...any) string {
+	var out []string
+	for _, a := range args {
+		if a != nil {
+			out = append(out, "'"+strings.ReplaceAll(fmt.Sprint(a), "'", "''")+"'")
+		}
+	}
+	return strings.Join(out, " ")
+}
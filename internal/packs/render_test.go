@@ -0,0 +1,332 @@
+package packs
+
+import (
+	stderrors "errors"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+// renderPack returns a pack "app" whose resources.yaml is tmpl.
+func renderPack(t *testing.T, tmpl string, extra map[string]string) *Pack {
+	t.Helper()
+	fsys := validPack("app")
+	fsys["app/templates/resources.yaml"] = &fstest.MapFile{Data: []byte(tmpl)}
+	for name, data := range extra {
+		fsys["app/templates/"+name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	pack, err := LoadFS(fsys, "app")
+	if err != nil {
+		t.Fatalf("LoadFS() error = %v", err)
+	}
+	return pack
+}
+
+func renderContext(target Target, params map[string]any) RenderContext {
+	return RenderContext{
+		Project:     "shop",
+		Environment: "local",
+		Service:     &config.Service{Name: "web", Pack: "app", Params: params},
+		Target:      target,
+	}
+}
+
+func TestRender_Funcs(t *testing.T) {
+	const tmpl = `apiVersion: yar.io/v1
+kind: Pack
+metadata:
+  name: {{ .Service.Name }}
+spec:
+  containers:
+    - name: app
+      image: {{ .Params.image | default "app:latest" }}
+      command: [{{ required "cmd is required" .Params.cmd | squote }}]
+      env:
+        - name: PROJECT
+          value: {{ .Project.Name | quote }}
+        - name: ENV
+          value: {{ printf "%s/%s" .Environment.Name .Environment.Target | quote }}
+        - name: LABELS
+          value: {{ toJson .Params.labels | quote }}
+  configMaps:
+    - name: settings
+      data:
+        app.yaml: |
+          {{- toYaml .Params.settings | nindent 10 }}
+        banner.txt: |
+{{ include "files/banner.txt" . | indent 10 }}
+`
+	pack := renderPack(t, tmpl, map[string]string{"files/banner.txt": "{{ .Service.Name }}\nit's {{ .Params.cmd }}"})
+	params := map[string]any{
+		"cmd":      "it's",
+		"image":    "",
+		"labels":   map[string]any{"team": "core"},
+		"settings": map[string]any{"debug": true, "workers": 2},
+	}
+
+	got, err := pack.Render(renderContext(TargetCompose, params))
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	c := got.Resources.Spec.Containers[0]
+	if c.Image != "app:latest" || c.Command[0] != "it's" {
+		t.Errorf("container = %+v", c)
+	}
+	wantEnv := []EnvVar{
+		{Name: "PROJECT", Value: "shop"},
+		{Name: "ENV", Value: "local/compose"},
+		{Name: "LABELS", Value: `{"team":"core"}`},
+	}
+	if diff := cmp.Diff(wantEnv, c.Env); diff != "" {
+		t.Errorf("env mismatch (-want +got):\n%s", diff)
+	}
+	wantData := map[string]string{
+		"app.yaml":   "debug: true\nworkers: 2\n",
+		"banner.txt": "web\nit's it's\n",
+	}
+	if diff := cmp.Diff(wantData, got.Resources.Spec.ConfigMaps[0].Data); diff != "" {
+		t.Errorf("configMap data mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRender_FuncNames(t *testing.T) {
+	r := &renderer{}
+	var got []string
+	for name := range r.funcs(nil) {
+		got = append(got, name)
+	}
+	want := append([]string(nil), FuncNames...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("render funcs do not match FuncNames (-want +got):\n%s", diff)
+	}
+}
+
+func TestRender_SecretRef(t *testing.T) {
+	const tmpl = `apiVersion: yar.io/v1
+kind: Pack
+spec:
+  containers:
+    - name: app
+      image: app
+      env:
+        - name: DB_PASSWORD
+          secretRef: db/password
+  configMaps:
+    - name: refs
+      data:
+        token: {{ secretRef .Params.tokenRef | squote }}
+        api: {{ secretRef .Params.apiRef | squote }}
+        again: {{ secretRef "db/password" | squote }}
+        config: {{ configMapRef "refs" "token" | squote }}
+`
+	pack := renderPack(t, tmpl, nil)
+	params := map[string]any{
+		"tokenRef": "app_token",
+		"apiRef":   map[string]any{"provider": "azure", "key": "api-key", "env": "prod"},
+	}
+
+	tests := map[string]struct {
+		target      Target
+		store       string
+		wantData    map[string]string
+		wantSecrets []SecretBinding
+	}{
+		"compose": {
+			target: TargetCompose,
+			wantData: map[string]string{
+				"token":  "/run/secrets/app_token",
+				"api":    "/run/secrets/api-key",
+				"again":  "/run/secrets/db_password",
+				"config": "/run/configs/web-refs/token",
+			},
+			wantSecrets: []SecretBinding{
+				{Ref: "app_token", Name: "app_token", Key: "app_token"},
+				{Ref: "api-key", Provider: "azure", Env: "prod", Name: "api-key", Key: "api-key"},
+				{Ref: "db/password", Name: "db_password", Key: "db_password"},
+			},
+		},
+		"kubernetes": {
+			target: TargetManifest,
+			wantData: map[string]string{
+				"token":  `{"secretKeyRef":{"key":"app_token","name":"web-secrets"}}`,
+				"api":    `{"secretKeyRef":{"key":"api-key","name":"web-secrets"}}`,
+				"again":  `{"secretKeyRef":{"key":"db_password","name":"web-secrets"}}`,
+				"config": `{"configMapKeyRef":{"key":"token","name":"web-refs"}}`,
+			},
+			wantSecrets: []SecretBinding{
+				{Ref: "app_token", Name: "web-secrets", Key: "app_token"},
+				{Ref: "api-key", Provider: "azure", Env: "prod", Name: "web-secrets", Key: "api-key"},
+				{Ref: "db/password", Name: "web-secrets", Key: "db_password"},
+			},
+		},
+		"eso": {
+			target: TargetHelm,
+			store:  "github",
+			wantData: map[string]string{
+				"token":  `{"secretKeyRef":{"key":"app_token","name":"web-secrets"}}`,
+				"api":    `{"secretKeyRef":{"key":"api-key","name":"web-secrets"}}`,
+				"again":  `{"secretKeyRef":{"key":"db_password","name":"web-secrets"}}`,
+				"config": `{"configMapKeyRef":{"key":"token","name":"web-refs"}}`,
+			},
+			wantSecrets: []SecretBinding{
+				{Ref: "app_token", Name: "web-secrets", Key: "app_token", Store: "github"},
+				{Ref: "api-key", Provider: "azure", Env: "prod", Name: "web-secrets", Key: "api-key", Store: "github"},
+				{Ref: "db/password", Name: "web-secrets", Key: "db_password", Store: "github"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := renderContext(tc.target, params)
+			ctx.SecretStore = tc.store
+			got, err := pack.Render(ctx)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if diff := cmp.Diff(tc.wantData, got.Resources.Spec.ConfigMaps[0].Data); diff != "" {
+				t.Errorf("rendered references mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantSecrets, got.Secrets); diff != "" {
+				t.Errorf("Secrets mismatch (-want +got):\n%s", diff)
+			}
+			if len(got.ConfigMaps) != 1 || got.ConfigMaps[0] != (ConfigMapBinding{ConfigMap: "refs", Key: "token", Name: "web-refs"}) {
+				t.Errorf("ConfigMaps = %+v", got.ConfigMaps)
+			}
+		})
+	}
+}
+
+func TestRender_Errors(t *testing.T) {
+	const head = "apiVersion: yar.io/v1\nkind: Pack\nspec:\n  containers:\n    - name: app\n"
+
+	tests := map[string]struct {
+		tmpl     string
+		wantFile string
+		wantLine int
+		wantMsg  string
+	}{
+		"required":           {head + "      image: {{ required \"image is required\" .Params.image }}\n", "templates/resources.yaml", 6, "template failed: image is required"},
+		"include failure":    {head + "      image: app\n      args: [{{ include \"files/args\" . }}]\n", "templates/files/args", 2, "template failed: args missing"},
+		"include unknown":    {head + "      image: {{ include \"files/none\" . }}\n", "templates/resources.yaml", 6, `no template "files/none"`},
+		"secret value":       {head + "      image: {{ .Secrets.password }}\n", "templates/resources.yaml", 6, "can't evaluate field Secrets"},
+		"secretRef empty":    {head + "      image: {{ secretRef .Params.missing }}\n", "templates/resources.yaml", 6, "secretRef needs a secret reference"},
+		"secretRef mapping":  {head + "      image: {{ secretRef .Params.ref }}\n", "templates/resources.yaml", 6, "secretRef: key is required"},
+		"configMap missing":  {head + "      image: {{ configMapRef \"none\" \"key\" }}\n", "templates/resources.yaml", 0, `spec.configMaps has no configMap "none"`},
+		"rendered spec":      {head + "      image: \"\"\n", "templates/resources.yaml", 3, "invalid spec"},
+		"secretRef bad type": {head + "      image: {{ secretRef 1 }}\n", "templates/resources.yaml", 6, "must be a string or a mapping"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			pack := renderPack(t, tc.tmpl, map[string]string{"files/args": "a,\n{{ required \"args missing\" .Params.args }}"})
+			_, err := pack.Render(renderContext(TargetCompose, map[string]any{"ref": map[string]any{"provider": "azure"}}))
+			var perr *errors.PackError
+			if !stderrors.As(err, &perr) {
+				t.Fatalf("Render() error = %v, want PackError", err)
+			}
+			if perr.File != tc.wantFile || perr.Line != tc.wantLine || !strings.Contains(err.Error(), tc.wantMsg) {
+				t.Errorf("Render() error at %s:%d = %v, want %s:%d %q", perr.File, perr.Line, err, tc.wantFile, tc.wantLine, tc.wantMsg)
+			}
+		})
+	}
+}
+
+func TestRender_Builtins(t *testing.T) {
+	r, err := NewPackRegistry(WithUserDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := []*config.Service{
+		{Name: "cache", Pack: "redis"},
+		{Name: "db", Pack: "postgres", Params: map[string]any{"passwordRef": "db_password"}},
+		{Name: "events", Pack: "kafka", Params: map[string]any{"topics": []any{"orders"}}},
+	}
+	services, err = ApplyParams(r, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, svc := range services {
+		pack, err := r.Resolve(svc.Pack)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, target := range Targets {
+			got, err := pack.Render(RenderContext{Project: "shop", Environment: "local", Service: svc, Target: target})
+			if err != nil {
+				t.Errorf("Render(%s, %s) error = %v", svc.Pack, target, err)
+				continue
+			}
+			if got.Resources.Metadata.Name != svc.Name {
+				t.Errorf("Render(%s, %s) metadata.name = %q", svc.Pack, target, got.Resources.Metadata.Name)
+			}
+		}
+	}
+}
+
+func TestRender_Dependencies(t *testing.T) {
+	fsys := validPack("app")
+	fsys["app/meta.yaml"] = &fstest.MapFile{Data: []byte("name: app\nversion: 1.0.0\ndependencies:\n  - name: db\n    pack: postgres\n")}
+	fsys["app/templates/resources.yaml"] = &fstest.MapFile{Data: []byte(`apiVersion: yar.io/v1
+kind: Pack
+metadata:
+  name: {{ .Service.Name }}
+spec:
+  containers:
+    - name: app
+      image: app
+      env:
+        - name: DATABASE_HOST
+          value: {{ .Dependencies.db.Name }}
+        - name: DATABASE_PACK
+          value: {{ .Dependencies.db.Pack }}
+`)}
+	pack, err := LoadFS(fsys, "app")
+	if err != nil {
+		t.Fatalf("LoadFS() error = %v", err)
+	}
+	got, err := pack.Render(renderContext(TargetCompose, nil))
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	want := []EnvVar{{Name: "DATABASE_HOST", Value: "web-db"}, {Name: "DATABASE_PACK", Value: "postgres"}}
+	if diff := cmp.Diff(want, got.Resources.Spec.Containers[0].Env); diff != "" {
+		t.Errorf("env (-want +got):\n%s", diff)
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	if got := defaultFunc("x", 0); got != "x" {
+		t.Errorf("default on 0 = %v", got)
+	}
+	if got := defaultFunc("x", []any{}); got != "x" {
+		t.Errorf("default on empty list = %v", got)
+	}
+	if got := defaultFunc("x", "y"); got != "y" {
+		t.Errorf("default on value = %v", got)
+	}
+	if got := defaultFunc("x"); got != "x" {
+		t.Errorf("default without value = %v", got)
+	}
+	if _, err := requiredFunc("need it", false); err != nil {
+		t.Errorf("required(false) error = %v; only nil and \"\" are missing", err)
+	}
+	if got := quote("a\"b", nil, 5); got != `"a\"b" "5"` {
+		t.Errorf("quote = %s", got)
+	}
+	if got := squote("it's"); got != "'it''s'" {
+		t.Errorf("squote = %s", got)
+	}
+	if got := indent(2, "a\nb"); got != "  a\n  b" {
+		t.Errorf("indent = %q", got)
+	}
+}
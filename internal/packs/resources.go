@@ -0,0 +1,152 @@
+package packs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// FuncNames lists the functions pack templates may call.
+var FuncNames = []string{
+	"default", "required", "include", "toYaml", "toJson",
+	"indent", "nindent", "quote", "squote", "secretRef", "configMapRef",
+}
+
+// parseFuncs declares FuncNames so templates compile. Loading only
+// compiles templates; rendering binds the implementations.
+func parseFuncs() template.FuncMap {
+	funcs := make(template.FuncMap, len(FuncNames))
+	for _, name := range FuncNames {
+		funcs[name] = func(...any) (string, error) {
+			return "", fmt.Errorf("%s is not available outside rendering", name)
+		}
+	}
+	return funcs
+}
+
+// ParseResources decodes and validates a rendered resources.yaml document
+// of pack. Unknown fields are errors, so typos in templates surface at
+// their line.
+func ParseResources(pack string, data []byte) (*Resources, error) {
+	file := DirTemplates + "/" + FileResources
+	l := &packLoader{name: pack}
+
+	var res Resources
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&res); err != nil && err != io.EOF {
+		return nil, l.yamlError(file, err)
+	}
+	var doc yaml.Node
+	_ = yaml.Unmarshal(data, &doc)
+
+	if res.APIVersion != APIVersion {
+		return nil, l.errorf(file, keyLine(&doc, "apiVersion"), nil, "apiVersion must be %s (got %q)", APIVersion, res.APIVersion)
+	}
+	if res.Kind != KindPack {
+		return nil, l.errorf(file, keyLine(&doc, "kind"), nil, "kind must be %s (got %q)", KindPack, res.Kind)
+	}
+	if errs := validateSpec(&res.Spec); len(errs) > 0 {
+		return nil, &errors.PackError{
+			Pack:    pack,
+			File:    file,
+			Line:    keyLine(&doc, "spec"),
+			Message: "invalid spec",
+			Err:     &errors.ValidationError{Field: "spec", Message: "invalid pack spec", Errors: errs},
+		}
+	}
+	return &res, nil
+}
+
+// validateSpec checks the fields of a rendered spec that YAML decoding
+// cannot, returning one message per problem.
+func validateSpec(spec *PackSpec) []string {
+	var errs []string
+	if len(spec.Containers) == 0 {
+		errs = append(errs, "spec.containers: at least one container is required")
+	}
+	for i, c := range spec.Containers {
+		field := fmt.Sprintf("spec.containers[%d]", i)
+		if c.Name == "" {
+			errs = append(errs, field+".name is required")
+		}
+		if c.Image == "" {
+			errs = append(errs, field+".image is required")
+		}
+		for j, p := range c.Ports {
+			if p.ContainerPort < 1 || p.ContainerPort > 65535 {
+				errs = append(errs, fmt.Sprintf("%s.ports[%d].containerPort must be between 1 and 65535 (got %d)", field, j, p.ContainerPort))
+			}
+			if p.Protocol != "" && p.Protocol != ProtocolTCP && p.Protocol != ProtocolUDP {
+				errs = append(errs, fmt.Sprintf("%s.ports[%d].protocol must be one of: tcp, udp (got %q)", field, j, p.Protocol))
+			}
+		}
+		for j, e := range c.Env {
+			if e.Name == "" {
+				errs = append(errs, fmt.Sprintf("%s.env[%d].name is required", field, j))
+			}
+			if e.Value != "" && e.SecretRef != "" {
+				errs = append(errs, fmt.Sprintf("%s.env[%d]: value and secretRef are mutually exclusive", field, j))
+			}
+		}
+		for j, v := range c.Volumes {
+			if v.Name == "" || v.MountPath == "" {
+				errs = append(errs, fmt.Sprintf("%s.volumes[%d]: name and mountPath are required", field, j))
+			}
+		}
+	}
+	for i, s := range spec.Services {
+		field := fmt.Sprintf("spec.services[%d]", i)
+		if s.Name == "" {
+			errs = append(errs, field+".name is required")
+		}
+		if s.Port < 1 || s.Port > 65535 {
+			errs = append(errs, fmt.Sprintf("%s.port must be between 1 and 65535 (got %d)", field, s.Port))
+		}
+		switch s.Type {
+		case "", ServiceClusterIP, ServiceNodePort, ServiceLoadBalancer:
+		default:
+			errs = append(errs, fmt.Sprintf("%s.type must be one of: ClusterIP, NodePort, LoadBalancer (got %q)", field, s.Type))
+		}
+	}
+	for i, job := range spec.Jobs {
+		field := fmt.Sprintf("spec.jobs[%d]", i)
+		if job.Name == "" {
+			errs = append(errs, field+".name is required")
+		}
+		if job.Image == "" {
+			errs = append(errs, field+".image is required")
+		}
+		if job.When != "" && job.When != config.JobBefore && job.When != config.JobAfter {
+			errs = append(errs, fmt.Sprintf("%s.when must be one of: before, after (got %q)", field, job.When))
+		}
+		if job.Run != "" && job.Run != config.JobRunAlways && job.Run != config.JobRunOnChange {
+			errs = append(errs, fmt.Sprintf("%s.run must be one of: always, onChange (got %q)", field, job.Run))
+		}
+	}
+	return errs
+}
+
+// ServiceJobs returns the jobs svc runs with its pack rendered as res: the
+// pack's spec.jobs, then the service's own jobs. A job of the service
+// replaces the pack's job of the same name.
+func ServiceJobs(svc *config.Service, res *Resources) []*config.Job {
+	own := make(map[string]bool, len(svc.Jobs))
+	for _, job := range svc.Jobs {
+		own[job.Name] = true
+	}
+	var jobs []*config.Job
+	if res != nil {
+		for _, job := range res.Spec.Jobs {
+			if !own[job.Name] {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	return append(jobs, svc.Jobs...)
+}
@@ -0,0 +1,105 @@
+package packs
+
+import (
+	stderrors "errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/yar-run/yar/internal/config"
+	"github.com/yar-run/yar/internal/errors"
+)
+
+const renderedRedis = `apiVersion: yar.io/v1
+kind: Pack
+metadata:
+  name: cache
+spec:
+  containers:
+    - name: redis
+      image: redis:7-alpine
+      ports:
+        - containerPort: 6379
+      env:
+        - name: REDIS_PASSWORD
+          secretRef: cache/password
+      readinessProbe:
+        tcpSocket:
+          port: 6379
+  services:
+    - name: cache
+      port: 6379
+  jobs:
+    - name: warm
+      image: redis:7-alpine
+      command: [redis-cli, ping]
+      when: after
+`
+
+func TestServiceJobs(t *testing.T) {
+	res := &Resources{Spec: PackSpec{Jobs: []*config.Job{
+		{Name: "create-topics", Image: "kafka"},
+		{Name: "migrate", Image: "pack-migrate"},
+	}}}
+	svc := &config.Service{Name: "events", Jobs: []*config.Job{{Name: "migrate", Image: "own-migrate"}}}
+
+	var got []string
+	for _, job := range ServiceJobs(svc, res) {
+		got = append(got, job.Name+"="+job.Image)
+	}
+	want := []string{"create-topics=kafka", "migrate=own-migrate"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ServiceJobs() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseResources(t *testing.T) {
+	res, err := ParseResources("redis", []byte(renderedRedis))
+	if err != nil {
+		t.Fatalf("ParseResources() error = %v", err)
+	}
+	if res.Metadata.Name != "cache" || len(res.Spec.Containers) != 1 || len(res.Spec.Services) != 1 {
+		t.Fatalf("Resources = %+v", res)
+	}
+	c := res.Spec.Containers[0]
+	if c.Ports[0].ContainerPort != 6379 || c.Env[0].SecretRef != "cache/password" || c.ReadinessProbe.TCPSocket.Port != 6379 {
+		t.Errorf("Container = %+v", c)
+	}
+	if job := res.Spec.Jobs[0]; job.Name != "warm" || job.Phase() != "after" || len(job.Command) != 2 {
+		t.Errorf("Jobs[0] = %+v", job)
+	}
+}
+
+func TestParseResources_Errors(t *testing.T) {
+	tests := map[string]struct {
+		data     string
+		wantLine int
+		wantMsg  string
+	}{
+		"api version":   {strings.Replace(renderedRedis, "yar.io/v1", "yar.io/v2", 1), 1, "apiVersion must be yar.io/v1"},
+		"kind":          {strings.Replace(renderedRedis, "kind: Pack", "kind: Chart", 1), 2, "kind must be Pack"},
+		"unknown field": {strings.Replace(renderedRedis, "      ports:", "      portz:", 1), 9, "field portz not found"},
+		"syntax":        {strings.Replace(renderedRedis, "kind: Pack", "kind: Pack\n  extra: x", 1), 3, "invalid YAML"},
+		"no image":      {strings.Replace(renderedRedis, "      image: redis:7-alpine\n      ports", "      ports", 1), 5, "spec.containers[0].image is required"},
+		"bad port":      {strings.Replace(renderedRedis, "containerPort: 6379", "containerPort: 70000", 1), 5, "containerPort must be between 1 and 65535"},
+		"env both":      {strings.Replace(renderedRedis, "secretRef: cache/password", "secretRef: cache/password\n          value: hunter2", 1), 5, "value and secretRef are mutually exclusive"},
+		"service type":  {strings.Replace(renderedRedis, "      port: 6379\n  jobs", "      port: 6379\n      type: External\n  jobs", 1), 5, "type must be one of"},
+		"job when":      {strings.Replace(renderedRedis, "when: after", "when: later", 1), 5, "spec.jobs[0].when must be one of"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseResources("redis", []byte(tc.data))
+			var perr *errors.PackError
+			if !stderrors.As(err, &perr) {
+				t.Fatalf("ParseResources() error = %v, want PackError", err)
+			}
+			if perr.File != "templates/resources.yaml" || perr.Line != tc.wantLine {
+				t.Errorf("PackError at %s:%d, want line %d (%v)", perr.File, perr.Line, tc.wantLine, err)
+			}
+			if !strings.Contains(err.Error(), tc.wantMsg) {
+				t.Errorf("ParseResources() error = %v, want %q", err, tc.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package packs
+
+import (
+	"text/template"
+
+	"github.com/yar-run/yar/internal/config"
+)
+
+// Files and directories of a pack.
+const (
+	FileMeta      = "meta.yaml"
+	FileSchema    = "schema.json"
+	FileDefaults  = "defaults.yaml"
+	DirTemplates  = "templates"
+	FileResources = "resources.yaml" // main template, relative to DirTemplates
+)
+
+// Identity of a rendered resources.yaml document.
+const (
+	APIVersion = "yar.io/v1"
+	KindPack   = "Pack"
+)
+
+// Pack is a loaded and validated pack.
+type Pack struct {
+	Meta      PackMeta
+	Schema    map[string]any     // parameter schema from schema.json
+	Defaults  map[string]any     // values from defaults.yaml, if present
+	Templates *template.Template // files under templates/, named by their path there
+	Dir       string             // directory the pack was loaded from
+	Source    Source             // where a registry found the pack; empty if loaded directly
+}
+
+// Name returns the pack name.
+func (p *Pack) Name() string {
+	return p.Meta.Name
+}
+
+// Version returns the pack version.
+func (p *Pack) Version() string {
+	return p.Meta.Version
+}
+
+// PackMeta is the content of meta.yaml.
+type PackMeta struct {
+	Name          string       `yaml:"name" json:"name"`
+	Version       string       `yaml:"version" json:"version"`
+	Description   string       `yaml:"description,omitempty" json:"description,omitempty"`
+	Maintainer    string       `yaml:"maintainer,omitempty" json:"maintainer,omitempty"`
+	Tags          []string     `yaml:"tags,omitempty" json:"tags,omitempty"`
+	MinYarVersion string       `yaml:"minYarVersion,omitempty" json:"minYarVersion,omitempty"`
+	Dependencies  []Dependency `yaml:"dependencies,omitempty" json:"dependencies,omitempty"`
+}
+
+// Dependency is a pack a pack brings along. Each service using the pack
+// gets a service of the dependency's pack next to it, named
+// <service>-<name> (see DependencyService), which it requires. That
+// service's params are Params, overridden by the params.<name> object of
+// the service using the pack.
+type Dependency struct {
+	Name    string         `yaml:"name,omitempty" json:"name,omitempty"`       // scopes the service name and params key; defaults to Pack
+	Pack    string         `yaml:"pack" json:"pack"`                           // pack name, resolved like a service's
+	Version string         `yaml:"version,omitempty" json:"version,omitempty"` // version constraint, such as ^1.2
+	Params  map[string]any `yaml:"params,omitempty" json:"params,omitempty"`
+}
+
+// DependencyService returns the name of the service dependency dep of
+// the pack of service runs as.
+func DependencyService(service string, dep Dependency) string {
+	return service + "-" + dep.Name
+}
+
+// Resources is a rendered templates/resources.yaml document.
+type Resources struct {
+	APIVersion string           `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string           `yaml:"kind" json:"kind"`
+	Metadata   ResourceMetadata `yaml:"metadata" json:"metadata"`
+	Spec       PackSpec         `yaml:"spec" json:"spec"`
+}
+
+// ResourceMetadata identifies a rendered pack document.
+type ResourceMetadata struct {
+	Name string `yaml:"name" json:"name"`
+}
+
+// PackSpec is what a pack runs for a service.
+type PackSpec struct {
+	Containers []Container   `yaml:"containers,omitempty" json:"containers,omitempty"`
+	Services   []ServiceSpec `yaml:"services,omitempty" json:"services,omitempty"`
+	ConfigMaps []ConfigMap   `yaml:"configMaps,omitempty" json:"configMaps,omitempty"`
+	Ingress    []Ingress     `yaml:"ingress,omitempty" json:"ingress,omitempty"`
+	Jobs       []*config.Job `yaml:"jobs,omitempty" json:"jobs,omitempty"` // run with the service's own jobs, see ServiceJobs
+}
+
+// Container is a container of a pack.
+type Container struct {
+	Name           string                `yaml:"name" json:"name"`
+	Image          string                `yaml:"image" json:"image"`
+	Command        []string              `yaml:"command,omitempty" json:"command,omitempty"`
+	Args           []string              `yaml:"args,omitempty" json:"args,omitempty"`
+	Ports          []Port                `yaml:"ports,omitempty" json:"ports,omitempty"`
+	Env            []EnvVar              `yaml:"env,omitempty" json:"env,omitempty"`
+	Volumes        []Volume              `yaml:"volumes,omitempty" json:"volumes,omitempty"`
+	Resources      *ResourceRequirements `yaml:"resources,omitempty" json:"resources,omitempty"`
+	LivenessProbe  *Probe                `yaml:"livenessProbe,omitempty" json:"livenessProbe,omitempty"`
+	ReadinessProbe *Probe                `yaml:"readinessProbe,omitempty" json:"readinessProbe,omitempty"`
+}
+
+// Port protocols.
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
+// Port is a container port.
+type Port struct {
+	ContainerPort int    `yaml:"containerPort" json:"containerPort"`
+	HostPort      int    `yaml:"hostPort,omitempty" json:"hostPort,omitempty"`
+	Protocol      string `yaml:"protocol,omitempty" json:"protocol,omitempty"` // ProtocolTCP (default) or ProtocolUDP
+}
+
+// EnvVar is an environment variable with a literal value or a secret
+// reference.
+type EnvVar struct {
+	Name      string `yaml:"name" json:"name"`
+	Value     string `yaml:"value,omitempty" json:"value,omitempty"`
+	SecretRef string `yaml:"secretRef,omitempty" json:"secretRef,omitempty"`
+}
+
+// Volume is a mount with inline content or persistent storage.
+type Volume struct {
+	Name       string `yaml:"name" json:"name"`
+	MountPath  string `yaml:"mountPath" json:"mountPath"`
+	Content    string `yaml:"content,omitempty" json:"content,omitempty"`
+	Persistent bool   `yaml:"persistent,omitempty" json:"persistent,omitempty"`
+	Size       string `yaml:"size,omitempty" json:"size,omitempty"`
+}
+
+// ResourceRequirements are a container's resource requests and limits.
+type ResourceRequirements struct {
+	Requests ResourceList `yaml:"requests,omitempty" json:"requests,omitempty"`
+	Limits   ResourceList `yaml:"limits,omitempty" json:"limits,omitempty"`
+}
+
+// ResourceList is an amount of memory and CPU.
+type ResourceList struct {
+	Memory string `yaml:"memory,omitempty" json:"memory,omitempty"`
+	CPU    string `yaml:"cpu,omitempty" json:"cpu,omitempty"`
+}
+
+// Probe is a container health check.
+type Probe struct {
+	HTTPGet             *HTTPGetAction   `yaml:"httpGet,omitempty" json:"httpGet,omitempty"`
+	TCPSocket           *TCPSocketAction `yaml:"tcpSocket,omitempty" json:"tcpSocket,omitempty"`
+	InitialDelaySeconds int              `yaml:"initialDelaySeconds,omitempty" json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int              `yaml:"periodSeconds,omitempty" json:"periodSeconds,omitempty"`
+}
+
+// HTTPGetAction probes with an HTTP GET request.
+type HTTPGetAction struct {
+	Path string `yaml:"path" json:"path"`
+	Port int    `yaml:"port" json:"port"`
+}
+
+// TCPSocketAction probes by opening a TCP connection.
+type TCPSocketAction struct {
+	Port int `yaml:"port" json:"port"`
+}
+
+// Service types.
+const (
+	ServiceClusterIP    = "ClusterIP"
+	ServiceNodePort     = "NodePort"
+	ServiceLoadBalancer = "LoadBalancer"
+)
+
+// ServiceSpec exposes a container port inside the fleet.
+type ServiceSpec struct {
+	Name       string `yaml:"name" json:"name"`
+	Port       int    `yaml:"port" json:"port"`
+	TargetPort int    `yaml:"targetPort,omitempty" json:"targetPort,omitempty"`
+	Type       string `yaml:"type,omitempty" json:"type,omitempty"` // ServiceClusterIP (default), ServiceNodePort or ServiceLoadBalancer
+}
+
+// ConfigMap is a set of files mounted into containers.
+type ConfigMap struct {
+	Name string            `yaml:"name" json:"name"`
+	Data map[string]string `yaml:"data" json:"data"`
+}
+
+// Ingress routes external traffic to a service.
+type Ingress struct {
+	Name        string `yaml:"name" json:"name"`
+	Host        string `yaml:"host" json:"host"`
+	Path        string `yaml:"path,omitempty" json:"path,omitempty"`
+	ServiceName string `yaml:"serviceName" json:"serviceName"`
+	ServicePort int    `yaml:"servicePort" json:"servicePort"`
+	TLS         bool   `yaml:"tls,omitempty" json:"tls,omitempty"`
+}
@@ -0,0 +1,290 @@
+package packs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version. Build metadata is dropped, as it
+// does not take part in precedence.
+type semver struct {
+	major, minor, patch int
+	pre                 []string
+}
+
+// parseSemver parses a semantic version, with or without a leading v.
+func parseSemver(v string) (semver, bool) {
+	v = strings.TrimPrefix(v, "v")
+	if !ValidVersion(v) {
+		return semver{}, false
+	}
+	v, _, _ = strings.Cut(v, "+")
+	core, pre, hasPre := strings.Cut(v, "-")
+	parts := strings.Split(core, ".")
+	var s semver
+	s.major, _ = strconv.Atoi(parts[0])
+	s.minor, _ = strconv.Atoi(parts[1])
+	s.patch, _ = strconv.Atoi(parts[2])
+	if hasPre {
+		s.pre = strings.Split(pre, ".")
+	}
+	return s, true
+}
+
+// compare returns -1, 0 or 1 as s has lower, equal or higher precedence
+// than o.
+func (s semver) compare(o semver) int {
+	for _, d := range [3]int{s.major - o.major, s.minor - o.minor, s.patch - o.patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case len(s.pre) == 0 && len(o.pre) == 0:
+		return 0
+	case len(s.pre) == 0:
+		return 1
+	case len(o.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(s.pre) && i < len(o.pre); i++ {
+		a, aErr := strconv.Atoi(s.pre[i])
+		b, bErr := strconv.Atoi(o.pre[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if a != b {
+				return sign(a - b)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(s.pre[i], o.pre[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(s.pre) - len(o.pre))
+}
+
+func (s semver) sameCore(o semver) bool {
+	return s.major == o.major && s.minor == o.minor && s.patch == o.patch
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// CompareVersions compares two semantic versions by precedence, returning
+// -1, 0 or 1. Invalid versions sort before valid ones.
+func CompareVersions(a, b string) int {
+	va, okA := parseSemver(a)
+	vb, okB := parseSemver(b)
+	switch {
+	case okA && okB:
+		return va.compare(vb)
+	case okA:
+		return 1
+	case okB:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+// Constraint is a set of acceptable pack versions, written like npm
+// ranges:
+//
+//	1.2.3, =1.2.3      exactly 1.2.3
+//	1.2, 1.2.x         any 1.2 patch
+//	^1.2               >=1.2.0 <2.0.0 (^0.2 is >=0.2.0 <0.3.0)
+//	~1.2.3             >=1.2.3 <1.3.0
+//	>=1.2 <1.5, !=1.3.0  every comparison must hold
+//	^1 || ^2           either range
+//	*                  any version
+//
+// Pre-releases match only comparisons naming a pre-release of the same
+// version, so ^1.2 does not pick up 1.3.0-rc.1.
+type Constraint struct {
+	raw  string
+	sets [][]comparison // any set whose comparisons all hold
+}
+
+type comparison struct {
+	op string // =, !=, >, >=, <, <=
+	v  semver
+}
+
+var constraintTermPattern = regexp.MustCompile(`^(\^|~|!=|>=|<=|>|<|=)?v?([0-9]+|[xX*])(?:\.([0-9]+|[xX*]))?(?:\.([0-9]+|[xX*]))?(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// ParseConstraint parses a version constraint.
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{raw: strings.TrimSpace(s)}
+	if c.raw == "" {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+	for _, set := range strings.Split(c.raw, "||") {
+		// Operators may be separated from their versions: ">= 1.2".
+		fields := strings.FieldsFunc(set, func(r rune) bool { return r == ' ' || r == ',' })
+		var terms []string
+		for i := 0; i < len(fields); i++ {
+			f := fields[i]
+			if strings.Trim(f, "^~!=<>") == "" && i+1 < len(fields) {
+				f += fields[i+1]
+				i++
+			}
+			terms = append(terms, f)
+		}
+		if len(terms) == 0 {
+			return nil, fmt.Errorf("invalid version constraint %q: empty range", c.raw)
+		}
+		var comparisons []comparison
+		for _, term := range terms {
+			cs, err := parseConstraintTerm(term)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraint %q: %w", c.raw, err)
+			}
+			comparisons = append(comparisons, cs...)
+		}
+		c.sets = append(c.sets, comparisons)
+	}
+	return c, nil
+}
+
+// parseConstraintTerm turns one term into the comparisons it stands for.
+func parseConstraintTerm(term string) ([]comparison, error) {
+	m := constraintTermPattern.FindStringSubmatch(term)
+	if m == nil {
+		return nil, fmt.Errorf("%q is not a version or a version comparison", term)
+	}
+	op := m[1]
+	// The number of leading version parts given; x and * end them.
+	parts := [3]int{}
+	given := 0
+	for i, p := range m[2:5] {
+		if p == "" || p == "x" || p == "X" || p == "*" {
+			break
+		}
+		parts[i], _ = strconv.Atoi(p)
+		given = i + 1
+	}
+	v := semver{major: parts[0], minor: parts[1], patch: parts[2]}
+	if m[5] != "" {
+		if given < 3 {
+			return nil, fmt.Errorf("%q: a pre-release needs a full version", term)
+		}
+		v.pre = strings.Split(m[5][1:], ".")
+	}
+	if given == 0 {
+		if op != "" && op != "=" && op != ">=" {
+			return nil, fmt.Errorf("%q matches no version", term)
+		}
+		return nil, nil // any version
+	}
+
+	// next returns the lowest version above every version with the first
+	// n parts of v.
+	next := func(n int) semver {
+		switch n {
+		case 1:
+			return semver{major: v.major + 1}
+		case 2:
+			return semver{major: v.major, minor: v.minor + 1}
+		}
+		return semver{major: v.major, minor: v.minor, patch: v.patch + 1}
+	}
+	upTo := func(upper semver) []comparison {
+		return []comparison{{">=", v}, {"<", upper}}
+	}
+
+	switch op {
+	case "^":
+		switch {
+		case v.major > 0 || given == 1:
+			return upTo(next(1)), nil
+		case v.minor > 0 || given == 2:
+			return upTo(next(2)), nil
+		}
+		return upTo(next(3)), nil
+	case "~":
+		if given == 1 {
+			return upTo(next(1)), nil
+		}
+		return upTo(next(2)), nil
+	case "", "=":
+		if given < 3 {
+			return upTo(next(given)), nil
+		}
+		return []comparison{{"=", v}}, nil
+	case "!=":
+		if given < 3 {
+			return nil, fmt.Errorf("%q: != needs a full version", term)
+		}
+		return []comparison{{"!=", v}}, nil
+	case ">":
+		if given < 3 {
+			return []comparison{{">=", next(given)}}, nil
+		}
+	case "<=":
+		if given < 3 {
+			return []comparison{{"<", next(given)}}, nil
+		}
+	}
+	return []comparison{{op, v}}, nil
+}
+
+// String returns the constraint as written.
+func (c *Constraint) String() string {
+	return c.raw
+}
+
+// Check reports whether version satisfies the constraint.
+func (c *Constraint) Check(version string) bool {
+	v, ok := parseSemver(version)
+	if !ok {
+		return false
+	}
+	for _, set := range c.sets {
+		if checkSet(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkSet(set []comparison, v semver) bool {
+	preAllowed := len(v.pre) == 0
+	for _, cmp := range set {
+		if len(cmp.v.pre) > 0 && cmp.v.sameCore(v) {
+			preAllowed = true
+		}
+		d := v.compare(cmp.v)
+		var ok bool
+		switch cmp.op {
+		case "=":
+			ok = d == 0
+		case "!=":
+			ok = d != 0
+		case ">":
+			ok = d > 0
+		case ">=":
+			ok = d >= 0
+		case "<":
+			ok = d < 0
+		case "<=":
+			ok = d <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return preAllowed
+}
@@ -0,0 +1,77 @@
+package packs
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompareVersions(t *testing.T) {
+	// Ascending precedence, from the semver specification's examples.
+	versions := []string{
+		"bogus",
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0",
+		"1.2.0", "v1.10.0", "2.0.0",
+	}
+	shuffled := append([]string(nil), versions...)
+	sort.Slice(shuffled, func(i, j int) bool { return shuffled[i] > shuffled[j] })
+	sort.Slice(shuffled, func(i, j int) bool { return CompareVersions(shuffled[i], shuffled[j]) < 0 })
+	if diff := cmp.Diff(versions, shuffled); diff != "" {
+		t.Errorf("versions sorted by CompareVersions (-want +got):\n%s", diff)
+	}
+	if CompareVersions("1.0.0+build.1", "1.0.0") != 0 {
+		t.Error("build metadata takes part in precedence")
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{"1.2.3", []string{"1.2.3", "1.2.3+build"}, []string{"1.2.4", "1.2.3-rc.1"}},
+		{"=1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0", "1.1.9"}},
+		{"1.x", []string{"1.0.0", "1.9.9"}, []string{"2.0.0", "0.9.0"}},
+		{"*", []string{"0.0.1", "9.0.0"}, []string{"2.0.0-rc.1"}},
+		{"^1.2", []string{"1.2.0", "1.9.0"}, []string{"1.1.9", "2.0.0", "1.3.0-rc.1"}},
+		{"^1.2.3", []string{"1.2.3", "1.4.0"}, []string{"1.2.2", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"^0", []string{"0.0.1", "0.9.0"}, []string{"1.0.0"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0", "1.2.2"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{">=1.2 <1.5", []string{"1.2.0", "1.4.9"}, []string{"1.5.0", "1.1.0"}},
+		{">= 1.2, < 1.5, != 1.3.0", []string{"1.2.0", "1.3.1"}, []string{"1.3.0"}},
+		{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+		{"<=1.2", []string{"1.2.9"}, []string{"1.3.0"}},
+		{"^1 || ^3", []string{"1.5.0", "3.0.0"}, []string{"2.0.0"}},
+		{"^2.0.0-rc.1", []string{"2.0.0-rc.2", "2.0.0", "2.1.0"}, []string{"2.1.0-rc.1", "2.0.0-beta"}},
+		{"v1.2.3", []string{"1.2.3"}, nil},
+	}
+	for _, tc := range tests {
+		c, err := ParseConstraint(tc.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q) error = %v", tc.constraint, err)
+			continue
+		}
+		for _, v := range tc.match {
+			if !c.Check(v) {
+				t.Errorf("%q does not match %s", tc.constraint, v)
+			}
+		}
+		for _, v := range tc.noMatch {
+			if c.Check(v) {
+				t.Errorf("%q matches %s", tc.constraint, v)
+			}
+		}
+	}
+
+	for _, s := range []string{"", "latest", "^", ">=1.2 ||", "1.2-rc.1", "!=1.2", ">*", "^1.2.3.4"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q) error = nil", s)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitBranch returns the branch checked out in the git work tree containing
+// dir. HEAD is read directly, so git need not be installed. It returns ""
+// if HEAD is detached, and an error if dir is not inside a work tree.
+func GitBranch(dir string) (string, error) {
+	start, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for dir = start; ; {
+		gitPath := filepath.Join(dir, ".git")
+		info, err := os.Stat(gitPath)
+		if err == nil {
+			gitDir := gitPath
+			if !info.IsDir() {
+				// Linked work trees and submodules have a .git file
+				// pointing at the real git directory.
+				data, err := os.ReadFile(gitPath)
+				if err != nil {
+					return "", err
+				}
+				target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+				if !ok {
+					return "", fmt.Errorf("%s: not a gitdir file", gitPath)
+				}
+				gitDir = strings.TrimSpace(target)
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+			}
+
+			head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+			if err != nil {
+				return "", err
+			}
+			branch, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+			if !ok {
+				return "", nil // Detached
+			}
+			return branch, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("%s is not inside a git work tree", start)
+		}
+		dir = parent
+	}
+}
@@ -1,11 +1,14 @@
 package platform
 
 import (
+	"context"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestPlatform(t *testing.T) {
@@ -235,3 +238,100 @@ func TestExpandPath(t *testing.T) {
 		}
 	})
 }
+
+func TestProcessAlive(t *testing.T) {
+	if !ProcessAlive(os.Getpid()) {
+		t.Error("ProcessAlive(own pid) = false, want true")
+	}
+	if ProcessAlive(0) || ProcessAlive(-1) {
+		t.Error("ProcessAlive(invalid pid) = true, want false")
+	}
+
+	// A child that has exited and been reaped no longer exists.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("running child: %v", err)
+	}
+	if ProcessAlive(cmd.Process.Pid) {
+		t.Errorf("ProcessAlive(%d) = true for an exited child", cmd.Process.Pid)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are Unix only")
+	}
+	out, err := ShellCommand(context.Background(), "echo $((1+2))").Output()
+	if err != nil || strings.TrimSpace(string(out)) != "3" {
+		t.Fatalf("ShellCommand(echo) = %q, %v, want 3", out, err)
+	}
+
+	// Cancellation kills commands the shell started too, so Wait returns
+	// without waiting for them to release the output pipe.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	cmd := ShellCommand(ctx, "sleep 10 & wait")
+	var stdout strings.Builder
+	cmd.Stdout = &stdout
+	start := time.Now()
+	if err := cmd.Run(); err == nil {
+		t.Error("Run() after cancellation succeeded, want error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run() took %s after cancellation", elapsed)
+	}
+}
+
+func TestGitBranch(t *testing.T) {
+	write := func(t *testing.T, path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("reads the branch from a subdirectory", func(t *testing.T) {
+		root := t.TempDir()
+		write(t, filepath.Join(root, ".git", "HEAD"), "ref: refs/heads/feature/ABC-123\n")
+		sub := filepath.Join(root, "services", "api")
+		os.MkdirAll(sub, 0755)
+
+		got, err := GitBranch(sub)
+		if err != nil {
+			t.Fatalf("GitBranch() error = %v", err)
+		}
+		if got != "feature/ABC-123" {
+			t.Errorf("GitBranch() = %q, want feature/ABC-123", got)
+		}
+	})
+
+	t.Run("follows a linked work tree", func(t *testing.T) {
+		root := t.TempDir()
+		write(t, filepath.Join(root, "repo", ".git", "worktrees", "wt", "HEAD"), "ref: refs/heads/review\n")
+		write(t, filepath.Join(root, "wt", ".git"), "gitdir: ../repo/.git/worktrees/wt\n")
+
+		got, err := GitBranch(filepath.Join(root, "wt"))
+		if err != nil || got != "review" {
+			t.Errorf("GitBranch() = %q, %v, want review", got, err)
+		}
+	})
+
+	t.Run("detached HEAD", func(t *testing.T) {
+		root := t.TempDir()
+		write(t, filepath.Join(root, ".git", "HEAD"), "3f1c2a9d0e5b7c4a1f2e3d4c5b6a79881726354a\n")
+
+		got, err := GitBranch(root)
+		if err != nil || got != "" {
+			t.Errorf("GitBranch() = %q, %v, want empty", got, err)
+		}
+	})
+
+	t.Run("outside a work tree", func(t *testing.T) {
+		if _, err := GitBranch(t.TempDir()); err == nil {
+			t.Error("GitBranch() error = nil, want error")
+		}
+	})
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package platform
+
+import (
+	"context"
+	stderrors "errors"
+	"os/exec"
+	"syscall"
+)
+
+// ProcessAlive reports whether a process with pid exists on this machine.
+// A process owned by another user counts as alive.
+func ProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || stderrors.Is(err, syscall.EPERM)
+}
+
+// ShellCommand returns a command running command through sh -c. It runs in
+// its own process group, which is killed as a whole when ctx is done, so
+// commands the shell started do not outlive it.
+func ShellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return cmd
+}
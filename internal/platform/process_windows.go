@@ -0,0 +1,45 @@
+//go:build windows
+
+package platform
+
+import (
+	"context"
+	stderrors "errors"
+	"os/exec"
+	"syscall"
+)
+
+const (
+	// processQueryLimitedInformation is PROCESS_QUERY_LIMITED_INFORMATION,
+	// which syscall does not define.
+	processQueryLimitedInformation = 0x1000
+
+	// stillActive is the exit code GetExitCodeProcess reports for a
+	// running process.
+	stillActive = 259
+)
+
+// ProcessAlive reports whether a process with pid exists on this machine.
+// A process owned by another user counts as alive.
+func ProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return stderrors.Is(err, syscall.ERROR_ACCESS_DENIED)
+	}
+	defer syscall.CloseHandle(h)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
+
+// ShellCommand returns a command running command through cmd /C, killed
+// when ctx is done.
+func ShellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}